@@ -0,0 +1,126 @@
+//-----------------------------------------------------------------------------
+/*
+
+Evaluation and Meshing Benchmarks
+
+*/
+//-----------------------------------------------------------------------------
+
+package bench
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// nPoints is the number of sample points for the evaluation benchmarks.
+const nPoints = 4096
+
+// meshCells are the fixed mesh resolutions (cells on the longest axis).
+var meshCells = []int{50, 100, 200}
+
+//-----------------------------------------------------------------------------
+
+func BenchmarkEvaluate2D(b *testing.B) {
+	for _, m := range Models2D() {
+		points := Points2(m.SDF, nPoints)
+		b.Run(m.Name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				m.SDF.Evaluate(points[i%nPoints])
+			}
+		})
+	}
+}
+
+func BenchmarkEvaluate3D(b *testing.B) {
+	for _, m := range Models3D() {
+		points := Points3(m.SDF, nPoints)
+		b.Run(m.Name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				m.SDF.Evaluate(points[i%nPoints])
+			}
+		})
+	}
+}
+
+func BenchmarkEvaluateN3D(b *testing.B) {
+	for _, m := range Models3D() {
+		points := Points3(m.SDF, nPoints)
+		out := make([]float64, nPoints)
+		b.Run(m.Name, func(b *testing.B) {
+			for i := 0; i < b.N; i += nPoints {
+				sdf.EvaluateN(m.SDF, points, out)
+			}
+		})
+	}
+}
+
+func BenchmarkEvaluateCompiled3D(b *testing.B) {
+	for _, m := range Models3D() {
+		s := sdf.Compile3D(m.SDF)
+		points := Points3(m.SDF, nPoints)
+		b.Run(m.Name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				s.Evaluate(points[i%nPoints])
+			}
+		})
+	}
+}
+
+func BenchmarkMarchingSquares(b *testing.B) {
+	for _, m := range Models2D() {
+		for _, cells := range meshCells {
+			b.Run(fmt.Sprintf("%s/%d", m.Name, cells), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					sdf.GenerateLines(m.SDF, cells)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkMarchingCubes(b *testing.B) {
+	for _, m := range Models3D() {
+		for _, cells := range meshCells {
+			b.Run(fmt.Sprintf("%s/%d", m.Name, cells), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					sdf.GenerateTriangles(m.SDF, cells)
+				}
+			})
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// The models are deterministic, the benchmarks measure the same work each run.
+func Test_Models(t *testing.T) {
+	for _, m := range Models2D() {
+		n0 := len(sdf.GenerateLines(m.SDF, 50))
+		n1 := len(sdf.GenerateLines(m.SDF, 50))
+		if n0 == 0 || n0 != n1 {
+			t.Errorf("FAIL %s %d %d", m.Name, n0, n1)
+		}
+		if Points2(m.SDF, 10)[9] != Points2(m.SDF, 10)[9] {
+			t.Errorf("FAIL %s", m.Name)
+		}
+	}
+	for _, m := range Models3D() {
+		mesh := sdf.GenerateTriangles(m.SDF, 50)
+		if len(mesh) == 0 || len(mesh) != len(sdf.GenerateTriangles(m.SDF, 50)) {
+			t.Errorf("FAIL %s", m.Name)
+		}
+		if s := sdf.MeshStats(mesh); s.OpenEdges != 0 {
+			t.Errorf("FAIL %s %d open edges", m.Name, s.OpenEdges)
+		}
+		if Points3(m.SDF, 10)[9] != Points3(m.SDF, 10)[9] {
+			t.Errorf("FAIL %s", m.Name)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
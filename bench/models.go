@@ -0,0 +1,141 @@
+//-----------------------------------------------------------------------------
+/*
+
+Benchmark Models
+
+Canonical models for measuring the performance of SDF evaluation and
+meshing. The models and the sample points are fixed, so benchmark results
+from different versions of the code can be compared with benchstat:
+
+	go test -run XXX -bench . -count 10 ./bench > old.txt
+	(make changes)
+	go test -run XXX -bench . -count 10 ./bench > new.txt
+	benchstat old.txt new.txt
+
+Don't change the models, add new ones. A changed model makes the old
+results meaningless.
+
+*/
+//-----------------------------------------------------------------------------
+
+package bench
+
+import (
+	"math/rand"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// Model2 is a named SDF2 benchmark model.
+type Model2 struct {
+	Name string
+	SDF  sdf.SDF2
+}
+
+// Model3 is a named SDF3 benchmark model.
+type Model3 struct {
+	Name string
+	SDF  sdf.SDF3
+}
+
+//-----------------------------------------------------------------------------
+
+// Gear2D returns a 20 tooth involute gear profile.
+func Gear2D() sdf.SDF2 {
+	return sdf.InvoluteGear(
+		20,           // number of teeth
+		2.0,          // gear module
+		sdf.DtoR(20), // pressure angle
+		0.1,          // backlash
+		0.25,         // clearance
+		5.0,          // ring width
+		7,            // facets
+	)
+}
+
+// Gear3D returns a 20 tooth involute gear, 10 mm thick.
+func Gear3D() sdf.SDF3 {
+	return sdf.Extrude3D(Gear2D(), 10)
+}
+
+// Bolt returns a 40 mm long M10 hex head bolt.
+func Bolt() sdf.SDF3 {
+	s, err := sdf.Bolt(&sdf.BoltParms{
+		Thread:      "M10x1.5",
+		Style:       "hex",
+		TotalLength: 40,
+		ShankLength: 10,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// LatticeCube returns a 40 mm cube of 4x4x4 cubic lattice cells with 2 mm struts.
+func LatticeCube() sdf.SDF3 {
+	const cells = 4
+	const pitch = 10.0
+	const strut = 2.0
+	size := cells * pitch
+	x := sdf.Box3D(sdf.V3{X: size, Y: strut, Z: strut}, 0)
+	y := sdf.Box3D(sdf.V3{X: strut, Y: size, Z: strut}, 0)
+	z := sdf.Box3D(sdf.V3{X: strut, Y: strut, Z: size}, 0)
+	// struts along each axis
+	offset := -0.5 * (cells - 1) * pitch
+	x = sdf.Transform3D(sdf.Array3D(x, sdf.V3i{1, cells, cells}, sdf.V3{X: 0, Y: pitch, Z: pitch}), sdf.Translate3d(sdf.V3{X: 0, Y: offset, Z: offset}))
+	y = sdf.Transform3D(sdf.Array3D(y, sdf.V3i{cells, 1, cells}, sdf.V3{X: pitch, Y: 0, Z: pitch}), sdf.Translate3d(sdf.V3{X: offset, Y: 0, Z: offset}))
+	z = sdf.Transform3D(sdf.Array3D(z, sdf.V3i{cells, cells, 1}, sdf.V3{X: pitch, Y: pitch, Z: 0}), sdf.Translate3d(sdf.V3{X: offset, Y: offset, Z: 0}))
+	return sdf.Union3D(x, y, z)
+}
+
+//-----------------------------------------------------------------------------
+
+// Models2D returns the SDF2 benchmark models.
+func Models2D() []Model2 {
+	return []Model2{
+		{"gear", Gear2D()},
+	}
+}
+
+// Models3D returns the SDF3 benchmark models.
+func Models3D() []Model3 {
+	return []Model3{
+		{"gear", Gear3D()},
+		{"bolt", Bolt()},
+		{"lattice", LatticeCube()},
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// seed is the random seed for the sample points.
+const seed = 1
+
+// Points2 returns n fixed sample points over a region larger than the bounding box.
+func Points2(s sdf.SDF2, n int) []sdf.V2 {
+	r := rand.New(rand.NewSource(seed))
+	bb := s.BoundingBox().ScaleAboutCenter(1.2)
+	size := bb.Size()
+	p := make([]sdf.V2, n)
+	for i := range p {
+		p[i] = bb.Min.Add(sdf.V2{X: r.Float64() * size.X, Y: r.Float64() * size.Y})
+	}
+	return p
+}
+
+// Points3 returns n fixed sample points over a region larger than the bounding box.
+func Points3(s sdf.SDF3, n int) []sdf.V3 {
+	r := rand.New(rand.NewSource(seed))
+	bb := s.BoundingBox().ScaleAboutCenter(1.2)
+	size := bb.Size()
+	p := make([]sdf.V3, n)
+	for i := range p {
+		p[i] = bb.Min.Add(sdf.V3{X: r.Float64() * size.X, Y: r.Float64() * size.Y, Z: r.Float64() * size.Z})
+	}
+	return p
+}
+
+//-----------------------------------------------------------------------------
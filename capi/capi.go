@@ -0,0 +1,502 @@
+//-----------------------------------------------------------------------------
+/*
+
+C API
+
+Build the sdf package as a C shared library:
+
+	go build -buildmode=c-shared -o libsdfx.so ./capi
+
+SDF objects and meshes are referred to by integer handles. A handle of 0
+(or a return value of -1, or NaN for evaluation) indicates an error,
+sdfx_error() returns a copy of the description of the error from the last
+call (NULL if it succeeded), which the caller releases with
+sdfx_free_string(). Bad parameters (which panic in the sdf package) are
+returned as errors, they don't crash the host process. Arrays passed by the
+caller are limited to 1<<28 elements.
+Handles are released with sdfx_free().
+
+See sdfx.py for a Python wrapper.
+
+*/
+//-----------------------------------------------------------------------------
+
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"unsafe"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+// Handles
+
+var (
+	lock    sync.Mutex
+	objects = make(map[C.int]interface{})
+	next    C.int
+	lastErr string
+)
+
+// newHandle stores an object and returns its handle (0 on error).
+func newHandle(x interface{}, err error) C.int {
+	lock.Lock()
+	defer lock.Unlock()
+	if err == nil && x == nil {
+		err = errors.New("nil object")
+	}
+	if err != nil {
+		setError(err)
+		return 0
+	}
+	next++
+	objects[next] = x
+	return next
+}
+
+// setError records the last error. Call with the lock held.
+func setError(err error) {
+	lastErr = err.Error()
+}
+
+// clearError clears the error from a previous call.
+func clearError() {
+	lock.Lock()
+	defer lock.Unlock()
+	lastErr = ""
+}
+
+// maxArray is the maximum length of an array passed by the caller.
+const maxArray = 1 << 28
+
+// doubles returns a slice for an array of n doubles passed by the caller.
+func doubles(p *C.double, n int) ([]C.double, error) {
+	if p == nil || n < 0 || n > maxArray {
+		return nil, fmt.Errorf("bad array (%d doubles)", n)
+	}
+	return (*[maxArray]C.double)(unsafe.Pointer(p))[:n:n], nil
+}
+
+// floats returns a slice for an array of n floats passed by the caller.
+func floats(p *C.float, n int) ([]C.float, error) {
+	if p == nil || n < 0 || n > maxArray {
+		return nil, fmt.Errorf("bad array (%d floats)", n)
+	}
+	return (*[maxArray]C.float)(unsafe.Pointer(p))[:n:n], nil
+}
+
+// fail records an error and returns -1 (the error value for non-handle results).
+func fail(err error) C.int {
+	lock.Lock()
+	defer lock.Unlock()
+	setError(err)
+	return -1
+}
+
+// recoverError records the error for a recovered panic.
+func recoverError(r interface{}) {
+	lock.Lock()
+	defer lock.Unlock()
+	setError(fmt.Errorf("%v", r))
+}
+
+// recoverHandle recovers from a panic (e.g. a bad constructor parameter),
+// records the error and returns a 0 handle. Call it with defer.
+func recoverHandle(handle *C.int) {
+	if r := recover(); r != nil {
+		recoverError(r)
+		*handle = 0
+	}
+}
+
+// recoverResult recovers from a panic, records the error and returns -1.
+// Call it with defer.
+func recoverResult(rc *C.int) {
+	if r := recover(); r != nil {
+		recoverError(r)
+		*rc = -1
+	}
+}
+
+// recoverDouble recovers from a panic, records the error and returns NaN.
+// Call it with defer.
+func recoverDouble(d *C.double) {
+	if r := recover(); r != nil {
+		recoverError(r)
+		*d = C.double(math.NaN())
+	}
+}
+
+// lookup returns the object for a handle.
+func lookup(h C.int) (interface{}, error) {
+	lock.Lock()
+	defer lock.Unlock()
+	x, ok := objects[h]
+	if !ok {
+		return nil, fmt.Errorf("bad handle %d", h)
+	}
+	return x, nil
+}
+
+// lookup3 returns the SDF3 for a handle.
+func lookup3(h C.int) (sdf.SDF3, error) {
+	x, err := lookup(h)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := x.(sdf.SDF3)
+	if !ok {
+		return nil, fmt.Errorf("handle %d is not an SDF3", h)
+	}
+	return s, nil
+}
+
+// lookup2 returns the SDF2 for a handle.
+func lookup2(h C.int) (sdf.SDF2, error) {
+	x, err := lookup(h)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := x.(sdf.SDF2)
+	if !ok {
+		return nil, fmt.Errorf("handle %d is not an SDF2", h)
+	}
+	return s, nil
+}
+
+// sdfx_error returns a copy of the error from the last call (NULL if there is none).
+// The caller owns the string and releases it with sdfx_free_string().
+//
+//export sdfx_error
+func sdfx_error() *C.char {
+	lock.Lock()
+	defer lock.Unlock()
+	if lastErr == "" {
+		return nil
+	}
+	return C.CString(lastErr)
+}
+
+// sdfx_free_string releases a string returned by the library.
+//
+//export sdfx_free_string
+func sdfx_free_string(p *C.char) {
+	C.free(unsafe.Pointer(p))
+}
+
+//export sdfx_free
+func sdfx_free(h C.int) {
+	lock.Lock()
+	defer lock.Unlock()
+	lastErr = ""
+	delete(objects, h)
+}
+
+//-----------------------------------------------------------------------------
+// 2D Primitives
+
+//export sdfx_circle2d
+func sdfx_circle2d(radius C.double) (handle C.int) {
+	defer recoverHandle(&handle)
+	clearError()
+	return newHandle(sdf.Circle2D(float64(radius)), nil)
+}
+
+//export sdfx_box2d
+func sdfx_box2d(x, y, round C.double) (handle C.int) {
+	defer recoverHandle(&handle)
+	clearError()
+	return newHandle(sdf.Box2D(sdf.V2{X: float64(x), Y: float64(y)}, float64(round)), nil)
+}
+
+//export sdfx_polygon2d
+func sdfx_polygon2d(xy *C.double, n C.int) (handle C.int) {
+	defer recoverHandle(&handle)
+	clearError()
+	if n < 3 {
+		return newHandle(nil, errors.New("polygon needs >= 3 vertices"))
+	}
+	c, err := doubles(xy, 2*int(n))
+	if err != nil {
+		return newHandle(nil, err)
+	}
+	v := make([]sdf.V2, n)
+	for i := range v {
+		v[i] = sdf.V2{X: float64(c[2*i]), Y: float64(c[2*i+1])}
+	}
+	return newHandle(sdf.Polygon2D(v), nil)
+}
+
+//-----------------------------------------------------------------------------
+// 3D Primitives
+
+//export sdfx_sphere3d
+func sdfx_sphere3d(radius C.double) (handle C.int) {
+	defer recoverHandle(&handle)
+	clearError()
+	return newHandle(sdf.Sphere3D(float64(radius)), nil)
+}
+
+//export sdfx_box3d
+func sdfx_box3d(x, y, z, round C.double) (handle C.int) {
+	defer recoverHandle(&handle)
+	clearError()
+	return newHandle(sdf.Box3D(sdf.V3{X: float64(x), Y: float64(y), Z: float64(z)}, float64(round)), nil)
+}
+
+//export sdfx_cylinder3d
+func sdfx_cylinder3d(height, radius, round C.double) (handle C.int) {
+	defer recoverHandle(&handle)
+	clearError()
+	return newHandle(sdf.Cylinder3D(float64(height), float64(radius), float64(round)), nil)
+}
+
+//export sdfx_cone3d
+func sdfx_cone3d(height, r0, r1, round C.double) (handle C.int) {
+	defer recoverHandle(&handle)
+	clearError()
+	return newHandle(sdf.Cone3D(float64(height), float64(r0), float64(r1), float64(round)), nil)
+}
+
+//-----------------------------------------------------------------------------
+// 2D to 3D
+
+//export sdfx_extrude3d
+func sdfx_extrude3d(h C.int, height C.double) (handle C.int) {
+	defer recoverHandle(&handle)
+	clearError()
+	s, err := lookup2(h)
+	if err != nil {
+		return newHandle(nil, err)
+	}
+	return newHandle(sdf.Extrude3D(s, float64(height)), nil)
+}
+
+//export sdfx_revolve3d
+func sdfx_revolve3d(h C.int, theta C.double) (handle C.int) {
+	defer recoverHandle(&handle)
+	clearError()
+	s, err := lookup2(h)
+	if err != nil {
+		return newHandle(nil, err)
+	}
+	return newHandle(sdf.RevolveTheta3D(s, float64(theta)), nil)
+}
+
+//-----------------------------------------------------------------------------
+// CSG Operations
+
+//export sdfx_union3d
+func sdfx_union3d(a, b C.int) (handle C.int) {
+	defer recoverHandle(&handle)
+	clearError()
+	s0, err := lookup3(a)
+	if err != nil {
+		return newHandle(nil, err)
+	}
+	s1, err := lookup3(b)
+	if err != nil {
+		return newHandle(nil, err)
+	}
+	return newHandle(sdf.Union3D(s0, s1), nil)
+}
+
+//export sdfx_difference3d
+func sdfx_difference3d(a, b C.int) (handle C.int) {
+	defer recoverHandle(&handle)
+	clearError()
+	s0, err := lookup3(a)
+	if err != nil {
+		return newHandle(nil, err)
+	}
+	s1, err := lookup3(b)
+	if err != nil {
+		return newHandle(nil, err)
+	}
+	return newHandle(sdf.Difference3D(s0, s1), nil)
+}
+
+//export sdfx_intersect3d
+func sdfx_intersect3d(a, b C.int) (handle C.int) {
+	defer recoverHandle(&handle)
+	clearError()
+	s0, err := lookup3(a)
+	if err != nil {
+		return newHandle(nil, err)
+	}
+	s1, err := lookup3(b)
+	if err != nil {
+		return newHandle(nil, err)
+	}
+	return newHandle(sdf.Intersect3D(s0, s1), nil)
+}
+
+//-----------------------------------------------------------------------------
+// Transforms
+
+//export sdfx_translate3d
+func sdfx_translate3d(h C.int, x, y, z C.double) (handle C.int) {
+	defer recoverHandle(&handle)
+	clearError()
+	s, err := lookup3(h)
+	if err != nil {
+		return newHandle(nil, err)
+	}
+	m := sdf.Translate3d(sdf.V3{X: float64(x), Y: float64(y), Z: float64(z)})
+	return newHandle(sdf.Transform3D(s, m), nil)
+}
+
+//export sdfx_rotate3d
+func sdfx_rotate3d(h C.int, x, y, z, theta C.double) (handle C.int) {
+	defer recoverHandle(&handle)
+	clearError()
+	s, err := lookup3(h)
+	if err != nil {
+		return newHandle(nil, err)
+	}
+	m := sdf.Rotate3d(sdf.V3{X: float64(x), Y: float64(y), Z: float64(z)}, float64(theta))
+	return newHandle(sdf.Transform3D(s, m), nil)
+}
+
+//export sdfx_scale3d
+func sdfx_scale3d(h C.int, k C.double) (handle C.int) {
+	defer recoverHandle(&handle)
+	clearError()
+	s, err := lookup3(h)
+	if err != nil {
+		return newHandle(nil, err)
+	}
+	return newHandle(sdf.ScaleUniform3D(s, float64(k)), nil)
+}
+
+//-----------------------------------------------------------------------------
+// Evaluation
+
+//export sdfx_evaluate3d
+func sdfx_evaluate3d(h C.int, x, y, z C.double) (d C.double) {
+	defer recoverDouble(&d)
+	clearError()
+	s, err := lookup3(h)
+	if err != nil {
+		fail(err)
+		return C.double(math.NaN())
+	}
+	return C.double(s.Evaluate(sdf.V3{X: float64(x), Y: float64(y), Z: float64(z)}))
+}
+
+//export sdfx_bounds3d
+func sdfx_bounds3d(h C.int, out *C.double) (rc C.int) {
+	defer recoverResult(&rc)
+	clearError()
+	s, err := lookup3(h)
+	if err != nil {
+		return fail(err)
+	}
+	bb := s.BoundingBox()
+	c, err := doubles(out, 6)
+	if err != nil {
+		return fail(err)
+	}
+	c[0], c[1], c[2] = C.double(bb.Min.X), C.double(bb.Min.Y), C.double(bb.Min.Z)
+	c[3], c[4], c[5] = C.double(bb.Max.X), C.double(bb.Max.Y), C.double(bb.Max.Z)
+	return 0
+}
+
+//-----------------------------------------------------------------------------
+// Meshing and Export
+
+//export sdfx_mesh3d
+func sdfx_mesh3d(h C.int, cells C.int) (handle C.int) {
+	defer recoverHandle(&handle)
+	clearError()
+	s, err := lookup3(h)
+	if err != nil {
+		return newHandle(nil, err)
+	}
+	if cells <= 0 {
+		return newHandle(nil, errors.New("cells must be > 0"))
+	}
+	return newHandle(sdf.GenerateTriangles(s, int(cells)), nil)
+}
+
+// lookupMesh returns the triangle mesh for a handle.
+func lookupMesh(h C.int) ([]*sdf.Triangle3, error) {
+	x, err := lookup(h)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := x.([]*sdf.Triangle3)
+	if !ok {
+		return nil, fmt.Errorf("handle %d is not a mesh", h)
+	}
+	return m, nil
+}
+
+//export sdfx_mesh_triangles
+func sdfx_mesh_triangles(h C.int) (rc C.int) {
+	defer recoverResult(&rc)
+	clearError()
+	m, err := lookupMesh(h)
+	if err != nil {
+		return fail(err)
+	}
+	return C.int(len(m))
+}
+
+// sdfx_mesh_vertices copies the mesh vertices (9 floats per triangle) to out,
+// which has room for size floats.
+//
+//export sdfx_mesh_vertices
+func sdfx_mesh_vertices(h C.int, out *C.float, size C.int) (rc C.int) {
+	defer recoverResult(&rc)
+	clearError()
+	m, err := lookupMesh(h)
+	if err != nil {
+		return fail(err)
+	}
+	n := 9 * len(m)
+	if int(size) < n {
+		return fail(fmt.Errorf("buffer too small (%d floats, need %d)", size, n))
+	}
+	c, err := floats(out, n)
+	if err != nil {
+		return fail(err)
+	}
+	for i, t := range m {
+		for j, v := range t.V {
+			k := 9*i + 3*j
+			c[k], c[k+1], c[k+2] = C.float(v.X), C.float(v.Y), C.float(v.Z)
+		}
+	}
+	return 0
+}
+
+//export sdfx_save_stl
+func sdfx_save_stl(h C.int, path *C.char) (rc C.int) {
+	defer recoverResult(&rc)
+	clearError()
+	m, err := lookupMesh(h)
+	if err != nil {
+		return fail(err)
+	}
+	if err := sdf.SaveSTL(C.GoString(path), m); err != nil {
+		return fail(err)
+	}
+	return 0
+}
+
+//-----------------------------------------------------------------------------
+
+func main() {}
+
+//-----------------------------------------------------------------------------
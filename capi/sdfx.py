@@ -0,0 +1,176 @@
+#------------------------------------------------------------------------------
+"""
+
+Python wrapper for the sdfx C API (libsdfx.so).
+
+    import math, sdfx
+    s = sdfx.sphere(10) - sdfx.cylinder(30, 4).rotate((1, 0, 0), math.pi / 2)
+    s.mesh(200).save_stl("part.stl")
+
+Set SDFX_LIB to load the library from a non-default path.
+
+"""
+#------------------------------------------------------------------------------
+
+import ctypes
+import math
+import os
+
+#------------------------------------------------------------------------------
+
+_path = os.environ.get("SDFX_LIB", os.path.join(os.path.dirname(os.path.abspath(__file__)), "libsdfx.so"))
+_lib = ctypes.CDLL(_path)
+
+_d = ctypes.c_double
+_i = ctypes.c_int
+
+def _proto(name, restype, *argtypes):
+    f = getattr(_lib, name)
+    f.restype = restype
+    f.argtypes = list(argtypes)
+    return f
+
+_error = _proto("sdfx_error", ctypes.c_void_p)
+_free_string = _proto("sdfx_free_string", None, ctypes.c_void_p)
+_free = _proto("sdfx_free", None, _i)
+_circle2d = _proto("sdfx_circle2d", _i, _d)
+_box2d = _proto("sdfx_box2d", _i, _d, _d, _d)
+_polygon2d = _proto("sdfx_polygon2d", _i, ctypes.POINTER(_d), _i)
+_sphere3d = _proto("sdfx_sphere3d", _i, _d)
+_box3d = _proto("sdfx_box3d", _i, _d, _d, _d, _d)
+_cylinder3d = _proto("sdfx_cylinder3d", _i, _d, _d, _d)
+_cone3d = _proto("sdfx_cone3d", _i, _d, _d, _d, _d)
+_extrude3d = _proto("sdfx_extrude3d", _i, _i, _d)
+_revolve3d = _proto("sdfx_revolve3d", _i, _i, _d)
+_union3d = _proto("sdfx_union3d", _i, _i, _i)
+_difference3d = _proto("sdfx_difference3d", _i, _i, _i)
+_intersect3d = _proto("sdfx_intersect3d", _i, _i, _i)
+_translate3d = _proto("sdfx_translate3d", _i, _i, _d, _d, _d)
+_rotate3d = _proto("sdfx_rotate3d", _i, _i, _d, _d, _d, _d)
+_scale3d = _proto("sdfx_scale3d", _i, _i, _d)
+_evaluate3d = _proto("sdfx_evaluate3d", _d, _i, _d, _d, _d)
+_bounds3d = _proto("sdfx_bounds3d", _i, _i, ctypes.POINTER(_d))
+_mesh3d = _proto("sdfx_mesh3d", _i, _i, _i)
+_mesh_triangles = _proto("sdfx_mesh_triangles", _i, _i)
+_mesh_vertices = _proto("sdfx_mesh_vertices", _i, _i, ctypes.POINTER(ctypes.c_float), _i)
+_save_stl = _proto("sdfx_save_stl", _i, _i, ctypes.c_char_p)
+
+#------------------------------------------------------------------------------
+
+class Error(Exception):
+    pass
+
+def _raise():
+    p = _error()
+    if not p:
+        raise Error("unknown error")
+    msg = ctypes.string_at(p).decode()
+    _free_string(p)
+    raise Error(msg)
+
+class _Handle(object):
+    """an object in the sdfx library"""
+
+    def __init__(self, h):
+        if h <= 0:
+            _raise()
+        self.h = h
+
+    def __del__(self):
+        if getattr(self, "h", 0) > 0 and _free is not None:
+            _free(self.h)
+
+#------------------------------------------------------------------------------
+
+class SDF2(_Handle):
+    """2d signed distance function"""
+
+    def extrude(self, height):
+        return SDF3(_extrude3d(self.h, height))
+
+    def revolve(self, theta=0):
+        return SDF3(_revolve3d(self.h, theta))
+
+class SDF3(_Handle):
+    """3d signed distance function"""
+
+    def __or__(self, other):
+        return SDF3(_union3d(self.h, other.h))
+
+    def __sub__(self, other):
+        return SDF3(_difference3d(self.h, other.h))
+
+    def __and__(self, other):
+        return SDF3(_intersect3d(self.h, other.h))
+
+    def translate(self, v):
+        return SDF3(_translate3d(self.h, v[0], v[1], v[2]))
+
+    def rotate(self, axis, theta):
+        return SDF3(_rotate3d(self.h, axis[0], axis[1], axis[2], theta))
+
+    def scale(self, k):
+        return SDF3(_scale3d(self.h, k))
+
+    def evaluate(self, p):
+        d = _evaluate3d(self.h, p[0], p[1], p[2])
+        if math.isnan(d):
+            _raise()
+        return d
+
+    def bounds(self):
+        """return the bounding box as ((xmin, ymin, zmin), (xmax, ymax, zmax))"""
+        bb = (_d * 6)()
+        if _bounds3d(self.h, bb) < 0:
+            _raise()
+        return (tuple(bb[0:3]), tuple(bb[3:6]))
+
+    def mesh(self, cells=200):
+        return Mesh(_mesh3d(self.h, cells))
+
+class Mesh(_Handle):
+    """triangle mesh"""
+
+    def __len__(self):
+        n = _mesh_triangles(self.h)
+        if n < 0:
+            _raise()
+        return n
+
+    def vertices(self):
+        """return a flat list of vertex coordinates (9 per triangle)"""
+        n = 9 * len(self)
+        buf = (ctypes.c_float * n)()
+        if _mesh_vertices(self.h, buf, n) < 0:
+            _raise()
+        return list(buf)
+
+    def save_stl(self, path):
+        if _save_stl(self.h, path.encode()) < 0:
+            _raise()
+
+#------------------------------------------------------------------------------
+
+def circle(radius):
+    return SDF2(_circle2d(radius))
+
+def rect(x, y, round=0):
+    return SDF2(_box2d(x, y, round))
+
+def polygon(vertices):
+    xy = [c for v in vertices for c in v]
+    return SDF2(_polygon2d((_d * len(xy))(*xy), len(vertices)))
+
+def sphere(radius):
+    return SDF3(_sphere3d(radius))
+
+def box(x, y, z, round=0):
+    return SDF3(_box3d(x, y, z, round))
+
+def cylinder(height, radius, round=0):
+    return SDF3(_cylinder3d(height, radius, round))
+
+def cone(height, r0, r1, round=0):
+    return SDF3(_cone3d(height, r0, r1, round))
+
+#------------------------------------------------------------------------------
@@ -0,0 +1,682 @@
+//-----------------------------------------------------------------------------
+/*
+
+sdfx command line tool
+
+Load a user model (see plugin.go) and generate output from it.
+
+	sdfx mesh [options] <model>
+	sdfx serve [options] <model>
+	sdfx report [options] <model>
+	sdfx edges [options] <model>
+	sdfx render [options] <model>
+	sdfx slice [options] <model>
+	sdfx stats [options] <model>
+	sdfx gcode [options] <model>
+	sdfx mill [options] <model>
+	sdfx gallery [options]
+	sdfx examples
+
+*/
+//-----------------------------------------------------------------------------
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/deadsy/sdfx/examples/gallery"
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// command is a sub-command of the sdfx tool.
+type command struct {
+	name  string
+	descr string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"mesh", "generate a mesh file (3d: STL, 3MF, AMF, PLY or OpenSCAD, 2d: DXF)", meshCmd},
+	{"serve", "serve the model over HTTP with a live preview in a web browser", serveCmd},
+	{"report", "write a JSON report of the model metrics (3d)", reportCmd},
+	{"edges", "write the sharp edges of the model mesh (3d: DXF or JSON)", edgesCmd},
+	{"render", "render an image of the model (3d: PNG)", renderCmd},
+	{"slice", "render a z-slice or silhouette of the model (3d: PNG with a distance color map, or a DXF/SVG outline)", sliceCmd},
+	{"stats", "print a summary of the model size, volume and mesh", statsCmd},
+	{"gcode", "slice the model and write G-code for an FDM printer (3d)", gcodeCmd},
+	{"mill", "write CNC pocket or profile toolpaths as G-code (2d)", millCmd},
+	{"gallery", "build the example gallery (meshes, images and measurements)", galleryCmd},
+	{"examples", "list the gallery examples (load them with example:<name>)", examplesCmd},
+}
+
+//-----------------------------------------------------------------------------
+
+// previewCells is the initial mesh resolution for time budgeted meshing.
+const previewCells = 25
+
+// svgLineStyle is the line style for SVG outlines.
+const svgLineStyle = "fill:none;stroke:black;stroke-width:0.1"
+
+// interruptContext returns a context that is cancelled by an interrupt (^C).
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	go func() {
+		select {
+		case <-c:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(c)
+	}()
+	return ctx, cancel
+}
+
+// showProgress writes the percentage complete of a long operation.
+func showProgress(fraction float64, cells int) {
+	fmt.Printf("\r%3.0f%%", 100*fraction)
+	if fraction >= 1 {
+		fmt.Printf("\n")
+	}
+}
+
+// meshFormats3 are the file extensions of the 3d mesh formats.
+var meshFormats3 = map[string]bool{".stl": true, ".3mf": true, ".amf": true, ".ply": true, ".scad": true}
+
+// meshCmd generates a mesh file for the model.
+func meshCmd(args []string) error {
+	fs := flag.NewFlagSet("mesh", flag.ExitOnError)
+	cells := fs.Int("cells", 200, "number of cells on the longest axis")
+	out := fs.String("o", "", "output filename")
+	minVolume := fs.Float64("minvolume", 0, "3d: remove parts with a volume less than this")
+	hollow := fs.Float64("hollow", 0, "3d: hollow the model with this wall thickness")
+	drain := fs.Float64("drain", 0, "3d: radius of the drain/vent holes for a hollowed model")
+	budget := fs.Duration("budget", 0, "3d: generate the finest mesh (up to -cells) within this time")
+	simplify := fs.Float64("simplify", 0, "simplify the mesh (3d) or contours (2d) to within this distance of the surface")
+	orient := fs.Bool("orient", false, "3mf: set the print orientation to the most stable resting pose")
+	seam := fs.String("seam", "", "3mf: seam position hint (aligned, nearest, rear, random)")
+	material := fs.String("material", "", "3d: compensate for the shrinkage of this material ("+strings.Join(sdf.MaterialNames(), ", ")+")")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: sdfx mesh [options] <model>\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("no model specified")
+	}
+
+	m, err := loadModel(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if m.s3 == nil {
+		// options for 3d models only
+		var opts []string
+		fs.Visit(func(f *flag.Flag) {
+			if strings.HasPrefix(f.Usage, "3d:") || strings.HasPrefix(f.Usage, "3mf:") {
+				opts = append(opts, "-"+f.Name)
+			}
+		})
+		if len(opts) != 0 {
+			return fmt.Errorf("%s needs a 3d model", strings.Join(opts, ", "))
+		}
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	if m.s3 != nil {
+		if *out == "" {
+			*out = m.name + ".stl"
+		}
+		ext := strings.ToLower(filepath.Ext(*out))
+		if !meshFormats3[ext] {
+			return fmt.Errorf("unknown 3d mesh format \"%s\" (use .stl, .3mf, .amf, .ply or .scad)", ext)
+		}
+		s := m.s3
+		if *minVolume > 0 {
+			s, err = sdf.RemoveSmall3D(s, *cells, *minVolume)
+			if err != nil {
+				return err
+			}
+		}
+		if *hollow > 0 {
+			k := sdf.DrainParms{Radius: *drain, Vent: true, MeshCells: *cells}
+			s, err = sdf.Hollow3D(s, *hollow, &k)
+			if err != nil {
+				return err
+			}
+		}
+		if *material != "" {
+			s, err = sdf.MaterialCompensate3D(s, *material)
+			if err != nil {
+				return err
+			}
+		}
+		if ext == ".scad" {
+			// OpenSCAD source, only the parts with no OpenSCAD equivalent are meshed
+			fmt.Printf("writing %s\n", *out)
+			return sdf.SaveSCAD(s, *out, &sdf.SCADParms{MeshCells: *cells})
+		}
+		threeMF := ext == ".3mf"
+		if *budget == 0 && *simplify == 0 && ext == ".stl" {
+			return sdf.RenderSTLContext(ctx, s, *cells, *out, showProgress)
+		}
+		var mesh []*sdf.Triangle3
+		if *budget > 0 {
+			var n int
+			mesh, n, err = sdf.GenerateTrianglesWithinContext(ctx, s, previewCells, *cells, *budget)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("rendering %s (%d cells)\n", *out, n)
+		} else {
+			fmt.Printf("rendering %s (%d cells)\n", *out, *cells)
+			mesh, err = sdf.GenerateTrianglesContext(ctx, s, *cells, showProgress)
+			if err != nil {
+				return err
+			}
+		}
+		if *simplify > 0 {
+			n := len(mesh)
+			mesh = sdf.Simplify(mesh, &sdf.SimplifyParms{MaxError: *simplify})
+			fmt.Printf("simplified %d to %d triangles\n", n, len(mesh))
+		}
+		if threeMF {
+			k := sdf.PrintParms{Name: m.name, Seam: *seam}
+			if *orient {
+				poses, err := sdf.StablePoses(s, *cells)
+				if err != nil {
+					return err
+				}
+				if len(poses) > 0 {
+					k.Transform = &poses[0].Transform
+				}
+			}
+			return sdf.Save3MF(*out, mesh, &k)
+		}
+		if ext == ".amf" {
+			k := sdf.AMFParms{Objects: []sdf.AMFObject{{Name: m.name, Mesh: mesh}}}
+			return sdf.SaveAMF(*out, &k)
+		}
+		if ext == ".ply" {
+			return sdf.SavePLY(*out, mesh, &sdf.PLYParms{Normals: s})
+		}
+		return sdf.SaveSTL(*out, mesh)
+	}
+
+	if *out == "" {
+		*out = m.name + ".dxf"
+	}
+	if ext := strings.ToLower(filepath.Ext(*out)); ext != ".dxf" {
+		return fmt.Errorf("unknown 2d mesh format \"%s\" (use .dxf)", ext)
+	}
+	if *simplify > 0 {
+		lines, err := sdf.GenerateLinesContext(ctx, m.s2, *cells, showProgress)
+		if err != nil {
+			return err
+		}
+		simple := sdf.SimplifyLines(lines, *simplify)
+		fmt.Printf("simplified %d to %d lines\n", len(lines), len(simple))
+		return sdf.SaveDXF(*out, simple)
+	}
+	return sdf.RenderDXFContext(ctx, m.s2, *cells, *out, showProgress)
+}
+
+//-----------------------------------------------------------------------------
+
+// reportCmd writes a JSON report of the model metrics.
+func reportCmd(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	cells := fs.Int("cells", 200, "number of cells on the longest axis")
+	density := fs.Float64("density", 1, "material density (for the mass)")
+	out := fs.String("o", "", "output filename (default stdout)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: sdfx report [options] <model>\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("no model specified")
+	}
+
+	m, err := loadModel(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if m.s3 == nil {
+		return errors.New("report needs a 3d model")
+	}
+
+	resolution := m.s3.BoundingBox().Size().MaxComponent() / float64(*cells)
+	mass, err := sdf.Properties3D(m.s3, *density, resolution)
+	if err != nil {
+		return err
+	}
+	stats := sdf.MeshStats(sdf.GenerateTriangles(m.s3, *cells))
+	symmetry := sdf.DetectSymmetry(m.s3, 1000, 1e-3*resolution)
+	symmetry = sdf.VerifySymmetry(m.s3, *cells, symmetry, 1e-3*resolution)
+
+	w := os.Stdout
+	if *out != "" {
+		w, err = os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer w.Close()
+	}
+	return sdf.EncodeReport(w, stats, mass, symmetry)
+}
+
+//-----------------------------------------------------------------------------
+
+// edgesCmd writes the feature (sharp) edges of the model mesh.
+func edgesCmd(args []string) error {
+	fs := flag.NewFlagSet("edges", flag.ExitOnError)
+	cells := fs.Int("cells", 200, "number of cells on the longest axis")
+	angle := fs.Float64("angle", 30, "dihedral angle (degrees) for a sharp edge")
+	out := fs.String("o", "", "output filename (.dxf or .json)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: sdfx edges [options] <model>\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("no model specified")
+	}
+
+	m, err := loadModel(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if m.s3 == nil {
+		return errors.New("edges needs a 3d model")
+	}
+	if *out == "" {
+		*out = m.name + "_edges.dxf"
+	}
+
+	lines := sdf.FeatureEdges(sdf.GenerateTriangles(m.s3, *cells), sdf.DtoR(*angle))
+	fmt.Printf("writing %s (%d polylines)\n", *out, len(lines))
+
+	if strings.HasSuffix(strings.ToLower(*out), ".json") {
+		w, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer w.Close()
+		return sdf.EncodeReport(w, sdf.NewFeatureEdgeReport(lines, sdf.DtoR(*angle)))
+	}
+	return sdf.SavePolylinesDXF(*out, lines)
+}
+
+//-----------------------------------------------------------------------------
+
+// renderCmd renders an image of the model.
+func renderCmd(args []string) error {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	width := fs.Int("width", 800, "image width (pixels)")
+	height := fs.Int("height", 600, "image height (pixels)")
+	samples := fs.Int("samples", 2, "samples per pixel on each axis (anti-aliasing)")
+	fov := fs.Float64("fov", 40, "vertical field of view (degrees)")
+	floor := fs.Bool("floor", true, "render a floor under the model")
+	ao := fs.Bool("ao", true, "render ambient occlusion")
+	turntable := fs.Int("turntable", 0, "render this many frames orbiting the model (PNG sequence, or an animated .gif)")
+	out := fs.String("o", "", "output filename")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: sdfx render [options] <model>\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("no model specified")
+	}
+
+	m, err := loadModel(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if m.s3 == nil {
+		return errors.New("render needs a 3d model")
+	}
+
+	o := sdf.DefaultRenderOptions(m.s3)
+	o.Size = sdf.V2i{*width, *height}
+	o.Samples = *samples
+	o.Floor = *floor
+	o.AO = *ao
+	// keep the framing for the field of view
+	distance := o.Eye.Sub(o.Target).Length() * math.Sin(0.5*o.FOV) / math.Sin(0.5*sdf.DtoR(*fov))
+	o.FOV = sdf.DtoR(*fov)
+	o.Eye = o.Target.Add(o.Eye.Sub(o.Target).Normalize().MulScalar(distance))
+	o.Path = *out
+	if o.Path == "" {
+		o.Path = m.name + ".png"
+	}
+	fmt.Printf("rendering %s (%dx%d)\n", o.Path, *width, *height)
+	if *turntable > 0 {
+		return sdf.RenderTurntable(m.s3, *turntable, *o)
+	}
+	return sdf.Render(m.s3, o)
+}
+
+//-----------------------------------------------------------------------------
+
+// sliceCmd renders a z-slice (or silhouette) of the model.
+func sliceCmd(args []string) error {
+	fs := flag.NewFlagSet("slice", flag.ExitOnError)
+	z := fs.Float64("z", math.NaN(), "z height of the slice (default: middle of the bounding box)")
+	silhouette := fs.Bool("silhouette", false, "render the silhouette (projection along z)")
+	pixels := fs.Int("pixels", 800, "pixels on the longest axis")
+	contour := fs.Float64("contour", 0, "distance between contour lines (0 == none)")
+	cells := fs.Int("cells", 200, "dxf/svg: number of cells on the longest axis")
+	out := fs.String("o", "", "output filename (.png, .dxf or .svg)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: sdfx slice [options] <model>\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("no model specified")
+	}
+
+	m, err := loadModel(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if m.s3 == nil {
+		return errors.New("slice needs a 3d model")
+	}
+
+	k := &sdf.SliceImageParms{
+		Z:          *z,
+		Silhouette: *silhouette,
+		Pixels:     *pixels,
+		Contour:    *contour,
+		Path:       *out,
+	}
+	if math.IsNaN(k.Z) {
+		k.Z = m.s3.BoundingBox().Center().Z
+	}
+	if k.Path == "" {
+		k.Path = m.name + "_slice.png"
+	}
+
+	// a vector outline of the slice
+	ext := strings.ToLower(filepath.Ext(k.Path))
+	if ext == ".dxf" || ext == ".svg" {
+		if k.Silhouette {
+			return errors.New("a silhouette can only be rendered as a PNG")
+		}
+		s := sdf.Slice2D(m.s3, sdf.V3{Z: k.Z}, sdf.V3{Z: 1})
+		if ext == ".svg" {
+			return sdf.RenderSVG(s, *cells, k.Path, svgLineStyle)
+		}
+		ctx, cancel := interruptContext()
+		defer cancel()
+		return sdf.RenderDXFContext(ctx, s, *cells, k.Path, showProgress)
+	}
+
+	fmt.Printf("rendering %s\n", k.Path)
+	return sdf.RenderSlice(m.s3, k)
+}
+
+//-----------------------------------------------------------------------------
+
+// statsCmd prints a summary of the model.
+func statsCmd(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	cells := fs.Int("cells", 200, "number of cells on the longest axis")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: sdfx stats [options] <model>\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("no model specified")
+	}
+
+	m, err := loadModel(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if m.s2 != nil {
+		bb := m.s2.BoundingBox()
+		lines := sdf.GenerateLines(m.s2, *cells)
+		fmt.Printf("model %s (2d)\n", m.name)
+		fmt.Printf("bounding box %v %v\n", bb.Min, bb.Max)
+		fmt.Printf("size %v\n", bb.Size())
+		fmt.Printf("lines %d\n", len(lines))
+		return nil
+	}
+
+	bb := m.s3.BoundingBox()
+	resolution := bb.Size().MaxComponent() / float64(*cells)
+	mass, err := sdf.Properties3D(m.s3, 1, resolution)
+	if err != nil {
+		return err
+	}
+	stats := sdf.MeshStats(sdf.GenerateTriangles(m.s3, *cells))
+	fmt.Printf("model %s (3d)\n", m.name)
+	fmt.Printf("bounding box %v %v\n", bb.Min, bb.Max)
+	fmt.Printf("size %v\n", bb.Size())
+	fmt.Printf("volume %g\n", mass.Volume)
+	fmt.Printf("surface area %g\n", mass.Area)
+	fmt.Printf("centroid %v\n", mass.Centroid)
+	fmt.Printf("triangles %d\n", stats.Triangles)
+	fmt.Printf("watertight %t\n", stats.Watertight)
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// gcodeCmd slices the model and writes G-code.
+func gcodeCmd(args []string) error {
+	d := sdf.DefaultSlicerParms()
+	fs := flag.NewFlagSet("gcode", flag.ExitOnError)
+	layer := fs.Float64("layer", d.LayerHeight, "layer height (mm)")
+	width := fs.Float64("width", d.LineWidth, "extrusion line width (mm)")
+	perimeters := fs.Int("perimeters", d.Perimeters, "number of perimeters")
+	solid := fs.Int("solid", d.SolidLayers, "number of solid bottom and top layers")
+	infill := fs.Float64("infill", d.InfillDensity, "infill density (0..1)")
+	temp := fs.Float64("temp", d.Temperature, "nozzle temperature (C)")
+	bed := fs.Float64("bed", d.BedTemperature, "bed temperature (C)")
+	centerX := fs.Float64("x", d.Center.X, "bed x position of the model center (mm)")
+	centerY := fs.Float64("y", d.Center.Y, "bed y position of the model center (mm)")
+	out := fs.String("o", "", "output filename")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: sdfx gcode [options] <model>\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("no model specified")
+	}
+
+	m, err := loadModel(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if m.s3 == nil {
+		return errors.New("gcode needs a 3d model")
+	}
+
+	k := *d
+	k.LayerHeight = *layer
+	k.LineWidth = *width
+	k.Perimeters = *perimeters
+	k.SolidLayers = *solid
+	k.InfillDensity = *infill
+	k.Temperature = *temp
+	k.BedTemperature = *bed
+	k.Center = sdf.V2{X: *centerX, Y: *centerY}
+	if *out == "" {
+		*out = m.name + ".gcode"
+	}
+	fmt.Printf("slicing %s\n", *out)
+	return sdf.SaveGCode(*out, m.s3, &k)
+}
+
+//-----------------------------------------------------------------------------
+
+// millCmd writes CNC toolpaths for the model.
+func millCmd(args []string) error {
+	fs := flag.NewFlagSet("mill", flag.ExitOnError)
+	op := fs.String("op", "outside", "operation: pocket, outside (profile) or inside (profile)")
+	tool := fs.Float64("tool", 3.175, "tool diameter (mm)")
+	stepover := fs.Float64("stepover", 0.4, "pocketing stepover (fraction of the tool diameter)")
+	depth := fs.Float64("depth", 3, "cutting depth (mm)")
+	stepdown := fs.Float64("stepdown", 1, "depth per pass (mm)")
+	safe := fs.Float64("safe", 5, "safe z height (mm)")
+	feed := fs.Float64("feed", 600, "feed rate (mm/min)")
+	plunge := fs.Float64("plunge", 200, "plunge rate (mm/min)")
+	spindle := fs.Float64("spindle", 0, "spindle speed (rpm)")
+	conventional := fs.Bool("conventional", false, "conventional milling (default climb)")
+	out := fs.String("o", "", "output filename")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: sdfx mill [options] <model>\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("no model specified")
+	}
+
+	m, err := loadModel(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if m.s2 == nil {
+		return errors.New("mill needs a 2d model")
+	}
+
+	k := sdf.MillParms{
+		ToolDiameter: *tool,
+		Stepover:     *stepover,
+		Depth:        *depth,
+		StepDown:     *stepdown,
+		SafeZ:        *safe,
+		FeedRate:     *feed,
+		PlungeRate:   *plunge,
+		SpindleSpeed: *spindle,
+	}
+	if *conventional {
+		k.Direction = sdf.MillConventional
+	}
+	var loops []sdf.V2Set
+	switch *op {
+	case "pocket":
+		loops, err = sdf.PocketToolpath(m.s2, &k)
+	case "outside", "inside":
+		loops, err = sdf.ProfileToolpath(m.s2, &k, *op == "outside")
+	default:
+		return fmt.Errorf("unknown operation \"%s\"", *op)
+	}
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		*out = m.name + ".nc"
+	}
+	fmt.Printf("writing %s (%d loops)\n", *out, len(loops))
+	return sdf.SaveMillGCode(*out, loops, &k)
+}
+
+//-----------------------------------------------------------------------------
+
+// examplesCmd lists the gallery examples.
+func examplesCmd(args []string) error {
+	for _, e := range gallery.Examples() {
+		fmt.Printf("%-16s %s\n", e.Name, e.Description)
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// galleryCmd builds the example gallery.
+func galleryCmd(args []string) error {
+	fs := flag.NewFlagSet("gallery", flag.ExitOnError)
+	cells := fs.Int("cells", 0, "mesh cells on the longest axis (0 == example default)")
+	workers := fs.Int("j", 0, "number of examples built in parallel (0 == number of CPUs)")
+	out := fs.String("o", "gallery", "output directory")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: sdfx gallery [options]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	results, err := gallery.Build(&gallery.BuildParms{
+		Dir:       *out,
+		Workers:   *workers,
+		MeshCells: *cells,
+	})
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Printf("%-16s FAIL %s\n", r.Name, r.Err)
+			failed++
+			continue
+		}
+		fmt.Printf("%-16s ok   %s\n", r.Name, r.Duration)
+	}
+	if failed != 0 {
+		return fmt.Errorf("%d of %d examples failed", failed, len(results))
+	}
+	fmt.Printf("gallery written to %s\n", filepath.Join(*out, "index.html"))
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: sdfx <command> [options] <model>\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", c.name, c.descr)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(1)
+	}
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			if err := c.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	usage()
+	os.Exit(1)
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,47 @@
+//-----------------------------------------------------------------------------
+/*
+
+Command Tests
+
+*/
+//-----------------------------------------------------------------------------
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//-----------------------------------------------------------------------------
+
+func Test_MeshErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sdfx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tests := [][]string{
+		// unknown output formats
+		{"-o", filepath.Join(dir, "box.obj"), "example:box"},
+		{"-o", filepath.Join(dir, "box.stk"), "example:box"},
+		{"-o", filepath.Join(dir, "box"), "example:box"},
+		{"-o", filepath.Join(dir, "panel.svg"), "example:panel"},
+		// 3d options for a 2d model
+		{"-o", filepath.Join(dir, "panel.dxf"), "-hollow", "1", "example:panel"},
+		{"-o", filepath.Join(dir, "panel.dxf"), "-material", "pla", "example:panel"},
+	}
+	for _, args := range tests {
+		if err := meshCmd(args); err == nil {
+			t.Errorf("FAIL %v", args)
+		}
+	}
+	// nothing is written
+	if files, _ := filepath.Glob(filepath.Join(dir, "*")); len(files) != 0 {
+		t.Errorf("FAIL %v", files)
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,202 @@
+//-----------------------------------------------------------------------------
+/*
+
+Model Plugins
+
+User models are compiled as Go plugins (go build -buildmode=plugin) and
+loaded at run time. A model plugin is a main package that exports a
+"Model" function with one of the following signatures:
+
+	func Model() sdf.SDF3
+	func Model() (sdf.SDF3, error)
+	func Model() sdf.SDF2
+	func Model() (sdf.SDF2, error)
+
+If the model path is a directory or a .go file it is built as a plugin
+before being loaded. The plugin must be built against the same version
+of the sdf package as the sdfx tool.
+
+A model path of "example:<name>" loads a registered gallery example
+instead (see "sdfx examples"), a .json file is loaded as a model file
+(see sdf.LoadModel), a .sdfx file is evaluated as a model script (see
+sdf.EvalScript) and a .scad file is imported as OpenSCAD source (see
+sdf.EvalSCAD).
+
+*/
+//-----------------------------------------------------------------------------
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"plugin"
+	"strings"
+
+	"github.com/deadsy/sdfx/examples/gallery"
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// modelSymbol is the name of the function exported by a model plugin.
+const modelSymbol = "Model"
+
+// examplePrefix is the model path prefix for a gallery example.
+const examplePrefix = "example:"
+
+// model is a user model loaded from a plugin.
+type model struct {
+	name string   // name of the model
+	s3   sdf.SDF3 // 3d model (or nil)
+	s2   sdf.SDF2 // 2d model (or nil)
+}
+
+//-----------------------------------------------------------------------------
+
+// buildPlugin builds the model source at path as a plugin.
+// It returns the path of the plugin and the temporary directory containing it.
+func buildPlugin(path string) (string, string, error) {
+	dir, err := ioutil.TempDir("", "sdfx")
+	if err != nil {
+		return "", "", err
+	}
+	so := filepath.Join(dir, "model.so")
+	// build from within the source directory so the go.mod file is found
+	dst, src := path, "."
+	if strings.HasSuffix(path, ".go") {
+		dst, src = filepath.Dir(path), filepath.Base(path)
+	}
+	cmd := exec.Command("go", "build", "-buildmode=plugin", "-o", so, src)
+	cmd.Dir = dst
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		os.RemoveAll(dir)
+		return "", "", fmt.Errorf("can't build plugin from \"%s\": %s", path, err)
+	}
+	return so, dir, nil
+}
+
+// isSource returns true if the path is model source code (rather than a plugin).
+func isSource(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return info.IsDir() || strings.HasSuffix(path, ".go")
+}
+
+//-----------------------------------------------------------------------------
+
+// loadExample loads a registered gallery example.
+func loadExample(name string) (*model, error) {
+	for _, e := range gallery.Examples() {
+		if e.Name != name {
+			continue
+		}
+		m := model{name: name}
+		var err error
+		if e.Model3 != nil {
+			m.s3, err = e.Model3()
+		} else {
+			m.s2, err = e.Model2()
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &m, nil
+	}
+	return nil, fmt.Errorf("unknown example \"%s\"", name)
+}
+
+// modelName returns the model name for a model path, the base name without the
+// extension. A directory (e.g. ".") is named after its absolute path.
+func modelName(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	name := filepath.Base(path)
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	if name == "" || name == "." || name == string(filepath.Separator) {
+		return "model"
+	}
+	return name
+}
+
+// loadModel loads a model from a plugin (or from model source code).
+func loadModel(path string) (*model, error) {
+	if strings.HasPrefix(path, examplePrefix) {
+		return loadExample(strings.TrimPrefix(path, examplePrefix))
+	}
+	name := modelName(path)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		s, err := sdf.LoadModel(path)
+		if err != nil {
+			return nil, err
+		}
+		return &model{name: name, s3: s}, nil
+	case ".sdfx":
+		s3, s2, err := sdf.LoadScript(path)
+		if err != nil {
+			return nil, err
+		}
+		return &model{name: name, s3: s3, s2: s2}, nil
+	case ".scad":
+		s3, s2, err := sdf.LoadSCAD(path)
+		if err != nil {
+			return nil, err
+		}
+		return &model{name: name, s3: s3, s2: s2}, nil
+	}
+	so := path
+	if isSource(path) {
+		var dir string
+		var err error
+		so, dir, err = buildPlugin(path)
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+	}
+
+	p, err := plugin.Open(so)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup(modelSymbol)
+	if err != nil {
+		return nil, err
+	}
+
+	m := model{}
+	m.name = name
+
+	switch fn := sym.(type) {
+	case func() sdf.SDF3:
+		m.s3 = fn()
+	case func() (sdf.SDF3, error):
+		m.s3, err = fn()
+	case func() sdf.SDF2:
+		m.s2 = fn()
+	case func() (sdf.SDF2, error):
+		m.s2, err = fn()
+	default:
+		return nil, fmt.Errorf("%s: bad type %T for %s()", path, sym, modelSymbol)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if m.s3 == nil && m.s2 == nil {
+		return nil, fmt.Errorf("%s: %s() returned a nil sdf", path, modelSymbol)
+	}
+	return &m, nil
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,41 @@
+//-----------------------------------------------------------------------------
+/*
+
+Model Loading Tests
+
+*/
+//-----------------------------------------------------------------------------
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//-----------------------------------------------------------------------------
+
+func Test_ModelName(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path, name string
+	}{
+		{"box.sdfx", "box"},
+		{"models/part.v2.json", "part.v2"},
+		{".", filepath.Base(wd)},
+		{"./", filepath.Base(wd)},
+		{"..", filepath.Base(filepath.Dir(wd))},
+		{"/", "model"},
+	}
+	for _, test := range tests {
+		if name := modelName(test.path); name != test.name {
+			t.Errorf("FAIL %q: %q, expected %q", test.path, name, test.name)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
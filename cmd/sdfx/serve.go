@@ -0,0 +1,435 @@
+//-----------------------------------------------------------------------------
+/*
+
+Service Mode
+
+Serve a model over HTTP so that other programs can drive it, with a
+live preview in a web browser.
+
+GET  /                   WebGL (three.js) viewer of the model
+GET  /preview            the current preview mesh (3d: STL, 2d: JSON line segments)
+GET  /ws                 websocket, a JSON message is sent for each new preview mesh
+GET  /bounds             bounding box of the model
+POST /evaluate           evaluate the model at a set of points
+GET  /mesh?cells=N&format=F
+                         3d: STL (F = stl) or JSON triangles (F = json)
+                         2d: JSON line segments
+
+Points and vertices are JSON arrays of [x, y] (2d) or [x, y, z] (3d).
+Request bodies are limited to maxRequestBytes.
+
+The model file (or the Go source directory) is polled for changes. When it
+changes the model is reloaded and re-meshed, and the viewers are sent a
+message to load the new preview mesh. If the model can't be loaded the
+viewers are sent the error and the previous model is kept. Each reload of
+a Go model loads a new plugin, plugins can't be unloaded.
+
+*/
+//-----------------------------------------------------------------------------
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// maxRequestBytes is the maximum size of a request body.
+const maxRequestBytes = 8 << 20
+
+// server serves a model over HTTP.
+type server struct {
+	path     string // model path
+	maxCells int    // maximum mesh cells for a request
+	cells    int    // mesh cells for the preview
+	mu       sync.Mutex
+	m        *model
+	preview  []byte           // preview mesh
+	msg      previewMessage   // the latest preview message
+	clients  map[*wsConn]bool // connected viewers
+}
+
+// previewMessage is sent to the viewers when the preview changes.
+type previewMessage struct {
+	Version   int    `json:"version"`         // preview version
+	Name      string `json:"name"`            // model name
+	Dimension int    `json:"dimension"`       // 2 or 3
+	Error     string `json:"error,omitempty"` // model load error
+}
+
+// evaluateRequest is the body of an /evaluate request.
+type evaluateRequest struct {
+	Points [][]float64 `json:"points"`
+}
+
+// evaluateResponse is the body of an /evaluate response.
+type evaluateResponse struct {
+	Distances []float64 `json:"distances"`
+}
+
+// boundsResponse is the body of a /bounds response.
+type boundsResponse struct {
+	Min []float64 `json:"min"`
+	Max []float64 `json:"max"`
+}
+
+//-----------------------------------------------------------------------------
+
+// writeJSON writes a JSON response.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+	}
+}
+
+// dimension returns the number of coordinates for a point of the model.
+func (m *model) dimension() int {
+	if m.s3 != nil {
+		return 3
+	}
+	return 2
+}
+
+// model returns the current model.
+func (s *server) model() *model {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.m
+}
+
+//-----------------------------------------------------------------------------
+
+// bounds returns the bounding box of the model.
+func (s *server) bounds(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	m := s.model()
+	var rsp boundsResponse
+	if m.s3 != nil {
+		bb := m.s3.BoundingBox()
+		rsp.Min = []float64{bb.Min.X, bb.Min.Y, bb.Min.Z}
+		rsp.Max = []float64{bb.Max.X, bb.Max.Y, bb.Max.Z}
+	} else {
+		bb := m.s2.BoundingBox()
+		rsp.Min = []float64{bb.Min.X, bb.Min.Y}
+		rsp.Max = []float64{bb.Max.X, bb.Max.Y}
+	}
+	writeJSON(w, &rsp)
+}
+
+// evaluate returns the distance from the model for a set of points.
+func (s *server) evaluate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req evaluateRequest
+	body := http.MaxBytesReader(w, r.Body, maxRequestBytes)
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	m := s.model()
+	n := m.dimension()
+	rsp := evaluateResponse{Distances: make([]float64, len(req.Points))}
+	for i, p := range req.Points {
+		if len(p) != n {
+			http.Error(w, fmt.Sprintf("point %d: expected %d coordinates", i, n), http.StatusBadRequest)
+			return
+		}
+		if n == 3 {
+			rsp.Distances[i] = m.s3.Evaluate(sdf.V3{X: p[0], Y: p[1], Z: p[2]})
+		} else {
+			rsp.Distances[i] = m.s2.Evaluate(sdf.V2{X: p[0], Y: p[1]})
+		}
+	}
+	writeJSON(w, &rsp)
+}
+
+// mesh returns a mesh of the model.
+func (s *server) mesh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// the default is limited to the maximum
+	cells := 200
+	if cells > s.maxCells {
+		cells = s.maxCells
+	}
+	if v := r.URL.Query().Get("cells"); v != "" {
+		var err error
+		cells, err = strconv.Atoi(v)
+		if err != nil || cells <= 0 || cells > s.maxCells {
+			http.Error(w, fmt.Sprintf("cells must be 1..%d", s.maxCells), http.StatusBadRequest)
+			return
+		}
+	}
+	format := r.URL.Query().Get("format")
+	m := s.model()
+
+	if m.s2 != nil {
+		if format != "" && format != "json" {
+			http.Error(w, "2d format must be json", http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, lineSegments(m.s2, cells))
+		return
+	}
+
+	switch format {
+	case "", "stl":
+		mesh := sdf.GenerateTriangles(m.s3, cells)
+		w.Header().Set("Content-Type", "model/stl")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.stl\"", m.name))
+		if err := sdf.EncodeSTL(w, mesh); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+		}
+	case "json":
+		mesh := sdf.GenerateTriangles(m.s3, cells)
+		triangles := make([][3][3]float64, len(mesh))
+		for i, t := range mesh {
+			for j, v := range t.V {
+				triangles[i][j] = [3]float64{v.X, v.Y, v.Z}
+			}
+		}
+		writeJSON(w, triangles)
+	default:
+		http.Error(w, "3d format must be stl or json", http.StatusBadRequest)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// lineSegments returns the line segments of a 2d model.
+func lineSegments(s sdf.SDF2, cells int) [][2][2]float64 {
+	lines := sdf.GenerateLines(s, cells)
+	segments := make([][2][2]float64, len(lines))
+	for i, l := range lines {
+		segments[i] = [2][2]float64{{l[0].X, l[0].Y}, {l[1].X, l[1].Y}}
+	}
+	return segments
+}
+
+//-----------------------------------------------------------------------------
+// Live Preview
+
+// update meshes a model for the preview and tells the viewers about it.
+func (s *server) update(m *model) error {
+	var buf bytes.Buffer
+	if m.s3 != nil {
+		if err := sdf.EncodeSTL(&buf, sdf.GenerateTriangles(m.s3, s.cells)); err != nil {
+			return err
+		}
+	} else {
+		if err := json.NewEncoder(&buf).Encode(lineSegments(m.s2, s.cells)); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	s.m = m
+	s.preview = buf.Bytes()
+	s.msg = previewMessage{Version: s.msg.Version + 1, Name: m.name, Dimension: m.dimension()}
+	s.mu.Unlock()
+	s.broadcast()
+	return nil
+}
+
+// fail tells the viewers about a model load error.
+func (s *server) fail(err error) {
+	s.mu.Lock()
+	s.msg.Error = err.Error()
+	s.mu.Unlock()
+	s.broadcast()
+}
+
+// broadcast sends the latest preview message to all viewers.
+// The messages are sent without holding the server lock, so a stalled
+// viewer doesn't hold up the other requests. Viewers that fail are dropped.
+func (s *server) broadcast() {
+	s.mu.Lock()
+	b, _ := json.Marshal(&s.msg)
+	clients := make([]*wsConn, 0, len(s.clients))
+	for c := range s.clients {
+		clients = append(clients, c)
+	}
+	s.mu.Unlock()
+	for _, c := range clients {
+		if err := c.WriteText(b); err != nil {
+			c.Close()
+			s.mu.Lock()
+			delete(s.clients, c)
+			s.mu.Unlock()
+		}
+	}
+}
+
+// viewer returns the WebGL viewer page.
+func (s *server) viewer(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, viewerHTML)
+}
+
+// previewMesh returns the current preview mesh.
+func (s *server) previewMesh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.mu.Lock()
+	b, dimension := s.preview, s.m.dimension()
+	s.mu.Unlock()
+	if dimension == 3 {
+		w.Header().Set("Content-Type", "model/stl")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(b)
+}
+
+// websocket sends preview messages to a viewer until it disconnects.
+func (s *server) websocket(w http.ResponseWriter, r *http.Request) {
+	c := wsUpgrade(w, r)
+	if c == nil {
+		return
+	}
+	// Take the write lock before releasing the server lock, so a broadcast
+	// of a newer message is sent after the current message.
+	s.mu.Lock()
+	b, _ := json.Marshal(&s.msg)
+	s.clients[c] = true
+	c.wmu.Lock()
+	s.mu.Unlock()
+	err := c.writeText(b)
+	c.wmu.Unlock()
+	if err == nil {
+		c.Discard()
+	}
+	s.mu.Lock()
+	delete(s.clients, c)
+	s.mu.Unlock()
+	c.Close()
+}
+
+// modTime returns the latest modification time of a model file (or Go source directory).
+func modTime(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	t := info.ModTime()
+	if !info.IsDir() {
+		return t, nil
+	}
+	err = filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if (strings.HasSuffix(p, ".go") || filepath.Base(p) == "go.mod") && info.ModTime().After(t) {
+			t = info.ModTime()
+		}
+		return nil
+	})
+	return t, err
+}
+
+// watch polls the model file and reloads the model when it changes.
+func (s *server) watch(poll time.Duration) {
+	t, _ := modTime(s.path)
+	for range time.Tick(poll) {
+		mt, err := modTime(s.path)
+		if err != nil || mt.Equal(t) {
+			continue
+		}
+		t = mt
+		fmt.Printf("reloading %s\n", s.path)
+		m, err := loadModel(s.path)
+		if err == nil {
+			err = s.update(m)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			s.fail(err)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// serveCmd serves the model over HTTP.
+func serveCmd(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	maxCells := fs.Int("maxcells", 500, "maximum number of mesh cells for a request")
+	cells := fs.Int("cells", 200, "mesh cells on the longest axis for the preview")
+	poll := fs.Duration("poll", time.Second, "model file polling interval (0 == don't reload)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: sdfx serve [options] <model>\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("no model specified")
+	}
+	if *cells <= 0 {
+		return errors.New("cells must be > 0")
+	}
+
+	m, err := loadModel(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	s := &server{
+		path:     fs.Arg(0),
+		maxCells: *maxCells,
+		cells:    *cells,
+		clients:  make(map[*wsConn]bool),
+	}
+	if err := s.update(m); err != nil {
+		return err
+	}
+	if *poll > 0 && !strings.HasPrefix(s.path, examplePrefix) {
+		go s.watch(*poll)
+	}
+
+	fmt.Printf("serving %s on http://%s/\n", m.name, *addr)
+	return http.ListenAndServe(*addr, s.handler())
+}
+
+// handler returns the HTTP handler for the server.
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.viewer)
+	mux.HandleFunc("/preview", s.previewMesh)
+	mux.HandleFunc("/ws", s.websocket)
+	mux.HandleFunc("/bounds", s.bounds)
+	mux.HandleFunc("/evaluate", s.evaluate)
+	mux.HandleFunc("/mesh", s.mesh)
+	return mux
+}
+
+//-----------------------------------------------------------------------------
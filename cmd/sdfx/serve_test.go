@@ -0,0 +1,112 @@
+//-----------------------------------------------------------------------------
+/*
+
+Service Mode Tests
+
+*/
+//-----------------------------------------------------------------------------
+
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// testServer returns a server for a 10mm cube.
+func testServer(t *testing.T) *server {
+	s := &server{maxCells: 100, cells: 10, clients: make(map[*wsConn]bool)}
+	if err := s.update(&model{name: "box", s3: sdf.Box3D(sdf.V3{X: 10, Y: 10, Z: 10}, 0)}); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// request sends a request to the server and returns the response.
+func request(s *server, method, url, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.handler().ServeHTTP(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+	return w
+}
+
+func Test_Serve(t *testing.T) {
+	s := testServer(t)
+
+	// evaluate
+	w := request(s, http.MethodPost, "/evaluate", `{"points": [[0, 0, 0], [20, 0, 0]]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("FAIL %d %s", w.Code, w.Body.String())
+	}
+	var rsp evaluateResponse
+	if err := json.NewDecoder(w.Body).Decode(&rsp); err != nil {
+		t.Fatal(err)
+	}
+	if len(rsp.Distances) != 2 || math.Abs(rsp.Distances[0]+5) > 1e-9 || math.Abs(rsp.Distances[1]-15) > 1e-9 {
+		t.Errorf("FAIL distances %v", rsp.Distances)
+	}
+
+	// bounds
+	w = request(s, http.MethodGet, "/bounds", "")
+	var bb boundsResponse
+	if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&bb) != nil || bb.Min[0] != -5 || bb.Max[2] != 5 {
+		t.Errorf("FAIL bounds %d %v", w.Code, bb)
+	}
+
+	// mesh
+	w = request(s, http.MethodGet, "/mesh?cells=10&format=json", "")
+	var triangles [][3][3]float64
+	if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&triangles) != nil || len(triangles) == 0 {
+		t.Errorf("FAIL mesh %d", w.Code)
+	}
+	w = request(s, http.MethodGet, "/mesh?cells=10", "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "model/stl" {
+		t.Errorf("FAIL mesh %d", w.Code)
+	}
+}
+
+func Test_ServeMaxCells(t *testing.T) {
+	s := testServer(t)
+	s.maxCells = 10
+	// the default number of cells is limited to the maximum
+	w0 := request(s, http.MethodGet, "/mesh", "")
+	w1 := request(s, http.MethodGet, "/mesh?cells=10", "")
+	if w0.Code != http.StatusOK || w0.Body.String() != w1.Body.String() {
+		t.Errorf("FAIL %d", w0.Code)
+	}
+	if w := request(s, http.MethodGet, "/mesh?cells=11", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("FAIL %d", w.Code)
+	}
+}
+
+func Test_ServeErrors(t *testing.T) {
+	s := testServer(t)
+	tests := []struct {
+		method, url, body string
+		code              int
+	}{
+		{http.MethodGet, "/evaluate", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/evaluate", `{"points": [[0, 0`, http.StatusBadRequest},
+		{http.MethodPost, "/evaluate", `{"points": [[0, 0]]}`, http.StatusBadRequest},
+		{http.MethodPost, "/evaluate", strings.Repeat(" ", maxRequestBytes+1), http.StatusBadRequest},
+		{http.MethodPost, "/bounds", "", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/mesh?cells=0", "", http.StatusBadRequest},
+		{http.MethodGet, "/mesh?cells=1000", "", http.StatusBadRequest},
+		{http.MethodGet, "/mesh?format=obj", "", http.StatusBadRequest},
+		{http.MethodGet, "/nothing", "", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		if w := request(s, test.method, test.url, test.body); w.Code != test.code {
+			t.Errorf("FAIL %s %s: %d, expected %d", test.method, test.url, w.Code, test.code)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,141 @@
+//-----------------------------------------------------------------------------
+/*
+
+Preview Viewer
+
+The web page served by "sdfx serve". It shows the preview mesh with
+three.js (loaded from a CDN) and loads the new preview mesh when the server
+sends a websocket message.
+
+*/
+//-----------------------------------------------------------------------------
+
+package main
+
+//-----------------------------------------------------------------------------
+
+const viewerHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>sdfx</title>
+<style>
+body { margin: 0; overflow: hidden; font-family: sans-serif; }
+#status { position: absolute; top: 8px; left: 8px; padding: 4px 8px; background: rgba(255,255,255,0.8); white-space: pre; }
+#status.error { color: #c00000; }
+</style>
+<script src="https://unpkg.com/three@0.128.0/build/three.min.js"></script>
+<script src="https://unpkg.com/three@0.128.0/examples/js/controls/OrbitControls.js"></script>
+<script src="https://unpkg.com/three@0.128.0/examples/js/loaders/STLLoader.js"></script>
+</head>
+<body>
+<div id="status">connecting</div>
+<script>
+var statusDiv = document.getElementById("status");
+var scene = new THREE.Scene();
+scene.background = new THREE.Color(0xf0f0f0);
+var camera = new THREE.PerspectiveCamera(45, window.innerWidth / window.innerHeight, 0.01, 1e6);
+camera.up.set(0, 0, 1);
+camera.add(new THREE.DirectionalLight(0xffffff, 0.6));
+scene.add(camera);
+scene.add(new THREE.HemisphereLight(0xffffff, 0x404040, 0.6));
+var renderer = new THREE.WebGLRenderer({antialias: true});
+renderer.setPixelRatio(window.devicePixelRatio);
+renderer.setSize(window.innerWidth, window.innerHeight);
+document.body.appendChild(renderer.domElement);
+var controls = new THREE.OrbitControls(camera, renderer.domElement);
+
+var object = null;  // the displayed preview
+var version = 0;    // the displayed preview version
+
+function setStatus(text, error) {
+  statusDiv.textContent = text;
+  statusDiv.className = error ? "error" : "";
+}
+
+// fit the camera to the first preview, keep the view for later ones
+function show(obj) {
+  var first = object == null;
+  if (object) {
+    scene.remove(object);
+    object.geometry.dispose();
+  }
+  object = obj;
+  scene.add(object);
+  if (!first) {
+    return;
+  }
+  var box = new THREE.Box3().setFromObject(object);
+  var center = box.getCenter(new THREE.Vector3());
+  var size = box.getSize(new THREE.Vector3()).length() || 1;
+  controls.target.copy(center);
+  camera.position.copy(center).add(new THREE.Vector3(1, -1.5, 1).normalize().multiplyScalar(1.5 * size));
+  controls.update();
+}
+
+function load(msg) {
+  fetch("/preview?v=" + msg.version).then(function(rsp) {
+    if (!rsp.ok) {
+      throw new Error(rsp.statusText);
+    }
+    return msg.dimension == 3 ? rsp.arrayBuffer() : rsp.json();
+  }).then(function(data) {
+    var obj;
+    if (msg.dimension == 3) {
+      var geometry = new THREE.STLLoader().parse(data);
+      obj = new THREE.Mesh(geometry, new THREE.MeshStandardMaterial({color: 0x4080c0, flatShading: true}));
+    } else {
+      var v = [];
+      data.forEach(function(l) {
+        v.push(l[0][0], l[0][1], 0, l[1][0], l[1][1], 0);
+      });
+      var geometry = new THREE.BufferGeometry();
+      geometry.setAttribute("position", new THREE.Float32BufferAttribute(v, 3));
+      obj = new THREE.LineSegments(geometry, new THREE.LineBasicMaterial({color: 0x000000}));
+    }
+    version = msg.version;
+    show(obj);
+  }).catch(function(err) {
+    setStatus(err.toString(), true);
+  });
+}
+
+function connect() {
+  var ws = new WebSocket((location.protocol == "https:" ? "wss://" : "ws://") + location.host + "/ws");
+  ws.onmessage = function(e) {
+    var msg = JSON.parse(e.data);
+    document.title = msg.name;
+    if (msg.error) {
+      setStatus(msg.name + ": " + msg.error, true);
+    } else {
+      setStatus(msg.name + " (" + msg.version + ")", false);
+    }
+    if (msg.version != version) {
+      load(msg);
+    }
+  };
+  ws.onclose = function() {
+    setStatus("disconnected", true);
+    setTimeout(connect, 1000);
+  };
+}
+
+window.addEventListener("resize", function() {
+  camera.aspect = window.innerWidth / window.innerHeight;
+  camera.updateProjectionMatrix();
+  renderer.setSize(window.innerWidth, window.innerHeight);
+});
+
+function animate() {
+  requestAnimationFrame(animate);
+  renderer.render(scene, camera);
+}
+
+connect();
+animate();
+</script>
+</body>
+</html>
+`
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,202 @@
+//-----------------------------------------------------------------------------
+/*
+
+WebSockets
+
+A minimal server side websocket (RFC 6455) for pushing messages to the
+preview viewers. Only unfragmented text messages are sent, and messages
+from the viewer are read and discarded until it closes the connection.
+
+Browsers send an Origin header with the handshake. Handshakes from another
+origin (a page on another site) are refused, requests without an Origin
+header (non-browser clients) are accepted.
+
+*/
+//-----------------------------------------------------------------------------
+
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+//-----------------------------------------------------------------------------
+
+// wsGUID is appended to the client key for the handshake.
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// wsWriteTimeout is the time limit for sending a message.
+const wsWriteTimeout = 10 * time.Second
+
+// websocket opcodes
+const (
+	wsText  = 0x1
+	wsClose = 0x8
+)
+
+// wsConn is a websocket connection.
+type wsConn struct {
+	conn net.Conn
+	rd   *bufio.Reader
+	wmu  sync.Mutex // serializes the writes
+}
+
+// wsAccept returns the Sec-WebSocket-Accept value for a client key.
+func wsAccept(key string) string {
+	h := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// headerContains returns true if a comma separated header contains a token.
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sameOrigin returns true if the request has no Origin header, or the
+// origin host matches the request host.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// wsUpgrade upgrades an HTTP request to a websocket connection.
+// It writes an HTTP error response and returns nil on failure.
+func wsUpgrade(w http.ResponseWriter, r *http.Request) *wsConn {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet || key == "" ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "not a websocket handshake", http.StatusBadRequest)
+		return nil
+	}
+	if !sameOrigin(r) {
+		http.Error(w, "cross origin websocket request", http.StatusForbidden)
+		return nil
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websockets not supported", http.StatusInternalServerError)
+		return nil
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil
+	}
+	rsp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + wsAccept(key) + "\r\n\r\n"
+	conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if _, err := conn.Write([]byte(rsp)); err != nil {
+		conn.Close()
+		return nil
+	}
+	return &wsConn{conn: conn, rd: rw.Reader}
+}
+
+//-----------------------------------------------------------------------------
+
+// WriteText sends a text message.
+func (c *wsConn) WriteText(msg []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return c.writeText(msg)
+}
+
+// writeText sends a text message, the caller holds the write lock.
+func (c *wsConn) writeText(msg []byte) error {
+	hdr := []byte{0x80 | wsText, 0}
+	n := len(msg)
+	switch {
+	case n < 126:
+		hdr[1] = byte(n)
+	case n <= 0xffff:
+		hdr[1] = 126
+		hdr = append(hdr, 0, 0)
+		binary.BigEndian.PutUint16(hdr[2:], uint16(n))
+	default:
+		hdr[1] = 127
+		hdr = append(hdr, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(hdr[2:], uint64(n))
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	_, err := c.conn.Write(append(hdr, msg...))
+	return err
+}
+
+// Discard reads and discards messages until the connection is closed.
+func (c *wsConn) Discard() error {
+	var hdr [2]byte
+	for {
+		if _, err := io.ReadFull(c.rd, hdr[:]); err != nil {
+			return err
+		}
+		if hdr[0]&0xf == wsClose {
+			return nil
+		}
+		n := uint64(hdr[1] & 0x7f)
+		switch n {
+		case 126:
+			var b [2]byte
+			if _, err := io.ReadFull(c.rd, b[:]); err != nil {
+				return err
+			}
+			n = uint64(binary.BigEndian.Uint16(b[:]))
+		case 127:
+			var b [8]byte
+			if _, err := io.ReadFull(c.rd, b[:]); err != nil {
+				return err
+			}
+			n = binary.BigEndian.Uint64(b[:])
+		}
+		if hdr[1]&0x80 != 0 {
+			// masking key
+			n += 4
+		}
+		if n > 1<<20 {
+			return errors.New("websocket message too long")
+		}
+		if _, err := io.CopyN(ioutil.Discard, c.rd, int64(n)); err != nil {
+			return err
+		}
+	}
+}
+
+// Close closes the connection.
+func (c *wsConn) Close() error {
+	return c.conn.Close()
+}
+
+//-----------------------------------------------------------------------------
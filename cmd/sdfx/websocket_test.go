@@ -0,0 +1,224 @@
+//-----------------------------------------------------------------------------
+/*
+
+WebSocket Tests
+
+*/
+//-----------------------------------------------------------------------------
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+//-----------------------------------------------------------------------------
+
+// wsFrame returns a masked client frame.
+func wsFrame(opcode byte, payload []byte) []byte {
+	b := []byte{0x80 | opcode}
+	n := len(payload)
+	switch {
+	case n < 126:
+		b = append(b, 0x80|byte(n))
+	case n <= 0xffff:
+		b = append(b, 0x80|126, byte(n>>8), byte(n))
+	default:
+		b = append(b, 0x80|127)
+		b = append(b, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(b[2:], uint64(n))
+	}
+	mask := []byte{1, 2, 3, 4}
+	b = append(b, mask...)
+	for i, x := range payload {
+		b = append(b, x^mask[i&3])
+	}
+	return b
+}
+
+func Test_WsAccept(t *testing.T) {
+	// RFC 6455 section 1.3
+	if wsAccept("dGhlIHNhbXBsZSBub25jZQ==") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Error("FAIL")
+	}
+}
+
+func Test_WsHandshake(t *testing.T) {
+	s := testServer(t)
+	ts := httptest.NewServer(s.handler())
+	defer ts.Close()
+	host := strings.TrimPrefix(ts.URL, "http://")
+
+	conn, err := net.Dial("tcp", host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/ws", nil)
+	req.Header.Set("Connection", "keep-alive, Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Header.Set("Origin", ts.URL)
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	rd := bufio.NewReader(conn)
+	rsp, err := http.ReadResponse(rd, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rsp.StatusCode != http.StatusSwitchingProtocols || rsp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("FAIL %s", rsp.Status)
+	}
+
+	// the current preview message
+	var hdr [2]byte
+	if _, err := io.ReadFull(rd, hdr[:]); err != nil {
+		t.Fatal(err)
+	}
+	n := int(hdr[1] & 0x7f)
+	if n == 126 {
+		var b [2]byte
+		io.ReadFull(rd, b[:])
+		n = int(binary.BigEndian.Uint16(b[:]))
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(rd, msg); err != nil {
+		t.Fatal(err)
+	}
+	if hdr[0] != 0x80|wsText || !bytes.HasPrefix(msg, []byte("{")) {
+		t.Errorf("FAIL message %x %s", hdr, msg)
+	}
+
+	// a client message is discarded, a close removes the client
+	conn.Write(wsFrame(wsText, []byte("hello")))
+	conn.Write(wsFrame(wsClose, nil))
+	if _, err := rd.ReadByte(); err != io.EOF {
+		t.Errorf("FAIL connection not closed: %v", err)
+	}
+	s.mu.Lock()
+	if len(s.clients) != 0 {
+		t.Error("FAIL client not removed")
+	}
+	s.mu.Unlock()
+}
+
+func Test_WsStalled(t *testing.T) {
+	s := testServer(t)
+	// a viewer that doesn't read its messages
+	a, b := net.Pipe()
+	defer b.Close()
+	stalled := &wsConn{conn: a}
+	s.clients[stalled] = true
+	done := make(chan bool)
+	go func() {
+		s.broadcast()
+		done <- true
+	}()
+	// the other requests aren't held up
+	ok := make(chan bool)
+	go func() {
+		ok <- request(s, http.MethodGet, "/bounds", "").Code == http.StatusOK
+	}()
+	select {
+	case x := <-ok:
+		if !x {
+			t.Error("FAIL")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("FAIL request blocked by a stalled viewer")
+	}
+	// the failed viewer is dropped
+	b.Close()
+	<-done
+	s.mu.Lock()
+	if s.clients[stalled] {
+		t.Error("FAIL stalled viewer not dropped")
+	}
+	s.mu.Unlock()
+}
+
+func Test_WsHandshakeErrors(t *testing.T) {
+	s := testServer(t)
+	tests := []struct {
+		header map[string]string
+		code   int
+	}{
+		{map[string]string{"Upgrade": "websocket", "Sec-WebSocket-Key": "x", "Sec-WebSocket-Version": "13"}, http.StatusBadRequest},
+		{map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Key": "x"}, http.StatusUpgradeRequired},
+		{map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Key": "x", "Sec-WebSocket-Version": "13",
+			"Origin": "http://evil.example.com"}, http.StatusForbidden},
+		{map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Key": "x", "Sec-WebSocket-Version": "13",
+			"Origin": "http://localhost:8080"}, http.StatusForbidden},
+	}
+	for i, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "http://localhost:9000/ws", nil)
+		for k, v := range test.header {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		s.handler().ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("FAIL test %d: %d, expected %d", i, w.Code, test.code)
+		}
+	}
+}
+
+func Test_WsDiscard(t *testing.T) {
+	long := bytes.Repeat([]byte("x"), 300)
+	tests := []struct {
+		in  [][]byte
+		err bool
+	}{
+		{[][]byte{wsFrame(wsClose, nil)}, false},
+		{[][]byte{wsFrame(wsText, []byte("abc")), wsFrame(wsText, long), wsFrame(wsClose, []byte{3, 232})}, false},
+		{[][]byte{wsFrame(wsText, make([]byte, 1<<20+1))}, true},
+		{[][]byte{wsFrame(wsText, []byte("abc"))}, true},
+		{[][]byte{wsFrame(wsText, long)[:10]}, true},
+	}
+	for i, test := range tests {
+		c := &wsConn{rd: bufio.NewReader(bytes.NewReader(bytes.Join(test.in, nil)))}
+		if err := c.Discard(); (err != nil) != test.err {
+			t.Errorf("FAIL test %d: %v", i, err)
+		}
+	}
+}
+
+func Test_WsWriteText(t *testing.T) {
+	for _, n := range []int{0, 125, 126, 0xffff, 0x10000} {
+		a, b := net.Pipe()
+		c := &wsConn{conn: a}
+		msg := bytes.Repeat([]byte("y"), n)
+		go func() {
+			c.WriteText(msg)
+			a.Close()
+		}()
+		frame, _ := ioutil.ReadAll(b)
+		var hdr []byte
+		switch {
+		case n < 126:
+			hdr = []byte{0x81, byte(n)}
+		case n <= 0xffff:
+			hdr = []byte{0x81, 126, byte(n >> 8), byte(n)}
+		default:
+			hdr = []byte{0x81, 127, 0, 0, 0, 0, 0, byte(n >> 16), byte(n >> 8), byte(n)}
+		}
+		if !bytes.Equal(frame, append(hdr, msg...)) {
+			t.Errorf("FAIL length %d", n)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
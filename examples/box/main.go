@@ -34,8 +34,35 @@ func box1() {
 
 //-----------------------------------------------------------------------------
 
+func box2() {
+
+	bp := ProjectBoxParms{
+		Size:       V3{80.0, 60.0, 30.0}, // outer dimensions
+		Wall:       2.0,                  // wall thickness
+		Rounding:   5.0,                  // outer corner rounding
+		Lid:        2.0,                  // lid thickness
+		Lip:        3.0,                  // lid lip depth
+		Clearance:  0.2,                  // lip fit clearance
+		Screw:      "M3x0.5",             // corner bosses for M3 screws
+		VentSlots:  7,                    // ventilation slots
+		VentWidth:  2.0,                  // slot width
+		VentLength: 30.0,                 // slot length
+	}
+
+	box, err := ProjectBox(&bp)
+	if err != nil {
+		panic(err)
+	}
+
+	RenderSTL(box[0], 300, "base.stl")
+	RenderSTL(box[1], 300, "lid.stl")
+}
+
+//-----------------------------------------------------------------------------
+
 func main() {
 	box1()
+	box2()
 }
 
 //-----------------------------------------------------------------------------
@@ -0,0 +1,281 @@
+//-----------------------------------------------------------------------------
+/*
+
+Example Gallery
+
+Example models register themselves (see models.go) and Build generates
+all of them in parallel into an output directory:
+
+	name.stl   mesh (3d models)
+	name.dxf   line segments (2d models)
+	name.png   rendered image
+	name.json  measurements (mesh statistics, mass properties)
+	index.html the gallery page
+
+Building the gallery exercises most of the package, so it's also a
+regression test (see gallery_test.go).
+
+	sdfx gallery -o gallery
+
+*/
+//-----------------------------------------------------------------------------
+
+package gallery
+
+import (
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// defaultMeshCells is the mesh resolution for an example without one.
+const defaultMeshCells = 100
+
+// Example is a registered example model.
+type Example struct {
+	Name        string                   // unique name (used for the file names)
+	Description string                   // one line description
+	Model3      func() (sdf.SDF3, error) // 3d model (or nil)
+	Model2      func() (sdf.SDF2, error) // 2d model (or nil)
+	MeshCells   int                      // mesh resolution (cells on the longest axis)
+}
+
+var (
+	lock     sync.Mutex
+	examples = make(map[string]Example)
+)
+
+// Register adds an example to the gallery.
+func Register(e Example) {
+	if (e.Model3 == nil) == (e.Model2 == nil) {
+		panic(fmt.Sprintf("example %s needs a 2d or a 3d model", e.Name))
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if _, ok := examples[e.Name]; ok {
+		panic(fmt.Sprintf("example %s is already registered", e.Name))
+	}
+	examples[e.Name] = e
+}
+
+// Examples returns the registered examples sorted by name.
+func Examples() []Example {
+	lock.Lock()
+	defer lock.Unlock()
+	list := make([]Example, 0, len(examples))
+	for _, e := range examples {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+//-----------------------------------------------------------------------------
+
+// BuildParms defines the parameters for building the gallery.
+type BuildParms struct {
+	Dir       string // output directory
+	Workers   int    // number of examples built in parallel (0 == number of CPUs)
+	MeshCells int    // override the example mesh resolutions (0 == example resolution)
+	ImageSize sdf.V2i
+}
+
+// Result is the result of building an example.
+type Result struct {
+	Example
+	Files    []string            // output files
+	Stats    *sdf.MeshStatistics // 3d mesh statistics
+	Mass     *sdf.MassProperties // 3d mass properties
+	Lines    int                 // 2d line segments
+	Duration time.Duration       // build time
+	Err      error
+}
+
+// render2D rasterizes an SDF2 (inside is the material color).
+func render2D(s sdf.SDF2, size sdf.V2i) image.Image {
+	bb := s.BoundingBox().ScaleAboutCenter(1.1)
+	// keep the aspect ratio
+	scale := sdf.Max(bb.Size().X/float64(size[0]), bb.Size().Y/float64(size[1]))
+	center := bb.Center()
+	img := image.NewRGBA(image.Rect(0, 0, size[0], size[1]))
+	for y := 0; y < size[1]; y++ {
+		for x := 0; x < size[0]; x++ {
+			p := sdf.V2{
+				X: center.X + (float64(x)+0.5-0.5*float64(size[0]))*scale,
+				Y: center.Y - (float64(y)+0.5-0.5*float64(size[1]))*scale,
+			}
+			c := color.RGBA{0xff, 0xff, 0xff, 0xff}
+			if s.Evaluate(p) <= 0 {
+				c = color.RGBA{0x4a, 0x90, 0xd9, 0xff}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// savePNG writes an image to a PNG file.
+func savePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return png.Encode(f, img)
+}
+
+// build3 builds a 3d example.
+func build3(e Example, k *BuildParms, cells int, r *Result) error {
+	s, err := e.Model3()
+	if err != nil {
+		return err
+	}
+	base := filepath.Join(k.Dir, e.Name)
+	mesh := sdf.GenerateTriangles(s, cells)
+	if err := sdf.SaveSTL(base+".stl", mesh); err != nil {
+		return err
+	}
+	r.Files = append(r.Files, e.Name+".stl")
+	// render
+	o := sdf.DefaultRenderOptions(s)
+	o.Size = k.ImageSize
+	o.Samples = 1
+	o.Path = base + ".png"
+	if err := sdf.Render(s, o); err != nil {
+		return err
+	}
+	r.Files = append(r.Files, e.Name+".png")
+	// measurements
+	r.Stats = sdf.MeshStats(mesh)
+	resolution := s.BoundingBox().Size().MaxComponent() / float64(cells)
+	r.Mass, err = sdf.Properties3D(s, 1, resolution)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(base + ".json")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := sdf.EncodeReport(f, r.Stats, r.Mass); err != nil {
+		return err
+	}
+	r.Files = append(r.Files, e.Name+".json")
+	return nil
+}
+
+// build2 builds a 2d example.
+func build2(e Example, k *BuildParms, cells int, r *Result) error {
+	s, err := e.Model2()
+	if err != nil {
+		return err
+	}
+	base := filepath.Join(k.Dir, e.Name)
+	lines := sdf.GenerateLines(s, cells)
+	if err := sdf.SaveDXF(base+".dxf", lines); err != nil {
+		return err
+	}
+	r.Files = append(r.Files, e.Name+".dxf")
+	r.Lines = len(lines)
+	if err := savePNG(base+".png", render2D(s, k.ImageSize)); err != nil {
+		return err
+	}
+	r.Files = append(r.Files, e.Name+".png")
+	return nil
+}
+
+// Build builds the registered examples into the output directory and writes
+// the gallery page. It returns the results for each example.
+func Build(k *BuildParms) ([]Result, error) {
+	if err := os.MkdirAll(k.Dir, 0755); err != nil {
+		return nil, err
+	}
+	if k.ImageSize == (sdf.V2i{}) {
+		k.ImageSize = sdf.V2i{400, 300}
+	}
+	workers := k.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	list := Examples()
+	results := make([]Result, len(list))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				e := list[j]
+				cells := k.MeshCells
+				if cells <= 0 {
+					cells = e.MeshCells
+				}
+				if cells <= 0 {
+					cells = defaultMeshCells
+				}
+				r := &results[j]
+				r.Example = e
+				start := time.Now()
+				if e.Model3 != nil {
+					r.Err = build3(e, k, cells, r)
+				} else {
+					r.Err = build2(e, k, cells, r)
+				}
+				r.Duration = time.Since(start)
+			}
+		}()
+	}
+	for j := range list {
+		jobs <- j
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results, writeIndex(filepath.Join(k.Dir, "index.html"), results)
+}
+
+//-----------------------------------------------------------------------------
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>sdfx gallery</title></head>
+<body>
+<h1>sdfx gallery</h1>
+<table>
+{{range .}}<tr>
+<td>{{if not .Err}}<img src="{{.Name}}.png" width="200">{{end}}</td>
+<td><b>{{.Name}}</b><br>{{.Description}}<br>
+{{range .Files}}<a href="{{.}}">{{.}}</a> {{end}}<br>
+{{if .Err}}error: {{.Err}}{{else if .Stats}}{{.Stats.Triangles}} triangles, volume {{printf "%.1f" .Mass.Volume}}, area {{printf "%.1f" .Mass.Area}}{{else}}{{.Lines}} lines{{end}}<br>
+{{.Duration}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// writeIndex writes the gallery page.
+func writeIndex(path string, results []Result) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return indexTemplate.Execute(f, results)
+}
+
+//-----------------------------------------------------------------------------
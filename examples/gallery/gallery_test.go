@@ -0,0 +1,72 @@
+//-----------------------------------------------------------------------------
+/*
+
+Build the gallery at a low resolution as a regression test.
+
+*/
+//-----------------------------------------------------------------------------
+
+package gallery
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+func Test_Gallery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gallery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	results, err := Build(&BuildParms{
+		Dir:       dir,
+		MeshCells: 50,
+		ImageSize: sdf.V2i{80, 60},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(Examples()) {
+		t.Errorf("FAIL %d results for %d examples", len(results), len(Examples()))
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			t.Errorf("FAIL %s: %s", r.Name, r.Err)
+			continue
+		}
+		for _, f := range r.Files {
+			if _, err := os.Stat(filepath.Join(dir, f)); err != nil {
+				t.Errorf("FAIL %s: %s", r.Name, err)
+			}
+		}
+		if r.Model3 != nil {
+			if r.Stats.Triangles == 0 || r.Mass.Volume <= 0 {
+				t.Errorf("FAIL %s: empty model", r.Name)
+			}
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "index.html")); err != nil {
+		t.Error("FAIL no index.html")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Register(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("FAIL duplicate name registered")
+		}
+	}()
+	Register(Example{Name: "gear", Model3: gear})
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,148 @@
+//-----------------------------------------------------------------------------
+/*
+
+Gallery Models
+
+Each example registers itself in an init function. To add an example, add a
+function returning the model and register it here.
+
+*/
+//-----------------------------------------------------------------------------
+
+package gallery
+
+import "github.com/deadsy/sdfx/sdf"
+
+//-----------------------------------------------------------------------------
+
+func gearProfile() (sdf.SDF2, error) {
+	return sdf.InvoluteGear(
+		20,           // number of teeth
+		2.0,          // gear module
+		sdf.DtoR(20), // pressure angle
+		0.1,          // backlash
+		0.25,         // clearance
+		5.0,          // ring width
+		7,            // facets
+	), nil
+}
+
+func gear() (sdf.SDF3, error) {
+	s, err := gearProfile()
+	if err != nil {
+		return nil, err
+	}
+	return sdf.Extrude3D(s, 10), nil
+}
+
+func bolt() (sdf.SDF3, error) {
+	return sdf.Bolt(&sdf.BoltParms{
+		Thread:      "M10x1.5",
+		Style:       "hex",
+		TotalLength: 40,
+		ShankLength: 10,
+	})
+}
+
+func nut() (sdf.SDF3, error) {
+	return sdf.Nut(&sdf.NutParms{
+		Thread:    "M10x1.5",
+		Style:     "hex",
+		Tolerance: 0.1,
+	})
+}
+
+func washer() (sdf.SDF3, error) {
+	return sdf.Washer3D(&sdf.WasherParms{
+		Thickness:   2,
+		InnerRadius: 5.5,
+		OuterRadius: 10,
+	}), nil
+}
+
+func panel() (sdf.SDF2, error) {
+	return sdf.Panel2D(&sdf.PanelParms{
+		Size:         sdf.V2{X: 80, Y: 50},
+		CornerRadius: 5,
+		HoleDiameter: 3.5,
+		HoleMargin:   [4]float64{5, 5, 5, 5},
+		HolePattern:  [4]string{"x..x", "x", "x..x", "x"},
+	}), nil
+}
+
+func cam() (sdf.SDF2, error) {
+	return sdf.FlatFlankCam2D(30, 20, 8), nil
+}
+
+func standoff() (sdf.SDF3, error) {
+	return sdf.Standoff3D(&sdf.StandoffParms{
+		PillarHeight:   20,
+		PillarDiameter: 8,
+		HoleDepth:      10,
+		HoleDiameter:   2.5,
+		NumberWebs:     4,
+		WebHeight:      10,
+		WebDiameter:    20,
+		WebWidth:       2,
+	}), nil
+}
+
+func roundedBox() (sdf.SDF3, error) {
+	box := sdf.Box3D(sdf.V3{X: 40, Y: 30, Z: 20}, 3)
+	hole := sdf.Cylinder3D(30, 6, 0)
+	return sdf.Difference3D(box, hole), nil
+}
+
+//-----------------------------------------------------------------------------
+
+func init() {
+	Register(Example{
+		Name:        "gear_profile",
+		Description: "20 tooth involute gear profile, module 2",
+		Model2:      gearProfile,
+	})
+	Register(Example{
+		Name:        "gear",
+		Description: "20 tooth involute gear, module 2, 10 mm thick",
+		Model3:      gear,
+	})
+	Register(Example{
+		Name:        "bolt",
+		Description: "M10x1.5 hex head bolt, 40 mm long",
+		Model3:      bolt,
+		MeshCells:   200,
+	})
+	Register(Example{
+		Name:        "nut",
+		Description: "M10x1.5 hex nut",
+		Model3:      nut,
+		MeshCells:   150,
+	})
+	Register(Example{
+		Name:        "washer",
+		Description: "M10 washer",
+		Model3:      washer,
+	})
+	Register(Example{
+		Name:        "panel",
+		Description: "80x50 mm panel with mounting holes",
+		Model2:      panel,
+	})
+	Register(Example{
+		Name:        "cam",
+		Description: "flat flank cam profile",
+		Model2:      cam,
+	})
+	Register(Example{
+		Name:        "standoff",
+		Description: "PCB standoff with support webs",
+		Model3:      standoff,
+	})
+	Register(Example{
+		Name:        "box",
+		Description: "rounded box with a through hole",
+		Model3:      roundedBox,
+	})
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,60 @@
+//go:build js && wasm
+// +build js,wasm
+
+//-----------------------------------------------------------------------------
+/*
+
+WebAssembly Customizer
+
+A parameterised model evaluated and meshed in the browser.
+See index.html for the JS side.
+
+*/
+//-----------------------------------------------------------------------------
+
+package main
+
+import (
+	"errors"
+
+	"github.com/deadsy/sdfx/sdf"
+	"github.com/deadsy/sdfx/wasm"
+)
+
+//-----------------------------------------------------------------------------
+
+// param returns a named parameter (or a default value).
+func param(params map[string]float64, name string, x float64) float64 {
+	if v, ok := params[name]; ok {
+		return v
+	}
+	return x
+}
+
+// block returns a rounded block with a hole through it.
+func block(params map[string]float64) (sdf.SDF3, error) {
+	size := param(params, "size", 30)
+	round := param(params, "round", 3)
+	hole := param(params, "hole", 10)
+	if size <= 0 || round < 0 || 2*round >= size {
+		return nil, errors.New("bad size/round")
+	}
+	if hole < 0 || hole >= size {
+		return nil, errors.New("bad hole size")
+	}
+	s := sdf.Box3D(sdf.V3{X: size, Y: size, Z: size}, round)
+	if hole == 0 {
+		return s, nil
+	}
+	return sdf.Difference3D(s, sdf.Cylinder3D(size, 0.5*hole, 0)), nil
+}
+
+//-----------------------------------------------------------------------------
+
+func main() {
+	wasm.Export3("block", block)
+	// keep running so JS can call the exported functions
+	select {}
+}
+
+//-----------------------------------------------------------------------------
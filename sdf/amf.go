@@ -0,0 +1,163 @@
+//-----------------------------------------------------------------------------
+/*
+
+AMF Save
+
+Write triangle meshes as an Additive Manufacturing File (ISO/ASTM 52915).
+
+An AMF file has the units of the coordinates, any number of named objects
+(each with an indexed mesh and metadata) and an optional constellation
+that places instances of the objects on the build plate. E.g. a bolt and
+two nuts can be written as one file ready to print.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+//-----------------------------------------------------------------------------
+
+// AMFObject is a named object in an AMF file.
+type AMFObject struct {
+	Name     string
+	Mesh     []*Triangle3
+	Metadata map[string]string // object metadata, e.g. "material": "PETG"
+}
+
+// NewAMFObject returns a named object for an SDF3 meshed with meshCells cells on the longest axis.
+func NewAMFObject(name string, s SDF3, meshCells int) AMFObject {
+	return AMFObject{
+		Name: name,
+		Mesh: GenerateTriangles(s, meshCells),
+	}
+}
+
+// AMFInstance is a placement of an object in the constellation.
+type AMFInstance struct {
+	Object   int // index of the object
+	Position V3  // translation
+	Rotation V3  // rotation about the x, y and z axes (radians)
+}
+
+// AMFParms defines the contents of an AMF file.
+type AMFParms struct {
+	Unit          string            // "millimeter", "inch", "feet", "meter" or "micron" ("" == millimeter)
+	Metadata      map[string]string // document metadata, e.g. "name", "author"
+	Objects       []AMFObject       // objects
+	Constellation []AMFInstance     // object placements (nil == no constellation)
+}
+
+var amfUnits = map[string]bool{"": true, "millimeter": true, "inch": true, "feet": true, "meter": true, "micron": true}
+
+// validate checks the AMF parameters.
+func (k *AMFParms) validate() error {
+	if !amfUnits[k.Unit] {
+		return fmt.Errorf("unknown unit \"%s\"", k.Unit)
+	}
+	if len(k.Objects) == 0 {
+		return errors.New("no objects")
+	}
+	for i, o := range k.Objects {
+		if len(o.Mesh) == 0 {
+			return fmt.Errorf("object %d has an empty mesh", i)
+		}
+	}
+	for _, x := range k.Constellation {
+		if x.Object < 0 || x.Object >= len(k.Objects) {
+			return fmt.Errorf("no object %d for constellation instance", x.Object)
+		}
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// writeMetadata writes metadata elements (sorted by type).
+func writeMetadata(w io.Writer, indent string, metadata map[string]string) {
+	keys := make([]string, 0, len(metadata))
+	for k := range metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s<metadata type=\"%s\">%s</metadata>\n", indent, xmlEscape(k), xmlEscape(metadata[k]))
+	}
+}
+
+// EncodeAMF writes triangle mesh objects to a writer in AMF format.
+func EncodeAMF(w io.Writer, k *AMFParms) error {
+	if err := k.validate(); err != nil {
+		return err
+	}
+	unit := k.Unit
+	if unit == "" {
+		unit = "millimeter"
+	}
+
+	buf := bufio.NewWriter(w)
+	fmt.Fprintf(buf, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	fmt.Fprintf(buf, "<amf unit=\"%s\" version=\"1.1\">\n", unit)
+	writeMetadata(buf, " ", k.Metadata)
+	for i, o := range k.Objects {
+		fmt.Fprintf(buf, " <object id=\"%d\">\n", i)
+		metadata := map[string]string{}
+		for key, value := range o.Metadata {
+			metadata[key] = value
+		}
+		if o.Name != "" {
+			metadata["name"] = o.Name
+		}
+		writeMetadata(buf, "  ", metadata)
+		// indexed mesh
+		v := newWelder(0)
+		faces := make([][3]int, len(o.Mesh))
+		for j, t := range o.Mesh {
+			for l := range t.V {
+				faces[j][l], _ = v.index(t.V[l])
+			}
+		}
+		fmt.Fprintf(buf, "  <mesh>\n   <vertices>\n")
+		for _, p := range v.vertex {
+			fmt.Fprintf(buf, "    <vertex><coordinates><x>%g</x><y>%g</y><z>%g</z></coordinates></vertex>\n", p.X, p.Y, p.Z)
+		}
+		fmt.Fprintf(buf, "   </vertices>\n   <volume>\n")
+		for _, f := range faces {
+			fmt.Fprintf(buf, "    <triangle><v1>%d</v1><v2>%d</v2><v3>%d</v3></triangle>\n", f[0], f[1], f[2])
+		}
+		fmt.Fprintf(buf, "   </volume>\n  </mesh>\n </object>\n")
+	}
+	if len(k.Constellation) != 0 {
+		fmt.Fprintf(buf, " <constellation id=\"%d\">\n", len(k.Objects))
+		for _, x := range k.Constellation {
+			// AMF rotations are in degrees
+			fmt.Fprintf(buf, "  <instance objectid=\"%d\">", x.Object)
+			fmt.Fprintf(buf, "<deltax>%g</deltax><deltay>%g</deltay><deltaz>%g</deltaz>", x.Position.X, x.Position.Y, x.Position.Z)
+			fmt.Fprintf(buf, "<rx>%g</rx><ry>%g</ry><rz>%g</rz>", RtoD(x.Rotation.X), RtoD(x.Rotation.Y), RtoD(x.Rotation.Z))
+			fmt.Fprintf(buf, "</instance>\n")
+		}
+		fmt.Fprintf(buf, " </constellation>\n")
+	}
+	fmt.Fprintf(buf, "</amf>\n")
+	return buf.Flush()
+}
+
+// SaveAMF writes triangle mesh objects to an AMF file.
+func SaveAMF(path string, k *AMFParms) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return EncodeAMF(file, k)
+}
+
+//-----------------------------------------------------------------------------
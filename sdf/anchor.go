@@ -0,0 +1,224 @@
+//-----------------------------------------------------------------------------
+/*
+
+Anchors and Attachment
+
+Parts can have named anchor frames (a position and an orientation), and
+Attach3D assembles two parts by moving the second part so its anchor mates
+with an anchor on the first part. This replaces the transform arithmetic
+that's otherwise needed to line up the parts of an assembly.
+
+An anchor frame has an origin, a Z direction pointing out of the part and
+an X direction (perpendicular to Z) setting the rotation about Z. Mated
+anchors have the same origin, opposing Z directions and the same X
+direction.
+
+The anchors of an SDF3 are found by descending the tree:
+
+Anchor: the named anchors, then the anchors of the underlying SDF3.
+Transform and scale: the (moved) anchors of the underlying SDF3.
+Union, difference and intersection: the anchors of the SDF3s, in order.
+Tag and offset: the anchors of the underlying SDF3.
+
+So the anchors of both parts can be used to attach more parts to an
+assembly. If no anchor is found, the faces of the bounding box of the SDF3
+have the anchors "top" (+z), "bottom" (-z), "right" (+x), "left" (-x),
+"back" (+y) and "front" (-y), and "center" is the center of the bounding
+box (facing +z).
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"fmt"
+	"math"
+)
+
+//-----------------------------------------------------------------------------
+
+// Frame is an anchor frame, a position and an orientation on a part.
+type Frame struct {
+	Origin V3 // position
+	Z      V3 // outward direction (unit vector)
+	X      V3 // reference direction, perpendicular to Z (unit vector)
+}
+
+// NewFrame returns an anchor frame. The directions are normalized and x is
+// made perpendicular to z. If x is zero (or parallel to z) a perpendicular
+// direction is chosen.
+func NewFrame(origin, z, x V3) Frame {
+	if z.Length() == 0 {
+		panic("z direction is zero")
+	}
+	z = z.Normalize()
+	x = x.Sub(z.MulScalar(x.Dot(z)))
+	if x.Length() < tolerance {
+		// any perpendicular direction
+		if math.Abs(z.X) < 0.9 {
+			x = V3{1, 0, 0}
+		} else {
+			x = V3{0, 1, 0}
+		}
+		x = x.Sub(z.MulScalar(x.Dot(z)))
+	}
+	return Frame{origin, z, x.Normalize()}
+}
+
+// Matrix returns the matrix that maps frame coordinates to part coordinates.
+func (f Frame) Matrix() M44 {
+	y := f.Z.Cross(f.X)
+	return M44{
+		f.X.X, y.X, f.Z.X, f.Origin.X,
+		f.X.Y, y.Y, f.Z.Y, f.Origin.Y,
+		f.X.Z, y.Z, f.Z.Z, f.Origin.Z,
+		0, 0, 0, 1}
+}
+
+// Transform returns the frame moved by a transform matrix.
+func (f Frame) Transform(m M44) Frame {
+	o := m.MulPosition(f.Origin)
+	z := m.MulPosition(f.Origin.Add(f.Z)).Sub(o)
+	x := m.MulPosition(f.Origin.Add(f.X)).Sub(o)
+	return NewFrame(o, z, x)
+}
+
+//-----------------------------------------------------------------------------
+
+// AnchorSDF3 is an SDF3 with named anchor frames.
+type AnchorSDF3 struct {
+	sdf     SDF3
+	anchors map[string]Frame
+}
+
+// Anchor3D returns an SDF3 with named anchor frames.
+func Anchor3D(sdf SDF3, anchors map[string]Frame) SDF3 {
+	s := AnchorSDF3{sdf: sdf, anchors: make(map[string]Frame, len(anchors))}
+	for name, f := range anchors {
+		s.anchors[name] = NewFrame(f.Origin, f.Z, f.X)
+	}
+	return &s
+}
+
+// Evaluate returns the minimum distance to an anchored SDF3.
+func (s *AnchorSDF3) Evaluate(p V3) float64 {
+	return s.sdf.Evaluate(p)
+}
+
+// EvaluateInterval returns the range of distances to an anchored SDF3 within a box.
+func (s *AnchorSDF3) EvaluateInterval(b Box3) Interval {
+	return EvaluateInterval3(s.sdf, b)
+}
+
+// BoundingBox returns the bounding box of an anchored SDF3.
+func (s *AnchorSDF3) BoundingBox() Box3 {
+	return s.sdf.BoundingBox()
+}
+
+// Tag returns the tag of an anchored SDF3.
+func (s *AnchorSDF3) Tag(p V3) int {
+	return TagAt(s.sdf, p)
+}
+
+//-----------------------------------------------------------------------------
+
+// findAnchor returns a named anchor frame within an SDF3 tree.
+func findAnchor(s SDF3, name string) (Frame, bool) {
+	switch s := s.(type) {
+	case *AnchorSDF3:
+		if f, ok := s.anchors[name]; ok {
+			return f, true
+		}
+		return findAnchor(s.sdf, name)
+	case *TransformSDF3:
+		if f, ok := findAnchor(s.sdf, name); ok {
+			return f.Transform(s.matrix), true
+		}
+	case *ScaleUniformSDF3:
+		if f, ok := findAnchor(s.sdf, name); ok {
+			f.Origin = f.Origin.MulScalar(s.k)
+			return f, true
+		}
+	case *TagSDF3:
+		return findAnchor(s.sdf, name)
+	case *OffsetSDF3:
+		return findAnchor(s.sdf, name)
+	case *UnionSDF3:
+		for _, x := range s.sdf {
+			if f, ok := findAnchor(x, name); ok {
+				return f, true
+			}
+		}
+	case *DifferenceSDF3:
+		if f, ok := findAnchor(s.s0, name); ok {
+			return f, true
+		}
+		return findAnchor(s.s1, name)
+	case *IntersectionSDF3:
+		if f, ok := findAnchor(s.s0, name); ok {
+			return f, true
+		}
+		return findAnchor(s.s1, name)
+	}
+	return Frame{}, false
+}
+
+// boxAnchor returns a bounding box anchor frame.
+func boxAnchor(bb Box3, name string) (Frame, bool) {
+	c := bb.Center()
+	h := bb.Size().MulScalar(0.5)
+	switch name {
+	case "top":
+		return Frame{c.Add(V3{0, 0, h.Z}), V3{0, 0, 1}, V3{1, 0, 0}}, true
+	case "bottom":
+		return Frame{c.Sub(V3{0, 0, h.Z}), V3{0, 0, -1}, V3{1, 0, 0}}, true
+	case "right":
+		return Frame{c.Add(V3{h.X, 0, 0}), V3{1, 0, 0}, V3{0, 0, 1}}, true
+	case "left":
+		return Frame{c.Sub(V3{h.X, 0, 0}), V3{-1, 0, 0}, V3{0, 0, 1}}, true
+	case "back":
+		return Frame{c.Add(V3{0, h.Y, 0}), V3{0, 1, 0}, V3{0, 0, 1}}, true
+	case "front":
+		return Frame{c.Sub(V3{0, h.Y, 0}), V3{0, -1, 0}, V3{0, 0, 1}}, true
+	case "center":
+		return Frame{c, V3{0, 0, 1}, V3{1, 0, 0}}, true
+	}
+	return Frame{}, false
+}
+
+// GetAnchor returns a named anchor frame of an SDF3.
+func GetAnchor(s SDF3, name string) (Frame, bool) {
+	if f, ok := findAnchor(s, name); ok {
+		return f, true
+	}
+	return boxAnchor(s.BoundingBox(), name)
+}
+
+// AttachTransform returns the transform that moves part b so its anchor
+// mates with the anchor of part a.
+func AttachTransform(a SDF3, anchorA string, b SDF3, anchorB string) M44 {
+	fa, ok := GetAnchor(a, anchorA)
+	if !ok {
+		panic(fmt.Sprintf("no anchor \"%s\"", anchorA))
+	}
+	fb, ok := GetAnchor(b, anchorB)
+	if !ok {
+		panic(fmt.Sprintf("no anchor \"%s\"", anchorB))
+	}
+	// frame b to frame a, with the z direction reversed
+	flip := M44{
+		1, 0, 0, 0,
+		0, -1, 0, 0,
+		0, 0, -1, 0,
+		0, 0, 0, 1}
+	return fa.Matrix().Mul(flip).Mul(fb.Matrix().Inverse())
+}
+
+// Attach3D returns the union of part a and part b, with part b moved so its
+// anchor mates with the anchor of part a.
+func Attach3D(a SDF3, anchorA string, b SDF3, anchorB string) SDF3 {
+	return Union3D(a, Transform3D(b, AttachTransform(a, anchorA, b, anchorB)))
+}
+
+//-----------------------------------------------------------------------------
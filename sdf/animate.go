@@ -0,0 +1,280 @@
+//-----------------------------------------------------------------------------
+/*
+
+Time Varying SDFs
+
+An SDF4 is an SDF3 that changes with time (x, y, z, t). It can animate a
+mechanism (parts moving on a path) or morph between designs. Each frame of
+an animation is an SDF3 (see Frame4D) and a sequence of frames can be
+meshed and written as numbered STL or OBJ files (see RenderSequence).
+
+The frames of a sequence are meshed with the same sampling resolution, so
+the tessellation doesn't jump about between the frames.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+//-----------------------------------------------------------------------------
+
+// SDF4 is the interface to a time varying SDF3.
+type SDF4 interface {
+	Evaluate(p V3, t float64) float64
+	BoundingBox(t float64) Box3
+}
+
+// framer is an SDF4 that has a faster SDF3 for a single frame.
+type framer interface {
+	Frame(t float64) SDF3
+}
+
+//-----------------------------------------------------------------------------
+// A single frame of an SDF4.
+
+// FrameSDF3 is an SDF4 at a fixed time.
+type FrameSDF3 struct {
+	sdf SDF4
+	t   float64
+	bb  Box3
+}
+
+// Frame4D returns the SDF3 for an SDF4 at time t.
+func Frame4D(sdf SDF4, t float64) SDF3 {
+	if f, ok := sdf.(framer); ok {
+		return f.Frame(t)
+	}
+	return &FrameSDF3{
+		sdf: sdf,
+		t:   t,
+		bb:  sdf.BoundingBox(t),
+	}
+}
+
+// Evaluate returns the minimum distance to an SDF4 frame.
+func (s *FrameSDF3) Evaluate(p V3) float64 {
+	return s.sdf.Evaluate(p, s.t)
+}
+
+// BoundingBox returns the bounding box of an SDF4 frame.
+func (s *FrameSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+// SDF4 from a distance function.
+
+// FuncSDF4 is an SDF4 defined by a distance function of position and time.
+type FuncSDF4 struct {
+	f  func(p V3, t float64) float64
+	bb Box3
+}
+
+// Func4D returns an SDF4 for a distance function of position and time.
+// The bounding box contains the shape at all times.
+func Func4D(f func(p V3, t float64) float64, bb Box3) SDF4 {
+	return &FuncSDF4{f: f, bb: bb}
+}
+
+// Evaluate returns the minimum distance to a function SDF4.
+func (s *FuncSDF4) Evaluate(p V3, t float64) float64 {
+	return s.f(p, t)
+}
+
+// BoundingBox returns the bounding box of a function SDF4.
+func (s *FuncSDF4) BoundingBox(t float64) Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+// Morph between two SDF3s.
+
+// MorphSDF4 is a blend from one SDF3 (t = 0) to another (t = 1).
+type MorphSDF4 struct {
+	s0, s1 SDF3
+	bb     Box3
+}
+
+// Morph4D returns an SDF4 that blends from s0 at t = 0 to s1 at t = 1.
+// The time is clamped to [0, 1].
+func Morph4D(s0, s1 SDF3) SDF4 {
+	return &MorphSDF4{
+		s0: s0,
+		s1: s1,
+		bb: s0.BoundingBox().Extend(s1.BoundingBox()),
+	}
+}
+
+// Evaluate returns the minimum distance to a morphed SDF4.
+func (s *MorphSDF4) Evaluate(p V3, t float64) float64 {
+	t = Clamp(t, 0, 1)
+	switch t {
+	case 0:
+		return s.s0.Evaluate(p)
+	case 1:
+		return s.s1.Evaluate(p)
+	}
+	return Mix(s.s0.Evaluate(p), s.s1.Evaluate(p), t)
+}
+
+// BoundingBox returns the bounding box of a morphed SDF4.
+func (s *MorphSDF4) BoundingBox(t float64) Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+// Rigid motion of an SDF3.
+
+// MotionSDF4 is an SDF3 moving on a path.
+type MotionSDF4 struct {
+	sdf  SDF3
+	path func(t float64) M44
+}
+
+// Motion4D returns an SDF4 for an SDF3 moved by a time varying transform.
+func Motion4D(sdf SDF3, path func(t float64) M44) SDF4 {
+	return &MotionSDF4{sdf: sdf, path: path}
+}
+
+// Evaluate returns the minimum distance to a moving SDF4.
+func (s *MotionSDF4) Evaluate(p V3, t float64) float64 {
+	return s.sdf.Evaluate(s.path(t).Inverse().MulPosition(p))
+}
+
+// BoundingBox returns the bounding box of a moving SDF4.
+func (s *MotionSDF4) BoundingBox(t float64) Box3 {
+	return s.path(t).MulBox(s.sdf.BoundingBox())
+}
+
+// Frame returns the SDF3 for a moving SDF4 at time t.
+func (s *MotionSDF4) Frame(t float64) SDF3 {
+	return Transform3D(s.sdf, s.path(t))
+}
+
+//-----------------------------------------------------------------------------
+// Union of SDF4s.
+
+// UnionSDF4 is the union of SDF4s (e.g. the parts of a mechanism).
+type UnionSDF4 struct {
+	sdf []SDF4
+}
+
+// Union4D returns the union of SDF4s.
+func Union4D(sdf ...SDF4) SDF4 {
+	if len(sdf) == 0 {
+		return nil
+	}
+	return &UnionSDF4{sdf: sdf}
+}
+
+// Evaluate returns the minimum distance to a union of SDF4s.
+func (s *UnionSDF4) Evaluate(p V3, t float64) float64 {
+	d := s.sdf[0].Evaluate(p, t)
+	for _, x := range s.sdf[1:] {
+		d = Min(d, x.Evaluate(p, t))
+	}
+	return d
+}
+
+// BoundingBox returns the bounding box of a union of SDF4s.
+func (s *UnionSDF4) BoundingBox(t float64) Box3 {
+	bb := s.sdf[0].BoundingBox(t)
+	for _, x := range s.sdf[1:] {
+		bb = bb.Extend(x.BoundingBox(t))
+	}
+	return bb
+}
+
+// Frame returns the SDF3 for a union of SDF4s at time t.
+func (s *UnionSDF4) Frame(t float64) SDF3 {
+	frames := make([]SDF3, len(s.sdf))
+	for i, x := range s.sdf {
+		frames[i] = Frame4D(x, t)
+	}
+	return Union3D(frames...)
+}
+
+//-----------------------------------------------------------------------------
+// Frame Sequences
+
+// SequenceParms defines the parameters for a sequence of frames.
+type SequenceParms struct {
+	Start, End float64 // time range
+	Frames     int     // number of frames (the first is at Start, the last is at End)
+	MeshCells  int     // number of cells on the longest axis of the largest frame
+}
+
+// FrameTime returns the time of a frame.
+func (k *SequenceParms) FrameTime(i int) float64 {
+	if k.Frames <= 1 {
+		return k.Start
+	}
+	return k.Start + (k.End-k.Start)*float64(i)/float64(k.Frames-1)
+}
+
+// validate checks the sequence parameters.
+func (k *SequenceParms) validate() error {
+	if k.Frames < 1 {
+		return errors.New("frames < 1")
+	}
+	if k.MeshCells < 1 {
+		return errors.New("mesh cells < 1")
+	}
+	return nil
+}
+
+// GenerateSequence meshes a sequence of frames of an SDF4. The output
+// function is called with the frame number, time and mesh of each frame.
+func GenerateSequence(s SDF4, k *SequenceParms, output func(i int, t float64, mesh []*Triangle3) error) error {
+	if err := k.validate(); err != nil {
+		return err
+	}
+	frames := make([]SDF3, k.Frames)
+	size := 0.0
+	for i := range frames {
+		frames[i] = Frame4D(s, k.FrameTime(i))
+		size = Max(size, frames[i].BoundingBox().Size().MaxComponent())
+	}
+	// the same resolution for all frames
+	resolution := size / float64(k.MeshCells)
+	for i, f := range frames {
+		mesh, err := generateTriangles(context.Background(), f, resolution, nil)
+		if err != nil {
+			return err
+		}
+		if err := output(i, k.FrameTime(i), mesh); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RenderSequence meshes a sequence of frames of an SDF4 and writes them to
+// numbered files. The path is a format string for the frame number
+// (e.g. "frame_%04d.obj"), the file type (STL or OBJ) is set by the extension.
+func RenderSequence(s SDF4, k *SequenceParms, path string) error {
+	var save func(path string, mesh []*Triangle3) error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".stl":
+		save = SaveSTL
+	case ".obj":
+		save = SaveOBJ
+	default:
+		return fmt.Errorf("unknown mesh file type \"%s\"", filepath.Ext(path))
+	}
+	return GenerateSequence(s, k, func(i int, t float64, mesh []*Triangle3) error {
+		name := fmt.Sprintf(path, i)
+		fmt.Printf("rendering %s (t = %g, %d triangles)\n", name, t, len(mesh))
+		return save(name, mesh)
+	})
+}
+
+//-----------------------------------------------------------------------------
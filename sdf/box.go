@@ -130,6 +130,34 @@ func (a Box3) Vertices() V3Set {
 	return v
 }
 
+// Cut returns the bounding box of the part of a 3d bounding box on the
+// normal side of a plane (passing through p with normal n).
+// An empty box at p is returned if the box is completely cut away.
+func (a Box3) Cut(p, n V3) Box3 {
+	v := a.Vertices()
+	d := make([]float64, len(v))
+	for i := range v {
+		d[i] = v[i].Sub(p).Dot(n)
+	}
+	var kept V3Set
+	for i := range v {
+		if d[i] >= 0 {
+			kept = append(kept, v[i])
+		}
+		// add the points where the box edges cross the plane
+		for _, j := range []int{i ^ 1, i ^ 2, i ^ 4} {
+			if j > i && (d[i] < 0) != (d[j] < 0) {
+				t := d[i] / (d[i] - d[j])
+				kept = append(kept, v[i].Add(v[j].Sub(v[i]).MulScalar(t)))
+			}
+		}
+	}
+	if len(kept) == 0 {
+		return Box3{p, p}
+	}
+	return Box3{kept.Min(), kept.Max()}
+}
+
 // BottomLeft returns the bottom left corner of a 2d bounding box.
 func (a Box2) BottomLeft() V2 {
 	return a.Min
@@ -0,0 +1,164 @@
+//-----------------------------------------------------------------------------
+/*
+
+Bounding Volume Hierarchy
+
+A union of many SDF3s (e.g. the holes in a perfboard) evaluates every SDF3
+at every point. A bounding volume hierarchy (a binary tree of bounding boxes)
+over the SDF3s lets the evaluation skip the SDF3s with bounding boxes
+further from the point than the nearest distance found so far. The distance
+to a bounding box is a lower bound on the distance to the SDF3 within it,
+so for SDF3s with exact distances the result is the same as Union3D.
+
+The union is a plain minimum, it can't be blended (see Union3D/SetMin).
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"math"
+	"sort"
+)
+
+//-----------------------------------------------------------------------------
+
+// bvhLeafSize is the maximum number of SDF3s in a leaf node.
+const bvhLeafSize = 4
+
+// bvhNode is a node of a bounding volume hierarchy.
+type bvhNode struct {
+	bb          Box3
+	left, right int    // child node indices (internal nodes)
+	sdf         []SDF3 // leaf node SDF3s
+}
+
+// bvhItem is an SDF3 being sorted into a bounding volume hierarchy.
+type bvhItem struct {
+	sdf    SDF3
+	bb     Box3
+	center V3
+}
+
+// BVHUnionSDF3 is a union of SDF3s accelerated with a bounding volume hierarchy.
+type BVHUnionSDF3 struct {
+	nodes []bvhNode // nodes[0] is the root
+}
+
+// BVHUnion3D returns the union of multiple SDF3s, using a bounding volume
+// hierarchy so only the SDF3s near a point are evaluated.
+func BVHUnion3D(sdf ...SDF3) SDF3 {
+	items := make([]bvhItem, 0, len(sdf))
+	for _, x := range sdf {
+		if x != nil {
+			bb := x.BoundingBox()
+			items = append(items, bvhItem{x, bb, bb.Center()})
+		}
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	if len(items) == 1 {
+		// only one sdf - not really a union
+		return items[0].sdf
+	}
+	s := BVHUnionSDF3{}
+	s.build(items)
+	return &s
+}
+
+// BVHDifference3D returns the difference of an SDF3 and the union of
+// multiple SDF3s, s0 - (s1 + s2 + ...), see BVHUnion3D.
+func BVHDifference3D(s0 SDF3, sdf ...SDF3) SDF3 {
+	s1 := BVHUnion3D(sdf...)
+	if s1 == nil {
+		return s0
+	}
+	return Difference3D(s0, s1)
+}
+
+// build adds the nodes for a set of SDF3s and returns the index of the subtree root.
+func (s *BVHUnionSDF3) build(items []bvhItem) int {
+	bb := items[0].bb
+	for _, x := range items {
+		bb = bb.Extend(x.bb)
+	}
+	i := len(s.nodes)
+	s.nodes = append(s.nodes, bvhNode{bb: bb})
+	if len(items) <= bvhLeafSize {
+		leaf := make([]SDF3, len(items))
+		for j, x := range items {
+			leaf[j] = x.sdf
+		}
+		s.nodes[i].sdf = leaf
+		return i
+	}
+	// split at the median of the centers on the longest axis of their bounding box
+	cb := Box3{items[0].center, items[0].center}
+	for _, x := range items {
+		cb = cb.Extend(Box3{x.center, x.center})
+	}
+	size := cb.Size()
+	axis := func(v V3) float64 { return v.X }
+	if size.Y > size.X && size.Y >= size.Z {
+		axis = func(v V3) float64 { return v.Y }
+	} else if size.Z > size.X && size.Z > size.Y {
+		axis = func(v V3) float64 { return v.Z }
+	}
+	sort.Slice(items, func(a, b int) bool { return axis(items[a].center) < axis(items[b].center) })
+	mid := len(items) / 2
+	left := s.build(items[:mid])
+	right := s.build(items[mid:])
+	s.nodes[i].left = left
+	s.nodes[i].right = right
+	return i
+}
+
+// boxDist2 returns the squared distance from a point to a box (0 within the box).
+func boxDist2(b Box3, p V3) float64 {
+	d := b.Min.Sub(p).Max(p.Sub(b.Max)).Max(V3{})
+	return d.Length2()
+}
+
+// search finds the minimum distance to the SDF3s within a subtree.
+func (s *BVHUnionSDF3) search(i int, p V3, d float64) float64 {
+	n := &s.nodes[i]
+	if n.sdf != nil {
+		for _, x := range n.sdf {
+			d = Min(d, x.Evaluate(p))
+		}
+		return d
+	}
+	// search the nearer subtree first
+	a, b := n.left, n.right
+	da, db := boxDist2(s.nodes[a].bb, p), boxDist2(s.nodes[b].bb, p)
+	if db < da {
+		a, b = b, a
+		da, db = db, da
+	}
+	if !bvhSkip(da, d) {
+		d = s.search(a, p, d)
+	}
+	if !bvhSkip(db, d) {
+		d = s.search(b, p, d)
+	}
+	return d
+}
+
+// bvhSkip returns true if a box at a squared distance can't contain anything nearer than d.
+func bvhSkip(dist2, d float64) bool {
+	return dist2 > 0 && (d <= 0 || dist2 >= d*d)
+}
+
+// Evaluate returns the minimum distance to a BVH union.
+func (s *BVHUnionSDF3) Evaluate(p V3) float64 {
+	return s.search(0, p, math.MaxFloat64)
+}
+
+// BoundingBox returns the bounding box of a BVH union.
+func (s *BVHUnionSDF3) BoundingBox() Box3 {
+	return s.nodes[0].bb
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,129 @@
+//-----------------------------------------------------------------------------
+/*
+
+Evaluation Cache
+
+Deep CSG trees are expensive to evaluate, and the renderers evaluate the
+same points many times (e.g. the shared corners of neighbouring cubes).
+Cache3D wraps an SDF3 with a least recently used cache of distances.
+
+The points are quantized to a grid of the given resolution and the SDF3
+is evaluated at the grid point. The distance error is at most the half
+diagonal of a grid cube (resolution * sqrt(3)/2), so the resolution should
+be small compared to the mesh cell size. Ideally the mesh grid points are
+also cache grid points (e.g. resolution = mesh cell size / n).
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"container/list"
+	"math"
+	"sync"
+)
+
+//-----------------------------------------------------------------------------
+
+// cacheEntries is the maximum number of cached distances.
+const cacheEntries = 1 << 20
+
+// cacheEntry is a cached distance.
+type cacheEntry struct {
+	key  V3i
+	dist float64
+}
+
+// CacheSDF3 is an SDF3 with an evaluation cache.
+type CacheSDF3 struct {
+	sdf        SDF3
+	resolution float64
+	size       int                   // maximum number of entries
+	lock       sync.Mutex            // lock the cache during reads/writes
+	entries    map[V3i]*list.Element // cache of distances
+	lru        *list.List            // entries, most recently used first
+	hits       uint64
+	misses     uint64
+}
+
+// Cache3D returns an SDF3 that caches the evaluations of another SDF3.
+// Points are quantized to a grid with the given resolution.
+func Cache3D(sdf SDF3, resolution float64) SDF3 {
+	return newCacheSDF3(sdf, resolution, cacheEntries)
+}
+
+// newCacheSDF3 returns a cached SDF3 with a maximum number of entries.
+func newCacheSDF3(sdf SDF3, resolution float64, size int) *CacheSDF3 {
+	if resolution <= 0 {
+		panic("resolution <= 0")
+	}
+	if size <= 0 {
+		panic("size <= 0")
+	}
+	return &CacheSDF3{
+		sdf:        sdf,
+		resolution: resolution,
+		size:       size,
+		entries:    make(map[V3i]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// read from the cache
+func (s *CacheSDF3) read(key V3i) (float64, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if e, found := s.entries[key]; found {
+		s.hits++
+		s.lru.MoveToFront(e)
+		return e.Value.(*cacheEntry).dist, true
+	}
+	s.misses++
+	return 0, false
+}
+
+// write to the cache
+func (s *CacheSDF3) write(key V3i, dist float64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if e, found := s.entries[key]; found {
+		// another goroutine evaluated the same point
+		s.lru.MoveToFront(e)
+		return
+	}
+	if s.lru.Len() >= s.size {
+		// evict the least recently used entry
+		e := s.lru.Back()
+		s.lru.Remove(e)
+		delete(s.entries, e.Value.(*cacheEntry).key)
+	}
+	s.entries[key] = s.lru.PushFront(&cacheEntry{key, dist})
+}
+
+// Evaluate returns the minimum distance to the cached SDF3.
+func (s *CacheSDF3) Evaluate(p V3) float64 {
+	q := p.DivScalar(s.resolution)
+	key := V3i{int(math.Round(q.X)), int(math.Round(q.Y)), int(math.Round(q.Z))}
+	if dist, found := s.read(key); found {
+		return dist
+	}
+	// evaluate outside the lock so other goroutines can use the cache
+	dist := s.sdf.Evaluate(key.ToV3().MulScalar(s.resolution))
+	s.write(key, dist)
+	return dist
+}
+
+// BoundingBox returns the bounding box of the cached SDF3.
+func (s *CacheSDF3) BoundingBox() Box3 {
+	return s.sdf.BoundingBox()
+}
+
+// Stats returns the number of cache hits and misses.
+func (s *CacheSDF3) Stats() (hits, misses uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.hits, s.misses
+}
+
+//-----------------------------------------------------------------------------
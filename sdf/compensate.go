@@ -0,0 +1,253 @@
+//-----------------------------------------------------------------------------
+/*
+
+Shrinkage and Warp Compensation
+
+Printed parts shrink as they cool, and by different amounts on each axis
+(the layers shrink more in x/y than the stack of layers does in z). Parts
+can also warp in a repeatable way. Compensation pre-distorts the model so
+the printed part hits the target dimensions.
+
+The printed position of a model point p is modelled as:
+
+	printed(p) = origin + (p - origin) * (1 - shrink) + warp(p)
+
+The compensated SDF3 is the target SDF3 evaluated at printed(p), so the
+printed compensated model is the target model. The shrinkage is a fraction
+for each axis (e.g. 0.007 == 0.7%) and the warp is a displacement field
+measured from a printed part (e.g. by probing a calibration print).
+
+The material profiles are typical values. Calibrate them for a particular
+printer, filament and part orientation.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//-----------------------------------------------------------------------------
+// Material Profiles
+
+// Material is the shrinkage profile of a print material.
+type Material struct {
+	Name   string
+	Shrink V3 // linear shrinkage on each axis (fraction)
+}
+
+var materials = []Material{
+	{"PLA", V3{0.002, 0.002, 0.001}},
+	{"PETG", V3{0.004, 0.004, 0.002}},
+	{"ASA", V3{0.005, 0.005, 0.003}},
+	{"ABS", V3{0.007, 0.007, 0.004}},
+	{"PC", V3{0.007, 0.007, 0.005}},
+	{"Nylon", V3{0.015, 0.015, 0.008}},
+}
+
+// LookupMaterial returns the shrinkage profile of a named material (case insensitive).
+func LookupMaterial(name string) (*Material, error) {
+	for i := range materials {
+		if strings.EqualFold(materials[i].Name, name) {
+			m := materials[i]
+			return &m, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown material \"%s\" (%s)", name, strings.Join(MaterialNames(), ", "))
+}
+
+// MaterialNames returns the names of the material profiles.
+func MaterialNames() []string {
+	names := make([]string, len(materials))
+	for i := range materials {
+		names[i] = materials[i].Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+//-----------------------------------------------------------------------------
+// Warp Field
+
+// WarpField is the measured warp (displacement) of a printed part sampled on
+// a regular grid. It is interpolated between the grid points and clamped to
+// the grid boundary.
+type WarpField struct {
+	Box  Box3 // the grid spans the box
+	Size V3i  // number of grid points on each axis (>= 2)
+	Data []V3 // displacement at each grid point (x varies fastest, then y, then z)
+}
+
+// validate checks the warp field parameters.
+func (w *WarpField) validate() error {
+	for i := range w.Size {
+		if w.Size[i] < 2 {
+			return errors.New("warp field needs >= 2 grid points on each axis")
+		}
+	}
+	size := w.Box.Size()
+	if size.X <= 0 || size.Y <= 0 || size.Z <= 0 {
+		return errors.New("warp field box is empty")
+	}
+	if len(w.Data) != w.Size[0]*w.Size[1]*w.Size[2] {
+		return fmt.Errorf("warp field has %d samples, expected %d", len(w.Data), w.Size[0]*w.Size[1]*w.Size[2])
+	}
+	return nil
+}
+
+// sample returns the displacement at a grid point.
+func (w *WarpField) sample(x, y, z int) V3 {
+	return w.Data[(z*w.Size[1]+y)*w.Size[0]+x]
+}
+
+// inc returns the grid spacing.
+func (w *WarpField) inc() V3 {
+	return w.Box.Size().Div(w.Size.SubScalar(1).ToV3())
+}
+
+// Displacement returns the interpolated warp at a point.
+func (w *WarpField) Displacement(p V3) V3 {
+	q := p.Clamp(w.Box.Min, w.Box.Max)
+	inc := w.inc()
+	steps := w.Size.SubScalar(1)
+	return V3{
+		gridEvaluate(q, w.Box, inc, steps, func(x, y, z int) float64 { return w.sample(x, y, z).X }),
+		gridEvaluate(q, w.Box, inc, steps, func(x, y, z int) float64 { return w.sample(x, y, z).Y }),
+		gridEvaluate(q, w.Box, inc, steps, func(x, y, z int) float64 { return w.sample(x, y, z).Z }),
+	}
+}
+
+// maxDisplacement returns the largest warp displacement.
+func (w *WarpField) maxDisplacement() float64 {
+	d := 0.0
+	for _, v := range w.Data {
+		d = Max(d, v.Length())
+	}
+	return d
+}
+
+// lipschitz returns an upper bound on the rate of change of the warp.
+// Each column of the jacobian is bounded by the largest difference
+// between neighbouring grid points along that axis.
+func (w *WarpField) lipschitz() float64 {
+	inc := w.inc()
+	var g V3
+	for z := 0; z < w.Size[2]; z++ {
+		for y := 0; y < w.Size[1]; y++ {
+			for x := 0; x < w.Size[0]; x++ {
+				d := w.sample(x, y, z)
+				if x+1 < w.Size[0] {
+					g.X = Max(g.X, w.sample(x+1, y, z).Sub(d).Length()/inc.X)
+				}
+				if y+1 < w.Size[1] {
+					g.Y = Max(g.Y, w.sample(x, y+1, z).Sub(d).Length()/inc.Y)
+				}
+				if z+1 < w.Size[2] {
+					g.Z = Max(g.Z, w.sample(x, y, z+1).Sub(d).Length()/inc.Z)
+				}
+			}
+		}
+	}
+	return g.Length()
+}
+
+//-----------------------------------------------------------------------------
+// Compensation
+
+// CompensationParms defines the parameters for shrinkage/warp compensation.
+type CompensationParms struct {
+	Shrink V3         // linear shrinkage on each axis (fraction)
+	Origin V3         // the part shrinks towards this point (e.g. the center of the part on the bed)
+	Warp   *WarpField // measured warp of the printed part (optional)
+}
+
+// CompensateSDF3 is an SDF3 pre-distorted to compensate for shrinkage and warp.
+type CompensateSDF3 struct {
+	sdf    SDF3
+	scale  V3 // 1 - shrink
+	origin V3
+	warp   *WarpField
+	k      float64 // inverse lipschitz bound of the printed position
+	bb     Box3
+}
+
+// Compensate3D returns an SDF3 that prints as the given SDF3 with the given
+// shrinkage and warp. The distance is not exact, it is a conservative (lower)
+// bound on the real distance.
+func Compensate3D(sdf SDF3, k *CompensationParms) (SDF3, error) {
+	if k.Shrink.X < 0 || k.Shrink.Y < 0 || k.Shrink.Z < 0 {
+		return nil, errors.New("shrink < 0")
+	}
+	if k.Shrink.X >= 1 || k.Shrink.Y >= 1 || k.Shrink.Z >= 1 {
+		return nil, errors.New("shrink >= 1")
+	}
+	s := CompensateSDF3{
+		sdf:    sdf,
+		scale:  V3{1, 1, 1}.Sub(k.Shrink),
+		origin: k.Origin,
+	}
+	lipschitz := s.scale.MaxComponent()
+	warp := 0.0
+	if k.Warp != nil {
+		if err := k.Warp.validate(); err != nil {
+			return nil, err
+		}
+		s.warp = k.Warp
+		lipschitz += k.Warp.lipschitz()
+		warp = k.Warp.maxDisplacement()
+	}
+	s.k = 1 / lipschitz
+	// scale the bounding box up about the origin, allow for the warp
+	bb := sdf.BoundingBox()
+	bb = Box3{
+		bb.Min.Sub(s.origin).Div(s.scale).Add(s.origin),
+		bb.Max.Sub(s.origin).Div(s.scale).Add(s.origin),
+	}
+	margin := warp / s.scale.MinComponent()
+	s.bb = Box3{bb.Min.SubScalar(margin), bb.Max.AddScalar(margin)}
+	return &s, nil
+}
+
+// printed returns the printed position of a model point.
+func (s *CompensateSDF3) printed(p V3) V3 {
+	q := p.Sub(s.origin).Mul(s.scale).Add(s.origin)
+	if s.warp != nil {
+		q = q.Add(s.warp.Displacement(p))
+	}
+	return q
+}
+
+// Evaluate returns a lower bound on the minimum distance to a compensated SDF3.
+func (s *CompensateSDF3) Evaluate(p V3) float64 {
+	return s.sdf.Evaluate(s.printed(p)) * s.k
+}
+
+// Exact returns false, the distance for a compensated SDF3 is only a bound.
+func (s *CompensateSDF3) Exact() bool {
+	return false
+}
+
+// BoundingBox returns the bounding box of a compensated SDF3.
+func (s *CompensateSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+// MaterialCompensate3D compensates an SDF3 for the shrinkage of a named material.
+// The part shrinks towards the center of the bottom of its bounding box.
+func MaterialCompensate3D(sdf SDF3, material string) (SDF3, error) {
+	m, err := LookupMaterial(material)
+	if err != nil {
+		return nil, err
+	}
+	bb := sdf.BoundingBox()
+	origin := bb.Center()
+	origin.Z = bb.Min.Z
+	return Compensate3D(sdf, &CompensationParms{Shrink: m.Shrink, Origin: origin})
+}
+
+//-----------------------------------------------------------------------------
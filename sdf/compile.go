@@ -0,0 +1,380 @@
+//-----------------------------------------------------------------------------
+/*
+
+SDF3 Compiler
+
+Evaluating an SDF3 walks the CSG tree with an interface call for each node.
+For large trees the call overhead is a large part of the evaluation time.
+
+Compile3D flattens the tree into a list of instructions for a small stack
+machine. The machine has a stack of distances and a stack of points (for
+the transformed positions), both of fixed size, so an evaluation makes no
+interface calls and no allocations. The primitive distance instructions
+include the point transform and the min/max with the stack, so e.g. a union
+of transformed primitives is one instruction per primitive.
+
+Boxes, spheres, cylinders, transforms, uniform scaling, offsets, tags,
+unions, differences and intersections are compiled. Any other SDF3 is
+evaluated with a call instruction (its own Evaluate), so all SDF3s can be
+compiled and the compiled SDF3 gives the same distances as the tree.
+
+Go interface calls are cheap when each call site always calls the same
+type (as in most trees), and the switch dispatch of an instruction costs
+more. So an SDF3 is only compiled if the instructions are expected to be
+faster, e.g. a union of many translated primitives. The meshers compile the
+SDF3 before sampling it.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+//-----------------------------------------------------------------------------
+
+// vmStackSize is the size of the distance and point stacks.
+const vmStackSize = 16
+
+// vmOp is a stack machine operation.
+type vmOp uint8
+
+const (
+	opBox        vmOp = iota // distance to a box
+	opSphere                 // distance to a sphere
+	opCylinder               // distance to a cylinder
+	opCall                   // distance to an SDF3
+	opTransform              // push the transformed point
+	opTranslate              // push the translated point
+	opScale                  // push the scaled point
+	opPopPoint               // pop a point
+	opMul                    // multiply the distance by a constant
+	opSub                    // subtract a constant from the distance
+	opMin                    // pop 2 distances, push min(d0, d1)
+	opMax                    // pop 2 distances, push max(d0, d1)
+	opMaxNeg                 // pop 2 distances, push max(d0, -d1)
+	opMinFunc                // pop 2 distances, push min(d0, d1) (blended)
+	opMaxFunc                // pop 2 distances, push max(d0, d1) (blended)
+	opMaxNegFunc             // pop 2 distances, push max(d0, -d1) (blended)
+)
+
+// vmPoint is the point a distance instruction is evaluated at.
+type vmPoint uint8
+
+const (
+	ptCurrent   vmPoint = iota // the current point
+	ptTranslate                // the translated current point
+	ptTransform                // the transformed current point
+)
+
+// vmAcc is how a distance instruction combines the distance with the stack.
+type vmAcc uint8
+
+const (
+	accPush   vmAcc = iota // push the distance
+	accMin                 // replace the top distance with min(top, d)
+	accMax                 // replace the top distance with max(top, d)
+	accMaxNeg              // replace the top distance with max(top, -d)
+)
+
+// vmInstruction is an instruction for the stack machine. The operands are
+// in the constant tables of the program. The distance instructions include
+// a point transform and an accumulation, so a union of transformed
+// primitives is one instruction per primitive.
+type vmInstruction struct {
+	op  vmOp
+	pt  vmPoint // point for a distance instruction
+	acc vmAcc   // accumulation for a distance instruction
+	i   int32   // constant table index
+	j   int32   // point transform table index
+}
+
+// vmProgram is a compiled SDF3.
+type vmProgram struct {
+	code []vmInstruction
+	k    []float64 // scalar constants
+	v    []V3      // vector constants
+	m    []M44     // transforms
+	s    []SDF3    // SDF3s for calls
+	min  []MinFunc // blended union min functions
+	max  []MaxFunc // blended difference/intersection max functions
+}
+
+// vmCompiler compiles an SDF3 tree to stack machine instructions.
+type vmCompiler struct {
+	vmProgram
+	d, p   int // distance and point stack depths
+	dm, pm int // maximum stack depths
+	nodes  int // number of SDF3 tree nodes
+}
+
+// emit adds an instruction and tracks the stack depths.
+func (c *vmCompiler) emit(in vmInstruction, dd, dp int) {
+	c.code = append(c.code, in)
+	c.d += dd
+	c.p += dp
+	if c.d > c.dm {
+		c.dm = c.d
+	}
+	if c.p > c.pm {
+		c.pm = c.p
+	}
+}
+
+// scalar adds scalar constants and returns the index of the first.
+func (c *vmCompiler) scalar(k ...float64) int32 {
+	c.k = append(c.k, k...)
+	return int32(len(c.k) - len(k))
+}
+
+// vector adds a vector constant and returns its index.
+func (c *vmCompiler) vector(v V3) int32 {
+	c.v = append(c.v, v)
+	return int32(len(c.v) - 1)
+}
+
+// accumulate combines the top two distances. A distance instruction that
+// pushed the top distance does the accumulation itself.
+func (c *vmCompiler) accumulate(acc vmAcc, start int) {
+	if last := &c.code[len(c.code)-1]; len(c.code) == start+1 && last.op <= opCall {
+		last.acc = acc
+		c.d--
+		return
+	}
+	c.emit(vmInstruction{op: [...]vmOp{accMin: opMin, accMax: opMax, accMaxNeg: opMaxNeg}[acc]}, -1, 0)
+}
+
+// compileMax adds the instructions for a difference or intersection.
+func (c *vmCompiler) compileMax(s0, s1 SDF3, max MaxFunc, acc vmAcc, op vmOp) {
+	c.compile(s0)
+	start := len(c.code)
+	c.compile(s1)
+	if sameFunc(max, Max) {
+		c.accumulate(acc, start)
+	} else {
+		c.max = append(c.max, max)
+		c.emit(vmInstruction{op: op, i: int32(len(c.max) - 1)}, -1, 0)
+	}
+}
+
+// vmLeaf returns true if an SDF3 compiles to a single distance instruction.
+func vmLeaf(s SDF3) bool {
+	switch s.(type) {
+	case *TransformSDF3, *ScaleUniformSDF3, *OffsetSDF3, *TagSDF3, *AnchorSDF3,
+		*UnionSDF3, *DifferenceSDF3, *IntersectionSDF3:
+		return false
+	}
+	return true
+}
+
+// compile adds the instructions to evaluate an SDF3.
+func (c *vmCompiler) compile(s SDF3) {
+	c.nodes++
+	switch s := s.(type) {
+	case *BoxSDF3:
+		c.emit(vmInstruction{op: opBox, i: c.scalar(s.size.X, s.size.Y, s.size.Z, s.round)}, 1, 0)
+	case *SphereSDF3:
+		c.emit(vmInstruction{op: opSphere, i: c.scalar(s.radius)}, 1, 0)
+	case *CylinderSDF3:
+		c.emit(vmInstruction{op: opCylinder, i: c.scalar(s.radius, s.height, s.round)}, 1, 0)
+	case *TransformSDF3:
+		m := s.inverse
+		in := vmInstruction{op: opTransform, pt: ptTransform}
+		if m.x00 == 1 && m.x01 == 0 && m.x02 == 0 &&
+			m.x10 == 0 && m.x11 == 1 && m.x12 == 0 &&
+			m.x20 == 0 && m.x21 == 0 && m.x22 == 1 {
+			in.op, in.pt, in.j = opTranslate, ptTranslate, c.vector(V3{m.x03, m.x13, m.x23})
+		} else {
+			c.m = append(c.m, m)
+			in.j = int32(len(c.m) - 1)
+		}
+		if vmLeaf(s.sdf) {
+			// evaluate the distance instruction at the transformed point
+			c.compile(s.sdf)
+			last := &c.code[len(c.code)-1]
+			last.pt, last.j = in.pt, in.j
+		} else {
+			c.emit(in, 0, 1)
+			c.compile(s.sdf)
+			c.emit(vmInstruction{op: opPopPoint}, 0, -1)
+		}
+		if s.k != 1 {
+			c.emit(vmInstruction{op: opMul, i: c.scalar(s.k)}, 0, 0)
+		}
+	case *ScaleUniformSDF3:
+		c.emit(vmInstruction{op: opScale, i: c.scalar(s.invK)}, 0, 1)
+		c.compile(s.sdf)
+		c.emit(vmInstruction{op: opPopPoint}, 0, -1)
+		c.emit(vmInstruction{op: opMul, i: c.scalar(s.k)}, 0, 0)
+	case *OffsetSDF3:
+		c.compile(s.sdf)
+		c.emit(vmInstruction{op: opSub, i: c.scalar(s.offset)}, 0, 0)
+	case *TagSDF3:
+		c.compile(s.sdf)
+	case *AnchorSDF3:
+		c.compile(s.sdf)
+	case *UnionSDF3:
+		for i, x := range s.sdf {
+			start := len(c.code)
+			c.compile(x)
+			if i == 0 {
+				continue
+			}
+			if sameFunc(s.min, Min) {
+				c.accumulate(accMin, start)
+			} else {
+				c.min = append(c.min, s.min)
+				c.emit(vmInstruction{op: opMinFunc, i: int32(len(c.min) - 1)}, -1, 0)
+			}
+		}
+	case *DifferenceSDF3:
+		c.compileMax(s.s0, s.s1, s.max, accMaxNeg, opMaxNegFunc)
+	case *IntersectionSDF3:
+		c.compileMax(s.s0, s.s1, s.max, accMax, opMaxFunc)
+	default:
+		c.s = append(c.s, s)
+		c.emit(vmInstruction{op: opCall, i: int32(len(c.s) - 1)}, 1, 0)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// CompiledSDF3 is an SDF3 compiled to stack machine instructions.
+type CompiledSDF3 struct {
+	sdf SDF3
+	vmProgram
+}
+
+// vmCompile compiles an SDF3. It returns nil if the tree is too deep for
+// the stacks, and whether the compiled SDF3 is expected to be faster.
+func vmCompile(s SDF3) (*CompiledSDF3, bool) {
+	c := vmCompiler{}
+	c.compile(s)
+	if c.dm > vmStackSize || c.pm > vmStackSize {
+		return nil, false
+	}
+	// An instruction dispatch costs about as much as 2 interface calls, so
+	// the compiled SDF3 is faster if there are less than half the instructions
+	// as there are tree nodes. The instructions also inline the default min/max
+	// functions and translations.
+	return &CompiledSDF3{sdf: s, vmProgram: c.vmProgram}, 2*len(c.code) <= c.nodes
+}
+
+// Compile3D compiles an SDF3 for faster evaluation. The SDF3 is returned
+// unchanged if the compiled SDF3 isn't expected to be faster.
+func Compile3D(s SDF3) SDF3 {
+	if _, ok := s.(*CompiledSDF3); ok {
+		return s
+	}
+	if c, ok := vmCompile(s); ok {
+		return c
+	}
+	return s
+}
+
+// Evaluate returns the minimum distance to a compiled SDF3.
+func (s *CompiledSDF3) Evaluate(p V3) float64 {
+	// the top of the distance stack (d) and the current point (q) are kept
+	// out of the stacks
+	var ds [vmStackSize]float64
+	var ps [vmStackSize]V3
+	var d float64
+	q := p
+	n, j := 0, 0
+	for _, in := range s.code {
+		if in.op <= opCall {
+			// distance instruction
+			x := q
+			switch in.pt {
+			case ptTranslate:
+				x = q.Add(s.v[in.j])
+			case ptTransform:
+				x = s.m[in.j].MulPosition(q)
+			}
+			var dist float64
+			switch in.op {
+			case opBox:
+				k := s.k[in.i : in.i+4]
+				dist = sdfBox3d(x, V3{k[0], k[1], k[2]}) - k[3]
+			case opSphere:
+				dist = x.Length() - s.k[in.i]
+			case opCylinder:
+				k := s.k[in.i : in.i+3]
+				dist = sdfBox2d(V2{V2{x.X, x.Y}.Length(), x.Z}, V2{k[0], k[1]}) - k[2]
+			default:
+				dist = s.s[in.i].Evaluate(x)
+			}
+			switch in.acc {
+			case accPush:
+				ds[n] = d
+				n++
+				d = dist
+			case accMin:
+				d = Min(d, dist)
+			case accMax:
+				d = Max(d, dist)
+			case accMaxNeg:
+				d = Max(d, -dist)
+			}
+			continue
+		}
+		switch in.op {
+		case opTransform:
+			ps[j] = q
+			j++
+			q = s.m[in.j].MulPosition(q)
+		case opTranslate:
+			ps[j] = q
+			j++
+			q = q.Add(s.v[in.j])
+		case opScale:
+			ps[j] = q
+			j++
+			q = q.MulScalar(s.k[in.i])
+		case opPopPoint:
+			j--
+			q = ps[j]
+		case opMul:
+			d *= s.k[in.i]
+		case opSub:
+			d -= s.k[in.i]
+		case opMin:
+			n--
+			d = Min(ds[n], d)
+		case opMax:
+			n--
+			d = Max(ds[n], d)
+		case opMaxNeg:
+			n--
+			d = Max(ds[n], -d)
+		case opMinFunc:
+			n--
+			d = s.min[in.i](ds[n], d)
+		case opMaxFunc:
+			n--
+			d = s.max[in.i](ds[n], d)
+		case opMaxNegFunc:
+			n--
+			d = s.max[in.i](ds[n], -d)
+		}
+	}
+	return d
+}
+
+// EvaluateN returns the minimum distance to a compiled SDF3 for each point.
+func (s *CompiledSDF3) EvaluateN(p []V3, out []float64) {
+	out = out[:len(p)]
+	for i, x := range p {
+		out[i] = s.Evaluate(x)
+	}
+}
+
+// BoundingBox returns the bounding box of a compiled SDF3.
+func (s *CompiledSDF3) BoundingBox() Box3 {
+	return s.sdf.BoundingBox()
+}
+
+// Tag returns the tag of a compiled SDF3.
+func (s *CompiledSDF3) Tag(p V3) int {
+	return TagAt(s.sdf, p)
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,294 @@
+//-----------------------------------------------------------------------------
+/*
+
+Connected Components
+
+Find the disconnected solid regions of an SDF3.
+
+The SDF3 is sampled on a coarse voxel grid. A voxel is solid if a point
+within it is inside the SDF3. Voxels where the surface may pass near the
+voxel center are subdivided to find small or thin parts. The solid voxels
+are then flood filled (6-connected) to give the components.
+
+Solid regions closer together than the voxel size may be merged.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"fmt"
+	"math"
+)
+
+//-----------------------------------------------------------------------------
+
+// refineLevels is the number of voxel subdivisions used to find thin parts.
+const refineLevels = 2
+
+// Component3 is a connected solid region of an SDF3.
+type Component3 struct {
+	Surface     V3      // a point on the surface of the component
+	Voxels      int     // number of voxels in the component
+	Volume      float64 // approximate volume of the component
+	BoundingBox Box3    // approximate bounding box of the component
+}
+
+// voxelGrid is a coarse grid of solid/empty voxels for an SDF3.
+type voxelGrid struct {
+	s      SDF3
+	base   V3     // center of voxel 0,0,0
+	inc    V3     // voxel size
+	steps  V3i    // number of x,y,z voxels
+	solid  []bool // is the voxel solid?
+	inside []V3   // a point inside each solid voxel
+	label  []int  // component label for each voxel (-1 == empty)
+}
+
+func newVoxelGrid(s SDF3, meshCells int) *voxelGrid {
+	bb := s.BoundingBox()
+	inc := bb.Size().MaxComponent() / float64(meshCells)
+	// pad the grid so the outer voxels are empty
+	size := bb.Size().AddScalar(2 * inc)
+	g := voxelGrid{}
+	g.s = s
+	g.steps = size.DivScalar(inc).Ceil().ToV3i()
+	g.inc = size.Div(g.steps.ToV3())
+	g.base = bb.Min.SubScalar(inc).Add(g.inc.MulScalar(0.5))
+	n := g.steps[0] * g.steps[1] * g.steps[2]
+	g.solid = make([]bool, n)
+	g.inside = make([]V3, n)
+	g.label = make([]int, n)
+	return &g
+}
+
+// index returns the voxel index for x,y,z voxel coordinates.
+func (g *voxelGrid) index(v V3i) int {
+	return (v[0]*g.steps[1]+v[1])*g.steps[2] + v[2]
+}
+
+// contains returns true if the x,y,z voxel coordinates are within the grid.
+func (g *voxelGrid) contains(v V3i) bool {
+	return v[0] >= 0 && v[1] >= 0 && v[2] >= 0 && v[0] < g.steps[0] && v[1] < g.steps[1] && v[2] < g.steps[2]
+}
+
+// center returns the center of a voxel.
+func (g *voxelGrid) center(v V3i) V3 {
+	return g.base.Add(v.ToV3().Mul(g.inc))
+}
+
+// findInside looks for a point inside the SDF3 within a box (center, half size).
+func (g *voxelGrid) findInside(c, h V3, level int) (V3, bool) {
+	d := g.s.Evaluate(c)
+	if d < 0 {
+		return c, true
+	}
+	if d >= h.Length() || level == 0 {
+		return V3{}, false
+	}
+	h = h.MulScalar(0.5)
+	for i := 0; i < 8; i++ {
+		ofs := V3{h.X, h.Y, h.Z}
+		if i&1 == 0 {
+			ofs.X = -ofs.X
+		}
+		if i&2 == 0 {
+			ofs.Y = -ofs.Y
+		}
+		if i&4 == 0 {
+			ofs.Z = -ofs.Z
+		}
+		if p, ok := g.findInside(c.Add(ofs), h, level-1); ok {
+			return p, true
+		}
+	}
+	return V3{}, false
+}
+
+// scan finds the solid voxels.
+func (g *voxelGrid) scan() {
+	h := g.inc.MulScalar(0.5)
+	var v V3i
+	for v[0] = 0; v[0] < g.steps[0]; v[0]++ {
+		for v[1] = 0; v[1] < g.steps[1]; v[1]++ {
+			for v[2] = 0; v[2] < g.steps[2]; v[2]++ {
+				i := g.index(v)
+				g.inside[i], g.solid[i] = g.findInside(g.center(v), h, refineLevels)
+			}
+		}
+	}
+}
+
+// neighbours are the offsets to the 6-connected neighbours of a voxel.
+var neighbours = [6]V3i{{-1, 0, 0}, {1, 0, 0}, {0, -1, 0}, {0, 1, 0}, {0, 0, -1}, {0, 0, 1}}
+
+// fill labels the connected solid voxels starting from v.
+// It returns the component and a boundary voxel/empty neighbour pair.
+func (g *voxelGrid) fill(v V3i, label int) (Component3, V3i, V3i) {
+	var c Component3
+	var vi, vo V3i
+	cmin, cmax := g.center(v), g.center(v)
+	g.label[g.index(v)] = label
+	stack := []V3i{v}
+	for len(stack) > 0 {
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		c.Voxels++
+		cmin, cmax = cmin.Min(g.center(v)), cmax.Max(g.center(v))
+		for _, dv := range neighbours {
+			u := v.Add(dv)
+			if !g.contains(u) {
+				continue
+			}
+			i := g.index(u)
+			if !g.solid[i] {
+				vi, vo = v, u
+				continue
+			}
+			if g.label[i] < 0 {
+				g.label[i] = label
+				stack = append(stack, u)
+			}
+		}
+	}
+	h := g.inc.MulScalar(0.5)
+	c.BoundingBox = Box3{cmin.Sub(h), cmax.Add(h)}
+	c.Volume = float64(c.Voxels) * g.inc.X * g.inc.Y * g.inc.Z
+	return c, vi, vo
+}
+
+// surface returns a point on the surface between an inside and an outside point.
+func (g *voxelGrid) surface(pi, po V3) V3 {
+	for i := 0; i < 50; i++ {
+		p := pi.Add(po).MulScalar(0.5)
+		if g.s.Evaluate(p) < 0 {
+			pi = p
+		} else {
+			po = p
+		}
+	}
+	return pi.Add(po).MulScalar(0.5)
+}
+
+// components labels the connected components of the solid voxels.
+func (g *voxelGrid) components() []Component3 {
+	for i := range g.label {
+		g.label[i] = -1
+	}
+	var comps []Component3
+	var v V3i
+	for v[0] = 0; v[0] < g.steps[0]; v[0]++ {
+		for v[1] = 0; v[1] < g.steps[1]; v[1]++ {
+			for v[2] = 0; v[2] < g.steps[2]; v[2]++ {
+				i := g.index(v)
+				if !g.solid[i] || g.label[i] >= 0 {
+					continue
+				}
+				c, vi, vo := g.fill(v, len(comps))
+				c.Surface = g.surface(g.inside[g.index(vi)], g.center(vo))
+				comps = append(comps, c)
+			}
+		}
+	}
+	return comps
+}
+
+//-----------------------------------------------------------------------------
+
+// Components3D returns the connected solid regions of an SDF3.
+// The SDF3 is sampled with meshCells voxels on the longest axis.
+func Components3D(s SDF3, meshCells int) []Component3 {
+	g := newVoxelGrid(s, meshCells)
+	g.scan()
+	return g.components()
+}
+
+//-----------------------------------------------------------------------------
+
+// RemoveSmallSDF3 is an SDF3 with the small disconnected parts removed.
+type RemoveSmallSDF3 struct {
+	sdf  SDF3
+	g    *voxelGrid
+	drop []bool // voxels of the removed parts
+	bb   Box3
+}
+
+// RemoveSmall3D removes the disconnected parts of an SDF3 with a volume less
+// than minVolume. The parts are found with Components3D(s, meshCells).
+// This is useful for removing floating debris left over from CSG operations.
+// It returns an error if all the parts would be removed.
+func RemoveSmall3D(s SDF3, meshCells int, minVolume float64) (SDF3, error) {
+	g := newVoxelGrid(s, meshCells)
+	g.scan()
+	comps := g.components()
+	// mark the voxels of the small components (and their neighbours)
+	small := make([]bool, len(comps))
+	var bb Box3
+	first := true
+	for i, c := range comps {
+		if c.Volume < minVolume {
+			small[i] = true
+		} else if first {
+			bb, first = c.BoundingBox, false
+		} else {
+			bb = bb.Extend(c.BoundingBox)
+		}
+	}
+	if first {
+		return nil, fmt.Errorf("all parts have a volume less than %g", minVolume)
+	}
+	drop := make([]bool, len(g.label))
+	var v V3i
+	for v[0] = 0; v[0] < g.steps[0]; v[0]++ {
+		for v[1] = 0; v[1] < g.steps[1]; v[1]++ {
+			for v[2] = 0; v[2] < g.steps[2]; v[2]++ {
+				l := g.label[g.index(v)]
+				if l < 0 || !small[l] {
+					continue
+				}
+				drop[g.index(v)] = true
+				for _, dv := range neighbours {
+					u := v.Add(dv)
+					if g.contains(u) && g.label[g.index(u)] < 0 {
+						drop[g.index(u)] = true
+					}
+				}
+			}
+		}
+	}
+	// The component bounding boxes are on voxel boundaries, so they
+	// may be larger than the bounding box of the SDF3.
+	sbb := s.BoundingBox()
+	bb = Box3{bb.Min.Max(sbb.Min), bb.Max.Min(sbb.Max)}
+	return &RemoveSmallSDF3{
+		sdf:  s,
+		g:    g,
+		drop: drop,
+		bb:   bb,
+	}, nil
+}
+
+// Evaluate returns the minimum distance to an SDF3 with small parts removed.
+// Points inside a removed part are outside the SDF3. The distance to the
+// surface of the removed part is a lower bound on the distance to the
+// remaining parts.
+func (s *RemoveSmallSDF3) Evaluate(p V3) float64 {
+	d := s.sdf.Evaluate(p)
+	if d >= 0 {
+		return d
+	}
+	t := p.Sub(s.g.base).Div(s.g.inc)
+	v := V3i{int(math.Floor(t.X + 0.5)), int(math.Floor(t.Y + 0.5)), int(math.Floor(t.Z + 0.5))}
+	if s.g.contains(v) && s.drop[s.g.index(v)] {
+		return -d
+	}
+	return d
+}
+
+// BoundingBox returns the bounding box of an SDF3 with small parts removed.
+func (s *RemoveSmallSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,225 @@
+//-----------------------------------------------------------------------------
+/*
+
+Contour Trees
+
+Join the line segments from 2D contouring into closed loops and work out
+how the loops are nested. Outer boundaries contain holes, holes contain
+islands (more outer boundaries), and so on. JoinLines returns the loops
+as polygons with holes (for exporters that need them).
+
+The loops are oriented so outer boundaries are counter-clockwise and holes
+are clockwise.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "sort"
+
+//-----------------------------------------------------------------------------
+
+// Contour is a closed loop of a 2d boundary.
+type Contour struct {
+	Points   V2Set      // loop vertices (the last vertex joins the first)
+	Hole     bool       // is this a hole?
+	Depth    int        // nesting depth (0 = outermost)
+	Parent   *Contour   // enclosing contour (nil for depth 0)
+	Children []*Contour // directly enclosed contours
+	area     float64    // signed area (counter-clockwise is positive)
+}
+
+// ContourTree is the set of nested contours for a 2d boundary.
+type ContourTree struct {
+	Roots []*Contour // the depth 0 (outer) contours
+}
+
+//-----------------------------------------------------------------------------
+
+// Area returns the area enclosed by a contour.
+func (c *Contour) Area() float64 {
+	return Abs(c.area)
+}
+
+// signedArea returns the signed area of a polygon (counter-clockwise is positive).
+func signedArea(v V2Set) float64 {
+	a := 0.0
+	for i := range v {
+		j := (i + 1) % len(v)
+		a += v[i].Cross(v[j])
+	}
+	return 0.5 * a
+}
+
+// Contains returns true if a point is inside the loop of a contour.
+func (c *Contour) Contains(p V2) bool {
+	inside := false
+	v := c.Points
+	for i, j := 0, len(v)-1; i < len(v); j, i = i, i+1 {
+		if (v[i].Y > p.Y) != (v[j].Y > p.Y) {
+			x := v[i].X + (p.Y-v[i].Y)*(v[j].X-v[i].X)/(v[j].Y-v[i].Y)
+			if p.X < x {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
+
+// reverse reverses the direction of a contour.
+func (c *Contour) reverse() {
+	v := c.Points
+	for i, j := 0, len(v)-1; i < j; i, j = i+1, j-1 {
+		v[i], v[j] = v[j], v[i]
+	}
+	c.area = -c.area
+}
+
+// All returns all of the contours in the tree (parents before children).
+func (t *ContourTree) All() []*Contour {
+	var all []*Contour
+	var walk func(c []*Contour)
+	walk = func(c []*Contour) {
+		for _, x := range c {
+			all = append(all, x)
+			walk(x.Children)
+		}
+	}
+	walk(t.Roots)
+	return all
+}
+
+//-----------------------------------------------------------------------------
+
+// chainLines joins line segments with shared end points into loops.
+func chainLines(lines []*Line) []V2Set {
+	// line indices for each end point
+	ends := make(map[V2][]int)
+	for i, l := range lines {
+		ends[l[0]] = append(ends[l[0]], i)
+		ends[l[1]] = append(ends[l[1]], i)
+	}
+	used := make([]bool, len(lines))
+	var loops []V2Set
+	for i, l := range lines {
+		if used[i] {
+			continue
+		}
+		used[i] = true
+		loop := V2Set{l[0]}
+		start, p := l[0], l[1]
+		for p != start {
+			loop = append(loop, p)
+			// find an unused line at this end point
+			next := -1
+			for _, j := range ends[p] {
+				if !used[j] {
+					next = j
+					break
+				}
+			}
+			if next < 0 {
+				// an open chain, treat it as closed
+				break
+			}
+			used[next] = true
+			if lines[next][0] == p {
+				p = lines[next][1]
+			} else {
+				p = lines[next][0]
+			}
+		}
+		if len(loop) >= 3 {
+			loops = append(loops, loop)
+		}
+	}
+	return loops
+}
+
+// NewContourTree joins line segments into loops and works out their nesting.
+func NewContourTree(lines []*Line) *ContourTree {
+	loops := chainLines(lines)
+	contours := make([]*Contour, len(loops))
+	for i, v := range loops {
+		contours[i] = &Contour{Points: v, area: signedArea(v)}
+	}
+	// The parent is the smallest enclosing contour. Sort by area so the
+	// possible parents of a contour are the larger contours before it.
+	sort.SliceStable(contours, func(i, j int) bool {
+		return contours[i].Area() > contours[j].Area()
+	})
+	t := ContourTree{}
+	for i, c := range contours {
+		for j := i - 1; j >= 0; j-- {
+			if contours[j].Contains(c.Points[0]) {
+				c.Parent = contours[j]
+				break
+			}
+		}
+		if c.Parent == nil {
+			t.Roots = append(t.Roots, c)
+		} else {
+			c.Depth = c.Parent.Depth + 1
+			c.Parent.Children = append(c.Parent.Children, c)
+		}
+		c.Hole = c.Depth%2 == 1
+		// outer boundaries are counter-clockwise, holes are clockwise
+		if (c.area < 0) != c.Hole {
+			c.reverse()
+		}
+	}
+	return &t
+}
+
+// GenerateContours generates the nested contours for an SDF2 boundary (uses quadtree sampling).
+func GenerateContours(
+	s SDF2, // sdf2 to render
+	meshCells int, // number of cells on the longest axis. e.g 200
+) *ContourTree {
+	return NewContourTree(GenerateLines(s, meshCells))
+}
+
+//-----------------------------------------------------------------------------
+
+// Polygon2 is a 2d polygon with holes.
+type Polygon2 struct {
+	Outer V2Set   // outer boundary (counter-clockwise)
+	Holes []V2Set // holes (clockwise)
+}
+
+// JoinLines joins line segments into closed polygons with holes. Segment end
+// points within tolerance of each other are joined. The loops are nested by
+// even-odd containment, so an island within a hole is another polygon.
+func JoinLines(lines []*Line, tolerance float64) []Polygon2 {
+	if tolerance < 0 {
+		panic("tolerance < 0")
+	}
+	// weld the end points
+	w := newWelder(tolerance)
+	weld := func(p V2) V2 {
+		i, _ := w.index(V3{p.X, p.Y, 0})
+		return V2{w.vertex[i].X, w.vertex[i].Y}
+	}
+	welded := make([]*Line, 0, len(lines))
+	for _, l := range lines {
+		p0, p1 := weld(l[0]), weld(l[1])
+		if p0 != p1 {
+			welded = append(welded, &Line{p0, p1})
+		}
+	}
+	var polygons []Polygon2
+	for _, c := range NewContourTree(welded).All() {
+		if c.Hole {
+			continue
+		}
+		p := Polygon2{Outer: c.Points}
+		for _, h := range c.Children {
+			p.Holes = append(p.Holes, h.Points)
+		}
+		polygons = append(polygons, p)
+	}
+	return polygons
+}
+
+//-----------------------------------------------------------------------------
@@ -94,6 +94,20 @@ func SaveDXF(path string, mesh []*Line) error {
 	return nil
 }
 
+// SavePolylinesDXF writes 3D polylines to a DXF file.
+func SavePolylinesDXF(path string, lines []Polyline3) error {
+	d := NewDXF(path)
+	d.drawing.ChangeLayer("Lines")
+	for _, l := range lines {
+		for i := 1; i < len(l); i++ {
+			p0 := l[i-1]
+			p1 := l[i]
+			d.drawing.Line(p0.X, p0.Y, p0.Z, p1.X, p1.Y, p1.Z)
+		}
+	}
+	return d.Save()
+}
+
 //-----------------------------------------------------------------------------
 
 // WriteDXF writes a stream of line segments to a DXF file.
@@ -0,0 +1,186 @@
+//-----------------------------------------------------------------------------
+/*
+
+Feature Edges
+
+Extract the sharp edges of a triangle mesh as polylines. These can be
+exported (DXF/JSON) and used to re-create sketch geometry for a generated
+model in a parametric CAD program.
+
+An edge is sharp if the angle between the normals of the triangles either
+side of it is larger than a threshold. Open edges (boundary edges) are
+always feature edges. The edges are chained into polylines that end at
+corners (where more than two feature edges meet) and at the ends of open
+chains. A closed loop has the same first and last point.
+
+Marching cubes meshes have chamfered sharp edges (the corner is cut off
+by a strip of triangles), so a sharp edge of the model can appear as two
+parallel feature edges with half the angle each. Use a threshold of less
+than half of the smallest angle of interest.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"math"
+	"sort"
+)
+
+//-----------------------------------------------------------------------------
+
+// Polyline3 is a chain of connected 3D points.
+type Polyline3 []V3
+
+// Closed returns true if the polyline is a closed loop.
+func (p Polyline3) Closed() bool {
+	return len(p) > 2 && p[0] == p[len(p)-1]
+}
+
+// Length returns the length of the polyline.
+func (p Polyline3) Length() float64 {
+	l := 0.0
+	for i := 1; i < len(p); i++ {
+		l += p[i].Sub(p[i-1]).Length()
+	}
+	return l
+}
+
+//-----------------------------------------------------------------------------
+
+// FeatureEdges returns the sharp edges of a triangle mesh as polylines.
+// An edge is sharp if the dihedral angle (radians) between the normals of the
+// adjacent triangles is larger than angle.
+func FeatureEdges(mesh []*Triangle3, angle float64) []Polyline3 {
+	if angle < 0 || angle > Pi {
+		panic("angle must be [0..Pi]")
+	}
+	cosAngle := math.Cos(angle)
+
+	// indexed mesh
+	w := newWelder(0)
+	faces := make([]repairFace, len(mesh))
+	normals := make([]V3, len(mesh))
+	for i, t := range mesh {
+		for j := range t.V {
+			faces[i].v[j], _ = w.index(t.V[j])
+		}
+		n := t.V[1].Sub(t.V[0]).Cross(t.V[2].Sub(t.V[0]))
+		if n.Length() != 0 {
+			normals[i] = n.Normalize()
+		}
+	}
+
+	// the faces on each edge
+	edgeFaces := make(map[[2]int][]int)
+	for i, f := range faces {
+		for j := 0; j < 3; j++ {
+			a, b := f.v[j], f.v[(j+1)%3]
+			if a == b {
+				continue
+			}
+			k := edgeKey(a, b)
+			edgeFaces[k] = append(edgeFaces[k], i)
+		}
+	}
+
+	// the feature edges at each vertex
+	adjacent := make(map[int][]int)
+	for k, fs := range edgeFaces {
+		sharp := len(fs) != 2
+		if !sharp {
+			n0, n1 := normals[fs[0]], normals[fs[1]]
+			// ignore degenerate triangles
+			sharp = n0 != (V3{}) && n1 != (V3{}) && n0.Dot(n1) < cosAngle
+		}
+		if sharp {
+			adjacent[k[0]] = append(adjacent[k[0]], k[1])
+			adjacent[k[1]] = append(adjacent[k[1]], k[0])
+		}
+	}
+
+	// chain the feature edges into polylines
+	used := make(map[[2]int]bool)
+	var lines []Polyline3
+	walk := func(start, next int) {
+		line := Polyline3{w.vertex[start]}
+		prev, v := start, next
+		for {
+			used[edgeKey(prev, v)] = true
+			line = append(line, w.vertex[v])
+			if len(adjacent[v]) != 2 {
+				break
+			}
+			n := adjacent[v][0]
+			if n == prev {
+				n = adjacent[v][1]
+			}
+			if used[edgeKey(v, n)] {
+				break
+			}
+			prev, v = v, n
+		}
+		lines = append(lines, line)
+	}
+	// open chains start at the ends and corners
+	vertices := make([]int, 0, len(adjacent))
+	for v := range adjacent {
+		vertices = append(vertices, v)
+	}
+	// deterministic output
+	sort.Ints(vertices)
+	for _, v := range vertices {
+		if len(adjacent[v]) == 2 {
+			continue
+		}
+		for _, n := range adjacent[v] {
+			if !used[edgeKey(v, n)] {
+				walk(v, n)
+			}
+		}
+	}
+	// the remaining edges are closed loops
+	for _, v := range vertices {
+		for _, n := range adjacent[v] {
+			if !used[edgeKey(v, n)] {
+				walk(v, n)
+			}
+		}
+	}
+	return lines
+}
+
+//-----------------------------------------------------------------------------
+
+// FeatureEdgeReport is a set of feature edges (for JSON output).
+type FeatureEdgeReport struct {
+	Angle     float64        `json:"angle"`     // dihedral angle threshold (radians)
+	Polylines [][][3]float64 `json:"polylines"` // feature edge polylines (x, y, z points)
+}
+
+// NewFeatureEdgeReport returns a report of feature edges.
+func NewFeatureEdgeReport(lines []Polyline3, angle float64) *FeatureEdgeReport {
+	r := &FeatureEdgeReport{Angle: angle, Polylines: make([][][3]float64, len(lines))}
+	for i, l := range lines {
+		r.Polylines[i] = make([][3]float64, len(l))
+		for j, p := range l {
+			r.Polylines[i][j] = [3]float64{p.X, p.Y, p.Z}
+		}
+	}
+	return r
+}
+
+// Lines returns the polylines of a feature edge report.
+func (r *FeatureEdgeReport) Lines() []Polyline3 {
+	lines := make([]Polyline3, len(r.Polylines))
+	for i, l := range r.Polylines {
+		lines[i] = make(Polyline3, len(l))
+		for j, p := range l {
+			lines[i][j] = V3{p[0], p[1], p[2]}
+		}
+	}
+	return lines
+}
+
+//-----------------------------------------------------------------------------
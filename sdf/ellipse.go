@@ -0,0 +1,288 @@
+//-----------------------------------------------------------------------------
+/*
+
+Ellipses, Ellipsoids and Elliptic Cylinders
+
+Non-uniformly scaling a sphere or cylinder gives a distance bound that gets
+worse as the scaling becomes less uniform. These primitives use the exact
+distance to an ellipse/ellipsoid.
+
+The closest point on the ellipse/ellipsoid is found by bisection on the
+Lagrange multiplier. See:
+
+https://www.geometrictools.com/Documentation/DistancePointEllipseEllipsoid.pdf
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// ellipseRoot finds the root of the ellipse distance function by bisection.
+func ellipseRoot(r0, z0, z1, g float64) float64 {
+	n0 := r0 * z0
+	s0 := z1 - 1
+	s1 := 0.0
+	if g >= 0 {
+		s1 = V2{n0, z1}.Length() - 1
+	}
+	s := 0.0
+	for i := 0; i < 1100; i++ {
+		s = 0.5 * (s0 + s1)
+		if s == s0 || s == s1 {
+			break
+		}
+		a0, a1 := n0/(s+r0), z1/(s+1)
+		g = a0*a0 + a1*a1 - 1
+		if g > 0 {
+			s0 = s
+		} else if g < 0 {
+			s1 = s
+		} else {
+			break
+		}
+	}
+	return s
+}
+
+// ellipseDistance returns the distance from a point (y0, y1 >= 0) to an ellipse
+// with semi-axes e0 >= e1 > 0.
+func ellipseDistance(e0, e1, y0, y1 float64) float64 {
+	if y1 > 0 {
+		if y0 > 0 {
+			z0 := y0 / e0
+			z1 := y1 / e1
+			g := z0*z0 + z1*z1 - 1
+			if g == 0 {
+				return 0
+			}
+			r0 := (e0 / e1) * (e0 / e1)
+			s := ellipseRoot(r0, z0, z1, g)
+			x0 := r0 * y0 / (s + r0)
+			x1 := y1 / (s + 1)
+			return V2{x0 - y0, x1 - y1}.Length()
+		}
+		return Abs(y1 - e1)
+	}
+	numer0 := e0 * y0
+	denom0 := e0*e0 - e1*e1
+	if numer0 < denom0 {
+		xde0 := numer0 / denom0
+		x0 := e0 * xde0
+		x1 := e1 * math.Sqrt(1-xde0*xde0)
+		return V2{x0 - y0, x1}.Length()
+	}
+	return Abs(y0 - e0)
+}
+
+// ellipsoidRoot finds the root of the ellipsoid distance function by bisection.
+func ellipsoidRoot(r0, r1, z0, z1, z2, g float64) float64 {
+	n0 := r0 * z0
+	n1 := r1 * z1
+	s0 := z2 - 1
+	s1 := 0.0
+	if g >= 0 {
+		s1 = V3{n0, n1, z2}.Length() - 1
+	}
+	s := 0.0
+	for i := 0; i < 1100; i++ {
+		s = 0.5 * (s0 + s1)
+		if s == s0 || s == s1 {
+			break
+		}
+		a0, a1, a2 := n0/(s+r0), n1/(s+r1), z2/(s+1)
+		g = a0*a0 + a1*a1 + a2*a2 - 1
+		if g > 0 {
+			s0 = s
+		} else if g < 0 {
+			s1 = s
+		} else {
+			break
+		}
+	}
+	return s
+}
+
+// ellipsoidDistance returns the distance from a point (y0, y1, y2 >= 0) to an
+// ellipsoid with semi-axes e0 >= e1 >= e2 > 0.
+func ellipsoidDistance(e0, e1, e2, y0, y1, y2 float64) float64 {
+	if y2 > 0 {
+		if y1 > 0 {
+			if y0 > 0 {
+				z0 := y0 / e0
+				z1 := y1 / e1
+				z2 := y2 / e2
+				g := z0*z0 + z1*z1 + z2*z2 - 1
+				if g == 0 {
+					return 0
+				}
+				r0 := (e0 / e2) * (e0 / e2)
+				r1 := (e1 / e2) * (e1 / e2)
+				s := ellipsoidRoot(r0, r1, z0, z1, z2, g)
+				x0 := r0 * y0 / (s + r0)
+				x1 := r1 * y1 / (s + r1)
+				x2 := y2 / (s + 1)
+				return V3{x0 - y0, x1 - y1, x2 - y2}.Length()
+			}
+			return ellipseDistance(e1, e2, y1, y2)
+		}
+		if y0 > 0 {
+			return ellipseDistance(e0, e2, y0, y2)
+		}
+		return Abs(y2 - e2)
+	}
+	denom0 := e0*e0 - e2*e2
+	denom1 := e1*e1 - e2*e2
+	numer0 := e0 * y0
+	numer1 := e1 * y1
+	if numer0 < denom0 && numer1 < denom1 {
+		xde0 := numer0 / denom0
+		xde1 := numer1 / denom1
+		discr := 1 - xde0*xde0 - xde1*xde1
+		if discr > 0 {
+			x0 := e0 * xde0
+			x1 := e1 * xde1
+			x2 := e2 * math.Sqrt(discr)
+			return V3{x0 - y0, x1 - y1, x2}.Length()
+		}
+	}
+	return ellipseDistance(e0, e1, y0, y1)
+}
+
+// sdfEllipse2d returns the signed distance to an ellipse with semi-axes r.
+func sdfEllipse2d(p, r V2) float64 {
+	p = p.Abs()
+	// the first axis must be the major axis
+	if r.X < r.Y {
+		p = V2{p.Y, p.X}
+		r = V2{r.Y, r.X}
+	}
+	d := ellipseDistance(r.X, r.Y, p.X, p.Y)
+	if p.Div(r).Length() < 1 {
+		return -d
+	}
+	return d
+}
+
+//-----------------------------------------------------------------------------
+// 2D Ellipse (exact distance field)
+
+// EllipseSDF2 is the 2d signed distance object for an ellipse.
+type EllipseSDF2 struct {
+	r  V2 // x, y semi-axes
+	bb Box2
+}
+
+// Ellipse2D returns the SDF2 for an ellipse with x and y semi-axes rx and ry.
+func Ellipse2D(rx, ry float64) SDF2 {
+	if rx <= 0 || ry <= 0 {
+		panic("radius <= 0")
+	}
+	s := EllipseSDF2{}
+	s.r = V2{rx, ry}
+	s.bb = Box2{s.r.Neg(), s.r}
+	return &s
+}
+
+// Evaluate returns the minimum distance to an ellipse.
+func (s *EllipseSDF2) Evaluate(p V2) float64 {
+	return sdfEllipse2d(p, s.r)
+}
+
+// BoundingBox returns the bounding box of an ellipse.
+func (s *EllipseSDF2) BoundingBox() Box2 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+// Ellipsoid (exact distance field)
+
+// EllipsoidSDF3 is an ellipsoid.
+type EllipsoidSDF3 struct {
+	r   V3     // semi-axes in descending order
+	idx [3]int // x,y,z index for each semi-axis
+	bb  Box3
+}
+
+// Ellipsoid3D returns an SDF3 for an ellipsoid with x, y, z semi-axes r.
+func Ellipsoid3D(r V3) SDF3 {
+	if r.X <= 0 || r.Y <= 0 || r.Z <= 0 {
+		panic("radius <= 0")
+	}
+	s := EllipsoidSDF3{}
+	// sort the semi-axes by descending length
+	a := [3]float64{r.X, r.Y, r.Z}
+	s.idx = [3]int{0, 1, 2}
+	for i := 0; i < 2; i++ {
+		for j := i + 1; j < 3; j++ {
+			if a[s.idx[j]] > a[s.idx[i]] {
+				s.idx[i], s.idx[j] = s.idx[j], s.idx[i]
+			}
+		}
+	}
+	s.r = V3{a[s.idx[0]], a[s.idx[1]], a[s.idx[2]]}
+	s.bb = Box3{r.Neg(), r}
+	return &s
+}
+
+// Evaluate returns the minimum distance to an ellipsoid.
+func (s *EllipsoidSDF3) Evaluate(p V3) float64 {
+	a := [3]float64{Abs(p.X), Abs(p.Y), Abs(p.Z)}
+	y := V3{a[s.idx[0]], a[s.idx[1]], a[s.idx[2]]}
+	d := ellipsoidDistance(s.r.X, s.r.Y, s.r.Z, y.X, y.Y, y.Z)
+	if y.Div(s.r).Length() < 1 {
+		return -d
+	}
+	return d
+}
+
+// BoundingBox returns the bounding box for an ellipsoid.
+func (s *EllipsoidSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+// Elliptic Cylinder (exact distance field)
+
+// EllipticCylinderSDF3 is a cylinder with an elliptic cross section.
+type EllipticCylinderSDF3 struct {
+	height float64 // half height
+	r      V2      // x, y semi-axes
+	bb     Box3
+}
+
+// EllipticCylinder3D returns an SDF3 for a cylinder with an elliptic cross section.
+// The x and y semi-axes of the ellipse are rx and ry.
+func EllipticCylinder3D(height, rx, ry float64) SDF3 {
+	if height <= 0 {
+		panic("height <= 0")
+	}
+	if rx <= 0 || ry <= 0 {
+		panic("radius <= 0")
+	}
+	s := EllipticCylinderSDF3{}
+	s.height = height / 2
+	s.r = V2{rx, ry}
+	d := V3{rx, ry, height / 2}
+	s.bb = Box3{d.Neg(), d}
+	return &s
+}
+
+// Evaluate returns the minimum distance to an elliptic cylinder.
+func (s *EllipticCylinderSDF3) Evaluate(p V3) float64 {
+	d := V2{sdfEllipse2d(V2{p.X, p.Y}, s.r), Abs(p.Z) - s.height}
+	if d.X > 0 && d.Y > 0 {
+		return d.Length()
+	}
+	return Max(d.X, d.Y)
+}
+
+// BoundingBox returns the bounding box for an elliptic cylinder.
+func (s *EllipticCylinderSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,208 @@
+//-----------------------------------------------------------------------------
+/*
+
+Engraving
+
+Engrave an SDF2 (e.g. text from TextSDF2) into the surface of an SDF3.
+
+The engraving follows the surface, so it has a constant depth on curved
+surfaces. On a convex surface the walls of an engraved stroke converge, so
+narrow strokes can close up at the bottom of a deep engraving. The
+engraving is widened (and the depth limited) using the local surface
+curvature so that the bottom of the thinnest stroke is at least as wide as
+the printer nozzle.
+
+The engraving is limited to a slab around the surface point (the depth
+plus the drop of the curved surface across the engraving), so it doesn't
+cut into the far side of a thin part.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+//-----------------------------------------------------------------------------
+
+// EngraveParms defines the parameters for an engraving.
+type EngraveParms struct {
+	Depth    float64 // engraving depth (normal to the surface)
+	Nozzle   float64 // printer nozzle width (minimum stroke width)
+	Position V3      // center of the engraving (on or near the surface)
+	Normal   V3      // outward direction of the engraving
+	Up       V3      // direction of the engraving y-axis
+}
+
+//-----------------------------------------------------------------------------
+
+// surfacePoint moves a point onto the surface of an SDF3.
+func surfacePoint(s SDF3, p V3, h float64) (V3, error) {
+	for i := 0; i < 50; i++ {
+		d := s.Evaluate(p)
+		if Abs(d) < epsilon {
+			return p, nil
+		}
+		n := Normal3(s, p, h)
+		if n.Length() == 0 {
+			break
+		}
+		p = p.Sub(n.MulScalar(d))
+	}
+	return V3{}, errors.New("can't find the surface")
+}
+
+// maxCurvature returns the maximum principal curvature of an SDF3 surface
+// at p, where u and v are the tangent directions. Convex is positive.
+func maxCurvature(s SDF3, p, u, v V3, h float64) float64 {
+	f := func(a, b float64) float64 {
+		return s.Evaluate(p.Add(u.MulScalar(a * h)).Add(v.MulScalar(b * h)))
+	}
+	f0 := f(0, 0)
+	fuu := (f(1, 0) - 2*f0 + f(-1, 0)) / (h * h)
+	fvv := (f(0, 1) - 2*f0 + f(0, -1)) / (h * h)
+	fuv := (f(1, 1) - f(1, -1) - f(-1, 1) + f(-1, -1)) / (4 * h * h)
+	// maximum eigenvalue of the 2x2 hessian
+	a := 0.5 * (fuu + fvv)
+	b := 0.5 * (fuu - fvv)
+	return a + math.Sqrt(b*b+fuv*fuv)
+}
+
+// strokeWidth estimates the width of the thinnest stroke of an SDF2.
+// It samples the SDF2 on a grid and uses the local maxima of the interior
+// distance (points on the medial axis).
+func strokeWidth(s SDF2, cells int) float64 {
+	bb := s.BoundingBox()
+	inc := bb.Size().MaxComponent() / float64(cells)
+	n := bb.Size().DivScalar(inc).Ceil().ToV2i().AddScalar(1)
+	d := make([]float64, n[0]*n[1])
+	for i := 0; i < n[0]; i++ {
+		for j := 0; j < n[1]; j++ {
+			d[i*n[1]+j] = s.Evaluate(bb.Min.Add(V2{float64(i), float64(j)}.MulScalar(inc)))
+		}
+	}
+	var widths []float64
+	for i := 1; i < n[0]-1; i++ {
+		for j := 1; j < n[1]-1; j++ {
+			x := d[i*n[1]+j]
+			if x >= 0 {
+				continue
+			}
+			ridge := true
+			for di := -1; di <= 1 && ridge; di++ {
+				for dj := -1; dj <= 1; dj++ {
+					if d[(i+di)*n[1]+j+dj] < x {
+						ridge = false
+						break
+					}
+				}
+			}
+			if ridge {
+				widths = append(widths, -2*x)
+			}
+		}
+	}
+	if len(widths) == 0 {
+		return 0
+	}
+	// ignore the odd outlier (e.g. at stroke ends)
+	sort.Float64s(widths)
+	return widths[len(widths)/10]
+}
+
+//-----------------------------------------------------------------------------
+
+// engraveSDF3 is the volume removed by an engraving.
+type engraveSDF3 struct {
+	s       SDF3    // the engraved surface
+	e       SDF2    // the engraving
+	o       V3      // engraving origin
+	u, v, w V3      // engraving x, y, z axes
+	depth   float64 // engraving depth
+	z0, z1  float64 // slab (along w) containing the engraving
+	bb      Box3
+}
+
+// Evaluate returns the minimum distance to the engraving volume.
+func (s *engraveSDF3) Evaluate(p V3) float64 {
+	q := p.Sub(s.o)
+	d := s.e.Evaluate(V2{q.Dot(s.u), q.Dot(s.v)})
+	z := q.Dot(s.w)
+	// the slab stops the engraving cutting into other faces of the SDF3
+	d = Max(d, Max(s.z0-z, z-s.z1))
+	return Max(d, -s.s.Evaluate(p)-s.depth)
+}
+
+// BoundingBox returns the bounding box of the engraving volume.
+func (s *engraveSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+
+// Engrave3D engraves an SDF2 into the surface of an SDF3.
+// The SDF2 is projected onto the surface along the normal direction.
+// Its origin is placed at the surface point nearest to k.Position.
+func Engrave3D(s SDF3, e SDF2, k *EngraveParms) (SDF3, error) {
+	if k.Depth <= 0 {
+		return nil, errors.New("Depth <= 0")
+	}
+	if k.Nozzle < 0 {
+		return nil, errors.New("Nozzle < 0")
+	}
+	w := k.Normal.Normalize()
+	u := k.Up.Cross(w)
+	if u.Length() == 0 {
+		return nil, errors.New("Up and Normal are parallel")
+	}
+	u = u.Normalize()
+	v := w.Cross(u)
+
+	// local surface curvature
+	h := 0.5 * k.Depth
+	o, err := surfacePoint(s, k.Position, h)
+	if err != nil {
+		return nil, err
+	}
+	kappa := Max(maxCurvature(s, o, u, v, h), 0)
+
+	// limit the depth to half the radius of curvature
+	depth := k.Depth
+	if kappa > 0 {
+		depth = Min(depth, 0.5/kappa)
+	}
+	// widen the strokes so the bottom of the thinnest stroke is >= nozzle width
+	width := strokeWidth(e, 200)
+	grow := 0.5 * (k.Nozzle/(1-kappa*depth) - width)
+	if grow > 0 {
+		e = Offset2D(e, grow)
+	}
+
+	// allow for the surface curving away from the tangent plane
+	bb := e.BoundingBox()
+	l := bb.Size().Length()
+	r := Max(bb.Min.Length(), bb.Max.Length())
+	sag := r
+	if kappa*r < 1 {
+		sag = (1 - math.Sqrt(1-kappa*kappa*r*r)) / kappa
+		if kappa == 0 {
+			sag = 0
+		}
+	}
+	c := engraveSDF3{s: s, e: e, o: o, u: u, v: v, w: w, depth: depth}
+	c.z0 = -(sag + 1.5*depth)
+	c.z1 = l
+	var pts V3Set
+	for _, p := range bb.Vertices() {
+		x := o.Add(u.MulScalar(p.X)).Add(v.MulScalar(p.Y))
+		pts = append(pts, x.Add(w.MulScalar(c.z1)), x.Add(w.MulScalar(c.z0)))
+	}
+	c.bb = Box3{pts.Min(), pts.Max()}
+	return Difference3D(s, &c), nil
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,304 @@
+//-----------------------------------------------------------------------------
+/*
+
+G-Code Slicer
+
+A simple planar slicer for FDM printing. The SDF3 is sliced at the middle
+of each layer, the 2d area of the slice is rebuilt from the slice contours,
+and the toolpaths for each layer are:
+
+perimeters: the slice contours offset inwards by 0.5, 1.5, 2.5 ... line widths.
+infill: rectilinear lines inside the perimeters, rotated 90 degrees on
+alternate layers. The bottom and top layers are solid (100% infill).
+
+The toolpaths are written as basic RepRap (Marlin) G-code with absolute
+extrusion. There is no retraction, support, bridging, cooling or
+acceleration control, so use a real slicer for anything but simple parts.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+//-----------------------------------------------------------------------------
+
+// SlicerParms defines the parameters for slicing an SDF3 into G-code.
+type SlicerParms struct {
+	LayerHeight      float64 // layer height (mm)
+	LineWidth        float64 // extrusion line width, typically the nozzle diameter (mm)
+	Perimeters       int     // number of perimeters
+	SolidLayers      int     // number of solid bottom and top layers
+	InfillDensity    float64 // infill density (0..1)
+	InfillAngle      float64 // infill angle (radians)
+	FilamentDiameter float64 // filament diameter (mm)
+	PrintSpeed       float64 // printing speed (mm/s)
+	TravelSpeed      float64 // travel speed (mm/s)
+	Temperature      float64 // nozzle temperature (C), 0 == no temperature commands
+	BedTemperature   float64 // bed temperature (C), 0 == no temperature commands
+	Center           V2      // bed position of the center of the model
+	Resolution       float64 // contour resolution (mm), 0 == 1/4 of the line width
+}
+
+// DefaultSlicerParms returns the slicer parameters for PLA with a 0.4 mm nozzle.
+func DefaultSlicerParms() *SlicerParms {
+	return &SlicerParms{
+		LayerHeight:      0.2,
+		LineWidth:        0.4,
+		Perimeters:       2,
+		SolidLayers:      3,
+		InfillDensity:    0.2,
+		InfillAngle:      DtoR(45),
+		FilamentDiameter: 1.75,
+		PrintSpeed:       40,
+		TravelSpeed:      120,
+		Temperature:      210,
+		BedTemperature:   60,
+		Center:           V2{100, 100},
+	}
+}
+
+// validate checks the slicer parameters.
+func (k *SlicerParms) validate() error {
+	if k.LayerHeight <= 0 {
+		return errors.New("layer height <= 0")
+	}
+	if k.LineWidth <= 0 {
+		return errors.New("line width <= 0")
+	}
+	if k.Perimeters < 0 || k.SolidLayers < 0 {
+		return errors.New("perimeters or solid layers < 0")
+	}
+	if k.InfillDensity < 0 || k.InfillDensity > 1 {
+		return errors.New("infill density must be [0..1]")
+	}
+	if k.FilamentDiameter <= 0 {
+		return errors.New("filament diameter <= 0")
+	}
+	if k.PrintSpeed <= 0 || k.TravelSpeed <= 0 {
+		return errors.New("speed <= 0")
+	}
+	if k.Resolution < 0 {
+		return errors.New("resolution < 0")
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// SliceLayer is the toolpaths for a layer (in model x/y coordinates).
+type SliceLayer struct {
+	Z          float64 // nozzle height above the bed
+	Perimeters []V2Set // closed loops (innermost perimeter first)
+	Infill     []*Line // infill lines (in print order)
+}
+
+// contourArea returns an SDF2 for the area inside a contour (less the areas of its children).
+func contourArea(c *Contour) SDF2 {
+	children := make([]SDF2, len(c.Children))
+	for i, x := range c.Children {
+		children[i] = contourArea(x)
+	}
+	return Difference2D(Polygon2D(c.Points), Union2D(children...))
+}
+
+// sliceRegion returns an SDF2 for the area of a slice through an SDF3.
+// The distance of a slice near the top or bottom of the SDF3 is the distance
+// to the top or bottom face, so the area is rebuilt from the slice contours
+// to get the 2d distance.
+func sliceRegion(slice SDF2, resolution float64) SDF2 {
+	cells := int(math.Ceil(slice.BoundingBox().Size().MaxComponent() / resolution))
+	t := NewContourTree(GenerateLines(slice, cells))
+	areas := make([]SDF2, len(t.Roots))
+	for i, c := range t.Roots {
+		areas[i] = contourArea(c)
+	}
+	return Union2D(areas...)
+}
+
+// insetContours returns the oriented contour loops of an SDF2 inset by d.
+func insetContours(s SDF2, d, resolution float64) []V2Set {
+	inset := Offset2D(s, -d)
+	size := inset.BoundingBox().Size()
+	if size.X <= 0 || size.Y <= 0 {
+		return nil
+	}
+	cells := int(math.Ceil(size.MaxComponent() / resolution))
+	var loops []V2Set
+	for _, c := range NewContourTree(GenerateLines(inset, cells)).All() {
+		loops = append(loops, c.Points)
+	}
+	return loops
+}
+
+// SliceLayers slices an SDF3 into layers of toolpaths.
+func SliceLayers(s SDF3, k *SlicerParms) ([]SliceLayer, error) {
+	if err := k.validate(); err != nil {
+		return nil, err
+	}
+	resolution := k.Resolution
+	if resolution == 0 {
+		resolution = 0.25 * k.LineWidth
+	}
+	w := k.LineWidth
+	bb := s.BoundingBox()
+	n := int(math.Floor(bb.Size().Z/k.LayerHeight + 0.5))
+	if n == 0 {
+		return nil, errors.New("model is thinner than a layer")
+	}
+	layers := make([]SliceLayer, n)
+	for i := range layers {
+		l := &layers[i]
+		l.Z = float64(i+1) * k.LayerHeight
+		// slice the middle of the layer
+		slice := sliceRegion(SliceZ2D(s, bb.Min.Z+(float64(i)+0.5)*k.LayerHeight), resolution)
+		if slice == nil {
+			continue
+		}
+		// perimeters (innermost first, so the outer surface is printed last)
+		for j := k.Perimeters - 1; j >= 0; j-- {
+			l.Perimeters = append(l.Perimeters, insetContours(slice, (float64(j)+0.5)*w, resolution)...)
+		}
+		// infill
+		density := k.InfillDensity
+		if i < k.SolidLayers || i >= n-k.SolidLayers {
+			density = 1
+		}
+		if density == 0 {
+			continue
+		}
+		// overlap the infill with the inner perimeter
+		inset := Offset2D(slice, -(float64(k.Perimeters)-0.15)*w)
+		size := inset.BoundingBox().Size()
+		if size.X <= 0 || size.Y <= 0 {
+			continue
+		}
+		angle := k.InfillAngle
+		if i%2 == 1 {
+			angle += 0.5 * Pi
+		}
+		l.Infill = hatchLines(inset, angle, w/density, []float64{0})
+		// zig-zag
+		for j, line := range l.Infill {
+			if j%2 == 1 {
+				l.Infill[j] = &Line{line[1], line[0]}
+			}
+		}
+	}
+	return layers, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// gcodeResolution is the resolution of the G-code positions (mm).
+const gcodeResolution = 0.001
+
+// gcodeWriter writes toolpath moves as G-code.
+type gcodeWriter struct {
+	w      *bufio.Writer
+	k      *SlicerParms
+	offset V2      // model to bed x/y offset
+	eScale float64 // filament length per unit of extrusion length
+	p      V2      // current position
+	e      float64 // current extruder position
+}
+
+// travel moves to a point without extruding.
+func (g *gcodeWriter) travel(p V2) {
+	p = p.Add(g.offset)
+	fmt.Fprintf(g.w, "G0 X%.3f Y%.3f F%.0f\n", p.X, p.Y, 60*g.k.TravelSpeed)
+	g.p = p
+}
+
+// extrude moves to a point while extruding.
+func (g *gcodeWriter) extrude(p V2) {
+	p = p.Add(g.offset)
+	l := p.Sub(g.p).Length()
+	if l < gcodeResolution {
+		// skip moves that don't change the output position
+		return
+	}
+	g.e += l * g.eScale
+	fmt.Fprintf(g.w, "G1 X%.3f Y%.3f E%.5f F%.0f\n", p.X, p.Y, g.e, 60*g.k.PrintSpeed)
+	g.p = p
+}
+
+// EncodeGCode writes the layers of toolpaths to a writer as G-code.
+func EncodeGCode(w io.Writer, layers []SliceLayer, bb Box3, k *SlicerParms) error {
+	if err := k.validate(); err != nil {
+		return err
+	}
+	r := 0.5 * k.FilamentDiameter
+	g := gcodeWriter{
+		w:      bufio.NewWriter(w),
+		k:      k,
+		offset: k.Center.Sub(V2{bb.Center().X, bb.Center().Y}),
+		eScale: k.LineWidth * k.LayerHeight / (Pi * r * r),
+	}
+	fmt.Fprintf(g.w, "; generated by sdfx\n")
+	fmt.Fprintf(g.w, "; layer height %g, line width %g, %d layers\n", k.LayerHeight, k.LineWidth, len(layers))
+	fmt.Fprintf(g.w, "G21 ; millimeters\nG90 ; absolute positioning\nM82 ; absolute extrusion\n")
+	if k.BedTemperature > 0 {
+		fmt.Fprintf(g.w, "M140 S%.0f\n", k.BedTemperature)
+	}
+	if k.Temperature > 0 {
+		fmt.Fprintf(g.w, "M104 S%.0f\n", k.Temperature)
+	}
+	fmt.Fprintf(g.w, "G28 ; home\n")
+	if k.BedTemperature > 0 {
+		fmt.Fprintf(g.w, "M190 S%.0f\n", k.BedTemperature)
+	}
+	if k.Temperature > 0 {
+		fmt.Fprintf(g.w, "M109 S%.0f\n", k.Temperature)
+	}
+	fmt.Fprintf(g.w, "G92 E0\n")
+
+	for i, l := range layers {
+		fmt.Fprintf(g.w, "; layer %d\n", i)
+		fmt.Fprintf(g.w, "G1 Z%.3f F%.0f\n", l.Z, 60*k.TravelSpeed)
+		for _, loop := range l.Perimeters {
+			g.travel(loop[0])
+			for _, p := range loop[1:] {
+				g.extrude(p)
+			}
+			g.extrude(loop[0])
+		}
+		for _, line := range l.Infill {
+			g.travel(line[0])
+			g.extrude(line[1])
+		}
+	}
+
+	z := 10.0
+	if len(layers) != 0 {
+		z += layers[len(layers)-1].Z
+	}
+	fmt.Fprintf(g.w, "; end\nM104 S0\nM140 S0\n")
+	fmt.Fprintf(g.w, "G1 Z%.3f F%.0f\n", z, 60*k.TravelSpeed)
+	fmt.Fprintf(g.w, "M84 ; motors off\n")
+	return g.w.Flush()
+}
+
+// SaveGCode slices an SDF3 and writes the toolpaths to a G-code file.
+func SaveGCode(path string, s SDF3, k *SlicerParms) error {
+	layers, err := SliceLayers(s, k)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return EncodeGCode(file, layers, s.BoundingBox(), k)
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,420 @@
+//-----------------------------------------------------------------------------
+/*
+
+Dense Grid Sampling
+
+Sample an SDF3 on a uniform grid.
+
+Grid3: The distances are stored in a memory mapped file. The grid can be
+larger than the available RAM, pages of the file are loaded and flushed by
+the OS as needed. It can be meshed directly with RenderSTLGrid().
+
+VoxelSDF3: The distances are stored in memory. Evaluating a deep CSG tree
+once and then using the voxels makes repeated meshing/previews much faster.
+The voxels can be saved to and loaded from a file.
+
+Both are SDF3s (trilinear interpolation of the samples).
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+)
+
+//-----------------------------------------------------------------------------
+
+// Grid3 is a dense grid of SDF3 samples stored in a memory mapped file.
+type Grid3 struct {
+	bb    Box3     // bounding box of the grid
+	inc   V3       // dx, dy, dz for each step
+	steps V3i      // number of x,y,z cells (samples = steps + 1)
+	f     *os.File // backing file
+	data  []byte   // memory mapped samples (float32, x-major)
+}
+
+// gridSize works out the sampling grid for an SDF3 with meshCells cells on the
+// longest axis. It returns the grid bounding box, the cell size and the number
+// of cells.
+func gridSize(s SDF3, meshCells int) (Box3, V3, V3i) {
+	bb0 := s.BoundingBox()
+	bb0Size := bb0.Size()
+	meshInc := bb0Size.MaxComponent() / float64(meshCells)
+	bb1Size := bb0Size.DivScalar(meshInc)
+	bb1Size = bb1Size.Ceil().AddScalar(1)
+	steps := bb1Size.ToV3i()
+	bb1Size = bb1Size.MulScalar(meshInc)
+	return NewBox3(bb0.Center(), bb1Size), bb1Size.Div(steps.ToV3()), steps
+}
+
+// gridEvaluate returns the trilinear interpolation of grid samples.
+// Points outside the grid are clamped to the grid boundary and the
+// distance to the boundary is added.
+func gridEvaluate(p V3, bb Box3, inc V3, steps V3i, get func(x, y, z int) float64) float64 {
+	q := p.Clamp(bb.Min, bb.Max)
+	// grid position
+	t := q.Sub(bb.Min).Div(inc)
+	x := int(Clamp(math.Floor(t.X), 0, float64(steps[0]-1)))
+	y := int(Clamp(math.Floor(t.Y), 0, float64(steps[1]-1)))
+	z := int(Clamp(math.Floor(t.Z), 0, float64(steps[2]-1)))
+	u := t.Sub(V3{float64(x), float64(y), float64(z)})
+	// trilinear interpolation
+	c00 := Mix(get(x, y, z), get(x+1, y, z), u.X)
+	c10 := Mix(get(x, y+1, z), get(x+1, y+1, z), u.X)
+	c01 := Mix(get(x, y, z+1), get(x+1, y, z+1), u.X)
+	c11 := Mix(get(x, y+1, z+1), get(x+1, y+1, z+1), u.X)
+	c0 := Mix(c00, c10, u.Y)
+	c1 := Mix(c01, c11, u.Y)
+	return Mix(c0, c1, u.Z) + p.Sub(q).Length()
+}
+
+// sampleGrid samples an SDF3 on a grid one x layer at a time.
+// The samples of each layer are passed to the put function.
+func sampleGrid(s SDF3, bb Box3, inc V3, steps V3i, put func(x int, layer []float64)) {
+	s = Compile3D(s)
+	l := newLayerYZ(bb.Min, inc, steps)
+	defer l.release()
+	for x := 0; x <= steps[0]; x++ {
+		l.Evaluate(s, x)
+		put(x, l.val1)
+	}
+}
+
+// NewGrid3 samples an SDF3 on a grid with meshCells cells on the longest
+// axis and stores the samples in a file at path.
+// The file is created (or truncated) and is not removed by Close().
+func NewGrid3(s SDF3, meshCells int, path string) (*Grid3, error) {
+	if meshCells <= 0 {
+		return nil, errors.New("meshCells must be > 0")
+	}
+	// work out the region we will sample
+	g := Grid3{}
+	g.bb, g.inc, g.steps = gridSize(s, meshCells)
+	steps := g.steps
+
+	// size of the backing file
+	n := int64(steps[0]+1) * int64(steps[1]+1) * int64(steps[2]+1) * 4
+	if n != int64(int(n)) {
+		return nil, fmt.Errorf("grid size %d bytes is too large", n)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Truncate(n); err != nil {
+		f.Close()
+		return nil, err
+	}
+	g.data, err = mmapFile(f, int(n))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	g.f = f
+
+	// sample the SDF one x layer at a time
+	n = int64(steps[1]+1) * int64(steps[2]+1)
+	sampleGrid(s, g.bb, g.inc, steps, func(x int, layer []float64) {
+		b := g.data[4*int64(x)*n:]
+		for i, d := range layer {
+			binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(float32(d)))
+		}
+	})
+	return &g, nil
+}
+
+// Close unmaps the grid and closes the backing file.
+func (g *Grid3) Close() error {
+	err := munmapFile(g.f, g.data)
+	g.data = nil
+	if err1 := g.f.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+// Get returns the sample at the x,y,z grid position.
+func (g *Grid3) Get(x, y, z int) float64 {
+	idx := (x*(g.steps[1]+1)+y)*(g.steps[2]+1) + z
+	return float64(math.Float32frombits(binary.LittleEndian.Uint32(g.data[4*idx:])))
+}
+
+// Evaluate returns the interpolated distance to the sampled SDF3.
+func (g *Grid3) Evaluate(p V3) float64 {
+	return gridEvaluate(p, g.bb, g.inc, g.steps, g.Get)
+}
+
+// BoundingBox returns the bounding box of the grid.
+func (g *Grid3) BoundingBox() Box3 {
+	return g.bb
+}
+
+//-----------------------------------------------------------------------------
+
+// marchingCubesGrid generates a triangle mesh from the grid samples.
+func marchingCubesGrid(g *Grid3, output chan<- *Triangle3) {
+	nx, ny, nz := g.steps[0], g.steps[1], g.steps[2]
+	dx, dy, dz := g.inc.X, g.inc.Y, g.inc.Z
+	base := g.bb.Min
+
+	var p V3
+	p.X = base.X
+	for x := 0; x < nx; x++ {
+		p.Y = base.Y
+		for y := 0; y < ny; y++ {
+			p.Z = base.Z
+			for z := 0; z < nz; z++ {
+				x0, y0, z0 := p.X, p.Y, p.Z
+				x1, y1, z1 := x0+dx, y0+dy, z0+dz
+				corners := [8]V3{
+					{x0, y0, z0},
+					{x1, y0, z0},
+					{x1, y1, z0},
+					{x0, y1, z0},
+					{x0, y0, z1},
+					{x1, y0, z1},
+					{x1, y1, z1},
+					{x0, y1, z1}}
+				values := [8]float64{
+					g.Get(x, y, z),
+					g.Get(x+1, y, z),
+					g.Get(x+1, y+1, z),
+					g.Get(x, y+1, z),
+					g.Get(x, y, z+1),
+					g.Get(x+1, y, z+1),
+					g.Get(x+1, y+1, z+1),
+					g.Get(x, y+1, z+1)}
+				for _, t := range mcToTriangles(corners, values, 0) {
+					output <- t
+				}
+				p.Z += dz
+			}
+			p.Y += dy
+		}
+		p.X += dx
+	}
+}
+
+// RenderSTLGrid renders an SDF3 as an STL file via a memory mapped sample grid.
+// Use this for resolutions where the samples will not fit in memory.
+// The grid file is removed after rendering.
+// The optional hooks are called for each triangle before it is written.
+func RenderSTLGrid(
+	s SDF3, //sdf3 to render
+	meshCells int, //number of cells on the longest axis. e.g 2000
+	path string, //path to filename
+	gridPath string, //path to the temporary grid file
+	hooks ...TriangleHook, //triangle hooks
+) error {
+	g, err := NewGrid3(s, meshCells, gridPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(gridPath)
+	defer g.Close()
+
+	fmt.Printf("rendering %s (%dx%dx%d)\n", path, g.steps[0], g.steps[1], g.steps[2])
+
+	// write the triangles to an STL file
+	var wg sync.WaitGroup
+	output, err := WriteSTL(&wg, path)
+	if err != nil {
+		return err
+	}
+	// run the hooks on the triangles before writing them
+	hooked := hookTriangles(output, hooks)
+	// check the triangle orientation before the hooks
+	input, orientation := checkTriangles(g, hooked, RenderOrient)
+	// run marching cubes on the grid
+	marchingCubesGrid(g, input)
+	close(input)
+	(<-orientation).report()
+	// stop the STL writer reading on the channel
+	close(hooked)
+	// wait for the file write to complete
+	wg.Wait()
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// voxelMagic identifies a voxel file.
+const voxelMagic = "SDFXVOX1"
+
+// maxVoxelSteps is the maximum number of cells on an axis of a voxel file.
+const maxVoxelSteps = 4096
+
+// maxVoxelSamples is the maximum number of samples in a voxel file (4GiB).
+const maxVoxelSamples = 1 << 30
+
+// voxelChunk is the number of samples read at a time from a voxel file.
+const voxelChunk = 1 << 20
+
+// VoxelSDF3 is an SDF3 sampled on a dense grid (held in memory).
+type VoxelSDF3 struct {
+	bb    Box3      // bounding box of the grid
+	inc   V3        // dx, dy, dz for each step
+	steps V3i       // number of x,y,z cells (samples = steps + 1)
+	data  []float32 // samples (x-major)
+}
+
+// Voxel3D samples an SDF3 on a grid with meshCells cells on the longest axis.
+func Voxel3D(s SDF3, meshCells int) *VoxelSDF3 {
+	if meshCells <= 0 {
+		panic("meshCells <= 0")
+	}
+	v := VoxelSDF3{}
+	v.bb, v.inc, v.steps = gridSize(s, meshCells)
+	n := (v.steps[1] + 1) * (v.steps[2] + 1)
+	v.data = make([]float32, (v.steps[0]+1)*n)
+	sampleGrid(s, v.bb, v.inc, v.steps, func(x int, layer []float64) {
+		for i, d := range layer {
+			v.data[x*n+i] = float32(d)
+		}
+	})
+	return &v
+}
+
+// get returns the sample at the x,y,z grid position.
+func (v *VoxelSDF3) get(x, y, z int) float64 {
+	return float64(v.data[(x*(v.steps[1]+1)+y)*(v.steps[2]+1)+z])
+}
+
+// Evaluate returns the interpolated distance to the sampled SDF3.
+func (v *VoxelSDF3) Evaluate(p V3) float64 {
+	return gridEvaluate(p, v.bb, v.inc, v.steps, v.get)
+}
+
+// BoundingBox returns the bounding box of the grid.
+func (v *VoxelSDF3) BoundingBox() Box3 {
+	return v.bb
+}
+
+// voxelHeader is the header of a voxel file.
+type voxelHeader struct {
+	Magic    [8]byte
+	Min, Max [3]float64 // grid bounding box
+	Steps    [3]int32   // number of x,y,z cells
+}
+
+// Encode writes the voxels to a writer.
+func (v *VoxelSDF3) Encode(w io.Writer) error {
+	buf := bufio.NewWriter(w)
+	hdr := voxelHeader{
+		Min:   [3]float64{v.bb.Min.X, v.bb.Min.Y, v.bb.Min.Z},
+		Max:   [3]float64{v.bb.Max.X, v.bb.Max.Y, v.bb.Max.Z},
+		Steps: [3]int32{int32(v.steps[0]), int32(v.steps[1]), int32(v.steps[2])},
+	}
+	copy(hdr.Magic[:], voxelMagic)
+	if err := binary.Write(buf, binary.LittleEndian, &hdr); err != nil {
+		return err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, v.data); err != nil {
+		return err
+	}
+	return buf.Flush()
+}
+
+// remaining returns the number of bytes left in a reader (-1 if unknown).
+func remaining(r io.Reader) int64 {
+	switch r := r.(type) {
+	case interface{ Len() int }:
+		return int64(r.Len())
+	case io.Seeker:
+		cur, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+		end, err := r.Seek(0, io.SeekEnd)
+		if err != nil {
+			return -1
+		}
+		if _, err := r.Seek(cur, io.SeekStart); err != nil {
+			return -1
+		}
+		return end - cur
+	}
+	return -1
+}
+
+// DecodeVoxel3D reads voxels from a reader.
+// The grid size in the header is checked against the size of the input (when it is known)
+// and the samples are read in chunks, so a bad header can't cause a huge allocation.
+func DecodeVoxel3D(r io.Reader) (*VoxelSDF3, error) {
+	size := remaining(r)
+	buf := bufio.NewReader(r)
+	var hdr voxelHeader
+	if err := binary.Read(buf, binary.LittleEndian, &hdr); err != nil {
+		return nil, err
+	}
+	if string(hdr.Magic[:]) != voxelMagic {
+		return nil, errors.New("not a voxel file")
+	}
+	v := VoxelSDF3{}
+	v.bb = Box3{V3{hdr.Min[0], hdr.Min[1], hdr.Min[2]}, V3{hdr.Max[0], hdr.Max[1], hdr.Max[2]}}
+	for i := range hdr.Min {
+		lo, hi := hdr.Min[i], hdr.Max[i]
+		if math.IsNaN(lo) || math.IsNaN(hi) || math.IsInf(lo, 0) || math.IsInf(hi, 0) || hi-lo <= 0 || math.IsInf(hi-lo, 0) {
+			return nil, errors.New("bad voxel bounding box")
+		}
+	}
+	v.steps = V3i{int(hdr.Steps[0]), int(hdr.Steps[1]), int(hdr.Steps[2])}
+	for _, n := range v.steps {
+		if n <= 0 || n > maxVoxelSteps {
+			return nil, errors.New("bad voxel grid size")
+		}
+	}
+	n := int64(v.steps[0]+1) * int64(v.steps[1]+1) * int64(v.steps[2]+1)
+	if n > maxVoxelSamples {
+		return nil, errors.New("voxel grid too large")
+	}
+	if size >= 0 && size-int64(binary.Size(&hdr)) < 4*n {
+		return nil, errors.New("voxel file is truncated")
+	}
+	v.inc = v.bb.Size().Div(v.steps.ToV3())
+	// grow the data as it is read
+	for int64(len(v.data)) < n {
+		k := int(Min(float64(n-int64(len(v.data))), voxelChunk))
+		chunk := make([]float32, k)
+		if err := binary.Read(buf, binary.LittleEndian, chunk); err != nil {
+			return nil, err
+		}
+		v.data = append(v.data, chunk...)
+	}
+	return &v, nil
+}
+
+// SaveVoxel3D writes voxels to a file.
+func SaveVoxel3D(path string, v *VoxelSDF3) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := v.Encode(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadVoxel3D reads voxels from a file.
+func LoadVoxel3D(path string) (*VoxelSDF3, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return DecodeVoxel3D(f)
+}
+
+//-----------------------------------------------------------------------------
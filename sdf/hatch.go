@@ -0,0 +1,155 @@
+//-----------------------------------------------------------------------------
+/*
+
+Section Hatching
+
+Generate hatch lines clipped to the inside of an SDF2 (e.g. a section
+through an SDF3 from Slice2D). The section outline and hatching can be
+written to DXF/SVG files for engineering drawings.
+
+Hatch styles (ANSI Y14.2):
+
+ANSI31: single lines (iron, general use, ISO 128 general section)
+ANSI32: pairs of lines (steel)
+ANSI37: cross hatch (lead, rubber, electrical insulation)
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// HatchStyle is the hatch pattern style.
+type HatchStyle int
+
+// Hatch styles.
+const (
+	HatchANSI31 HatchStyle = iota // single lines
+	HatchANSI32                   // pairs of lines
+	HatchANSI37                   // cross hatch
+)
+
+// HatchParms defines the parameters for section hatching.
+type HatchParms struct {
+	Style   HatchStyle // hatch pattern style
+	Angle   float64    // hatch line angle (radians), typically 45 degrees
+	Spacing float64    // distance between hatch lines (or line pairs)
+}
+
+//-----------------------------------------------------------------------------
+
+// clipLine returns the segments of a line that are inside an SDF2.
+// The line starts at p and goes in direction u (normalized) for length l.
+func clipLine(s SDF2, p, u V2, l, minStep float64) []*Line {
+	at := func(t float64) V2 { return p.Add(u.MulScalar(t)) }
+	// boundary returns the boundary crossing between t0 and t1.
+	boundary := func(t0, t1 float64, inside bool) float64 {
+		for i := 0; i < 30; i++ {
+			t := 0.5 * (t0 + t1)
+			if (s.Evaluate(at(t)) < 0) == inside {
+				t0 = t
+			} else {
+				t1 = t
+			}
+		}
+		return 0.5 * (t0 + t1)
+	}
+	var lines []*Line
+	t := 0.0
+	d := s.Evaluate(at(t))
+	inside := d < 0
+	start := t
+	for t < l {
+		tNext := math.Min(t+math.Max(Abs(d), minStep), l)
+		d = s.Evaluate(at(tNext))
+		if (d < 0) != inside {
+			tb := boundary(t, tNext, inside)
+			if inside {
+				lines = append(lines, &Line{at(start), at(tb)})
+			} else {
+				start = tb
+			}
+			inside = !inside
+		}
+		t = tNext
+	}
+	if inside {
+		lines = append(lines, &Line{at(start), at(l)})
+	}
+	return lines
+}
+
+// hatchLines returns a family of parallel lines (at angle theta, with the given
+// offsets within each spacing period) clipped to the inside of an SDF2.
+func hatchLines(s SDF2, theta, spacing float64, offsets []float64) []*Line {
+	u := V2{math.Cos(theta), math.Sin(theta)}
+	n := V2{-u.Y, u.X}
+	// the range of the lines (along n) and the line length (along u)
+	umin, umax := math.MaxFloat64, -math.MaxFloat64
+	nmin, nmax := math.MaxFloat64, -math.MaxFloat64
+	for _, v := range s.BoundingBox().Vertices() {
+		umin, umax = Min(umin, v.Dot(u)), Max(umax, v.Dot(u))
+		nmin, nmax = Min(nmin, v.Dot(n)), Max(nmax, v.Dot(n))
+	}
+	minStep := 0.01 * spacing
+	var lines []*Line
+	// the lines are aligned to the origin, so adjacent sections match
+	for k := math.Floor(nmin / spacing); k*spacing <= nmax; k++ {
+		for _, ofs := range offsets {
+			o := k*spacing + ofs
+			if o < nmin || o > nmax {
+				continue
+			}
+			p := n.MulScalar(o).Add(u.MulScalar(umin))
+			lines = append(lines, clipLine(s, p, u, umax-umin, minStep)...)
+		}
+	}
+	return lines
+}
+
+// Hatch2D returns the hatch lines for the inside of an SDF2.
+func Hatch2D(s SDF2, k *HatchParms) []*Line {
+	if k.Spacing <= 0 {
+		panic("Spacing <= 0")
+	}
+	switch k.Style {
+	case HatchANSI31:
+		return hatchLines(s, k.Angle, k.Spacing, []float64{0})
+	case HatchANSI32:
+		return hatchLines(s, k.Angle, k.Spacing, []float64{0, 0.25 * k.Spacing})
+	case HatchANSI37:
+		lines := hatchLines(s, k.Angle, k.Spacing, []float64{0})
+		return append(lines, hatchLines(s, k.Angle+0.5*Pi, k.Spacing, []float64{0})...)
+	}
+	panic("unknown hatch style")
+}
+
+//-----------------------------------------------------------------------------
+
+// RenderHatchedDXF renders an SDF2 section (outline and hatching) as a DXF file.
+func RenderHatchedDXF(
+	s SDF2, //sdf2 to render
+	meshCells int, //number of cells on the longest axis. e.g 200
+	path string, //path to filename
+	k *HatchParms, //hatching parameters
+) error {
+	lines := append(GenerateLines(s, meshCells), Hatch2D(s, k)...)
+	return SaveDXF(path, lines)
+}
+
+// RenderHatchedSVG renders an SDF2 section (outline and hatching) as an SVG file.
+func RenderHatchedSVG(
+	s SDF2, // sdf2 to render
+	meshCells int, // number of cells on the longest axis. e.g 200
+	path string, // path to filename
+	lineStyle string, // SVG line style
+	k *HatchParms, // hatching parameters
+) error {
+	lines := append(GenerateLines(s, meshCells), Hatch2D(s, k)...)
+	return SaveSVG(path, lineStyle, lines)
+}
+
+//-----------------------------------------------------------------------------
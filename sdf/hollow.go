@@ -0,0 +1,126 @@
+//-----------------------------------------------------------------------------
+/*
+
+Hollowing
+
+Hollow out an SDF3 leaving a wall of constant thickness.
+
+For resin (SLA) printing an enclosed cavity traps uncured resin, so each
+cavity needs a drain hole. The cavities are found with a connected
+component analysis of the hollowed volume. A drain hole is drilled (in the
+-z direction) at the lowest point of each cavity. A vent hole can also be
+drilled (in the +z direction) at the highest point of each cavity.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "errors"
+
+//-----------------------------------------------------------------------------
+
+// DrainParms defines the drain holes for a hollowed SDF3.
+type DrainParms struct {
+	Radius    float64 // drain hole radius (0 == no drain holes)
+	Vent      bool    // add a vent hole at the top of each cavity
+	MeshCells int     // number of voxels on the longest axis for the cavity search
+}
+
+//-----------------------------------------------------------------------------
+
+// extremeVoxels returns the lowest and highest voxels of each component.
+// Of the voxels at the same height the one nearest the center (x,y) of the
+// component is used.
+func (g *voxelGrid) extremeVoxels(comps []Component3) ([]V3i, []V3i) {
+	n := len(comps)
+	lo := make([]V3i, n)
+	hi := make([]V3i, n)
+	found := make([]bool, n)
+	// distance (x,y) from the component center
+	dist := func(v V3i, l int) float64 {
+		d := g.center(v).Sub(comps[l].BoundingBox.Center())
+		return V2{d.X, d.Y}.Length()
+	}
+	var v V3i
+	for v[0] = 0; v[0] < g.steps[0]; v[0]++ {
+		for v[1] = 0; v[1] < g.steps[1]; v[1]++ {
+			for v[2] = 0; v[2] < g.steps[2]; v[2]++ {
+				l := g.label[g.index(v)]
+				if l < 0 {
+					continue
+				}
+				if !found[l] {
+					lo[l], hi[l], found[l] = v, v, true
+					continue
+				}
+				if v[2] < lo[l][2] || (v[2] == lo[l][2] && dist(v, l) < dist(lo[l], l)) {
+					lo[l] = v
+				}
+				if v[2] > hi[l][2] || (v[2] == hi[l][2] && dist(v, l) < dist(hi[l], l)) {
+					hi[l] = v
+				}
+			}
+		}
+	}
+	return lo, hi
+}
+
+// drainHole returns a hole from a cavity surface point through the wall.
+// The hole goes in the -z (dir < 0) or +z (dir > 0) direction.
+func drainHole(p V3, radius, wall, dir float64) SDF3 {
+	// start within the cavity and go through the wall (with margin)
+	l := radius + 2*wall
+	hole := Cylinder3D(l, radius, 0)
+	z := p.Z + dir*(0.5*l-radius)
+	return Transform3D(hole, Translate3d(V3{p.X, p.Y, z}))
+}
+
+//-----------------------------------------------------------------------------
+
+// Hollow3D hollows out an SDF3 leaving a wall of the given thickness.
+// If k.Radius > 0 drain holes are added at the lowest point of each
+// enclosed cavity. The build direction is +z.
+func Hollow3D(s SDF3, wall float64, k *DrainParms) (SDF3, error) {
+	if wall <= 0 {
+		return nil, errors.New("wall <= 0")
+	}
+	cavity := Offset3D(s, -wall)
+	size := cavity.BoundingBox().Size()
+	if size.X <= 0 || size.Y <= 0 || size.Z <= 0 {
+		return nil, errors.New("wall is too thick")
+	}
+	hollow := Difference3D(s, cavity)
+	if k == nil || k.Radius <= 0 {
+		return hollow, nil
+	}
+	if k.MeshCells <= 0 {
+		return nil, errors.New("MeshCells <= 0")
+	}
+
+	// find the cavities
+	g := newVoxelGrid(cavity, k.MeshCells)
+	g.scan()
+	comps := g.components()
+	lo, hi := g.extremeVoxels(comps)
+
+	// drill the holes
+	dz := V3{0, 0, g.inc.Z}
+	var holes []SDF3
+	for i := range comps {
+		p := g.inside[g.index(lo[i])]
+		p = g.surface(p, g.center(lo[i]).Sub(dz))
+		holes = append(holes, drainHole(p, k.Radius, wall, -1))
+		if k.Vent {
+			p := g.inside[g.index(hi[i])]
+			p = g.surface(p, g.center(hi[i]).Add(dz))
+			holes = append(holes, drainHole(p, k.Radius, wall, 1))
+		}
+	}
+	if len(holes) == 0 {
+		return hollow, nil
+	}
+	return Difference3D(hollow, Union3D(holes...)), nil
+}
+
+//-----------------------------------------------------------------------------
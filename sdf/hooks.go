@@ -0,0 +1,109 @@
+//-----------------------------------------------------------------------------
+/*
+
+Triangle Hooks
+
+Hooks are called for each triangle as it is passed from the mesher to the
+STL writer. A hook can modify the triangle (e.g. scale the units or set a
+color) or drop it (e.g. to export a region of the mesh). The triangles are
+streamed through the hooks, the mesh is not buffered.
+
+The hooks are called in order, after the triangle orientation has been
+checked (and fixed) against the SDF3 and before the triangle is written.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+//-----------------------------------------------------------------------------
+
+// TriangleHook is called for each triangle before it is written.
+// It may modify the triangle. It returns false to drop the triangle.
+type TriangleHook func(t *Triangle3) bool
+
+// runHooks runs the hooks on a triangle. It returns false if the triangle is dropped.
+func runHooks(t *Triangle3, hooks []TriangleHook) bool {
+	for _, h := range hooks {
+		if !h(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// hookTriangles returns a channel that runs the hooks on the triangles
+// written to it and passes them to the output channel. Closing the returned
+// channel closes the output channel.
+func hookTriangles(output chan<- *Triangle3, hooks []TriangleHook) chan<- *Triangle3 {
+	if len(hooks) == 0 {
+		return output
+	}
+	input := make(chan *Triangle3)
+	go func() {
+		for t := range input {
+			if runHooks(t, hooks) {
+				output <- t
+			}
+		}
+		close(output)
+	}()
+	return input
+}
+
+// HookMesh runs the hooks on the triangles of a mesh.
+// It returns the triangles that were not dropped.
+func HookMesh(mesh []*Triangle3, hooks ...TriangleHook) []*Triangle3 {
+	var out []*Triangle3
+	for _, t := range mesh {
+		if runHooks(t, hooks) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+//-----------------------------------------------------------------------------
+// Common Hooks
+
+// ScaleHook returns a hook that scales the triangles (e.g. to change units).
+func ScaleHook(k float64) TriangleHook {
+	return func(t *Triangle3) bool {
+		for i := range t.V {
+			t.V[i] = t.V[i].MulScalar(k)
+		}
+		return true
+	}
+}
+
+// RegionHook returns a hook that drops the triangles with a center outside of a box.
+func RegionHook(b Box3) TriangleHook {
+	return func(t *Triangle3) bool {
+		c := t.V[0].Add(t.V[1]).Add(t.V[2]).DivScalar(3)
+		return c.X >= b.Min.X && c.Y >= b.Min.Y && c.Z >= b.Min.Z &&
+			c.X <= b.Max.X && c.Y <= b.Max.Y && c.Z <= b.Max.Z
+	}
+}
+
+// ColorHook returns a hook that sets the color of each triangle.
+// The color function returns the r,g,b color (0..1) for the triangle center.
+// The color is stored in the STL attribute (VisCAM/SolidView 15-bit color).
+func ColorHook(color func(p V3) V3) TriangleHook {
+	return func(t *Triangle3) bool {
+		c := t.V[0].Add(t.V[1]).Add(t.V[2]).DivScalar(3)
+		t.Attribute = STLColor(color(c))
+		return true
+	}
+}
+
+// STLColor returns the STL attribute for an r,g,b color (0..1).
+func STLColor(c V3) uint16 {
+	c = c.Clamp(V3{0, 0, 0}, V3{1, 1, 1}).MulScalar(31)
+	r := uint16(c.X + 0.5)
+	g := uint16(c.Y + 0.5)
+	b := uint16(c.Z + 0.5)
+	// bit 15 == 1: the color is valid
+	return 1<<15 | r<<10 | g<<5 | b
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,322 @@
+//-----------------------------------------------------------------------------
+/*
+
+Image Importers
+
+Heightmap: gray scale pixel values are heights (e.g. terrain, lithophanes).
+
+Bitmap: dark pixels are inside an SDF2 (e.g. logos, scanned outlines). The
+distance field is found with a two pass Euclidean distance transform. See:
+Felzenszwalb & Huttenlocher, "Distance Transforms of Sampled Functions"
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+)
+
+//-----------------------------------------------------------------------------
+
+// grayPixels returns the gray scale values (0..1) of the image pixels (x-major).
+func grayPixels(img image.Image) ([]float64, V2i) {
+	r := img.Bounds()
+	n := V2i{r.Dx(), r.Dy()}
+	g := make([]float64, n[0]*n[1])
+	for i := 0; i < n[0]; i++ {
+		for j := 0; j < n[1]; j++ {
+			c := color.Gray16Model.Convert(img.At(r.Min.X+i, r.Min.Y+j)).(color.Gray16)
+			g[i*n[1]+j] = float64(c.Y) / 0xffff
+		}
+	}
+	return g, n
+}
+
+//-----------------------------------------------------------------------------
+// Heightmap
+
+// HeightmapSDF3 is a solid with a top surface defined by an image.
+type HeightmapSDF3 struct {
+	h      []float64 // heights at the pixel centers (x-major)
+	pixels V2i       // number of x,y pixels
+	size   V3        // size of the solid
+	inc    V2        // pixel size
+	k      float64   // lipschitz scaling for the height distance
+	bb     Box3
+}
+
+// Heightmap3D returns an SDF3 for a heightmap (e.g. terrain or a lithophane).
+// The gray scale value of each pixel (black = 0, white = 1) gives the height.
+// The solid is centered on the xy origin with its base on z = 0. It has a
+// flat slab of base thickness below the heights, so the total height is size.Z.
+// Heights are interpolated between pixel centers.
+func Heightmap3D(img image.Image, size V3, base float64) SDF3 {
+	if size.X <= 0 || size.Y <= 0 || size.Z <= 0 {
+		panic("size <= 0")
+	}
+	if base < 0 || base > size.Z {
+		panic("bad base thickness")
+	}
+	g, pixels := grayPixels(img)
+	if pixels[0] == 0 || pixels[1] == 0 {
+		panic("empty image")
+	}
+	s := HeightmapSDF3{}
+	s.pixels = pixels
+	s.size = size
+	s.inc = V2{size.X / float64(pixels[0]), size.Y / float64(pixels[1])}
+	s.h = make([]float64, len(g))
+	for i := range g {
+		s.h[i] = base + g[i]*(size.Z-base)
+	}
+	// The maximum slope of the interpolated surface gives a lipschitz
+	// bound for the height distance.
+	var lx, ly float64
+	for i := 0; i < pixels[0]; i++ {
+		for j := 0; j < pixels[1]; j++ {
+			h := s.h[i*pixels[1]+j]
+			if i+1 < pixels[0] {
+				lx = Max(lx, Abs(s.h[(i+1)*pixels[1]+j]-h))
+			}
+			if j+1 < pixels[1] {
+				ly = Max(ly, Abs(s.h[i*pixels[1]+j+1]-h))
+			}
+		}
+	}
+	l := V2{lx / s.inc.X, ly / s.inc.Y}.Length()
+	s.k = 1 / math.Sqrt(1+l*l)
+	s.bb = Box3{V3{-size.X / 2, -size.Y / 2, 0}, V3{size.X / 2, size.Y / 2, size.Z}}
+	return &s
+}
+
+// height returns the interpolated height at x,y.
+func (s *HeightmapSDF3) height(x, y float64) float64 {
+	// pixel coordinates (the image y-axis is down)
+	u := Clamp((x+s.size.X/2)/s.inc.X-0.5, 0, float64(s.pixels[0]-1))
+	v := Clamp((s.size.Y/2-y)/s.inc.Y-0.5, 0, float64(s.pixels[1]-1))
+	i0, j0 := int(u), int(v)
+	i1, j1 := i0+1, j0+1
+	if i1 == s.pixels[0] {
+		i1 = i0
+	}
+	if j1 == s.pixels[1] {
+		j1 = j0
+	}
+	at := func(i, j int) float64 {
+		return s.h[i*s.pixels[1]+j]
+	}
+	// bilinear interpolation
+	fu := u - float64(i0)
+	fv := v - float64(j0)
+	h0 := Mix(at(i0, j0), at(i1, j0), fu)
+	h1 := Mix(at(i0, j1), at(i1, j1), fu)
+	return Mix(h0, h1, fv)
+}
+
+// Evaluate returns the minimum distance to a heightmap.
+func (s *HeightmapSDF3) Evaluate(p V3) float64 {
+	c := s.bb.Center()
+	d := sdfBox3d(p.Sub(c), s.bb.Size().MulScalar(0.5))
+	return Max(d, (p.Z-s.height(p.X, p.Y))*s.k)
+}
+
+// BoundingBox returns the bounding box for a heightmap.
+func (s *HeightmapSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+// Bitmap
+
+// edtInf is the (finite) infinity used for the distance transform.
+const edtInf = 1e20
+
+// edt1d does a 1D squared euclidean distance transform of f.
+// v and z are work areas of len(f) and len(f)+1.
+func edt1d(f []float64, d []float64, v []int, z []float64) {
+	n := len(f)
+	// the lower envelope of the parabolas
+	k := 0
+	v[0] = 0
+	z[0] = math.Inf(-1)
+	z[1] = math.Inf(1)
+	for q := 1; q < n; q++ {
+		var s float64
+		for {
+			r := v[k]
+			s = ((f[q] + float64(q*q)) - (f[r] + float64(r*r))) / float64(2*q-2*r)
+			if s > z[k] {
+				break
+			}
+			k--
+		}
+		k++
+		v[k] = q
+		z[k] = s
+		z[k+1] = math.Inf(1)
+	}
+	// fill in the distances
+	k = 0
+	for q := 0; q < n; q++ {
+		for z[k+1] < float64(q) {
+			k++
+		}
+		r := v[k]
+		d[q] = float64((q-r)*(q-r)) + f[r]
+	}
+}
+
+// edt2d returns the squared euclidean distance (in pixels) to the nearest
+// feature pixel for a grid of nx by ny pixels (x-major).
+func edt2d(feature []bool, nx, ny int) []float64 {
+	m := nx
+	if ny > m {
+		m = ny
+	}
+	f := make([]float64, m)
+	d := make([]float64, m)
+	v := make([]int, m)
+	z := make([]float64, m+1)
+	out := make([]float64, nx*ny)
+	for i := range out {
+		if feature[i] {
+			out[i] = 0
+		} else {
+			out[i] = edtInf
+		}
+	}
+	// columns (y)
+	for i := 0; i < nx; i++ {
+		copy(f[:ny], out[i*ny:(i+1)*ny])
+		edt1d(f[:ny], d[:ny], v, z)
+		copy(out[i*ny:(i+1)*ny], d[:ny])
+	}
+	// rows (x)
+	for j := 0; j < ny; j++ {
+		for i := 0; i < nx; i++ {
+			f[i] = out[i*ny+j]
+		}
+		edt1d(f[:nx], d[:nx], v, z)
+		for i := 0; i < nx; i++ {
+			out[i*ny+j] = d[i]
+		}
+	}
+	return out
+}
+
+// BitmapSDF2 is an SDF2 made from the dark pixels of an image.
+type BitmapSDF2 struct {
+	d      []float64 // signed distance at the pixel centers (x-major)
+	pixels V2i       // number of x,y samples
+	base   V2        // position of sample 0,0
+	inc    V2        // pixel size
+	bb     Box2
+}
+
+// Bitmap2D returns an SDF2 for the dark pixels (gray < 0.5) of an image.
+// The image is centered on the origin and scaled to the given size.
+func Bitmap2D(img image.Image, size V2) SDF2 {
+	if size.X <= 0 || size.Y <= 0 {
+		panic("size <= 0")
+	}
+	g, n := grayPixels(img)
+	if n[0] == 0 || n[1] == 0 {
+		panic("empty image")
+	}
+	// pad the image with a border of outside pixels
+	nx, ny := n[0]+2, n[1]+2
+	inside := make([]bool, nx*ny)
+	outside := make([]bool, nx*ny)
+	for i := 0; i < nx; i++ {
+		for j := 0; j < ny; j++ {
+			k := i*ny + j
+			if i > 0 && j > 0 && i <= n[0] && j <= n[1] && g[(i-1)*n[1]+(j-1)] < 0.5 {
+				inside[k] = true
+			} else {
+				outside[k] = true
+			}
+		}
+	}
+	dIn := edt2d(inside, nx, ny)
+	dOut := edt2d(outside, nx, ny)
+
+	s := BitmapSDF2{}
+	s.pixels = V2i{nx, ny}
+	s.inc = V2{size.X / float64(n[0]), size.Y / float64(n[1])}
+	// The boundary is half a pixel from the pixel centers.
+	// Non-square pixels are approximated with the mean pixel size.
+	k := 0.5 * (s.inc.X + s.inc.Y)
+	s.d = make([]float64, nx*ny)
+	for i := range s.d {
+		if inside[i] {
+			s.d[i] = -(math.Sqrt(dOut[i]) - 0.5) * k
+		} else {
+			s.d[i] = (math.Sqrt(dIn[i]) - 0.5) * k
+		}
+	}
+	// pixel 0,0 of the image is top left, the padding is one pixel
+	s.base = V2{-size.X/2 - 0.5*s.inc.X, size.Y/2 + 0.5*s.inc.Y}
+	s.bb = Box2{size.MulScalar(-0.5), size.MulScalar(0.5)}
+	return &s
+}
+
+// LoadBitmap2D returns an SDF2 for the dark pixels of a PNG file.
+func LoadBitmap2D(path string, size V2) (SDF2, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	return Bitmap2D(img, size), nil
+}
+
+// Evaluate returns the minimum distance to a bitmap.
+func (s *BitmapSDF2) Evaluate(p V2) float64 {
+	// pixel coordinates (the image y-axis is down)
+	u := (p.X - s.base.X) / s.inc.X
+	v := (s.base.Y - p.Y) / s.inc.Y
+	uc := Clamp(u, 0, float64(s.pixels[0]-1))
+	vc := Clamp(v, 0, float64(s.pixels[1]-1))
+	// distance to the sampled region
+	ofs := V2{(u - uc) * s.inc.X, (v - vc) * s.inc.Y}.Length()
+	i0, j0 := int(uc), int(vc)
+	i1, j1 := i0+1, j0+1
+	if i1 == s.pixels[0] {
+		i1 = i0
+	}
+	if j1 == s.pixels[1] {
+		j1 = j0
+	}
+	at := func(i, j int) float64 {
+		return s.d[i*s.pixels[1]+j]
+	}
+	// bilinear interpolation
+	fu := uc - float64(i0)
+	fv := vc - float64(j0)
+	d0 := Mix(at(i0, j0), at(i1, j0), fu)
+	d1 := Mix(at(i0, j1), at(i1, j1), fu)
+	d := Mix(d0, d1, fv)
+	if ofs > 0 {
+		// The clamped point is on the (outside) padding and the image is
+		// in the direction away from p, so this is a lower bound.
+		return V2{ofs, d}.Length()
+	}
+	return d
+}
+
+// BoundingBox returns the bounding box for a bitmap.
+func (s *BitmapSDF2) BoundingBox() Box2 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,317 @@
+//-----------------------------------------------------------------------------
+/*
+
+Interval Evaluation
+
+Evaluate an SDF3 over a box to give the range of distances within the box.
+The range is conservative (it contains all the distances in the box) but
+may be wider than the true range. If the range doesn't include 0 the box
+is completely inside or outside of the object, so hierarchical meshers can
+skip it without sampling.
+
+An SDF3 provides interval evaluation by implementing IntervalSDF3. Otherwise
+the range is found from the distance at the box center and the half diagonal
+of the box times the Lipschitz bound of the SDF3 (see lipschitz.go).
+
+The min/max blending functions (see SetMin/SetMax) are assumed to be
+monotonic in each argument.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// Interval is a range of values.
+type Interval struct {
+	Min, Max float64
+}
+
+// Contains returns true if the interval contains x.
+func (a Interval) Contains(x float64) bool {
+	return a.Min <= x && x <= a.Max
+}
+
+// Neg returns the negated interval.
+func (a Interval) Neg() Interval {
+	return Interval{-a.Max, -a.Min}
+}
+
+// AddScalar adds a scalar to an interval.
+func (a Interval) AddScalar(b float64) Interval {
+	return Interval{a.Min + b, a.Max + b}
+}
+
+// MulScalar multiplies an interval by a scalar.
+func (a Interval) MulScalar(b float64) Interval {
+	if b < 0 {
+		return Interval{a.Max * b, a.Min * b}
+	}
+	return Interval{a.Min * b, a.Max * b}
+}
+
+// absInterval returns the range of |x| for x in [lo, hi].
+func absInterval(lo, hi float64) Interval {
+	if lo <= 0 && hi >= 0 {
+		return Interval{0, Max(-lo, hi)}
+	}
+	return Interval{Min(Abs(lo), Abs(hi)), Max(Abs(lo), Abs(hi))}
+}
+
+// monotonic returns the range of a function that is monotonic (non-decreasing) in each argument.
+func monotonic(f func(a, b float64) float64, a, b Interval) Interval {
+	return Interval{f(a.Min, b.Min), f(a.Max, b.Max)}
+}
+
+//-----------------------------------------------------------------------------
+
+// IntervalSDF3 is implemented by SDF3s with interval evaluation.
+type IntervalSDF3 interface {
+	EvaluateInterval(b Box3) Interval
+}
+
+// EvaluateInterval3 returns the range of distances of an SDF3 within a box.
+func EvaluateInterval3(s SDF3, b Box3) Interval {
+	if i, ok := s.(IntervalSDF3); ok {
+		return i.EvaluateInterval(b)
+	}
+	d := s.Evaluate(b.Center())
+	h := 0.5 * b.Size().Length() * LipschitzK3(s)
+	return Interval{d - h, d + h}
+}
+
+//-----------------------------------------------------------------------------
+// Primitives
+
+// EvaluateInterval returns the range of distances to a sphere within a box.
+func (s *SphereSDF3) EvaluateInterval(b Box3) Interval {
+	x := absInterval(b.Min.X, b.Max.X)
+	y := absInterval(b.Min.Y, b.Max.Y)
+	z := absInterval(b.Min.Z, b.Max.Z)
+	dMin := V3{x.Min, y.Min, z.Min}.Length()
+	dMax := V3{x.Max, y.Max, z.Max}.Length()
+	return Interval{dMin - s.radius, dMax - s.radius}
+}
+
+// EvaluateInterval returns the range of distances to a box within a box.
+func (s *BoxSDF3) EvaluateInterval(b Box3) Interval {
+	// the distance is non-decreasing in each of |x|, |y| and |z|
+	x := absInterval(b.Min.X, b.Max.X)
+	y := absInterval(b.Min.Y, b.Max.Y)
+	z := absInterval(b.Min.Z, b.Max.Z)
+	dMin := sdfBox3d(V3{x.Min, y.Min, z.Min}, s.size)
+	dMax := sdfBox3d(V3{x.Max, y.Max, z.Max}, s.size)
+	return Interval{dMin - s.round, dMax - s.round}
+}
+
+// EvaluateInterval returns the range of distances to a cylinder within a box.
+func (s *CylinderSDF3) EvaluateInterval(b Box3) Interval {
+	// the distance is non-decreasing in each of the radius and |z|
+	x := absInterval(b.Min.X, b.Max.X)
+	y := absInterval(b.Min.Y, b.Max.Y)
+	z := absInterval(b.Min.Z, b.Max.Z)
+	r := Interval{V2{x.Min, y.Min}.Length(), V2{x.Max, y.Max}.Length()}
+	size := V2{s.radius, s.height}
+	dMin := sdfBox2d(V2{r.Min, z.Min}, size)
+	dMax := sdfBox2d(V2{r.Max, z.Max}, size)
+	return Interval{dMin - s.round, dMax - s.round}
+}
+
+// EvaluateInterval returns the range of distances to a screw within a box.
+// The box is mapped to a box in the xy space of the thread profile. The
+// profile x range is the z range plus the lead times the range of angles
+// about the z-axis, so it's narrow for small boxes away from the axis.
+func (s *ScrewSDF3) EvaluateInterval(b Box3) Interval {
+	// radius range
+	x := absInterval(b.Min.X, b.Max.X)
+	y := absInterval(b.Min.Y, b.Max.Y)
+	r := Interval{V2{x.Min, y.Min}.Length(), V2{x.Max, y.Max}.Length()}
+	// profile x range, the xy box is within a circle about its center
+	c := b.Center()
+	size := b.Size()
+	h := 0.5 * V2{size.X, size.Y}.Length()
+	px := Interval{-0.5 * s.pitch, 0.5 * s.pitch}
+	if cr := (V2{c.X, c.Y}).Length(); cr > h {
+		theta := math.Atan2(c.Y, c.X)
+		w := 0.5*size.Z + Abs(s.lead)*math.Asin(h/cr)/Tau
+		x0 := SawTooth(c.Z+s.lead*theta/Tau, s.pitch)
+		if x0-w >= px.Min && x0+w <= px.Max {
+			px = Interval{x0 - w, x0 + w}
+		}
+	}
+	// thread profile distance range
+	pc := V2{0.5 * (px.Min + px.Max), 0.5 * (r.Min + r.Max)}
+	ph := 0.5 * V2{px.Max - px.Min, r.Max - r.Min}.Length() * LipschitzK2(s.thread)
+	d0 := s.thread.Evaluate(pc)
+	// screw length range
+	d1 := absInterval(b.Min.Z, b.Max.Z).AddScalar(-s.length)
+	return monotonic(math.Max, Interval{d0 - ph, d0 + ph}, d1)
+}
+
+//-----------------------------------------------------------------------------
+// Operators
+
+// EvaluateInterval returns the range of distances to a union within a box.
+func (s *UnionSDF3) EvaluateInterval(b Box3) Interval {
+	var d Interval
+	for i, x := range s.sdf {
+		if i == 0 {
+			d = EvaluateInterval3(x, b)
+		} else {
+			d = monotonic(s.min, d, EvaluateInterval3(x, b))
+		}
+	}
+	return d
+}
+
+// EvaluateInterval returns the range of distances to a difference within a box.
+func (s *DifferenceSDF3) EvaluateInterval(b Box3) Interval {
+	return monotonic(s.max, EvaluateInterval3(s.s0, b), EvaluateInterval3(s.s1, b).Neg())
+}
+
+// EvaluateInterval returns the range of distances to an intersection within a box.
+func (s *IntersectionSDF3) EvaluateInterval(b Box3) Interval {
+	return monotonic(s.max, EvaluateInterval3(s.s0, b), EvaluateInterval3(s.s1, b))
+}
+
+// EvaluateInterval returns the range of distances to an offset SDF3 within a box.
+func (s *OffsetSDF3) EvaluateInterval(b Box3) Interval {
+	return EvaluateInterval3(s.sdf, b).AddScalar(-s.offset)
+}
+
+// EvaluateInterval returns the range of distances to a transformed SDF3 within a box.
+func (s *TransformSDF3) EvaluateInterval(b Box3) Interval {
+	// the transformed box is within the bounding box of its vertices
+	return EvaluateInterval3(s.sdf, s.inverse.MulBox(b)).MulScalar(s.k)
+}
+
+// EvaluateInterval returns the range of distances to a scaled SDF3 within a box.
+func (s *ScaleUniformSDF3) EvaluateInterval(b Box3) Interval {
+	p0, p1 := b.Min.MulScalar(s.invK), b.Max.MulScalar(s.invK)
+	q := Box3{p0.Min(p1), p0.Max(p1)}
+	return EvaluateInterval3(s.sdf, q).MulScalar(s.k)
+}
+
+//-----------------------------------------------------------------------------
+
+// isEmptyInterval returns true if a box is completely inside or outside of an SDF3.
+func isEmptyInterval(s SDF3, b Box3) bool {
+	d := EvaluateInterval3(s, b)
+	return d.Min > 0 || d.Max < 0
+}
+
+//-----------------------------------------------------------------------------
+// Bounding Box Tightening
+
+// emptyEvals is the maximum number of interval evaluations used to show a
+// box is empty.
+const emptyEvals = 4096
+
+// isEmptyBox returns true if a box can be shown to be outside of an SDF3.
+// The cells of the box that may cross the surface are subdivided (depth
+// first) down to the tolerance size. It returns false if a cell is inside
+// the SDF3, or if the evaluation budget runs out.
+func isEmptyBox(s SDF3, b Box3, tolerance float64) bool {
+	stack := []Box3{b}
+	for evals := 0; len(stack) > 0; evals++ {
+		if evals == emptyEvals {
+			return false
+		}
+		b := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		d := EvaluateInterval3(s, b)
+		if d.Min > 0 {
+			continue
+		}
+		size := b.Size()
+		if d.Max < 0 || size.MaxComponent() <= tolerance {
+			return false
+		}
+		// split the box on the longest axis
+		b0, b1 := b, b
+		switch {
+		case size.X >= size.Y && size.X >= size.Z:
+			b0.Max.X = 0.5 * (b.Min.X + b.Max.X)
+			b1.Min.X = b0.Max.X
+		case size.Y >= size.Z:
+			b0.Max.Y = 0.5 * (b.Min.Y + b.Max.Y)
+			b1.Min.Y = b0.Max.Y
+		default:
+			b0.Max.Z = 0.5 * (b.Min.Z + b.Max.Z)
+			b1.Min.Z = b0.Max.Z
+		}
+		stack = append(stack, b1, b0)
+	}
+	return true
+}
+
+// TightSDF3 is an SDF3 with a tightened bounding box.
+type TightSDF3 struct {
+	sdf SDF3
+	bb  Box3
+}
+
+// TightenBBox returns an SDF3 with a bounding box that has been shrunk to
+// within about tolerance of the object. The box is only reduced where the
+// removed space can be shown (by interval evaluation) to be empty.
+// E.g. the bounding box of a difference is that of the first SDF3, even if
+// most of it has been removed. The work done to show a slab of the box is
+// empty is bounded (see emptyEvals), so with loose interval bounds the box
+// may be less tight than the tolerance.
+func TightenBBox(sdf SDF3, tolerance float64) SDF3 {
+	if tolerance <= 0 {
+		panic("tolerance <= 0")
+	}
+	bb := sdf.BoundingBox()
+	min := [3]float64{bb.Min.X, bb.Min.Y, bb.Min.Z}
+	max := [3]float64{bb.Max.X, bb.Max.Y, bb.Max.Z}
+	box := func(min, max [3]float64) Box3 {
+		return Box3{V3{min[0], min[1], min[2]}, V3{max[0], max[1], max[2]}}
+	}
+	// shrink each face of the box
+	for i := 0; i < 6; i++ {
+		axis, upper := i%3, i >= 3
+		// binary search for the thickest empty slab on the face
+		t0, t1 := 0.0, max[axis]-min[axis]
+		for t1-t0 > tolerance {
+			t := 0.5 * (t0 + t1)
+			slabMin, slabMax := min, max
+			if upper {
+				slabMin[axis] = max[axis] - t
+			} else {
+				slabMax[axis] = min[axis] + t
+			}
+			if isEmptyBox(sdf, box(slabMin, slabMax), tolerance) {
+				t0 = t
+			} else {
+				t1 = t
+			}
+		}
+		if upper {
+			max[axis] -= t0
+		} else {
+			min[axis] += t0
+		}
+	}
+	return &TightSDF3{sdf, box(min, max)}
+}
+
+// Evaluate returns the minimum distance to a tightened SDF3.
+func (s *TightSDF3) Evaluate(p V3) float64 {
+	return s.sdf.Evaluate(p)
+}
+
+// EvaluateInterval returns the range of distances to a tightened SDF3 within a box.
+func (s *TightSDF3) EvaluateInterval(b Box3) Interval {
+	return EvaluateInterval3(s.sdf, b)
+}
+
+// BoundingBox returns the tightened bounding box.
+func (s *TightSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,144 @@
+//-----------------------------------------------------------------------------
+/*
+
+Lattice Homogenization
+
+Estimate the effective properties of a lattice (e.g. a TPMS or strut infill)
+from one unit cell of the lattice. The cell is voxelized and:
+
+Relative density is the solid volume fraction of the cell.
+
+Relative stiffness (E/Es, where Es is the stiffness of the solid material)
+is estimated in each axis direction with two voxel models:
+
+Slices: The cell is cut into slices normal to the load. The voxels of a slice
+are loaded in parallel, the slices are loaded in series. This is an upper
+estimate.
+
+Columns: The cell is cut into columns along the load. The voxels of a column
+are loaded in series (a column with any void carries no load), the columns
+are loaded in parallel. This is a lower estimate.
+
+Stretch dominated lattices (e.g. cubic struts along the load) are near the
+lower estimate, bending dominated lattices (e.g. TPMS) are between the two.
+These are quick estimates for comparing lattice settings, not a substitute
+for a finite element analysis.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"errors"
+	"fmt"
+)
+
+//-----------------------------------------------------------------------------
+
+// LatticeReport is the estimated properties of a lattice unit cell.
+type LatticeReport struct {
+	Cell         V3      `json:"cell"`          // unit cell size
+	Density      float64 `json:"density"`       // relative density (solid volume fraction)
+	StiffnessMax V3      `json:"stiffness_max"` // upper estimate of the x,y,z relative stiffness
+	StiffnessMin V3      `json:"stiffness_min"` // lower estimate of the x,y,z relative stiffness
+}
+
+// String returns a printable lattice report.
+func (r *LatticeReport) String() string {
+	s := fmt.Sprintf("cell %.3g x %.3g x %.3g\n", r.Cell.X, r.Cell.Y, r.Cell.Z)
+	s += fmt.Sprintf("relative density %.4f\n", r.Density)
+	s += fmt.Sprintf("relative stiffness x %.4f..%.4f\n", r.StiffnessMin.X, r.StiffnessMax.X)
+	s += fmt.Sprintf("relative stiffness y %.4f..%.4f\n", r.StiffnessMin.Y, r.StiffnessMax.Y)
+	s += fmt.Sprintf("relative stiffness z %.4f..%.4f", r.StiffnessMin.Z, r.StiffnessMax.Z)
+	return s
+}
+
+// latticeStiffness returns the slice and column stiffness estimates for
+// loading along axis a of the voxels.
+func latticeStiffness(solid []bool, n V3i, a int) (float64, float64) {
+	// the other two axes
+	b, c := (a+1)%3, (a+2)%3
+	at := func(i, j, k int) bool {
+		var v V3i
+		v[a], v[b], v[c] = i, j, k
+		return solid[(v[0]*n[1]+v[1])*n[2]+v[2]]
+	}
+	area := float64(n[b] * n[c])
+	// slices: parallel voxels in each slice, series slices
+	compliance := 0.0
+	for i := 0; i < n[a]; i++ {
+		count := 0
+		for j := 0; j < n[b]; j++ {
+			for k := 0; k < n[c]; k++ {
+				if at(i, j, k) {
+					count++
+				}
+			}
+		}
+		if count == 0 {
+			// a void slice: no load path
+			compliance = -1
+			break
+		}
+		compliance += area / float64(count)
+	}
+	sMax := 0.0
+	if compliance > 0 {
+		sMax = float64(n[a]) / compliance
+	}
+	// columns: series voxels in each column, parallel columns
+	count := 0
+	for j := 0; j < n[b]; j++ {
+		for k := 0; k < n[c]; k++ {
+			full := true
+			for i := 0; i < n[a] && full; i++ {
+				full = at(i, j, k)
+			}
+			if full {
+				count++
+			}
+		}
+	}
+	sMin := float64(count) / area
+	return sMax, sMin
+}
+
+// AnalyzeLattice estimates the properties of a lattice unit cell.
+// The unit cell is the cell box of the lattice SDF3. The cell is sampled
+// with meshCells voxels on the longest axis.
+func AnalyzeLattice(s SDF3, cell Box3, meshCells int) (*LatticeReport, error) {
+	size := cell.Size()
+	if size.X <= 0 || size.Y <= 0 || size.Z <= 0 {
+		return nil, errors.New("bad cell size")
+	}
+	if meshCells <= 0 {
+		return nil, errors.New("meshCells <= 0")
+	}
+	// voxels
+	inc := size.MaxComponent() / float64(meshCells)
+	n := size.DivScalar(inc).Ceil().ToV3i()
+	inc3 := size.Div(n.ToV3())
+	solid := make([]bool, n[0]*n[1]*n[2])
+	count := 0
+	for x := 0; x < n[0]; x++ {
+		for y := 0; y < n[1]; y++ {
+			for z := 0; z < n[2]; z++ {
+				// sample the voxel center
+				p := cell.Min.Add(V3{float64(x) + 0.5, float64(y) + 0.5, float64(z) + 0.5}.Mul(inc3))
+				if s.Evaluate(p) < 0 {
+					solid[(x*n[1]+y)*n[2]+z] = true
+					count++
+				}
+			}
+		}
+	}
+	r := LatticeReport{Cell: size}
+	r.Density = float64(count) / float64(len(solid))
+	r.StiffnessMax.X, r.StiffnessMin.X = latticeStiffness(solid, n, 0)
+	r.StiffnessMax.Y, r.StiffnessMin.Y = latticeStiffness(solid, n, 1)
+	r.StiffnessMax.Z, r.StiffnessMin.Z = latticeStiffness(solid, n, 2)
+	return &r, nil
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,433 @@
+//-----------------------------------------------------------------------------
+/*
+
+Lipschitz Bounds
+
+An SDF is Lipschitz with constant K if its value changes by at most K times
+the distance between two points. An exact distance function has K = 1. A
+distance bound with K > 1 can overestimate the distance to the surface, so
+|d|/K (not |d|) is the safe distance for sphere tracing and for showing a
+cell of a mesher is empty.
+
+The primitives and most operators have K <= 1. The deformations (non-uniform
+scaling, twist, bend, shrinkage compensation) divide their distances by how
+much they stretch space, so they have the K of the deformed SDF. The twisted
+and scaled extrusions and lofts have K > 1 within their bounding boxes. An SDF
+reports a different K by implementing LipschitzSDF3 (or LipschitzSDF2), and
+the operators pass the K of their children through the tree. An SDF that
+doesn't report K is assumed to have K = 1.
+
+Some SDFs have no useful bound (e.g. screws, where the helix stretches space
+without limit near the axis, and extrusions with a user defined function).
+They report K = +Inf, and the callers fall back to conservative methods: the
+octree mesher only prunes cells using interval evaluation, and the raytracer
+takes fixed steps along a ray.
+
+Lipschitz3D/Lipschitz2D set K for an SDF from elsewhere (e.g. a user
+defined distance function).
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// LipschitzSDF3 is implemented by SDF3s that report their Lipschitz bound.
+type LipschitzSDF3 interface {
+	LipschitzK() float64
+}
+
+// LipschitzK3 returns the Lipschitz bound of an SDF3 (1 if not reported).
+func LipschitzK3(s SDF3) float64 {
+	if l, ok := s.(LipschitzSDF3); ok {
+		return l.LipschitzK()
+	}
+	return 1
+}
+
+// LipschitzSDF2 is implemented by SDF2s that report their Lipschitz bound.
+type LipschitzSDF2 interface {
+	LipschitzK() float64
+}
+
+// LipschitzK2 returns the Lipschitz bound of an SDF2 (1 if not reported).
+func LipschitzK2(s SDF2) float64 {
+	if l, ok := s.(LipschitzSDF2); ok {
+		return l.LipschitzK()
+	}
+	return 1
+}
+
+//-----------------------------------------------------------------------------
+
+// LipschitzBoundSDF3 is an SDF3 with a given Lipschitz bound.
+type LipschitzBoundSDF3 struct {
+	sdf SDF3
+	k   float64
+}
+
+// Lipschitz3D returns an SDF3 with a Lipschitz bound of k.
+func Lipschitz3D(sdf SDF3, k float64) SDF3 {
+	if k <= 0 {
+		panic("k <= 0")
+	}
+	return &LipschitzBoundSDF3{sdf: sdf, k: k}
+}
+
+// Evaluate returns the distance bound of an SDF3.
+func (s *LipschitzBoundSDF3) Evaluate(p V3) float64 {
+	return s.sdf.Evaluate(p)
+}
+
+// BoundingBox returns the bounding box of an SDF3.
+func (s *LipschitzBoundSDF3) BoundingBox() Box3 {
+	return s.sdf.BoundingBox()
+}
+
+// LipschitzK returns the Lipschitz bound of an SDF3.
+func (s *LipschitzBoundSDF3) LipschitzK() float64 {
+	return s.k
+}
+
+// LipschitzBoundSDF2 is an SDF2 with a given Lipschitz bound.
+type LipschitzBoundSDF2 struct {
+	sdf SDF2
+	k   float64
+}
+
+// Lipschitz2D returns an SDF2 with a Lipschitz bound of k.
+func Lipschitz2D(sdf SDF2, k float64) SDF2 {
+	if k <= 0 {
+		panic("k <= 0")
+	}
+	return &LipschitzBoundSDF2{sdf: sdf, k: k}
+}
+
+// Evaluate returns the distance bound of an SDF2.
+func (s *LipschitzBoundSDF2) Evaluate(p V2) float64 {
+	return s.sdf.Evaluate(p)
+}
+
+// BoundingBox returns the bounding box of an SDF2.
+func (s *LipschitzBoundSDF2) BoundingBox() Box2 {
+	return s.sdf.BoundingBox()
+}
+
+// LipschitzK returns the Lipschitz bound of an SDF2.
+func (s *LipschitzBoundSDF2) LipschitzK() float64 {
+	return s.k
+}
+
+//-----------------------------------------------------------------------------
+// SDF3 Operators
+
+// LipschitzK returns the Lipschitz bound of a transformed SDF3.
+// The distance is scaled by the minimum scale factor, so the bound is unchanged.
+func (s *TransformSDF3) LipschitzK() float64 {
+	return LipschitzK3(s.sdf)
+}
+
+// LipschitzK returns the Lipschitz bound of a uniformly scaled SDF3.
+func (s *ScaleUniformSDF3) LipschitzK() float64 {
+	return LipschitzK3(s.sdf)
+}
+
+// LipschitzK returns the Lipschitz bound of a non-uniformly scaled SDF3.
+// The distance is scaled by the minimum scale factor, so the bound is unchanged.
+func (s *ScaleNonUniformSDF3) LipschitzK() float64 {
+	return LipschitzK3(s.sdf)
+}
+
+// LipschitzK returns the Lipschitz bound of a twisted SDF3.
+// The distance is divided by the stretch of the twist, so the bound is unchanged.
+func (s *TwistSDF3) LipschitzK() float64 {
+	return LipschitzK3(s.sdf)
+}
+
+// LipschitzK returns the Lipschitz bound of a bent SDF3.
+// The distance is scaled by the maximum stretch of the bend (outside the
+// minimum radius), so the bound is unchanged.
+func (s *BendSDF3) LipschitzK() float64 {
+	return LipschitzK3(s.sdf)
+}
+
+// LipschitzK returns the Lipschitz bound of a compensated SDF3.
+// The distance is divided by the stretch of the compensation, so the bound is unchanged.
+func (s *CompensateSDF3) LipschitzK() float64 {
+	return LipschitzK3(s.sdf)
+}
+
+// LipschitzK returns the Lipschitz bound of a knurled SDF3.
+func (s *KnurlSDF3) LipschitzK() float64 {
+	return Max(LipschitzK3(s.sdf), 1)
+}
+
+// LipschitzK returns the Lipschitz bound of a displaced SDF3.
+// The distance is divided by the slope of the displacement, so the bound is unchanged.
+func (s *DisplaceSDF3) LipschitzK() float64 {
+	return LipschitzK3(s.sdf)
+}
+
+// LipschitzK returns the Lipschitz bound of an interpolated SDF3.
+// The distance is divided by the slope of the blend, so the bound is that of the SDF3s.
+func (s *LerpSDF3) LipschitzK() float64 {
+	return Max(LipschitzK3(s.s0), LipschitzK3(s.s1))
+}
+
+// LipschitzK returns the Lipschitz bound of an offset SDF3.
+func (s *OffsetSDF3) LipschitzK() float64 {
+	return LipschitzK3(s.sdf)
+}
+
+// LipschitzK returns the Lipschitz bound of an elongated SDF3.
+func (s *ElongateSDF3) LipschitzK() float64 {
+	return LipschitzK3(s.sdf)
+}
+
+// LipschitzK returns the Lipschitz bound of a tagged SDF3.
+func (s *TagSDF3) LipschitzK() float64 {
+	return LipschitzK3(s.sdf)
+}
+
+// LipschitzK returns the Lipschitz bound of an anchored SDF3.
+func (s *AnchorSDF3) LipschitzK() float64 {
+	return LipschitzK3(s.sdf)
+}
+
+// LipschitzK returns the Lipschitz bound of a compiled SDF3.
+func (s *CompiledSDF3) LipschitzK() float64 {
+	return LipschitzK3(s.sdf)
+}
+
+// LipschitzK returns the Lipschitz bound of a union of SDF3s.
+func (s *UnionSDF3) LipschitzK() float64 {
+	k := 0.0
+	for _, x := range s.sdf {
+		k = Max(k, LipschitzK3(x))
+	}
+	return k
+}
+
+// LipschitzK returns the Lipschitz bound of a BVH union of SDF3s.
+func (s *BVHUnionSDF3) LipschitzK() float64 {
+	k := 0.0
+	for _, n := range s.nodes {
+		for _, x := range n.sdf {
+			k = Max(k, LipschitzK3(x))
+		}
+	}
+	return k
+}
+
+// LipschitzK returns the Lipschitz bound of the difference of two SDF3s.
+func (s *DifferenceSDF3) LipschitzK() float64 {
+	return Max(LipschitzK3(s.s0), LipschitzK3(s.s1))
+}
+
+// LipschitzK returns the Lipschitz bound of the intersection of two SDF3s.
+func (s *IntersectionSDF3) LipschitzK() float64 {
+	return Max(LipschitzK3(s.s0), LipschitzK3(s.s1))
+}
+
+// LipschitzK returns the Lipschitz bound of the cut SDF3.
+func (s *CutSDF3) LipschitzK() float64 {
+	return Max(LipschitzK3(s.sdf), 1)
+}
+
+// LipschitzK returns the Lipschitz bound of an array of SDF3s.
+func (s *ArraySDF3) LipschitzK() float64 {
+	return LipschitzK3(s.sdf)
+}
+
+// LipschitzK returns the Lipschitz bound of a union of rotated SDF3s.
+func (s *RotateUnionSDF3) LipschitzK() float64 {
+	return LipschitzK3(s.sdf)
+}
+
+// LipschitzK returns the Lipschitz bound of an extruded SDF2.
+// The bound of the extrude function is for the bounding box of the extrusion.
+func (s *ExtrudeSDF3) LipschitzK() float64 {
+	if s.k == 0 {
+		// user defined extrude function
+		return math.Inf(1)
+	}
+	return Max(LipschitzK2(s.sdf)*s.k, 1)
+}
+
+// LipschitzK returns the Lipschitz bound of an extruded SDF2 with rounded edges.
+func (s *ExtrudeRoundedSDF3) LipschitzK() float64 {
+	return Max(LipschitzK2(s.sdf), 1)
+}
+
+// LipschitzK returns the Lipschitz bound of an extruded SDF2 with filleted faces.
+func (s *FilletExtrudeSDF3) LipschitzK() float64 {
+	return Max(LipschitzK2(s.sdf), 1)
+}
+
+// LipschitzK returns the Lipschitz bound of a lofted SDF3.
+// Within the bounding box the SDF2 distances differ by at most 2 * K * d
+// (d is the xy diagonal), and that difference is mixed over the height.
+func (s *LoftSDF3) LipschitzK() float64 {
+	k := Max(LipschitzK2(s.sdf0), LipschitzK2(s.sdf1))
+	d := V2{s.bb.Size().X, s.bb.Size().Y}.Length()
+	return Max(k*math.Sqrt(1+(d/s.height)*(d/s.height)), 1)
+}
+
+// LipschitzK returns the Lipschitz bound of a solid of revolution.
+func (s *SorSDF3) LipschitzK() float64 {
+	return Max(LipschitzK2(s.sdf), 1)
+}
+
+// LipschitzK returns the Lipschitz bound of a screw.
+// The helix stretches space by sqrt(1 + (lead / (2 * pi * r))^2) at radius r,
+// so there is no bound near the axis. See EvaluateInterval.
+func (s *ScrewSDF3) LipschitzK() float64 {
+	return math.Inf(1)
+}
+
+// LipschitzK returns the Lipschitz bound of a cached SDF3.
+func (s *CacheSDF3) LipschitzK() float64 {
+	return LipschitzK3(s.sdf)
+}
+
+// LipschitzK returns the Lipschitz bound of a connected SDF3.
+func (s *ConnectedSDF3) LipschitzK() float64 {
+	return LipschitzK3(s.sdf)
+}
+
+// LipschitzK returns the Lipschitz bound of an SDF3 with small parts removed.
+func (s *RemoveSmallSDF3) LipschitzK() float64 {
+	return LipschitzK3(s.sdf)
+}
+
+// LipschitzK returns the Lipschitz bound of a synchronized SDF3.
+func (s *SynchronizedSDF3) LipschitzK() float64 {
+	return LipschitzK3(s.sdf)
+}
+
+// LipschitzK returns the Lipschitz bound of an SDF3 with a tight bounding box.
+func (s *TightSDF3) LipschitzK() float64 {
+	return LipschitzK3(s.sdf)
+}
+
+// LipschitzK returns the Lipschitz bound of a repeated SDF3.
+func (s *RepeatSDF3) LipschitzK() float64 {
+	return LipschitzK3(s.sdf)
+}
+
+// LipschitzK returns the Lipschitz bound of a repeated and transformed SDF3.
+// The distance isn't scaled, so scaling down an instance increases the bound.
+func (s *RepeatTransformSDF3) LipschitzK() float64 {
+	k := 1.0
+	for i, m := range s.inv {
+		if !s.skip[i] {
+			_, x := m.ScaleFactors()
+			k = Max(k, x)
+		}
+	}
+	return LipschitzK3(s.sdf) * k
+}
+
+// LipschitzK returns the Lipschitz bound of rotated copies of an SDF3.
+func (s *RotateCopySDF3) LipschitzK() float64 {
+	return LipschitzK3(s.sdf)
+}
+
+// LipschitzK returns the Lipschitz bound of a swept SDF3.
+func (s *sweepSDF3) LipschitzK() float64 {
+	return LipschitzK3(s.sdf)
+}
+
+// LipschitzK returns the Lipschitz bound of an engraved SDF3.
+func (s *engraveSDF3) LipschitzK() float64 {
+	return Max(LipschitzK2(s.e), LipschitzK3(s.s))
+}
+
+//-----------------------------------------------------------------------------
+// SDF2 Operators
+
+// LipschitzK returns the Lipschitz bound of a transformed SDF2.
+// The distance isn't scaled, so scaling down increases the bound.
+func (s *TransformSDF2) LipschitzK() float64 {
+	_, k := s.mInv.ScaleFactors()
+	return LipschitzK2(s.sdf) * k
+}
+
+// LipschitzK returns the Lipschitz bound of a uniformly scaled SDF2.
+func (s *ScaleUniformSDF2) LipschitzK() float64 {
+	return LipschitzK2(s.sdf)
+}
+
+// LipschitzK returns the Lipschitz bound of an offset SDF2.
+func (s *OffsetSDF2) LipschitzK() float64 {
+	return LipschitzK2(s.sdf)
+}
+
+// LipschitzK returns the Lipschitz bound of a union of SDF2s.
+func (s *UnionSDF2) LipschitzK() float64 {
+	k := 0.0
+	for _, x := range s.sdf {
+		k = Max(k, LipschitzK2(x))
+	}
+	return k
+}
+
+// LipschitzK returns the Lipschitz bound of the difference of two SDF2s.
+func (s *DifferenceSDF2) LipschitzK() float64 {
+	return Max(LipschitzK2(s.s0), LipschitzK2(s.s1))
+}
+
+// LipschitzK returns the Lipschitz bound of the cut SDF2.
+func (s *CutSDF2) LipschitzK() float64 {
+	return Max(LipschitzK2(s.sdf), 1)
+}
+
+// LipschitzK returns the Lipschitz bound of an array of SDF2s.
+func (s *ArraySDF2) LipschitzK() float64 {
+	return LipschitzK2(s.sdf)
+}
+
+// LipschitzK returns the Lipschitz bound of a union of rotated SDF2s.
+func (s *RotateUnionSDF2) LipschitzK() float64 {
+	return LipschitzK2(s.sdf)
+}
+
+// LipschitzK returns the Lipschitz bound of rotated copies of an SDF2.
+func (s *RotateCopySDF2) LipschitzK() float64 {
+	return LipschitzK2(s.sdf)
+}
+
+// LipschitzK returns the Lipschitz bound of a repeated SDF2.
+func (s *RepeatSDF2) LipschitzK() float64 {
+	return LipschitzK2(s.sdf)
+}
+
+// LipschitzK returns the Lipschitz bound of an elongated SDF2.
+func (s *ElongateSDF2) LipschitzK() float64 {
+	return LipschitzK2(s.sdf)
+}
+
+// LipschitzK returns the Lipschitz bound of a wall around an SDF2.
+func (s *WallSDF2) LipschitzK() float64 {
+	return LipschitzK2(s.sdf)
+}
+
+// LipschitzK returns the Lipschitz bound of a synchronized SDF2.
+func (s *SynchronizedSDF2) LipschitzK() float64 {
+	return LipschitzK2(s.sdf)
+}
+
+// LipschitzK returns the Lipschitz bound of a slice of an SDF3.
+func (s *SliceSDF2) LipschitzK() float64 {
+	return LipschitzK3(s.sdf)
+}
+
+// LipschitzK returns the Lipschitz bound of a projection of an SDF3.
+func (s *ProjectSDF2) LipschitzK() float64 {
+	return LipschitzK3(s.sdf)
+}
+
+//-----------------------------------------------------------------------------
@@ -13,6 +13,7 @@ package sdf
 //-----------------------------------------------------------------------------
 
 // lineCache is a cache of SDF2 evaluations samples over a 2d line.
+// It is not safe for concurrent use, each renderer has its own.
 type lineCache struct {
 	base  V2        // base coordinate of line
 	inc   V2        // dx, dy for each step
@@ -37,7 +38,7 @@ func (l *lineCache) evaluate(sdf SDF2, x int) {
 
 	// allocate storage
 	if l.val1 == nil {
-		l.val1 = make([]float64, ny+1)
+		l.val1 = getFloat64s(ny + 1)
 	}
 
 	// setup the loop variables
@@ -54,6 +55,13 @@ func (l *lineCache) evaluate(sdf SDF2, x int) {
 	}
 }
 
+// release returns the line cache buffers to the pool.
+func (l *lineCache) release() {
+	putFloat64s(l.val0)
+	putFloat64s(l.val1)
+	l.val0, l.val1 = nil, nil
+}
+
 // get a value from a line cache.
 func (l *lineCache) get(x, y int) float64 {
 	if x == 0 {
@@ -66,7 +74,7 @@ func (l *lineCache) get(x, y int) float64 {
 
 func marchingSquares(sdf SDF2, box Box2, step float64) []*Line {
 
-	var lines []*Line
+	lines := make([]*Line, 0, estimateLines(box, step))
 	size := box.Size()
 	base := box.Min
 	steps := size.DivScalar(step).Ceil().ToV2i()
@@ -74,6 +82,7 @@ func marchingSquares(sdf SDF2, box Box2, step float64) []*Line {
 
 	// create the line cache
 	l := newLineCache(base, inc, steps)
+	defer l.release()
 	// evaluate the SDF for x = 0
 	l.evaluate(sdf, 0)
 
@@ -115,13 +124,7 @@ func marchingSquares(sdf SDF2, box Box2, step float64) []*Line {
 
 // generate the line segments for a square
 func msToLines(p [4]V2, v [4]float64, x float64) []*Line {
-	// which of the 0..15 patterns do we have?
-	index := 0
-	for i := 0; i < 4; i++ {
-		if v[i] < x {
-			index |= 1 << uint(i)
-		}
-	}
+	index := msIndex(v, x)
 	// do we have any lines to create?
 	if msEdgeTable[index] == 0 {
 		return nil
@@ -136,7 +139,22 @@ func msToLines(p [4]V2, v [4]float64, x float64) []*Line {
 			points[i] = msInterpolate(p[a], p[b], v[a], v[b], x)
 		}
 	}
-	// create the line segments
+	return msLines(index, points)
+}
+
+// msIndex returns which of the 0..15 patterns we have for the corner values.
+func msIndex(v [4]float64, x float64) int {
+	index := 0
+	for i := 0; i < 4; i++ {
+		if v[i] < x {
+			index |= 1 << uint(i)
+		}
+	}
+	return index
+}
+
+// msLines creates the line segments for a pattern given the edge points.
+func msLines(index int, points [4]V2) []*Line {
 	table := msLineTable[index]
 	count := len(table) / 2
 	result := make([]*Line, count)
@@ -152,6 +170,13 @@ func msToLines(p [4]V2, v [4]float64, x float64) []*Line {
 //-----------------------------------------------------------------------------
 
 func msInterpolate(p1, p2 V2, v1, v2, x float64) V2 {
+	// Neighbouring squares share edges, but may list the edge end points in
+	// the opposite order. Use a consistent order so the shared end points
+	// are identical and the lines join up.
+	if p2.X < p1.X || p2.Y < p1.Y {
+		p1, p2 = p2, p1
+		v1, v2 = v2, v1
+	}
 	if Abs(x-v1) < epsilon {
 		return p1
 	}
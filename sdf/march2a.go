@@ -0,0 +1,161 @@
+//-----------------------------------------------------------------------------
+/*
+
+Adaptive Marching Squares
+
+Convert an SDF2 boundary to a set of line segments.
+Uses quadtree space subdivision with variable sized leaf squares.
+
+Squares are subdivided where the SDF2 is not well approximated by bilinear
+interpolation of the corner values (curved boundaries, corners, features
+smaller than the square). Flat regions use larger squares. Fine features
+are captured without a small step size over the whole boundary.
+
+The boundary crossings on the square edges are found by bisection. A large
+square and its smaller neighbours bisect the shared edge in the same way,
+so they find the same crossing points and the boundary has no gaps.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// adaptiveLevels is the number of levels the leaf squares can be coarsened.
+const adaptiveLevels = 5
+
+// crossingIterations is the number of bisection iterations within a minimum step.
+const crossingIterations = 10
+
+type adaptive2 struct {
+	dc        *dcache2 // distance cache for square corners
+	tolerance float64  // allowed interpolation error
+	maxLevel  uint     // level of the largest leaf square
+}
+
+// isComplex returns true if a square needs to be subdivided.
+func (a *adaptive2) isComplex(c *square) bool {
+	s := 1 << c.n // side
+	h := s >> 1   // half side
+	_, d0 := a.dc.evaluate(c.v)
+	_, d1 := a.dc.evaluate(c.v.Add(V2i{s, 0}))
+	_, d2 := a.dc.evaluate(c.v.Add(V2i{s, s}))
+	_, d3 := a.dc.evaluate(c.v.Add(V2i{0, s}))
+	_, d01 := a.dc.evaluate(c.v.Add(V2i{h, 0}))
+	_, d12 := a.dc.evaluate(c.v.Add(V2i{s, h}))
+	_, d23 := a.dc.evaluate(c.v.Add(V2i{h, s}))
+	_, d30 := a.dc.evaluate(c.v.Add(V2i{0, h}))
+	_, dc := a.dc.evaluate(c.v.AddScalar(h))
+	edges := [4][3]float64{{d0, d1, d01}, {d1, d2, d12}, {d2, d3, d23}, {d3, d0, d30}}
+	for _, e := range edges {
+		// interpolation error at the edge midpoint
+		if Abs(e[2]-0.5*(e[0]+e[1])) > a.tolerance {
+			return true
+		}
+		// a pair of crossings between the corners
+		if (e[0] < 0) == (e[1] < 0) && (e[2] < 0) != (e[0] < 0) {
+			return true
+		}
+	}
+	// interpolation error at the center
+	return Abs(dc-0.25*(d0+d1+d2+d3)) > a.tolerance
+}
+
+// crossing returns the boundary crossing on an edge between two corners.
+func (a *adaptive2) crossing(v0, v1 V2i) V2 {
+	// use a consistent order for the edge end points
+	if v1[0] < v0[0] || v1[1] < v0[1] {
+		v0, v1 = v1, v0
+	}
+	p0, d0 := a.dc.evaluate(v0)
+	p1, d1 := a.dc.evaluate(v1)
+	// bisect the integer grid (the edges are axis aligned)
+	for (v1[0]-v0[0])+(v1[1]-v0[1]) > 1 {
+		vm := V2i{(v0[0] + v1[0]) / 2, (v0[1] + v1[1]) / 2}
+		pm, dm := a.dc.evaluate(vm)
+		if (dm < 0) == (d0 < 0) {
+			v0, p0, d0 = vm, pm, dm
+		} else {
+			v1, p1, d1 = vm, pm, dm
+		}
+	}
+	// bisect within the grid step
+	for i := 0; i < crossingIterations; i++ {
+		pm := p0.Add(p1).MulScalar(0.5)
+		dm := a.dc.s.Evaluate(pm)
+		if (dm < 0) == (d0 < 0) {
+			p0, d0 = pm, dm
+		} else {
+			p1, d1 = pm, dm
+		}
+	}
+	return msInterpolate(p0, p1, d0, d1, 0)
+}
+
+// processSquare outputs the line segments for a square (or its sub squares).
+func (a *adaptive2) processSquare(c *square, output chan<- *Line) {
+	s := 1 << c.n // side
+	h := s >> 1   // half side
+	// is the square empty?
+	_, d := a.dc.evaluate(c.v.AddScalar(h))
+	if Abs(d) >= a.dc.hdiag[c.n] {
+		return
+	}
+	if c.n > 1 && (c.n > a.maxLevel || a.isComplex(c)) {
+		// process the sub squares
+		n := c.n - 1
+		a.processSquare(&square{c.v, n}, output)
+		a.processSquare(&square{c.v.Add(V2i{h, 0}), n}, output)
+		a.processSquare(&square{c.v.Add(V2i{h, h}), n}, output)
+		a.processSquare(&square{c.v.Add(V2i{0, h}), n}, output)
+		return
+	}
+	// this is a leaf square
+	v := [4]V2i{c.v, c.v.Add(V2i{s, 0}), c.v.Add(V2i{s, s}), c.v.Add(V2i{0, s})}
+	var values [4]float64
+	for i := range v {
+		_, values[i] = a.dc.evaluate(v[i])
+	}
+	index := msIndex(values, 0)
+	if msEdgeTable[index] == 0 {
+		return
+	}
+	var points [4]V2
+	for i := 0; i < 4; i++ {
+		if msEdgeTable[index]&(1<<uint(i)) != 0 {
+			points[i] = a.crossing(v[msPairTable[i][0]], v[msPairTable[i][1]])
+		}
+	}
+	for _, l := range msLines(index, points) {
+		output <- l
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// marchingSquaresAdaptive generates line segments for an SDF2 using adaptive
+// quadtree subdivision. The resolution is the minimum step size.
+func marchingSquaresAdaptive(s SDF2, resolution, tolerance float64, output chan<- *Line) {
+	// Scale the bounding box about the center to make sure the boundaries
+	// aren't on the object surface.
+	bb := s.BoundingBox()
+	bb = bb.ScaleAboutCenter(1.01)
+	longAxis := bb.Size().MaxComponent()
+	// The level = 1 square is the minimum step, so the level = 0 square is
+	// at half resolution (the square centers are on the integer grid).
+	resolution = 0.5 * resolution
+	// how many square levels for the quadtree?
+	levels := uint(math.Ceil(math.Log2(longAxis/resolution))) + 1
+	a := adaptive2{
+		dc:        newDcache2(s, bb.Min, resolution, levels),
+		tolerance: tolerance,
+		maxLevel:  1 + adaptiveLevels,
+	}
+	// process the quadtree, start at the top level
+	a.processSquare(&square{V2i{0, 0}, levels - 1}, output)
+}
+
+//-----------------------------------------------------------------------------
@@ -6,12 +6,19 @@ Marching Squares Quadtree
 Convert an SDF2 boundary to a set of line segments.
 Uses quadtree space subdivision.
 
+A square is only subdivided if the distance at its center is less than the
+center to corner distance (the boundary may pass through it). Empty space
+is skipped with a single evaluation per large square, so a small boundary
+in a large bounding box needs far fewer evaluations than a uniform grid.
+The line segments are the same as for a uniform grid.
+
 */
 //-----------------------------------------------------------------------------
 
 package sdf
 
 import (
+	"context"
 	"math"
 	"sync"
 )
@@ -33,6 +40,7 @@ type dcache2 struct {
 	s          SDF2            // the SDF2 to be rendered
 	cache      map[V2i]float64 // cache of distances
 	lock       sync.RWMutex    // lock the the cache during reads/writes
+	p          *progress       // progress/cancellation (optional)
 }
 
 func newDcache2(s SDF2, origin V2, resolution float64, n uint) *dcache2 {
@@ -44,10 +52,12 @@ func newDcache2(s SDF2, origin V2, resolution float64, n uint) *dcache2 {
 		cache:      make(map[V2i]float64),
 	}
 	// build a lut for cube half diagonal lengths
+	// (scaled by the lipschitz bound, the largest center/corner distance change)
+	k := LipschitzK2(s)
 	for i := range dc.hdiag {
 		si := 1 << uint(i)
 		s := float64(si) * dc.resolution
-		dc.hdiag[i] = 0.5 * math.Sqrt(2.0*s*s)
+		dc.hdiag[i] = 0.5 * math.Sqrt(2.0*s*s) * k
 	}
 	return &dc
 }
@@ -92,7 +102,13 @@ func (dc *dcache2) isEmpty(c *square) bool {
 
 // Process a square. Generate line segments, or more squares.
 func (dc *dcache2) processSquare(c *square, output chan<- *Line) {
-	if !dc.isEmpty(c) {
+	if dc.p.cancelled() {
+		return
+	}
+	if dc.isEmpty(c) {
+		// the number of minimum size squares in this square
+		dc.p.add(math.Ldexp(1, 2*int(c.n-1)))
+	} else {
 		if c.n == 1 {
 			// this square is at the required resolution
 			c0, d0 := dc.evaluate(c.v.Add(V2i{0, 0}))
@@ -105,6 +121,7 @@ func (dc *dcache2) processSquare(c *square, output chan<- *Line) {
 			for _, l := range msToLines(corners, values, 0) {
 				output <- l
 			}
+			dc.p.add(1)
 		} else {
 			// process the sub squares
 			n := c.n - 1
@@ -122,6 +139,12 @@ func (dc *dcache2) processSquare(c *square, output chan<- *Line) {
 
 // marchingSquaresQuadtree generates line segments for an SDF2 using quadtree subdivision.
 func marchingSquaresQuadtree(s SDF2, resolution float64, output chan<- *Line) {
+	marchingSquaresQuadtreeContext(context.Background(), s, resolution, output, nil)
+}
+
+// marchingSquaresQuadtreeContext generates line segments for an SDF2 using quadtree
+// subdivision. Cancelling ctx stops the mesher, fn (optional) is called with the progress.
+func marchingSquaresQuadtreeContext(ctx context.Context, s SDF2, resolution float64, output chan<- *Line, fn ProgressFunc) error {
 	// Scale the bounding box about the center to make sure the boundaries
 	// aren't on the object surface.
 	bb := s.BoundingBox()
@@ -134,8 +157,10 @@ func marchingSquaresQuadtree(s SDF2, resolution float64, output chan<- *Line) {
 	levels := uint(math.Ceil(math.Log2(longAxis/resolution))) + 1
 	// create the distance cache
 	dc := newDcache2(s, bb.Min, resolution, levels)
+	dc.p = newProgress(ctx, fn, math.Ldexp(1, 2*int(levels-2)))
 	// process the quadtree, start at the top level
 	dc.processSquare(&square{V2i{0, 0}, levels - 1}, output)
+	return dc.p.err()
 }
 
 //-----------------------------------------------------------------------------
@@ -17,26 +17,30 @@ import (
 
 //-----------------------------------------------------------------------------
 
+// layerYZ is a cache of SDF3 evaluations over a yz layer.
+// It is not safe for concurrent use, each renderer has its own.
 type layerYZ struct {
-	base  V3        // base coordinate of layer
-	inc   V3        // dx, dy, dz for each step
-	steps V3i       // number of x,y,z steps
-	val0  []float64 // SDF values for x layer
-	val1  []float64 // SDF values for x + dx layer
+	base  V3            // base coordinate of layer
+	inc   V3            // dx, dy, dz for each step
+	steps V3i           // number of x,y,z steps
+	val0  []float64     // SDF values for x layer
+	val1  []float64     // SDF values for x + dx layer
+	grid  GridEvaluator // grid evaluator (nil == evaluate on the CPU)
+	gsdf  SDF3          // SDF3 for the grid evaluator
 }
 
 func newLayerYZ(base, inc V3, steps V3i) *layerYZ {
-	return &layerYZ{base, inc, steps, nil, nil}
+	return &layerYZ{base: base, inc: inc, steps: steps}
 }
 
 // evalReq is used for processing evaluations in parallel.
 //
-// A slice of V3 is run through `fn`; the result of which
+// A slice of V3 is batch evaluated by `sdf`; the result of which
 // is stored in the corresponding index of the `out` slice.
 type evalReq struct {
 	out []float64
 	p   []V3
-	fn  func(V3) float64
+	sdf SDF3
 	wg  *sync.WaitGroup
 }
 
@@ -45,12 +49,9 @@ var evalProcessCh = make(chan evalReq, 100)
 func init() {
 	for i := 0; i < runtime.NumCPU(); i++ {
 		go func() {
-			var i int
-			var p V3
 			for r := range evalProcessCh {
-				for i, p = range r.p {
-					r.out[i] = r.fn(p)
-				}
+				EvaluateN(r.sdf, r.p, r.out[:len(r.p)])
+				putV3Batch(r.p)
 				r.wg.Done()
 			}
 		}()
@@ -68,7 +69,16 @@ func (l *layerYZ) Evaluate(sdf SDF3, x int) {
 
 	// allocate storage
 	if l.val1 == nil {
-		l.val1 = make([]float64, (ny+1)*(nz+1))
+		l.val1 = getFloat64s((ny + 1) * (nz + 1))
+	}
+
+	// try the grid evaluator, fall back to the CPU if it fails
+	if l.grid != nil {
+		base := V3{l.base.X + float64(x)*dx, l.base.Y, l.base.Z}
+		if l.grid.EvaluateGrid(l.gsdf, base, l.inc, V3i{0, ny, nz}, l.val1) == nil {
+			return
+		}
+		l.grid = nil
 	}
 
 	// setup the loop variables
@@ -79,26 +89,23 @@ func (l *layerYZ) Evaluate(sdf SDF3, x int) {
 	// define the base struct for requesting evaluation
 	eReq := evalReq{
 		wg:  new(sync.WaitGroup),
-		fn:  sdf.Evaluate,
+		sdf: sdf,
 		out: l.val1,
 	}
 
 	// evaluate the layer
 	p.Y = l.base.Y
 
-	// Performance doesn't seem to improve past 100.
-	const batchSize = 100
-
-	eReq.p = make([]V3, 0, batchSize)
+	eReq.p = getV3Batch()
 	for y := 0; y < ny+1; y++ {
 		p.Z = l.base.Z
 		for z := 0; z < nz+1; z++ {
 			eReq.p = append(eReq.p, p)
-			if len(eReq.p) == batchSize {
+			if len(eReq.p) == evalBatchSize {
 				eReq.wg.Add(1)
 				evalProcessCh <- eReq
-				eReq.out = eReq.out[batchSize:]   // shift the output slice for processing
-				eReq.p = make([]V3, 0, batchSize) // create a new slice for the next batch
+				eReq.out = eReq.out[evalBatchSize:] // shift the output slice for processing
+				eReq.p = getV3Batch()               // get a new slice for the next batch
 			}
 			idx++
 			p.Z += dz
@@ -110,12 +117,21 @@ func (l *layerYZ) Evaluate(sdf SDF3, x int) {
 	if len(eReq.p) > 0 {
 		eReq.wg.Add(1)
 		evalProcessCh <- eReq
+	} else {
+		putV3Batch(eReq.p)
 	}
 
 	// Wait for all processing to complete before returning
 	eReq.wg.Wait()
 }
 
+// release returns the layer buffers to the pool.
+func (l *layerYZ) release() {
+	putFloat64s(l.val0)
+	putFloat64s(l.val1)
+	l.val0, l.val1 = nil, nil
+}
+
 func (l *layerYZ) Get(x, y, z int) float64 {
 	idx := y*(l.steps[2]+1) + z
 	if x == 0 {
@@ -127,8 +143,15 @@ func (l *layerYZ) Get(x, y, z int) float64 {
 //-----------------------------------------------------------------------------
 
 func marchingCubes(sdf SDF3, box Box3, step float64) []*Triangle3 {
+	return marchingCubesEvaluator(sdf, box, step, nil)
+}
+
+// marchingCubesEvaluator generates a triangle mesh for an SDF3 using uniform
+// sampling. The layers of samples are evaluated with a grid evaluator (nil ==
+// evaluate on the CPU).
+func marchingCubesEvaluator(sdf SDF3, box Box3, step float64, grid GridEvaluator) []*Triangle3 {
 
-	var triangles []*Triangle3
+	triangles := make([]*Triangle3, 0, estimateTriangles(box, step))
 	size := box.Size()
 	base := box.Min
 	steps := size.DivScalar(step).Ceil().ToV3i()
@@ -136,6 +159,10 @@ func marchingCubes(sdf SDF3, box Box3, step float64) []*Triangle3 {
 
 	// create the SDF layer cache
 	l := newLayerYZ(base, inc, steps)
+	l.grid, l.gsdf = grid, sdf
+	defer l.release()
+
+	sdf = Compile3D(sdf)
 	// evaluate the SDF for x = 0
 	l.Evaluate(sdf, 0)
 
@@ -224,6 +251,13 @@ func mcToTriangles(p [8]V3, v [8]float64, x float64) []*Triangle3 {
 //-----------------------------------------------------------------------------
 
 func mcInterpolate(p1, p2 V3, v1, v2, x float64) V3 {
+	// Neighbouring cubes share edges, but may list the edge end points in
+	// the opposite order. Use a consistent order so the shared vertices are
+	// identical and the mesh is watertight.
+	if p2.X < p1.X || p2.Y < p1.Y || p2.Z < p1.Z {
+		p1, p2 = p2, p1
+		v1, v2 = v2, v1
+	}
 	if Abs(x-v1) < epsilon {
 		return p1
 	}
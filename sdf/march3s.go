@@ -0,0 +1,199 @@
+//-----------------------------------------------------------------------------
+/*
+
+Marching Cubes Surface Tracking
+
+Convert an SDF3 to a triangle mesh.
+
+Only the cells crossing the surface are evaluated. Seed cells are found by
+sphere tracing along a lattice of lines parallel to the x, y and z axes,
+and at a surface point of each connected component (see Components3D), so
+small disjoint pieces lying between the lines are also found. The surface
+is then flood filled from the seed cells across neighbouring cells that
+cross the surface.
+
+Parts smaller than the component voxels (a few cells) may still be missed.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+//-----------------------------------------------------------------------------
+
+// seedCells is the spacing (in cells) of the seed line lattice.
+const seedCells = 8
+
+// surfaceTracker tracks the surface of an SDF3 through a uniform grid.
+type surfaceTracker struct {
+	s     SDF3
+	base  V3               // base coordinate of grid
+	inc   V3               // dx, dy, dz for each step
+	steps V3i              // number of x,y,z cells
+	cache map[V3i]float64  // cache of evaluated grid points
+	seen  map[V3i]struct{} // cells that have been queued
+	queue []V3i            // cells to be processed
+}
+
+func newSurfaceTracker(s SDF3, box Box3, step float64) *surfaceTracker {
+	size := box.Size()
+	steps := size.DivScalar(step).Ceil().ToV3i()
+	return &surfaceTracker{
+		s:     Compile3D(s),
+		base:  box.Min,
+		inc:   size.Div(steps.ToV3()),
+		steps: steps,
+		cache: make(map[V3i]float64),
+		seen:  make(map[V3i]struct{}),
+	}
+}
+
+// position returns the position of a grid point.
+func (t *surfaceTracker) position(v V3i) V3 {
+	return t.base.Add(v.ToV3().Mul(t.inc))
+}
+
+// evaluate returns the SDF3 value at a grid point.
+func (t *surfaceTracker) evaluate(v V3i) float64 {
+	if d, ok := t.cache[v]; ok {
+		return d
+	}
+	d := t.s.Evaluate(t.position(v))
+	t.cache[v] = d
+	return d
+}
+
+// push queues a cell (if it is within the grid and has not been seen).
+func (t *surfaceTracker) push(c V3i) {
+	if c[0] < 0 || c[1] < 0 || c[2] < 0 || c[0] >= t.steps[0] || c[1] >= t.steps[1] || c[2] >= t.steps[2] {
+		return
+	}
+	if _, ok := t.seen[c]; ok {
+		return
+	}
+	t.seen[c] = struct{}{}
+	t.queue = append(t.queue, c)
+}
+
+// seed queues the cells about a point near the surface.
+func (t *surfaceTracker) seed(p V3) {
+	c := p.Sub(t.base).Div(t.inc).ToV3i()
+	for i := -1; i <= 1; i++ {
+		for j := -1; j <= 1; j++ {
+			for k := -1; k <= 1; k++ {
+				t.push(c.Add(V3i{i, j, k}))
+			}
+		}
+	}
+}
+
+// traceLine sphere traces along a line (from p0 in direction dir, for length l)
+// and seeds the cells where the line passes close to the surface.
+func (t *surfaceTracker) traceLine(p0, dir V3, l float64) {
+	near := t.inc.MaxComponent()
+	x := 0.0
+	for x < l {
+		p := p0.Add(dir.MulScalar(x))
+		d := Abs(t.s.Evaluate(p))
+		if d <= near {
+			t.seed(p)
+			d = near
+		}
+		x += d
+	}
+}
+
+// findSeeds traces a lattice of lines through the grid to find seed cells,
+// and seeds the cells at the surface of each connected component.
+func (t *surfaceTracker) findSeeds() {
+	// component voxels are subdivided (see refineLevels), so they find parts
+	// of about one cell
+	cells := 1
+	for _, n := range t.steps {
+		if n>>refineLevels > cells {
+			cells = n >> refineLevels
+		}
+	}
+	for _, c := range Components3D(t.s, cells) {
+		t.seed(c.Surface)
+	}
+	size := t.inc.Mul(t.steps.ToV3())
+	length := [3]float64{size.X, size.Y, size.Z}
+	for axis := 0; axis < 3; axis++ {
+		// the line direction and the lattice axes
+		u, v := (axis+1)%3, (axis+2)%3
+		var dir V3i
+		dir[axis] = 1
+		for i := 0; i <= t.steps[u]; i += seedCells {
+			for j := 0; j <= t.steps[v]; j += seedCells {
+				var c V3i
+				c[u], c[v] = i, j
+				t.traceLine(t.position(c), dir.ToV3(), length[axis])
+			}
+		}
+	}
+}
+
+// processCell generates the triangles for a cell and queues the neighbouring
+// cells that share a face crossing the surface.
+func (t *surfaceTracker) processCell(c V3i, output chan<- *Triangle3) {
+	x0, y0, z0 := c[0], c[1], c[2]
+	x1, y1, z1 := x0+1, y0+1, z0+1
+	vi := [8]V3i{
+		{x0, y0, z0},
+		{x1, y0, z0},
+		{x1, y1, z0},
+		{x0, y1, z0},
+		{x0, y0, z1},
+		{x1, y0, z1},
+		{x1, y1, z1},
+		{x0, y1, z1}}
+	var corners [8]V3
+	var values [8]float64
+	for i, v := range vi {
+		corners[i] = t.position(v)
+		values[i] = t.evaluate(v)
+	}
+	for _, tri := range mcToTriangles(corners, values, 0) {
+		output <- tri
+	}
+	// the corners of each face and the neighbour across the face
+	faces := [6]struct {
+		idx [4]int
+		dc  V3i
+	}{
+		{[4]int{0, 3, 4, 7}, V3i{-1, 0, 0}},
+		{[4]int{1, 2, 5, 6}, V3i{1, 0, 0}},
+		{[4]int{0, 1, 4, 5}, V3i{0, -1, 0}},
+		{[4]int{2, 3, 6, 7}, V3i{0, 1, 0}},
+		{[4]int{0, 1, 2, 3}, V3i{0, 0, -1}},
+		{[4]int{4, 5, 6, 7}, V3i{0, 0, 1}},
+	}
+	for _, f := range faces {
+		n := 0
+		for _, i := range f.idx {
+			if values[i] < 0 {
+				n++
+			}
+		}
+		if n != 0 && n != 4 {
+			t.push(c.Add(f.dc))
+		}
+	}
+}
+
+// marchingCubesSurface generates a triangle mesh for an SDF3 using surface tracking.
+func marchingCubesSurface(s SDF3, resolution float64, output chan<- *Triangle3) {
+	// Scale the bounding box about the center to make sure the boundaries
+	// aren't on the object surface.
+	bb := s.BoundingBox().ScaleAboutCenter(1.01)
+	t := newSurfaceTracker(s, bb, resolution)
+	t.findSeeds()
+	for len(t.queue) > 0 {
+		c := t.queue[len(t.queue)-1]
+		t.queue = t.queue[:len(t.queue)-1]
+		t.processCell(c, output)
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -12,6 +12,7 @@ Uses octree space subdivision.
 package sdf
 
 import (
+	"context"
 	"math"
 	"sync"
 )
@@ -33,8 +34,10 @@ type dcache3 struct {
 	resolution float64         // size of smallest octree cube
 	hdiag      []float64       // lookup table of cube half diagonals
 	s          SDF3            // the SDF3 to be rendered
+	eval       SDF3            // the compiled SDF3 (for point evaluation)
 	cache      map[V3i]float64 // cache of distances
 	lock       sync.RWMutex    // lock the the cache during reads/writes
+	p          *progress       // progress/cancellation (optional)
 }
 
 func newDcache3(s SDF3, origin V3, resolution float64, n uint) *dcache3 {
@@ -45,13 +48,16 @@ func newDcache3(s SDF3, origin V3, resolution float64, n uint) *dcache3 {
 		resolution: resolution,
 		hdiag:      make([]float64, n),
 		s:          s,
+		eval:       Compile3D(s),
 		cache:      make(map[V3i]float64),
 	}
 	// build a lut for cube half diagonal lengths
+	// (scaled by the lipschitz bound, the largest center/corner distance change)
+	k := LipschitzK3(s)
 	for i := range dc.hdiag {
 		si := 1 << uint(i)
 		s := float64(si) * dc.resolution
-		dc.hdiag[i] = 0.5 * math.Sqrt(3.0*s*s)
+		dc.hdiag[i] = 0.5 * math.Sqrt(3.0*s*s) * k
 	}
 	return &dc
 }
@@ -79,7 +85,7 @@ func (dc *dcache3) evaluate(vi V3i) (V3, float64) {
 		return v, dist
 	}
 	// evaluate the SDF3
-	dist = dc.s.Evaluate(v)
+	dist = dc.eval.Evaluate(v)
 	// write it to the cache
 	dc.write(vi, dist)
 	return v, dist
@@ -91,12 +97,27 @@ func (dc *dcache3) isEmpty(c *cube) bool {
 	s := 1 << (c.n - 1) // half side
 	_, d := dc.evaluate(c.v.AddScalar(s))
 	// compare to the center/corner distance
-	return Abs(d) >= dc.hdiag[c.n]
+	if Abs(d) >= dc.hdiag[c.n] {
+		return true
+	}
+	// try interval evaluation over the cube
+	if _, ok := dc.s.(IntervalSDF3); ok {
+		side := float64(int(1)<<c.n) * dc.resolution
+		min := dc.origin.Add(c.v.ToV3().MulScalar(dc.resolution))
+		return isEmptyInterval(dc.s, Box3{min, min.AddScalar(side)})
+	}
+	return false
 }
 
 // Process a cube. Generate triangles, or more cubes.
 func (dc *dcache3) processCube(c *cube, output chan<- *Triangle3) {
-	if !dc.isEmpty(c) {
+	if dc.p.cancelled() {
+		return
+	}
+	if dc.isEmpty(c) {
+		// the number of minimum size cubes in this cube
+		dc.p.add(math.Ldexp(1, 3*int(c.n-1)))
+	} else {
 		if c.n == 1 {
 			// this cube is at the required resolution
 			c0, d0 := dc.evaluate(c.v.Add(V3i{0, 0, 0}))
@@ -113,6 +134,7 @@ func (dc *dcache3) processCube(c *cube, output chan<- *Triangle3) {
 			for _, t := range mcToTriangles(corners, values, 0) {
 				output <- t
 			}
+			dc.p.add(1)
 		} else {
 			// process the sub cubes
 			n := c.n - 1
@@ -134,6 +156,12 @@ func (dc *dcache3) processCube(c *cube, output chan<- *Triangle3) {
 
 // marchingCubesOctree generates a triangle mesh for an SDF3 using octree subdivision.
 func marchingCubesOctree(s SDF3, resolution float64, output chan<- *Triangle3) {
+	marchingCubesOctreeContext(context.Background(), s, resolution, output, nil)
+}
+
+// marchingCubesOctreeContext generates a triangle mesh for an SDF3 using octree
+// subdivision. Cancelling ctx stops the mesher, fn (optional) is called with the progress.
+func marchingCubesOctreeContext(ctx context.Context, s SDF3, resolution float64, output chan<- *Triangle3, fn ProgressFunc) error {
 	// Scale the bounding box about the center to make sure the boundaries
 	// aren't on the object surface.
 	bb := s.BoundingBox()
@@ -146,8 +174,10 @@ func marchingCubesOctree(s SDF3, resolution float64, output chan<- *Triangle3) {
 	levels := uint(math.Ceil(math.Log2(longAxis/resolution))) + 1
 	// create the distance cache
 	dc := newDcache3(s, bb.Min, resolution, levels)
+	dc.p = newProgress(ctx, fn, math.Ldexp(1, 3*int(levels-2)))
 	// process the octree, start at the top level
 	dc.processCube(&cube{V3i{0, 0, 0}, levels - 1}, output)
+	return dc.p.err()
 }
 
 //-----------------------------------------------------------------------------
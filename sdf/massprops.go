@@ -0,0 +1,124 @@
+//-----------------------------------------------------------------------------
+/*
+
+Mass Properties
+
+Estimate the volume, surface area, mass, center of mass and moment of
+inertia of an SDF3 by integrating over a uniform grid of cells.
+
+The SDF3 is sampled at each cell center. Cells with the surface passing
+through them are counted as partially full (the fraction is estimated from
+the distance to the surface) so the results converge smoothly as the
+resolution is reduced. The surface area is estimated from the volume of
+the cells near the surface, weighted by their distance to the surface.
+
+These estimates assume the SDF3 returns (approximately) the true distance
+near the surface.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"errors"
+	"fmt"
+)
+
+//-----------------------------------------------------------------------------
+
+// MassProperties are the mass properties of an SDF3.
+type MassProperties struct {
+	Volume   float64       `json:"volume"`   // volume
+	Area     float64       `json:"area"`     // surface area
+	Mass     float64       `json:"mass"`     // mass (volume * density)
+	Centroid V3            `json:"centroid"` // center of mass
+	Inertia  [3][3]float64 `json:"inertia"`  // inertia tensor about the center of mass
+}
+
+// String returns a printable mass properties report.
+func (m *MassProperties) String() string {
+	s := fmt.Sprintf("volume %g\n", m.Volume)
+	s += fmt.Sprintf("surface area %g\n", m.Area)
+	s += fmt.Sprintf("mass %g\n", m.Mass)
+	s += fmt.Sprintf("center of mass %g %g %g\n", m.Centroid.X, m.Centroid.Y, m.Centroid.Z)
+	s += "inertia tensor"
+	for _, row := range m.Inertia {
+		s += fmt.Sprintf("\n%g %g %g", row[0], row[1], row[2])
+	}
+	return s
+}
+
+// Properties3D returns the mass properties of an SDF3 with a uniform density.
+// The SDF3 is integrated over cubic cells with sides of resolution length.
+func Properties3D(s SDF3, density, resolution float64) (*MassProperties, error) {
+	if density <= 0 {
+		return nil, errors.New("density <= 0")
+	}
+	if resolution <= 0 {
+		return nil, errors.New("resolution <= 0")
+	}
+	// Grow the bounding box so the partially full cells are included. The
+	// moments are taken about the center of the box to limit cancellation.
+	h := resolution
+	bb := s.BoundingBox()
+	center := bb.Center()
+	n := bb.Size().AddScalar(2 * h).DivScalar(h).Ceil().ToV3i()
+	bb = NewBox3(center, n.ToV3().MulScalar(h))
+	dv := h * h * h
+	// volume integrals: 1, x, y, z, xx, yy, zz, xy, xz, yz
+	var v, area float64
+	var m1 V3
+	var xx, yy, zz, xy, xz, yz float64
+	for i := 0; i < n[0]; i++ {
+		for j := 0; j < n[1]; j++ {
+			for k := 0; k < n[2]; k++ {
+				p := bb.Min.Add(V3{float64(i) + 0.5, float64(j) + 0.5, float64(k) + 0.5}.MulScalar(h))
+				d := s.Evaluate(p)
+				// tent weighted cells within a cell of the surface
+				area += Max(1-Abs(d)/h, 0) * dv / h
+				// fraction of the cell that is inside
+				f := Clamp(0.5-d/h, 0, 1)
+				if f == 0 {
+					continue
+				}
+				w := f * dv
+				q := p.Sub(center)
+				v += w
+				m1 = m1.Add(q.MulScalar(w))
+				xx += w * q.X * q.X
+				yy += w * q.Y * q.Y
+				zz += w * q.Z * q.Z
+				xy += w * q.X * q.Y
+				xz += w * q.X * q.Z
+				yz += w * q.Y * q.Z
+			}
+		}
+	}
+	if v == 0 {
+		return nil, errors.New("zero volume")
+	}
+	c := m1.DivScalar(v)
+	// second moments about the centroid (a cell contributes h*h/12 on each axis)
+	k := h * h / 12
+	xx = xx/v - c.X*c.X + k
+	yy = yy/v - c.Y*c.Y + k
+	zz = zz/v - c.Z*c.Z + k
+	xy = xy/v - c.X*c.Y
+	xz = xz/v - c.X*c.Z
+	yz = yz/v - c.Y*c.Z
+	mass := v * density
+	return &MassProperties{
+		Volume:   v,
+		Area:     area,
+		Mass:     mass,
+		Centroid: center.Add(c),
+		Inertia: [3][3]float64{
+			{mass * (yy + zz), -mass * xy, -mass * xz},
+			{-mass * xy, mass * (xx + zz), -mass * yz},
+			{-mass * xz, -mass * yz, mass * (xx + yy)},
+		},
+	}, nil
+}
+
+//-----------------------------------------------------------------------------
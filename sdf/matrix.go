@@ -126,7 +126,7 @@ func Translate2d(v V2) M33 {
 }
 
 // Scale3d returns a 4x4 scaling matrix.
-// Scaling does not preserve distance. See: ScaleUniform3D()
+// Scaling does not preserve distance. See: ScaleUniform3D(), ScaleNonUniform3D()
 func Scale3d(v V3) M44 {
 	return M44{
 		v.X, 0, 0, 0,
@@ -487,3 +487,55 @@ func (a M22) Inverse() M22 {
 }
 
 //-----------------------------------------------------------------------------
+// Scale Factors
+// The singular values of the rotate/scale/shear part of a 4x4 matrix give
+// the minimum and maximum stretch applied to any vector. These are found as
+// the square roots of the eigenvalues of the symmetric matrix AᵀA.
+// See: https://en.wikipedia.org/wiki/Eigenvalue_algorithm#3%C3%973_matrices
+
+// ScaleFactors returns the minimum and maximum distance scaling of a 4x4 matrix.
+func (a M44) ScaleFactors() (float64, float64) {
+	// b = AᵀA (symmetric)
+	b00 := a.x00*a.x00 + a.x10*a.x10 + a.x20*a.x20
+	b11 := a.x01*a.x01 + a.x11*a.x11 + a.x21*a.x21
+	b22 := a.x02*a.x02 + a.x12*a.x12 + a.x22*a.x22
+	b01 := a.x00*a.x01 + a.x10*a.x11 + a.x20*a.x21
+	b02 := a.x00*a.x02 + a.x10*a.x12 + a.x20*a.x22
+	b12 := a.x01*a.x02 + a.x11*a.x12 + a.x21*a.x22
+
+	var eMin, eMax float64
+	p1 := b01*b01 + b02*b02 + b12*b12
+	if p1 == 0 {
+		// b is diagonal
+		eMin = Min(Min(b00, b11), b22)
+		eMax = Max(Max(b00, b11), b22)
+	} else {
+		q := (b00 + b11 + b22) / 3
+		p2 := (b00-q)*(b00-q) + (b11-q)*(b11-q) + (b22-q)*(b22-q) + 2*p1
+		p := math.Sqrt(p2 / 6)
+		// c = (b - qI) / p
+		c := M33{
+			(b00 - q) / p, b01 / p, b02 / p,
+			b01 / p, (b11 - q) / p, b12 / p,
+			b02 / p, b12 / p, (b22 - q) / p,
+		}
+		r := Clamp(c.Determinant()/2, -1, 1)
+		phi := math.Acos(r) / 3
+		eMax = q + 2*p*math.Cos(phi)
+		eMin = q + 2*p*math.Cos(phi+(Tau/3))
+	}
+	return math.Sqrt(Max(eMin, 0)), math.Sqrt(Max(eMax, 0))
+}
+
+// ScaleFactors returns the minimum and maximum distance scaling of a 3x3 matrix.
+func (a M33) ScaleFactors() (float64, float64) {
+	// b = AᵀA (symmetric 2x2)
+	b00 := a.x00*a.x00 + a.x10*a.x10
+	b11 := a.x01*a.x01 + a.x11*a.x11
+	b01 := a.x00*a.x01 + a.x10*a.x11
+	q := 0.5 * (b00 + b11)
+	r := math.Sqrt(0.25*(b00-b11)*(b00-b11) + b01*b01)
+	return math.Sqrt(Max(q-r, 0)), math.Sqrt(Max(q+r, 0))
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,116 @@
+//-----------------------------------------------------------------------------
+/*
+
+Mesh Statistics
+
+Quality metrics for a triangle mesh. Check a mesh before sending it to a
+printer (or slicer).
+
+Watertight: Each edge is shared by exactly two triangles with opposite
+directions. A mesh that isn't watertight has holes or inconsistent
+triangle orientations.
+
+Aspect Ratio: The longest edge over the shortest altitude, scaled so an
+equilateral triangle is 1. Long thin triangles have a large aspect ratio.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"fmt"
+	"math"
+)
+
+//-----------------------------------------------------------------------------
+
+// AspectRatioBins are the upper limits of the aspect ratio histogram bins.
+var AspectRatioBins = []float64{2, 4, 8, 16, math.Inf(1)}
+
+// MeshStatistics are the quality metrics for a triangle mesh.
+type MeshStatistics struct {
+	Triangles   int     `json:"triangles"`    // number of triangles
+	Area        float64 `json:"area"`         // surface area
+	Watertight  bool    `json:"watertight"`   // each edge is shared by two triangles (with opposite directions)
+	OpenEdges   int     `json:"open_edges"`   // edges without a matching opposite edge
+	Degenerate  int     `json:"degenerate"`   // number of zero area triangles
+	MinEdge     float64 `json:"min_edge"`     // minimum edge length
+	MaxEdge     float64 `json:"max_edge"`     // maximum edge length
+	AspectRatio []int   `json:"aspect_ratio"` // aspect ratio histogram (see AspectRatioBins), non-degenerate triangles
+}
+
+// aspectRatio returns the aspect ratio of a triangle (1 for an equilateral triangle).
+func aspectRatio(l [3]float64, area float64) float64 {
+	lmax := Max(l[0], Max(l[1], l[2]))
+	// shortest altitude = 2 * area / longest edge
+	h := 2 * area / lmax
+	return (math.Sqrt(3) / 2) * lmax / h
+}
+
+// MeshStats returns the quality metrics for a triangle mesh.
+func MeshStats(mesh []*Triangle3) *MeshStatistics {
+	s := MeshStatistics{
+		Triangles:   len(mesh),
+		MinEdge:     math.MaxFloat64,
+		AspectRatio: make([]int, len(AspectRatioBins)),
+	}
+	// directed edges (+1) and their opposites (-1) should cancel out
+	type edge struct {
+		a, b V3
+	}
+	edges := make(map[edge]int)
+	for _, t := range mesh {
+		var l [3]float64
+		for i := 0; i < 3; i++ {
+			a, b := t.V[i], t.V[(i+1)%3]
+			l[i] = b.Sub(a).Length()
+			s.MinEdge = Min(s.MinEdge, l[i])
+			s.MaxEdge = Max(s.MaxEdge, l[i])
+			if a != b {
+				edges[edge{a, b}]++
+				edges[edge{b, a}]--
+			}
+		}
+		area := 0.5 * t.V[1].Sub(t.V[0]).Cross(t.V[2].Sub(t.V[0])).Length()
+		s.Area += area
+		if area == 0 {
+			s.Degenerate++
+			continue
+		}
+		k := aspectRatio(l, area)
+		for i, limit := range AspectRatioBins {
+			if k < limit {
+				s.AspectRatio[i]++
+				break
+			}
+		}
+	}
+	for _, n := range edges {
+		if n > 0 {
+			s.OpenEdges += n
+		}
+	}
+	s.Watertight = s.OpenEdges == 0
+	if len(mesh) == 0 {
+		s.MinEdge = 0
+	}
+	return &s
+}
+
+// String returns a printable mesh statistics report.
+func (s *MeshStatistics) String() string {
+	r := fmt.Sprintf("triangles %d (%d degenerate)\n", s.Triangles, s.Degenerate)
+	r += fmt.Sprintf("surface area %g\n", s.Area)
+	r += fmt.Sprintf("watertight %t (%d open edges)\n", s.Watertight, s.OpenEdges)
+	r += fmt.Sprintf("edge length %g..%g\n", s.MinEdge, s.MaxEdge)
+	r += "aspect ratio"
+	lower := 1.0
+	for i, limit := range AspectRatioBins {
+		r += fmt.Sprintf(" [%g,%g):%d", lower, limit, s.AspectRatio[i])
+		lower = limit
+	}
+	return r
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,209 @@
+//-----------------------------------------------------------------------------
+/*
+
+CNC 2.5D Toolpaths
+
+Generate pocketing and profile toolpaths for an SDF2 region, for milling
+(or laser/router cutting) the 2d outputs of a model.
+
+pocket: clear the inside of the region with offset loops, starting in the
+middle and working out to the finishing pass half a tool diameter inside
+the boundary.
+
+profile: cut around the region, half a tool diameter outside the boundary
+(cut out a part) or inside the boundary (cut out a hole).
+
+The loop direction is set for climb or conventional milling with a
+clockwise (M3) spindle. The toolpaths are cut in depth steps and written
+as basic G-code.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+//-----------------------------------------------------------------------------
+
+// MillDirection is the direction of milling.
+type MillDirection int
+
+// Milling directions (for a clockwise spindle).
+const (
+	MillClimb        MillDirection = iota // the cutter teeth enter the material at the maximum chip thickness
+	MillConventional                      // the cutter teeth enter the material at zero chip thickness
+)
+
+// MillParms defines the parameters for CNC toolpaths.
+type MillParms struct {
+	ToolDiameter float64       // cutter diameter (mm)
+	Stepover     float64       // pocketing stepover as a fraction of the tool diameter (0..1]
+	Direction    MillDirection // climb or conventional milling
+	Depth        float64       // total cutting depth (mm)
+	StepDown     float64       // maximum cutting depth per pass (mm)
+	SafeZ        float64       // clearance height for travel moves (mm)
+	FeedRate     float64       // cutting feed rate (mm/min)
+	PlungeRate   float64       // plunge feed rate (mm/min)
+	SpindleSpeed float64       // spindle speed (rpm), 0 == no spindle commands
+	Resolution   float64       // contour resolution (mm), 0 == 1/20 of the tool diameter
+}
+
+// validate checks the milling parameters.
+func (k *MillParms) validate() error {
+	if k.ToolDiameter <= 0 {
+		return errors.New("tool diameter <= 0")
+	}
+	if k.Stepover <= 0 || k.Stepover > 1 {
+		return errors.New("stepover must be (0..1]")
+	}
+	if k.Depth <= 0 || k.StepDown <= 0 {
+		return errors.New("depth or step down <= 0")
+	}
+	if k.SafeZ <= 0 {
+		return errors.New("safe z <= 0")
+	}
+	if k.FeedRate <= 0 || k.PlungeRate <= 0 {
+		return errors.New("feed rate <= 0")
+	}
+	if k.Resolution < 0 {
+		return errors.New("resolution < 0")
+	}
+	return nil
+}
+
+// resolution returns the contour resolution.
+func (k *MillParms) resolution() float64 {
+	if k.Resolution == 0 {
+		return k.ToolDiameter / 20
+	}
+	return k.Resolution
+}
+
+// reverseLoops reverses the direction of toolpath loops.
+func reverseLoops(loops []V2Set) {
+	for _, v := range loops {
+		for i, j := 0, len(v)-1; i < j; i, j = i+1, j-1 {
+			v[i], v[j] = v[j], v[i]
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// PocketToolpath returns the toolpath loops to clear the inside of an SDF2
+// (in cutting order).
+func PocketToolpath(s SDF2, k *MillParms) ([]V2Set, error) {
+	if err := k.validate(); err != nil {
+		return nil, err
+	}
+	r := 0.5 * k.ToolDiameter
+	step := k.Stepover * k.ToolDiameter
+	// offset loops from the boundary inwards
+	var levels [][]V2Set
+	for d := r; ; d += step {
+		loops := insetContours(s, d, k.resolution())
+		if len(loops) == 0 {
+			break
+		}
+		levels = append(levels, loops)
+	}
+	if len(levels) == 0 {
+		return nil, errors.New("the tool doesn't fit in the pocket")
+	}
+	// cut from the middle out
+	var loops []V2Set
+	for i := len(levels) - 1; i >= 0; i-- {
+		loops = append(loops, levels[i]...)
+	}
+	// The contour loops have the region on the left, so the material
+	// (pocket walls) is on the right: climb milling.
+	if k.Direction == MillConventional {
+		reverseLoops(loops)
+	}
+	return loops, nil
+}
+
+// ProfileToolpath returns the toolpath loops to cut around an SDF2, outside
+// the boundary (cut out the part) or inside the boundary (cut out a hole).
+func ProfileToolpath(s SDF2, k *MillParms, outside bool) ([]V2Set, error) {
+	if err := k.validate(); err != nil {
+		return nil, err
+	}
+	r := 0.5 * k.ToolDiameter
+	d := r
+	if outside {
+		d = -r
+	}
+	loops := insetContours(s, d, k.resolution())
+	if len(loops) == 0 {
+		return nil, errors.New("no profile toolpath")
+	}
+	// The contour loops have the region on the left. Cutting outside,
+	// the part is on the left: conventional milling.
+	if (k.Direction == MillClimb) == outside {
+		reverseLoops(loops)
+	}
+	return loops, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// EncodeMillGCode writes toolpath loops to a writer as G-code.
+// Each loop is cut at each depth step.
+func EncodeMillGCode(w io.Writer, loops []V2Set, k *MillParms) error {
+	if err := k.validate(); err != nil {
+		return err
+	}
+	buf := bufio.NewWriter(w)
+	fmt.Fprintf(buf, "; generated by sdfx\n")
+	fmt.Fprintf(buf, "; tool diameter %g, depth %g\n", k.ToolDiameter, k.Depth)
+	fmt.Fprintf(buf, "G21 ; millimeters\nG90 ; absolute positioning\n")
+	fmt.Fprintf(buf, "G0 Z%.3f\n", k.SafeZ)
+	if k.SpindleSpeed > 0 {
+		fmt.Fprintf(buf, "M3 S%.0f\n", k.SpindleSpeed)
+	}
+	passes := int(math.Ceil(k.Depth/k.StepDown - tolerance))
+	for i := 0; i < passes; i++ {
+		z := -Min(float64(i+1)*k.StepDown, k.Depth)
+		fmt.Fprintf(buf, "; pass %d, z = %g\n", i, z)
+		for _, loop := range loops {
+			fmt.Fprintf(buf, "G0 X%.3f Y%.3f\n", loop[0].X, loop[0].Y)
+			fmt.Fprintf(buf, "G1 Z%.3f F%.0f\n", z, k.PlungeRate)
+			last := loop[0]
+			for j := 1; j <= len(loop); j++ {
+				p := loop[j%len(loop)]
+				if p.Sub(last).Length() < gcodeResolution {
+					continue
+				}
+				fmt.Fprintf(buf, "G1 X%.3f Y%.3f F%.0f\n", p.X, p.Y, k.FeedRate)
+				last = p
+			}
+			fmt.Fprintf(buf, "G0 Z%.3f\n", k.SafeZ)
+		}
+	}
+	if k.SpindleSpeed > 0 {
+		fmt.Fprintf(buf, "M5\n")
+	}
+	fmt.Fprintf(buf, "M2\n")
+	return buf.Flush()
+}
+
+// SaveMillGCode writes toolpath loops to a G-code file.
+func SaveMillGCode(path string, loops []V2Set, k *MillParms) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return EncodeMillGCode(file, loops, k)
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,32 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+//-----------------------------------------------------------------------------
+/*
+
+Memory Mapped Files
+
+There is no mmap support on this platform. The data is held in memory
+and written to the file when it is unmapped.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "os"
+
+//-----------------------------------------------------------------------------
+
+// mmapFile returns an in-memory buffer for the first size bytes of a file.
+func mmapFile(f *os.File, size int) ([]byte, error) {
+	return make([]byte, size), nil
+}
+
+// munmapFile writes the buffer back to the file.
+func munmapFile(f *os.File, b []byte) error {
+	_, err := f.WriteAt(b, 0)
+	return err
+}
+
+//-----------------------------------------------------------------------------
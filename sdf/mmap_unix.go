@@ -0,0 +1,31 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+//-----------------------------------------------------------------------------
+/*
+
+Memory Mapped Files
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"os"
+	"syscall"
+)
+
+//-----------------------------------------------------------------------------
+
+// mmapFile maps the first size bytes of a file into memory (read/write, shared).
+func mmapFile(f *os.File, size int) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+}
+
+// munmapFile unmaps a memory mapped file.
+func munmapFile(f *os.File, b []byte) error {
+	return syscall.Munmap(b)
+}
+
+//-----------------------------------------------------------------------------
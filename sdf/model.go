@@ -0,0 +1,303 @@
+//-----------------------------------------------------------------------------
+/*
+
+Model Files
+
+An SDF3 CSG tree can be saved as (and loaded from) a JSON document, for
+storing and diffing models and for tools that aren't written in Go.
+
+	{
+	  "schema": "sdfx-model",
+	  "version": 1,
+	  "model": {
+	    "type": "difference",
+	    "children": [
+	      {"type": "box", "size": {"X": 20, "Y": 20, "Z": 10}, "round": 1},
+	      {"type": "cylinder", "height": 12, "radius": 4}
+	    ]
+	  }
+	}
+
+Node types and their parameters:
+
+	box: size, round
+	sphere: radius
+	cylinder: height, radius, round
+	transform: matrix (4x4, row major), 1 child
+	translate: vector, 1 child
+	scale: scale (uniform), 1 child
+	offset: offset, 1 child
+	tag: tag, 1 child
+	union: 2 or more children
+	difference: 2 children (children[0] - children[1])
+	intersection: 2 children
+
+Only these SDF3s can be saved: boxes, spheres, cylinders, transforms,
+uniform scaling, offsets, tags, and unions, differences and intersections
+with the default (unblended) min/max. Saving returns an error for any other
+SDF3. A translate node is saved as a transform. Loading returns an error
+for unknown fields (e.g. a misspelled parameter).
+
+Only JSON is supported. sdfx has no YAML dependency, a YAML model has to be
+converted to JSON by the application.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+//-----------------------------------------------------------------------------
+
+const modelSchema = "sdfx-model"
+
+// ModelVersion is the version of the JSON model schema.
+const ModelVersion = 1
+
+// ModelNode is a node of an SDF3 CSG tree in a model file.
+type ModelNode struct {
+	Type     string       `json:"type"`               // node type
+	Size     *V3          `json:"size,omitempty"`     // box size
+	Radius   float64      `json:"radius,omitempty"`   // sphere/cylinder radius
+	Height   float64      `json:"height,omitempty"`   // cylinder height
+	Round    float64      `json:"round,omitempty"`    // box/cylinder edge rounding
+	Matrix   *[16]float64 `json:"matrix,omitempty"`   // transform matrix (row major)
+	Vector   *V3          `json:"vector,omitempty"`   // translation
+	Scale    float64      `json:"scale,omitempty"`    // uniform scale factor
+	Offset   float64      `json:"offset,omitempty"`   // distance offset
+	Tag      int          `json:"tag,omitempty"`      // material/color tag
+	Children []*ModelNode `json:"children,omitempty"` // child nodes
+}
+
+type jsonModel struct {
+	Schema  string     `json:"schema"`
+	Version int        `json:"version"`
+	Model   *ModelNode `json:"model"`
+}
+
+//-----------------------------------------------------------------------------
+
+// m44Array returns the elements of a 4x4 matrix (row major).
+func m44Array(m M44) *[16]float64 {
+	return &[16]float64{
+		m.x00, m.x01, m.x02, m.x03,
+		m.x10, m.x11, m.x12, m.x13,
+		m.x20, m.x21, m.x22, m.x23,
+		m.x30, m.x31, m.x32, m.x33,
+	}
+}
+
+// arrayM44 returns a 4x4 matrix from its elements (row major).
+func arrayM44(a *[16]float64) M44 {
+	return M44{
+		a[0], a[1], a[2], a[3],
+		a[4], a[5], a[6], a[7],
+		a[8], a[9], a[10], a[11],
+		a[12], a[13], a[14], a[15],
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// NewModelNode returns the model node for an SDF3 CSG tree.
+func NewModelNode(s SDF3) (*ModelNode, error) {
+	switch s := s.(type) {
+	case *BoxSDF3:
+		size := s.size.AddScalar(s.round).MulScalar(2)
+		return &ModelNode{Type: "box", Size: &size, Round: s.round}, nil
+	case *SphereSDF3:
+		return &ModelNode{Type: "sphere", Radius: s.radius}, nil
+	case *CylinderSDF3:
+		return &ModelNode{Type: "cylinder", Height: 2 * (s.height + s.round), Radius: s.radius + s.round, Round: s.round}, nil
+	case *TransformSDF3:
+		return newModelParent(&ModelNode{Type: "transform", Matrix: m44Array(s.matrix)}, s.sdf)
+	case *ScaleUniformSDF3:
+		return newModelParent(&ModelNode{Type: "scale", Scale: s.k}, s.sdf)
+	case *OffsetSDF3:
+		return newModelParent(&ModelNode{Type: "offset", Offset: s.offset}, s.sdf)
+	case *TagSDF3:
+		return newModelParent(&ModelNode{Type: "tag", Tag: s.tag}, s.sdf)
+	case *UnionSDF3:
+		if !sameFunc(s.min, Min) {
+			return nil, fmt.Errorf("blended %T can't be saved", s)
+		}
+		return newModelParent(&ModelNode{Type: "union"}, s.sdf...)
+	case *DifferenceSDF3:
+		if !sameFunc(s.max, Max) {
+			return nil, fmt.Errorf("blended %T can't be saved", s)
+		}
+		return newModelParent(&ModelNode{Type: "difference"}, s.s0, s.s1)
+	case *IntersectionSDF3:
+		if !sameFunc(s.max, Max) {
+			return nil, fmt.Errorf("blended %T can't be saved", s)
+		}
+		return newModelParent(&ModelNode{Type: "intersection"}, s.s0, s.s1)
+	}
+	return nil, fmt.Errorf("%T can't be saved", s)
+}
+
+// newModelParent adds the child nodes to a model node.
+func newModelParent(n *ModelNode, children ...SDF3) (*ModelNode, error) {
+	for _, x := range children {
+		c, err := NewModelNode(x)
+		if err != nil {
+			return nil, err
+		}
+		n.Children = append(n.Children, c)
+	}
+	return n, nil
+}
+
+// SDF3 returns the SDF3 CSG tree for a model node.
+func (n *ModelNode) SDF3() (SDF3, error) {
+	// check the number of children
+	children := 0
+	switch n.Type {
+	case "box", "sphere", "cylinder":
+	case "transform", "translate", "scale", "offset", "tag":
+		children = 1
+	case "difference", "intersection":
+		children = 2
+	case "union":
+		if len(n.Children) < 2 {
+			return nil, errors.New("union needs 2 or more children")
+		}
+		children = len(n.Children)
+	default:
+		return nil, fmt.Errorf("unknown model node type \"%s\"", n.Type)
+	}
+	if len(n.Children) != children {
+		return nil, fmt.Errorf("%s needs %d children", n.Type, children)
+	}
+	c := make([]SDF3, children)
+	for i, x := range n.Children {
+		if x == nil {
+			return nil, fmt.Errorf("%s has a nil child", n.Type)
+		}
+		s, err := x.SDF3()
+		if err != nil {
+			return nil, err
+		}
+		c[i] = s
+	}
+
+	switch n.Type {
+	case "box":
+		if n.Size == nil || n.Size.X <= 0 || n.Size.Y <= 0 || n.Size.Z <= 0 {
+			return nil, errors.New("bad box size")
+		}
+		if n.Round < 0 || 2*n.Round > n.Size.MinComponent() {
+			return nil, errors.New("bad box rounding")
+		}
+		return Box3D(*n.Size, n.Round), nil
+	case "sphere":
+		if n.Radius <= 0 {
+			return nil, errors.New("sphere radius <= 0")
+		}
+		return Sphere3D(n.Radius), nil
+	case "cylinder":
+		if n.Radius <= 0 || n.Height <= 0 {
+			return nil, errors.New("bad cylinder size")
+		}
+		if n.Round < 0 || n.Round > n.Radius || 2*n.Round > n.Height {
+			return nil, errors.New("bad cylinder rounding")
+		}
+		return Cylinder3D(n.Height, n.Radius, n.Round), nil
+	case "transform":
+		if n.Matrix == nil {
+			return nil, errors.New("transform has no matrix")
+		}
+		m := arrayM44(n.Matrix)
+		if m.Determinant() == 0 {
+			return nil, errors.New("transform matrix is singular")
+		}
+		return Transform3D(c[0], m), nil
+	case "translate":
+		if n.Vector == nil {
+			return nil, errors.New("translate has no vector")
+		}
+		return Transform3D(c[0], Translate3d(*n.Vector)), nil
+	case "scale":
+		if n.Scale <= 0 {
+			return nil, errors.New("scale <= 0")
+		}
+		return ScaleUniform3D(c[0], n.Scale), nil
+	case "offset":
+		return Offset3D(c[0], n.Offset), nil
+	case "tag":
+		if n.Tag <= 0 {
+			return nil, errors.New("tag <= 0")
+		}
+		return Tag3D(c[0], n.Tag), nil
+	case "union":
+		return Union3D(c...), nil
+	case "difference":
+		return Difference3D(c[0], c[1]), nil
+	}
+	return Intersect3D(c[0], c[1]), nil
+}
+
+//-----------------------------------------------------------------------------
+
+// EncodeModel writes an SDF3 CSG tree as a JSON model document.
+func EncodeModel(w io.Writer, s SDF3) error {
+	n, err := NewModelNode(s)
+	if err != nil {
+		return err
+	}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(&jsonModel{Schema: modelSchema, Version: ModelVersion, Model: n})
+}
+
+// DecodeModel reads an SDF3 CSG tree from a JSON model document.
+func DecodeModel(r io.Reader) (SDF3, error) {
+	var doc jsonModel
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if doc.Schema != modelSchema {
+		return nil, errors.New("not an sdfx model")
+	}
+	if doc.Version > ModelVersion {
+		return nil, fmt.Errorf("unsupported model version %d", doc.Version)
+	}
+	if doc.Model == nil {
+		return nil, errors.New("no model")
+	}
+	return doc.Model.SDF3()
+}
+
+// SaveModel saves an SDF3 CSG tree as a JSON model file.
+func SaveModel(s SDF3, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := EncodeModel(f, s); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadModel loads an SDF3 CSG tree from a JSON model file.
+func LoadModel(path string) (SDF3, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return DecodeModel(f)
+}
+
+//-----------------------------------------------------------------------------
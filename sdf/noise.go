@@ -0,0 +1,137 @@
+//-----------------------------------------------------------------------------
+/*
+
+Noise
+
+Perlin's gradient noise ("Improving Noise", 2002) and fractal noise (a sum of
+octaves of noise), for organic surfaces and terrain.
+
+The noise is smooth with a bounded gradient, so a noise displacement of an
+SDF3 can be given a conservative distance bound. The noise repeats every 256
+units.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"math"
+	"math/rand"
+)
+
+//-----------------------------------------------------------------------------
+
+// noiseSlope is a bound on the gradient of the noise (the maximum found by
+// sampling is about 3.2, this allows a margin).
+const noiseSlope = 4.0
+
+// noisePerm is the permutation used to hash the lattice points (repeated to avoid wrapping).
+var noisePerm [512]int
+
+func init() {
+	p := rand.New(rand.NewSource(1)).Perm(256)
+	for i := range noisePerm {
+		noisePerm[i] = p[i&255]
+	}
+}
+
+// noiseFade is the quintic fade curve 6t^5 - 15t^4 + 10t^3.
+func noiseFade(t float64) float64 {
+	return t * t * t * (t*(t*6-15) + 10)
+}
+
+// noiseGrad returns the dot product of a hashed gradient (one of the 12 cube
+// edge directions) and the offset from a lattice point.
+func noiseGrad(hash int, x, y, z float64) float64 {
+	switch hash & 15 {
+	case 0, 12:
+		return x + y
+	case 1, 14:
+		return -x + y
+	case 2:
+		return x - y
+	case 3:
+		return -x - y
+	case 4:
+		return x + z
+	case 5:
+		return -x + z
+	case 6:
+		return x - z
+	case 7:
+		return -x - z
+	case 8:
+		return y + z
+	case 9, 13:
+		return -y + z
+	case 10:
+		return y - z
+	}
+	return -y - z
+}
+
+// PerlinNoise3 returns the gradient noise at a point. The noise is zero at
+// integer points and within [-1, 1].
+func PerlinNoise3(p V3) float64 {
+	fx, fy, fz := math.Floor(p.X), math.Floor(p.Y), math.Floor(p.Z)
+	// lattice cell and offset within the cell
+	x, y, z := p.X-fx, p.Y-fy, p.Z-fz
+	i, j, k := int(fx)&255, int(fy)&255, int(fz)&255
+	u, v, w := noiseFade(x), noiseFade(y), noiseFade(z)
+	// hash the corners of the cell
+	pp := &noisePerm
+	a := pp[i] + j
+	aa := pp[a] + k
+	ab := pp[a+1] + k
+	b := pp[i+1] + j
+	ba := pp[b] + k
+	bb := pp[b+1] + k
+	// interpolate the corner contributions
+	return Mix(
+		Mix(
+			Mix(noiseGrad(pp[aa], x, y, z), noiseGrad(pp[ba], x-1, y, z), u),
+			Mix(noiseGrad(pp[ab], x, y-1, z), noiseGrad(pp[bb], x-1, y-1, z), u), v),
+		Mix(
+			Mix(noiseGrad(pp[aa+1], x, y, z-1), noiseGrad(pp[ba+1], x-1, y, z-1), u),
+			Mix(noiseGrad(pp[ab+1], x, y-1, z-1), noiseGrad(pp[bb+1], x-1, y-1, z-1), u), v), w)
+}
+
+// FractalNoise3 returns the sum of octaves of gradient noise at a point. Each
+// octave has twice the frequency and half the amplitude of the previous
+// octave. The sum is normalized to be within [-1, 1].
+func FractalNoise3(p V3, octaves int) float64 {
+	sum, amp, norm := 0.0, 1.0, 0.0
+	for i := 0; i < octaves; i++ {
+		sum += amp * PerlinNoise3(p)
+		norm += amp
+		p = p.MulScalar(2)
+		amp *= 0.5
+	}
+	return sum / norm
+}
+
+//-----------------------------------------------------------------------------
+
+// Noise3D displaces the surface of an SDF3 by fractal noise with a maximum
+// amplitude. The frequency is the number of noise features per unit length
+// (of the first octave).
+func Noise3D(sdf SDF3, amplitude, frequency float64, octaves int) SDF3 {
+	if amplitude <= 0 || frequency <= 0 {
+		panic("bad amplitude or frequency")
+	}
+	if octaves < 1 {
+		panic("octaves < 1")
+	}
+	// Each octave doubles the slope of the noise and halves its weight, so the
+	// slope of the sum is bounded by the slope of the first octave times the
+	// number of octaves (normalized).
+	norm := 2 * (1 - math.Pow(0.5, float64(octaves)))
+	slope := amplitude * frequency * noiseSlope * float64(octaves) / norm
+	fn := func(p V3) float64 {
+		return amplitude * Clamp(FractalNoise3(p.MulScalar(frequency), octaves), -1, 1)
+	}
+	return displace(sdf, fn, amplitude, slope)
+}
+
+//-----------------------------------------------------------------------------
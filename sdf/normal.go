@@ -0,0 +1,82 @@
+//-----------------------------------------------------------------------------
+/*
+
+Surface Normals
+
+The normal of an SDF is the normalized gradient of the distance function.
+By default the gradient is found with central differences. An SDF can
+provide an analytic gradient by implementing the Gradient2/Gradient3
+interface.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+//-----------------------------------------------------------------------------
+
+// Gradient2 is implemented by SDF2s with an analytic gradient.
+type Gradient2 interface {
+	Gradient(p V2) V2
+}
+
+// Gradient3 is implemented by SDF3s with an analytic gradient.
+type Gradient3 interface {
+	Gradient(p V3) V3
+}
+
+//-----------------------------------------------------------------------------
+
+// Normal2 returns the normal of an SDF2 at p (a zero vector if it is undefined).
+// The gradient is found with central differences of size eps, unless the
+// SDF2 has an analytic gradient.
+func Normal2(s SDF2, p V2, eps float64) V2 {
+	var n V2
+	if g, ok := s.(Gradient2); ok {
+		n = g.Gradient(p)
+	} else {
+		n = V2{
+			s.Evaluate(p.Add(V2{eps, 0})) - s.Evaluate(p.Sub(V2{eps, 0})),
+			s.Evaluate(p.Add(V2{0, eps})) - s.Evaluate(p.Sub(V2{0, eps})),
+		}
+	}
+	if n.Length() == 0 {
+		return V2{}
+	}
+	return n.Normalize()
+}
+
+// Normal3 returns the normal of an SDF3 at p (a zero vector if it is undefined).
+// The gradient is found with central differences of size eps, unless the
+// SDF3 has an analytic gradient.
+func Normal3(s SDF3, p V3, eps float64) V3 {
+	var n V3
+	if g, ok := s.(Gradient3); ok {
+		n = g.Gradient(p)
+	} else {
+		n = V3{
+			s.Evaluate(p.Add(V3{eps, 0, 0})) - s.Evaluate(p.Sub(V3{eps, 0, 0})),
+			s.Evaluate(p.Add(V3{0, eps, 0})) - s.Evaluate(p.Sub(V3{0, eps, 0})),
+			s.Evaluate(p.Add(V3{0, 0, eps})) - s.Evaluate(p.Sub(V3{0, 0, eps})),
+		}
+	}
+	if n.Length() == 0 {
+		return V3{}
+	}
+	return n.Normalize()
+}
+
+//-----------------------------------------------------------------------------
+// Analytic Gradients
+
+// Gradient returns the gradient of a 2d circle.
+func (s *CircleSDF2) Gradient(p V2) V2 {
+	return p
+}
+
+// Gradient returns the gradient of a sphere.
+func (s *SphereSDF3) Gradient(p V3) V3 {
+	return p
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,134 @@
+//-----------------------------------------------------------------------------
+/*
+
+OBJ Save
+
+Write a triangle mesh as a Wavefront OBJ file. The vertices are shared
+between the triangles (an indexed mesh), so the files are smaller than
+STL files and keep the connectivity of the mesh.
+
+A tagged mesh (see GenerateTaggedTriangles) is written with a group and
+material per tag, and the material colors are written to a material
+library (MTL) file.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"bufio"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//-----------------------------------------------------------------------------
+
+// SaveOBJ writes a triangle mesh to an OBJ file.
+func SaveOBJ(path string, mesh []*Triangle3) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return EncodeOBJ(file, mesh)
+}
+
+// EncodeOBJ writes a triangle mesh to a writer in OBJ format.
+func EncodeOBJ(w io.Writer, mesh []*Triangle3) error {
+	return encodeOBJ(w, "", map[int][]*Triangle3{0: mesh}, false)
+}
+
+// encodeOBJ writes triangle groups to a writer in OBJ format.
+// If materials is set each group uses the material for its tag.
+func encodeOBJ(w io.Writer, mtllib string, groups map[int][]*Triangle3, materials bool) error {
+	buf := bufio.NewWriter(w)
+
+	// indexed mesh
+	v := newWelder(0)
+	tags := sortedTags(groups)
+	faces := make([][][3]int, len(tags))
+	for i, tag := range tags {
+		faces[i] = make([][3]int, len(groups[tag]))
+		for j, t := range groups[tag] {
+			for k := range t.V {
+				faces[i][j][k], _ = v.index(t.V[k])
+			}
+		}
+	}
+
+	if mtllib != "" {
+		if _, err := fmt.Fprintf(buf, "mtllib %s\n", mtllib); err != nil {
+			return err
+		}
+	}
+	for _, p := range v.vertex {
+		if _, err := fmt.Fprintf(buf, "v %g %g %g\n", p.X, p.Y, p.Z); err != nil {
+			return err
+		}
+	}
+	for i, tag := range tags {
+		if materials {
+			if _, err := fmt.Fprintf(buf, "g tag%d\nusemtl tag%d\n", tag, tag); err != nil {
+				return err
+			}
+		}
+		// the vertex indices start at 1
+		for _, f := range faces[i] {
+			if _, err := fmt.Fprintf(buf, "f %d %d %d\n", f[0]+1, f[1]+1, f[2]+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	return buf.Flush()
+}
+
+//-----------------------------------------------------------------------------
+
+// EncodeTaggedOBJ writes a tagged triangle mesh to a writer in OBJ format.
+// Each tag is a group using the material "tag<N>" from the mtllib material library.
+func EncodeTaggedOBJ(w io.Writer, mtllib string, groups map[int][]*Triangle3) error {
+	return encodeOBJ(w, mtllib, groups, true)
+}
+
+// EncodeMTL writes the material library for a tagged triangle mesh.
+// Tags without a color use a default color.
+func EncodeMTL(w io.Writer, groups map[int][]*Triangle3, colors map[int]color.RGBA) error {
+	buf := bufio.NewWriter(w)
+	for _, tag := range sortedTags(groups) {
+		c := tagColor(tag, colors)
+		_, err := fmt.Fprintf(buf, "newmtl tag%d\nKd %.3f %.3f %.3f\n", tag,
+			float64(c.R)/255, float64(c.G)/255, float64(c.B)/255)
+		if err != nil {
+			return err
+		}
+	}
+	return buf.Flush()
+}
+
+// SaveTaggedOBJ writes a tagged triangle mesh to an OBJ file and its material
+// library to an MTL file (the same path with a .mtl extension).
+func SaveTaggedOBJ(path string, groups map[int][]*Triangle3, colors map[int]color.RGBA) error {
+	mtlPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".mtl"
+	mtl, err := os.Create(mtlPath)
+	if err != nil {
+		return err
+	}
+	defer mtl.Close()
+	if err := EncodeMTL(mtl, groups, colors); err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return EncodeTaggedOBJ(file, filepath.Base(mtlPath), groups)
+}
+
+//-----------------------------------------------------------------------------
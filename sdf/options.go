@@ -0,0 +1,172 @@
+//-----------------------------------------------------------------------------
+/*
+
+Constructor Options
+
+The NewXXX() constructors take the required parameters as arguments and
+the optional parameters as functional options. E.g.
+
+	s := NewBox3D(V3{10, 20, 30}, WithRound(2))
+
+New options can be added without changing the constructor signatures.
+The positional constructors (Box3D(), Cylinder3D(), etc.) are unchanged.
+
+A constructor panics if it's given an option that doesn't apply to it
+(e.g. NewBox3D() with WithTwist()), like any other bad parameter.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "fmt"
+
+//-----------------------------------------------------------------------------
+
+// Options are the optional parameters for the NewXXX() constructors.
+// Not all options apply to all constructors.
+type Options struct {
+	Round   float64 // edge rounding radius
+	Chamfer float64 // edge chamfer length
+	Twist   float64 // extrusion twist (radians)
+	Scale   V2      // extrusion top scaling (x,y)
+	Fillet  V2      // extrusion fillet radius (top, bottom)
+	set     option  // options that have been set
+}
+
+// option is a set of options.
+type option uint
+
+const (
+	optRound option = 1 << iota
+	optChamfer
+	optTwist
+	optScale
+	optFillet
+)
+
+// optionNames are the names of the options (in bit order).
+var optionNames = []string{"round", "chamfer", "twist", "scale", "fillet"}
+
+// Option sets an optional parameter.
+type Option func(*Options)
+
+// WithRound sets the edge rounding radius.
+func WithRound(round float64) Option {
+	return func(o *Options) {
+		o.Round = round
+		o.set |= optRound
+	}
+}
+
+// WithChamfer sets the edge chamfer length.
+func WithChamfer(chamfer float64) Option {
+	return func(o *Options) {
+		o.Chamfer = chamfer
+		o.set |= optChamfer
+	}
+}
+
+// WithTwist sets the twist of an extrusion.
+func WithTwist(twist float64) Option {
+	return func(o *Options) {
+		o.Twist = twist
+		o.set |= optTwist
+	}
+}
+
+// WithScale sets the x,y scaling of the top of an extrusion.
+func WithScale(scale V2) Option {
+	return func(o *Options) {
+		o.Scale = scale
+		o.set |= optScale
+	}
+}
+
+// WithFillet sets the radius of the top and bottom edge fillets of an extrusion.
+func WithFillet(top, bottom float64) Option {
+	return func(o *Options) {
+		o.Fillet = V2{top, bottom}
+		o.set |= optFillet
+	}
+}
+
+// newOptions returns the default options with the options applied.
+// It panics if an option doesn't apply to the named constructor.
+func newOptions(name string, allowed option, opts []Option) *Options {
+	o := &Options{Scale: V2{1, 1}}
+	for _, f := range opts {
+		f(o)
+	}
+	if bad := o.set &^ allowed; bad != 0 {
+		for i, n := range optionNames {
+			if bad&(1<<uint(i)) != 0 {
+				panic(fmt.Sprintf("%s doesn't take the %s option", name, n))
+			}
+		}
+	}
+	return o
+}
+
+//-----------------------------------------------------------------------------
+
+// NewBox2D returns a 2d box (options: round or chamfer).
+func NewBox2D(size V2, opts ...Option) SDF2 {
+	o := newOptions("NewBox2D", optRound|optChamfer, opts)
+	if o.Chamfer > 0 {
+		if o.Round > 0 {
+			panic("round and chamfer")
+		}
+		return ChamferBox2D(size, o.Chamfer)
+	}
+	return Box2D(size, o.Round)
+}
+
+// NewBox3D returns a 3d box (options: round).
+func NewBox3D(size V3, opts ...Option) SDF3 {
+	o := newOptions("NewBox3D", optRound, opts)
+	return Box3D(size, o.Round)
+}
+
+// NewCylinder3D returns a cylinder (options: round).
+func NewCylinder3D(height, radius float64, opts ...Option) SDF3 {
+	o := newOptions("NewCylinder3D", optRound, opts)
+	return Cylinder3D(height, radius, o.Round)
+}
+
+// NewCone3D returns a truncated cone (options: round).
+func NewCone3D(height, r0, r1 float64, opts ...Option) SDF3 {
+	o := newOptions("NewCone3D", optRound, opts)
+	return Cone3D(height, r0, r1, o.Round)
+}
+
+// NewExtrude3D returns a linear extrusion of an SDF2 (options: round, fillet, or twist and scale).
+func NewExtrude3D(sdf SDF2, height float64, opts ...Option) SDF3 {
+	o := newOptions("NewExtrude3D", optRound|optTwist|optScale|optFillet, opts)
+	twisted := o.Twist != 0
+	scaled := o.Scale != V2{1, 1}
+	filleted := o.Fillet != V2{0, 0}
+	if o.Round > 0 {
+		if twisted || scaled || filleted {
+			panic("round with twist, scale or fillet")
+		}
+		return ExtrudeRounded3D(sdf, height, o.Round)
+	}
+	if filleted {
+		if twisted || scaled {
+			panic("fillet with twist or scale")
+		}
+		return FilletExtrude3D(sdf, height, o.Fillet.X, o.Fillet.Y)
+	}
+	switch {
+	case twisted && scaled:
+		return ScaleTwistExtrude3D(sdf, height, o.Twist, o.Scale)
+	case twisted:
+		return TwistExtrude3D(sdf, height, o.Twist)
+	case scaled:
+		return ScaleExtrude3D(sdf, height, o.Scale)
+	}
+	return Extrude3D(sdf, height)
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,198 @@
+//-----------------------------------------------------------------------------
+/*
+
+Mesh Orientation
+
+Check the orientation of triangles against the SDF3 they were generated
+from. A correctly oriented triangle has its normal pointing out of the
+SDF3 (the distance increases along the normal).
+
+By default the STL renderers check every triangle and flip those with the
+wrong orientation. This catches sign convention bugs in user defined SDF3s
+before the mesh reaches a slicer. The check costs two evaluations of the
+SDF3 per triangle, so it can be limited to a random sample of the triangles
+(reported but not flipped), or turned off, with RenderOrient.
+
+An SDF3 that is negative outside of its bounding box has its sign inverted
+(a bug in a user defined SDF3). Triangles are oriented so the mesh is the
+outside of the bounding box rather than the inside.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+//-----------------------------------------------------------------------------
+
+// orienter checks triangle orientation against an SDF3.
+type orienter struct {
+	s    SDF3
+	sign float64 // -1 if the SDF3 sign is inverted
+}
+
+func newOrienter(s SDF3) *orienter {
+	o := orienter{s: s, sign: 1}
+	// sample points well outside the bounding box
+	inverted := true
+	for _, p := range s.BoundingBox().ScaleAboutCenter(2).Vertices() {
+		if s.Evaluate(p) >= 0 {
+			inverted = false
+			break
+		}
+	}
+	if inverted {
+		o.sign = -1
+	}
+	return &o
+}
+
+// OrientMode is the triangle orientation check done by the STL renderers.
+type OrientMode int
+
+// Triangle orientation checks.
+const (
+	OrientFlip   OrientMode = iota // check every triangle and flip those with the wrong orientation
+	OrientSample                   // check a random sample of the triangles and report those with the wrong orientation
+	OrientNone                     // don't check the triangle orientation
+)
+
+// RenderOrient is the triangle orientation check done by the STL renderers.
+var RenderOrient = OrientFlip
+
+// orientSample is the fraction of triangles (1 in n) checked by OrientSample.
+const orientSample = 64
+
+// wrong returns true if the triangle has the wrong orientation.
+func (o *orienter) wrong(t *Triangle3) bool {
+	e0 := t.V[1].Sub(t.V[0])
+	e1 := t.V[2].Sub(t.V[0])
+	n := e0.Cross(e1)
+	if n.Length() == 0 {
+		// degenerate triangle
+		return false
+	}
+	n = n.Normalize()
+	// Sample either side of the triangle center. The samples are close to
+	// the triangle so they don't cross thin walls or grooves.
+	c := t.V[0].Add(t.V[1]).Add(t.V[2]).DivScalar(3)
+	h := 0.01 * Max(Max(e0.Length(), e1.Length()), t.V[2].Sub(t.V[1]).Length())
+	dOut := o.s.Evaluate(c.Add(n.MulScalar(h)))
+	dIn := o.s.Evaluate(c.Sub(n.MulScalar(h)))
+	return o.sign*(dOut-dIn) < 0
+}
+
+// orient flips the triangle if it has the wrong orientation.
+// It returns true if the triangle was flipped.
+func (o *orienter) orient(t *Triangle3) bool {
+	if !o.wrong(t) {
+		return false
+	}
+	t.Flip()
+	return true
+}
+
+//-----------------------------------------------------------------------------
+
+// OrientTriangles checks the orientation of the triangles in a mesh generated
+// from an SDF3 and flips those that have the wrong orientation.
+// It returns the number of triangles flipped.
+func OrientTriangles(s SDF3, mesh []*Triangle3) int {
+	o := newOrienter(s)
+	n := 0
+	for _, t := range mesh {
+		if o.orient(t) {
+			n++
+		}
+	}
+	return n
+}
+
+// OrientHook returns a render hook that flips the triangles with the wrong
+// orientation. Every triangle is checked (two evaluations of the SDF3 each).
+func OrientHook(s SDF3) TriangleHook {
+	o := newOrienter(s)
+	return func(t *Triangle3) bool {
+		o.orient(t)
+		return true
+	}
+}
+
+// orientCount is the result of an orientation check.
+type orientCount struct {
+	mode    OrientMode
+	checked int // number of triangles checked
+	wrong   int // number of triangles with the wrong orientation
+}
+
+// check checks (and flips) the orientation of a triangle as per the mode.
+func (c *orientCount) check(o *orienter, t *Triangle3) {
+	switch c.mode {
+	case OrientFlip:
+		c.checked++
+		if o.orient(t) {
+			c.wrong++
+		}
+	case OrientSample:
+		if rand.Intn(orientSample) != 0 {
+			return
+		}
+		c.checked++
+		if o.wrong(t) {
+			c.wrong++
+		}
+	}
+}
+
+// checkMesh checks the orientation of the triangles in a mesh as per the mode.
+func checkMesh(s SDF3, mesh []*Triangle3, mode OrientMode) orientCount {
+	c := orientCount{mode: mode}
+	if mode == OrientNone {
+		return c
+	}
+	o := newOrienter(s)
+	for _, t := range mesh {
+		c.check(o, t)
+	}
+	return c
+}
+
+// checkTriangles returns a channel that checks the orientation of the
+// triangles written to it (as per the mode) and passes them to the output
+// channel. Once the returned channel is closed the result is written to the
+// count channel.
+func checkTriangles(s SDF3, output chan<- *Triangle3, mode OrientMode) (chan<- *Triangle3, <-chan orientCount) {
+	input := make(chan *Triangle3)
+	count := make(chan orientCount, 1)
+	go func() {
+		c := orientCount{mode: mode}
+		var o *orienter
+		if mode != OrientNone {
+			o = newOrienter(s)
+		}
+		for t := range input {
+			c.check(o, t)
+			output <- t
+		}
+		count <- c
+	}()
+	return input, count
+}
+
+// report reports the triangles that had the wrong orientation.
+func (c orientCount) report() {
+	if c.wrong == 0 {
+		return
+	}
+	if c.mode == OrientFlip {
+		fmt.Printf("flipped %d of %d triangles with the wrong orientation (check the SDF sign convention)\n", c.wrong, c.checked)
+		return
+	}
+	fmt.Printf("%d of %d sampled triangles have the wrong orientation (check the SDF sign convention, or use OrientFlip)\n", c.wrong, c.checked)
+}
+
+//-----------------------------------------------------------------------------
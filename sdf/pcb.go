@@ -0,0 +1,192 @@
+//-----------------------------------------------------------------------------
+/*
+
+PCB Mounts
+
+Standoffs, mounting pins and keepouts for mounting a printed circuit board
+in an enclosure, worked out from a simple description of the board: its
+size, thickness and mounting holes.
+
+The board is in the XY plane from (0, 0) to its size (the usual PCB
+coordinates) and sits on top of the standoffs. A standoff either has a
+pilot hole for a screw through the board, or a snap-fit pin: a split pin
+through the board hole with a barb that clips over the top of the board.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "errors"
+
+//-----------------------------------------------------------------------------
+
+// PCBMountStyle is the style of a PCB mount.
+type PCBMountStyle int
+
+// PCB mount styles.
+const (
+	PCBScrew PCBMountStyle = iota // standoff with a pilot hole for a screw
+	PCBSnap                       // standoff with a snap-fit pin
+)
+
+// PCBParms describes a printed circuit board and its mounts.
+type PCBParms struct {
+	Size             V2            // board size
+	Thickness        float64       // board thickness
+	Holes            V2Set         // mounting hole positions
+	HoleDiameter     float64       // mounting hole diameter
+	Keepout          float64       // component keepout diameter around the mounting holes
+	Mount            PCBMountStyle // screw or snap-fit mounts
+	Screw            string        // name of the screw thread for screw mounts (e.g. "M3x0.5")
+	StandoffHeight   float64       // height of the board (underside) above z = 0
+	StandoffDiameter float64       // standoff diameter (0 == the keepout diameter)
+	Webs             int           // number of gussets around the standoff base
+	Clearance        float64       // clearance of the snap-fit pins in the holes
+}
+
+// validate checks the PCB parameters.
+func (k *PCBParms) validate() error {
+	if k.Size.X <= 0 || k.Size.Y <= 0 || k.Thickness <= 0 {
+		return errors.New("bad board size")
+	}
+	if k.HoleDiameter <= 0 {
+		return errors.New("HoleDiameter <= 0")
+	}
+	if k.Keepout < 0 || k.StandoffDiameter < 0 || k.Clearance < 0 || k.Webs < 0 {
+		return errors.New("bad keepout, standoff, web or clearance size")
+	}
+	if k.StandoffHeight <= 0 {
+		return errors.New("StandoffHeight <= 0")
+	}
+	if k.standoffDiameter() <= k.HoleDiameter {
+		return errors.New("the standoff diameter must be larger than the hole diameter")
+	}
+	if 2*k.Clearance >= 0.5*k.HoleDiameter {
+		return errors.New("Clearance is too large for the hole")
+	}
+	for _, p := range k.Holes {
+		if p.X < 0 || p.Y < 0 || p.X > k.Size.X || p.Y > k.Size.Y {
+			return errors.New("mounting hole is outside the board")
+		}
+	}
+	return nil
+}
+
+// standoffDiameter returns the standoff diameter.
+func (k *PCBParms) standoffDiameter() float64 {
+	if k.StandoffDiameter == 0 {
+		return k.Keepout
+	}
+	return k.StandoffDiameter
+}
+
+//-----------------------------------------------------------------------------
+
+// PCBOutline2D returns the outline of a board (with the mounting holes).
+func PCBOutline2D(k *PCBParms) (SDF2, error) {
+	if err := k.validate(); err != nil {
+		return nil, err
+	}
+	board := Transform2D(Box2D(k.Size, 0), Translate2d(k.Size.MulScalar(0.5)))
+	if len(k.Holes) != 0 {
+		board = Difference2D(board, MultiCircle2D(0.5*k.HoleDiameter, k.Holes))
+	}
+	return board, nil
+}
+
+// PCBKeepout2D returns the component keepouts around the mounting holes of a board.
+func PCBKeepout2D(k *PCBParms) (SDF2, error) {
+	if err := k.validate(); err != nil {
+		return nil, err
+	}
+	if len(k.Holes) == 0 || k.Keepout == 0 {
+		return nil, errors.New("no keepouts")
+	}
+	return MultiCircle2D(0.5*k.Keepout, k.Holes), nil
+}
+
+// PCBBoard3D returns a board in its mounted position (e.g. to check the fit in an enclosure).
+func PCBBoard3D(k *PCBParms) (SDF3, error) {
+	board, err := PCBOutline2D(k)
+	if err != nil {
+		return nil, err
+	}
+	return prism(board, k.StandoffHeight, k.StandoffHeight+k.Thickness), nil
+}
+
+//-----------------------------------------------------------------------------
+
+// PCBStandoff3D returns a single board mount at the origin, from z = 0 to
+// the board (screw mounts) or to the top of the snap-fit pin. The standoff
+// is a Standoff3D pillar.
+func PCBStandoff3D(k *PCBParms) (SDF3, error) {
+	if err := k.validate(); err != nil {
+		return nil, err
+	}
+	h := k.StandoffHeight
+	sd := k.standoffDiameter()
+	sp := StandoffParms{
+		PillarHeight:   h,
+		PillarDiameter: sd,
+		NumberWebs:     k.Webs,
+		WebHeight:      0.5 * h,
+		WebDiameter:    2 * sd,
+		WebWidth:       0.2 * sd,
+	}
+
+	switch k.Mount {
+	case PCBScrew:
+		t, err := ThreadLookup(k.Screw)
+		if err != nil {
+			return nil, err
+		}
+		// a pilot hole for the screw thread, leave a solid base
+		pilotR := 0.85 * t.Radius
+		if 2*pilotR >= sd {
+			return nil, errors.New("the standoff is too small for the screw")
+		}
+		sp.HoleDiameter = 2 * pilotR
+		sp.HoleDepth = h - Min(0.25*h, 0.5*sd)
+	case PCBSnap:
+		// the pin is added to the pillar below
+	default:
+		return nil, errors.New("bad mount style")
+	}
+	standoff := Transform3D(Standoff3D(&sp), Translate3d(V3{0, 0, 0.5 * h}))
+
+	if k.Mount == PCBSnap {
+		// a pin through the hole with a barb over the top of the board
+		d := k.HoleDiameter
+		pinR := 0.5*d - k.Clearance
+		lip := 0.15 * d
+		z1 := h + k.Thickness
+		pin := prism(Circle2D(pinR), h, z1)
+		barb := Cone3D(d, pinR+lip, 0.5*pinR, 0)
+		barb = Transform3D(barb, Translate3d(V3{0, 0, z1 + 0.5*d}))
+		standoff = Union3D(standoff, pin, barb)
+		// the slot lets the barb halves close to pass through the hole
+		slot := Box3D(V3{2.5 * lip, d + 2*lip, k.Thickness + 2*d}, 0)
+		slot = Transform3D(slot, Translate3d(V3{0, 0, h + 0.5*k.Thickness + d}))
+		standoff = Difference3D(standoff, slot)
+	}
+	return standoff, nil
+}
+
+// PCBMounts3D returns the board mounts at the mounting holes of a board.
+func PCBMounts3D(k *PCBParms) (SDF3, error) {
+	s, err := PCBStandoff3D(k)
+	if err != nil {
+		return nil, err
+	}
+	if len(k.Holes) == 0 {
+		return nil, errors.New("no mounting holes")
+	}
+	mounts := make([]SDF3, len(k.Holes))
+	for i, p := range k.Holes {
+		mounts[i] = Transform3D(s, Translate3d(V3{p.X, p.Y, 0}))
+	}
+	return Union3D(mounts...), nil
+}
+
+//-----------------------------------------------------------------------------
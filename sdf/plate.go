@@ -0,0 +1,184 @@
+//-----------------------------------------------------------------------------
+/*
+
+Build Plate Layout
+
+Arrange multiple parts on one or more printer build plates.
+
+The parts are placed using their bounding box footprints, so parts can't
+collide. The footprints are packed into shelves (rows) across the plate,
+tallest footprints first. When a plate is full a new plate is started.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+//-----------------------------------------------------------------------------
+
+// PlateParms defines the build plate for a layout.
+type PlateParms struct {
+	Size    V2      // x,y size of the build plate
+	Spacing float64 // minimum gap between parts (and the plate edge)
+	Rotate  bool    // allow parts to be rotated 90 degrees about the z-axis
+}
+
+// Placement is the position of a part on a build plate.
+type Placement struct {
+	Plate  int  // build plate index
+	Matrix M44  // transform from part to plate coordinates
+	Rotate bool // is the part rotated 90 degrees about the z-axis?
+}
+
+// shelf is a row of parts across a build plate.
+type shelf struct {
+	y, h float64 // y position and height of the shelf
+	x    float64 // next free x position
+}
+
+// plate is the shelves of a build plate.
+type plate struct {
+	shelves []shelf
+	y       float64 // next free y position
+}
+
+// place finds a position for a w x h footprint on the plate.
+func (p *plate) place(w, h float64, size V2) (V2, bool) {
+	for i := range p.shelves {
+		s := &p.shelves[i]
+		if h <= s.h && s.x+w <= size.X {
+			pos := V2{s.x, s.y}
+			s.x += w
+			return pos, true
+		}
+	}
+	if p.y+h > size.Y || w > size.X {
+		return V2{}, false
+	}
+	p.shelves = append(p.shelves, shelf{y: p.y, h: h, x: w})
+	pos := V2{0, p.y}
+	p.y += h
+	return pos, true
+}
+
+//-----------------------------------------------------------------------------
+
+// LayoutPlates returns the build plate placements for a set of parts,
+// given the part bounding boxes. The bottom of each part is placed on
+// the build plate (z = 0), the plate is from (0,0) to k.Size.
+func LayoutPlates(parts []Box3, k *PlateParms) ([]Placement, error) {
+	if k.Size.X <= 0 || k.Size.Y <= 0 {
+		return nil, errors.New("bad plate size")
+	}
+	if k.Spacing < 0 {
+		return nil, errors.New("Spacing < 0")
+	}
+	// Each footprint includes the spacing on one side, the usable plate
+	// area is reduced by the spacing on the other side.
+	size := k.Size.SubScalar(k.Spacing)
+
+	// work out the footprints (and rotations) of the parts
+	type footprint struct {
+		idx    int
+		w, h   float64
+		rotate bool
+	}
+	fp := make([]footprint, len(parts))
+	for i, bb := range parts {
+		s := bb.Size()
+		f := footprint{i, s.X + k.Spacing, s.Y + k.Spacing, false}
+		fits := f.w <= size.X && f.h <= size.Y
+		fitsRotated := f.h <= size.X && f.w <= size.Y
+		if !fits && !(k.Rotate && fitsRotated) {
+			return nil, fmt.Errorf("part %d does not fit on the build plate", i)
+		}
+		// rotate to put the long side along the shelf
+		if k.Rotate && fitsRotated && (!fits || f.h > f.w) {
+			f.w, f.h, f.rotate = f.h, f.w, true
+		}
+		fp[i] = f
+	}
+	// tallest footprints first
+	sort.SliceStable(fp, func(i, j int) bool { return fp[i].h > fp[j].h })
+
+	placements := make([]Placement, len(parts))
+	var plates []*plate
+	for _, f := range fp {
+		var pos V2
+		n := 0
+		for ; n < len(plates); n++ {
+			var ok bool
+			if pos, ok = plates[n].place(f.w, f.h, size); ok {
+				break
+			}
+		}
+		if n == len(plates) {
+			plates = append(plates, &plate{})
+			pos, _ = plates[n].place(f.w, f.h, size)
+		}
+		// move the part from its bounding box to the plate position
+		m := Identity3d()
+		if f.rotate {
+			m = RotateZ(DtoR(90))
+		}
+		bb := m.MulBox(parts[f.idx])
+		ofs := V3{pos.X + k.Spacing, pos.Y + k.Spacing, 0}.Sub(bb.Min)
+		placements[f.idx] = Placement{
+			Plate:  n,
+			Matrix: Translate3d(ofs).Mul(m),
+			Rotate: f.rotate,
+		}
+	}
+	return placements, nil
+}
+
+// Plate3D arranges a set of SDF3 parts on build plates.
+// It returns an SDF3 for each build plate.
+func Plate3D(parts []SDF3, k *PlateParms) ([]SDF3, error) {
+	boxes := make([]Box3, len(parts))
+	for i, s := range parts {
+		boxes[i] = s.BoundingBox()
+	}
+	placements, err := LayoutPlates(boxes, k)
+	if err != nil {
+		return nil, err
+	}
+	var plates [][]SDF3
+	for i, p := range placements {
+		for p.Plate >= len(plates) {
+			plates = append(plates, nil)
+		}
+		plates[p.Plate] = append(plates[p.Plate], Transform3D(parts[i], p.Matrix))
+	}
+	s := make([]SDF3, len(plates))
+	for i, parts := range plates {
+		s[i] = Union3D(parts...)
+	}
+	return s, nil
+}
+
+// RenderSTLPlates arranges a set of SDF3 parts on build plates and renders
+// each build plate as an STL file (prefix_N.stl).
+func RenderSTLPlates(
+	parts []SDF3, // parts to arrange
+	k *PlateParms, // build plate parameters
+	meshCells int, // number of cells on the longest axis of the plate. e.g 400
+	prefix string, // filename prefix
+) error {
+	plates, err := Plate3D(parts, k)
+	if err != nil {
+		return err
+	}
+	for i, s := range plates {
+		RenderSTL(s, meshCells, fmt.Sprintf("%s_%d.stl", prefix, i))
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
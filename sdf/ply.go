@@ -0,0 +1,121 @@
+//-----------------------------------------------------------------------------
+/*
+
+PLY Save
+
+Write a triangle mesh as a binary (little endian) PLY file. The vertices
+are shared between the triangles (an indexed mesh) and can have normals
+and colors, for use in MeshLab, Blender, etc.
+
+The vertex normals are the SDF gradient at each vertex, so they are the
+normals of the smooth surface rather than an average of the normals of the
+faces around the vertex (which shows the facets of the mesh).
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"os"
+)
+
+//-----------------------------------------------------------------------------
+
+// PLYParms defines the optional vertex data for a PLY file.
+type PLYParms struct {
+	Normals SDF3                  // vertex normals are the gradient of this SDF3 (nil == no normals)
+	Color   func(p V3) color.RGBA // vertex color (nil == no colors)
+}
+
+// EncodePLY writes a triangle mesh to a writer in binary PLY format.
+func EncodePLY(w io.Writer, mesh []*Triangle3, k *PLYParms) error {
+	// indexed mesh
+	v := newWelder(0)
+	faces := make([][3]int, len(mesh))
+	for i, t := range mesh {
+		for j := range t.V {
+			faces[i][j], _ = v.index(t.V[j])
+		}
+	}
+
+	buf := bufio.NewWriter(w)
+	fmt.Fprintf(buf, "ply\nformat binary_little_endian 1.0\ncomment sdfx\n")
+	fmt.Fprintf(buf, "element vertex %d\n", len(v.vertex))
+	fmt.Fprintf(buf, "property float x\nproperty float y\nproperty float z\n")
+	size := 12
+	var eps float64
+	if k.Normals != nil {
+		fmt.Fprintf(buf, "property float nx\nproperty float ny\nproperty float nz\n")
+		size += 12
+		// central difference step for the gradient
+		eps = 1e-4 * k.Normals.BoundingBox().Size().Length()
+	}
+	if k.Color != nil {
+		fmt.Fprintf(buf, "property uchar red\nproperty uchar green\nproperty uchar blue\nproperty uchar alpha\n")
+		size += 4
+	}
+	fmt.Fprintf(buf, "element face %d\n", len(faces))
+	fmt.Fprintf(buf, "property list uchar int vertex_indices\n")
+	fmt.Fprintf(buf, "end_header\n")
+
+	le := binary.LittleEndian
+	putV3 := func(b []byte, p V3) {
+		le.PutUint32(b[0:], math.Float32bits(float32(p.X)))
+		le.PutUint32(b[4:], math.Float32bits(float32(p.Y)))
+		le.PutUint32(b[8:], math.Float32bits(float32(p.Z)))
+	}
+	b := make([]byte, size)
+	for _, p := range v.vertex {
+		putV3(b, p)
+		i := 12
+		if k.Normals != nil {
+			putV3(b[i:], Normal3(k.Normals, p, eps))
+			i += 12
+		}
+		if k.Color != nil {
+			c := k.Color(p)
+			b[i], b[i+1], b[i+2], b[i+3] = c.R, c.G, c.B, c.A
+		}
+		if _, err := buf.Write(b); err != nil {
+			return err
+		}
+	}
+	f := make([]byte, 13)
+	f[0] = 3
+	for _, t := range faces {
+		le.PutUint32(f[1:], uint32(t[0]))
+		le.PutUint32(f[5:], uint32(t[1]))
+		le.PutUint32(f[9:], uint32(t[2]))
+		if _, err := buf.Write(f); err != nil {
+			return err
+		}
+	}
+
+	return buf.Flush()
+}
+
+// SavePLY writes a triangle mesh to a binary PLY file.
+func SavePLY(path string, mesh []*Triangle3, k *PLYParms) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return EncodePLY(file, mesh, k)
+}
+
+// RenderPLY meshes an SDF3 and writes it to a binary PLY file with vertex
+// normals (from the SDF3 gradient) and optional vertex colors.
+func RenderPLY(s SDF3, meshCells int, path string, vertexColor func(p V3) color.RGBA) error {
+	mesh := GenerateTriangles(s, meshCells)
+	return SavePLY(path, mesh, &PLYParms{Normals: s, Color: vertexColor})
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,104 @@
+//-----------------------------------------------------------------------------
+/*
+
+Buffer Pools
+
+The meshers use large temporary buffers (the SDF values for a layer of the
+grid, batches of points for parallel evaluation, intermediate values for
+batch evaluation). The buffers are reused from pools rather than allocated
+for each layer of each mesh, to reduce the garbage collection during large
+meshing runs.
+
+The output slices are pre-sized with an estimate of the number of
+triangles/lines from the surface area (perimeter) of the bounding box.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "sync"
+
+//-----------------------------------------------------------------------------
+
+// float64Pool is a pool of *[]float64 buffers.
+var float64Pool sync.Pool
+
+// getFloat64s returns a float64 buffer of length n from the pool.
+func getFloat64s(n int) []float64 {
+	if x, ok := float64Pool.Get().(*[]float64); ok && cap(*x) >= n {
+		return (*x)[:n]
+	}
+	return make([]float64, n)
+}
+
+// putFloat64s returns a float64 buffer to the pool.
+func putFloat64s(x []float64) {
+	if x != nil {
+		float64Pool.Put(&x)
+	}
+}
+
+// v3Pool is a pool of *[]V3 buffers.
+var v3Pool sync.Pool
+
+// getV3s returns a V3 buffer of length n from the pool.
+func getV3s(n int) []V3 {
+	if x, ok := v3Pool.Get().(*[]V3); ok && cap(*x) >= n {
+		return (*x)[:n]
+	}
+	return make([]V3, n)
+}
+
+// putV3s returns a V3 buffer to the pool.
+func putV3s(x []V3) {
+	if x != nil {
+		v3Pool.Put(&x)
+	}
+}
+
+// evalBatchSize is the number of points in a batch for parallel evaluation.
+// Performance doesn't seem to improve past 100.
+const evalBatchSize = 100
+
+// v3BatchPool is a pool of *[]V3 evaluation batches.
+var v3BatchPool = sync.Pool{
+	New: func() interface{} {
+		x := make([]V3, 0, evalBatchSize)
+		return &x
+	},
+}
+
+// getV3Batch returns an empty evaluation batch from the pool.
+func getV3Batch() []V3 {
+	return (*v3BatchPool.Get().(*[]V3))[:0]
+}
+
+// putV3Batch returns an evaluation batch to the pool.
+func putV3Batch(x []V3) {
+	v3BatchPool.Put(&x)
+}
+
+//-----------------------------------------------------------------------------
+
+// maxEstimate limits the pre-sized output slices (the estimates are for
+// solid objects, a mostly empty bounding box has far less output).
+const maxEstimate = 1 << 20
+
+// estimateTriangles returns an estimate of the number of triangles in a mesh
+// of an SDF3 (about 1 triangle per cell of the bounding box surface).
+func estimateTriangles(bb Box3, resolution float64) int {
+	s := bb.Size().DivScalar(resolution)
+	n := 2 * (s.X*s.Y + s.Y*s.Z + s.Z*s.X)
+	return int(Clamp(n, 0, maxEstimate))
+}
+
+// estimateLines returns an estimate of the number of line segments for the
+// boundary of an SDF2 (about 1 line per cell of the bounding box perimeter).
+func estimateLines(bb Box2, resolution float64) int {
+	s := bb.Size().DivScalar(resolution)
+	n := 2 * (s.X + s.Y)
+	return int(Clamp(n, 0, maxEstimate))
+}
+
+//-----------------------------------------------------------------------------
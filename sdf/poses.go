@@ -0,0 +1,437 @@
+//-----------------------------------------------------------------------------
+/*
+
+Stable Poses
+
+Find the orientations a part can rest in on a flat surface. These are
+suggestions for print orientations and packaging.
+
+A rigid part rests on a face of its convex hull. The rest is stable if
+the center of mass projects (along the face normal) into the face. The
+poses are ranked by the support area (the area of the hull face) and then
+by the height of the center of mass above the surface. Large support areas
+and low centers of mass are more stable.
+
+The convex hull is found (quickhull) from the vertices of a mesh of the
+part, the center of mass assumes a uniform density. The mesh only
+approximates the part (e.g. the edges are chamfered), so hull triangles
+within a mesh cell of a face plane are merged into the face, and a pose is
+only stable if the center of mass is at least a mesh cell inside the face.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+//-----------------------------------------------------------------------------
+// Convex Hull
+
+// hullFace is a triangle of a convex hull.
+type hullFace struct {
+	v       [3]int
+	n       V3      // outward unit normal
+	d       float64 // plane offset (n.p = d)
+	outside []int   // points outside of the face
+	dead    bool
+}
+
+// distance returns the distance of a point above the face plane.
+func (f *hullFace) distance(p V3) float64 {
+	return f.n.Dot(p) - f.d
+}
+
+// newHullFace returns a face with vertices a, b, c (counter-clockwise from outside).
+func newHullFace(points []V3, a, b, c int) *hullFace {
+	n := points[b].Sub(points[a]).Cross(points[c].Sub(points[a]))
+	if n.Length() != 0 {
+		n = n.Normalize()
+	}
+	return &hullFace{v: [3]int{a, b, c}, n: n, d: n.Dot(points[a])}
+}
+
+// removeIndex removes a value from a list of indices.
+func removeIndex(list []int, x int) []int {
+	for i, y := range list {
+		if y == x {
+			return append(list[:i], list[i+1:]...)
+		}
+	}
+	return list
+}
+
+// hullHorizon returns the hull faces visible from a point (starting with
+// face f, a face is visible if the point is more than eps above it) and the
+// horizon, the loop of edges bounding the visible faces.
+// The horizon is nil if the visible faces aren't bounded by a single simple
+// loop, a cone from the point to the horizon would not close the hull.
+func hullHorizon(edges map[[2]int]*hullFace, f *hullFace, p V3, eps float64) ([]*hullFace, [][2]int) {
+	visible := []*hullFace{f}
+	seen := map[*hullFace]bool{f: true}
+	var horizon [][2]int
+	for n := 0; n < len(visible); n++ {
+		g := visible[n]
+		for j := 0; j < 3; j++ {
+			a, b := g.v[j], g.v[(j+1)%3]
+			h := edges[[2]int{b, a}]
+			if h == nil || h.dead {
+				// the hull isn't closed
+				return nil, nil
+			}
+			if seen[h] {
+				continue
+			}
+			if h.distance(p) > eps {
+				seen[h] = true
+				visible = append(visible, h)
+			}
+		}
+	}
+	// the horizon edges, in the order of the visible faces
+	next := make(map[int]int)
+	for _, g := range visible {
+		for j := 0; j < 3; j++ {
+			a, b := g.v[j], g.v[(j+1)%3]
+			if seen[edges[[2]int{b, a}]] {
+				continue
+			}
+			if _, ok := next[a]; ok {
+				// a vertex is on the horizon twice
+				return nil, nil
+			}
+			next[a] = b
+			horizon = append(horizon, [2]int{a, b})
+		}
+	}
+	// the horizon is a single loop
+	if len(horizon) < 3 {
+		return nil, nil
+	}
+	v := horizon[0][0]
+	for n := 1; ; n++ {
+		var ok bool
+		if v, ok = next[v]; !ok || n > len(horizon) {
+			return nil, nil
+		}
+		if v == horizon[0][0] {
+			if n != len(horizon) {
+				return nil, nil
+			}
+			break
+		}
+	}
+	return visible, horizon
+}
+
+// convexHull3 returns the triangles of the convex hull of a set of points.
+// Points within eps of the hull are treated as on the hull.
+func convexHull3(points []V3, eps float64) [][3]int {
+	if len(points) < 4 {
+		return nil
+	}
+	// initial tetrahedron: extreme points on x, then the furthest points
+	// from the line and the plane
+	i0, i1 := 0, 0
+	for i, p := range points {
+		if p.X < points[i0].X {
+			i0 = i
+		}
+		if p.X > points[i1].X {
+			i1 = i
+		}
+	}
+	line := points[i1].Sub(points[i0])
+	if line.Length() <= eps {
+		return nil
+	}
+	i2, dMax := -1, eps
+	for i, p := range points {
+		d := p.Sub(points[i0]).Cross(line).Length() / line.Length()
+		if d > dMax {
+			i2, dMax = i, d
+		}
+	}
+	if i2 < 0 {
+		return nil
+	}
+	base := newHullFace(points, i0, i1, i2)
+	i3, dMax := -1, eps
+	for i, p := range points {
+		d := Abs(base.distance(p))
+		if d > dMax {
+			i3, dMax = i, d
+		}
+	}
+	if i3 < 0 {
+		return nil
+	}
+	if base.distance(points[i3]) > 0 {
+		i1, i2 = i2, i1
+	}
+	faces := []*hullFace{
+		newHullFace(points, i0, i1, i2),
+		newHullFace(points, i0, i3, i1),
+		newHullFace(points, i1, i3, i2),
+		newHullFace(points, i2, i3, i0),
+	}
+	// directed edge to face
+	edges := make(map[[2]int]*hullFace)
+	addFace := func(f *hullFace) {
+		for j := 0; j < 3; j++ {
+			edges[[2]int{f.v[j], f.v[(j+1)%3]}] = f
+		}
+	}
+	for _, f := range faces {
+		addFace(f)
+	}
+	// assign the points to faces
+	assign := func(candidates []int, faces []*hullFace) {
+		for _, i := range candidates {
+			for _, f := range faces {
+				if f.distance(points[i]) > eps {
+					f.outside = append(f.outside, i)
+					break
+				}
+			}
+		}
+	}
+	all := make([]int, len(points))
+	for i := range all {
+		all[i] = i
+	}
+	assign(all, faces)
+
+	stack := append([]*hullFace{}, faces...)
+	for len(stack) > 0 {
+		f := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if f.dead || len(f.outside) == 0 {
+			continue
+		}
+		// the furthest point
+		p, dMax := -1, 0.0
+		for _, i := range f.outside {
+			if d := f.distance(points[i]); d > dMax {
+				p, dMax = i, d
+			}
+		}
+		// find the faces visible from the point
+		visible, horizon := hullHorizon(edges, f, points[p], eps)
+		if horizon == nil {
+			// The visible faces aren't bounded by a single loop of edges (the
+			// point is nearly coplanar with some of the faces). Include the
+			// nearly coplanar faces in the visible faces.
+			visible, horizon = hullHorizon(edges, f, points[p], -eps)
+		}
+		if horizon == nil {
+			// skip the point
+			f.outside = removeIndex(f.outside, p)
+			stack = append(stack, f)
+			continue
+		}
+		for _, g := range visible {
+			g.dead = true
+		}
+		// replace the visible faces with a cone to the point
+		var cone []*hullFace
+		for _, e := range horizon {
+			g := newHullFace(points, e[0], e[1], p)
+			addFace(g)
+			cone = append(cone, g)
+		}
+		var orphans []int
+		for _, g := range visible {
+			for _, i := range g.outside {
+				if i != p {
+					orphans = append(orphans, i)
+				}
+			}
+			g.outside = nil
+		}
+		assign(orphans, cone)
+		faces = append(faces, cone...)
+		stack = append(stack, cone...)
+	}
+
+	var hull [][3]int
+	for _, f := range faces {
+		if !f.dead {
+			hull = append(hull, f.v)
+		}
+	}
+	return hull
+}
+
+//-----------------------------------------------------------------------------
+
+// Pose is a stable resting orientation of a part.
+type Pose struct {
+	Normal    V3      // outward normal of the resting face (before transformation)
+	Transform M44     // moves the part to rest on the z = 0 plane
+	Area      float64 // support area (area of the resting face)
+	Height    float64 // height of the center of mass above the plane
+	Margin    float64 // distance from the projected center of mass to the edge of the resting face
+}
+
+// restTransform returns the transform that rests a face with normal n and
+// offset d on the z = 0 plane.
+func restTransform(n V3, d float64) M44 {
+	down := V3{0, 0, -1}
+	var r M44
+	axis := n.Cross(down)
+	switch {
+	case axis.Length() > 1e-9:
+		r = Rotate3d(axis.Normalize(), math.Acos(Clamp(n.Dot(down), -1, 1)))
+	case n.Z < 0:
+		r = Identity3d()
+	default:
+		r = RotateX(Pi)
+	}
+	return Translate3d(V3{0, 0, d}).Mul(r)
+}
+
+// pointInTriangle returns true if p (on the triangle plane) is inside the triangle.
+func pointInTriangle(p, a, b, c, n V3) bool {
+	return b.Sub(a).Cross(p.Sub(a)).Dot(n) >= 0 &&
+		c.Sub(b).Cross(p.Sub(b)).Dot(n) >= 0 &&
+		a.Sub(c).Cross(p.Sub(c)).Dot(n) >= 0
+}
+
+// segmentDistance returns the distance from p to the line segment ab.
+func segmentDistance(p, a, b V3) float64 {
+	ab := b.Sub(a)
+	t := Clamp(p.Sub(a).Dot(ab)/ab.Length2(), 0, 1)
+	return p.Sub(a.Add(ab.MulScalar(t))).Length()
+}
+
+// StablePoses returns the stable resting orientations of an SDF3 on a plane,
+// most stable first. The SDF3 is meshed with meshCells cells on the longest
+// axis to find the convex hull and center of mass.
+func StablePoses(s SDF3, meshCells int) ([]Pose, error) {
+	resolution := s.BoundingBox().Size().MaxComponent() / float64(meshCells)
+	mass, err := Properties3D(s, 1, resolution)
+	if err != nil {
+		return nil, err
+	}
+	com := mass.Centroid
+
+	// unique mesh vertices
+	w := newWelder(0)
+	for _, t := range GenerateTriangles(s, meshCells) {
+		for _, v := range t.V {
+			w.index(v)
+		}
+	}
+	points := w.vertex
+	// Mesh vertices have many coplanar (and collinear) subsets, which make
+	// the hull numerically degenerate. Jitter the points by a very small
+	// amount so the point-plane tests are well clear of the tolerance.
+	size := s.BoundingBox().Size().Length()
+	r := rand.New(rand.NewSource(1))
+	for i, p := range points {
+		points[i] = p.Add(V3{r.Float64(), r.Float64(), r.Float64()}.SubScalar(0.5).MulScalar(1e-6 * size))
+	}
+	hull := convexHull3(points, 1e-12*size)
+
+	// merge the coplanar hull triangles into faces
+	normal := func(t [3]int) V3 {
+		return points[t[1]].Sub(points[t[0]]).Cross(points[t[2]].Sub(points[t[0]]))
+	}
+	edgeTri := make(map[[2]int]int)
+	for i, t := range hull {
+		for j := 0; j < 3; j++ {
+			edgeTri[[2]int{t[j], t[(j+1)%3]}] = i
+		}
+	}
+	group := make([]int, len(hull))
+	for i := range group {
+		group[i] = -1
+	}
+	// Start the faces from the largest triangles, so the small triangles
+	// on the chamfered mesh edges are merged into the faces next to them.
+	seeds := make([]int, len(hull))
+	areas := make([]float64, len(hull))
+	for i := range hull {
+		seeds[i] = i
+		areas[i] = normal(hull[i]).Length()
+	}
+	sort.SliceStable(seeds, func(i, j int) bool { return areas[seeds[i]] > areas[seeds[j]] })
+	var poses []Pose
+	for _, seed := range seeds {
+		if group[seed] >= 0 {
+			continue
+		}
+		n0 := normal(hull[seed])
+		if n0.Length() == 0 {
+			continue
+		}
+		n0 = n0.Normalize()
+		d := n0.Dot(points[hull[seed][0]])
+		// flood fill the triangles within a mesh cell of the seed plane
+		coplanar := func(t [3]int) bool {
+			for _, i := range t {
+				if d-n0.Dot(points[i]) > resolution {
+					return false
+				}
+			}
+			return normal(t).Dot(n0) > 0
+		}
+		tris := []int{seed}
+		group[seed] = seed
+		for k := 0; k < len(tris); k++ {
+			t := hull[tris[k]]
+			for j := 0; j < 3; j++ {
+				i, ok := edgeTri[[2]int{t[(j+1)%3], t[j]}]
+				if !ok || group[i] >= 0 || !coplanar(hull[i]) {
+					continue
+				}
+				group[i] = seed
+				tris = append(tris, i)
+			}
+		}
+		// face area (projected on the seed plane), projected center of mass and boundary
+		area := 0.0
+		p := com.Sub(n0.MulScalar(n0.Dot(com) - d))
+		inside := false
+		margin := math.MaxFloat64
+		for _, i := range tris {
+			t := hull[i]
+			a, b, c := points[t[0]], points[t[1]], points[t[2]]
+			area += 0.5 * normal(t).Dot(n0)
+			if pointInTriangle(p, a, b, c, n0) {
+				inside = true
+			}
+			for j := 0; j < 3; j++ {
+				// a boundary edge has its neighbour in another face
+				if group[edgeTri[[2]int{t[(j+1)%3], t[j]}]] != seed {
+					margin = Min(margin, segmentDistance(p, points[t[j]], points[t[(j+1)%3]]))
+				}
+			}
+		}
+		if !inside || margin < resolution {
+			continue
+		}
+		poses = append(poses, Pose{
+			Normal:    n0,
+			Transform: restTransform(n0, d),
+			Area:      area,
+			Height:    d - n0.Dot(com),
+			Margin:    margin,
+		})
+	}
+
+	sort.SliceStable(poses, func(i, j int) bool {
+		if Abs(poses[i].Area-poses[j].Area) > 1e-6*Max(poses[i].Area, poses[j].Area) {
+			return poses[i].Area > poses[j].Area
+		}
+		return poses[i].Height < poses[j].Height
+	})
+	return poses, nil
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,75 @@
+//-----------------------------------------------------------------------------
+/*
+
+Progress and Cancellation
+
+Meshing can take minutes for a complex model. The Context versions of the
+mesh generation and render functions take a context (cancel the context to
+stop the operation) and an optional progress callback (to show a progress
+bar).
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "context"
+
+//-----------------------------------------------------------------------------
+
+// ProgressFunc is called during a long operation with the fraction of the
+// operation completed (0..1) and the number of mesh cells processed.
+type ProgressFunc func(fraction float64, cells int)
+
+// progressStep is the minimum fraction between progress callbacks.
+const progressStep = 0.01
+
+// progress tracks the progress of an operation.
+// A nil progress is never cancelled and doesn't report.
+type progress struct {
+	ctx   context.Context
+	fn    ProgressFunc
+	total float64 // total number of cells
+	cells float64 // number of cells processed
+	next  float64 // fraction for the next callback
+}
+
+func newProgress(ctx context.Context, fn ProgressFunc, total float64) *progress {
+	return &progress{ctx: ctx, fn: fn, total: total}
+}
+
+// cancelled returns true if the operation has been cancelled.
+func (p *progress) cancelled() bool {
+	if p == nil {
+		return false
+	}
+	select {
+	case <-p.ctx.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// add records processed cells and calls the progress callback.
+func (p *progress) add(cells float64) {
+	if p == nil || p.fn == nil {
+		return
+	}
+	p.cells += cells
+	fraction := Min(p.cells/p.total, 1)
+	if fraction >= p.next {
+		p.fn(fraction, int(p.cells))
+		p.next = fraction + progressStep
+	}
+}
+
+// err returns the context error (if the operation was cancelled).
+func (p *progress) err() error {
+	if p == nil {
+		return nil
+	}
+	return p.ctx.Err()
+}
+
+//-----------------------------------------------------------------------------
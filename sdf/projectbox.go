@@ -0,0 +1,135 @@
+//-----------------------------------------------------------------------------
+/*
+
+Project Box
+
+A 2 part enclosure: an open topped base and a lid. The lid has a lip that
+fits inside the walls of the base. Screw bosses in the base take screws
+through the lid, the boss and hole sizes are worked out from a standard
+screw thread (so the box dimensions are in the units of the thread). The lid
+can have a pattern of ventilation slots.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "errors"
+
+//-----------------------------------------------------------------------------
+
+// ProjectBoxParms defines the parameters for a project box.
+type ProjectBoxParms struct {
+	Size       V3      // outer dimensions of the closed box
+	Wall       float64 // wall and floor thickness
+	Rounding   float64 // radius of the vertical corners
+	Lid        float64 // lid thickness
+	Lip        float64 // depth of the lid lip (0 == no lip)
+	Clearance  float64 // fit clearance between the lid lip and the walls
+	Screw      string  // name of the boss screw thread (e.g. "M3x0.5"), "" == no bosses
+	Bosses     V2Set   // boss positions (nil == in the corners)
+	VentSlots  int     // number of ventilation slots in the lid (0 == none)
+	VentWidth  float64 // width of a ventilation slot
+	VentLength float64 // length of a ventilation slot (along y)
+}
+
+// prism returns an SDF3 extruded from an SDF2 between z0 and z1.
+func prism(s SDF2, z0, z1 float64) SDF3 {
+	return Transform3D(Extrude3D(s, z1-z0), Translate3d(V3{0, 0, 0.5 * (z0 + z1)}))
+}
+
+// ProjectBox returns the base and the lid of a project box. The base sits on
+// z = 0, the lid is in its closed position.
+func ProjectBox(k *ProjectBoxParms) ([]SDF3, error) {
+	// validate parameters
+	if k.Size.X <= 0 || k.Size.Y <= 0 || k.Size.Z <= 0 {
+		return nil, errors.New("bad box size")
+	}
+	if k.Wall <= 0 {
+		return nil, errors.New("Wall <= 0")
+	}
+	inner := V2{k.Size.X, k.Size.Y}.SubScalar(2 * k.Wall)
+	if inner.X <= 0 || inner.Y <= 0 {
+		return nil, errors.New("Wall is too thick for the box size")
+	}
+	if k.Rounding < 0 || k.Rounding > 0.5*Min(k.Size.X, k.Size.Y) {
+		return nil, errors.New("bad Rounding")
+	}
+	if k.Lid <= 0 || k.Lip < 0 {
+		return nil, errors.New("bad lid size")
+	}
+	if k.Clearance < 0 {
+		return nil, errors.New("Clearance < 0")
+	}
+	// height of the base
+	h := k.Size.Z - k.Lid
+	if h-k.Lip <= k.Wall {
+		return nil, errors.New("the box is too shallow for the lid")
+	}
+	if k.VentSlots < 0 || (k.VentSlots > 0 && (k.VentWidth <= 0 || k.VentLength < k.VentWidth)) {
+		return nil, errors.New("bad ventilation slot parameters")
+	}
+
+	// the inside of the lip
+	lipInner := inner.SubScalar(2 * (k.Clearance + k.Wall))
+	if k.Lip > 0 && (lipInner.X <= 0 || lipInner.Y <= 0) {
+		return nil, errors.New("the box is too small for the lid lip")
+	}
+
+	outer2d := Box2D(V2{k.Size.X, k.Size.Y}, k.Rounding)
+	innerRounding := Max(0, k.Rounding-k.Wall)
+	outer := prism(outer2d, 0, h)
+	base := Difference3D(outer, prism(Box2D(inner, innerRounding), k.Wall, h+k.Wall))
+	lid := prism(outer2d, h, k.Size.Z)
+
+	if k.Lip > 0 {
+		lipSize := inner.SubScalar(2 * k.Clearance)
+		lip := Difference2D(Box2D(lipSize, Max(0, innerRounding-k.Clearance)), Box2D(lipInner, Max(0, innerRounding-k.Clearance-k.Wall)))
+		lid = Union3D(lid, prism(lip, h-k.Lip, h))
+	}
+
+	if k.Screw != "" {
+		t, err := ThreadLookup(k.Screw)
+		if err != nil {
+			return nil, err
+		}
+		// bosses: a pilot hole for the screw thread, a wall around it
+		bossR := t.Radius + k.Wall
+		pilotR := 0.85 * t.Radius
+		clearR := 1.1 * t.Radius
+		bosses := k.Bosses
+		if bosses == nil {
+			x, y := 0.5*inner.X-bossR, 0.5*inner.Y-bossR
+			if x <= 0 || y <= 0 {
+				return nil, errors.New("the box is too small for the bosses")
+			}
+			bosses = V2Set{{-x, -y}, {x, -y}, {x, y}, {-x, y}}
+		}
+		base = Union3D(base, Intersect3D(prism(MultiCircle2D(bossR, bosses), k.Wall, h), outer))
+		base = Difference3D(base, prism(MultiCircle2D(pilotR, bosses), 2*k.Wall, h+k.Wall))
+		// the lip clears the bosses, the screws go through the lid
+		lid = Difference3D(lid, prism(MultiCircle2D(bossR+k.Clearance, bosses), h-k.Lip-k.Wall, h))
+		lid = Difference3D(lid, prism(MultiCircle2D(clearR, bosses), h-k.Wall, k.Size.Z+k.Wall))
+	}
+
+	if k.VentSlots > 0 {
+		// parallel slots (along y) centered on the lid
+		pitch := 2 * k.VentWidth
+		w := float64(k.VentSlots-1)*pitch + k.VentWidth
+		space := inner
+		if k.Lip > 0 {
+			space = lipInner
+		}
+		if w > space.X || k.VentLength > space.Y {
+			return nil, errors.New("the ventilation slots don't fit in the lid")
+		}
+		slot := Box2D(V2{k.VentWidth, k.VentLength}, 0.5*k.VentWidth)
+		x0 := -0.5 * float64(k.VentSlots-1) * pitch
+		slots := Array2D(Transform2D(slot, Translate2d(V2{x0, 0})), V2i{k.VentSlots, 1}, V2{pitch, 0})
+		lid = Difference3D(lid, prism(slots, h-k.Wall, k.Size.Z+k.Wall))
+	}
+
+	return []SDF3{base, lid}, nil
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,404 @@
+//-----------------------------------------------------------------------------
+/*
+
+3D Image Rendering
+
+Render an SDF3 to a PNG image by sphere tracing (ray marching) the
+distance field. No mesh is generated, so it's a quick way to look at a
+model.
+
+The shading is Lambert (single bounce, with shadows) and ambient
+occlusion. The normals are the SDF gradient and the ambient occlusion is
+estimated from SDF samples along the normal (a surface point near other
+surfaces has distances less than the distance from the point).
+
+The camera, light, image size, anti-aliasing samples, floor and material
+color are set with RenderOptions. DefaultRenderOptions frames the bounding
+box of the model. RenderPreview is a fast low resolution render for
+checking a model while iterating on the design.
+
+RenderTurntable orbits the camera (and light) around the model and writes
+a numbered PNG sequence or an animated GIF.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+//-----------------------------------------------------------------------------
+
+// maxMarchSteps is the maximum number of steps along a ray.
+const maxMarchSteps = 512
+
+// occlusionSamples is the number of SDF samples for ambient occlusion.
+const occlusionSamples = 5
+
+// RenderOptions defines the camera, lighting and output for Render().
+type RenderOptions struct {
+	Eye     V3         // camera position
+	Target  V3         // camera look at position
+	Up      V3         // camera up direction
+	FOV     float64    // vertical field of view (radians)
+	Size    V2i        // image width, height (pixels)
+	Samples int        // samples per pixel on each axis (anti-aliasing), e.g. 2 == 4 samples per pixel
+	Light   V3         // direction to the light
+	Floor   bool       // render a floor (with shadows) under the model
+	AO      bool       // ambient occlusion
+	Color   color.RGBA // material color
+	Path    string     // output filename
+}
+
+// DefaultRenderOptions returns render options that frame the bounding box of an SDF3.
+func DefaultRenderOptions(s SDF3) *RenderOptions {
+	bb := s.BoundingBox()
+	fov := DtoR(40)
+	// the bounding sphere fills the view
+	distance := 1.1 * 0.5 * bb.Size().Length() / math.Sin(0.5*fov)
+	return &RenderOptions{
+		Eye:     bb.Center().Add(V3{1, -1.5, 1}.Normalize().MulScalar(distance)),
+		Target:  bb.Center(),
+		Up:      V3{0, 0, 1},
+		FOV:     fov,
+		Size:    V2i{800, 600},
+		Samples: 2,
+		Light:   V3{-1, -2, 3},
+		Floor:   true,
+		AO:      true,
+		Color:   color.RGBA{0x4a, 0x90, 0xd9, 0xff},
+		Path:    "render.png",
+	}
+}
+
+// validate checks the render options.
+func (o *RenderOptions) validate() error {
+	if o.Size[0] <= 0 || o.Size[1] <= 0 {
+		return errors.New("image size <= 0")
+	}
+	if o.Samples < 1 {
+		return errors.New("samples < 1")
+	}
+	if o.FOV <= 0 || o.FOV >= Pi {
+		return errors.New("field of view must be (0..Pi)")
+	}
+	forward := o.Target.Sub(o.Eye)
+	if forward.Length() == 0 {
+		return errors.New("eye == target")
+	}
+	if forward.Cross(o.Up).Length() == 0 {
+		return errors.New("up is parallel to the view direction")
+	}
+	if o.Light.Length() == 0 {
+		return errors.New("light direction is zero")
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// tracer holds the state for tracing the rays of an image.
+type tracer struct {
+	s          SDF3
+	k          float64 // lipschitz bound of the SDF3
+	o          *RenderOptions
+	bb         Box3    // bounding box of the SDF3 (with a margin)
+	floor      float64 // z height of the floor
+	light      V3      // unit direction to the light
+	pixelAngle float64 // angular size of a pixel
+	aoStep     float64 // distance between ambient occlusion samples
+}
+
+// boxIntersect returns the range of ray distances within the bounding box.
+func (t *tracer) boxIntersect(eye, dir V3) (float64, float64, bool) {
+	tMin, tMax := 0.0, math.MaxFloat64
+	lo, hi := t.bb.Min, t.bb.Max
+	// eye, direction, box min, box max on each axis
+	for _, a := range [3][4]float64{
+		{eye.X, dir.X, lo.X, hi.X},
+		{eye.Y, dir.Y, lo.Y, hi.Y},
+		{eye.Z, dir.Z, lo.Z, hi.Z},
+	} {
+		if a[1] == 0 {
+			if a[0] < a[2] || a[0] > a[3] {
+				return 0, 0, false
+			}
+			continue
+		}
+		t0, t1 := (a[2]-a[0])/a[1], (a[3]-a[0])/a[1]
+		if t0 > t1 {
+			t0, t1 = t1, t0
+		}
+		tMin = Max(tMin, t0)
+		tMax = Min(tMax, t1)
+	}
+	return tMin, tMax, tMin <= tMax
+}
+
+// march returns the distance along a ray to the surface of the SDF3.
+func (t *tracer) march(eye, dir V3) (float64, bool) {
+	tMin, tMax, ok := t.boxIntersect(eye, dir)
+	if !ok {
+		return 0, false
+	}
+	if math.IsInf(t.k, 1) {
+		return t.marchFixed(eye, dir, tMin, tMax)
+	}
+	x := tMin
+	for i := 0; i < maxMarchSteps && x <= tMax; i++ {
+		// a safe step for a distance bound with lipschitz bound k
+		d := t.s.Evaluate(eye.Add(dir.MulScalar(x))) / t.k
+		// stop within the footprint of a pixel
+		if d < Max(t.pixelAngle*x, 1e-9) {
+			return x, true
+		}
+		x += d
+	}
+	return 0, false
+}
+
+// marchFixed returns the distance along a ray to the surface of an SDF3 with
+// no Lipschitz bound. The ray is sampled with fixed steps (the larger of the
+// pixel footprint and the box range / maxMarchSteps) until the distance
+// changes sign, then the surface is found by bisection. Parts of the surface
+// thinner than a step may be missed.
+func (t *tracer) marchFixed(eye, dir V3, tMin, tMax float64) (float64, bool) {
+	x0 := tMin
+	if t.s.Evaluate(eye.Add(dir.MulScalar(x0))) <= 0 {
+		return x0, true
+	}
+	for x0 < tMax {
+		x1 := x0 + Max(t.pixelAngle*x0, (tMax-tMin)/maxMarchSteps)
+		if t.s.Evaluate(eye.Add(dir.MulScalar(x1))) <= 0 {
+			for i := 0; i < 32; i++ {
+				x := 0.5 * (x0 + x1)
+				if t.s.Evaluate(eye.Add(dir.MulScalar(x))) <= 0 {
+					x1 = x
+				} else {
+					x0 = x
+				}
+			}
+			return x1, true
+		}
+		x0 = x1
+	}
+	return 0, false
+}
+
+// shadow returns the light visibility (0 or 1) at a point.
+func (t *tracer) shadow(p, n V3) float64 {
+	eps := Max(t.pixelAngle*t.o.Eye.Sub(p).Length(), 1e-6)
+	if _, hit := t.march(p.Add(n.MulScalar(2*eps)), t.light); hit {
+		return 0
+	}
+	return 1
+}
+
+// occlusion returns the ambient light (0..1) at a surface point.
+// Samples closer to the surface count for more.
+func (t *tracer) occlusion(p, n V3) float64 {
+	if !t.o.AO {
+		return 1
+	}
+	occ := 0.0
+	k := 1.0
+	for i := 1; i <= occlusionSamples; i++ {
+		h := t.aoStep * float64(i)
+		d := t.s.Evaluate(p.Add(n.MulScalar(h)))
+		occ += k * Max(h-d, 0) / h
+		k *= 0.5
+	}
+	return Clamp(1-occ, 0, 1)
+}
+
+// trace returns the color (r, g, b in 0..1) seen along a ray.
+func (t *tracer) trace(eye, dir V3) V3 {
+	background := V3{1, 1, 1}
+	x, hit := t.march(eye, dir)
+	// is the floor closer than the model?
+	if t.o.Floor && dir.Z < 0 && eye.Z > t.floor {
+		xf := (t.floor - eye.Z) / dir.Z
+		if !hit || xf < x {
+			p := eye.Add(dir.MulScalar(xf))
+			k := 0.6 + 0.3*t.shadow(p, V3{0, 0, 1})
+			return V3{k, k, k}
+		}
+	}
+	if !hit {
+		return background
+	}
+	p := eye.Add(dir.MulScalar(x))
+	n := Normal3(t.s, p, Max(t.pixelAngle*x, 1e-6))
+	diffuse := Max(n.Dot(t.light), 0)
+	if diffuse > 0 {
+		diffuse *= t.shadow(p, n)
+	}
+	c := V3{float64(t.o.Color.R), float64(t.o.Color.G), float64(t.o.Color.B)}.DivScalar(255)
+	return c.MulScalar(0.3*t.occlusion(p, n) + 0.7*diffuse)
+}
+
+// RenderImage renders an SDF3 as an image.
+func RenderImage(s SDF3, o *RenderOptions) (*image.RGBA, error) {
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	bb := s.BoundingBox()
+	t := tracer{
+		s:          s,
+		k:          LipschitzK3(s),
+		o:          o,
+		bb:         bb.ScaleAboutCenter(1.01),
+		floor:      bb.Min.Z,
+		light:      o.Light.Normalize(),
+		pixelAngle: o.FOV / float64(o.Size[1]),
+		aoStep:     0.01 * bb.Size().Length(),
+	}
+
+	// camera frame
+	forward := o.Target.Sub(o.Eye).Normalize()
+	right := forward.Cross(o.Up).Normalize()
+	up := right.Cross(forward)
+	h := math.Tan(0.5 * o.FOV)
+	w := h * float64(o.Size[0]) / float64(o.Size[1])
+
+	img := image.NewRGBA(image.Rect(0, 0, o.Size[0], o.Size[1]))
+	n := o.Samples
+	rows := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for y := range rows {
+				for x := 0; x < o.Size[0]; x++ {
+					var sum V3
+					// stratified samples within the pixel
+					for sy := 0; sy < n; sy++ {
+						for sx := 0; sx < n; sx++ {
+							u := (2*(float64(x)+(float64(sx)+0.5)/float64(n))/float64(o.Size[0]) - 1) * w
+							v := (1 - 2*(float64(y)+(float64(sy)+0.5)/float64(n))/float64(o.Size[1])) * h
+							dir := forward.Add(right.MulScalar(u)).Add(up.MulScalar(v)).Normalize()
+							sum = sum.Add(t.trace(o.Eye, dir))
+						}
+					}
+					c := sum.DivScalar(float64(n * n)).MulScalar(255)
+					img.SetRGBA(x, y, color.RGBA{uint8(Clamp(c.X, 0, 255)), uint8(Clamp(c.Y, 0, 255)), uint8(Clamp(c.Z, 0, 255)), 0xff})
+				}
+			}
+		}()
+	}
+	for y := 0; y < o.Size[1]; y++ {
+		rows <- y
+	}
+	close(rows)
+	wg.Wait()
+	return img, nil
+}
+
+// Render renders an SDF3 to a PNG file.
+func Render(s SDF3, o *RenderOptions) error {
+	img, err := RenderImage(s, o)
+	if err != nil {
+		return err
+	}
+	return savePNG(o.Path, img)
+}
+
+// RenderPreview renders an SDF3 to a small PNG file (fast, for design iteration).
+func RenderPreview(s SDF3, path string) error {
+	o := DefaultRenderOptions(s)
+	o.Size = V2i{400, 300}
+	o.Samples = 1
+	o.Path = path
+	return Render(s, o)
+}
+
+// savePNG writes an image to a PNG file.
+func savePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return png.Encode(f, img)
+}
+
+//-----------------------------------------------------------------------------
+
+// turntableTime is the time for one turn of an animated GIF (1/100 seconds).
+const turntableTime = 500
+
+// RenderTurntable renders frames of an SDF3 with the camera orbiting the
+// model about the up direction. The light orbits with the camera. If the
+// path extension is ".gif" an animated GIF is written, otherwise the path is
+// a format string for the frame number of a PNG sequence (e.g. "turn_%03d.png").
+func RenderTurntable(s SDF3, frames int, opts RenderOptions) error {
+	if frames < 1 {
+		return errors.New("frames < 1")
+	}
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	animated := strings.ToLower(filepath.Ext(opts.Path)) == ".gif"
+	path := opts.Path
+	if !animated && !strings.Contains(path, "%") {
+		// add the frame number before the extension
+		ext := filepath.Ext(path)
+		path = strings.TrimSuffix(path, ext) + "_%03d" + ext
+	}
+
+	eye := opts.Eye.Sub(opts.Target)
+	light := opts.Light
+	anim := &gif.GIF{}
+	delay := turntableTime / frames
+	if delay < 2 {
+		delay = 2
+	}
+	for i := 0; i < frames; i++ {
+		m := Rotate3d(opts.Up, Tau*float64(i)/float64(frames))
+		o := opts
+		o.Eye = opts.Target.Add(m.MulPosition(eye))
+		o.Light = m.MulPosition(light)
+		img, err := RenderImage(s, &o)
+		if err != nil {
+			return err
+		}
+		if !animated {
+			o.Path = fmt.Sprintf(path, i)
+			if err := savePNG(o.Path, img); err != nil {
+				return err
+			}
+			continue
+		}
+		frame := image.NewPaletted(img.Bounds(), palette.Plan9)
+		draw.FloydSteinberg.Draw(frame, img.Bounds(), img, image.Point{})
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, delay)
+	}
+	if !animated {
+		return nil
+	}
+	f, err := os.Create(opts.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return gif.EncodeAll(f, anim)
+}
+
+//-----------------------------------------------------------------------------
@@ -6,6 +6,8 @@ Render an SDF
 SDF3 -> STL file
 SDF2 -> DXF file
 SDF2 -> SVG file
+SDF3 -> triangle mesh
+SDF2 -> line segments
 
 */
 //-----------------------------------------------------------------------------
@@ -13,18 +15,41 @@ SDF2 -> SVG file
 package sdf
 
 import (
+	"context"
 	"fmt"
+	"os"
 	"sync"
+	"time"
 )
 
 //-----------------------------------------------------------------------------
 
 // RenderSTL renders an SDF3 as an STL file (uses octree sampling).
+// The optional hooks are called for each triangle before it is written.
 func RenderSTL(
 	s SDF3, //sdf3 to render
 	meshCells int, //number of cells on the longest axis. e.g 200
 	path string, //path to filename
+	hooks ...TriangleHook, //triangle hooks
 ) {
+	err := RenderSTLContext(context.Background(), s, meshCells, path, nil, hooks...)
+	if err != nil {
+		fmt.Printf("%s", err)
+	}
+}
+
+// RenderSTLContext renders an SDF3 as an STL file (uses octree sampling).
+// Cancelling ctx stops the rendering and removes the file. The optional
+// progress function is called as the rendering proceeds. The optional hooks
+// are called for each triangle before it is written.
+func RenderSTLContext(
+	ctx context.Context, // context for cancellation
+	s SDF3, //sdf3 to render
+	meshCells int, //number of cells on the longest axis. e.g 200
+	path string, //path to filename
+	fn ProgressFunc, // progress callback (optional)
+	hooks ...TriangleHook, //triangle hooks
+) error {
 
 	// work out the sampling resolution to use
 	bbSize := s.BoundingBox().Size()
@@ -37,26 +62,34 @@ func RenderSTL(
 	var wg sync.WaitGroup
 	output, err := WriteSTL(&wg, path)
 	if err != nil {
-		fmt.Printf("%s", err)
-		return
+		return err
 	}
 
+	// run the hooks on the triangles before writing them
+	hooked := hookTriangles(output, hooks)
+	// check the triangle orientation before the hooks
+	input, orientation := checkTriangles(s, hooked, RenderOrient)
+
 	// run marching cubes to generate the triangle mesh
-	marchingCubesOctree(s, resolution, output)
+	err = marchingCubesOctreeContext(ctx, s, resolution, input, fn)
+	close(input)
+	(<-orientation).report()
 
 	// stop the STL writer reading on the channel
-	close(output)
+	close(hooked)
 	// wait for the file write to complete
 	wg.Wait()
+
+	if err != nil {
+		// don't leave a partial file
+		os.Remove(path)
+	}
+	return err
 }
 
-// RenderSTLSlow renders an SDF3 as an STL file (uses uniform grid sampling).
-func RenderSTLSlow(
-	s SDF3, //sdf3 to render
-	meshCells int, //number of cells on the longest axis. e.g 200
-	path string, //path to filename
-) {
-	// work out the region we will sample
+// uniformGrid returns the region, the sampling resolution and the number of
+// cells for uniform grid sampling of an SDF3.
+func uniformGrid(s SDF3, meshCells int) (Box3, float64, V3i) {
 	bb0 := s.BoundingBox()
 	bb0Size := bb0.Size()
 	meshInc := bb0Size.MaxComponent() / float64(meshCells)
@@ -64,16 +97,69 @@ func RenderSTLSlow(
 	bb1Size = bb1Size.Ceil().AddScalar(1)
 	cells := bb1Size.ToV3i()
 	bb1Size = bb1Size.MulScalar(meshInc)
-	bb := NewBox3(bb0.Center(), bb1Size)
+	return NewBox3(bb0.Center(), bb1Size), meshInc, cells
+}
+
+// RenderSTLSlow renders an SDF3 as an STL file (uses uniform grid sampling).
+// The optional hooks are called for each triangle before it is written.
+func RenderSTLSlow(
+	s SDF3, //sdf3 to render
+	meshCells int, //number of cells on the longest axis. e.g 200
+	path string, //path to filename
+	hooks ...TriangleHook, //triangle hooks
+) {
+	bb, meshInc, cells := uniformGrid(s, meshCells)
 
 	fmt.Printf("rendering %s (%dx%dx%d)\n", path, cells[0], cells[1], cells[2])
 
 	// run marching cubes to generate the triangle mesh
 	m := marchingCubes(s, bb, meshInc)
-	err := SaveSTL(path, m)
+	checkMesh(s, m, RenderOrient).report()
+	err := SaveSTL(path, HookMesh(m, hooks...))
+	if err != nil {
+		fmt.Printf("%s", err)
+	}
+}
+
+// RenderSTLSurface renders an SDF3 as an STL file (uses surface tracking).
+// Only cells near the surface are evaluated, so this is fast for thin shelled
+// models. Small disjoint parts of the model may be missed (see march3s.go).
+// The optional hooks are called for each triangle before it is written.
+func RenderSTLSurface(
+	s SDF3, //sdf3 to render
+	meshCells int, //number of cells on the longest axis. e.g 200
+	path string, //path to filename
+	hooks ...TriangleHook, //triangle hooks
+) {
+	// work out the sampling resolution to use
+	bbSize := s.BoundingBox().Size()
+	resolution := bbSize.MaxComponent() / float64(meshCells)
+	cells := bbSize.DivScalar(resolution).ToV3i()
+
+	fmt.Printf("rendering %s (%dx%dx%d, resolution %.2f)\n", path, cells[0], cells[1], cells[2], resolution)
+
+	// write the triangles to an STL file
+	var wg sync.WaitGroup
+	output, err := WriteSTL(&wg, path)
 	if err != nil {
 		fmt.Printf("%s", err)
+		return
 	}
+
+	// run the hooks on the triangles before writing them
+	hooked := hookTriangles(output, hooks)
+	// check the triangle orientation before the hooks
+	input, orientation := checkTriangles(s, hooked, RenderOrient)
+
+	// run marching cubes to generate the triangle mesh
+	marchingCubesSurface(s, resolution, input)
+	close(input)
+	(<-orientation).report()
+
+	// stop the STL writer reading on the channel
+	close(hooked)
+	// wait for the file write to complete
+	wg.Wait()
 }
 
 //-----------------------------------------------------------------------------
@@ -84,6 +170,22 @@ func RenderDXF(
 	meshCells int, //number of cells on the longest axis. e.g 200
 	path string, //path to filename
 ) {
+	err := RenderDXFContext(context.Background(), s, meshCells, path, nil)
+	if err != nil {
+		fmt.Printf("%s", err)
+	}
+}
+
+// RenderDXFContext renders an SDF2 as a DXF file. (uses quadtree sampling)
+// Cancelling ctx stops the rendering and removes the file. The optional
+// progress function is called as the rendering proceeds.
+func RenderDXFContext(
+	ctx context.Context, // context for cancellation
+	s SDF2, //sdf2 to render
+	meshCells int, //number of cells on the longest axis. e.g 200
+	path string, //path to filename
+	fn ProgressFunc, // progress callback (optional)
+) error {
 
 	// work out the sampling resolution to use
 	bbSize := s.BoundingBox().Size()
@@ -96,17 +198,22 @@ func RenderDXF(
 	var wg sync.WaitGroup
 	output, err := WriteDXF(&wg, path)
 	if err != nil {
-		fmt.Printf("%s", err)
-		return
+		return err
 	}
 
 	// run marching squares to generate the line segments
-	marchingSquaresQuadtree(s, resolution, output)
+	err = marchingSquaresQuadtreeContext(ctx, s, resolution, output, fn)
 
 	// stop the DXF writer reading on the channel
 	close(output)
 	// wait for the file write to complete
 	wg.Wait()
+
+	if err != nil {
+		// don't leave a partial file
+		os.Remove(path)
+	}
+	return err
 }
 
 // RenderDXFSlow renders an SDF2 as a DXF file. (uses uniform grid sampling)
@@ -135,6 +242,27 @@ func RenderDXFSlow(
 	}
 }
 
+// RenderDXFAdaptive renders an SDF2 as a DXF file. (uses adaptive quadtree sampling)
+func RenderDXFAdaptive(
+	s SDF2, // sdf2 to render
+	meshCells int, // number of cells (of the minimum size) on the longest axis. e.g 1000
+	tolerance float64, // allowed interpolation error. e.g 0.01
+	path string, // path to filename
+) error {
+	return SaveDXF(path, GenerateLinesAdaptive(s, meshCells, tolerance))
+}
+
+// RenderDXFSimplified renders an SDF2 as a DXF file with the contours
+// simplified to within tolerance of the boundary. (uses quadtree sampling)
+func RenderDXFSimplified(
+	s SDF2, // sdf2 to render
+	meshCells int, // number of cells on the longest axis. e.g 200
+	tolerance float64, // allowed distance from the boundary. e.g 0.01
+	path string, // path to filename
+) error {
+	return SaveDXF(path, SimplifyLines(GenerateLines(s, meshCells), tolerance))
+}
+
 //-----------------------------------------------------------------------------
 
 // RenderSVG renders an SDF2 as an SVG file. (uses quadtree sampling)
@@ -192,4 +320,232 @@ func RenderSVGSlow(
 	return SaveSVG(path, lineStyle, m)
 }
 
+// RenderSVGAdaptive renders an SDF2 as an SVG file. (uses adaptive quadtree sampling)
+func RenderSVGAdaptive(
+	s SDF2, // sdf2 to render
+	meshCells int, // number of cells (of the minimum size) on the longest axis. e.g 1000
+	tolerance float64, // allowed interpolation error. e.g 0.01
+	path string, // path to filename
+	lineStyle string, // SVG line style
+) error {
+	return SaveSVG(path, lineStyle, GenerateLinesAdaptive(s, meshCells, tolerance))
+}
+
+// RenderSVGSimplified renders an SDF2 as an SVG file with the contours
+// simplified to within tolerance of the boundary. (uses quadtree sampling)
+func RenderSVGSimplified(
+	s SDF2, // sdf2 to render
+	meshCells int, // number of cells on the longest axis. e.g 200
+	tolerance float64, // allowed distance from the boundary. e.g 0.01
+	path string, // path to filename
+	lineStyle string, // SVG line style
+) error {
+	return SaveSVG(path, lineStyle, SimplifyLines(GenerateLines(s, meshCells), tolerance))
+}
+
+//-----------------------------------------------------------------------------
+
+// GenerateTriangles generates a triangle mesh for an SDF3 (uses octree sampling).
+func GenerateTriangles(
+	s SDF3, // sdf3 to render
+	meshCells int, // number of cells on the longest axis. e.g 200
+) []*Triangle3 {
+	mesh, _ := GenerateTrianglesContext(context.Background(), s, meshCells, nil)
+	return mesh
+}
+
+// GenerateTrianglesContext generates a triangle mesh for an SDF3 (uses octree sampling).
+// Cancelling ctx stops the mesh generation (and returns the context error).
+// The optional progress function is called as the mesh generation proceeds.
+func GenerateTrianglesContext(
+	ctx context.Context, // context for cancellation
+	s SDF3, // sdf3 to render
+	meshCells int, // number of cells on the longest axis. e.g 200
+	fn ProgressFunc, // progress callback (optional)
+) ([]*Triangle3, error) {
+	// work out the sampling resolution to use
+	resolution := s.BoundingBox().Size().MaxComponent() / float64(meshCells)
+	return generateTriangles(ctx, s, resolution, fn)
+}
+
+// generateTriangles generates a triangle mesh for an SDF3 with a given
+// sampling resolution (uses octree sampling).
+func generateTriangles(
+	ctx context.Context, // context for cancellation
+	s SDF3, // sdf3 to render
+	resolution float64, // sampling resolution
+	fn ProgressFunc, // progress callback (optional)
+) ([]*Triangle3, error) {
+	// collect the triangles from the output channel
+	output := make(chan *Triangle3)
+	done := make(chan []*Triangle3)
+	go func() {
+		mesh := make([]*Triangle3, 0, estimateTriangles(s.BoundingBox(), resolution))
+		for t := range output {
+			mesh = append(mesh, t)
+		}
+		done <- mesh
+	}()
+
+	// run marching cubes to generate the triangle mesh
+	err := marchingCubesOctreeContext(ctx, s, resolution, output, fn)
+	close(output)
+	mesh := <-done
+	if err != nil {
+		return nil, err
+	}
+	return mesh, nil
+}
+
+// GenerateTrianglesGrid generates a triangle mesh for an SDF3 (uses uniform
+// grid sampling). The samples are evaluated with a grid evaluator (e.g. a GPU
+// compute shader, see glsl.go). If the grid evaluator is nil or returns an
+// error the samples are evaluated on the CPU.
+func GenerateTrianglesGrid(
+	s SDF3, // sdf3 to render
+	meshCells int, // number of cells on the longest axis. e.g 200
+	grid GridEvaluator, // grid evaluator (optional)
+) []*Triangle3 {
+	bb, meshInc, _ := uniformGrid(s, meshCells)
+	return marchingCubesEvaluator(s, bb, meshInc, grid)
+}
+
+// GenerateTrianglesWithin generates the finest triangle mesh for an SDF3 that
+// can be completed within a time budget (uses octree sampling).
+// The number of mesh cells starts at minCells and doubles for each level up
+// to maxCells. A level that is not expected to complete within the budget is
+// not started, a level that doesn't complete within the budget is discarded.
+// The minCells level is always completed.
+// It returns the mesh and the number of mesh cells used.
+func GenerateTrianglesWithin(
+	s SDF3, // sdf3 to render
+	minCells int, // initial number of cells on the longest axis. e.g 25
+	maxCells int, // maximum number of cells on the longest axis. e.g 400
+	budget time.Duration, // time budget
+) ([]*Triangle3, int) {
+	mesh, cells, _ := GenerateTrianglesWithinContext(context.Background(), s, minCells, maxCells, budget)
+	return mesh, cells
+}
+
+// GenerateTrianglesWithinContext generates the finest triangle mesh for an
+// SDF3 that can be completed within a time budget (uses octree sampling).
+// The mesher stops a level at the budget deadline (the level is discarded).
+// Cancelling ctx stops the mesh generation (and returns the context error).
+func GenerateTrianglesWithinContext(
+	ctx context.Context, // context for cancellation
+	s SDF3, // sdf3 to render
+	minCells int, // initial number of cells on the longest axis. e.g 25
+	maxCells int, // maximum number of cells on the longest axis. e.g 400
+	budget time.Duration, // time budget
+) ([]*Triangle3, int, error) {
+	if minCells > maxCells {
+		minCells = maxCells
+	}
+	start := time.Now()
+	mesh, err := GenerateTrianglesContext(ctx, s, minCells, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	cells := minCells
+	levelTime := time.Since(start)
+	// the mesher checks the deadline once per octree cube
+	levelCtx, cancel := context.WithDeadline(ctx, start.Add(budget))
+	defer cancel()
+	for cells < maxCells {
+		next := 2 * cells
+		if next > maxCells {
+			next = maxCells
+		}
+		// the work is proportional to the surface area (~ cells^2)
+		k := float64(next) / float64(cells)
+		estimate := time.Duration(float64(levelTime) * k * k)
+		if deadline, _ := levelCtx.Deadline(); time.Now().Add(estimate).After(deadline) {
+			break
+		}
+		t := time.Now()
+		m, err := GenerateTrianglesContext(levelCtx, s, next, nil)
+		if err == context.DeadlineExceeded && ctx.Err() == nil {
+			// out of time, discard the level
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		mesh, cells, levelTime = m, next, time.Since(t)
+	}
+	return mesh, cells, nil
+}
+
+// GenerateLines generates the line segments for an SDF2 boundary (uses quadtree sampling).
+func GenerateLines(
+	s SDF2, // sdf2 to render
+	meshCells int, // number of cells on the longest axis. e.g 200
+) []*Line {
+	lines, _ := GenerateLinesContext(context.Background(), s, meshCells, nil)
+	return lines
+}
+
+// GenerateLinesContext generates the line segments for an SDF2 boundary (uses quadtree sampling).
+// Cancelling ctx stops the line generation (and returns the context error).
+// The optional progress function is called as the line generation proceeds.
+func GenerateLinesContext(
+	ctx context.Context, // context for cancellation
+	s SDF2, // sdf2 to render
+	meshCells int, // number of cells on the longest axis. e.g 200
+	fn ProgressFunc, // progress callback (optional)
+) ([]*Line, error) {
+	// work out the sampling resolution to use
+	resolution := s.BoundingBox().Size().MaxComponent() / float64(meshCells)
+
+	// collect the line segments from the output channel
+	output := make(chan *Line)
+	done := make(chan []*Line)
+	go func() {
+		lines := make([]*Line, 0, estimateLines(s.BoundingBox(), resolution))
+		for l := range output {
+			lines = append(lines, l)
+		}
+		done <- lines
+	}()
+
+	// run marching squares to generate the line segments
+	err := marchingSquaresQuadtreeContext(ctx, s, resolution, output, fn)
+	close(output)
+	lines := <-done
+	if err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// GenerateLinesAdaptive generates the line segments for an SDF2 boundary
+// (uses adaptive quadtree sampling). Squares are subdivided down to the
+// minimum size where the SDF2 isn't within tolerance of bilinear interpolation.
+func GenerateLinesAdaptive(
+	s SDF2, // sdf2 to render
+	meshCells int, // number of cells (of the minimum size) on the longest axis. e.g 1000
+	tolerance float64, // allowed interpolation error. e.g 0.01
+) []*Line {
+	// work out the minimum step size
+	resolution := s.BoundingBox().Size().MaxComponent() / float64(meshCells)
+
+	// collect the line segments from the output channel
+	output := make(chan *Line)
+	done := make(chan []*Line)
+	go func() {
+		lines := make([]*Line, 0, estimateLines(s.BoundingBox(), resolution))
+		for l := range output {
+			lines = append(lines, l)
+		}
+		done <- lines
+	}()
+
+	// run marching squares to generate the line segments
+	marchingSquaresAdaptive(s, resolution, tolerance, output)
+	close(output)
+	return <-done
+}
+
 //-----------------------------------------------------------------------------
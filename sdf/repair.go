@@ -0,0 +1,333 @@
+//-----------------------------------------------------------------------------
+/*
+
+Mesh Repair
+
+Clean up a triangle mesh so it survives strict slicers and CAD import.
+
+1. Weld: Vertices within a tolerance of each other are merged.
+2. Degenerate: Triangles with repeated vertices (after welding) are removed.
+3. Duplicate: Triangles with the same vertices as an earlier triangle are removed.
+4. Winding: Triangles are flipped to match the orientation of their neighbours.
+Closed parts of the mesh are oriented so their normals point outwards.
+5. Holes: Loops of open edges are found and small holes are filled.
+
+Only the mesh is used, so this works on meshes from any source. The
+orientation of open parts of the mesh (e.g. with large holes) is made
+consistent, but can't be checked against the inside/outside of the part.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"fmt"
+	"math"
+)
+
+//-----------------------------------------------------------------------------
+
+// RepairParms defines the parameters for mesh repair.
+type RepairParms struct {
+	Tolerance float64 // vertices closer than this are welded (0 == exact matches only)
+	MaxHole   int     // holes with up to this many edges are filled (0 == no filling)
+}
+
+// RepairReport is the result of a mesh repair.
+type RepairReport struct {
+	Welded     int `json:"welded"`     // vertices merged with another vertex
+	Degenerate int `json:"degenerate"` // degenerate triangles removed
+	Duplicate  int `json:"duplicate"`  // duplicate triangles removed
+	Flipped    int `json:"flipped"`    // triangles flipped
+	Holes      int `json:"holes"`      // holes found
+	Filled     int `json:"filled"`     // holes filled
+	OpenEdges  int `json:"open_edges"` // open edges after the repair
+}
+
+// String returns a printable mesh repair report.
+func (r *RepairReport) String() string {
+	s := fmt.Sprintf("welded %d vertices\n", r.Welded)
+	s += fmt.Sprintf("removed %d degenerate, %d duplicate triangles\n", r.Degenerate, r.Duplicate)
+	s += fmt.Sprintf("flipped %d triangles\n", r.Flipped)
+	s += fmt.Sprintf("filled %d of %d holes, %d open edges", r.Filled, r.Holes, r.OpenEdges)
+	return s
+}
+
+//-----------------------------------------------------------------------------
+
+// repairFace is a triangle of vertex indices.
+type repairFace struct {
+	v         [3]int
+	attribute uint16
+}
+
+// welder merges vertices within a tolerance.
+type welder struct {
+	tolerance float64
+	vertex    []V3
+	exact     map[V3]int
+	grid      map[V3i][]int
+}
+
+func newWelder(tolerance float64) *welder {
+	return &welder{
+		tolerance: tolerance,
+		exact:     make(map[V3]int),
+		grid:      make(map[V3i][]int),
+	}
+}
+
+// cell returns the grid cell for a vertex.
+func (w *welder) cell(p V3) V3i {
+	q := p.DivScalar(w.tolerance)
+	return V3i{int(math.Floor(q.X)), int(math.Floor(q.Y)), int(math.Floor(q.Z))}
+}
+
+// index returns the vertex index for a point, and true if it was welded to
+// an existing vertex.
+func (w *welder) index(p V3) (int, bool) {
+	if i, ok := w.exact[p]; ok {
+		return i, false
+	}
+	if w.tolerance > 0 {
+		// search the neighbouring grid cells
+		c := w.cell(p)
+		for x := -1; x <= 1; x++ {
+			for y := -1; y <= 1; y++ {
+				for z := -1; z <= 1; z++ {
+					for _, i := range w.grid[c.Add(V3i{x, y, z})] {
+						if p.Sub(w.vertex[i]).Length() <= w.tolerance {
+							w.exact[p] = i
+							return i, true
+						}
+					}
+				}
+			}
+		}
+	}
+	i := len(w.vertex)
+	w.vertex = append(w.vertex, p)
+	w.exact[p] = i
+	if w.tolerance > 0 {
+		c := w.cell(p)
+		w.grid[c] = append(w.grid[c], i)
+	}
+	return i, false
+}
+
+// edgeKey returns the key for an undirected edge.
+func edgeKey(a, b int) [2]int {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]int{a, b}
+}
+
+// hasEdge returns true if a face has the directed edge a->b.
+func (f *repairFace) hasEdge(a, b int) bool {
+	for i := 0; i < 3; i++ {
+		if f.v[i] == a && f.v[(i+1)%3] == b {
+			return true
+		}
+	}
+	return false
+}
+
+// flip reverses the winding of a face.
+func (f *repairFace) flip() {
+	f.v[1], f.v[2] = f.v[2], f.v[1]
+}
+
+// orientFaces makes the winding of neighbouring faces consistent. Closed
+// connected parts are oriented with a positive volume. It returns the
+// number of faces flipped.
+func orientFaces(vertex []V3, faces []repairFace) int {
+	edges := make(map[[2]int][]int)
+	for i := range faces {
+		f := &faces[i]
+		for j := 0; j < 3; j++ {
+			k := edgeKey(f.v[j], f.v[(j+1)%3])
+			edges[k] = append(edges[k], i)
+		}
+	}
+	flipped := make([]bool, len(faces))
+	visited := make([]bool, len(faces))
+	for seed := range faces {
+		if visited[seed] {
+			continue
+		}
+		// walk the connected faces (across manifold edges)
+		visited[seed] = true
+		part := []int{seed}
+		closed := true
+		for n := 0; n < len(part); n++ {
+			i := part[n]
+			f := &faces[i]
+			for j := 0; j < 3; j++ {
+				a, b := f.v[j], f.v[(j+1)%3]
+				shared := edges[edgeKey(a, b)]
+				if len(shared) != 2 {
+					closed = false
+					continue
+				}
+				k := shared[0]
+				if k == i {
+					k = shared[1]
+				}
+				if visited[k] {
+					continue
+				}
+				visited[k] = true
+				// a consistent neighbour has the reverse edge
+				if faces[k].hasEdge(a, b) {
+					faces[k].flip()
+					flipped[k] = !flipped[k]
+				}
+				part = append(part, k)
+			}
+		}
+		if !closed {
+			continue
+		}
+		// the normals of a closed part point outwards
+		volume := 0.0
+		for _, i := range part {
+			v := faces[i].v
+			volume += vertex[v[0]].Dot(vertex[v[1]].Cross(vertex[v[2]]))
+		}
+		if volume < 0 {
+			for _, i := range part {
+				faces[i].flip()
+				flipped[i] = !flipped[i]
+			}
+		}
+	}
+	n := 0
+	for _, x := range flipped {
+		if x {
+			n++
+		}
+	}
+	return n
+}
+
+// openEdges returns the directed edges without a matching opposite edge.
+func openEdges(faces []repairFace) map[int][]int {
+	count := make(map[[2]int]int)
+	for i := range faces {
+		f := &faces[i]
+		for j := 0; j < 3; j++ {
+			count[[2]int{f.v[j], f.v[(j+1)%3]}]++
+			count[[2]int{f.v[(j+1)%3], f.v[j]}]--
+		}
+	}
+	open := make(map[int][]int)
+	for e, n := range count {
+		for ; n > 0; n-- {
+			open[e[0]] = append(open[e[0]], e[1])
+		}
+	}
+	return open
+}
+
+// holeLoops joins the open edges into loops.
+func holeLoops(open map[int][]int) [][]int {
+	var loops [][]int
+	for start := range open {
+		for len(open[start]) > 0 {
+			loop := []int{start}
+			v := start
+			for {
+				next := open[v]
+				if len(next) == 0 {
+					// not a closed loop
+					loop = nil
+					break
+				}
+				open[v] = next[1:]
+				v = next[0]
+				if v == start {
+					break
+				}
+				loop = append(loop, v)
+			}
+			if len(loop) >= 3 {
+				loops = append(loops, loop)
+			}
+		}
+	}
+	return loops
+}
+
+//-----------------------------------------------------------------------------
+
+// RepairMesh welds vertices, removes degenerate and duplicate triangles,
+// makes the triangle winding consistent and fills small holes.
+// It returns the repaired mesh and a report of the repairs.
+func RepairMesh(mesh []*Triangle3, k *RepairParms) ([]*Triangle3, *RepairReport) {
+	r := RepairReport{}
+	// weld the vertices
+	w := newWelder(k.Tolerance)
+	faces := make([]repairFace, 0, len(mesh))
+	duplicate := make(map[[3]int]bool)
+	for _, t := range mesh {
+		f := repairFace{attribute: t.Attribute}
+		for i := range t.V {
+			var welded bool
+			f.v[i], welded = w.index(t.V[i])
+			if welded {
+				r.Welded++
+			}
+		}
+		v := f.v
+		if v[0] == v[1] || v[1] == v[2] || v[2] == v[0] {
+			r.Degenerate++
+			continue
+		}
+		// sort the vertices to find duplicates (in either orientation)
+		if v[0] > v[1] {
+			v[0], v[1] = v[1], v[0]
+		}
+		if v[1] > v[2] {
+			v[1], v[2] = v[2], v[1]
+		}
+		if v[0] > v[1] {
+			v[0], v[1] = v[1], v[0]
+		}
+		if duplicate[v] {
+			r.Duplicate++
+			continue
+		}
+		duplicate[v] = true
+		faces = append(faces, f)
+	}
+	// fix the winding
+	r.Flipped = orientFaces(w.vertex, faces)
+	// fill the holes
+	for _, loop := range holeLoops(openEdges(faces)) {
+		r.Holes++
+		if len(loop) > k.MaxHole {
+			continue
+		}
+		// fan triangulation with the reverse winding of the open edges
+		for i := 1; i < len(loop)-1; i++ {
+			faces = append(faces, repairFace{v: [3]int{loop[0], loop[i+1], loop[i]}})
+		}
+		r.Filled++
+	}
+	for _, next := range openEdges(faces) {
+		r.OpenEdges += len(next)
+	}
+	// back to triangles
+	out := make([]*Triangle3, len(faces))
+	for i, f := range faces {
+		out[i] = &Triangle3{
+			V:         [3]V3{w.vertex[f.v[0]], w.vertex[f.v[1]], w.vertex[f.v[2]]},
+			Attribute: f.attribute,
+		}
+	}
+	return out, &r
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,137 @@
+//-----------------------------------------------------------------------------
+/*
+
+JSON Reports
+
+Analysis results (mesh statistics, mass properties, etc.) can be written
+as a JSON document so CI pipelines and web UIs can consume them.
+
+	{
+	  "schema": "sdfx-report",
+	  "version": 1,
+	  "reports": [
+	    {"kind": "mesh_stats", "data": {...}},
+	    {"kind": "mass_properties", "data": {...}}
+	  ]
+	}
+
+The data fields of each kind are the JSON tags of the report types. Fields
+are only added to a schema version, a change to an existing field bumps
+the version.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+//-----------------------------------------------------------------------------
+
+const reportSchema = "sdfx-report"
+
+// ReportVersion is the version of the JSON report schema.
+const ReportVersion = 1
+
+// Report is an analysis result that can be written as JSON.
+type Report interface {
+	ReportKind() string // the kind of report (identifies the data schema)
+}
+
+// ReportKind returns the kind of report.
+func (r *LatticeReport) ReportKind() string { return "lattice" }
+
+// ReportKind returns the kind of report.
+func (s *MeshStatistics) ReportKind() string { return "mesh_stats" }
+
+// ReportKind returns the kind of report.
+func (m *MassProperties) ReportKind() string { return "mass_properties" }
+
+// ReportKind returns the kind of report.
+func (s *Symmetry) ReportKind() string { return "symmetry" }
+
+// ReportKind returns the kind of report.
+func (r *RepairReport) ReportKind() string { return "mesh_repair" }
+
+// ReportKind returns the kind of report.
+func (r *FeatureEdgeReport) ReportKind() string { return "feature_edges" }
+
+// newReport returns an empty report of a given kind.
+func newReport(kind string) (Report, error) {
+	switch kind {
+	case "lattice":
+		return &LatticeReport{}, nil
+	case "mesh_stats":
+		return &MeshStatistics{}, nil
+	case "mass_properties":
+		return &MassProperties{}, nil
+	case "symmetry":
+		return &Symmetry{}, nil
+	case "mesh_repair":
+		return &RepairReport{}, nil
+	case "feature_edges":
+		return &FeatureEdgeReport{}, nil
+	}
+	return nil, fmt.Errorf("unknown report kind \"%s\"", kind)
+}
+
+//-----------------------------------------------------------------------------
+
+type jsonReport struct {
+	Kind string          `json:"kind"`
+	Data json.RawMessage `json:"data"`
+}
+
+type jsonReports struct {
+	Schema  string       `json:"schema"`
+	Version int          `json:"version"`
+	Reports []jsonReport `json:"reports"`
+}
+
+// EncodeReport writes reports as a JSON document.
+func EncodeReport(w io.Writer, reports ...Report) error {
+	doc := jsonReports{Schema: reportSchema, Version: ReportVersion}
+	for _, r := range reports {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		doc.Reports = append(doc.Reports, jsonReport{r.ReportKind(), data})
+	}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(&doc)
+}
+
+// DecodeReport reads reports from a JSON document.
+func DecodeReport(r io.Reader) ([]Report, error) {
+	var doc jsonReports
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	if doc.Schema != reportSchema {
+		return nil, errors.New("not an sdfx report")
+	}
+	if doc.Version > ReportVersion {
+		return nil, fmt.Errorf("unsupported report version %d", doc.Version)
+	}
+	reports := make([]Report, len(doc.Reports))
+	for i, x := range doc.Reports {
+		report, err := newReport(x.Kind)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(x.Data, report); err != nil {
+			return nil, err
+		}
+		reports[i] = report
+	}
+	return reports, nil
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,1400 @@
+//-----------------------------------------------------------------------------
+/*
+
+OpenSCAD Import
+
+Build a model from OpenSCAD source, to ease the migration of existing
+designs (e.g. "sdfx mesh model.scad"). A practical subset of the language
+is supported:
+
+	// a plate with a row of holes
+	n = 4;
+	difference() {
+		cube([10 * n, 10, 2]);
+		for (i = [0 : n - 1])
+			translate([10 * i + 5, 5, -1]) cylinder(h = 4, d = 3);
+	}
+
+statements: variable assignments, module instantiations (with the
+modifiers *, %, # and !), blocks, for loops (over ranges and vectors) and
+if/else.
+
+expressions: numbers, booleans, strings, undef, vectors, ranges,
+variables, indexing, arithmetic (+ - * / %), comparisons, logical
+operators (&& || !) and the conditional operator (?:).
+
+functions: sin, cos, tan, asin, acos, atan, atan2, sqrt, abs, pow, exp,
+ln, log, floor, ceil, round, min, max, len and PI.
+
+3d modules: cube, sphere, cylinder, linear_extrude
+
+2d modules: square, circle, polygon (points only)
+
+transforms: translate, rotate, scale (uniform), mirror, multmatrix,
+offset (2d, r only)
+
+booleans: union, difference, intersection (3d), color (ignored)
+
+Circles are exact, so $fn, $fa and $fs are ignored. Variables are
+evaluated in order (rather than the last assignment in a scope being used
+for the whole scope). User defined modules and functions, include/use and
+the other OpenSCAD modules (hull, minkowski, etc.) give an error. The
+top-level objects are unioned, * (disabled) and % (background) objects
+are left out.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+//-----------------------------------------------------------------------------
+// Lexer
+
+// scadPuncts are the OpenSCAD punctuation tokens (two character tokens first).
+var scadPuncts = []string{
+	"<=", ">=", "==", "!=", "&&", "||",
+	"+", "-", "*", "/", "%", "(", ")", "[", "]", "{", "}",
+	",", "=", ";", ":", "<", ">", "!", "?", "#",
+}
+
+// scadLex splits OpenSCAD source into tokens.
+func scadLex(src string) ([]scriptToken, error) {
+	var tokens []scriptToken
+	line := 1
+	r := []rune(src)
+	for i := 0; i < len(r); {
+		c := r[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case unicode.IsSpace(c):
+			i++
+		case c == '/' && i+1 < len(r) && r[i+1] == '/':
+			// comment to the end of the line
+			for i < len(r) && r[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(r) && r[i+1] == '*':
+			// block comment
+			start := line
+			i += 2
+			for i < len(r) && !(r[i] == '*' && i+1 < len(r) && r[i+1] == '/') {
+				if r[i] == '\n' {
+					line++
+				}
+				i++
+			}
+			if i == len(r) {
+				return nil, fmt.Errorf("line %d: unterminated comment", start)
+			}
+			i += 2
+		case unicode.IsDigit(c) || (c == '.' && i+1 < len(r) && unicode.IsDigit(r[i+1])):
+			t, j, err := lexNumber(r, i, line)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, t)
+			i = j
+		case unicode.IsLetter(c) || c == '_' || c == '$':
+			j := i + 1
+			for j < len(r) && (unicode.IsLetter(r[j]) || unicode.IsDigit(r[j]) || r[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, scriptToken{typ: tokenIdent, text: string(r[i:j]), line: line})
+			i = j
+		case c == '"':
+			var sb strings.Builder
+			j := i + 1
+			for j < len(r) && r[j] != '"' && r[j] != '\n' {
+				if r[j] == '\\' && j+1 < len(r) {
+					j++
+					switch r[j] {
+					case 'n':
+						sb.WriteRune('\n')
+					case 't':
+						sb.WriteRune('\t')
+					default:
+						sb.WriteRune(r[j])
+					}
+				} else {
+					sb.WriteRune(r[j])
+				}
+				j++
+			}
+			if j == len(r) || r[j] != '"' {
+				return nil, fmt.Errorf("line %d: unterminated string", line)
+			}
+			tokens = append(tokens, scriptToken{typ: tokenString, text: sb.String(), line: line})
+			i = j + 1
+		default:
+			rest := string(r[i:])
+			n := 0
+			for _, s := range scadPuncts {
+				if strings.HasPrefix(rest, s) {
+					n = len(s)
+					break
+				}
+			}
+			if n == 0 {
+				return nil, fmt.Errorf("line %d: unexpected character '%c'", line, c)
+			}
+			tokens = append(tokens, scriptToken{typ: tokenPunct, text: rest[:n], line: line})
+			i += n
+		}
+	}
+	tokens = append(tokens, scriptToken{typ: tokenEOF, line: line})
+	return tokens, nil
+}
+
+//-----------------------------------------------------------------------------
+// Values
+
+// scadMaxRange is the maximum number of values in a range.
+const scadMaxRange = 100000
+
+// scadRange is a range value, [start : step : end].
+type scadRange struct {
+	start, step, end float64
+}
+
+// values returns the values of a range.
+func (r scadRange) values() ([]interface{}, error) {
+	if r.step == 0 {
+		return nil, errors.New("range step is 0")
+	}
+	n := math.Floor((r.end-r.start)/r.step + epsilon)
+	if n > scadMaxRange {
+		return nil, errors.New("range is too long")
+	}
+	var v []interface{}
+	for i := 0.0; i <= n; i++ {
+		v = append(v, r.start+i*r.step)
+	}
+	return v, nil
+}
+
+// scadTypeName returns the name of the type of an OpenSCAD value.
+func scadTypeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "undef"
+	case bool:
+		return "boolean"
+	case scadRange:
+		return "range"
+	}
+	return scriptTypeName(v)
+}
+
+// scadTrue returns the truth of a value.
+func scadTrue(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case scriptList:
+		return len(v) != 0
+	case nil:
+		return false
+	}
+	return true
+}
+
+// scadOp applies a binary operator.
+func scadOp(op string, a, b interface{}) (interface{}, error) {
+	x, xok := a.(float64)
+	y, yok := b.(float64)
+	switch op {
+	case "||":
+		return scadTrue(a) || scadTrue(b), nil
+	case "&&":
+		return scadTrue(a) && scadTrue(b), nil
+	case "==":
+		return reflect.DeepEqual(a, b), nil
+	case "!=":
+		return !reflect.DeepEqual(a, b), nil
+	case "<", "<=", ">", ">=":
+		if !xok || !yok {
+			return nil, fmt.Errorf("can't compare %s and %s", scadTypeName(a), scadTypeName(b))
+		}
+		switch op {
+		case "<":
+			return x < y, nil
+		case "<=":
+			return x <= y, nil
+		case ">":
+			return x > y, nil
+		}
+		return x >= y, nil
+	case "%":
+		if !xok || !yok {
+			return nil, fmt.Errorf("can't apply '%%' to %s and %s", scadTypeName(a), scadTypeName(b))
+		}
+		return math.Mod(x, y), nil
+	case "*":
+		// the product of two vectors is the dot product
+		va, aok := scriptVector(a)
+		vb, bok := scriptVector(b)
+		if aok && bok {
+			if len(va) != len(vb) {
+				return nil, errors.New("vector lengths don't match")
+			}
+			d := 0.0
+			for i := range va {
+				d += va[i] * vb[i]
+			}
+			return d, nil
+		}
+	}
+	for _, v := range []interface{}{a, b} {
+		switch v.(type) {
+		case nil, bool, string, scadRange:
+			return nil, fmt.Errorf("can't apply '%s' to %s and %s", op, scadTypeName(a), scadTypeName(b))
+		}
+	}
+	return scriptArith(op, a, b)
+}
+
+// scadIndex returns an element of a list or string (undef if out of range).
+func scadIndex(v, i interface{}) (interface{}, error) {
+	x, ok := i.(float64)
+	if !ok {
+		return nil, fmt.Errorf("index is a %s, not a number", scadTypeName(i))
+	}
+	k := int(math.Floor(x))
+	switch v := v.(type) {
+	case scriptList:
+		if k >= 0 && k < len(v) {
+			return v[k], nil
+		}
+		return nil, nil
+	case string:
+		r := []rune(v)
+		if k >= 0 && k < len(r) {
+			return string(r[k]), nil
+		}
+		return nil, nil
+	}
+	return nil, fmt.Errorf("can't index a %s", scadTypeName(v))
+}
+
+// scadIterate returns the values a for loop iterates over.
+func scadIterate(v interface{}) ([]interface{}, error) {
+	switch v := v.(type) {
+	case scadRange:
+		return v.values()
+	case scriptList:
+		return v, nil
+	case float64, bool, string:
+		return []interface{}{v}, nil
+	}
+	return nil, fmt.Errorf("can't iterate over %s", scadTypeName(v))
+}
+
+//-----------------------------------------------------------------------------
+// Parser and evaluator
+
+// scadParser evaluates OpenSCAD source as it is parsed.
+type scadParser struct {
+	scriptParser
+	scopes []map[string]interface{}
+}
+
+// push starts a new variable scope.
+func (p *scadParser) push() {
+	p.scopes = append(p.scopes, make(map[string]interface{}))
+}
+
+// pop ends a variable scope.
+func (p *scadParser) pop() {
+	p.scopes = p.scopes[:len(p.scopes)-1]
+}
+
+// lookup returns the value of a variable.
+func (p *scadParser) lookup(name string) (interface{}, bool) {
+	for i := len(p.scopes) - 1; i >= 0; i-- {
+		if v, ok := p.scopes[i][name]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// isIdent returns true if the next token is the identifier.
+func (p *scadParser) isIdent(s string) bool {
+	t := p.peek()
+	return t.typ == tokenIdent && t.text == s
+}
+
+// statements evaluates the statements up to the end punctuation (or the end
+// of the source) and returns the objects they create.
+func (p *scadParser) statements(end string) ([]interface{}, error) {
+	var objs []interface{}
+	for {
+		t := p.peek()
+		if t.typ == tokenEOF {
+			if end != "" {
+				return nil, p.errorf(t, "expected '%s'", end)
+			}
+			return objs, nil
+		}
+		if end != "" && p.isPunct(end) {
+			p.next()
+			return objs, nil
+		}
+		o, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, o...)
+	}
+}
+
+// statement evaluates a statement and returns the objects it creates.
+func (p *scadParser) statement() ([]interface{}, error) {
+	t := p.peek()
+	switch {
+	case p.isPunct(";"):
+		p.next()
+		return nil, nil
+	case p.isPunct("{"):
+		p.next()
+		p.push()
+		defer p.pop()
+		return p.statements("}")
+	case p.isPunct("*") || p.isPunct("%"):
+		// disabled or background object
+		p.next()
+		return nil, p.skip()
+	case p.isPunct("#") || p.isPunct("!"):
+		// highlighted or root object
+		p.next()
+		return p.statement()
+	case t.typ == tokenEOF:
+		return nil, p.errorf(t, "unexpected end of source")
+	case t.typ != tokenIdent:
+		return nil, p.errorf(t, "unexpected \"%s\"", t.text)
+	}
+	switch t.text {
+	case "for":
+		return p.forLoop()
+	case "if":
+		return p.ifElse()
+	case "module", "function", "include", "use":
+		return nil, p.errorf(t, "\"%s\" is not supported", t.text)
+	}
+	p.next()
+	if p.isPunct("=") {
+		// assignment
+		p.next()
+		v, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		p.scopes[len(p.scopes)-1][t.text] = v
+		return nil, p.expect(";")
+	}
+	return p.instance(t)
+}
+
+// instance evaluates a module instantiation and returns the object it creates.
+func (p *scadParser) instance(name scriptToken) ([]interface{}, error) {
+	m, ok := scadModules[name.text]
+	if !ok {
+		return nil, p.errorf(name, "unknown module \"%s\"", name.text)
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	a, err := p.args()
+	if err != nil {
+		return nil, err
+	}
+	// the children have their own scope
+	p.push()
+	children, err := p.statement()
+	p.pop()
+	if err != nil {
+		return nil, err
+	}
+	o, err := scadCall(m, a, children)
+	if err != nil {
+		return nil, p.errorf(name, "%s: %s", name.text, err)
+	}
+	if o == nil {
+		return nil, nil
+	}
+	return []interface{}{o}, nil
+}
+
+// forLoop evaluates a for loop and returns the union of the objects it creates.
+func (p *scadParser) forLoop() ([]interface{}, error) {
+	p.next()
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var names []string
+	var values [][]interface{}
+	for {
+		t := p.next()
+		if t.typ != tokenIdent {
+			return nil, p.errorf(t, "expected a loop variable")
+		}
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+		v, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		l, err := scadIterate(v)
+		if err != nil {
+			return nil, p.errorf(t, "%s", err)
+		}
+		names = append(names, t.text)
+		values = append(values, l)
+		if p.isPunct(")") {
+			p.next()
+			break
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+	// evaluate the body for each (nested) loop value
+	start := p.pos
+	var objs []interface{}
+	var loop func(i int) error
+	loop = func(i int) error {
+		if i == len(names) {
+			p.pos = start
+			o, err := p.statement()
+			objs = append(objs, o...)
+			return err
+		}
+		for _, v := range values[i] {
+			p.push()
+			p.scopes[len(p.scopes)-1][names[i]] = v
+			err := loop(i + 1)
+			p.pop()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := loop(0); err != nil {
+		return nil, err
+	}
+	p.pos = start
+	if err := p.skip(); err != nil {
+		return nil, err
+	}
+	s, err := scadUnion(objs)
+	if err != nil || s == nil {
+		return nil, err
+	}
+	return []interface{}{s}, nil
+}
+
+// ifElse evaluates an if/else statement and returns the objects it creates.
+func (p *scadParser) ifElse() ([]interface{}, error) {
+	p.next()
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	c, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	var objs []interface{}
+	if scadTrue(c) {
+		objs, err = p.statement()
+	} else {
+		err = p.skip()
+	}
+	if err != nil || !p.isIdent("else") {
+		return objs, err
+	}
+	p.next()
+	if scadTrue(c) {
+		return objs, p.skip()
+	}
+	return p.statement()
+}
+
+// skip skips a statement without evaluating it.
+func (p *scadParser) skip() error {
+	switch {
+	case p.isPunct("{"):
+		return p.skipBlock("{", "}")
+	case p.isIdent("if") || p.isIdent("for"):
+		t := p.next()
+		if err := p.skipBlock("(", ")"); err != nil {
+			return err
+		}
+		if err := p.skip(); err != nil {
+			return err
+		}
+		if t.text == "if" && p.isIdent("else") {
+			p.next()
+			return p.skip()
+		}
+		return nil
+	}
+	// skip to the end of the statement (or the children block)
+	depth := 0
+	for {
+		t := p.peek()
+		switch {
+		case t.typ == tokenEOF:
+			return p.errorf(t, "unexpected end of source")
+		case depth == 0 && (p.isIdent("if") || p.isIdent("for")):
+			return p.skip()
+		case depth == 0 && p.isPunct("{"):
+			return p.skipBlock("{", "}")
+		}
+		p.next()
+		if t.typ == tokenPunct {
+			switch t.text {
+			case "(", "[":
+				depth++
+			case ")", "]":
+				depth--
+			case ";":
+				if depth == 0 {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// skipBlock skips the tokens up to and including the matching closing bracket.
+func (p *scadParser) skipBlock(open, close string) error {
+	if err := p.expect(open); err != nil {
+		return err
+	}
+	for depth := 1; depth > 0; {
+		t := p.next()
+		if t.typ == tokenEOF {
+			return p.errorf(t, "expected '%s'", close)
+		}
+		if t.typ == tokenPunct {
+			switch t.text {
+			case open:
+				depth++
+			case close:
+				depth--
+			}
+		}
+	}
+	return nil
+}
+
+// args evaluates the (positional and named) arguments of a call up to the
+// closing parenthesis.
+func (p *scadParser) args() (*scadArgs, error) {
+	a := &scadArgs{named: make(map[string]interface{})}
+	if p.isPunct(")") {
+		p.next()
+		return a, nil
+	}
+	for {
+		t := p.peek()
+		if t.typ == tokenIdent && p.tokens[p.pos+1].typ == tokenPunct && p.tokens[p.pos+1].text == "=" {
+			p.next()
+			p.next()
+			v, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			a.named[t.text] = v
+		} else {
+			v, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			a.pos = append(a.pos, v)
+		}
+		if p.isPunct(",") {
+			p.next()
+			continue
+		}
+		return a, p.expect(")")
+	}
+}
+
+// scadLevels are the binary operators in order of increasing precedence.
+var scadLevels = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+// expr evaluates a conditional expression.
+func (p *scadParser) expr() (interface{}, error) {
+	c, err := p.binary(0)
+	if err != nil || !p.isPunct("?") {
+		return c, err
+	}
+	p.next()
+	a, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	b, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if scadTrue(c) {
+		return a, nil
+	}
+	return b, nil
+}
+
+// binary evaluates a binary expression at a precedence level.
+func (p *scadParser) binary(level int) (interface{}, error) {
+	if level == len(scadLevels) {
+		return p.unary()
+	}
+	a, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.typ != tokenPunct || !scadHasOp(scadLevels[level], t.text) {
+			return a, nil
+		}
+		p.next()
+		b, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		if a, err = scadOp(t.text, a, b); err != nil {
+			return nil, p.errorf(t, "%s", err)
+		}
+	}
+}
+
+// scadHasOp returns true if an operator is in a list of operators.
+func scadHasOp(ops []string, op string) bool {
+	for _, x := range ops {
+		if x == op {
+			return true
+		}
+	}
+	return false
+}
+
+// unary evaluates a negated or logically inverted expression.
+func (p *scadParser) unary() (interface{}, error) {
+	switch {
+	case p.isPunct("-"):
+		t := p.next()
+		a, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		v, err := scriptArith("*", -1.0, a)
+		if err != nil {
+			return nil, p.errorf(t, "can't negate a %s", scadTypeName(a))
+		}
+		return v, nil
+	case p.isPunct("+"):
+		p.next()
+		return p.unary()
+	case p.isPunct("!"):
+		p.next()
+		a, err := p.unary()
+		return !scadTrue(a), err
+	}
+	return p.postfix()
+}
+
+// postfix evaluates a primary expression followed by indexes.
+func (p *scadParser) postfix() (interface{}, error) {
+	v, err := p.primary()
+	for err == nil && p.isPunct("[") {
+		t := p.next()
+		var i interface{}
+		if i, err = p.expr(); err != nil {
+			break
+		}
+		if err = p.expect("]"); err != nil {
+			break
+		}
+		if v, err = scadIndex(v, i); err != nil {
+			err = p.errorf(t, "%s", err)
+		}
+	}
+	return v, err
+}
+
+// primary evaluates a literal, variable, function call, vector, range or
+// parenthesized expression.
+func (p *scadParser) primary() (interface{}, error) {
+	t := p.next()
+	switch t.typ {
+	case tokenNumber:
+		return t.num, nil
+	case tokenString:
+		return t.text, nil
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "undef":
+			return nil, nil
+		case "PI":
+			return Pi, nil
+		}
+		if p.isPunct("(") {
+			return p.call(t)
+		}
+		v, ok := p.lookup(t.text)
+		if !ok {
+			return nil, p.errorf(t, "undefined variable \"%s\"", t.text)
+		}
+		return v, nil
+	case tokenPunct:
+		switch t.text {
+		case "(":
+			v, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			return v, p.expect(")")
+		case "[":
+			return p.vector(t)
+		}
+	case tokenEOF:
+		return nil, p.errorf(t, "unexpected end of source")
+	}
+	return nil, p.errorf(t, "unexpected \"%s\"", t.text)
+}
+
+// vector evaluates a vector or a range up to the closing bracket.
+func (p *scadParser) vector(t scriptToken) (interface{}, error) {
+	if p.isPunct("]") {
+		p.next()
+		return scriptList{}, nil
+	}
+	v, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.isPunct(":") {
+		// [start : end] or [start : step : end]
+		x := []interface{}{v}
+		for p.isPunct(":") && len(x) < 3 {
+			p.next()
+			v, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			x = append(x, v)
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		r, ok := scriptVector(scriptList(x))
+		if !ok {
+			return nil, p.errorf(t, "range values must be numbers")
+		}
+		if len(r) == 2 {
+			return scadRange{r[0], 1, r[1]}, nil
+		}
+		return scadRange{r[0], r[1], r[2]}, nil
+	}
+	l := scriptList{v}
+	for p.isPunct(",") {
+		p.next()
+		v, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, v)
+	}
+	return l, p.expect("]")
+}
+
+// call evaluates a builtin function call.
+func (p *scadParser) call(name scriptToken) (interface{}, error) {
+	p.next()
+	a, err := p.args()
+	if err != nil {
+		return nil, err
+	}
+	fn, ok := scadFunctions[name.text]
+	if !ok {
+		return nil, p.errorf(name, "unknown function \"%s\"", name.text)
+	}
+	if len(a.named) != 0 {
+		return nil, p.errorf(name, "%s: named arguments are not supported", name.text)
+	}
+	v, err := scriptCall(fn, a.pos)
+	if err != nil {
+		return nil, p.errorf(name, "%s: %s", name.text, err)
+	}
+	return v, nil
+}
+
+//-----------------------------------------------------------------------------
+// Builtin functions
+
+// scadTrig returns a builtin for a trigonometric function of an angle in degrees.
+func scadTrig(fn func(float64) float64) scriptFunc {
+	return scriptMath(func(x float64) float64 { return fn(DtoR(x)) })
+}
+
+// scadInverseTrig returns a builtin for an inverse trigonometric function
+// returning an angle in degrees.
+func scadInverseTrig(fn func(float64) float64) scriptFunc {
+	return scriptMath(func(x float64) float64 { return RtoD(fn(x)) })
+}
+
+// scadMinMax returns a builtin for the minimum or maximum of a vector or of
+// the arguments.
+func scadMinMax(fn func(a, b float64) float64) scriptFunc {
+	return func(a scriptArgs) (interface{}, error) {
+		x, ok := scriptVector(scriptList(a))
+		if len(a) == 1 {
+			x, ok = scriptVector(a[0])
+		}
+		if !ok || len(x) == 0 {
+			return nil, errors.New("needs a vector or numbers")
+		}
+		m := x[0]
+		for _, v := range x[1:] {
+			m = fn(m, v)
+		}
+		return m, nil
+	}
+}
+
+var scadFunctions map[string]scriptFunc
+
+func init() {
+	scadFunctions = map[string]scriptFunc{
+		"sin":   scadTrig(math.Sin),
+		"cos":   scadTrig(math.Cos),
+		"tan":   scadTrig(math.Tan),
+		"asin":  scadInverseTrig(math.Asin),
+		"acos":  scadInverseTrig(math.Acos),
+		"atan":  scadInverseTrig(math.Atan),
+		"sqrt":  scriptMath(math.Sqrt),
+		"abs":   scriptMath(math.Abs),
+		"exp":   scriptMath(math.Exp),
+		"ln":    scriptMath(math.Log),
+		"log":   scriptMath(math.Log10),
+		"floor": scriptMath(math.Floor),
+		"ceil":  scriptMath(math.Ceil),
+		"round": scriptMath(math.Round),
+		"min":   scadMinMax(math.Min),
+		"max":   scadMinMax(math.Max),
+		"atan2": func(a scriptArgs) (interface{}, error) {
+			x, err := scriptNums(a, 2)
+			if err != nil {
+				return nil, err
+			}
+			return RtoD(math.Atan2(x[0], x[1])), a.count(2, 2)
+		},
+		"pow": func(a scriptArgs) (interface{}, error) {
+			x, err := scriptNums(a, 2)
+			if err != nil {
+				return nil, err
+			}
+			return math.Pow(x[0], x[1]), a.count(2, 2)
+		},
+		"len": func(a scriptArgs) (interface{}, error) {
+			if err := a.count(1, 1); err != nil {
+				return nil, err
+			}
+			switch v := a[0].(type) {
+			case scriptList:
+				return float64(len(v)), nil
+			case string:
+				return float64(len([]rune(v))), nil
+			}
+			return nil, fmt.Errorf("can't get the length of a %s", scadTypeName(a[0]))
+		},
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Modules
+
+// scadArgs are the arguments of a module.
+type scadArgs struct {
+	pos   []interface{}          // positional arguments
+	named map[string]interface{} // named arguments
+}
+
+// scadModule is a builtin module, it returns the object it creates (or nil).
+type scadModule func(a *scadArgs, children []interface{}) (interface{}, error)
+
+// get returns the argument with a name or at a position (i < 0 for named only).
+func (a *scadArgs) get(i int, name string) interface{} {
+	if v, ok := a.named[name]; ok {
+		return v
+	}
+	if i >= 0 && i < len(a.pos) {
+		return a.pos[i]
+	}
+	return nil
+}
+
+// num returns a number argument (or a default for a missing argument).
+func (a *scadArgs) num(i int, name string, def float64) (float64, error) {
+	v := a.get(i, name)
+	if v == nil {
+		return def, nil
+	}
+	x, ok := v.(float64)
+	if !ok {
+		return 0, fmt.Errorf("%s is a %s, not a number", name, scadTypeName(v))
+	}
+	return x, nil
+}
+
+// flag returns a boolean argument (false for a missing argument).
+func (a *scadArgs) flag(i int, name string) bool {
+	return scadTrue(a.get(i, name))
+}
+
+// vec returns a vector argument with n elements. A number is used for all
+// elements, and the default is used for a missing argument or elements.
+func (a *scadArgs) vec(i int, name string, n int, def float64) ([]float64, error) {
+	x := make([]float64, n)
+	for j := range x {
+		x[j] = def
+	}
+	switch v := a.get(i, name).(type) {
+	case nil:
+	case float64:
+		for j := range x {
+			x[j] = v
+		}
+	default:
+		e, ok := scriptVector(v)
+		if !ok {
+			return nil, fmt.Errorf("%s is a %s, not a vector", name, scadTypeName(v))
+		}
+		copy(x, e)
+	}
+	return x, nil
+}
+
+// radius returns a radius given as a radius or a diameter argument.
+func (a *scadArgs) radius(i int, r, d string, def float64) (float64, error) {
+	if _, ok := a.named[d]; ok {
+		x, err := a.num(-1, d, 0)
+		return x / 2, err
+	}
+	return a.num(i, r, def)
+}
+
+// scadCall calls a builtin module, the SDF constructors panic on bad
+// arguments so a panic is returned as an error.
+func scadCall(m scadModule, a *scadArgs, children []interface{}) (v interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			v, err = nil, fmt.Errorf("%v", r)
+		}
+	}()
+	return m(a, children)
+}
+
+// scadUnion returns the union of the objects (nil if there are none).
+func scadUnion(objs []interface{}) (interface{}, error) {
+	s3, s2, err := scriptArgs(objs).shapes(0)
+	if err != nil {
+		return nil, err
+	}
+	if s3 != nil {
+		return Union3D(s3...), nil
+	}
+	if s2 != nil {
+		return Union2D(s2...), nil
+	}
+	return nil, nil
+}
+
+// scadTransform applies a 3d or 2d transform to the union of the children.
+func scadTransform(children []interface{}, m3 M44, m2 M33) (interface{}, error) {
+	s, err := scadUnion(children)
+	switch s := s.(type) {
+	case SDF3:
+		return Transform3D(s, m3), nil
+	case SDF2:
+		return Transform2D(s, m2), nil
+	}
+	return nil, err
+}
+
+var scadModules map[string]scadModule
+
+func init() {
+	scadModules = map[string]scadModule{
+		// 3d
+		"cube": func(a *scadArgs, _ []interface{}) (interface{}, error) {
+			v, err := a.vec(0, "size", 3, 1)
+			if err != nil {
+				return nil, err
+			}
+			size := V3{v[0], v[1], v[2]}
+			s := Box3D(size, 0)
+			if a.flag(1, "center") {
+				return s, nil
+			}
+			return Transform3D(s, Translate3d(size.MulScalar(0.5))), nil
+		},
+		"sphere": func(a *scadArgs, _ []interface{}) (interface{}, error) {
+			r, err := a.radius(0, "r", "d", 1)
+			if err != nil {
+				return nil, err
+			}
+			return Sphere3D(r), nil
+		},
+		"cylinder": func(a *scadArgs, _ []interface{}) (interface{}, error) {
+			h, err := a.num(0, "h", 1)
+			if err != nil {
+				return nil, err
+			}
+			r, err := a.radius(-1, "r", "d", 1)
+			if err != nil {
+				return nil, err
+			}
+			r1, err := a.radius(1, "r1", "d1", r)
+			if err != nil {
+				return nil, err
+			}
+			r2, err := a.radius(2, "r2", "d2", r)
+			if err != nil {
+				return nil, err
+			}
+			var s SDF3
+			if r1 == r2 {
+				s = Cylinder3D(h, r1, 0)
+			} else {
+				s = Cone3D(h, r1, r2, 0)
+			}
+			if a.flag(3, "center") {
+				return s, nil
+			}
+			return Transform3D(s, Translate3d(V3{0, 0, h / 2})), nil
+		},
+		"linear_extrude": func(a *scadArgs, children []interface{}) (interface{}, error) {
+			_, s2, err := scriptArgs(children).shapes(0)
+			if err != nil {
+				return nil, err
+			}
+			if s2 == nil {
+				return nil, errors.New("needs 2d children")
+			}
+			h, err := a.num(0, "height", 100)
+			if err != nil {
+				return nil, err
+			}
+			twist, err := a.num(3, "twist", 0)
+			if err != nil {
+				return nil, err
+			}
+			k, err := a.vec(5, "scale", 2, 1)
+			if err != nil {
+				return nil, err
+			}
+			s := Union2D(s2...)
+			scale := V2{k[0], k[1]}
+			// OpenSCAD twists clockwise from the bottom of the extrusion
+			twist = DtoR(twist)
+			if twist != 0 {
+				s = Transform2D(s, Rotate2d(-twist/2))
+			}
+			var s3 SDF3
+			switch {
+			case twist == 0 && scale == (V2{1, 1}):
+				s3 = Extrude3D(s, h)
+			case scale == (V2{1, 1}):
+				s3 = TwistExtrude3D(s, h, twist)
+			case twist == 0:
+				s3 = ScaleExtrude3D(s, h, scale)
+			default:
+				s3 = ScaleTwistExtrude3D(s, h, twist, scale)
+			}
+			if a.flag(1, "center") {
+				return s3, nil
+			}
+			return Transform3D(s3, Translate3d(V3{0, 0, h / 2})), nil
+		},
+		// 2d
+		"square": func(a *scadArgs, _ []interface{}) (interface{}, error) {
+			v, err := a.vec(0, "size", 2, 1)
+			if err != nil {
+				return nil, err
+			}
+			size := V2{v[0], v[1]}
+			s := Box2D(size, 0)
+			if a.flag(1, "center") {
+				return s, nil
+			}
+			return Transform2D(s, Translate2d(size.MulScalar(0.5))), nil
+		},
+		"circle": func(a *scadArgs, _ []interface{}) (interface{}, error) {
+			r, err := a.radius(0, "r", "d", 1)
+			if err != nil {
+				return nil, err
+			}
+			return Circle2D(r), nil
+		},
+		"polygon": func(a *scadArgs, _ []interface{}) (interface{}, error) {
+			if a.get(1, "paths") != nil {
+				return nil, errors.New("paths are not supported")
+			}
+			points, ok := a.get(0, "points").(scriptList)
+			if !ok {
+				return nil, errors.New("points is not a list")
+			}
+			v := make([]V2, len(points))
+			for i, x := range points {
+				p, ok := scriptVector(x)
+				if !ok || len(p) != 2 {
+					return nil, fmt.Errorf("point %d is not a 2d vector", i)
+				}
+				v[i] = V2{p[0], p[1]}
+			}
+			return Polygon2D(v), nil
+		},
+		// transforms
+		"translate": func(a *scadArgs, children []interface{}) (interface{}, error) {
+			v, err := a.vec(0, "v", 3, 0)
+			if err != nil {
+				return nil, err
+			}
+			return scadTransform(children, Translate3d(V3{v[0], v[1], v[2]}), Translate2d(V2{v[0], v[1]}))
+		},
+		"rotate": func(a *scadArgs, children []interface{}) (interface{}, error) {
+			if x, ok := a.get(0, "a").(float64); ok {
+				// a rotation about the z axis, or about the v axis
+				m3 := RotateZ(DtoR(x))
+				if a.get(1, "v") != nil {
+					v, err := a.vec(1, "v", 3, 0)
+					if err != nil {
+						return nil, err
+					}
+					m3 = Rotate3d(V3{v[0], v[1], v[2]}, DtoR(x))
+				}
+				return scadTransform(children, m3, Rotate2d(DtoR(x)))
+			}
+			// rotations about the x, y and z axes (in that order)
+			v, err := a.vec(0, "a", 3, 0)
+			if err != nil {
+				return nil, err
+			}
+			m3 := RotateZ(DtoR(v[2])).Mul(RotateY(DtoR(v[1]))).Mul(RotateX(DtoR(v[0])))
+			return scadTransform(children, m3, Rotate2d(DtoR(v[2])))
+		},
+		"scale": func(a *scadArgs, children []interface{}) (interface{}, error) {
+			v, err := a.vec(0, "v", 3, 1)
+			if err != nil {
+				return nil, err
+			}
+			s, err := scadUnion(children)
+			if err != nil {
+				return nil, err
+			}
+			k := v[0]
+			if k <= 0 || v[1] != k {
+				return nil, errors.New("only uniform scaling (> 0) is supported")
+			}
+			switch s := s.(type) {
+			case SDF3:
+				if v[2] != k {
+					return nil, errors.New("only uniform scaling (> 0) is supported")
+				}
+				return ScaleUniform3D(s, k), nil
+			case SDF2:
+				return ScaleUniform2D(s, k), nil
+			}
+			return nil, nil
+		},
+		"mirror": func(a *scadArgs, children []interface{}) (interface{}, error) {
+			v, err := a.vec(0, "v", 3, 0)
+			if err != nil {
+				return nil, err
+			}
+			// reflections in the planes (lines) normal to v
+			n := V3{v[0], v[1], v[2]}
+			if n.Length() == 0 {
+				return nil, errors.New("mirror vector is 0")
+			}
+			n = n.Normalize()
+			m3 := M44{
+				1 - 2*n.X*n.X, -2 * n.X * n.Y, -2 * n.X * n.Z, 0,
+				-2 * n.X * n.Y, 1 - 2*n.Y*n.Y, -2 * n.Y * n.Z, 0,
+				-2 * n.X * n.Z, -2 * n.Y * n.Z, 1 - 2*n.Z*n.Z, 0,
+				0, 0, 0, 1}
+			m2 := Identity2d()
+			if n2 := (V2{v[0], v[1]}); n2.Length() != 0 {
+				n2 = n2.Normalize()
+				m2 = M33{
+					1 - 2*n2.X*n2.X, -2 * n2.X * n2.Y, 0,
+					-2 * n2.X * n2.Y, 1 - 2*n2.Y*n2.Y, 0,
+					0, 0, 1}
+			}
+			return scadTransform(children, m3, m2)
+		},
+		"multmatrix": func(a *scadArgs, children []interface{}) (interface{}, error) {
+			rows, ok := a.get(0, "m").(scriptList)
+			if !ok || len(rows) < 3 || len(rows) > 4 {
+				return nil, errors.New("m is not a 4x4 matrix")
+			}
+			var x [4][4]float64
+			x[3][3] = 1
+			for i, row := range rows {
+				r, ok := scriptVector(row)
+				if !ok || len(r) != 4 {
+					return nil, errors.New("m is not a 4x4 matrix")
+				}
+				copy(x[i][:], r)
+			}
+			m3 := M44{
+				x[0][0], x[0][1], x[0][2], x[0][3],
+				x[1][0], x[1][1], x[1][2], x[1][3],
+				x[2][0], x[2][1], x[2][2], x[2][3],
+				x[3][0], x[3][1], x[3][2], x[3][3]}
+			m2 := M33{
+				x[0][0], x[0][1], x[0][3],
+				x[1][0], x[1][1], x[1][3],
+				0, 0, 1}
+			return scadTransform(children, m3, m2)
+		},
+		"offset": func(a *scadArgs, children []interface{}) (interface{}, error) {
+			if a.get(-1, "delta") != nil {
+				return nil, errors.New("delta is not supported")
+			}
+			r, err := a.num(0, "r", 0)
+			if err != nil {
+				return nil, err
+			}
+			s, err := scadUnion(children)
+			switch s := s.(type) {
+			case SDF3:
+				return nil, errors.New("needs 2d children")
+			case SDF2:
+				return Offset2D(s, r), nil
+			}
+			return nil, err
+		},
+		// booleans
+		"union": func(a *scadArgs, children []interface{}) (interface{}, error) {
+			return scadUnion(children)
+		},
+		"color": func(a *scadArgs, children []interface{}) (interface{}, error) {
+			return scadUnion(children)
+		},
+		"difference": func(a *scadArgs, children []interface{}) (interface{}, error) {
+			s3, s2, err := scriptArgs(children).shapes(0)
+			switch {
+			case err != nil:
+				return nil, err
+			case len(s3) == 1:
+				return s3[0], nil
+			case s3 != nil:
+				return Difference3D(s3[0], Union3D(s3[1:]...)), nil
+			case len(s2) == 1:
+				return s2[0], nil
+			case s2 != nil:
+				return Difference2D(s2[0], Union2D(s2[1:]...)), nil
+			}
+			return nil, nil
+		},
+		"intersection": func(a *scadArgs, children []interface{}) (interface{}, error) {
+			s3, s2, err := scriptArgs(children).shapes(0)
+			if err != nil {
+				return nil, err
+			}
+			if s2 != nil {
+				return nil, errors.New("2d intersection is not supported")
+			}
+			if s3 == nil {
+				return nil, nil
+			}
+			s := s3[0]
+			for _, x := range s3[1:] {
+				s = Intersect3D(s, x)
+			}
+			return s, nil
+		},
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// EvalSCAD evaluates OpenSCAD source. It returns the model, either an SDF3
+// or an SDF2 (the other is nil).
+func EvalSCAD(src string) (SDF3, SDF2, error) {
+	tokens, err := scadLex(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	p := scadParser{scriptParser: scriptParser{tokens: tokens}}
+	p.push()
+	objs, err := p.statements("")
+	if err != nil {
+		return nil, nil, err
+	}
+	s, err := scadUnion(objs)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch s := s.(type) {
+	case SDF3:
+		return s, nil, nil
+	case SDF2:
+		return nil, s, nil
+	}
+	return nil, nil, errors.New("the source has no objects")
+}
+
+// LoadSCAD loads and evaluates an OpenSCAD file.
+func LoadSCAD(path string) (SDF3, SDF2, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	s3, s2, err := EvalSCAD(string(src))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return s3, s2, nil
+}
+
+//-----------------------------------------------------------------------------
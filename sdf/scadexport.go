@@ -0,0 +1,288 @@
+//-----------------------------------------------------------------------------
+/*
+
+OpenSCAD Export
+
+Walk an SDF3 CSG tree and write it as OpenSCAD source, so sdfx designs can
+be shared with OpenSCAD users (see EvalSCAD for the inverse).
+
+These SDF3s map to OpenSCAD modules: boxes, spheres, cylinders, cones
+(without rounding), transforms, uniform scaling, positive offsets, tags
+and anchors (which are left out), normal extrusions of 2d shapes, and
+unions, differences and intersections with the default (unblended) min/max.
+Rounded boxes and cylinders and positive offsets are written as the
+minkowski sum of a shape and a sphere.
+
+The SDF2s that map are circles, boxes, polygons, transforms, uniform
+scaling, offsets, and unions and differences with the default min/max.
+
+Any other SDF3 (or the extrusion of any other SDF2) is meshed and written
+as a polyhedron. With SCADParms.MeshCells == 0 it's an error instead.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//-----------------------------------------------------------------------------
+
+// SCADParms defines the parameters for OpenSCAD export.
+type SCADParms struct {
+	MeshCells int // mesh cells on the longest axis for an SDF3 with no OpenSCAD equivalent (0 == return an error)
+	Fn        int // OpenSCAD $fn, the number of fragments in a circle (0 == the OpenSCAD default)
+}
+
+// scadNum returns an OpenSCAD number.
+func scadNum(x float64) string {
+	if x == 0 {
+		// no -0
+		x = 0
+	}
+	return strconv.FormatFloat(x, 'g', -1, 64)
+}
+
+// scadV3 returns an OpenSCAD 3d vector.
+func scadV3(v V3) string {
+	return fmt.Sprintf("[%s, %s, %s]", scadNum(v.X), scadNum(v.Y), scadNum(v.Z))
+}
+
+// scadV2 returns an OpenSCAD 2d vector.
+func scadV2(v V2) string {
+	return fmt.Sprintf("[%s, %s]", scadNum(v.X), scadNum(v.Y))
+}
+
+// scadWriter writes the OpenSCAD statements for an SDF3.
+type scadWriter struct {
+	buf   bytes.Buffer
+	k     *SCADParms
+	depth int // indentation depth
+}
+
+// line writes an indented line.
+func (w *scadWriter) line(format string, args ...interface{}) {
+	w.buf.WriteString(strings.Repeat("\t", w.depth))
+	fmt.Fprintf(&w.buf, format, args...)
+	w.buf.WriteByte('\n')
+}
+
+// group writes a module instantiation with n children.
+func (w *scadWriter) group(module string, n int, child func(i int) error) error {
+	w.line("%s {", module)
+	w.depth++
+	for i := 0; i < n; i++ {
+		if err := child(i); err != nil {
+			return err
+		}
+	}
+	w.depth--
+	w.line("}")
+	return nil
+}
+
+// minkowski writes the minkowski sum of a shape and a sphere.
+func (w *scadWriter) minkowski(r float64, child func() error) error {
+	return w.group("minkowski()", 2, func(i int) error {
+		if i == 0 {
+			return child()
+		}
+		w.line("sphere(r = %s);", scadNum(r))
+		return nil
+	})
+}
+
+// sdf3 writes the statements for an SDF3.
+func (w *scadWriter) sdf3(s SDF3) error {
+	one := func(x SDF3) func(int) error {
+		return func(int) error { return w.sdf3(x) }
+	}
+	switch s := s.(type) {
+	case *BoxSDF3:
+		cube := fmt.Sprintf("cube(%s, center = true);", scadV3(s.size.MulScalar(2)))
+		if s.round == 0 {
+			w.line("%s", cube)
+			return nil
+		}
+		return w.minkowski(s.round, func() error { w.line("%s", cube); return nil })
+	case *SphereSDF3:
+		w.line("sphere(r = %s);", scadNum(s.radius))
+		return nil
+	case *CylinderSDF3:
+		if s.radius == 0 {
+			break
+		}
+		cylinder := fmt.Sprintf("cylinder(h = %s, r = %s, center = true);", scadNum(2*s.height), scadNum(s.radius))
+		if s.round == 0 {
+			w.line("%s", cylinder)
+			return nil
+		}
+		return w.minkowski(s.round, func() error { w.line("%s", cylinder); return nil })
+	case *ConeSDF3:
+		if s.round != 0 {
+			break
+		}
+		w.line("cylinder(h = %s, r1 = %s, r2 = %s, center = true);", scadNum(s.z1-s.z0), scadNum(s.r0), scadNum(s.r1))
+		return nil
+	case *TransformSDF3:
+		m := s.matrix
+		return w.group(fmt.Sprintf("multmatrix([[%s, %s, %s, %s], [%s, %s, %s, %s], [%s, %s, %s, %s], [%s, %s, %s, %s]])",
+			scadNum(m.x00), scadNum(m.x01), scadNum(m.x02), scadNum(m.x03),
+			scadNum(m.x10), scadNum(m.x11), scadNum(m.x12), scadNum(m.x13),
+			scadNum(m.x20), scadNum(m.x21), scadNum(m.x22), scadNum(m.x23),
+			scadNum(m.x30), scadNum(m.x31), scadNum(m.x32), scadNum(m.x33)), 1, one(s.sdf))
+	case *ScaleUniformSDF3:
+		return w.group(fmt.Sprintf("scale(%s)", scadNum(s.k)), 1, one(s.sdf))
+	case *OffsetSDF3:
+		if s.offset == 0 {
+			return w.sdf3(s.sdf)
+		}
+		if s.offset > 0 {
+			return w.minkowski(s.offset, func() error { return w.sdf3(s.sdf) })
+		}
+	case *TagSDF3:
+		return w.sdf3(s.sdf)
+	case *AnchorSDF3:
+		return w.sdf3(s.sdf)
+	case *UnionSDF3:
+		if sameFunc(s.min, Min) {
+			return w.group("union()", len(s.sdf), func(i int) error { return w.sdf3(s.sdf[i]) })
+		}
+	case *DifferenceSDF3:
+		if sameFunc(s.max, Max) {
+			return w.group("difference()", 2, func(i int) error { return w.sdf3([]SDF3{s.s0, s.s1}[i]) })
+		}
+	case *IntersectionSDF3:
+		if sameFunc(s.max, Max) {
+			return w.group("intersection()", 2, func(i int) error { return w.sdf3([]SDF3{s.s0, s.s1}[i]) })
+		}
+	case *ExtrudeSDF3:
+		if sameFunc(s.extrude, NormalExtrude) {
+			// write the 2d shape separately, it's meshed if it can't be converted
+			w2 := scadWriter{k: w.k, depth: w.depth + 1}
+			if w2.sdf2(s.sdf) == nil {
+				w.line("linear_extrude(height = %s, center = true) {", scadNum(2*s.height))
+				w.buf.Write(w2.buf.Bytes())
+				w.line("}")
+				return nil
+			}
+		}
+	}
+	return w.mesh(s)
+}
+
+// sdf2 writes the statements for an SDF2.
+func (w *scadWriter) sdf2(s SDF2) error {
+	one := func(x SDF2) func(int) error {
+		return func(int) error { return w.sdf2(x) }
+	}
+	switch s := s.(type) {
+	case *CircleSDF2:
+		w.line("circle(r = %s);", scadNum(s.radius))
+		return nil
+	case *BoxSDF2:
+		square := fmt.Sprintf("square(%s, center = true);", scadV2(s.size.MulScalar(2)))
+		if s.round == 0 {
+			w.line("%s", square)
+			return nil
+		}
+		return w.group(fmt.Sprintf("offset(r = %s)", scadNum(s.round)), 1, func(int) error { w.line("%s", square); return nil })
+	case *PolySDF2:
+		v := s.vertex
+		if len(v) > 1 && v[0] == v[len(v)-1] {
+			v = v[:len(v)-1]
+		}
+		points := make([]string, len(v))
+		for i := range v {
+			points[i] = scadV2(v[i])
+		}
+		w.line("polygon([%s]);", strings.Join(points, ", "))
+		return nil
+	case *TransformSDF2:
+		m := s.mInv.Inverse()
+		return w.group(fmt.Sprintf("multmatrix([[%s, %s, 0, %s], [%s, %s, 0, %s], [0, 0, 1, 0], [0, 0, 0, 1]])",
+			scadNum(m.x00), scadNum(m.x01), scadNum(m.x02),
+			scadNum(m.x10), scadNum(m.x11), scadNum(m.x12)), 1, one(s.sdf))
+	case *ScaleUniformSDF2:
+		return w.group(fmt.Sprintf("scale(%s)", scadNum(s.k)), 1, one(s.sdf))
+	case *OffsetSDF2:
+		return w.group(fmt.Sprintf("offset(r = %s)", scadNum(s.offset)), 1, one(s.sdf))
+	case *UnionSDF2:
+		if sameFunc(s.min, Min) {
+			return w.group("union()", len(s.sdf), func(i int) error { return w.sdf2(s.sdf[i]) })
+		}
+	case *DifferenceSDF2:
+		if sameFunc(s.max, Max) {
+			return w.group("difference()", 2, func(i int) error { return w.sdf2([]SDF2{s.s0, s.s1}[i]) })
+		}
+	}
+	return fmt.Errorf("%T can't be converted to OpenSCAD", s)
+}
+
+// mesh writes an SDF3 as a polyhedron.
+func (w *scadWriter) mesh(s SDF3) error {
+	if w.k.MeshCells <= 0 {
+		return fmt.Errorf("%T can't be converted to OpenSCAD", s)
+	}
+	index := make(map[V3]int)
+	var points, faces []string
+	for _, t := range GenerateTriangles(s, w.k.MeshCells) {
+		var f [3]int
+		for j, v := range t.V {
+			i, ok := index[v]
+			if !ok {
+				i = len(points)
+				index[v] = i
+				points = append(points, scadV3(v))
+			}
+			f[j] = i
+		}
+		if f[0] == f[1] || f[1] == f[2] || f[2] == f[0] {
+			// degenerate triangle
+			continue
+		}
+		// OpenSCAD faces are clockwise when seen from the outside
+		faces = append(faces, fmt.Sprintf("[%d, %d, %d]", f[0], f[2], f[1]))
+	}
+	w.line("// meshed %T", s)
+	w.line("polyhedron(points = [%s], faces = [%s]);", strings.Join(points, ", "), strings.Join(faces, ", "))
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// EncodeSCAD writes an SDF3 CSG tree as OpenSCAD source.
+func EncodeSCAD(w io.Writer, s SDF3, k *SCADParms) error {
+	sw := scadWriter{k: k}
+	sw.line("// generated by sdfx")
+	if k.Fn > 0 {
+		sw.line("$fn = %d;", k.Fn)
+	}
+	if err := sw.sdf3(s); err != nil {
+		return err
+	}
+	_, err := w.Write(sw.buf.Bytes())
+	return err
+}
+
+// SaveSCAD saves an SDF3 CSG tree as an OpenSCAD file.
+func SaveSCAD(s SDF3, path string, k *SCADParms) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := EncodeSCAD(f, s, k); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+//-----------------------------------------------------------------------------
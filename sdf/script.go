@@ -0,0 +1,861 @@
+//-----------------------------------------------------------------------------
+/*
+
+Model Scripts
+
+A small expression language for defining models, so a design can be edited
+and re-meshed without recompiling Go (e.g. "sdfx mesh model.sdfx").
+
+	// a plate with a hole
+	r = 4
+	plate = box([40, 30, 5], 1)
+	hole = cylinder(10, r)
+	difference(plate, translate([10, 0, 0], hole))
+
+A script is a sequence of statements (one per line, or separated by ';').
+A statement either assigns an expression to a variable or is an expression.
+The value of the last expression statement is the model (an SDF3 or SDF2).
+
+Values are numbers, strings, lists ([a, b, ...], vectors are lists of
+numbers) and shapes. Numbers and vectors can be added, subtracted,
+multiplied and divided (element wise, or by a number). Angles are in
+degrees. Comments start with "//" or "#".
+
+3d shapes:
+
+	box(size, [round]), sphere(r), cylinder(h, r, [round]),
+	cone(h, r0, r1, [round]), capsule(h, r), torus(r0, r1)
+
+2d shapes:
+
+	rect(size, [round]), circle(r), polygon([[x, y], ...])
+
+operations (on 2d or 3d shapes unless noted):
+
+	translate(v, s), rotate(a, s) (3d: a = [x, y, z] angles),
+	scale(k, s), offset(d, s), union(s, ...), difference(s0, s1, ...),
+	intersection(s0, s1) (3d), extrude(h, s) (2d to 3d),
+	revolve(s) (2d to 3d)
+
+math: sqrt(x), sin(a), cos(a), pi
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+//-----------------------------------------------------------------------------
+// Lexer
+
+// scriptTokenType is the type of a script token.
+type scriptTokenType int
+
+const (
+	tokenEOF scriptTokenType = iota
+	tokenNewline
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenPunct
+)
+
+// scriptToken is a lexical token of a script.
+type scriptToken struct {
+	typ  scriptTokenType
+	text string
+	num  float64
+	line int
+}
+
+// lexNumber returns the number token starting at r[i] and the index after it.
+func lexNumber(r []rune, i, line int) (scriptToken, int, error) {
+	j := i
+	for j < len(r) && (unicode.IsDigit(r[j]) || r[j] == '.' || r[j] == 'e' || r[j] == 'E' ||
+		((r[j] == '-' || r[j] == '+') && (r[j-1] == 'e' || r[j-1] == 'E'))) {
+		j++
+	}
+	x, err := strconv.ParseFloat(string(r[i:j]), 64)
+	if err != nil {
+		return scriptToken{}, 0, fmt.Errorf("line %d: bad number \"%s\"", line, string(r[i:j]))
+	}
+	return scriptToken{typ: tokenNumber, text: string(r[i:j]), num: x, line: line}, j, nil
+}
+
+// scriptLex splits a script into tokens. Newlines within brackets are ignored.
+func scriptLex(src string) ([]scriptToken, error) {
+	var tokens []scriptToken
+	line, depth := 1, 0
+	r := []rune(src)
+	for i := 0; i < len(r); {
+		c := r[i]
+		switch {
+		case c == '\n':
+			if depth == 0 {
+				tokens = append(tokens, scriptToken{typ: tokenNewline, line: line})
+			}
+			line++
+			i++
+		case unicode.IsSpace(c):
+			i++
+		case c == '#' || (c == '/' && i+1 < len(r) && r[i+1] == '/'):
+			// comment to the end of the line
+			for i < len(r) && r[i] != '\n' {
+				i++
+			}
+		case unicode.IsDigit(c) || (c == '.' && i+1 < len(r) && unicode.IsDigit(r[i+1])):
+			t, j, err := lexNumber(r, i, line)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, t)
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(r) && (unicode.IsLetter(r[j]) || unicode.IsDigit(r[j]) || r[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, scriptToken{typ: tokenIdent, text: string(r[i:j]), line: line})
+			i = j
+		case c == '"':
+			j := i + 1
+			for j < len(r) && r[j] != '"' && r[j] != '\n' {
+				j++
+			}
+			if j == len(r) || r[j] != '"' {
+				return nil, fmt.Errorf("line %d: unterminated string", line)
+			}
+			tokens = append(tokens, scriptToken{typ: tokenString, text: string(r[i+1 : j]), line: line})
+			i = j + 1
+		case strings.ContainsRune("+-*/()[],=;", c):
+			switch c {
+			case '(', '[':
+				depth++
+			case ')', ']':
+				depth--
+			}
+			tokens = append(tokens, scriptToken{typ: tokenPunct, text: string(c), line: line})
+			i++
+		default:
+			return nil, fmt.Errorf("line %d: unexpected character '%c'", line, c)
+		}
+	}
+	tokens = append(tokens, scriptToken{typ: tokenEOF, line: line})
+	return tokens, nil
+}
+
+//-----------------------------------------------------------------------------
+// Values
+
+// scriptList is a list value (a vector is a list of numbers).
+type scriptList []interface{}
+
+// scriptTypeName returns the name of the type of a script value.
+func scriptTypeName(v interface{}) string {
+	switch v.(type) {
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case scriptList:
+		return "list"
+	case SDF3:
+		return "3d shape"
+	case SDF2:
+		return "2d shape"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// scriptVector returns the numbers in a list value.
+func scriptVector(v interface{}) ([]float64, bool) {
+	l, ok := v.(scriptList)
+	if !ok {
+		return nil, false
+	}
+	x := make([]float64, len(l))
+	for i := range l {
+		if x[i], ok = l[i].(float64); !ok {
+			return nil, false
+		}
+	}
+	return x, true
+}
+
+// scriptArith applies an arithmetic operator to numbers and vectors.
+func scriptArith(op string, a, b interface{}) (interface{}, error) {
+	x, xok := a.(float64)
+	y, yok := b.(float64)
+	if xok && yok {
+		switch op {
+		case "+":
+			return x + y, nil
+		case "-":
+			return x - y, nil
+		case "*":
+			return x * y, nil
+		}
+		return x / y, nil
+	}
+	// element wise on vectors, or a vector and a number
+	va, aok := scriptVector(a)
+	vb, bok := scriptVector(b)
+	switch {
+	case aok && bok:
+		if len(va) != len(vb) {
+			return nil, errors.New("vector lengths don't match")
+		}
+	case aok && yok:
+		vb = make([]float64, len(va))
+		for i := range vb {
+			vb[i] = y
+		}
+	case xok && bok:
+		va = make([]float64, len(vb))
+		for i := range va {
+			va[i] = x
+		}
+	default:
+		return nil, fmt.Errorf("can't apply '%s' to %s and %s", op, scriptTypeName(a), scriptTypeName(b))
+	}
+	l := make(scriptList, len(va))
+	for i := range va {
+		z, _ := scriptArith(op, va[i], vb[i])
+		l[i] = z
+	}
+	return l, nil
+}
+
+//-----------------------------------------------------------------------------
+// Parser and evaluator
+
+// scriptParser evaluates a script as it is parsed.
+type scriptParser struct {
+	tokens []scriptToken
+	pos    int
+	vars   map[string]interface{}
+}
+
+func (p *scriptParser) peek() scriptToken {
+	return p.tokens[p.pos]
+}
+
+func (p *scriptParser) next() scriptToken {
+	t := p.tokens[p.pos]
+	if t.typ != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// isPunct returns true if the next token is the punctuation.
+func (p *scriptParser) isPunct(s string) bool {
+	t := p.peek()
+	return t.typ == tokenPunct && t.text == s
+}
+
+// expect consumes the expected punctuation.
+func (p *scriptParser) expect(s string) error {
+	t := p.next()
+	if t.typ != tokenPunct || t.text != s {
+		return p.errorf(t, "expected '%s'", s)
+	}
+	return nil
+}
+
+func (p *scriptParser) errorf(t scriptToken, format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", t.line, fmt.Sprintf(format, args...))
+}
+
+// program evaluates the statements of a script and returns the value of the
+// last expression statement.
+func (p *scriptParser) program() (interface{}, error) {
+	var result interface{}
+	for {
+		t := p.peek()
+		switch {
+		case t.typ == tokenEOF:
+			return result, nil
+		case t.typ == tokenNewline || p.isPunct(";"):
+			p.next()
+			continue
+		}
+		if t.typ == tokenIdent && p.tokens[p.pos+1].typ == tokenPunct && p.tokens[p.pos+1].text == "=" {
+			// assignment
+			p.next()
+			p.next()
+			v, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := scriptBuiltins[t.text]; ok || t.text == "pi" {
+				return nil, p.errorf(t, "can't assign to \"%s\"", t.text)
+			}
+			p.vars[t.text] = v
+		} else {
+			v, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			result = v
+		}
+		// end of statement
+		t = p.peek()
+		if t.typ != tokenEOF && t.typ != tokenNewline && !p.isPunct(";") {
+			return nil, p.errorf(t, "unexpected \"%s\"", t.text)
+		}
+	}
+}
+
+// expr evaluates an additive expression.
+func (p *scriptParser) expr() (interface{}, error) {
+	a, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for p.isPunct("+") || p.isPunct("-") {
+		t := p.next()
+		b, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		if a, err = scriptArith(t.text, a, b); err != nil {
+			return nil, p.errorf(t, "%s", err)
+		}
+	}
+	return a, nil
+}
+
+// term evaluates a multiplicative expression.
+func (p *scriptParser) term() (interface{}, error) {
+	a, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isPunct("*") || p.isPunct("/") {
+		t := p.next()
+		b, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		if a, err = scriptArith(t.text, a, b); err != nil {
+			return nil, p.errorf(t, "%s", err)
+		}
+	}
+	return a, nil
+}
+
+// unary evaluates a negated expression.
+func (p *scriptParser) unary() (interface{}, error) {
+	if p.isPunct("-") {
+		t := p.next()
+		a, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		v, err := scriptArith("*", -1.0, a)
+		if err != nil {
+			return nil, p.errorf(t, "can't negate a %s", scriptTypeName(a))
+		}
+		return v, nil
+	}
+	return p.primary()
+}
+
+// primary evaluates a number, string, list, variable, function call or
+// parenthesized expression.
+func (p *scriptParser) primary() (interface{}, error) {
+	t := p.next()
+	switch t.typ {
+	case tokenNumber:
+		return t.num, nil
+	case tokenString:
+		return t.text, nil
+	case tokenIdent:
+		if p.isPunct("(") {
+			return p.call(t)
+		}
+		if t.text == "pi" {
+			return Pi, nil
+		}
+		v, ok := p.vars[t.text]
+		if !ok {
+			return nil, p.errorf(t, "undefined variable \"%s\"", t.text)
+		}
+		return v, nil
+	case tokenPunct:
+		switch t.text {
+		case "(":
+			v, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			return v, p.expect(")")
+		case "[":
+			l, err := p.list("]")
+			return scriptList(l), err
+		}
+	case tokenEOF:
+		return nil, p.errorf(t, "unexpected end of script")
+	}
+	return nil, p.errorf(t, "unexpected \"%s\"", t.text)
+}
+
+// list evaluates a comma separated list of expressions up to a closing bracket.
+func (p *scriptParser) list(end string) ([]interface{}, error) {
+	var l []interface{}
+	if p.isPunct(end) {
+		p.next()
+		return l, nil
+	}
+	for {
+		v, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, v)
+		if p.isPunct(",") {
+			p.next()
+			continue
+		}
+		return l, p.expect(end)
+	}
+}
+
+// call evaluates a builtin function call.
+func (p *scriptParser) call(name scriptToken) (interface{}, error) {
+	p.next()
+	args, err := p.list(")")
+	if err != nil {
+		return nil, err
+	}
+	fn, ok := scriptBuiltins[name.text]
+	if !ok {
+		return nil, p.errorf(name, "unknown function \"%s\"", name.text)
+	}
+	v, err := scriptCall(fn, args)
+	if err != nil {
+		return nil, p.errorf(name, "%s: %s", name.text, err)
+	}
+	return v, nil
+}
+
+// scriptCall calls a builtin function, the SDF constructors panic on bad
+// arguments so a panic is returned as an error.
+func scriptCall(fn scriptFunc, args []interface{}) (v interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			v, err = nil, fmt.Errorf("%v", r)
+		}
+	}()
+	return fn(scriptArgs(args))
+}
+
+//-----------------------------------------------------------------------------
+// Builtin functions
+
+// scriptArgs are the arguments of a builtin function.
+type scriptArgs []interface{}
+
+// scriptFunc is a builtin function.
+type scriptFunc func(a scriptArgs) (interface{}, error)
+
+// count checks the number of arguments.
+func (a scriptArgs) count(min, max int) error {
+	if len(a) < min || len(a) > max {
+		if min == max {
+			return fmt.Errorf("needs %d arguments", min)
+		}
+		return fmt.Errorf("needs %d to %d arguments", min, max)
+	}
+	return nil
+}
+
+// num returns a number argument (or a default for a missing optional argument).
+func (a scriptArgs) num(i int, def float64) (float64, error) {
+	if i >= len(a) {
+		return def, nil
+	}
+	x, ok := a[i].(float64)
+	if !ok {
+		return 0, fmt.Errorf("argument %d is a %s, not a number", i+1, scriptTypeName(a[i]))
+	}
+	return x, nil
+}
+
+// v3 returns a 3d vector argument.
+func (a scriptArgs) v3(i int) (V3, error) {
+	x, ok := scriptVector(a[i])
+	if !ok || len(x) != 3 {
+		return V3{}, fmt.Errorf("argument %d is not a 3d vector", i+1)
+	}
+	return V3{x[0], x[1], x[2]}, nil
+}
+
+// v2 returns a 2d vector argument.
+func (a scriptArgs) v2(i int) (V2, error) {
+	x, ok := scriptVector(a[i])
+	if !ok || len(x) != 2 {
+		return V2{}, fmt.Errorf("argument %d is not a 2d vector", i+1)
+	}
+	return V2{x[0], x[1]}, nil
+}
+
+// sdf2 returns a 2d shape argument.
+func (a scriptArgs) sdf2(i int) (SDF2, error) {
+	s, ok := a[i].(SDF2)
+	if !ok {
+		return nil, fmt.Errorf("argument %d is a %s, not a 2d shape", i+1, scriptTypeName(a[i]))
+	}
+	return s, nil
+}
+
+// shapes returns the shape arguments from i on, all 3d or all 2d.
+func (a scriptArgs) shapes(i int) ([]SDF3, []SDF2, error) {
+	var s3 []SDF3
+	var s2 []SDF2
+	for j := i; j < len(a); j++ {
+		switch s := a[j].(type) {
+		case SDF3:
+			s3 = append(s3, s)
+		case SDF2:
+			s2 = append(s2, s)
+		default:
+			return nil, nil, fmt.Errorf("argument %d is a %s, not a shape", j+1, scriptTypeName(a[j]))
+		}
+	}
+	if s3 != nil && s2 != nil {
+		return nil, nil, errors.New("can't mix 2d and 3d shapes")
+	}
+	return s3, s2, nil
+}
+
+// scriptTransform applies a 3d or 2d transform to the last (shape) argument.
+func scriptTransform(a scriptArgs, m3 func() (M44, error), m2 func() (M33, error)) (interface{}, error) {
+	s3, s2, err := a.shapes(len(a) - 1)
+	if err != nil {
+		return nil, err
+	}
+	if s3 != nil {
+		m, err := m3()
+		if err != nil {
+			return nil, err
+		}
+		return Transform3D(s3[0], m), nil
+	}
+	m, err := m2()
+	if err != nil {
+		return nil, err
+	}
+	return Transform2D(s2[0], m), nil
+}
+
+var scriptBuiltins map[string]scriptFunc
+
+func init() {
+	scriptBuiltins = map[string]scriptFunc{
+		// 3d shapes
+		"box": func(a scriptArgs) (interface{}, error) {
+			if err := a.count(1, 2); err != nil {
+				return nil, err
+			}
+			size, err := a.v3(0)
+			if err != nil {
+				return nil, err
+			}
+			round, err := a.num(1, 0)
+			if err != nil {
+				return nil, err
+			}
+			return Box3D(size, round), nil
+		},
+		"sphere": func(a scriptArgs) (interface{}, error) {
+			if err := a.count(1, 1); err != nil {
+				return nil, err
+			}
+			r, err := a.num(0, 0)
+			if err != nil {
+				return nil, err
+			}
+			return Sphere3D(r), nil
+		},
+		"cylinder": func(a scriptArgs) (interface{}, error) {
+			if err := a.count(2, 3); err != nil {
+				return nil, err
+			}
+			x, err := scriptNums(a, 3)
+			if err != nil {
+				return nil, err
+			}
+			return Cylinder3D(x[0], x[1], x[2]), nil
+		},
+		"cone": func(a scriptArgs) (interface{}, error) {
+			if err := a.count(3, 4); err != nil {
+				return nil, err
+			}
+			x, err := scriptNums(a, 4)
+			if err != nil {
+				return nil, err
+			}
+			return Cone3D(x[0], x[1], x[2], x[3]), nil
+		},
+		"capsule": func(a scriptArgs) (interface{}, error) {
+			if err := a.count(2, 2); err != nil {
+				return nil, err
+			}
+			x, err := scriptNums(a, 2)
+			if err != nil {
+				return nil, err
+			}
+			return Pill3D(x[0], x[1]), nil
+		},
+		"torus": func(a scriptArgs) (interface{}, error) {
+			if err := a.count(2, 2); err != nil {
+				return nil, err
+			}
+			x, err := scriptNums(a, 2)
+			if err != nil {
+				return nil, err
+			}
+			return Torus3D(x[0], x[1]), nil
+		},
+		// 2d shapes
+		"rect": func(a scriptArgs) (interface{}, error) {
+			if err := a.count(1, 2); err != nil {
+				return nil, err
+			}
+			size, err := a.v2(0)
+			if err != nil {
+				return nil, err
+			}
+			round, err := a.num(1, 0)
+			if err != nil {
+				return nil, err
+			}
+			return Box2D(size, round), nil
+		},
+		"circle": func(a scriptArgs) (interface{}, error) {
+			if err := a.count(1, 1); err != nil {
+				return nil, err
+			}
+			r, err := a.num(0, 0)
+			if err != nil {
+				return nil, err
+			}
+			return Circle2D(r), nil
+		},
+		"polygon": func(a scriptArgs) (interface{}, error) {
+			if err := a.count(1, 1); err != nil {
+				return nil, err
+			}
+			l, ok := a[0].(scriptList)
+			if !ok {
+				return nil, errors.New("argument 1 is not a list of points")
+			}
+			v := make([]V2, len(l))
+			for i := range l {
+				x, ok := scriptVector(l[i])
+				if !ok || len(x) != 2 {
+					return nil, fmt.Errorf("point %d is not a 2d vector", i+1)
+				}
+				v[i] = V2{x[0], x[1]}
+			}
+			return Polygon2D(v), nil
+		},
+		// transforms
+		"translate": func(a scriptArgs) (interface{}, error) {
+			if err := a.count(2, 2); err != nil {
+				return nil, err
+			}
+			return scriptTransform(a,
+				func() (M44, error) { v, err := a.v3(0); return Translate3d(v), err },
+				func() (M33, error) { v, err := a.v2(0); return Translate2d(v), err })
+		},
+		"rotate": func(a scriptArgs) (interface{}, error) {
+			if err := a.count(2, 2); err != nil {
+				return nil, err
+			}
+			return scriptTransform(a,
+				func() (M44, error) {
+					v, err := a.v3(0)
+					return RotateZ(DtoR(v.Z)).Mul(RotateY(DtoR(v.Y))).Mul(RotateX(DtoR(v.X))), err
+				},
+				func() (M33, error) { x, err := a.num(0, 0); return Rotate2d(DtoR(x)), err })
+		},
+		"scale": func(a scriptArgs) (interface{}, error) {
+			if err := a.count(2, 2); err != nil {
+				return nil, err
+			}
+			k, err := a.num(0, 0)
+			if err != nil {
+				return nil, err
+			}
+			if k <= 0 {
+				return nil, errors.New("scale <= 0")
+			}
+			return scriptTransform(a,
+				func() (M44, error) { return Scale3d(V3{k, k, k}), nil },
+				func() (M33, error) { return Scale2d(V2{k, k}), nil })
+		},
+		// operations
+		"offset": func(a scriptArgs) (interface{}, error) {
+			if err := a.count(2, 2); err != nil {
+				return nil, err
+			}
+			d, err := a.num(0, 0)
+			if err != nil {
+				return nil, err
+			}
+			s3, s2, err := a.shapes(1)
+			if err != nil {
+				return nil, err
+			}
+			if s3 != nil {
+				return Offset3D(s3[0], d), nil
+			}
+			return Offset2D(s2[0], d), nil
+		},
+		"union": func(a scriptArgs) (interface{}, error) {
+			if len(a) == 0 {
+				return nil, errors.New("needs 1 or more shapes")
+			}
+			s3, s2, err := a.shapes(0)
+			if err != nil {
+				return nil, err
+			}
+			if s3 != nil {
+				return Union3D(s3...), nil
+			}
+			return Union2D(s2...), nil
+		},
+		"difference": func(a scriptArgs) (interface{}, error) {
+			if len(a) < 2 {
+				return nil, errors.New("needs 2 or more shapes")
+			}
+			s3, s2, err := a.shapes(0)
+			if err != nil {
+				return nil, err
+			}
+			if s3 != nil {
+				return Difference3D(s3[0], Union3D(s3[1:]...)), nil
+			}
+			return Difference2D(s2[0], Union2D(s2[1:]...)), nil
+		},
+		"intersection": func(a scriptArgs) (interface{}, error) {
+			if err := a.count(2, 2); err != nil {
+				return nil, err
+			}
+			s3, _, err := a.shapes(0)
+			if err != nil {
+				return nil, err
+			}
+			if s3 == nil {
+				return nil, errors.New("needs 3d shapes")
+			}
+			return Intersect3D(s3[0], s3[1]), nil
+		},
+		"extrude": func(a scriptArgs) (interface{}, error) {
+			if err := a.count(2, 2); err != nil {
+				return nil, err
+			}
+			h, err := a.num(0, 0)
+			if err != nil {
+				return nil, err
+			}
+			s, err := a.sdf2(1)
+			if err != nil {
+				return nil, err
+			}
+			return Extrude3D(s, h), nil
+		},
+		"revolve": func(a scriptArgs) (interface{}, error) {
+			if err := a.count(1, 1); err != nil {
+				return nil, err
+			}
+			s, err := a.sdf2(0)
+			if err != nil {
+				return nil, err
+			}
+			return Revolve3D(s), nil
+		},
+		// math
+		"sqrt": scriptMath(math.Sqrt),
+		"sin":  scriptMath(func(x float64) float64 { return math.Sin(DtoR(x)) }),
+		"cos":  scriptMath(func(x float64) float64 { return math.Cos(DtoR(x)) }),
+	}
+}
+
+// scriptNums returns n number arguments (missing optional arguments are 0).
+func scriptNums(a scriptArgs, n int) ([]float64, error) {
+	x := make([]float64, n)
+	for i := range x {
+		var err error
+		if x[i], err = a.num(i, 0); err != nil {
+			return nil, err
+		}
+	}
+	return x, nil
+}
+
+// scriptMath returns a builtin for a math function of a number.
+func scriptMath(fn func(float64) float64) scriptFunc {
+	return func(a scriptArgs) (interface{}, error) {
+		if err := a.count(1, 1); err != nil {
+			return nil, err
+		}
+		x, err := a.num(0, 0)
+		if err != nil {
+			return nil, err
+		}
+		return fn(x), nil
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// EvalScript evaluates a model script. It returns the model, either an SDF3
+// or an SDF2 (the other is nil).
+func EvalScript(src string) (SDF3, SDF2, error) {
+	tokens, err := scriptLex(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	p := scriptParser{tokens: tokens, vars: make(map[string]interface{})}
+	v, err := p.program()
+	if err != nil {
+		return nil, nil, err
+	}
+	switch s := v.(type) {
+	case SDF3:
+		return s, nil, nil
+	case SDF2:
+		return nil, s, nil
+	case nil:
+		return nil, nil, errors.New("the script has no model")
+	}
+	return nil, nil, fmt.Errorf("the script result is a %s, not a shape", scriptTypeName(v))
+}
+
+// LoadScript loads and evaluates a model script file.
+func LoadScript(path string) (SDF3, SDF2, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	s3, s2, err := EvalScript(string(src))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return s3, s2, nil
+}
+
+//-----------------------------------------------------------------------------
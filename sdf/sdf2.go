@@ -9,44 +9,18 @@
 package sdf
 
 import (
-	"errors"
 	"math"
 )
 
 //-----------------------------------------------------------------------------
 
 // SDF2 is the interface to a 2d signed distance function object.
+// Evaluate may be called concurrently from multiple goroutines.
 type SDF2 interface {
 	Evaluate(p V2) float64
 	BoundingBox() Box2
 }
 
-//-----------------------------------------------------------------------------
-// SDF2 Evaluation Caching (experimental)
-
-type sdf2Cache struct {
-	cache map[V2]float64
-	hits  uint
-}
-
-func (c *sdf2Cache) lookup(p V2) (float64, error) {
-	if d, ok := c.cache[p]; ok {
-		c.hits++
-		return d, nil
-	}
-	return 0, errors.New("not found")
-}
-
-func (c *sdf2Cache) store(p V2, d float64) {
-	c.cache[p] = d
-}
-
-func newSdf2Cache() *sdf2Cache {
-	c := sdf2Cache{}
-	c.cache = make(map[V2]float64)
-	return &c
-}
-
 //-----------------------------------------------------------------------------
 // Basic SDF Functions
 
@@ -63,6 +37,18 @@ func sdfBox2d(p, s V2) float64 {
 	return d.X
 }
 
+// sdfSegment2d returns the (unsigned) distance to a line segment from a to b.
+func sdfSegment2d(p, a, b V2) float64 {
+	ab := b.Sub(a)
+	ap := p.Sub(a)
+	l2 := ab.Dot(ab)
+	if l2 == 0 {
+		return ap.Length()
+	}
+	t := Clamp(ap.Dot(ab)/l2, 0, 1)
+	return ap.Sub(ab.MulScalar(t)).Length()
+}
+
 //-----------------------------------------------------------------------------
 // 2D Circle
 
@@ -189,6 +175,153 @@ func (s *LineSDF2) BoundingBox() Box2 {
 	return s.bb
 }
 
+//-----------------------------------------------------------------------------
+// 2D Chamfered Box (exact distance field)
+
+// ChamferBoxSDF2 is the 2d signed distance object for a box with chamfered corners.
+type ChamferBoxSDF2 struct {
+	size    V2      // half size
+	chamfer float64 // chamfer length (along x and y)
+	bb      Box2
+}
+
+// ChamferBox2D returns a 2d box with 45 degree chamfers on the corners.
+func ChamferBox2D(size V2, chamfer float64) SDF2 {
+	size = size.MulScalar(0.5)
+	if chamfer < 0 || chamfer > Min(size.X, size.Y) {
+		panic("bad chamfer")
+	}
+	s := ChamferBoxSDF2{}
+	s.size = size
+	s.chamfer = chamfer
+	s.bb = Box2{size.Neg(), size}
+	return &s
+}
+
+// Evaluate returns the minimum distance to a 2d chamfered box.
+func (s *ChamferBoxSDF2) Evaluate(p V2) float64 {
+	p = p.Abs()
+	// the box is symmetric, so the closest edges are in the first quadrant
+	a := V2{s.size.X, 0}
+	b := V2{s.size.X, s.size.Y - s.chamfer}
+	c := V2{s.size.X - s.chamfer, s.size.Y}
+	e := V2{0, s.size.Y}
+	d := Min(sdfSegment2d(p, a, b), sdfSegment2d(p, b, c))
+	d = Min(d, sdfSegment2d(p, c, e))
+	if p.X <= s.size.X && p.Y <= s.size.Y && p.X+p.Y <= s.size.X+s.size.Y-s.chamfer {
+		return -d
+	}
+	return d
+}
+
+// BoundingBox returns the bounding box for a 2d chamfered box.
+func (s *ChamferBoxSDF2) BoundingBox() Box2 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+// 2D Annulus (exact distance field)
+
+// AnnulusSDF2 is the 2d signed distance object for an annulus (ring).
+type AnnulusSDF2 struct {
+	radius float64 // mid radius
+	width  float64 // half width
+	bb     Box2
+}
+
+// Annulus2D returns the SDF2 for an annulus with inner and outer radii.
+func Annulus2D(innerR, outerR float64) SDF2 {
+	if innerR < 0 || outerR <= innerR {
+		panic("bad radius")
+	}
+	s := AnnulusSDF2{}
+	s.radius = 0.5 * (innerR + outerR)
+	s.width = 0.5 * (outerR - innerR)
+	d := V2{outerR, outerR}
+	s.bb = Box2{d.Neg(), d}
+	return &s
+}
+
+// Evaluate returns the minimum distance to an annulus.
+func (s *AnnulusSDF2) Evaluate(p V2) float64 {
+	return Abs(p.Length()-s.radius) - s.width
+}
+
+// BoundingBox returns the bounding box of an annulus.
+func (s *AnnulusSDF2) BoundingBox() Box2 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+// 2D Star and Regular Polygon (exact distance field)
+// The plane is folded into a half sector between a vertex and the next
+// inner vertex. The boundary within the half sector is a single edge.
+
+// StarSDF2 is the 2d signed distance object for a star or regular polygon.
+type StarSDF2 struct {
+	n      int     // number of points
+	sector float64 // angle of a sector
+	a      V2      // outer vertex
+	b      V2      // inner vertex
+	bb     Box2
+}
+
+// Star2D returns an SDF2 for an n pointed star.
+// The outer vertices are at radius r0 (the first on the x-axis) and
+// the inner vertices are at radius r1.
+func Star2D(n int, r0, r1 float64) SDF2 {
+	if n < 2 {
+		panic("n < 2")
+	}
+	if r1 <= 0 || r1 > r0 {
+		panic("bad radius")
+	}
+	s := StarSDF2{}
+	s.n = n
+	s.sector = Tau / float64(n)
+	s.a = V2{r0, 0}
+	s.b = V2{math.Cos(0.5 * s.sector), math.Sin(0.5 * s.sector)}.MulScalar(r1)
+	// the inner vertices can be outside of the outer vertex polygon
+	v := Nagon(n, r0)
+	m := Rotate(s.sector)
+	for i, b := 0, s.b; i < n; i++ {
+		v = append(v, b)
+		b = m.MulPosition(b)
+	}
+	s.bb = Box2{v.Min(), v.Max()}
+	return &s
+}
+
+// Nagon2D returns an SDF2 for an n sided regular polygon.
+// The vertices are at radius r (the first on the x-axis).
+func Nagon2D(n int, r float64) SDF2 {
+	if n < 3 {
+		panic("n < 3")
+	}
+	return Star2D(n, r, r*math.Cos(Pi/float64(n)))
+}
+
+// Evaluate returns the minimum distance to a star.
+func (s *StarSDF2) Evaluate(p V2) float64 {
+	// fold into the half sector
+	theta := math.Mod(math.Atan2(p.Y, p.X)+Tau, s.sector)
+	if theta > 0.5*s.sector {
+		theta = s.sector - theta
+	}
+	p = V2{math.Cos(theta), math.Sin(theta)}.MulScalar(p.Length())
+	d := sdfSegment2d(p, s.a, s.b)
+	// inside if p is on the origin side of the edge
+	if s.b.Sub(s.a).Cross(p.Sub(s.a)) > 0 {
+		return -d
+	}
+	return d
+}
+
+// BoundingBox returns the bounding box for a star.
+func (s *StarSDF2) BoundingBox() Box2 {
+	return s.bb
+}
+
 //-----------------------------------------------------------------------------
 
 // OffsetSDF2 offsets the distance function of an existing SDF2.
@@ -199,6 +332,7 @@ type OffsetSDF2 struct {
 }
 
 // Offset2D returns an SDF2 that offsets the distance function of another SDF2.
+// A positive offset grows the SDF2, a negative offset shrinks it.
 func Offset2D(sdf SDF2, offset float64) SDF2 {
 	s := OffsetSDF2{}
 	s.sdf = sdf
@@ -219,6 +353,40 @@ func (s *OffsetSDF2) BoundingBox() Box2 {
 	return s.bb
 }
 
+//-----------------------------------------------------------------------------
+
+// WallSDF2 is a wall of constant thickness centered on the boundary of an SDF2.
+type WallSDF2 struct {
+	sdf       SDF2
+	thickness float64 // half thickness
+	bb        Box2
+}
+
+// Wall2D returns an SDF2 for a wall of the given thickness centered on the
+// boundary of another SDF2 (e.g. the walls of an enclosure).
+func Wall2D(sdf SDF2, thickness float64) SDF2 {
+	if thickness <= 0 {
+		panic("thickness <= 0")
+	}
+	s := WallSDF2{}
+	s.sdf = sdf
+	s.thickness = 0.5 * thickness
+	// work out the bounding box
+	bb := sdf.BoundingBox()
+	s.bb = NewBox2(bb.Center(), bb.Size().AddScalar(thickness))
+	return &s
+}
+
+// Evaluate returns the minimum distance to a wall.
+func (s *WallSDF2) Evaluate(p V2) float64 {
+	return Abs(s.sdf.Evaluate(p)) - s.thickness
+}
+
+// BoundingBox returns the bounding box for a wall.
+func (s *WallSDF2) BoundingBox() Box2 {
+	return s.bb
+}
+
 //-----------------------------------------------------------------------------
 // Cut an SDF2 along a line
 
@@ -457,6 +625,7 @@ type ArraySDF2 struct {
 }
 
 // Array2D returns an XY grid array of an existing SDF2.
+// See Repeat2D() for large arrays.
 func Array2D(sdf SDF2, num V2i, step V2) SDF2 {
 	// check the number of steps
 	if num[0] <= 0 || num[1] <= 0 {
@@ -498,6 +667,55 @@ func (s *ArraySDF2) BoundingBox() Box2 {
 
 //-----------------------------------------------------------------------------
 
+// RepeatSDF2 defines an XY grid of an SDF2 using domain repetition.
+type RepeatSDF2 struct {
+	sdf  SDF2
+	num  V2i // grid size
+	step V2  // grid step size
+	bb   Box2
+}
+
+// Repeat2D returns an XY grid of an SDF2 using domain repetition.
+// This has the same result as Array2D but only the cells nearest to the
+// evaluation point are evaluated, so the cost does not depend on the grid size.
+// The SDF2 should fit within a single grid cell.
+func Repeat2D(sdf SDF2, num V2i, step V2) SDF2 {
+	// check the number of steps
+	if num[0] <= 0 || num[1] <= 0 {
+		return nil
+	}
+	s := RepeatSDF2{}
+	s.sdf = sdf
+	s.num = num
+	s.step = step
+	// work out the bounding box
+	bb0 := sdf.BoundingBox()
+	bb1 := bb0.Translate(step.Mul(num.SubScalar(1).ToV2()))
+	s.bb = bb0.Extend(bb1)
+	return &s
+}
+
+// Evaluate returns the minimum distance to a repeated SDF2.
+func (s *RepeatSDF2) Evaluate(p V2) float64 {
+	x0, x1 := repeatCells(p.X, s.step.X, s.num[0])
+	y0, y1 := repeatCells(p.Y, s.step.Y, s.num[1])
+	d := math.MaxFloat64
+	for _, j := range [2]int{x0, x1} {
+		for _, k := range [2]int{y0, y1} {
+			x := p.Sub(V2{float64(j) * s.step.X, float64(k) * s.step.Y})
+			d = Min(d, s.sdf.Evaluate(x))
+		}
+	}
+	return d
+}
+
+// BoundingBox returns the bounding box of a repeated SDF2.
+func (s *RepeatSDF2) BoundingBox() Box2 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+
 // RotateUnionSDF2 defines a union of rotated SDF2s.
 type RotateUnionSDF2 struct {
 	sdf  SDF2
@@ -563,6 +781,8 @@ type RotateCopySDF2 struct {
 }
 
 // RotateCopy2D rotates and copies an SDF2 n times in a full circle.
+// The plane is folded into a single sector, so evaluation cost does not depend on n.
+// The SDF2 should lie within the sector centered on the +x axis.
 func RotateCopy2D(sdf SDF2, n int) SDF2 {
 	// check the number of steps
 	if n <= 0 {
@@ -617,37 +837,93 @@ func Slice2D(
 	s := SliceSDF2{}
 	s.sdf = sdf
 	s.a = a
-	// work out the x/y vectors on the plane.
+	s.u, s.v = planeAxes(n)
+	s.bb = s.sliceBox()
+	return &s
+}
+
+// planeAxes returns the x/y unit vectors on a plane with normal n.
+func planeAxes(n V3) (V3, V3) {
+	var u V3
 	if n.X == 0 {
-		s.u = V3{1, 0, 0}
+		u = V3{1, 0, 0}
 	} else if n.Y == 0 {
-		s.u = V3{0, 1, 0}
+		u = V3{0, 1, 0}
 	} else if n.Z == 0 {
-		s.u = V3{0, 0, 1}
+		u = V3{0, 0, 1}
 	} else {
-		s.u = V3{n.Y, -n.X, 0}
+		u = V3{n.Y, -n.X, 0}
 	}
-	s.v = n.Cross(s.u)
-	s.u = s.u.Normalize()
-	s.v = s.v.Normalize()
-	// work out the bounding box
-	// TODO: This is bigger than it needs to be. We could consider intersection
-	// between the plane and the edges of the 3d bounding box for a smaller 2d
-	// bounding box in some circumstances.
-	v3 := sdf.BoundingBox().Vertices()
-	v2 := make(V2Set, len(v3))
-	n = n.Normalize()
-	for i, v := range v3 {
-		// project the 3d bounding box vertex onto the plane
-		va := v.Sub(s.a)
-		pa := va.Sub(n.MulScalar(n.Dot(va)))
-		// work out the 3d point in terms of the 2d unit vectors
-		v2[i] = V2{pa.Dot(s.u), pa.Dot(s.v)}
+	v := n.Cross(u)
+	return u.Normalize(), v.Normalize()
+}
+
+// SliceZ2D returns an SDF2 created from a slice through an SDF3 at height z.
+// The 2d x/y axes are the 3d x/y axes.
+func SliceZ2D(sdf SDF3, z float64) SDF2 {
+	return Slice2D(sdf, V3{0, 0, z}, V3{0, 0, 1})
+}
+
+// SlicePlane2D returns an SDF2 created from a planar slice through an SDF3.
+// The slicing plane is the z = 0 plane transformed by m (a rotation and
+// translation), so the 2d x/y axes are the x/y axes of the transformed plane.
+func SlicePlane2D(sdf SDF3, m M44) SDF2 {
+	s := SliceSDF2{}
+	s.sdf = sdf
+	s.a = m.MulPosition(V3{0, 0, 0})
+	u := m.MulPosition(V3{1, 0, 0}).Sub(s.a)
+	v := m.MulPosition(V3{0, 1, 0}).Sub(s.a)
+	n := u.Cross(v)
+	if n.Length() == 0 {
+		panic("degenerate slicing plane")
 	}
-	s.bb = Box2{v2.Min(), v2.Max()}
+	// orthonormal axes on the plane
+	s.u = u.Normalize()
+	s.v = n.Cross(u).Normalize()
+	s.bb = s.sliceBox()
 	return &s
 }
 
+// sliceBox returns the 2d bounding box of the intersection of the slicing
+// plane with the bounding box of the SDF3. If the plane doesn't intersect
+// the bounding box, the bounding box is projected onto the plane.
+func (s *SliceSDF2) sliceBox() Box2 {
+	n := s.u.Cross(s.v)
+	v3 := s.sdf.BoundingBox().Vertices()
+	// distance from the plane
+	d := make([]float64, len(v3))
+	for i, v := range v3 {
+		d[i] = v.Sub(s.a).Dot(n)
+	}
+	var v2 V2Set
+	add := func(p V3) {
+		pa := p.Sub(s.a)
+		v2 = append(v2, V2{pa.Dot(s.u), pa.Dot(s.v)})
+	}
+	for i := range v3 {
+		if d[i] == 0 {
+			add(v3[i])
+		}
+		for j := i + 1; j < len(v3); j++ {
+			// box edges differ in one component
+			e := v3[j].Sub(v3[i])
+			if (e.X != 0 && e.Y != 0) || (e.X != 0 && e.Z != 0) || (e.Y != 0 && e.Z != 0) {
+				continue
+			}
+			if (d[i] < 0 && d[j] > 0) || (d[i] > 0 && d[j] < 0) {
+				add(v3[i].Add(e.MulScalar(d[i] / (d[i] - d[j]))))
+			}
+		}
+	}
+	if len(v2) == 0 {
+		// project the 3d bounding box vertices onto the plane
+		for _, v := range v3 {
+			add(v)
+		}
+	}
+	return Box2{v2.Min(), v2.Max()}
+}
+
 // Evaluate returns the minimum distance to the sliced SDF2.
 func (s *SliceSDF2) Evaluate(p V2) float64 {
 	pnew := s.a.Add(s.u.MulScalar(p.X)).Add(s.v.MulScalar(p.Y))
@@ -661,6 +937,67 @@ func (s *SliceSDF2) BoundingBox() Box2 {
 
 //-----------------------------------------------------------------------------
 
+// projectSamples is the number of samples along the projection axis (inside an SDF3).
+const projectSamples = 1000
+
+// ProjectSDF2 is the projection (silhouette) of an SDF3 onto a plane.
+type ProjectSDF2 struct {
+	sdf        SDF3    // the sdf3 being projected
+	u, v, n    V3      // 2d x/y axes, projection axis
+	tMin, tMax float64 // range along the projection axis
+	step       float64 // minimum step along the projection axis
+	bb         Box2    // bounding box
+}
+
+// Project2D returns an SDF2 for the silhouette of an SDF3 projected along an
+// axis onto a plane through the origin (e.g. a baseplate outline or a drill
+// template). The 2d x/y axes on the plane are the same as for Slice2D.
+// The distance is the minimum distance to the SDF3 along the projection
+// line, found by stepping along the line. It is an upper bound of the 2d
+// distance, and converges to the distance near the silhouette boundary.
+func Project2D(sdf SDF3, axis V3) SDF2 {
+	if axis.Length() == 0 {
+		panic("axis has zero length")
+	}
+	s := ProjectSDF2{}
+	s.sdf = sdf
+	s.n = axis.Normalize()
+	s.u, s.v = planeAxes(s.n)
+	v3 := sdf.BoundingBox().Vertices()
+	v2 := make(V2Set, len(v3))
+	s.tMin, s.tMax = math.Inf(1), math.Inf(-1)
+	for i, v := range v3 {
+		v2[i] = V2{v.Dot(s.u), v.Dot(s.v)}
+		t := v.Dot(s.n)
+		s.tMin = Min(s.tMin, t)
+		s.tMax = Max(s.tMax, t)
+	}
+	s.bb = Box2{v2.Min(), v2.Max()}
+	s.step = Max(s.tMax-s.tMin, s.bb.Size().MaxComponent()) / projectSamples
+	return &s
+}
+
+// Evaluate returns the minimum distance to the projected SDF2.
+func (s *ProjectSDF2) Evaluate(p V2) float64 {
+	p0 := s.u.MulScalar(p.X).Add(s.v.MulScalar(p.Y))
+	d := math.Inf(1)
+	// step by half the distance, so the samples are closer together near
+	// the minimum
+	for t := s.tMin; t <= s.tMax; {
+		dt := s.sdf.Evaluate(p0.Add(s.n.MulScalar(t)))
+		d = Min(d, dt)
+		t += Max(0.5*Abs(dt), s.step)
+	}
+	return d
+}
+
+// BoundingBox returns the bounding box of the projected SDF2.
+func (s *ProjectSDF2) BoundingBox() Box2 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+
 // UnionSDF2 is a union of multiple SDF2 objects.
 type UnionSDF2 struct {
 	sdf []SDF2
@@ -807,6 +1144,9 @@ type ElongateSDF2 struct {
 }
 
 // Elongate2D returns the elongation of an SDF2.
+// The SDF2 is split at the origin and the halves are moved apart by h,
+// the gap is filled with the cross section at the origin.
+// E.g. elongating a circle gives a stadium.
 func Elongate2D(sdf SDF2, h V2) SDF2 {
 	h = h.Abs()
 	s := ElongateSDF2{
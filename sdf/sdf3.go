@@ -10,11 +10,13 @@ package sdf
 
 import (
 	"math"
+	"math/rand"
 )
 
 //-----------------------------------------------------------------------------
 
 // SDF3 is the interface to a 3d signed distance function object.
+// Evaluate may be called concurrently from multiple goroutines.
 type SDF3 interface {
 	Evaluate(p V3) float64
 	BoundingBox() Box3
@@ -135,6 +137,7 @@ type ExtrudeSDF3 struct {
 	sdf     SDF2
 	height  float64
 	extrude ExtrudeFunc
+	k       float64 // Lipschitz bound of the extrude function (0 == unknown)
 	bb      Box3
 }
 
@@ -144,6 +147,7 @@ func Extrude3D(sdf SDF2, height float64) SDF3 {
 	s.sdf = sdf
 	s.height = height / 2
 	s.extrude = NormalExtrude
+	s.k = 1
 	// work out the bounding box
 	bb := sdf.BoundingBox()
 	s.bb = Box3{V3{bb.Min.X, bb.Min.Y, -s.height}, V3{bb.Max.X, bb.Max.Y, s.height}}
@@ -160,6 +164,7 @@ func TwistExtrude3D(sdf SDF2, height, twist float64) SDF3 {
 	bb := sdf.BoundingBox()
 	l := bb.Max.Length()
 	s.bb = Box3{V3{-l, -l, -s.height}, V3{l, l, s.height}}
+	s.k = twistExtrudeK(twist/height, s.bb)
 	return &s
 }
 
@@ -173,6 +178,7 @@ func ScaleExtrude3D(sdf SDF2, height float64, scale V2) SDF3 {
 	bb := sdf.BoundingBox()
 	bb = bb.Extend(Box2{bb.Min.Mul(scale), bb.Max.Mul(scale)})
 	s.bb = Box3{V3{bb.Min.X, bb.Min.Y, -s.height}, V3{bb.Max.X, bb.Max.Y, s.height}}
+	s.k, _ = scaleExtrudeK(height, scale, s.bb)
 	return &s
 }
 
@@ -187,9 +193,38 @@ func ScaleTwistExtrude3D(sdf SDF2, height, twist float64, scale V2) SDF3 {
 	bb = bb.Extend(Box2{bb.Min.Mul(scale), bb.Max.Mul(scale)})
 	l := bb.Max.Length()
 	s.bb = Box3{V3{-l, -l, -s.height}, V3{l, l, s.height}}
+	// the twist is applied to the scaled point
+	k, sMax := scaleExtrudeK(height, scale, s.bb)
+	s.k = k + Abs(twist/height)*sMax*xyRadius(s.bb)
 	return &s
 }
 
+// xyRadius returns the maximum distance from the z-axis within a box.
+func xyRadius(bb Box3) float64 {
+	return V2{Max(Abs(bb.Min.X), Abs(bb.Max.X)), Max(Abs(bb.Min.Y), Abs(bb.Max.Y))}.Length()
+}
+
+// twistExtrudeK returns the Lipschitz bound of a twist extrude function
+// (k radians per unit of z) within a box. A rotation by k*z stretches space by
+// sqrt(1 + (k*r)^2) at radius r.
+func twistExtrudeK(k float64, bb Box3) float64 {
+	r := xyRadius(bb)
+	return math.Sqrt(1 + k*k*r*r)
+}
+
+// scaleExtrudeK returns the Lipschitz bound of a scale extrude function
+// within a box, and the maximum scale factor of the xy coordinates.
+// The function is (x*sx(z), y*sy(z)), so the bound is max(sx, sy) plus the
+// length of (x*sx'(z), y*sy'(z)).
+func scaleExtrudeK(height float64, scale V2, bb Box3) (float64, float64) {
+	inv := V2{1 / scale.X, 1 / scale.Y}
+	m := inv.Sub(V2{1, 1}).DivScalar(height).Abs()
+	sMax := Max(1, Max(Abs(inv.X), Abs(inv.Y)))
+	x := Max(Abs(bb.Min.X), Abs(bb.Max.X))
+	y := Max(Abs(bb.Min.Y), Abs(bb.Max.Y))
+	return sMax + V2{x * m.X, y * m.Y}.Length(), sMax
+}
+
 // Evaluate returns the minimum distance to an extrusion.
 func (s *ExtrudeSDF3) Evaluate(p V3) float64 {
 	// sdf for the projected 2d surface
@@ -201,8 +236,10 @@ func (s *ExtrudeSDF3) Evaluate(p V3) float64 {
 }
 
 // SetExtrude sets the extrusion control function.
+// The Lipschitz bound of the extrusion is no longer known (see lipschitz.go).
 func (s *ExtrudeSDF3) SetExtrude(extrude ExtrudeFunc) {
 	s.extrude = extrude
+	s.k = 0
 }
 
 // BoundingBox returns the bounding box for an extrusion.
@@ -275,6 +312,60 @@ func (s *ExtrudeRoundedSDF3) BoundingBox() Box3 {
 	return s.bb
 }
 
+//-----------------------------------------------------------------------------
+// Linear extrude an SDF2 with filleted top and bottom edges.
+// The edges are rounded inside the extrusion, so the 2d profile and the
+// height of the extrusion are not changed.
+
+// FilletExtrudeSDF3 extrudes an SDF2 to an SDF3 with filleted top and bottom edges.
+type FilletExtrudeSDF3 struct {
+	sdf    SDF2
+	height float64
+	top    float64
+	bottom float64
+	bb     Box3
+}
+
+// FilletExtrude3D does a linear extrude of an SDF2 with rounded top and bottom edges.
+func FilletExtrude3D(sdf SDF2, height, top, bottom float64) SDF3 {
+	if top < 0 || bottom < 0 {
+		panic("fillet radius < 0")
+	}
+	if top+bottom > height {
+		panic("height < top + bottom fillet radius")
+	}
+	s := FilletExtrudeSDF3{}
+	s.sdf = sdf
+	s.height = height / 2
+	s.top = top
+	s.bottom = bottom
+	// work out the bounding box
+	bb := sdf.BoundingBox()
+	s.bb = Box3{V3{bb.Min.X, bb.Min.Y, -s.height}, V3{bb.Max.X, bb.Max.Y, s.height}}
+	return &s
+}
+
+// Evaluate returns the minimum distance to a filleted extrusion.
+func (s *FilletExtrudeSDF3) Evaluate(p V3) float64 {
+	// sdf for the projected 2d surface
+	a := s.sdf.Evaluate(V2{p.X, p.Y})
+	// distance to the nearest face and its fillet radius
+	b := p.Z - s.height
+	r := s.top
+	if p.Z < 0 {
+		b = -p.Z - s.height
+		r = s.bottom
+	}
+	// rounded intersection of the side and the face
+	q := V2{a + r, b + r}
+	return Min(q.MaxComponent(), 0) + q.Max(V2{0, 0}).Length() - r
+}
+
+// BoundingBox returns the bounding box for a filleted extrusion.
+func (s *FilletExtrudeSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
 //-----------------------------------------------------------------------------
 // Extrude/Loft (with rounded edges)
 // Blend between sdf0 and sdf1 as we move from bottom to top.
@@ -425,10 +516,19 @@ func Cylinder3D(height, radius, round float64) SDF3 {
 }
 
 // Capsule3D return an SDF3 for a capsule.
+//
+// Deprecated: The arguments are passed to Cylinder3D as (height, radius,
+// round) = (radius, height, radius). Use Pill3D.
 func Capsule3D(radius, height float64) SDF3 {
 	return Cylinder3D(radius, height, radius)
 }
 
+// Pill3D returns an SDF3 for a capsule along the z-axis.
+// The height is the overall height including the hemispherical ends.
+func Pill3D(height, radius float64) SDF3 {
+	return Cylinder3D(height, radius, radius)
+}
+
 // Evaluate returns the minimum distance to a cylinder.
 func (s *CylinderSDF3) Evaluate(p V3) float64 {
 	d := sdfBox2d(V2{V2{p.X, p.Y}.Length(), p.Z}, V2{s.radius, s.height})
@@ -440,6 +540,108 @@ func (s *CylinderSDF3) BoundingBox() Box3 {
 	return s.bb
 }
 
+//-----------------------------------------------------------------------------
+// Cylinder with different edges at each end (exact distance field)
+
+// CylinderEdgeStyle is the style of the edge at an end of a cylinder.
+type CylinderEdgeStyle int
+
+// Cylinder edge styles.
+const (
+	EdgeSquare  CylinderEdgeStyle = iota // square edge
+	EdgeRound                            // rounded edge (size is the radius)
+	EdgeChamfer                          // 45 degree chamfer (size is the length along each face)
+)
+
+// CylinderEdge is the edge at an end of a cylinder.
+type CylinderEdge struct {
+	Style CylinderEdgeStyle
+	Size  float64
+}
+
+// EdgedCylinderSDF3 is a cylinder with different edges at each end.
+type EdgedCylinderSDF3 struct {
+	height float64         // half height
+	radius float64         // radius
+	edge   [2]CylinderEdge // bottom and top edges
+	mid    float64         // z where the side is split between the ends
+	bb     Box3
+}
+
+// EdgedCylinder3D returns an SDF3 for a cylinder with the bottom and top
+// edges independently rounded or chamfered (e.g. bosses and standoffs).
+func EdgedCylinder3D(height, radius float64, bottom, top CylinderEdge) SDF3 {
+	if height <= 0 {
+		panic("height <= 0")
+	}
+	if radius <= 0 {
+		panic("radius <= 0")
+	}
+	s := EdgedCylinderSDF3{}
+	s.height = height / 2
+	s.radius = radius
+	s.edge = [2]CylinderEdge{bottom, top}
+	for i := range s.edge {
+		if s.edge[i].Style == EdgeSquare {
+			s.edge[i].Size = 0
+		}
+		if s.edge[i].Size < 0 || s.edge[i].Size > radius {
+			panic("bad edge size")
+		}
+	}
+	if s.edge[0].Size+s.edge[1].Size > height {
+		panic("edge sizes > height")
+	}
+	s.mid = 0.5 * (s.edge[0].Size - s.edge[1].Size)
+	d := V3{radius, radius, s.height}
+	s.bb = Box3{d.Neg(), d}
+	return &s
+}
+
+// end returns the distance to the boundary of one end of the cylinder
+// profile (the face, the edge and the side up to mid), and whether the point
+// is inside the edge. z is positive towards the end.
+func (s *EdgedCylinderSDF3) end(p V2, e CylinderEdge, mid float64) (float64, bool) {
+	c := e.Size
+	a := V2{s.radius, mid}          // side, at the split
+	b := V2{s.radius, s.height - c} // side, at the edge
+	d := V2{s.radius - c, s.height} // face, at the edge
+	f := V2{0, s.height}            // face, on the axis
+	dist := Min(sdfSegment2d(p, a, b), sdfSegment2d(p, d, f))
+	inside := true
+	// position relative to the corner of the edge
+	x, y := p.X-d.X, p.Y-b.Y
+	switch e.Style {
+	case EdgeRound:
+		if x >= 0 && y >= 0 {
+			l := math.Sqrt(x*x + y*y)
+			dist = Min(dist, Abs(l-c))
+			inside = l <= c
+		}
+	case EdgeChamfer:
+		dist = Min(dist, sdfSegment2d(p, b, d))
+		inside = x+y <= c
+	}
+	return dist, inside
+}
+
+// Evaluate returns the minimum distance to a cylinder with edges.
+func (s *EdgedCylinderSDF3) Evaluate(p V3) float64 {
+	q := V2{V2{p.X, p.Y}.Length(), p.Z}
+	d0, in0 := s.end(V2{q.X, -q.Y}, s.edge[0], -s.mid)
+	d1, in1 := s.end(q, s.edge[1], s.mid)
+	d := Min(d0, d1)
+	if in0 && in1 && q.X <= s.radius && Abs(q.Y) <= s.height {
+		return -d
+	}
+	return d
+}
+
+// BoundingBox returns the bounding box for a cylinder with edges.
+func (s *EdgedCylinderSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
 //-----------------------------------------------------------------------------
 // Cylinders of the same radius and height at various x/y positions
 // (E.g. drilling patterns) are useful enough to warrant their own SDF3 function.
@@ -480,25 +682,67 @@ func (s *MultiCylinderSDF3) BoundingBox() Box3 {
 	return s.bb
 }
 
+//-----------------------------------------------------------------------------
+// Pipe (exact distance field)
+
+// PipeSDF3 is a pipe (a cylindrical tube).
+type PipeSDF3 struct {
+	radius float64 // mid wall radius
+	wall   float64 // half wall thickness
+	height float64 // half height
+	bb     Box3
+}
+
+// Pipe3D returns an SDF3 for a pipe with an outer radius and a wall thickness.
+func Pipe3D(outerR, wallThickness, height float64) SDF3 {
+	if wallThickness <= 0 || wallThickness > outerR {
+		panic("bad wall thickness")
+	}
+	if height <= 0 {
+		panic("height <= 0")
+	}
+	s := PipeSDF3{}
+	s.radius = outerR - 0.5*wallThickness
+	s.wall = 0.5 * wallThickness
+	s.height = 0.5 * height
+	d := V3{outerR, outerR, s.height}
+	s.bb = Box3{d.Neg(), d}
+	return &s
+}
+
+// Evaluate returns the minimum distance to a pipe.
+func (s *PipeSDF3) Evaluate(p V3) float64 {
+	r := Abs(V2{p.X, p.Y}.Length() - s.radius)
+	return sdfBox2d(V2{r, p.Z}, V2{s.wall, s.height})
+}
+
+// BoundingBox returns the bounding box for a pipe.
+func (s *PipeSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
 //-----------------------------------------------------------------------------
 // Truncated Cone (exact distance field)
 
 // ConeSDF3 is a truncated cone.
 type ConeSDF3 struct {
-	r0     float64 // base radius
-	r1     float64 // top radius
-	height float64 // half height
-	round  float64 // rounding offset
-	u      V2      // normalized cone slope vector
-	n      V2      // normal to cone slope (points outward)
-	l      float64 // length of cone slope
-	bb     Box3    // bounding box
+	r0    float64 // base radius
+	r1    float64 // top radius
+	z0    float64 // base z
+	z1    float64 // top z
+	round float64 // rounding offset
+	u     V2      // normalized cone slope vector
+	n     V2      // normal to cone slope (points outward)
+	l     float64 // length of cone slope
+	bb    Box3    // bounding box
 }
 
 // Cone3D returns the SDF3 for a trucated cone (round > 0 gives rounded edges).
+// A radius of 0 gives a pointed cone, round > 0 gives a rounded apex.
 func Cone3D(height, r0, r1, round float64) SDF3 {
 	s := ConeSDF3{}
-	s.height = (height / 2) - round
+	s.z0 = -(height / 2) + round
+	s.z1 = (height / 2) - round
 	s.round = round
 	// cone slope vector and normal
 	s.u = V2{r1, height / 2}.Sub(V2{r0, -height / 2}).Normalize()
@@ -507,8 +751,18 @@ func Cone3D(height, r0, r1, round float64) SDF3 {
 	ofs := round / s.n.X
 	s.r0 = r0 - (1+s.n.Y)*ofs
 	s.r1 = r1 - (1-s.n.Y)*ofs
+	// An inset radius < 0 means the inset slope meets the axis
+	// before the end of the cone, that's the inset apex.
+	if s.r1 < 0 {
+		s.z1 = s.z0 + s.u.Y*s.r0/-s.u.X
+		s.r1 = 0
+	}
+	if s.r0 < 0 {
+		s.z0 = s.z1 - s.u.Y*s.r1/s.u.X
+		s.r0 = 0
+	}
 	// cone slope length
-	s.l = V2{s.r1, s.height}.Sub(V2{s.r0, -s.height}).Length()
+	s.l = V2{s.r1, s.z1}.Sub(V2{s.r0, s.z0}).Length()
 	// work out the bounding box
 	r := Max(s.r0+round, s.r1+round)
 	s.bb = Box3{V3{-r, -r, -height / 2}, V3{r, r, height / 2}}
@@ -520,19 +774,19 @@ func (s *ConeSDF3) Evaluate(p V3) float64 {
 	// convert to SoR 2d coordinates
 	p2 := V2{V2{p.X, p.Y}.Length(), p.Z}
 	// is p2 above the cone?
-	if p2.Y >= s.height && p2.X <= s.r1 {
-		return p2.Y - s.height - s.round
+	if p2.Y >= s.z1 && p2.X <= s.r1 {
+		return p2.Y - s.z1 - s.round
 	}
 	// is p2 below the cone?
-	if p2.Y <= -s.height && p2.X <= s.r0 {
-		return -p2.Y - s.height - s.round
+	if p2.Y <= s.z0 && p2.X <= s.r0 {
+		return s.z0 - p2.Y - s.round
 	}
 	// distance to slope line
-	v := p2.Sub(V2{s.r0, -s.height})
+	v := p2.Sub(V2{s.r0, s.z0})
 	dSlope := v.Dot(s.n)
 	// is p2 inside the cone?
-	if dSlope < 0 && Abs(p2.Y) < s.height {
-		return -Min(-dSlope, s.height-Abs(p2.Y)) - s.round
+	if dSlope < 0 && p2.Y > s.z0 && p2.Y < s.z1 {
+		return -Min(-dSlope, Min(s.z1-p2.Y, p2.Y-s.z0)) - s.round
 	}
 	// is p2 closest to the slope line?
 	t := v.Dot(s.u)
@@ -544,7 +798,7 @@ func (s *ConeSDF3) Evaluate(p V3) float64 {
 		return v.Length() - s.round
 	}
 	// p2 is closest to the top radius vertex
-	return p2.Sub(V2{s.r1, s.height}).Length() - s.round
+	return p2.Sub(V2{s.r1, s.z1}).Length() - s.round
 }
 
 // BoundingBox return the bounding box for the trucated cone..
@@ -553,13 +807,112 @@ func (s *ConeSDF3) BoundingBox() Box3 {
 }
 
 //-----------------------------------------------------------------------------
-// Transform SDF3 (rotation, translation - distance preserving)
+// Torus (exact distance field)
+
+// TorusSDF3 is a torus or an angular section of a torus.
+type TorusSDF3 struct {
+	major float64 // major radius (axis to tube center)
+	minor float64 // minor radius (tube radius)
+	theta float64 // section angle (0 == full torus)
+	bb    Box3
+}
+
+// Torus3D returns an SDF3 for a torus about the z-axis.
+func Torus3D(majorR, minorR float64) SDF3 {
+	return TorusTheta3D(majorR, minorR, 0)
+}
+
+// TorusTheta3D returns an SDF3 for an angular section of a torus about the z-axis.
+// The section starts on the x-axis and goes counter-clockwise for theta radians.
+// The ends of the section are capped with flat discs.
+func TorusTheta3D(majorR, minorR, theta float64) SDF3 {
+	if minorR <= 0 {
+		panic("minorR <= 0")
+	}
+	if majorR < minorR {
+		panic("majorR < minorR")
+	}
+	s := TorusSDF3{}
+	s.major = majorR
+	s.minor = minorR
+	s.theta = math.Mod(Abs(theta), Tau)
+	// work out the bounding box
+	r := majorR + minorR
+	if s.theta == 0 {
+		s.bb = Box3{V3{-r, -r, -minorR}, V3{r, r, minorR}}
+		return &s
+	}
+	sin := math.Sin(s.theta)
+	cos := math.Cos(s.theta)
+	vset := V2Set{{0, 0}, {r, 0}, {r * cos, r * sin}}
+	if s.theta > 0.5*Pi {
+		vset = append(vset, V2{0, r})
+	}
+	if s.theta > Pi {
+		vset = append(vset, V2{-r, 0})
+	}
+	if s.theta > 1.5*Pi {
+		vset = append(vset, V2{0, -r})
+	}
+	vmin := vset.Min()
+	vmax := vset.Max()
+	s.bb = Box3{V3{vmin.X, vmin.Y, -minorR}, V3{vmax.X, vmax.Y, minorR}}
+	return &s
+}
+
+// capDistance returns the distance to the end cap disc at angle a.
+func (s *TorusSDF3) capDistance(p V3, a float64) float64 {
+	sin := math.Sin(a)
+	cos := math.Cos(a)
+	// distance to the plane of the cap
+	h := Abs(p.Y*cos - p.X*sin)
+	// distance to the cap center within the plane
+	q := V2{p.X*cos + p.Y*sin - s.major, p.Z}.Length()
+	if q <= s.minor {
+		return h
+	}
+	return V2{h, q - s.minor}.Length()
+}
+
+// Evaluate returns the minimum distance to a torus.
+func (s *TorusSDF3) Evaluate(p V3) float64 {
+	d := V2{V2{p.X, p.Y}.Length() - s.major, p.Z}.Length() - s.minor
+	if s.theta == 0 {
+		return d
+	}
+	dCap := Min(s.capDistance(p, 0), s.capDistance(p, s.theta))
+	// Outside of the section the caps are the closest part of the torus.
+	phi := math.Atan2(p.Y, p.X)
+	if phi < 0 {
+		phi += Tau
+	}
+	if phi > s.theta {
+		return dCap
+	}
+	if d >= 0 {
+		return d
+	}
+	return -Min(-d, dCap)
+}
+
+// BoundingBox returns the bounding box for a torus.
+func (s *TorusSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+// Transform SDF3 (rotation, translation, scaling and shearing)
+// Rotation and translation are distance preserving.
+// Uniform scaling scales the distance by the scale factor.
+// Non-uniform scaling and shearing give a conservative bound on the distance.
 
 // TransformSDF3 is an SDF3 transformed with a 4x4 transformation matrix.
 type TransformSDF3 struct {
 	sdf     SDF3
 	matrix  M44
 	inverse M44
+	k       float64 // distance scaling
+	exact   bool    // is the distance exact?
 	bb      Box3
 }
 
@@ -569,14 +922,30 @@ func Transform3D(sdf SDF3, matrix M44) SDF3 {
 	s.sdf = sdf
 	s.matrix = matrix
 	s.inverse = matrix.Inverse()
+	// work out the distance scaling
+	kmin, kmax := matrix.ScaleFactors()
+	if kmax-kmin <= tolerance*kmax {
+		// uniform scaling
+		s.k = kmax
+		s.exact = true
+	} else {
+		// use the minimum scaling for a conservative bound
+		s.k = kmin
+		s.exact = false
+	}
 	s.bb = matrix.MulBox(sdf.BoundingBox())
 	return &s
 }
 
 // Evaluate returns the minimum distance to a transformed SDF3.
-// Distance is *not* preserved with scaling.
+// Distance is a lower bound with non-uniform scaling or shearing.
 func (s *TransformSDF3) Evaluate(p V3) float64 {
-	return s.sdf.Evaluate(s.inverse.MulPosition(p))
+	return s.sdf.Evaluate(s.inverse.MulPosition(p)) * s.k
+}
+
+// Exact returns true if the transformed SDF3 has an exact distance (not just a bound).
+func (s *TransformSDF3) Exact() bool {
+	return s.exact
 }
 
 // BoundingBox returns the bounding box of a transformed SDF3.
@@ -617,6 +986,177 @@ func (s *ScaleUniformSDF3) BoundingBox() Box3 {
 	return s.bb
 }
 
+//-----------------------------------------------------------------------------
+// Non-Uniform XYZ Scaling of SDF3s (we can only bound the distance)
+
+// ScaleNonUniformSDF3 is an SDF3 scaled by different amounts on each axis.
+type ScaleNonUniformSDF3 struct {
+	sdf      SDF3
+	invScale V3      // inverse scaling for each axis
+	k        float64 // minimum scale factor
+	bb       Box3
+}
+
+// ScaleNonUniform3D scales an SDF3 by a different amount on each axis.
+// The distance is not exact, it is a conservative (lower) bound on the real distance.
+func ScaleNonUniform3D(sdf SDF3, scale V3) SDF3 {
+	if scale.X == 0 || scale.Y == 0 || scale.Z == 0 {
+		panic("scale component == 0")
+	}
+	m := Scale3d(scale)
+	return &ScaleNonUniformSDF3{
+		sdf:      sdf,
+		invScale: V3{1 / scale.X, 1 / scale.Y, 1 / scale.Z},
+		k:        scale.Abs().MinComponent(),
+		bb:       m.MulBox(sdf.BoundingBox()),
+	}
+}
+
+// Evaluate returns a lower bound on the minimum distance to a non-uniformly scaled SDF3.
+// The distance for the unscaled SDF3 is divided by the maximum inverse scale factor.
+func (s *ScaleNonUniformSDF3) Evaluate(p V3) float64 {
+	q := p.Mul(s.invScale)
+	return s.sdf.Evaluate(q) * s.k
+}
+
+// Exact returns false, the distance for a non-uniformly scaled SDF3 is only a bound.
+func (s *ScaleNonUniformSDF3) Exact() bool {
+	return false
+}
+
+// BoundingBox returns the bounding box of a non-uniformly scaled SDF3.
+func (s *ScaleNonUniformSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+// Twist and Bend Deformations (we can only bound the distance)
+
+// TwistSDF3 is an SDF3 twisted about the z-axis.
+type TwistSDF3 struct {
+	sdf  SDF3
+	k    float64 // twist in radians per unit of z
+	rmax float64 // maximum radius of the SDF3 from the z-axis
+	bb   Box3
+}
+
+// Twist3D twists an SDF3 about the z-axis by k radians per unit of z.
+// The distance is not exact, it is a conservative (lower) bound on the real distance.
+func Twist3D(sdf SDF3, k float64) SDF3 {
+	s := TwistSDF3{}
+	s.sdf = sdf
+	s.k = k
+	// work out the bounding box
+	bb := sdf.BoundingBox()
+	for _, v := range bb.Vertices() {
+		s.rmax = Max(s.rmax, V2{v.X, v.Y}.Length())
+	}
+	s.bb = Box3{V3{-s.rmax, -s.rmax, bb.Min.Z}, V3{s.rmax, s.rmax, bb.Max.Z}}
+	return &s
+}
+
+// Evaluate returns a lower bound on the minimum distance to a twisted SDF3.
+func (s *TwistSDF3) Evaluate(p V3) float64 {
+	c, sn := math.Cos(-s.k*p.Z), math.Sin(-s.k*p.Z)
+	q := V3{c*p.X - sn*p.Y, sn*p.X + c*p.Y, p.Z}
+	// The twist stretches space by at most sqrt(1 + (k*r)^2) at radius r.
+	// The path to the surface is within max(r, rmax) of the z-axis.
+	r := Max(V2{p.X, p.Y}.Length(), s.rmax)
+	return s.sdf.Evaluate(q) / math.Sqrt(1+s.k*s.k*r*r)
+}
+
+// Exact returns true if the twist is zero.
+func (s *TwistSDF3) Exact() bool {
+	return s.k == 0
+}
+
+// BoundingBox returns the bounding box of a twisted SDF3.
+func (s *TwistSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+// BendSDF3 is an SDF3 bent about the z-axis.
+type BendSDF3 struct {
+	sdf  SDF3
+	r    float64 // bend radius
+	sign float64 // direction of the bend (+/- y)
+	rmin float64 // minimum radius of the bent SDF3
+	k    float64 // distance scale, 1 / maximum stretch of the bend
+	bb   Box3
+}
+
+// Bend3D bends the x-axis of an SDF3 into a circular arc in the XY plane.
+// The curvature is 1/radius of the arc, positive values bend towards +y.
+// The x-axis keeps its length, so the SDF3 should be shorter than the
+// circumference of the arc. The SDF3 must not extend to the center of the arc.
+// The distance is not exact. The bend stretches space along the arc by
+// radius/r at distance r from the center of the arc. Outside the minimum
+// radius of the bent SDF3 the stretch is at most radius/rmin, so the distance
+// is scaled by rmin/radius and its gradient is <= 1. Inside the minimum
+// radius (where there is no part of the bent SDF3) the distance is limited to
+// the distance to the minimum radius, so it is a lower bound on the real
+// distance but it is not a true SDF.
+func Bend3D(sdf SDF3, curvature float64) SDF3 {
+	if curvature == 0 {
+		panic("curvature == 0")
+	}
+	s := BendSDF3{}
+	s.sdf = sdf
+	s.r = 1 / Abs(curvature)
+	s.sign = Sign(curvature)
+	bb := sdf.BoundingBox()
+	// work out the radial and angular extents of the bent SDF3
+	y0, y1 := s.sign*bb.Min.Y, s.sign*bb.Max.Y
+	if y0 > y1 {
+		y0, y1 = y1, y0
+	}
+	s.rmin = s.r - y1
+	rmax := s.r - y0
+	if s.rmin <= 0 {
+		panic("sdf extends to the center of the bend")
+	}
+	s.k = Min(s.rmin/s.r, 1)
+	a0, a1 := bb.Min.X/s.r, bb.Max.X/s.r
+	// work out the bounding box
+	point := func(r, a float64) V2 {
+		return V2{r * math.Sin(a), s.sign * (s.r - r*math.Cos(a))}
+	}
+	pts := V2Set{point(s.rmin, a0), point(s.rmin, a1), point(rmax, a0), point(rmax, a1)}
+	for _, a := range []float64{-Pi, -0.5 * Pi, 0, 0.5 * Pi, Pi} {
+		if a > a0 && a < a1 {
+			pts = append(pts, point(rmax, a))
+		}
+	}
+	min, max := pts.Min(), pts.Max()
+	s.bb = Box3{V3{min.X, min.Y, bb.Min.Z}, V3{max.X, max.Y, bb.Max.Z}}
+	return &s
+}
+
+// Evaluate returns a lower bound on the minimum distance to a bent SDF3.
+func (s *BendSDF3) Evaluate(p V3) float64 {
+	// polar coordinates about the center of the bend
+	x, y := p.X, s.r-s.sign*p.Y
+	r := math.Sqrt(x*x + y*y)
+	a := math.Atan2(x, y)
+	q := V3{s.r * a, s.sign * (s.r - r), p.Z}
+	d := s.sdf.Evaluate(q) * s.k
+	if r < s.rmin {
+		// inside the minimum radius
+		return Min(d, s.rmin-r)
+	}
+	return d
+}
+
+// Exact returns false, the distance for a bent SDF3 is only a bound.
+func (s *BendSDF3) Exact() bool {
+	return false
+}
+
+// BoundingBox returns the bounding box of a bent SDF3.
+func (s *BendSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
 //-----------------------------------------------------------------------------
 
 // UnionSDF3 is a union of SDF3s.
@@ -730,6 +1270,9 @@ type ElongateSDF3 struct {
 }
 
 // Elongate3D returns the elongation of an SDF3.
+// The SDF3 is split at the origin and the halves are moved apart by h,
+// the gap is filled with the cross section at the origin.
+// E.g. elongating a sphere gives a capsule.
 func Elongate3D(sdf SDF3, h V3) SDF3 {
 	h = h.Abs()
 	s := ElongateSDF3{
@@ -745,7 +1288,7 @@ func Elongate3D(sdf SDF3, h V3) SDF3 {
 	return &s
 }
 
-// Evaluate returns the minimum distance to a elongated SDF2.
+// Evaluate returns the minimum distance to an elongated SDF3.
 func (s *ElongateSDF3) Evaluate(p V3) float64 {
 	q := p.Sub(p.Clamp(s.hn, s.hp))
 	return s.sdf.Evaluate(q)
@@ -758,6 +1301,108 @@ func (s *ElongateSDF3) BoundingBox() Box3 {
 
 //-----------------------------------------------------------------------------
 
+// OffsetSDF3 offsets the distance function of an existing SDF3.
+type OffsetSDF3 struct {
+	sdf    SDF3
+	offset float64
+	bb     Box3
+}
+
+// Offset3D returns an SDF3 that offsets the distance function of another SDF3.
+// A positive offset grows the SDF3, a negative offset shrinks it.
+// E.g. offset a screw by the printing clearance to make the hole for it.
+func Offset3D(sdf SDF3, offset float64) SDF3 {
+	s := OffsetSDF3{}
+	s.sdf = sdf
+	s.offset = offset
+	// work out the bounding box
+	bb := sdf.BoundingBox()
+	s.bb = NewBox3(bb.Center(), bb.Size().AddScalar(2*offset))
+	return &s
+}
+
+// Evaluate returns the offset minimum distance to an SDF3.
+func (s *OffsetSDF3) Evaluate(p V3) float64 {
+	return s.sdf.Evaluate(p) - s.offset
+}
+
+// BoundingBox returns the bounding box for the offset SDF3.
+func (s *OffsetSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+
+// LerpSDF3 is a linear interpolation between two SDF3s.
+type LerpSDF3 struct {
+	s0, s1 SDF3
+	t      float64 // blend (constant)
+	axis   bool    // the blend varies along an axis
+	p0     V3      // start of the axis (t = 0)
+	u      V3      // axis direction divided by the axis length
+	invK   float64 // inverse lipschitz bound of the blend
+	bb     Box3
+}
+
+// Lerp3D returns an SDF3 interpolated between s0 (t = 0) and s1 (t = 1).
+// The blend is clamped to [0, 1].
+func Lerp3D(s0, s1 SDF3, t float64) SDF3 {
+	s := LerpSDF3{}
+	s.s0 = s0
+	s.s1 = s1
+	s.t = Clamp(t, 0, 1)
+	s.invK = 1
+	s.bb = s0.BoundingBox().Extend(s1.BoundingBox())
+	return &s
+}
+
+// LerpAxis3D returns an SDF3 that changes from s0 to s1 along an axis, from
+// s0 at p0 (t = 0) to s1 at p1 (t = 1). The blend is clamped to [0, 1]
+// beyond the ends of the axis.
+// The distance is not exact, it is a conservative (lower) bound on the real distance.
+func LerpAxis3D(s0, s1 SDF3, p0, p1 V3) SDF3 {
+	v := p1.Sub(p0)
+	l := v.Length()
+	if l == 0 {
+		panic("p0 == p1")
+	}
+	s := LerpSDF3{}
+	s.s0 = s0
+	s.s1 = s1
+	s.axis = true
+	s.p0 = p0
+	s.u = v.DivScalar(l * l)
+	s.bb = s0.BoundingBox().Extend(s1.BoundingBox())
+	// The slope of the blend adds (s1 - s0)/l to the slope of the distance,
+	// estimate the maximum difference between s0 and s1 by sampling.
+	rng := rand.New(rand.NewSource(1))
+	size := s.bb.Size()
+	diff := 0.0
+	for i := 0; i < displaceSamples; i++ {
+		p := s.bb.Min.Add(size.Mul(V3{rng.Float64(), rng.Float64(), rng.Float64()}))
+		diff = Max(diff, Abs(s1.Evaluate(p)-s0.Evaluate(p)))
+	}
+	// allow for the difference being under-estimated by the sampling
+	s.invK = 1 / (1 + 1.5*diff/l)
+	return &s
+}
+
+// Evaluate returns the minimum distance to an interpolated SDF3.
+func (s *LerpSDF3) Evaluate(p V3) float64 {
+	t := s.t
+	if s.axis {
+		t = Clamp(p.Sub(s.p0).Dot(s.u), 0, 1)
+	}
+	return Mix(s.s0.Evaluate(p), s.s1.Evaluate(p), t) * s.invK
+}
+
+// BoundingBox returns the bounding box of an interpolated SDF3.
+func (s *LerpSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+
 // IntersectionSDF3 is the intersection of two SDF3s.
 type IntersectionSDF3 struct {
 	s0  SDF3
@@ -812,8 +1457,7 @@ func Cut3D(sdf SDF3, a, n V3) SDF3 {
 	s.sdf = sdf
 	s.a = a
 	s.n = n.Normalize().Neg()
-	// TODO - cut the bounding box
-	s.bb = sdf.BoundingBox()
+	s.bb = sdf.BoundingBox().Cut(a, n)
 	return &s
 }
 
@@ -827,6 +1471,46 @@ func (s *CutSDF3) BoundingBox() Box3 {
 	return s.bb
 }
 
+// Split3D splits an SDF3 into two parts along a plane passing through a with normal n.
+// The first part is on the same side as the normal. Both parts have a flat face on the plane.
+func Split3D(sdf SDF3, a, n V3) (SDF3, SDF3) {
+	return Cut3D(sdf, a, n), Cut3D(sdf, a, n.Neg())
+}
+
+// SplitKeyParms defines the key for a keyed split.
+type SplitKeyParms struct {
+	Key       SDF2    // key profile on the cut plane
+	Up        V3      // direction of the key profile y-axis on the cut plane
+	Depth     float64 // depth of the key into the first part
+	Clearance float64 // clearance between the key and the keyway
+}
+
+// SplitKeyed3D splits an SDF3 into two parts along a plane passing through a with normal n.
+// The first part is on the same side as the normal and has a keyway cut into its flat face.
+// The second part has a matching key (the key profile extruded along the normal) so the
+// parts line up when they are glued together. The key is trimmed to the SDF3.
+func SplitKeyed3D(sdf SDF3, a, n V3, k *SplitKeyParms) (SDF3, SDF3) {
+	if k.Key == nil {
+		panic("Key == nil")
+	}
+	if k.Depth <= 0 {
+		panic("Depth <= 0")
+	}
+	if k.Clearance < 0 {
+		panic("Clearance < 0")
+	}
+	if k.Up.Cross(n).Length() <= epsilon*k.Up.Length()*n.Length() {
+		panic("Up and Normal are parallel")
+	}
+	// key profile coordinates to part coordinates
+	m := NewFrame(a, n, k.Up.Cross(n)).Matrix()
+	key := Transform3D(Extrude3D(k.Key, k.Depth), m.Mul(Translate3d(V3{0, 0, 0.5 * k.Depth})))
+	keyway := Transform3D(Extrude3D(Offset2D(k.Key, k.Clearance), 2*(k.Depth+k.Clearance)), m)
+	s0 := Difference3D(Cut3D(sdf, a, n), keyway)
+	s1 := Union3D(Cut3D(sdf, a, n.Neg()), Intersect3D(key, sdf))
+	return s0, s1
+}
+
 //-----------------------------------------------------------------------------
 
 // ArraySDF3 stores an XYZ array of a given SDF3
@@ -839,6 +1523,7 @@ type ArraySDF3 struct {
 }
 
 // Array3D returns an XYZ array of a given SDF3
+// See Repeat3D() for large arrays.
 func Array3D(sdf SDF3, num V3i, step V3) SDF3 {
 	// check the number of steps
 	if num[0] <= 0 || num[1] <= 0 || num[2] <= 0 {
@@ -882,6 +1567,189 @@ func (s *ArraySDF3) BoundingBox() Box3 {
 
 //-----------------------------------------------------------------------------
 
+// RepeatSDF3 defines an XYZ grid of an SDF3 using domain repetition.
+type RepeatSDF3 struct {
+	sdf  SDF3
+	num  V3i
+	step V3
+	bb   Box3
+}
+
+// Repeat3D returns an XYZ grid of an SDF3 using domain repetition.
+// This has the same result as Array3D but only the cells nearest to the
+// evaluation point are evaluated, so the cost does not depend on the grid size.
+// The SDF3 should fit within a single grid cell.
+func Repeat3D(sdf SDF3, num V3i, step V3) SDF3 {
+	// check the number of steps
+	if num[0] <= 0 || num[1] <= 0 || num[2] <= 0 {
+		return nil
+	}
+	s := RepeatSDF3{}
+	s.sdf = sdf
+	s.num = num
+	s.step = step
+	// work out the bounding box
+	bb0 := sdf.BoundingBox()
+	bb1 := bb0.Translate(step.Mul(num.SubScalar(1).ToV3()))
+	s.bb = bb0.Extend(bb1)
+	return &s
+}
+
+// Evaluate returns the minimum distance to a repeated SDF3.
+func (s *RepeatSDF3) Evaluate(p V3) float64 {
+	x0, x1 := repeatCells(p.X, s.step.X, s.num[0])
+	y0, y1 := repeatCells(p.Y, s.step.Y, s.num[1])
+	z0, z1 := repeatCells(p.Z, s.step.Z, s.num[2])
+	d := math.MaxFloat64
+	for _, j := range [2]int{x0, x1} {
+		for _, k := range [2]int{y0, y1} {
+			for _, l := range [2]int{z0, z1} {
+				x := p.Sub(V3{float64(j) * s.step.X, float64(k) * s.step.Y, float64(l) * s.step.Z})
+				d = Min(d, s.sdf.Evaluate(x))
+			}
+		}
+	}
+	return d
+}
+
+// BoundingBox returns the bounding box of a repeated SDF3.
+func (s *RepeatSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+
+// RepeatFunc3 returns the transform for the instance of a repeated SDF3 at
+// grid index i, or false to leave the instance out.
+type RepeatFunc3 func(i V3i) (M44, bool)
+
+// RepeatTransformSDF3 is an XYZ grid of an SDF3 with a transform for each instance.
+type RepeatTransformSDF3 struct {
+	sdf   SDF3
+	num   V3i
+	step  V3
+	inv   []M44  // inverse transform for each instance
+	skip  []bool // instances left out
+	r     V3i    // cells to search either side of the nearest cell
+	limit float64
+	bb    Box3
+}
+
+// RepeatTransform3D returns an XYZ grid of an SDF3 using domain repetition.
+// Each instance is transformed (relative to its grid position) or left out
+// by a callback, e.g. for staggered patterns or hole grids with holes
+// missing. Only the cells near the evaluation point are evaluated, so the
+// cost doesn't depend on the grid size. The transforms should be rigid
+// (rotations and translations) and keep each instance near its grid cell.
+func RepeatTransform3D(sdf SDF3, num V3i, step V3, fn RepeatFunc3) SDF3 {
+	// check the number of steps
+	if num[0] <= 0 || num[1] <= 0 || num[2] <= 0 {
+		return nil
+	}
+	s := RepeatTransformSDF3{}
+	s.sdf = sdf
+	s.num = num
+	s.step = step
+	n := num[0] * num[1] * num[2]
+	s.inv = make([]M44, n)
+	s.skip = make([]bool, n)
+	bb0 := sdf.BoundingBox()
+	// the extent of the instances about their grid positions
+	var extent V3
+	found := false
+	for k := 0; k < num[2]; k++ {
+		for j := 0; j < num[1]; j++ {
+			for i := 0; i < num[0]; i++ {
+				idx := s.index(i, j, k)
+				m, ok := fn(V3i{i, j, k})
+				if !ok {
+					s.skip[idx] = true
+					continue
+				}
+				pos := step.Mul(V3i{i, j, k}.ToV3())
+				m = Translate3d(pos).Mul(m)
+				s.inv[idx] = m.Inverse()
+				bb := m.MulBox(bb0)
+				extent = extent.Max(bb.Min.Sub(pos).Abs()).Max(bb.Max.Sub(pos).Abs())
+				if !found {
+					s.bb = bb
+					found = true
+				} else {
+					s.bb = s.bb.Extend(bb)
+				}
+			}
+		}
+	}
+	if !found {
+		return nil
+	}
+	// search the cells that can hold an instance near the point
+	s.limit = math.MaxFloat64
+	ext := [3]float64{extent.X, extent.Y, extent.Z}
+	stp := [3]float64{step.X, step.Y, step.Z}
+	for i := range ext {
+		a := Abs(stp[i])
+		if num[i] == 1 || a == 0 {
+			continue
+		}
+		s.r[i] = int(Max(1, math.Ceil(ext[i]/a)))
+		// instances outside the searched cells are at least this far away
+		s.limit = Min(s.limit, 0.5*a)
+	}
+	return &s
+}
+
+// index returns the instance index for a grid index.
+func (s *RepeatTransformSDF3) index(i, j, k int) int {
+	return i + s.num[0]*(j+s.num[1]*k)
+}
+
+// repeatRange returns the range of grid cells to search along an axis.
+func repeatRange(x, step float64, n, r int) (int, int) {
+	if n == 1 || step == 0 {
+		return 0, 0
+	}
+	i := int(Clamp(math.Round(x/step), 0, float64(n-1)))
+	i0, i1 := i-r, i+r
+	if i0 < 0 {
+		i0 = 0
+	}
+	if i1 >= n {
+		i1 = n - 1
+	}
+	return i0, i1
+}
+
+// Evaluate returns the minimum distance to a repeated/transformed SDF3.
+func (s *RepeatTransformSDF3) Evaluate(p V3) float64 {
+	x0, x1 := repeatRange(p.X, s.step.X, s.num[0], s.r[0])
+	y0, y1 := repeatRange(p.Y, s.step.Y, s.num[1], s.r[1])
+	z0, z1 := repeatRange(p.Z, s.step.Z, s.num[2], s.r[2])
+	d := math.MaxFloat64
+	for k := z0; k <= z1; k++ {
+		for j := y0; j <= y1; j++ {
+			for i := x0; i <= x1; i++ {
+				idx := s.index(i, j, k)
+				if !s.skip[idx] {
+					d = Min(d, s.sdf.Evaluate(s.inv[idx].MulPosition(p)))
+				}
+			}
+		}
+	}
+	if d == math.MaxFloat64 {
+		// all the nearby instances are left out
+		return s.limit
+	}
+	return d
+}
+
+// BoundingBox returns the bounding box of a repeated/transformed SDF3.
+func (s *RepeatTransformSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+
 // RotateUnionSDF3 creates a union of SDF3s rotated about the z-axis.
 type RotateUnionSDF3 struct {
 	sdf  SDF3
@@ -947,6 +1815,8 @@ type RotateCopySDF3 struct {
 }
 
 // RotateCopy3D rotates and creates N copies of an SDF3 about the z-axis.
+// Space is folded into a single sector, so evaluation cost does not depend on N.
+// The SDF3 should lie within the sector centered on the +x axis.
 func RotateCopy3D(
 	sdf SDF3, // SDF3 to rotate and copy
 	num int, // number of copies
@@ -5,9 +5,27 @@
 package sdf
 
 import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"flag"
 	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"io/ioutil"
 	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 //-----------------------------------------------------------------------------
@@ -722,3 +740,5135 @@ func Test_Box2_Distances(t *testing.T) {
 }
 
 //-----------------------------------------------------------------------------
+
+func Test_ScaleFactors(t *testing.T) {
+	tests := []struct {
+		m          M44
+		kmin, kmax float64
+	}{
+		{Identity3d(), 1, 1},
+		{Translate3d(V3{1, 2, 3}), 1, 1},
+		{Rotate3d(V3{1, 2, 3}, DtoR(37)), 1, 1},
+		{Scale3d(V3{2, 2, 2}), 2, 2},
+		{Scale3d(V3{0.5, 3, 2}), 0.5, 3},
+		{RotateX(DtoR(20)).Mul(Scale3d(V3{4, 1, 0.25})).Mul(RotateZ(DtoR(-70))), 0.25, 4},
+	}
+	for _, v := range tests {
+		kmin, kmax := v.m.ScaleFactors()
+		if Abs(kmin-v.kmin) > 1e-6 || Abs(kmax-v.kmax) > 1e-6 {
+			t.Logf("expected %f %f, actual %f %f\n", v.kmin, v.kmax, kmin, kmax)
+			t.Error("FAIL")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Transform3D(t *testing.T) {
+	r := 2.0
+	s0 := Sphere3D(r)
+	// uniform scaling with rotation/translation gives an exact distance
+	k := 3.0
+	m := Translate3d(V3{1, -2, 3}).Mul(RotateY(DtoR(30))).Mul(Scale3d(V3{k, k, k}))
+	s1 := Transform3D(s0, m)
+	if !s1.(*TransformSDF3).Exact() {
+		t.Error("FAIL")
+	}
+	for i := 0; i < 1000; i++ {
+		b := NewBox3(V3{0, 0, 0}, V3{40, 40, 40})
+		p := b.Random()
+		d0 := p.Sub(V3{1, -2, 3}).Length() - k*r
+		d1 := s1.Evaluate(p)
+		if Abs(d0-d1) > tolerance {
+			t.Error("FAIL")
+		}
+	}
+	// non-uniform scaling gives a lower bound on the distance
+	s2 := Transform3D(s0, Scale3d(V3{1, 2, 4}))
+	if s2.(*TransformSDF3).Exact() {
+		t.Error("FAIL")
+	}
+	// sample the surface of the ellipsoid
+	surface := make(V3Set, 5000)
+	for i := range surface {
+		v := V3{randomRange(-1, 1), randomRange(-1, 1), randomRange(-1, 1)}
+		surface[i] = v.Normalize().MulScalar(r).Mul(V3{1, 2, 4})
+	}
+	for i := 0; i < 100; i++ {
+		b := NewBox3(V3{0, 0, 0}, V3{40, 40, 40})
+		p := b.Random()
+		// the distance to any surface point is an upper bound
+		dmax := math.MaxFloat64
+		for _, v := range surface {
+			dmax = Min(dmax, p.Sub(v).Length())
+		}
+		if Abs(s2.Evaluate(p)) > dmax+tolerance {
+			t.Error("FAIL")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_ScaleNonUniform3D(t *testing.T) {
+	s0 := Box3D(V3{1, 2, 3}, 0.2)
+	scale := V3{2, 0.5, -3}
+	s1 := ScaleNonUniform3D(s0, scale)
+	s2 := Transform3D(s0, Scale3d(scale))
+	if !s1.BoundingBox().Equals(s2.BoundingBox(), tolerance) {
+		t.Error("FAIL")
+	}
+	b := s1.BoundingBox().ScaleAboutCenter(1.5)
+	for i := 0; i < 1000; i++ {
+		p := b.Random()
+		if Abs(s1.Evaluate(p)-s2.Evaluate(p)) > tolerance {
+			t.Error("FAIL")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_RotateCopy(t *testing.T) {
+	// circles at the sector centers: the folded distance matches the union
+	n := 7
+	c := Transform2D(Circle2D(1.5), Translate2d(V2{5, 0}))
+	s0 := RotateCopy2D(c, n)
+	s1 := RotateUnion2D(c, n, Rotate2d(Tau/float64(n)))
+	b0 := s1.BoundingBox().ScaleAboutCenter(1.5)
+	for i := 0; i < 1000; i++ {
+		p := b0.Random()
+		if Abs(s0.Evaluate(p)-s1.Evaluate(p)) > tolerance {
+			t.Error("FAIL")
+		}
+	}
+	// spheres about the z-axis
+	k := Transform3D(Sphere3D(1.5), Translate3d(V3{5, 0, 1}))
+	s2 := RotateCopy3D(k, n)
+	s3 := RotateUnion3D(k, n, RotateZ(Tau/float64(n)))
+	b1 := s3.BoundingBox().ScaleAboutCenter(1.5)
+	for i := 0; i < 1000; i++ {
+		p := b1.Random()
+		if Abs(s2.Evaluate(p)-s3.Evaluate(p)) > tolerance {
+			t.Error("FAIL")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Repeat(t *testing.T) {
+	c := Circle2D(0.8)
+	num2 := V2i{5, 3}
+	step2 := V2{2, -3}
+	s0 := Repeat2D(c, num2, step2)
+	s1 := Array2D(c, num2, step2)
+	if !s0.BoundingBox().Equals(s1.BoundingBox(), tolerance) {
+		t.Error("FAIL")
+	}
+	b0 := s1.BoundingBox().ScaleAboutCenter(1.5)
+	for i := 0; i < 1000; i++ {
+		p := b0.Random()
+		if Abs(s0.Evaluate(p)-s1.Evaluate(p)) > tolerance {
+			t.Error("FAIL")
+		}
+	}
+	k := Sphere3D(1.2)
+	num3 := V3i{4, 1, 6}
+	step3 := V3{3, 3, 2.5}
+	s2 := Repeat3D(k, num3, step3)
+	s3 := Array3D(k, num3, step3)
+	if !s2.BoundingBox().Equals(s3.BoundingBox(), tolerance) {
+		t.Error("FAIL")
+	}
+	b1 := s3.BoundingBox().ScaleAboutCenter(1.5)
+	for i := 0; i < 1000; i++ {
+		p := b1.Random()
+		if Abs(s2.Evaluate(p)-s3.Evaluate(p)) > tolerance {
+			t.Error("FAIL")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Grid3(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := Box3D(V3{4, 6, 3}, 0.5)
+	g, err := NewGrid3(s, 20, filepath.Join(dir, "grid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	// samples match the sdf at the grid points
+	for x := 0; x <= g.steps[0]; x++ {
+		for y := 0; y <= g.steps[1]; y++ {
+			for z := 0; z <= g.steps[2]; z++ {
+				p := g.bb.Min.Add(V3i{x, y, z}.ToV3().Mul(g.inc))
+				if Abs(g.Get(x, y, z)-s.Evaluate(p)) > 1e-5 {
+					t.Error("FAIL")
+				}
+			}
+		}
+	}
+	// interpolated values are close to the sdf
+	b := s.BoundingBox().ScaleAboutCenter(1.5)
+	for i := 0; i < 1000; i++ {
+		p := b.Random()
+		if Abs(g.Evaluate(p)-s.Evaluate(p)) > g.inc.Length() {
+			t.Error("FAIL")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Voxel3D(t *testing.T) {
+	s := Difference3D(Box3D(V3{4, 6, 3}, 0.5), Sphere3D(1.5))
+	v := Voxel3D(s, 40)
+	// interpolated values are close to the sdf
+	b := s.BoundingBox().ScaleAboutCenter(1.5)
+	for i := 0; i < 1000; i++ {
+		p := b.Random()
+		if Abs(v.Evaluate(p)-s.Evaluate(p)) > v.inc.Length() {
+			t.Error("FAIL")
+		}
+	}
+	// save and load
+	var buf bytes.Buffer
+	if err := v.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	v1, err := DecodeVoxel3D(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v1.BoundingBox() != v.BoundingBox() || v1.steps != v.steps {
+		t.Error("FAIL")
+	}
+	for i := 0; i < 100; i++ {
+		p := b.Random()
+		if v1.Evaluate(p) != v.Evaluate(p) {
+			t.Error("FAIL")
+		}
+	}
+	// not a voxel file
+	if _, err := DecodeVoxel3D(bytes.NewReader(make([]byte, 100))); err == nil {
+		t.Error("FAIL")
+	}
+	// bad grid sizes
+	var enc bytes.Buffer
+	if err := v.Encode(&enc); err != nil {
+		t.Fatal(err)
+	}
+	steps := binary.Size(&voxelHeader{}) - 12
+	for _, n := range [][3]int32{{0, 1, 1}, {-1, 1, 1}, {maxVoxelSteps + 1, 1, 1}, {maxVoxelSteps, maxVoxelSteps, maxVoxelSteps}} {
+		b := append([]byte{}, enc.Bytes()...)
+		for i := range n {
+			binary.LittleEndian.PutUint32(b[steps+4*i:], uint32(n[i]))
+		}
+		if _, err := DecodeVoxel3D(bytes.NewReader(b)); err == nil {
+			t.Error("FAIL")
+		}
+	}
+	// bad bounding boxes (min.x is changed)
+	minX, maxX := 8, 32
+	maxXBits := binary.LittleEndian.Uint64(enc.Bytes()[maxX:])
+	for _, x := range []float64{math.NaN(), math.Inf(1), math.Inf(-1), math.Float64frombits(maxXBits), 100} {
+		b := append([]byte{}, enc.Bytes()...)
+		binary.LittleEndian.PutUint64(b[minX:], math.Float64bits(x))
+		if _, err := DecodeVoxel3D(bytes.NewReader(b)); err == nil {
+			t.Errorf("FAIL min.x %v", x)
+		}
+	}
+	// truncated file (size known, and unknown)
+	short := enc.Bytes()[:enc.Len()-4]
+	if _, err := DecodeVoxel3D(bytes.NewReader(short)); err == nil {
+		t.Error("FAIL")
+	}
+	if _, err := DecodeVoxel3D(bufio.NewReader(bytes.NewReader(short))); err == nil {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Cache3D(t *testing.T) {
+	s := Union3D(Box3D(V3{4, 6, 3}, 0.5), Sphere3D(2.5))
+	resolution := 0.01
+	c := Cache3D(s, resolution).(*CacheSDF3)
+	b := s.BoundingBox().ScaleAboutCenter(1.5)
+	// evaluate the same points from several goroutines
+	points := make([]V3, 1000)
+	for i := range points {
+		points[i] = b.Random()
+	}
+	done := make(chan bool)
+	for i := 0; i < 4; i++ {
+		go func() {
+			for _, p := range points {
+				if Abs(c.Evaluate(p)-s.Evaluate(p)) > resolution {
+					t.Error("FAIL")
+				}
+			}
+			done <- true
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		<-done
+	}
+	hits, misses := c.Stats()
+	if hits+misses != 4000 || misses < 1000 {
+		t.Error("FAIL")
+	}
+	// the points are now cached
+	for _, p := range points {
+		c.Evaluate(p)
+	}
+	if h, m := c.Stats(); h != hits+1000 || m != misses {
+		t.Error("FAIL")
+	}
+	// least recently used entries are evicted
+	c = newCacheSDF3(s, resolution, 10)
+	for _, p := range points[:20] {
+		c.Evaluate(p)
+	}
+	if len(c.entries) != 10 || c.lru.Len() != 10 {
+		t.Error("FAIL")
+	}
+	c.Evaluate(points[19])
+	c.Evaluate(points[0])
+	hits, misses = c.Stats()
+	if hits != 1 || misses != 21 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_AnalyzeLattice(t *testing.T) {
+	cell := Box3{V3{-5, -5, -5}, V3{5, 5, 5}}
+	// solid cell
+	r, err := AnalyzeLattice(Box3D(V3{12, 12, 12}, 0), cell, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Density != 1 || r.StiffnessMax != (V3{1, 1, 1}) || r.StiffnessMin != (V3{1, 1, 1}) {
+		t.Error("FAIL")
+	}
+	// cubic struts (2x2 cross section)
+	s := Union3D(
+		Box3D(V3{10, 2, 2}, 0),
+		Box3D(V3{2, 10, 2}, 0),
+		Box3D(V3{2, 2, 10}, 0),
+	)
+	r, err = AnalyzeLattice(s, cell, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Abs(r.Density-0.104) > tolerance {
+		t.Error("FAIL")
+	}
+	// 8 slices with 4% area, 2 slices with 36% area
+	sMax := 10 / (8/0.04 + 2/0.36)
+	if !r.StiffnessMax.Equals(V3{sMax, sMax, sMax}, tolerance) {
+		t.Error("FAIL")
+	}
+	if !r.StiffnessMin.Equals(V3{0.04, 0.04, 0.04}, tolerance) {
+		t.Error("FAIL")
+	}
+	// no load path in x
+	r, err = AnalyzeLattice(Box3D(V3{4, 12, 12}, 0), cell, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.StiffnessMax.X != 0 || r.StiffnessMin.X != 0 || Abs(r.StiffnessMin.Y-0.4) > tolerance {
+		t.Error("FAIL")
+	}
+	// bad parameters
+	if _, err := AnalyzeLattice(s, Box3{}, 10); err == nil {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Normal(t *testing.T) {
+	// analytic gradient
+	if !Normal3(Sphere3D(2), V3{0, 3, 4}, 1e-3).Equals(V3{0, 0.6, 0.8}, tolerance) {
+		t.Error("FAIL")
+	}
+	if !Normal2(Circle2D(2), V2{-3, 0}, 1e-3).Equals(V2{-1, 0}, tolerance) {
+		t.Error("FAIL")
+	}
+	if Normal3(Sphere3D(2), V3{}, 1e-3) != (V3{}) {
+		t.Error("FAIL")
+	}
+	// central differences
+	s3 := Box3D(V3{2, 4, 6}, 0)
+	if !Normal3(s3, V3{0, 0, 4}, 1e-3).Equals(V3{0, 0, 1}, 1e-6) {
+		t.Error("FAIL")
+	}
+	if !Normal3(Transform3D(Sphere3D(2), Translate3d(V3{1, 1, 1})), V3{1, 4, 5}, 1e-3).Equals(V3{0, 0.6, 0.8}, 1e-6) {
+		t.Error("FAIL")
+	}
+	s2 := Box2D(V2{2, 4}, 0)
+	if !Normal2(s2, V2{-2, 0}, 1e-3).Equals(V2{-1, 0}, 1e-6) {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// counterSDF3 is a user SDF3 that isn't safe for concurrent evaluation.
+type counterSDF3 struct {
+	SDF3
+	n int
+}
+
+func (s *counterSDF3) Evaluate(p V3) float64 {
+	s.n++
+	return s.SDF3.Evaluate(p)
+}
+
+// hammer evaluates a function at some points from multiple goroutines and
+// checks the results against sequential evaluation (run with -race).
+func hammer(t *testing.T, name string, n int, f func(i int) float64) {
+	expected := make([]float64, n)
+	for i := range expected {
+		expected[i] = f(i)
+	}
+	done := make(chan bool)
+	for j := 0; j < 8; j++ {
+		go func() {
+			for i := range expected {
+				if d := f(i); d != expected[i] && !(math.IsNaN(d) && math.IsNaN(expected[i])) {
+					t.Errorf("FAIL %s", name)
+				}
+			}
+			done <- true
+		}()
+	}
+	for j := 0; j < 8; j++ {
+		<-done
+	}
+}
+
+func Test_Concurrent(t *testing.T) {
+	c := Circle2D(1)
+	b := Box2D(V2{2, 3}, 0.2)
+	s2 := []SDF2{
+		c, b, Ellipse2D(2, 1), Star2D(5, 2, 1), Annulus2D(1, 2), ChamferBox2D(V2{2, 3}, 0.3),
+		Polygon2D([]V2{{0, 0}, {2, 0}, {1, 2}}), Line2D(3, 0.5),
+		Offset2D(b, 0.3), Cut2D(b, V2{0, 0}, V2{1, 1}), Union2D(c, b), Difference2D(b, c),
+		Transform2D(b, Rotate2d(DtoR(30))), Array2D(c, V2i{3, 2}, V2{2, 2}), RotateCopy2D(b, 4),
+		Slot2D(4, 1), Synchronized2D(c),
+	}
+	for i, s := range s2 {
+		bb := s.BoundingBox().ScaleAboutCenter(1.5)
+		points := bb.RandomSet(500)
+		hammer(t, fmt.Sprintf("sdf2 %d", i), len(points), func(i int) float64 { return s.Evaluate(points[i]) })
+	}
+	sp := Sphere3D(1)
+	bx := Box3D(V3{2, 3, 4}, 0.2)
+	s3 := []SDF3{
+		sp, bx, Cylinder3D(3, 1, 0.2), Cone3D(3, 1, 0.5, 0.1), Pill3D(4, 1), Torus3D(2, 0.5),
+		Ellipsoid3D(V3{1, 2, 3}), Extrude3D(b, 2), TwistExtrude3D(b, 2, 1), Revolve3D(Transform2D(c, Translate2d(V2{2, 0}))),
+		Loft3D(c, b, 3, 0.2), Union3D(sp, bx), Difference3D(bx, sp), Intersect3D(bx, sp),
+		Transform3D(bx, RotateZ(DtoR(30))), ScaleUniform3D(bx, 2), Offset3D(bx, 0.5), Cut3D(bx, V3{}, V3{1, 1, 1}),
+		Array3D(sp, V3i{2, 2, 2}, V3{3, 3, 3}), Twist3D(bx, 0.5), Bend3D(bx, 0.1),
+		Cache3D(bx, 0.01), Voxel3D(bx, 20), Synchronized3D(sp),
+	}
+	for i, s := range s3 {
+		bb := s.BoundingBox().ScaleAboutCenter(1.5)
+		points := bb.RandomSet(500)
+		hammer(t, fmt.Sprintf("sdf3 %d", i), len(points), func(i int) float64 { return s.Evaluate(points[i]) })
+	}
+	// a user SDF3 with mutable state
+	u := &counterSDF3{SDF3: sp}
+	s := Synchronized3D(u)
+	hammer(t, "synchronized", 100, func(i int) float64 { return s.Evaluate(V3{float64(i), 0, 0}) })
+	if u.n != 900 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_MarchingCubesSurface(t *testing.T) {
+	// separate parts and a thin shell
+	s0 := Transform3D(Sphere3D(3), Translate3d(V3{-6, 0, 0}))
+	s1 := Transform3D(Box3D(V3{4, 5, 6}, 0.5), Translate3d(V3{6, 0, 0}))
+	s2 := Difference3D(Sphere3D(8), Sphere3D(7.5))
+	s := Union3D(s0, s1, s2)
+	bb := s.BoundingBox().ScaleAboutCenter(1.01)
+	resolution := bb.Size().MaxComponent() / 100
+
+	// compare against a full uniform grid
+	m0 := marchingCubes(s, bb, resolution)
+
+	output := make(chan *Triangle3)
+	done := make(chan int)
+	go func() {
+		n := 0
+		for range output {
+			n++
+		}
+		done <- n
+	}()
+	marchingCubesSurface(s, resolution, output)
+	close(output)
+	if n := <-done; n != len(m0) {
+		t.Errorf("FAIL: %d triangles, expected %d", n, len(m0))
+	}
+}
+
+func Test_MarchingCubesSurfaceDisjoint(t *testing.T) {
+	// two small spheres lying between the seed lines
+	c0, c1 := V3{-10, -10, -10}, V3{10, 10, 10}
+	s := Union3D(Transform3D(Sphere3D(0.5), Translate3d(c0)), Transform3D(Sphere3D(0.5), Translate3d(c1)))
+	resolution := s.BoundingBox().Size().MaxComponent() / 100
+	output := make(chan *Triangle3)
+	done := make(chan [2]int)
+	go func() {
+		var n [2]int
+		for tri := range output {
+			for i, c := range []V3{c0, c1} {
+				if tri.V[0].Sub(c).Length() < 1 {
+					n[i]++
+				}
+			}
+		}
+		done <- n
+	}()
+	marchingCubesSurface(s, resolution, output)
+	close(output)
+	if n := <-done; n[0] == 0 || n[1] == 0 {
+		t.Errorf("FAIL: %v triangles on each sphere", n)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_TwistBend(t *testing.T) {
+	size := V3{8, 2, 3}
+	s0 := Box3D(size, 0)
+	// random points on the surface of the box
+	b0 := s0.BoundingBox()
+	surface := make([]V3, 2000)
+	for i := range surface {
+		p := b0.Random()
+		switch i % 6 {
+		case 0:
+			p.X = -0.5 * size.X
+		case 1:
+			p.X = 0.5 * size.X
+		case 2:
+			p.Y = -0.5 * size.Y
+		case 3:
+			p.Y = 0.5 * size.Y
+		case 4:
+			p.Z = -0.5 * size.Z
+		case 5:
+			p.Z = 0.5 * size.Z
+		}
+		surface[i] = p
+	}
+	// forward deformations of the box surface
+	k := 0.4
+	twist := func(p V3) V3 {
+		c, s := math.Cos(k*p.Z), math.Sin(k*p.Z)
+		return V3{c*p.X - s*p.Y, s*p.X + c*p.Y, p.Z}
+	}
+	r := 1 / k
+	bend := func(p V3) V3 {
+		a, l := p.X/r, r-p.Y
+		return V3{l * math.Sin(a), r - l*math.Cos(a), p.Z}
+	}
+	tests := []struct {
+		s  SDF3
+		fn func(V3) V3
+	}{
+		{Twist3D(s0, k), twist},
+		{Bend3D(s0, k), bend},
+	}
+	for _, test := range tests {
+		q := make([]V3, len(surface))
+		for i, p := range surface {
+			q[i] = test.fn(p)
+			// the surface is mapped to the surface
+			if Abs(test.s.Evaluate(q[i])) > tolerance {
+				t.Error("FAIL")
+			}
+			// the surface is within the bounding box
+			bb := test.s.BoundingBox()
+			if !q[i].Clamp(bb.Min, bb.Max).Equals(q[i], tolerance) {
+				t.Error("FAIL")
+			}
+		}
+		// the distance is a lower bound
+		b1 := test.s.BoundingBox().ScaleAboutCenter(1.5)
+		for i := 0; i < 500; i++ {
+			p := b1.Random()
+			dmin := math.MaxFloat64
+			for _, v := range q {
+				dmin = Min(dmin, p.Sub(v).Length())
+			}
+			if Abs(test.s.Evaluate(p)) > dmin+0.05 {
+				t.Error("FAIL")
+			}
+		}
+	}
+	// the gradient of the bent SDF3 is <= 1 outside the minimum radius
+	for _, c := range []float64{k, -k, 0.2} {
+		bend := Bend3D(s0, c).(*BendSDF3)
+		b1 := bend.BoundingBox().ScaleAboutCenter(1.5)
+		for i := 0; i < 5000; i++ {
+			p := b1.Random()
+			if r := (V2{p.X, bend.r - bend.sign*p.Y}).Length(); r < bend.rmin+0.01 {
+				// inside the minimum radius the distance is a lower bound
+				if r < bend.rmin && bend.Evaluate(p) > bend.rmin-r+tolerance {
+					t.Errorf("FAIL distance %f at %v", bend.Evaluate(p), p)
+					break
+				}
+				continue
+			}
+			h := 1e-6
+			g := V3{
+				bend.Evaluate(p.Add(V3{h, 0, 0})) - bend.Evaluate(p.Sub(V3{h, 0, 0})),
+				bend.Evaluate(p.Add(V3{0, h, 0})) - bend.Evaluate(p.Sub(V3{0, h, 0})),
+				bend.Evaluate(p.Add(V3{0, 0, h})) - bend.Evaluate(p.Sub(V3{0, 0, h})),
+			}.DivScalar(2 * h).Length()
+			if g > 1+1e-3 {
+				t.Errorf("FAIL gradient %f at %v", g, p)
+				break
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Elongate(t *testing.T) {
+	r, h := 1.5, 4.0
+	s0 := Elongate2D(Circle2D(r), V2{h, 0})
+	s1 := Line2D(h, r)
+	b0 := s1.BoundingBox().ScaleAboutCenter(1.5)
+	for i := 0; i < 1000; i++ {
+		p := b0.Random()
+		if Abs(s0.Evaluate(p)-s1.Evaluate(p)) > tolerance {
+			t.Error("FAIL")
+		}
+	}
+	s2 := Elongate3D(Sphere3D(r), V3{0, 0, h})
+	s3 := Cylinder3D(h+2*r, r, r)
+	if !s2.BoundingBox().Equals(s3.BoundingBox(), tolerance) {
+		t.Error("FAIL")
+	}
+	b1 := s3.BoundingBox().ScaleAboutCenter(1.5)
+	for i := 0; i < 1000; i++ {
+		p := b1.Random()
+		if Abs(s2.Evaluate(p)-s3.Evaluate(p)) > tolerance {
+			t.Error("FAIL")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Components3D(t *testing.T) {
+	// a shell with a sphere inside, a thin plate and a small sphere
+	s0 := Difference3D(Sphere3D(8), Sphere3D(7))
+	s1 := Sphere3D(3)
+	s2 := Transform3D(Box3D(V3{10, 10, 0.3}, 0), Translate3d(V3{15, 0, 0}))
+	s3 := Transform3D(Sphere3D(0.4), Translate3d(V3{-15, 5, 5}))
+	s := Union3D(s0, s1, s2, s3)
+	comps := Components3D(s, 40)
+	if len(comps) != 4 {
+		t.Errorf("FAIL: %d components, expected 4", len(comps))
+	}
+	for _, c := range comps {
+		if Abs(s.Evaluate(c.Surface)) > tolerance {
+			t.Error("FAIL")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_RemoveSmall3D(t *testing.T) {
+	// a box with some debris
+	s0 := Box3D(V3{10, 10, 10}, 0)
+	s1 := Transform3D(Sphere3D(0.5), Translate3d(V3{8, 0, 0}))
+	s2 := Transform3D(Box3D(V3{1, 1, 1}, 0), Translate3d(V3{0, 0, 7}))
+	s, err := RemoveSmall3D(Union3D(s0, s1, s2), 50, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.BoundingBox().Equals(s0.BoundingBox(), 0.5) {
+		t.Error("FAIL")
+	}
+	if len(Components3D(s, 50)) != 1 {
+		t.Error("FAIL")
+	}
+	if s.Evaluate(V3{8, 0, 0}) <= 0 || s.Evaluate(V3{0, 0, 7}) <= 0 {
+		t.Error("FAIL")
+	}
+	if s.Evaluate(V3{0, 0, 0}) >= 0 {
+		t.Error("FAIL")
+	}
+	// everything removed
+	if _, err := RemoveSmall3D(s1, 50, 2); err == nil {
+		t.Error("FAIL all removed")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Offset3D(t *testing.T) {
+	s0 := Offset3D(Sphere3D(5), 0.2)
+	s1 := Sphere3D(5.2)
+	if !s0.BoundingBox().Equals(s1.BoundingBox(), tolerance) {
+		t.Error("FAIL")
+	}
+	s2 := Offset3D(Box3D(V3{4, 6, 8}, 1), -0.5)
+	s3 := Box3D(V3{3, 5, 7}, 0.5)
+	if !s2.BoundingBox().Equals(s3.BoundingBox(), tolerance) {
+		t.Error("FAIL")
+	}
+	b := s1.BoundingBox().ScaleAboutCenter(1.5)
+	for i := 0; i < 1000; i++ {
+		p := b.Random()
+		if Abs(s0.Evaluate(p)-s1.Evaluate(p)) > tolerance {
+			t.Error("FAIL")
+		}
+		if Abs(s2.Evaluate(p)-s3.Evaluate(p)) > tolerance {
+			t.Error("FAIL")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Cut3D(t *testing.T) {
+	s := Box3D(V3{4, 4, 4}, 0)
+	// axis aligned cut
+	upper, lower := Split3D(s, V3{0, 0, 1}, V3{0, 0, 1})
+	if !upper.BoundingBox().Equals(Box3{V3{-2, -2, 1}, V3{2, 2, 2}}, tolerance) {
+		t.Error("FAIL")
+	}
+	if !lower.BoundingBox().Equals(Box3{V3{-2, -2, -2}, V3{2, 2, 1}}, tolerance) {
+		t.Error("FAIL")
+	}
+	// cut off a corner
+	s0 := Cut3D(s, V3{1, 1, 1}, V3{1, 1, 1})
+	if !s0.BoundingBox().Equals(Box3{V3{-1, -1, -1}, V3{2, 2, 2}}, tolerance) {
+		t.Error("FAIL")
+	}
+	// cut everything
+	s1 := Cut3D(s, V3{0, 0, 3}, V3{0, 0, 1})
+	if s1.BoundingBox().Size().Length() != 0 {
+		t.Error("FAIL")
+	}
+}
+
+func Test_SplitKeyed3D(t *testing.T) {
+	s := Box3D(V3{20, 20, 20}, 0)
+	k := SplitKeyParms{
+		Key:       Box2D(V2{4, 2}, 0),
+		Up:        V3{0, 1, 0},
+		Depth:     3,
+		Clearance: 0.25,
+	}
+	upper, lower := SplitKeyed3D(s, V3{0, 0, 1}, V3{0, 0, 1}, &k)
+	// keyway in the upper part
+	if upper.Evaluate(V3{0, 0, 2}) <= 0 || upper.Evaluate(V3{1.9, 0.9, 3.9}) <= 0 || upper.Evaluate(V3{0, 0, 5}) >= 0 {
+		t.Error("FAIL")
+	}
+	if Abs(upper.Evaluate(V3{2.5, 0, 2})+0.25) > tolerance {
+		t.Error("FAIL")
+	}
+	// key on the lower part
+	if lower.Evaluate(V3{0, 0, 2}) >= 0 || lower.Evaluate(V3{1.9, 0.9, 3.9}) >= 0 {
+		t.Error("FAIL")
+	}
+	if lower.Evaluate(V3{0, 1.5, 2}) <= 0 || lower.Evaluate(V3{0, 0, 4.5}) <= 0 {
+		t.Error("FAIL")
+	}
+	if Abs(lower.BoundingBox().Max.Z-4) > tolerance {
+		t.Error("FAIL")
+	}
+	// the up direction can't be parallel to the normal
+	for _, up := range []V3{{0, 0, 1}, {0, 0, -2}, {0, 0, 0}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("FAIL %v: no panic", up)
+				}
+			}()
+			k.Up = up
+			SplitKeyed3D(s, V3{0, 0, 1}, V3{0, 0, 1}, &k)
+		}()
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Engrave3D(t *testing.T) {
+	bar := Box2D(V2{0.2, 4}, 0)
+	// flat plate, the bar is widened to the nozzle width
+	plate := Box3D(V3{20, 20, 4}, 0)
+	k := EngraveParms{
+		Depth:    1,
+		Nozzle:   0.4,
+		Position: V3{0, 0, 3},
+		Normal:   V3{0, 0, 1},
+		Up:       V3{0, 1, 0},
+	}
+	s, err := Engrave3D(plate, bar, &k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Evaluate(V3{0, 0, 1.1}) <= 0 || s.Evaluate(V3{0.18, 0, 1.5}) <= 0 {
+		t.Error("FAIL")
+	}
+	if s.Evaluate(V3{0, 0, 0.9}) >= 0 || s.Evaluate(V3{0.22, 0, 1.5}) >= 0 {
+		t.Error("FAIL")
+	}
+	// the far face and the material below the depth are untouched
+	for _, z := range []float64{0.5, -0.5, -1.5, -1.9, -1.99} {
+		if s.Evaluate(V3{0, 0, z}) >= 0 {
+			t.Errorf("FAIL at z = %g", z)
+		}
+	}
+	// cylinder, the bar is widened further to allow for the curvature
+	cylinder := Cylinder3D(20, 5, 0)
+	k.Position = V3{6, 0, 0}
+	k.Normal = V3{1, 0, 0}
+	k.Up = V3{0, 0, 1}
+	s, err = Engrave3D(cylinder, bar, &k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// stroke width at the top is 0.4/(1-0.2) = 0.5
+	if s.Evaluate(V3{4.9, 0.23, 0}) <= 0 || s.Evaluate(V3{4.9, 0.27, 0}) >= 0 {
+		t.Error("FAIL")
+	}
+	// constant depth
+	if s.Evaluate(V3{4.1, 0, 1}) <= 0 || s.Evaluate(V3{3.9, 0, -1}) >= 0 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Cone3D(t *testing.T) {
+	// pointed and inverted cones against a revolved cross section
+	tests := []struct {
+		s SDF3
+		v []V2
+	}{
+		{Cone3D(10, 4, 0, 0), []V2{{-4, -5}, {4, -5}, {0, 5}}},
+		{Cone3D(10, 0, 4, 0), []V2{{0, -5}, {4, 5}, {-4, 5}}},
+		{Cone3D(10, 4, 2, 0), []V2{{-4, -5}, {4, -5}, {2, 5}, {-2, 5}}},
+	}
+	for _, test := range tests {
+		s1 := Revolve3D(Polygon2D(test.v))
+		b := test.s.BoundingBox().ScaleAboutCenter(1.5)
+		for i := 0; i < 1000; i++ {
+			p := b.Random()
+			if Abs(test.s.Evaluate(p)-s1.Evaluate(p)) > tolerance {
+				t.Error("FAIL")
+			}
+		}
+	}
+	// rounded apex
+	s := Cone3D(10, 4, 0, 0.5)
+	if s.Evaluate(V3{0, 0, 5}) <= 0 || s.Evaluate(V3{0, 0, 4}) >= 0 {
+		t.Error("FAIL")
+	}
+	// away from the rounding the surface is the same as the pointed cone
+	s0 := Cone3D(10, 4, 0, 0)
+	for _, p := range []V3{{2, 0, 0}, {0, 2.2, 0}, {1, 1, 0}, {0, 0, -5}} {
+		if Abs(s.Evaluate(p)-s0.Evaluate(p)) > tolerance {
+			t.Error("FAIL")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Pill3D(t *testing.T) {
+	s := Pill3D(6, 1)
+	if !s.BoundingBox().Equals(Box3{V3{-1, -1, -3}, V3{1, 1, 3}}, tolerance) {
+		t.Error("FAIL")
+	}
+	if Abs(s.Evaluate(V3{0, 0, 3})) > tolerance || Abs(s.Evaluate(V3{1, 0, 0})) > tolerance {
+		t.Error("FAIL")
+	}
+	// the deprecated Capsule3D is unchanged
+	s = Capsule3D(0.3, 1.4)
+	if !s.BoundingBox().Equals(Cylinder3D(0.3, 1.4, 0.3).BoundingBox(), tolerance) {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_GenerateTrianglesWithin(t *testing.T) {
+	s := Sphere3D(10)
+	// no time, only the first level is done
+	m, cells := GenerateTrianglesWithin(s, 10, 80, 0)
+	if cells != 10 || len(m) != len(GenerateTriangles(s, 10)) {
+		t.Error("FAIL")
+	}
+	// lots of time, all levels are done
+	m, cells = GenerateTrianglesWithin(s, 10, 60, time.Minute)
+	if cells != 60 || len(m) != len(GenerateTriangles(s, 60)) {
+		t.Error("FAIL")
+	}
+	// a short budget, the mesh is a complete level
+	m, cells = GenerateTrianglesWithin(s, 10, 2000, 100*time.Millisecond)
+	if cells >= 2000 || len(m) != len(GenerateTriangles(s, cells)) {
+		t.Error("FAIL")
+	}
+	// cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err := GenerateTrianglesWithinContext(ctx, s, 10, 60, time.Minute)
+	if err != context.Canceled {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// invertedSDF3 is an SDF3 with the wrong sign convention.
+type invertedSDF3 struct {
+	SDF3
+}
+
+func (s *invertedSDF3) Evaluate(p V3) float64 {
+	return -s.SDF3.Evaluate(p)
+}
+
+func Test_OrientTriangles(t *testing.T) {
+	s := Box3D(V3{10, 8, 6}, 1)
+	mesh := GenerateTriangles(s, 40)
+	if OrientTriangles(s, mesh) != 0 {
+		t.Error("FAIL")
+	}
+	// flip some (non-degenerate) triangles
+	degenerate := func(m *Triangle3) bool {
+		return m.V[1].Sub(m.V[0]).Cross(m.V[2].Sub(m.V[0])).Length() == 0
+	}
+	n := 0
+	for i, m := range mesh {
+		if i%3 == 0 && !degenerate(m) {
+			m.Flip()
+			n++
+		}
+	}
+	if OrientTriangles(s, mesh) != n {
+		t.Error("FAIL")
+	}
+	// all triangles are now facing out
+	for _, m := range mesh {
+		if degenerate(m) {
+			continue
+		}
+		c := m.V[0].Add(m.V[1]).Add(m.V[2]).DivScalar(3)
+		if s.Evaluate(c.Add(m.Normal().MulScalar(0.1))) <= 0 {
+			t.Error("FAIL")
+		}
+	}
+	// an inverted SDF3 generates inverted triangles, they are all flipped
+	inv := &invertedSDF3{s}
+	mesh = GenerateTriangles(inv, 40)
+	n = 0
+	for _, m := range mesh {
+		if !degenerate(m) {
+			n++
+		}
+	}
+	if OrientTriangles(inv, mesh) != n {
+		t.Error("FAIL")
+	}
+	// the renderers flip the triangles by default
+	mesh = GenerateTriangles(inv, 40)
+	if c := checkMesh(inv, mesh, OrientFlip); c.checked != len(mesh) || c.wrong != n {
+		t.Errorf("FAIL %v", c)
+	}
+	if OrientTriangles(inv, mesh) != 0 {
+		t.Error("FAIL")
+	}
+	// a sample is checked but not flipped, or the check is turned off
+	mesh = GenerateTriangles(inv, 40)
+	if c := checkMesh(inv, mesh, OrientSample); c.checked == 0 || c.checked > len(mesh)/10 || c.wrong == 0 {
+		t.Errorf("FAIL %v", c)
+	}
+	if c := checkMesh(inv, mesh, OrientNone); c.checked != 0 {
+		t.Errorf("FAIL %v", c)
+	}
+	if OrientTriangles(inv, mesh) != n {
+		t.Error("FAIL")
+	}
+	// OrientHook flips them all
+	mesh = HookMesh(GenerateTriangles(inv, 40), OrientHook(inv))
+	if OrientTriangles(inv, mesh) != 0 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Torus3D(t *testing.T) {
+	// full torus against a revolved circle
+	s0 := Torus3D(5, 2)
+	s1 := Revolve3D(Transform2D(Circle2D(2), Translate2d(V2{5, 0})))
+	b := s0.BoundingBox().ScaleAboutCenter(1.5)
+	for i := 0; i < 1000; i++ {
+		p := b.Random()
+		if Abs(s0.Evaluate(p)-s1.Evaluate(p)) > tolerance {
+			t.Error("FAIL")
+		}
+	}
+	// torus sections are inside/outside the same as a partial revolve
+	for _, theta := range []float64{0.3 * Pi, 1.25 * Pi, 1.9 * Pi} {
+		s0 = TorusTheta3D(5, 2, theta)
+		s1 = RevolveTheta3D(Transform2D(Circle2D(2), Translate2d(V2{5, 0})), theta)
+		b = s1.BoundingBox().ScaleAboutCenter(1.2)
+		if !s0.BoundingBox().Equals(s1.BoundingBox(), tolerance) {
+			t.Error("FAIL")
+		}
+		for i := 0; i < 1000; i++ {
+			p := b.Random()
+			if (s0.Evaluate(p) < 0) != (s1.Evaluate(p) < 0) {
+				t.Error("FAIL")
+			}
+		}
+	}
+	// distances to the end caps
+	s0 = TorusTheta3D(5, 2, 0.5*Pi)
+	tests := []struct {
+		p V3
+		d float64
+	}{
+		{V3{5, -1, 0}, 1},
+		{V3{5, -0.5, 1}, 0.5},
+		{V3{8, -4, 0}, math.Sqrt(17)},
+		{V3{-1, 5, 0}, 1},
+		{V3{5, 0.5, 0}, -0.5},
+		{V3{0.5, 5, 1}, -0.5},
+	}
+	for _, test := range tests {
+		if Abs(s0.Evaluate(test.p)-test.d) > tolerance {
+			t.Errorf("FAIL %v", test.p)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Ellipsoid3D(t *testing.T) {
+	// a spheroid/sphere
+	s0 := Ellipsoid3D(V3{4, 4, 4})
+	s1 := Sphere3D(4)
+	b := s0.BoundingBox().ScaleAboutCenter(1.5)
+	for i := 0; i < 1000; i++ {
+		p := b.Random()
+		if Abs(s0.Evaluate(p)-s1.Evaluate(p)) > tolerance {
+			t.Error("FAIL")
+		}
+	}
+	// against the closest sampled surface point
+	r := V3{2, 5, 3}
+	s0 = Ellipsoid3D(r)
+	var surface V3Set
+	n := 200
+	for i := 0; i <= n; i++ {
+		theta := Pi * float64(i) / float64(n)
+		for j := 0; j < 2*n; j++ {
+			phi := Pi * float64(j) / float64(n)
+			v := V3{math.Sin(theta) * math.Cos(phi), math.Sin(theta) * math.Sin(phi), math.Cos(theta)}
+			surface = append(surface, v.Mul(r))
+		}
+	}
+	b = s0.BoundingBox().ScaleAboutCenter(1.5)
+	for i := 0; i < 50; i++ {
+		p := b.Random()
+		d := math.MaxFloat64
+		for _, v := range surface {
+			d = Min(d, p.Sub(v).Length())
+		}
+		d0 := s0.Evaluate(p)
+		if Abs(d0) > d+tolerance || d-Abs(d0) > 0.05 {
+			t.Error("FAIL")
+		}
+		if (d0 < 0) != (p.Div(r).Length() < 1) {
+			t.Error("FAIL")
+		}
+	}
+	// points on the axes
+	tests := []struct {
+		p V3
+		d float64
+	}{
+		{V3{0, 0, 0}, -2},
+		{V3{4, 0, 0}, 2},
+		{V3{0, 0, 5}, 2},
+		{V3{0, -7, 0}, 2},
+	}
+	for _, test := range tests {
+		if Abs(s0.Evaluate(test.p)-test.d) > tolerance {
+			t.Error("FAIL")
+		}
+	}
+	// elliptic cylinder
+	s0 = EllipticCylinder3D(10, 3, 2)
+	tests = []struct {
+		p V3
+		d float64
+	}{
+		{V3{0, 0, 0}, -2},
+		{V3{0, 0, 6}, 1},
+		{V3{5, 0, 0}, 2},
+		{V3{0, 3, 7}, math.Sqrt(5)},
+		{V3{0, 0, 4.5}, -0.5},
+	}
+	for _, test := range tests {
+		if Abs(s0.Evaluate(test.p)-test.d) > tolerance {
+			t.Error("FAIL")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Hollow3D(t *testing.T) {
+	// two separate boxes, each has a cavity
+	b0 := Box3D(V3{20, 20, 20}, 0)
+	b1 := Transform3D(b0, Translate3d(V3{30, 0, 5}))
+	s, err := Hollow3D(Union3D(b0, b1), 2, &DrainParms{Radius: 1, Vent: true, MeshCells: 50})
+	if err != nil {
+		t.Error("FAIL")
+	}
+	for _, c := range []V3{{0, 0, 0}, {30, 0, 5}} {
+		// the cavity is empty, the walls are solid
+		if s.Evaluate(c) <= 0 || s.Evaluate(c.Add(V3{0, 9, 0})) >= 0 || s.Evaluate(c.Add(V3{5, 0, -9})) >= 0 {
+			t.Error("FAIL")
+		}
+		// drain and vent holes through the bottom and top walls
+		for _, dz := range []float64{-9, 9} {
+			p := c.Add(V3{0, 0, dz})
+			d := s.Evaluate(p)
+			if d <= 0 || Abs(d-1) > 0.5 {
+				t.Error("FAIL")
+			}
+		}
+	}
+	// no drain holes
+	s, err = Hollow3D(b0, 2, nil)
+	if err != nil || s.Evaluate(V3{0, 0, -9}) >= 0 || s.Evaluate(V3{0, 0, 0}) <= 0 {
+		t.Error("FAIL")
+	}
+	// too thick
+	_, err = Hollow3D(b0, 10, nil)
+	if err == nil {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Primitives2D(t *testing.T) {
+	// star vertices
+	star := func(n int, r0, r1 float64) V2Set {
+		var v V2Set
+		for i := 0; i < n; i++ {
+			a := Tau * float64(i) / float64(n)
+			b := a + Pi/float64(n)
+			v = append(v, V2{math.Cos(a), math.Sin(a)}.MulScalar(r0))
+			v = append(v, V2{math.Cos(b), math.Sin(b)}.MulScalar(r1))
+		}
+		return v
+	}
+	tests := []struct {
+		s0, s1 SDF2
+	}{
+		{ChamferBox2D(V2{10, 6}, 2), Polygon2D([]V2{{5, -1}, {5, 1}, {3, 3}, {-3, 3}, {-5, 1}, {-5, -1}, {-3, -3}, {3, -3}})},
+		{ChamferBox2D(V2{10, 6}, 0), Box2D(V2{10, 6}, 0)},
+		{Nagon2D(3, 5), Polygon2D(Nagon(3, 5))},
+		{Nagon2D(6, 5), Polygon2D(Nagon(6, 5))},
+		{Nagon2D(7, 5), Polygon2D(Nagon(7, 5))},
+		{Star2D(5, 5, 2), Polygon2D(star(5, 5, 2))},
+		{Star2D(8, 5, 4), Polygon2D(star(8, 5, 4))},
+		{Annulus2D(3, 5), Difference2D(Circle2D(5), Circle2D(3))},
+		{Ellipse2D(4, 4), Circle2D(4)},
+	}
+	for _, test := range tests {
+		if !test.s0.BoundingBox().Equals(test.s1.BoundingBox(), tolerance) {
+			t.Error("FAIL")
+		}
+		b := test.s1.BoundingBox().ScaleAboutCenter(1.5)
+		for i := 0; i < 1000; i++ {
+			p := b.Random()
+			if Abs(test.s0.Evaluate(p)-test.s1.Evaluate(p)) > tolerance {
+				t.Error("FAIL")
+			}
+		}
+	}
+	// ellipse against the closest sampled boundary point
+	r := V2{6, 2}
+	s := Ellipse2D(r.X, r.Y)
+	var boundary V2Set
+	for i := 0; i < 10000; i++ {
+		a := Tau * float64(i) / 10000
+		boundary = append(boundary, V2{math.Cos(a), math.Sin(a)}.Mul(r))
+	}
+	b := s.BoundingBox().ScaleAboutCenter(1.5)
+	for i := 0; i < 200; i++ {
+		p := b.Random()
+		d := math.MaxFloat64
+		for _, v := range boundary {
+			d = Min(d, p.Sub(v).Length())
+		}
+		d0 := s.Evaluate(p)
+		if Abs(Abs(d0)-d) > 0.01 || (d0 < 0) != (p.Div(r).Length() < 1) {
+			t.Error("FAIL")
+		}
+	}
+	// a star with inner vertices outside of the outer vertex triangle
+	bb := Star2D(3, 1, 0.8).BoundingBox()
+	if Abs(bb.Min.X+0.8) > tolerance {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_LayoutPlates(t *testing.T) {
+	k := PlateParms{Size: V2{150, 100}, Spacing: 5, Rotate: true}
+	var parts []Box3
+	for i := 0; i < 20; i++ {
+		size := V3{10 + float64(i%4)*10, 10 + float64(i%3)*5, 10}
+		parts = append(parts, NewBox3(V3{float64(i), -3, 7}, size))
+	}
+	// a part that only fits when rotated
+	parts = append(parts, NewBox3(V3{}, V3{20, 120, 10}))
+	placements, err := LayoutPlates(parts, &k)
+	if err != nil {
+		t.Fatal("FAIL")
+	}
+	if !placements[len(parts)-1].Rotate {
+		t.Error("FAIL")
+	}
+	// the parts are on the plates with no overlaps
+	plates := 0
+	boxes := make([]Box3, len(parts))
+	for i, p := range placements {
+		bb := p.Matrix.MulBox(parts[i])
+		boxes[i] = bb
+		plate := Box3{V3{k.Spacing, k.Spacing, 0}, V3{k.Size.X - k.Spacing, k.Size.Y - k.Spacing, 100}}
+		if bb.Min.X < plate.Min.X-tolerance || bb.Min.Y < plate.Min.Y-tolerance || bb.Max.X > plate.Max.X+tolerance || bb.Max.Y > plate.Max.Y+tolerance {
+			t.Error("FAIL")
+		}
+		if Abs(bb.Min.Z) > tolerance {
+			t.Error("FAIL")
+		}
+		if p.Plate+1 > plates {
+			plates = p.Plate + 1
+		}
+	}
+	if plates < 2 {
+		t.Error("FAIL")
+	}
+	for i := range boxes {
+		for j := i + 1; j < len(boxes); j++ {
+			if placements[i].Plate != placements[j].Plate {
+				continue
+			}
+			a, b := boxes[i], boxes[j]
+			gap := Max(Max(b.Min.X-a.Max.X, a.Min.X-b.Max.X), Max(b.Min.Y-a.Max.Y, a.Min.Y-b.Max.Y))
+			if gap < k.Spacing-tolerance {
+				t.Error("FAIL")
+			}
+		}
+	}
+	// too big
+	k.Rotate = false
+	if _, err := LayoutPlates(parts, &k); err == nil {
+		t.Error("FAIL")
+	}
+	// SDF3 plates
+	s, err := Plate3D([]SDF3{Sphere3D(10), Box3D(V3{20, 30, 40}, 0)}, &k)
+	if err != nil || len(s) != 1 {
+		t.Fatal("FAIL")
+	}
+	if Abs(s[0].BoundingBox().Min.Z) > tolerance || s[0].Evaluate(V3{15, 15, 10}) >= 0 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Slots2D(t *testing.T) {
+	tests := []struct {
+		s  SDF2
+		p  V2
+		d  float64
+		bb Box2
+	}{
+		{Slot2D(10, 4), V2{5, 0}, 0, Box2{V2{-5, -2}, V2{5, 2}}},
+		{Slot2D(10, 4), V2{0, 3}, 1, Box2{V2{-5, -2}, V2{5, 2}}},
+		{Obround2D(V2{4, 10}), V2{0, 6}, 1, Box2{V2{-2, -5}, V2{2, 5}}},
+		{Obround2D(V2{4, 10}), V2{1, 0}, -1, Box2{V2{-2, -5}, V2{2, 5}}},
+		{Keyhole2D(&KeyholeParms{10, 4, 15}), V2{0, -6}, 1, Box2{V2{-5, -5}, V2{5, 17}}},
+		{Keyhole2D(&KeyholeParms{10, 4, 15}), V2{3, 10}, 1, Box2{V2{-5, -5}, V2{5, 17}}},
+		{Keyhole2D(&KeyholeParms{10, 4, 15}), V2{0, 17}, 0, Box2{V2{-5, -5}, V2{5, 17}}},
+	}
+	for _, test := range tests {
+		if Abs(test.s.Evaluate(test.p)-test.d) > tolerance {
+			t.Error("FAIL")
+		}
+		if !test.s.BoundingBox().Equals(test.bb, tolerance) {
+			t.Error("FAIL")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Options(t *testing.T) {
+	sq := Box2D(V2{4, 4}, 0)
+	tests := []struct {
+		s0, s1 SDF3
+	}{
+		{NewBox3D(V3{10, 20, 30}), Box3D(V3{10, 20, 30}, 0)},
+		{NewBox3D(V3{10, 20, 30}, WithRound(2)), Box3D(V3{10, 20, 30}, 2)},
+		{NewCylinder3D(10, 3, WithRound(1)), Cylinder3D(10, 3, 1)},
+		{NewCone3D(10, 3, 1), Cone3D(10, 3, 1, 0)},
+		{NewExtrude3D(sq, 10), Extrude3D(sq, 10)},
+		{NewExtrude3D(sq, 10, WithRound(1)), ExtrudeRounded3D(sq, 10, 1)},
+		{NewExtrude3D(sq, 10, WithTwist(Pi)), TwistExtrude3D(sq, 10, Pi)},
+		{NewExtrude3D(sq, 10, WithScale(V2{2, 1}), WithTwist(1)), ScaleTwistExtrude3D(sq, 10, 1, V2{2, 1})},
+		{Extrude3D(NewBox2D(V2{4, 6}, WithChamfer(1)), 1), Extrude3D(ChamferBox2D(V2{4, 6}, 1), 1)},
+	}
+	for _, test := range tests {
+		b := test.s1.BoundingBox()
+		if !test.s0.BoundingBox().Equals(b, tolerance) {
+			t.Error("FAIL")
+		}
+		b = b.ScaleAboutCenter(1.5)
+		for i := 0; i < 100; i++ {
+			p := b.Random()
+			if Abs(test.s0.Evaluate(p)-test.s1.Evaluate(p)) > tolerance {
+				t.Error("FAIL")
+			}
+		}
+	}
+	// options that don't apply panic
+	for i, fn := range []func(){
+		func() { NewBox3D(V3{10, 20, 30}, WithTwist(1)) },
+		func() { NewCylinder3D(10, 3, WithChamfer(1)) },
+		func() { NewCone3D(10, 3, 1, WithScale(V2{2, 2})) },
+		func() { NewBox2D(V2{4, 6}, WithFillet(1, 1)) },
+		func() { NewExtrude3D(sq, 10, WithChamfer(1)) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("FAIL %d: no panic", i)
+				}
+			}()
+			fn()
+		}()
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_TriangleHooks(t *testing.T) {
+	s := Sphere3D(10)
+	mesh := GenerateTriangles(s, 20)
+	n := len(mesh)
+	// keep the top half, scale it and color it
+	top := Box3{V3{-20, -20, 0}, V3{20, 20, 20}}
+	red := func(p V3) V3 { return V3{1, 0, 0} }
+	mesh = HookMesh(mesh, RegionHook(top), ScaleHook(2), ColorHook(red))
+	if len(mesh) == 0 || len(mesh) >= n {
+		t.Error("FAIL")
+	}
+	for _, m := range mesh {
+		for _, v := range m.V {
+			// the triangle centers are in the region, the vertices are close
+			if v.Z < -3 || Abs(v.Length()-20) > 1 {
+				t.Error("FAIL")
+			}
+		}
+		if m.Attribute != 0xfc00 {
+			t.Error("FAIL")
+		}
+	}
+	// streaming hooks
+	dir, err := ioutil.TempDir("", "sdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "hooks.stl")
+	RenderSTL(s, 20, path, RegionHook(top), ColorHook(red))
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := int(binary.LittleEndian.Uint32(buf[80:]))
+	if count == 0 || count >= n || len(buf) != 84+50*count {
+		t.Error("FAIL")
+	}
+	if binary.LittleEndian.Uint16(buf[84+48:]) != 0xfc00 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Heightmap3D(t *testing.T) {
+	// a flat white image is a box
+	img := image.NewGray(image.Rect(0, 0, 4, 3))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	s0 := Heightmap3D(img, V3{8, 6, 2}, 0.5)
+	s1 := Transform3D(Box3D(V3{8, 6, 2}, 0), Translate3d(V3{0, 0, 1}))
+	b := s1.BoundingBox().ScaleAboutCenter(1.5)
+	for i := 0; i < 1000; i++ {
+		p := b.Random()
+		if Abs(s0.Evaluate(p)-s1.Evaluate(p)) > tolerance {
+			t.Error("FAIL")
+		}
+	}
+	// a black pixel (top left) is the base height
+	img.Pix[0] = 0
+	s0 = Heightmap3D(img, V3{8, 6, 2}, 0.5)
+	if Abs(s0.(*HeightmapSDF3).height(-3, 2)-0.5) > tolerance || Abs(s0.(*HeightmapSDF3).height(3, -2)-2) > tolerance {
+		t.Error("FAIL")
+	}
+	if Abs(s0.(*HeightmapSDF3).height(-2, 2)-1.25) > tolerance {
+		t.Error("FAIL")
+	}
+	// the distance is a bound
+	for i := 0; i < 1000; i++ {
+		p0, p1 := b.Random(), b.Random()
+		if Abs(s0.Evaluate(p0)-s0.Evaluate(p1)) > p0.Sub(p1).Length()+tolerance {
+			t.Error("FAIL")
+		}
+	}
+	if s0.Evaluate(V3{-3, 2, 0.6}) <= 0 || s0.Evaluate(V3{-3, 2, 0.4}) >= 0 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Bitmap2D(t *testing.T) {
+	// a black circle on a white background
+	n := 100
+	img := image.NewGray(image.Rect(0, 0, n, n))
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			p := V2{float64(i) + 0.5, float64(j) + 0.5}.SubScalar(float64(n) / 2)
+			if p.Length() < 30 {
+				img.SetGray(i, j, color.Gray{0})
+			} else {
+				img.SetGray(i, j, color.Gray{255})
+			}
+		}
+	}
+	s0 := Bitmap2D(img, V2{10, 10})
+	s1 := Circle2D(3)
+	if !s0.BoundingBox().Equals(Box2{V2{-5, -5}, V2{5, 5}}, tolerance) {
+		t.Error("FAIL")
+	}
+	b := s0.BoundingBox().ScaleAboutCenter(1.5)
+	for i := 0; i < 1000; i++ {
+		p := b.Random()
+		d0, d1 := s0.Evaluate(p), s1.Evaluate(p)
+		if Abs(p.X) > 5 || Abs(p.Y) > 5 {
+			// outside the image the distance is a bound
+			if d0 <= 0 || d0 > d1+0.15 {
+				t.Error("FAIL")
+			}
+			continue
+		}
+		// within a pixel or so
+		if Abs(d0-d1) > 0.15 {
+			t.Error("FAIL")
+		}
+	}
+	// the image is not flipped
+	img.SetGray(0, 0, color.Gray{0})
+	s0 = Bitmap2D(img, V2{10, 10})
+	if s0.Evaluate(V2{-4.95, 4.95}) >= 0 || s0.Evaluate(V2{-4.95, -4.95}) <= 0 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Hatch2D(t *testing.T) {
+	s := Circle2D(5)
+	// horizontal lines at y = -4 .. 4
+	lines := Hatch2D(s, &HatchParms{Style: HatchANSI31, Spacing: 1})
+	if len(lines) != 9 {
+		t.Error("FAIL")
+	}
+	for _, l := range lines {
+		y := l[0].Y
+		x := math.Sqrt(25 - y*y)
+		if !l[0].Equals(V2{-x, y}, 1e-6) || !l[1].Equals(V2{x, y}, 1e-6) {
+			t.Error("FAIL")
+		}
+	}
+	// line pairs and cross hatching
+	k := HatchParms{Style: HatchANSI32, Angle: DtoR(45), Spacing: 1}
+	if len(Hatch2D(s, &k)) <= len(lines) {
+		t.Error("FAIL")
+	}
+	k.Style = HatchANSI37
+	if len(Hatch2D(s, &k)) != 2*len(lines) {
+		t.Error("FAIL")
+	}
+	// the hatching is clipped to the inside
+	s = Annulus2D(2, 5)
+	k = HatchParms{Style: HatchANSI37, Angle: DtoR(30), Spacing: 0.7}
+	for _, l := range Hatch2D(s, &k) {
+		for _, x := range []float64{0.01, 0.5, 0.99} {
+			p := l[0].Add(l[1].Sub(l[0]).MulScalar(x))
+			if s.Evaluate(p) > 1e-6 {
+				t.Error("FAIL")
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Jig(t *testing.T) {
+	// a sphere jig (the lower half of a sphere can be dropped in)
+	part := Transform3D(Sphere3D(10), Translate3d(V3{5, 5, 20}))
+	k := JigParms{Clearance: 0.5, BaseThickness: 3, WallThickness: 4, SlotWidth: 4, SlotDepth: 2}
+	s, err := Jig(part, &k)
+	if err != nil {
+		t.Fatal("FAIL")
+	}
+	bb := Box3{V3{-9.5, -9.5, 6.5}, V3{19.5, 19.5, 20}}
+	if !s.BoundingBox().Equals(bb, tolerance) {
+		t.Error("FAIL")
+	}
+	// the part doesn't collide with the jig
+	b := part.BoundingBox()
+	for i := 0; i < 1000; i++ {
+		p := b.Random()
+		if part.Evaluate(p) < 0 && s.Evaluate(p) < k.Clearance-0.01 {
+			t.Error("FAIL")
+		}
+	}
+	// a cradle below the part, the clamp slots cut the top
+	tests := []struct {
+		p      V3
+		inside bool
+	}{
+		{V3{5, 5, 8}, true},
+		{V3{5, 5, 11}, false},
+		{V3{5, 5, 15}, false},
+		{V3{5, -8, 15}, true},
+		{V3{17, 5, 19}, true},
+		{V3{0, -8, 19}, false},
+		{V3{10, 18, 19}, false},
+		{V3{10, 18, 17}, true},
+	}
+	for _, test := range tests {
+		if (s.Evaluate(test.p) < 0) != test.inside {
+			t.Errorf("FAIL %v", test.p)
+		}
+	}
+	if _, err := Jig(part, &JigParms{}); err == nil {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// Fuzzing: random SDF trees and mesh parameters are checked for NaN
+// distances, bounding box containment and watertight meshes. E.g.
+// go test -run Fuzz ./sdf -args -fuzz.seed=42 -fuzz.n=1000
+var fuzzSeed = flag.Int64("fuzz.seed", 1, "random seed for the fuzz tests")
+var fuzzN = flag.Int("fuzz.n", 20, "number of random SDFs for the fuzz tests")
+
+// fuzzFloat returns a random float in [a, b).
+func fuzzFloat(r *rand.Rand, a, b float64) float64 {
+	return a + (b-a)*r.Float64()
+}
+
+// fuzzSDF2 returns a random SDF2 tree.
+func fuzzSDF2(r *rand.Rand, depth int) SDF2 {
+	if depth <= 0 || r.Intn(3) == 0 {
+		switch r.Intn(6) {
+		case 0:
+			return Circle2D(fuzzFloat(r, 0.5, 2))
+		case 1:
+			size := V2{fuzzFloat(r, 1, 4), fuzzFloat(r, 1, 4)}
+			return Box2D(size, fuzzFloat(r, 0, 0.4)*size.MinComponent())
+		case 2:
+			return Ellipse2D(fuzzFloat(r, 0.5, 2), fuzzFloat(r, 0.5, 2))
+		case 3:
+			r1 := fuzzFloat(r, 0.5, 1)
+			return Star2D(3+r.Intn(5), fuzzFloat(r, r1+0.2, 2.5), r1)
+		case 4:
+			r0 := fuzzFloat(r, 0.3, 1)
+			return Annulus2D(r0, fuzzFloat(r, r0+0.2, 2))
+		default:
+			return Nagon2D(3+r.Intn(5), fuzzFloat(r, 0.5, 2))
+		}
+	}
+	s0 := fuzzSDF2(r, depth-1)
+	switch r.Intn(4) {
+	case 0:
+		return Union2D(s0, fuzzSDF2(r, depth-1))
+	case 1:
+		return Difference2D(s0, fuzzSDF2(r, depth-1))
+	case 2:
+		m := Translate2d(V2{fuzzFloat(r, -1, 1), fuzzFloat(r, -1, 1)}).Mul(Rotate2d(fuzzFloat(r, 0, Tau)))
+		return Transform2D(s0, m)
+	default:
+		return Offset2D(s0, fuzzFloat(r, 0, 0.3))
+	}
+}
+
+// fuzzSDF3 returns a random SDF3 tree.
+func fuzzSDF3(r *rand.Rand, depth int) SDF3 {
+	if depth <= 0 || r.Intn(3) == 0 {
+		switch r.Intn(9) {
+		case 0:
+			return Sphere3D(fuzzFloat(r, 0.5, 2))
+		case 1:
+			size := V3{fuzzFloat(r, 1, 4), fuzzFloat(r, 1, 4), fuzzFloat(r, 1, 4)}
+			return Box3D(size, fuzzFloat(r, 0, 0.4)*size.MinComponent())
+		case 2:
+			radius := fuzzFloat(r, 0.5, 2)
+			return Cylinder3D(fuzzFloat(r, 1, 4), radius, fuzzFloat(r, 0, 0.4)*radius)
+		case 3:
+			return Cone3D(fuzzFloat(r, 1, 4), fuzzFloat(r, 0.5, 2), fuzzFloat(r, 0, 2), 0)
+		case 4:
+			radius := fuzzFloat(r, 0.3, 1)
+			return Pill3D(fuzzFloat(r, 2*radius+0.1, 4), radius)
+		case 5:
+			r1 := fuzzFloat(r, 0.2, 0.8)
+			return Torus3D(fuzzFloat(r, r1+0.2, 2), r1)
+		case 6:
+			return Ellipsoid3D(V3{fuzzFloat(r, 0.5, 2), fuzzFloat(r, 0.5, 2), fuzzFloat(r, 0.5, 2)})
+		case 7:
+			return Extrude3D(fuzzSDF2(r, depth-1), fuzzFloat(r, 0.5, 3))
+		default:
+			m := Translate2d(V2{fuzzFloat(r, 2.5, 4), 0})
+			return Revolve3D(Transform2D(fuzzSDF2(r, depth-1), m))
+		}
+	}
+	s0 := fuzzSDF3(r, depth-1)
+	switch r.Intn(6) {
+	case 0:
+		return Union3D(s0, fuzzSDF3(r, depth-1))
+	case 1:
+		return Difference3D(s0, fuzzSDF3(r, depth-1))
+	case 2:
+		return Intersect3D(s0, fuzzSDF3(r, depth-1))
+	case 3:
+		m := Translate3d(V3{fuzzFloat(r, -1, 1), fuzzFloat(r, -1, 1), fuzzFloat(r, -1, 1)})
+		m = m.Mul(RotateX(fuzzFloat(r, 0, Tau))).Mul(RotateZ(fuzzFloat(r, 0, Tau)))
+		return Transform3D(s0, m)
+	case 4:
+		return ScaleUniform3D(s0, fuzzFloat(r, 0.5, 2))
+	default:
+		return Offset3D(s0, fuzzFloat(r, 0, 0.3))
+	}
+}
+
+func Test_Fuzz(t *testing.T) {
+	r := rand.New(rand.NewSource(*fuzzSeed))
+	for i := 0; i < *fuzzN; i++ {
+		s := fuzzSDF3(r, 1+r.Intn(4))
+		bb := s.BoundingBox()
+		if bb.Size().MinComponent() < 0 {
+			t.Errorf("FAIL %d: bad bounding box %v", i, bb)
+			continue
+		}
+		// no NaN distances, no inside points outside of the bounding box
+		b := bb.ScaleAboutCenter(2)
+		points := append(b.RandomSet(2000), V3{}, bb.Min, bb.Max, bb.Center())
+		for _, p := range points {
+			d := s.Evaluate(p)
+			if math.IsNaN(d) {
+				t.Errorf("FAIL %d: NaN at %v", i, p)
+				break
+			}
+			q := p.Clamp(bb.Min, bb.Max)
+			if d < 0 && q.Sub(p).Length() > tolerance {
+				t.Errorf("FAIL %d: %v is inside and outside of the bounding box", i, p)
+				break
+			}
+		}
+		// the mesh is watertight and within the bounding box
+		cells := 20 + r.Intn(30)
+		mesh := GenerateTriangles(s, cells)
+		if !MeshStats(mesh).Watertight {
+			t.Errorf("FAIL %d: mesh (%d cells) is not watertight", i, cells)
+		}
+		pad := V3{1, 1, 1}.MulScalar(2 * bb.Size().MaxComponent() / float64(cells))
+		b = Box3{bb.Min.Sub(pad), bb.Max.Add(pad)}
+		for _, tri := range mesh {
+			for _, v := range tri.V {
+				if v.Clamp(b.Min, b.Max) != v {
+					t.Errorf("FAIL %d: vertex %v is outside of the bounding box", i, v)
+					break
+				}
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_EvaluateInterval(t *testing.T) {
+	// the intervals contain the sampled distances
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 50; i++ {
+		s := fuzzSDF3(r, 1+r.Intn(4))
+		bb := s.BoundingBox().ScaleAboutCenter(1.5)
+		for j := 0; j < 20; j++ {
+			p0, p1 := bb.Random(), bb.Random()
+			b := Box3{p0.Min(p1), p0.Max(p1)}
+			d := EvaluateInterval3(s, b)
+			for _, p := range b.RandomSet(50) {
+				if !d.Contains(s.Evaluate(p)) {
+					t.Errorf("FAIL %d", i)
+				}
+			}
+		}
+	}
+	// tight intervals
+	d := EvaluateInterval3(Sphere3D(1), Box3{V3{1, 2, 2}, V3{2, 3, 6}})
+	if Abs(d.Min-2) > tolerance || Abs(d.Max-6) > tolerance {
+		t.Error("FAIL")
+	}
+	d = EvaluateInterval3(Box3D(V3{2, 2, 2}, 0), Box3{V3{-0.5, -0.5, -0.5}, V3{0.5, 0.5, 0.5}})
+	if Abs(d.Min+1) > tolerance || Abs(d.Max+0.5) > tolerance {
+		t.Error("FAIL")
+	}
+	// the octree mesh is the same with and without interval pruning
+	type noInterval struct {
+		SDF3
+	}
+	s := Difference3D(Box3D(V3{4, 4, 4}, 0.2), Transform3D(Cylinder3D(6, 1, 0), RotateX(DtoR(30))))
+	m0 := GenerateTriangles(s, 30)
+	m1 := GenerateTriangles(noInterval{s}, 30)
+	if len(m0) != len(m1) {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_MarchingSquaresAdaptive(t *testing.T) {
+	s := Difference2D(
+		Union2D(Box2D(V2{40, 20}, 0), Transform2D(Circle2D(2), Translate2d(V2{20, 10}))),
+		Star2D(5, 3, 1),
+	)
+	lines := GenerateLinesAdaptive(s, 400, 0.01)
+	// the boundary is closed (each end point is shared by 2 lines)
+	ends := make(map[V2]int)
+	for _, l := range lines {
+		ends[l[0]]++
+		ends[l[1]]++
+	}
+	for _, n := range ends {
+		if n%2 != 0 {
+			t.Error("FAIL")
+			break
+		}
+	}
+	// the end points are on the boundary
+	for _, l := range lines {
+		for _, p := range l {
+			if Abs(s.Evaluate(p)) > 1e-3 {
+				t.Error("FAIL")
+			}
+		}
+	}
+	// fewer lines than uniform sampling at the minimum step
+	n := len(GenerateLines(s, 400))
+	if len(lines) == 0 || len(lines) > n/4 {
+		t.Errorf("FAIL %d %d", len(lines), n)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_TightenBBox(t *testing.T) {
+	// most of the box is removed
+	s := Difference3D(Box3D(V3{10, 10, 10}, 0), Transform3D(Box3D(V3{10, 12, 12}, 0), Translate3d(V3{4, 0, 0})))
+	ts := TightenBBox(s, 0.01)
+	bb := ts.BoundingBox()
+	if !bb.Equals(Box3{V3{-5, -5, -5}, V3{-1, 5, 5}}, 0.02) {
+		t.Errorf("FAIL %v", bb)
+	}
+	// an intersection
+	s = Intersect3D(Sphere3D(5), Transform3D(Sphere3D(5), Translate3d(V3{8, 0, 0})))
+	ts = TightenBBox(s, 0.01)
+	bb = ts.BoundingBox()
+	if Abs(bb.Min.X-3) > 0.02 || Abs(bb.Max.X-5) > 0.02 || Abs(bb.Max.Y-3) > 0.02 {
+		t.Errorf("FAIL %v", bb)
+	}
+	// the tightened box contains the object
+	b := s.BoundingBox()
+	for i := 0; i < 10000; i++ {
+		p := b.Random()
+		if s.Evaluate(p) < 0 && p.Clamp(bb.Min, bb.Max) != p {
+			t.Error("FAIL")
+			break
+		}
+	}
+}
+
+// looseSDF3 is an SDF3 with a loose bounding box and no interval evaluation.
+type looseSDF3 struct {
+	SDF3
+	bb Box3
+}
+
+func (s *looseSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+func Test_TightenBBoxTime(t *testing.T) {
+	// A 100 mm plate in a loose bounding box. Without interval evaluation
+	// the thin slabs next to the plate can only be shown to be empty by
+	// subdividing the whole face.
+	plate := Box3D(V3{100, 100, 10}, 1)
+	pb := plate.BoundingBox()
+	s := &looseSDF3{plate, Box3{pb.Min.SubScalar(20), pb.Max.AddScalar(20)}}
+	start := time.Now()
+	bb := TightenBBox(s, 0.01).BoundingBox()
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("FAIL took %v", d)
+	}
+	// the box is conservative, and tightened
+	if bb.Extend(pb) != bb || !bb.Equals(pb, 2) {
+		t.Errorf("FAIL %v", bb)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_ContourTree(t *testing.T) {
+	s := Union2D(
+		Annulus2D(5, 10),
+		Circle2D(2),
+		Transform2D(Box2D(V2{4, 4}, 0), Translate2d(V2{20, 0})),
+	)
+	tree := GenerateContours(s, 200)
+	all := tree.All()
+	if len(tree.Roots) != 2 || len(all) != 4 {
+		t.Fatalf("FAIL %d %d", len(tree.Roots), len(all))
+	}
+	// the largest root is the annulus
+	r := tree.Roots[0]
+	if Abs(r.Area()-Pi*100) > 1 || r.Hole || r.Depth != 0 || len(r.Children) != 1 {
+		t.Error("FAIL")
+	}
+	h := r.Children[0]
+	if Abs(h.Area()-Pi*25) > 1 || !h.Hole || h.Depth != 1 || h.Parent != r || len(h.Children) != 1 {
+		t.Error("FAIL")
+	}
+	i := h.Children[0]
+	if Abs(i.Area()-Pi*4) > 0.5 || i.Hole || i.Depth != 2 || len(i.Children) != 0 {
+		t.Error("FAIL")
+	}
+	b := tree.Roots[1]
+	if Abs(b.Area()-16) > 0.5 || b.Hole || len(b.Children) != 0 || !b.Contains(V2{20, 0}) {
+		t.Error("FAIL")
+	}
+	// outer boundaries are counter-clockwise, holes are clockwise
+	for _, c := range all {
+		if (signedArea(c.Points) > 0) == c.Hole {
+			t.Error("FAIL")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_MeshStats(t *testing.T) {
+	// unit cube
+	v := []V3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 1, 0}, {0, 0, 1}, {1, 0, 1}, {1, 1, 1}, {0, 1, 1}}
+	faces := [][4]int{{0, 3, 2, 1}, {4, 5, 6, 7}, {0, 1, 5, 4}, {2, 3, 7, 6}, {0, 4, 7, 3}, {1, 2, 6, 5}}
+	var mesh []*Triangle3
+	for _, f := range faces {
+		mesh = append(mesh, NewTriangle3(v[f[0]], v[f[1]], v[f[2]]))
+		mesh = append(mesh, NewTriangle3(v[f[0]], v[f[2]], v[f[3]]))
+	}
+	s := MeshStats(mesh)
+	if s.Triangles != 12 || Abs(s.Area-6) > tolerance || !s.Watertight || s.Degenerate != 0 {
+		t.Errorf("FAIL\n%s", s)
+	}
+	if s.MinEdge != 1 || Abs(s.MaxEdge-math.Sqrt2) > tolerance || s.AspectRatio[0] != 12 {
+		t.Errorf("FAIL\n%s", s)
+	}
+	// a missing triangle and a degenerate triangle
+	mesh = append(mesh[1:], NewTriangle3(V3{0, 0, 0}, V3{0, 0, 0}, V3{1, 0, 0}))
+	s = MeshStats(mesh)
+	if s.Watertight || s.OpenEdges != 3 || s.Degenerate != 1 {
+		t.Errorf("FAIL\n%s", s)
+	}
+	// a rendered sphere
+	s = MeshStats(GenerateTriangles(Sphere3D(10), 50))
+	if !s.Watertight || Abs(s.Area-4*Pi*100)/(4*Pi*100) > 0.02 {
+		t.Errorf("FAIL\n%s", s)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Symmetry(t *testing.T) {
+	hole := Cylinder3D(10, 1, 0)
+	// symmetric about y and z
+	s0 := Difference3D(Box3D(V3{20, 10, 6}, 1), Transform3D(hole, Translate3d(V3{5, 0, 0})))
+	sym := DetectSymmetry(s0, 1000, 1e-6)
+	if sym.Mirror != [3]bool{false, true, true} || sym.Rotation != 1 {
+		t.Errorf("FAIL %s", sym)
+	}
+	// symmetric about x, y and z
+	positions := V2Set{{5, 2}, {-5, 2}, {5, -2}, {-5, -2}}
+	s1 := Difference3D(Box3D(V3{20, 10, 6}, 1), MultiCylinder3D(10, 1, positions))
+	sym = DetectSymmetry(s1, 1000, 1e-6)
+	if sym.Mirror != [3]bool{true, true, true} || sym.Rotation != 2 {
+		t.Errorf("FAIL %s", sym)
+	}
+	// rotational symmetry
+	var hexagon V2Set
+	for i := 0; i < 6; i++ {
+		hexagon = append(hexagon, PolarToXY(5, float64(i)*Tau/6))
+	}
+	sym = DetectSymmetry(MultiCylinder3D(4, 1, hexagon), 1000, 1e-6)
+	if sym.Mirror != [3]bool{true, true, true} || sym.Rotation != 6 {
+		t.Errorf("FAIL %s", sym)
+	}
+	// the symmetric mesh matches the full mesh
+	for _, s := range []SDF3{s0, s1} {
+		sym = DetectSymmetry(s, 1000, 1e-6)
+		m0 := MeshStats(GenerateTrianglesSymmetric(s, 60, sym))
+		m1 := MeshStats(GenerateTriangles(s, 60))
+		if !m0.Watertight || Abs(m0.Area-m1.Area)/m1.Area > 0.01 {
+			t.Errorf("FAIL\n%s\n%s", m0, m1)
+		}
+	}
+	// a small off-center hole is missed by the sampling, but not by the grid check
+	plate := Difference3D(Box3D(V3{100, 100, 2}, 0), Transform3D(Cylinder3D(4, 0.5, 0), Translate3d(V3{30, 15, 0})))
+	sym = VerifySymmetry(plate, 200, DetectSymmetry(plate, 1000, 1e-3), 1e-3)
+	if sym.Mirror != [3]bool{false, false, true} {
+		t.Errorf("FAIL %s", sym)
+	}
+	// walls around the hole, and none around its reflections
+	walls := func(m []*Triangle3, p V2) int {
+		n := 0
+		for _, tri := range m {
+			if Abs(tri.Normal().Z) < 0.5 && (V2{tri.V[0].X, tri.V[0].Y}).Sub(p).Length() < 2 {
+				n++
+			}
+		}
+		return n
+	}
+	m := GenerateTrianglesSymmetric(plate, 200, sym)
+	if walls(m, V2{30, 15}) == 0 || walls(m, V2{-30, 15}) != 0 || walls(m, V2{30, -15}) != 0 {
+		t.Error("FAIL")
+	}
+	sym = VerifySymmetry(s1, 60, DetectSymmetry(s1, 1000, 1e-6), 1e-6)
+	if sym.Mirror != [3]bool{true, true, true} {
+		t.Errorf("FAIL %s", sym)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Properties3D(t *testing.T) {
+	// box
+	m, err := Properties3D(Box3D(V3{10, 20, 30}, 0), 2, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mass := 2.0 * 6000
+	ixx := mass * (20*20 + 30*30) / 12
+	iyy := mass * (10*10 + 30*30) / 12
+	if Abs(m.Volume-6000)/6000 > 0.01 || Abs(m.Mass-mass)/mass > 0.01 ||
+		Abs(m.Area-2200)/2200 > 0.02 || m.Centroid.Length() > 1e-6 ||
+		Abs(m.Inertia[0][0]-ixx)/ixx > 0.02 || Abs(m.Inertia[1][1]-iyy)/iyy > 0.02 ||
+		Abs(m.Inertia[0][1]) > 1e-6*ixx {
+		t.Errorf("FAIL\n%s", m)
+	}
+	// offset sphere
+	r := 5.0
+	c := V3{3, -2, 7}
+	m, err = Properties3D(Transform3D(Sphere3D(r), Translate3d(c)), 1, 0.2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := 4.0 / 3.0 * Pi * r * r * r
+	a := 4 * Pi * r * r
+	i := 0.4 * v * r * r
+	if Abs(m.Volume-v)/v > 0.01 || Abs(m.Area-a)/a > 0.02 || m.Centroid.Sub(c).Length() > 0.01 ||
+		Abs(m.Inertia[2][2]-i)/i > 0.02 || Abs(m.Inertia[0][2]) > 1e-3*i {
+		t.Errorf("FAIL\n%s", m)
+	}
+	// bad parameters
+	if _, err := Properties3D(Sphere3D(1), 1, 0); err == nil {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_PillContainer(t *testing.T) {
+	k := PillContainerParms{
+		Radius:       10,
+		Length:       20,
+		Wall:         2,
+		ThreadPitch:  1.5,
+		ThreadLength: 6,
+		Clearance:    0.2,
+		KnurlPitch:   1,
+		KnurlHeight:  0.5,
+	}
+	for _, length := range []float64{20, 40} {
+		k.Length = length
+		parts, err := PillContainer(&k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bottom, top := parts[0], parts[1]
+		// the halves don't overlap
+		bb := bottom.BoundingBox().Extend(top.BoundingBox())
+		r := rand.New(rand.NewSource(1))
+		for i := 0; i < 5000; i++ {
+			p := bb.Min.Add(V3{r.Float64(), r.Float64(), r.Float64()}.Mul(bb.Size()))
+			if bottom.Evaluate(p) < -1e-6 && top.Evaluate(p) < -1e-6 {
+				t.Fatalf("FAIL overlap at %v", p)
+			}
+		}
+		// the walls are solid (each side of the joint), the middle is empty
+		z := Max(0.5*length-10, 3)
+		if bottom.Evaluate(V3{9.5, 0, z - 7}) >= 0 || top.Evaluate(V3{9.5, 0, z}) >= 0 ||
+			bottom.Evaluate(V3{0, 0, 0}) <= 0 || top.Evaluate(V3{0, 0, 0}) <= 0 {
+			t.Error("FAIL")
+		}
+	}
+	// bad parameters
+	k.Wall = 1
+	if _, err := PillContainer(&k); err == nil {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_RepairMesh(t *testing.T) {
+	mesh := GenerateTriangles(Box3D(V3{10, 20, 30}, 2), 30)
+	area := MeshStats(mesh).Area
+	// damage the mesh
+	r := rand.New(rand.NewSource(1))
+	var damaged []*Triangle3
+	for i, t := range mesh {
+		if i == 0 {
+			// leave a hole
+			continue
+		}
+		x := *t
+		for j := range x.V {
+			x.V[j] = x.V[j].Add(V3{r.Float64(), r.Float64(), r.Float64()}.MulScalar(1e-7))
+		}
+		if i%10 == 0 {
+			x.Flip()
+		}
+		damaged = append(damaged, &x)
+	}
+	damaged = append(damaged, mesh[1], &Triangle3{V: [3]V3{mesh[2].V[0], mesh[2].V[0], mesh[2].V[1]}})
+	if MeshStats(damaged).Watertight {
+		t.Error("FAIL")
+	}
+	repaired, report := RepairMesh(damaged, &RepairParms{Tolerance: 1e-6, MaxHole: 8})
+	s := MeshStats(repaired)
+	flipped := (len(mesh) - 1) / 10
+	if !s.Watertight || report.OpenEdges != 0 || report.Duplicate != 1 || report.Degenerate < 1 ||
+		report.Flipped != flipped || report.Holes != 1 || report.Filled != 1 || Abs(s.Area-area)/area > 1e-3 {
+		t.Errorf("FAIL\n%s\n%s", report, s)
+	}
+	// the hole isn't filled
+	_, report = RepairMesh(damaged, &RepairParms{Tolerance: 1e-6})
+	if report.Filled != 0 || report.OpenEdges != 3 {
+		t.Errorf("FAIL\n%s", report)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Report(t *testing.T) {
+	s := Box3D(V3{10, 20, 30}, 1)
+	stats := MeshStats(GenerateTriangles(s, 50))
+	mass, err := Properties3D(s, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sym := DetectSymmetry(s, 100, 1e-6)
+	var b bytes.Buffer
+	if err := EncodeReport(&b, stats, mass, sym); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), `"kind": "mesh_stats"`) || !strings.Contains(b.String(), `"open_edges": 0`) {
+		t.Errorf("FAIL\n%s", b.String())
+	}
+	reports, err := DecodeReport(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 3 ||
+		!reflect.DeepEqual(reports[0], stats) ||
+		!reflect.DeepEqual(reports[1], mass) ||
+		!reflect.DeepEqual(reports[2], sym) {
+		t.Error("FAIL")
+	}
+	// not a report
+	if _, err := DecodeReport(strings.NewReader(`{"schema": "other"}`)); err == nil {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Simplify(t *testing.T) {
+	// flat faces
+	s := Box3D(V3{10, 20, 30}, 0)
+	mesh := GenerateTriangles(s, 50)
+	m0 := MeshStats(mesh)
+	simple := Simplify(mesh, &SimplifyParms{MaxError: 1e-6})
+	m1 := MeshStats(simple)
+	if !m1.Watertight || m1.Triangles > m0.Triangles/10 || Abs(m1.Area-m0.Area)/m0.Area > 1e-3 {
+		t.Errorf("FAIL\n%s\n%s", m0, m1)
+	}
+	// curved faces
+	r := 10.0
+	mesh = GenerateTriangles(Sphere3D(r), 50)
+	simple = Simplify(mesh, &SimplifyParms{TargetCount: 1000})
+	m1 = MeshStats(simple)
+	if !m1.Watertight || m1.Triangles > 1000 || m1.Triangles < 900 {
+		t.Errorf("FAIL\n%s", m1)
+	}
+	for _, x := range simple {
+		for _, v := range x.V {
+			if Abs(v.Length()-r) > 0.05*r {
+				t.Fatalf("FAIL %v", v)
+			}
+		}
+	}
+	// open edges are kept in place
+	mesh = GenerateTriangles(Box3D(V3{10, 10, 10}, 0), 20)
+	var half []*Triangle3
+	for _, x := range mesh {
+		if x.V[0].Z <= 0 && x.V[1].Z <= 0 && x.V[2].Z <= 0 {
+			half = append(half, x)
+		}
+	}
+	m0 = MeshStats(half)
+	m1 = MeshStats(Simplify(half, &SimplifyParms{MaxError: 1e-6}))
+	if m1.Triangles >= m0.Triangles || m1.OpenEdges == 0 || Abs(m1.Area-m0.Area)/m0.Area > 1e-3 {
+		t.Errorf("FAIL\n%s\n%s", m0, m1)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_SmoothMesh(t *testing.T) {
+	r := 10.0
+	s := Sphere3D(r)
+	// mean normal error and volume of a sphere mesh
+	measure := func(mesh []*Triangle3) (float64, float64) {
+		e, v := 0.0, 0.0
+		for _, x := range mesh {
+			c := x.V[0].Add(x.V[1]).Add(x.V[2]).DivScalar(3)
+			e += 1 - x.Normal().Dot(c.Normalize())
+			v += x.V[0].Dot(x.V[1].Cross(x.V[2])) / 6
+		}
+		return e / float64(len(mesh)), v
+	}
+	mesh := GenerateTriangles(s, 20)
+	e0, v0 := measure(mesh)
+	for _, k := range []SmoothParms{{10, 0.5, 0}, {10, 0.5, -0.53}} {
+		smooth := SmoothMesh(s, mesh, &k)
+		e1, v1 := measure(smooth)
+		v := 4.0 / 3.0 * Pi * r * r * r
+		if e1 >= e0 || Abs(v1-v)/v > Abs(v0-v)/v+0.01 || !MeshStats(smooth).Watertight {
+			t.Errorf("FAIL %v %g %g %g %g", k, e0, e1, v0, v1)
+		}
+		for _, x := range smooth {
+			for _, p := range x.V {
+				if Abs(p.Length()-r) > 1e-6 {
+					t.Fatalf("FAIL %v", p)
+				}
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_StablePoses(t *testing.T) {
+	s := Transform3D(Box3D(V3{10, 20, 30}, 0), Translate3d(V3{1, 2, 3}))
+	poses, err := StablePoses(s, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	areas := []float64{600, 600, 300, 300, 200, 200}
+	heights := []float64{5, 5, 10, 10, 15, 15}
+	if len(poses) != len(areas) {
+		t.Fatalf("FAIL %d poses", len(poses))
+	}
+	for i, p := range poses {
+		// the mesh edges are chamfered by up to a cell
+		if p.Area > areas[i] || p.Area < 0.8*areas[i] || Abs(p.Height-heights[i]) > 0.1 {
+			t.Errorf("FAIL %+v", p)
+		}
+		// the part rests on the z = 0 plane
+		bb := p.Transform.MulBox(s.BoundingBox())
+		c := p.Transform.MulPosition(V3{1, 2, 3})
+		if Abs(bb.Min.Z) > 0.1 || Abs(c.Z-p.Height) > 0.1 {
+			t.Errorf("FAIL %+v %v %v", p, bb, c)
+		}
+	}
+	// the chamfers are merged into the large faces
+	if poses[0].Area < 0.95*600 || poses[1].Area < 0.95*600 {
+		t.Errorf("FAIL %+v %+v", poses[0], poses[1])
+	}
+	// a cone rests on its base, a cylinder on its ends
+	for _, cells := range []int{30, 50, 60} {
+		poses, err = StablePoses(Cone3D(20, 10, 0, 0), cells)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := poses[0]
+		if p.Normal.Sub(V3{0, 0, -1}).Length() > 1e-3 || p.Area < 0.9*Pi*100 || p.Area > Pi*100 || Abs(p.Height-5) > 0.1 {
+			t.Errorf("FAIL cone %d cells %+v", cells, p)
+		}
+		poses, err = StablePoses(Cylinder3D(20, 5, 0), cells)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ends := 0
+		for _, p := range poses {
+			if Abs(Abs(p.Normal.Z)-1) > 1e-3 {
+				continue
+			}
+			ends++
+			if p.Area < 0.9*Pi*25 || p.Area > Pi*25 || Abs(p.Height-10) > 0.1 {
+				t.Errorf("FAIL cylinder %d cells %+v", cells, p)
+			}
+		}
+		if ends != 2 {
+			t.Errorf("FAIL cylinder %d cells, %d ends", cells, ends)
+		}
+	}
+	// the nearly coplanar triangles of a sphere are merged
+	poses, err = StablePoses(Sphere3D(10), 30)
+	if err != nil || len(poses) > 50 {
+		t.Errorf("FAIL sphere %d poses", len(poses))
+	}
+	// the hull of a cube
+	var points []V3
+	for _, v := range (Box3{V3{0, 0, 0}, V3{1, 1, 1}}).Vertices() {
+		points = append(points, v)
+	}
+	points = append(points, V3{0.5, 0.5, 0.5}, V3{0.5, 0.5, 1})
+	if hull := convexHull3(points, 1e-9); len(hull) != 12 {
+		t.Errorf("FAIL %d triangles", len(hull))
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Progress(t *testing.T) {
+	s := Sphere3D(10)
+	// progress is monotonic and completes
+	last := 0.0
+	calls := 0
+	mesh, err := GenerateTrianglesContext(context.Background(), s, 50, func(fraction float64, cells int) {
+		if fraction < last || fraction > 1 || cells <= 0 {
+			t.Errorf("FAIL fraction %f cells %d", fraction, cells)
+		}
+		last = fraction
+		calls++
+	})
+	if err != nil || calls == 0 || Abs(last-1) > 1e-9 {
+		t.Errorf("FAIL err %v calls %d last %f", err, calls, last)
+	}
+	if len(mesh) != len(GenerateTriangles(s, 50)) {
+		t.Error("FAIL")
+	}
+	lines, err := GenerateLinesContext(context.Background(), Circle2D(10), 50, nil)
+	if err != nil || len(lines) != len(GenerateLines(Circle2D(10), 50)) {
+		t.Errorf("FAIL err %v", err)
+	}
+	// cancelled operations
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	mesh, err = GenerateTrianglesContext(ctx, s, 50, nil)
+	if err != context.Canceled || mesh != nil {
+		t.Errorf("FAIL err %v", err)
+	}
+	lines, err = GenerateLinesContext(ctx, Circle2D(10), 50, nil)
+	if err != context.Canceled || lines != nil {
+		t.Errorf("FAIL err %v", err)
+	}
+	dir, err := ioutil.TempDir("", "sdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cancel.stl")
+	err = RenderSTLContext(ctx, s, 50, path, nil)
+	if _, statErr := os.Stat(path); err != context.Canceled || !os.IsNotExist(statErr) {
+		t.Errorf("FAIL err %v", err)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Compensate3D(t *testing.T) {
+	box := Box3D(V3{100, 50, 20}, 0)
+	k := CompensationParms{Shrink: V3{0.01, 0.02, 0.005}}
+	s, err := Compensate3D(box, &k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the compensated part is larger, and prints at the target size
+	size := s.BoundingBox().Size()
+	if !size.Equals(V3{100 / 0.99, 50 / 0.98, 20 / 0.995}, tolerance) {
+		t.Errorf("FAIL %v", size)
+	}
+	for _, p := range []V3{{50 / 0.99, 0, 0}, {0, -25 / 0.98, 0}, {0, 0, 10 / 0.995}} {
+		if Abs(s.Evaluate(p)) > tolerance {
+			t.Errorf("FAIL %v %f", p, s.Evaluate(p))
+		}
+	}
+	// the distance is a lower bound (the largest scaling is 1/0.98)
+	for _, p := range []V3{{60, 0, 0}, {0, 0, 0}, {70, 40, 20}} {
+		if Abs(s.Evaluate(p)) > Abs(box.Evaluate(p.Mul(V3{0.99, 0.98, 0.995})))/0.98+tolerance {
+			t.Errorf("FAIL %v", p)
+		}
+	}
+	// a uniform warp moves the compensated part the other way
+	warp := WarpField{
+		Box:  Box3{V3{-60, -30, -15}, V3{60, 30, 15}},
+		Size: V3i{2, 2, 2},
+	}
+	for i := 0; i < 8; i++ {
+		warp.Data = append(warp.Data, V3{0, 0, 0.5})
+	}
+	k = CompensationParms{Warp: &warp}
+	s, err = Compensate3D(box, &k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Abs(s.Evaluate(V3{0, 0, 9.5})) > tolerance || Abs(s.Evaluate(V3{0, 0, -10.5})) > tolerance {
+		t.Error("FAIL")
+	}
+	// a sheared warp, the distance is still a lower bound
+	warp.Data = []V3{{0, 0, 0}, {0, 0, 1}, {0, 0, 0}, {0, 0, 1}, {0, 0, 0}, {0, 0, 1}, {0, 0, 0}, {0, 0, 1}}
+	s, _ = Compensate3D(box, &k)
+	if d := warp.Displacement(V3{0, 0, 0}); !d.Equals(V3{0, 0, 0.5}, tolerance) {
+		t.Errorf("FAIL %v", d)
+	}
+	bb := s.BoundingBox()
+	for i := 0; i < 1000; i++ {
+		p := bb.Random()
+		for _, dir := range []V3{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}} {
+			q := p.Add(dir.MulScalar(s.Evaluate(p)))
+			if d0, d1 := s.Evaluate(p), s.Evaluate(q); d0 > 0 && d1 < -tolerance || d0 < 0 && d1 > tolerance {
+				t.Errorf("FAIL %v", p)
+			}
+		}
+	}
+	// material profiles
+	s, err = MaterialCompensate3D(box, "abs")
+	if err != nil || s.BoundingBox().Min.Z != -10 {
+		t.Errorf("FAIL %v", err)
+	}
+	if _, err = MaterialCompensate3D(box, "unobtanium"); err == nil {
+		t.Error("FAIL")
+	}
+	// bad parameters
+	if _, err = Compensate3D(box, &CompensationParms{Shrink: V3{1, 0, 0}}); err == nil {
+		t.Error("FAIL")
+	}
+	warp.Data = warp.Data[1:]
+	if _, err = Compensate3D(box, &k); err == nil {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_FeatureEdges(t *testing.T) {
+	// unit cube
+	quads := [][4]V3{
+		{{0, 0, 0}, {0, 1, 0}, {1, 1, 0}, {1, 0, 0}},
+		{{0, 0, 1}, {1, 0, 1}, {1, 1, 1}, {0, 1, 1}},
+		{{0, 0, 0}, {1, 0, 0}, {1, 0, 1}, {0, 0, 1}},
+		{{0, 1, 0}, {0, 1, 1}, {1, 1, 1}, {1, 1, 0}},
+		{{0, 0, 0}, {0, 0, 1}, {0, 1, 1}, {0, 1, 0}},
+		{{1, 0, 0}, {1, 1, 0}, {1, 1, 1}, {1, 0, 1}},
+	}
+	var mesh []*Triangle3
+	for _, q := range quads {
+		mesh = append(mesh, NewTriangle3(q[0], q[1], q[2]), NewTriangle3(q[0], q[2], q[3]))
+	}
+	// 12 edges between the corners
+	lines := FeatureEdges(mesh, DtoR(30))
+	if len(lines) != 12 {
+		t.Errorf("FAIL %d lines", len(lines))
+	}
+	for _, l := range lines {
+		if len(l) != 2 || Abs(l.Length()-1) > tolerance {
+			t.Errorf("FAIL %v", l)
+		}
+	}
+	if len(FeatureEdges(mesh, DtoR(100))) != 0 {
+		t.Error("FAIL")
+	}
+	// an open square is a closed loop of boundary edges
+	lines = FeatureEdges(mesh[:2], DtoR(30))
+	if len(lines) != 1 || !lines[0].Closed() || len(lines[0]) != 5 || Abs(lines[0].Length()-4) > tolerance {
+		t.Errorf("FAIL %v", lines)
+	}
+	// the edges of a meshed box (the marching cubes edges are chamfered)
+	lines = FeatureEdges(GenerateTriangles(Box3D(V3{10, 20, 30}, 0), 50), DtoR(20))
+	length := 0.0
+	for _, l := range lines {
+		length += l.Length()
+	}
+	if length < 240 || length > 2*240 {
+		t.Errorf("FAIL %f", length)
+	}
+	// no sharp edges on a sphere
+	if lines := FeatureEdges(GenerateTriangles(Sphere3D(10), 50), DtoR(30)); len(lines) != 0 {
+		t.Errorf("FAIL %d lines", len(lines))
+	}
+	// json round trip
+	var b bytes.Buffer
+	lines = FeatureEdges(mesh, DtoR(30))
+	if err := EncodeReport(&b, NewFeatureEdgeReport(lines, DtoR(30))); err != nil {
+		t.Fatal(err)
+	}
+	reports, err := DecodeReport(&b)
+	if err != nil || len(reports) != 1 {
+		t.Fatalf("FAIL %v", err)
+	}
+	if r, ok := reports[0].(*FeatureEdgeReport); !ok || !reflect.DeepEqual(r.Lines(), lines) {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Render(t *testing.T) {
+	s := Sphere3D(10)
+	o := DefaultRenderOptions(s)
+	o.Size = V2i{80, 60}
+	o.Samples = 1
+	img, err := RenderImage(s, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the sphere is in the center, the floor is gray
+	c := img.RGBAAt(40, 30)
+	if c.B <= c.R || c == (color.RGBA{0xff, 0xff, 0xff, 0xff}) {
+		t.Errorf("FAIL center %v", c)
+	}
+	if c := img.RGBAAt(40, 59); c.R != c.G || c.G != c.B || c.R == 0xff {
+		t.Errorf("FAIL floor %v", c)
+	}
+	// no floor, the background is white
+	o.Floor = false
+	img, _ = RenderImage(s, o)
+	for _, p := range []V2i{{0, 0}, {40, 59}} {
+		if c := img.RGBAAt(p[0], p[1]); c != (color.RGBA{0xff, 0xff, 0xff, 0xff}) {
+			t.Errorf("FAIL background %v", c)
+		}
+	}
+	// looking away from the model
+	o.Target = o.Eye.MulScalar(2)
+	img, _ = RenderImage(s, o)
+	if c := img.RGBAAt(40, 30); c != (color.RGBA{0xff, 0xff, 0xff, 0xff}) {
+		t.Errorf("FAIL away %v", c)
+	}
+	// png output
+	dir, err := ioutil.TempDir("", "sdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	o = DefaultRenderOptions(s)
+	o.Size = V2i{32, 24}
+	o.Path = filepath.Join(dir, "render.png")
+	if err := Render(s, o); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(o.Path); err != nil {
+		t.Error(err)
+	}
+	// bad options
+	o.Up = o.Target.Sub(o.Eye)
+	if Render(s, o) == nil {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_SDF4(t *testing.T) {
+	// a sphere moving along x
+	move := Motion4D(Sphere3D(5), func(t float64) M44 { return Translate3d(V3{10 * t, 0, 0}) })
+	if Abs(move.Evaluate(V3{15, 0, 0}, 1)) > tolerance || Abs(Frame4D(move, 0.5).Evaluate(V3{10, 0, 0})) > tolerance {
+		t.Error("FAIL")
+	}
+	if !move.BoundingBox(1).Center().Equals(V3{10, 0, 0}, tolerance) {
+		t.Error("FAIL")
+	}
+	// a growing sphere
+	grow := Func4D(func(p V3, t float64) float64 { return p.Length() - (5 + 5*t) }, Box3{V3{-10, -10, -10}, V3{10, 10, 10}})
+	if Abs(Frame4D(grow, 1).Evaluate(V3{0, 10, 0})) > tolerance {
+		t.Error("FAIL")
+	}
+	// a morph from a sphere to a box
+	morph := Morph4D(Sphere3D(5), Box3D(V3{10, 10, 10}, 0))
+	p := V3{4, 4, 0}
+	if morph.Evaluate(p, -1) != Sphere3D(5).Evaluate(p) || morph.Evaluate(p, 1) != Box3D(V3{10, 10, 10}, 0).Evaluate(p) {
+		t.Error("FAIL")
+	}
+	// a union of moving parts
+	s := Union4D(move, Motion4D(Sphere3D(5), func(t float64) M44 { return Translate3d(V3{-10 * t, 0, 0}) }))
+	if Abs(s.Evaluate(V3{-15, 0, 0}, 1)) > tolerance || !s.BoundingBox(1).Size().Equals(V3{30, 10, 10}, tolerance) {
+		t.Error("FAIL")
+	}
+	if _, ok := Frame4D(s, 1).(*UnionSDF3); !ok {
+		t.Error("FAIL")
+	}
+	// mesh sequence
+	k := SequenceParms{Start: 0, End: 1, Frames: 3, MeshCells: 20}
+	var area []float64
+	err := GenerateSequence(grow, &k, func(i int, time float64, mesh []*Triangle3) error {
+		if time != 0.5*float64(i) {
+			t.Errorf("FAIL frame %d time %f", i, time)
+		}
+		area = append(area, MeshStats(mesh).Area)
+		return nil
+	})
+	if err != nil || len(area) != 3 || !(area[0] < area[1] && area[1] < area[2]) {
+		t.Errorf("FAIL %v %v", err, area)
+	}
+	dir, err := ioutil.TempDir("", "sdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := RenderSequence(move, &k, filepath.Join(dir, "frame_%02d.obj")); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		b, err := ioutil.ReadFile(filepath.Join(dir, fmt.Sprintf("frame_%02d.obj", i)))
+		if err != nil || !strings.HasPrefix(string(b), "v ") || !strings.Contains(string(b), "\nf ") {
+			t.Errorf("FAIL %v", err)
+		}
+	}
+	if RenderSequence(move, &k, filepath.Join(dir, "frame_%02d.xyz")) == nil {
+		t.Error("FAIL")
+	}
+	// indexed OBJ output
+	var b bytes.Buffer
+	mesh := GenerateTriangles(Box3D(V3{1, 1, 1}, 0), 4)
+	if err := EncodeOBJ(&b, mesh); err != nil {
+		t.Fatal(err)
+	}
+	vertices := make(map[V3]bool)
+	for _, t := range mesh {
+		for _, v := range t.V {
+			vertices[v] = true
+		}
+	}
+	if strings.Count(b.String(), "v ") != len(vertices) || strings.Count(b.String(), "f ") != len(mesh) {
+		t.Errorf("FAIL %d vertices", strings.Count(b.String(), "v "))
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_RenderTurntable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := Box3D(V3{20, 10, 5}, 1)
+	o := DefaultRenderOptions(s)
+	o.Size = V2i{32, 24}
+	o.Samples = 1
+	// png sequence
+	o.Path = filepath.Join(dir, "turn.png")
+	if err := RenderTurntable(s, 4, *o); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := os.Stat(filepath.Join(dir, fmt.Sprintf("turn_%03d.png", i))); err != nil {
+			t.Error(err)
+		}
+	}
+	// animated gif
+	o.Path = filepath.Join(dir, "turn.gif")
+	if err := RenderTurntable(s, 6, *o); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(o.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	anim, err := gif.DecodeAll(f)
+	if err != nil || len(anim.Image) != 6 || anim.Image[0].Bounds().Size() != (image.Point{32, 24}) {
+		t.Errorf("FAIL %v", err)
+	}
+	// a half turn of a symmetric part looks the same
+	img0, _ := RenderImage(s, o)
+	o.Eye = o.Target.Add(RotateZ(Pi).MulPosition(o.Eye.Sub(o.Target)))
+	o.Light = RotateZ(Pi).MulPosition(o.Light)
+	img1, _ := RenderImage(s, o)
+	diff := 0
+	for i := range img0.Pix {
+		if d := int(img0.Pix[i]) - int(img1.Pix[i]); d > 2 || d < -2 {
+			diff++
+		}
+	}
+	if diff > len(img0.Pix)/50 {
+		t.Errorf("FAIL %d", diff)
+	}
+	if RenderTurntable(s, 0, *o) == nil {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_VoxelMorphology(t *testing.T) {
+	// distance transform of a single point
+	set := make([]bool, 5*5*5)
+	set[(2*5+2)*5+2] = true
+	d := edt3(set, V3i{5, 5, 5}, V3{1, 2, 1})
+	if d[(2*5+2)*5+2] != 0 || d[(4*5+2)*5+2] != 4 || d[(2*5+4)*5+2] != 16 || d[(0*5+0)*5+0] != 4+16+4 {
+		t.Error("FAIL")
+	}
+	s := Sphere3D(10)
+	v := Voxel3D(s, 50)
+	inc := v.inc.MaxComponent()
+	// dilate and erode
+	vd := v.Dilate(3)
+	ve := v.Erode(3)
+	for _, p := range []V3{{1, 0, 0}, {0, 1, 0}, {0, 0.6, 0.8}} {
+		if Abs(vd.Evaluate(p.MulScalar(13))) > inc || Abs(ve.Evaluate(p.MulScalar(7))) > inc {
+			t.Errorf("FAIL %v %f %f", p, vd.Evaluate(p.MulScalar(13)), ve.Evaluate(p.MulScalar(7)))
+		}
+	}
+	if vd.BoundingBox().Max.X < 13 || vd.BoundingBox().Min.Z > -13 {
+		t.Error("FAIL")
+	}
+	// opening removes a thin fin, the body is unchanged
+	body := Box3D(V3{20, 20, 20}, 0)
+	fin := Transform3D(Box3D(V3{10, 1, 10}, 0), Translate3d(V3{15, 0, 0}))
+	v = Voxel3D(Union3D(body, fin), 60)
+	inc = v.inc.MaxComponent()
+	vo := v.Open(2)
+	if vo.Evaluate(V3{15, 0, 0}) <= 0 || Abs(vo.Evaluate(V3{10, 0, 0})) > inc || vo.Evaluate(V3{0, 0, 0}) >= 0 {
+		t.Errorf("FAIL %f %f", vo.Evaluate(V3{15, 0, 0}), vo.Evaluate(V3{10, 0, 0}))
+	}
+	// closing fills a narrow gap
+	gap := Union3D(
+		Transform3D(Box3D(V3{10, 10, 10}, 0), Translate3d(V3{-5.5, 0, 0})),
+		Transform3D(Box3D(V3{10, 10, 10}, 0), Translate3d(V3{5.5, 0, 0})),
+	)
+	v = Voxel3D(gap, 60)
+	inc = v.inc.MaxComponent()
+	vc := v.Close(2)
+	if v.Evaluate(V3{0, 0, 0}) <= 0 || vc.Evaluate(V3{0, 0, 0}) >= 0 || Abs(vc.Evaluate(V3{10.5, 0, 0})) > inc {
+		t.Errorf("FAIL %f %f", vc.Evaluate(V3{0, 0, 0}), vc.Evaluate(V3{10.5, 0, 0}))
+	}
+	// a bound-only SDF3 (the scaled distance is too small to offset)
+	e := ScaleNonUniform3D(Sphere3D(10), V3{1, 1, 4})
+	vd = Voxel3D(e, 60).Dilate(2)
+	if Abs(vd.Evaluate(V3{0, 0, 42})) > Voxel3D(e, 60).inc.MaxComponent() {
+		t.Errorf("FAIL %f", vd.Evaluate(V3{0, 0, 42}))
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Encode3MF(t *testing.T) {
+	s := Box3D(V3{30, 20, 10}, 0)
+	mesh := GenerateTriangles(s, 20)
+	region := Transform3D(Box3D(V3{10, 10, 10}, 0), Translate3d(V3{10, 0, 0}))
+	m := RotateX(Pi / 2)
+	k := PrintParms{
+		Name:      "bracket <1>",
+		Transform: &m,
+		Seam:      "rear",
+		Settings:  map[string]string{"perimeters": "4"},
+		Modifiers: []PrintModifier{NewPrintModifier("dense", region, 10, map[string]string{"fill_density": "60%"})},
+	}
+	var b bytes.Buffer
+	if err := Encode3MF(&b, mesh, &k); err != nil {
+		t.Fatal(err)
+	}
+	z, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(r)
+		r.Close()
+		files[f.Name] = string(data)
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "3D/3dmodel.model", "Metadata/Slic3r_PE_model.config"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("FAIL no %s", name)
+		}
+	}
+	// the model
+	var model struct {
+		Object struct {
+			Name      string     `xml:"name,attr"`
+			Vertices  []struct{} `xml:"mesh>vertices>vertex"`
+			Triangles []struct {
+				V1 int `xml:"v1,attr"`
+			} `xml:"mesh>triangles>triangle"`
+		} `xml:"resources>object"`
+		Item struct {
+			Transform string `xml:"transform,attr"`
+		} `xml:"build>item"`
+	}
+	if err := xml.Unmarshal([]byte(files["3D/3dmodel.model"]), &model); err != nil {
+		t.Fatal(err)
+	}
+	n := len(mesh) + len(k.Modifiers[0].Mesh)
+	if model.Object.Name != k.Name || len(model.Object.Triangles) != n || len(model.Object.Vertices) == 0 {
+		t.Errorf("FAIL %s %d", model.Object.Name, len(model.Object.Triangles))
+	}
+	// row vector transform: x -> x, y -> z, z -> -y
+	var x [12]float64
+	fmt.Sscan(model.Item.Transform, &x[0], &x[1], &x[2], &x[3], &x[4], &x[5], &x[6], &x[7], &x[8], &x[9], &x[10], &x[11])
+	for i, v := range []float64{1, 0, 0, 0, 0, 1, 0, -1, 0, 0, 0, 0} {
+		if Abs(x[i]-v) > tolerance {
+			t.Errorf("FAIL %s", model.Item.Transform)
+			break
+		}
+	}
+	// the slicer config
+	var config struct {
+		Object struct {
+			Metadata []struct {
+				Key   string `xml:"key,attr"`
+				Value string `xml:"value,attr"`
+			} `xml:"metadata"`
+			Volumes []struct {
+				First    int `xml:"firstid,attr"`
+				Last     int `xml:"lastid,attr"`
+				Metadata []struct {
+					Key   string `xml:"key,attr"`
+					Value string `xml:"value,attr"`
+				} `xml:"metadata"`
+			} `xml:"volume"`
+		} `xml:"object"`
+	}
+	if err := xml.Unmarshal([]byte(files["Metadata/Slic3r_PE_model.config"]), &config); err != nil {
+		t.Fatal(err)
+	}
+	meta := make(map[string]string)
+	for _, x := range config.Object.Metadata {
+		meta[x.Key] = x.Value
+	}
+	if meta["seam_position"] != "rear" || meta["perimeters"] != "4" || meta["name"] != k.Name {
+		t.Errorf("FAIL %v", meta)
+	}
+	vols := config.Object.Volumes
+	if len(vols) != 2 || vols[0].First != 0 || vols[0].Last != len(mesh)-1 || vols[1].First != len(mesh) || vols[1].Last != n-1 {
+		t.Errorf("FAIL %v", vols)
+	}
+	meta = make(map[string]string)
+	for _, x := range vols[1].Metadata {
+		meta[x.Key] = x.Value
+	}
+	if meta["modifier"] != "1" || meta["fill_density"] != "60%" || meta["name"] != "dense" {
+		t.Errorf("FAIL %v", meta)
+	}
+	// bad parameters
+	if Encode3MF(&b, mesh, &PrintParms{Seam: "left"}) == nil || Encode3MF(&b, nil, &PrintParms{}) == nil {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_RenderPreview(t *testing.T) {
+	// ambient occlusion in an inside corner
+	s := Union3D(Box3D(V3{20, 20, 2}, 0), Transform3D(Box3D(V3{2, 20, 20}, 0), Translate3d(V3{-9, 0, 9})))
+	o := DefaultRenderOptions(s)
+	tr := tracer{s: s, k: 1, o: o, aoStep: 0.01 * s.BoundingBox().Size().Length()}
+	up := V3{0, 0, 1}
+	open := tr.occlusion(V3{5, 0, 1}, up)
+	corner := tr.occlusion(V3{-7.5, 0, 1}, up)
+	if Abs(open-1) > tolerance || corner >= open {
+		t.Errorf("FAIL %f %f", open, corner)
+	}
+	o.AO = false
+	if tr.occlusion(V3{-7.5, 0, 1}, up) != 1 {
+		t.Error("FAIL")
+	}
+	// preview png
+	dir, err := ioutil.TempDir("", "sdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "preview.png")
+	start := time.Now()
+	if err := RenderPreview(s, path); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil || cfg.Width != 400 || cfg.Height != 300 {
+		t.Errorf("FAIL %v %v", err, cfg)
+	}
+	t.Logf("preview %s", time.Since(start))
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_SliceImage(t *testing.T) {
+	// a box with an internal cavity
+	s := Difference3D(Box3D(V3{20, 20, 20}, 0), Box3D(V3{10, 10, 10}, 0))
+	k := &SliceImageParms{Pixels: 100, Contour: 1}
+
+	inside := func(img *image.RGBA, x, y int) bool {
+		c := img.RGBAAt(x, y)
+		return c.B > c.R
+	}
+
+	// the slice through the cavity
+	img, err := SliceImage(s, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := img.Bounds().Size()
+	if size.X != 100 || size.Y != 100 {
+		t.Errorf("FAIL image size %v", size)
+	}
+	cx, cy := size.X/2, size.Y/2
+	// the cavity is outside, the wall is inside, the corner is outside
+	if inside(img, cx, cy) || !inside(img, cx+34, cy) || inside(img, 0, 0) {
+		t.Error("FAIL slice colors")
+	}
+
+	// the silhouette has no cavity
+	k.Silhouette = true
+	img, err = SliceImage(s, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !inside(img, cx, cy) || !inside(img, cx+34, cy) || inside(img, 0, 0) {
+		t.Error("FAIL silhouette colors")
+	}
+
+	// out of range slice
+	k.Silhouette = false
+	k.Z = 20
+	if _, err := SliceImage(s, k); err == nil {
+		t.Error("FAIL expected an error")
+	}
+
+	dir, err := ioutil.TempDir("", "sdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	k.Z = 0
+	k.Path = filepath.Join(dir, "slice.png")
+	if err := RenderSlice(s, k); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(k.Path); err != nil {
+		t.Error("FAIL no png file")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_SliceZ2D(t *testing.T) {
+	// sphere slice is a circle
+	s := SliceZ2D(Sphere3D(10), 6)
+	if Abs(s.Evaluate(V2{8, 0})) > 1e-9 || Abs(s.Evaluate(V2{0, -8})) > 1e-9 {
+		t.Error("FAIL sphere slice radius")
+	}
+	// the bounding box fits the intersection with the sphere bounding box
+	if !s.BoundingBox().Equals(Box2{V2{-10, -10}, V2{10, 10}}, tolerance) {
+		t.Errorf("FAIL bounding box %v", s.BoundingBox())
+	}
+
+	// x/z profile of a box
+	box := Box3D(V3{10, 20, 30}, 0)
+	s = SlicePlane2D(box, Translate3d(V3{0, 2, 0}).Mul(RotateX(DtoR(90))))
+	if s.Evaluate(V2{0, 14}) >= 0 || s.Evaluate(V2{0, 16}) <= 0 || s.Evaluate(V2{6, 0}) <= 0 {
+		t.Error("FAIL box profile")
+	}
+	if !s.BoundingBox().Equals(Box2{V2{-5, -15}, V2{5, 15}}, tolerance) {
+		t.Errorf("FAIL bounding box %v", s.BoundingBox())
+	}
+
+	// an oblique slice is smaller than the projected bounding box
+	s = Slice2D(box, V3{0, 0, 0}, V3{1, 1, 0})
+	bb := s.BoundingBox()
+	if !EqualFloat64(bb.Size().X, 30, tolerance) || !EqualFloat64(bb.Size().Y, 10*math.Sqrt2, tolerance) {
+		t.Errorf("FAIL oblique bounding box %v", bb)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Project2D(t *testing.T) {
+	// sphere silhouette is a circle
+	s := Project2D(Transform3D(Sphere3D(10), Translate3d(V3{0, 0, 20})), V3{0, 0, 1})
+	for _, x := range []float64{12, 15, 20} {
+		d := s.Evaluate(V2{x, 0})
+		if Abs(d-(x-10)) > 0.02*(x-10) {
+			t.Errorf("FAIL distance at %g is %g", x, d)
+		}
+	}
+	if s.Evaluate(V2{0, 0}) >= 0 || s.Evaluate(V2{9, 0}) >= 0 {
+		t.Error("FAIL inside distance")
+	}
+	if Abs(s.Evaluate(V2{0, 10})) > 0.01 {
+		t.Error("FAIL silhouette boundary")
+	}
+
+	// an L shaped silhouette of two boxes at different heights
+	box := Box3D(V3{10, 10, 10}, 0)
+	l := Union3D(box, Transform3D(box, Translate3d(V3{10, 0, 30})), Transform3D(box, Translate3d(V3{0, 10, -30})))
+	s = Project2D(l, V3{0, 0, 1})
+	for _, p := range []V2{{0, 0}, {10, 0}, {0, 10}} {
+		if s.Evaluate(p) >= 0 {
+			t.Errorf("FAIL %v should be inside", p)
+		}
+	}
+	if s.Evaluate(V2{10, 10}) <= 0 {
+		t.Error("FAIL {10, 10} should be outside")
+	}
+
+	// x axis projection of a box is the y/z profile
+	s = Project2D(Box3D(V3{10, 20, 30}, 0), V3{1, 0, 0})
+	if !s.BoundingBox().Equals(Box2{V2{-10, -15}, V2{10, 15}}, tolerance) {
+		t.Errorf("FAIL bounding box %v", s.BoundingBox())
+	}
+	if s.Evaluate(V2{9, 14}) >= 0 || Abs(s.Evaluate(V2{12, 0})-2) > 0.01 {
+		t.Error("FAIL box profile")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_FilletExtrude3D(t *testing.T) {
+	s := FilletExtrude3D(Box2D(V2{20, 20}, 0), 10, 2, 0)
+	test := []struct {
+		p V3
+		d float64
+	}{
+		{V3{0, 0, 5}, 0},                           // top face
+		{V3{0, 0, -5}, 0},                          // bottom face
+		{V3{10, 0, 0}, 0},                          // side face
+		{V3{10, 0, 5}, 2*math.Sqrt2 - 2},           // rounded top edge
+		{V3{10, 0, -5}, 0},                         // sharp bottom edge
+		{V3{0, 0, 0}, -5},                          // center
+		{V3{8, 0, 3}, -2},                          // fillet center
+		{V3{0, 0, 8}, 3},                           // above the top
+		{V3{12, 0, -7}, 2 * math.Sqrt2},            // below the bottom edge
+		{V3{9, 0, 4}, math.Sqrt2 - 2},              // inside the fillet
+		{V3{8 + math.Sqrt2, 0, 3 + math.Sqrt2}, 0}, // on the fillet
+	}
+	for _, v := range test {
+		d := s.Evaluate(v.p)
+		if Abs(d-v.d) > tolerance {
+			t.Errorf("FAIL %v: expected %g, got %g", v.p, v.d, d)
+		}
+	}
+	// the height and profile are not changed
+	if !s.BoundingBox().Equals(Box3{V3{-10, -10, -5}, V3{10, 10, 5}}, tolerance) {
+		t.Errorf("FAIL bounding box %v", s.BoundingBox())
+	}
+	// the option constructor
+	s1 := NewExtrude3D(Box2D(V2{20, 20}, 0), 10, WithFillet(2, 0))
+	if s1.Evaluate(V3{10, 0, 5}) != s.Evaluate(V3{10, 0, 5}) {
+		t.Error("FAIL option constructor")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Tag3D(t *testing.T) {
+	// dual material part: a red base with a blue inlay
+	base := Tag3D(Box3D(V3{20, 20, 4}, 0), 1)
+	inlay := Tag3D(Cylinder3D(2, 5, 0), 2)
+	s := Union3D(base, Transform3D(inlay, Translate3d(V3{0, 0, 3})))
+	s = Difference3D(s, Transform3D(Cylinder3D(10, 1, 0), Translate3d(V3{8, 8, 0})))
+
+	test := []struct {
+		p   V3
+		tag int
+	}{
+		{V3{0, 0, 0}, 1},
+		{V3{0, 0, 3.5}, 2},
+		{V3{9, 0, 0}, 1},
+		{V3{8, 8, 0}, 1}, // the hole is cut from the base
+	}
+	for _, v := range test {
+		if tag := TagAt(s, v.p); tag != v.tag {
+			t.Errorf("FAIL %v: expected tag %d, got %d", v.p, v.tag, tag)
+		}
+	}
+	if TagAt(Box3D(V3{1, 1, 1}, 0), V3{}) != 0 {
+		t.Error("FAIL untagged")
+	}
+	if TagAt(Array3D(inlay, V3i{3, 1, 1}, V3{20, 0, 0}), V3{40, 0, 0}) != 2 {
+		t.Error("FAIL array tag")
+	}
+
+	groups := GenerateTaggedTriangles(s, 50)
+	if len(groups[1]) == 0 || len(groups[2]) == 0 || len(groups[0]) != 0 {
+		t.Errorf("FAIL groups %d %d %d", len(groups[0]), len(groups[1]), len(groups[2]))
+	}
+
+	// OBJ with a material library
+	var obj, mtl bytes.Buffer
+	if err := EncodeTaggedOBJ(&obj, "part.mtl", groups); err != nil {
+		t.Fatal(err)
+	}
+	if err := EncodeMTL(&mtl, groups, map[int]color.RGBA{2: {0, 0, 0xff, 0xff}}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(obj.String(), "mtllib part.mtl\n") || !strings.Contains(obj.String(), "usemtl tag2\n") {
+		t.Error("FAIL obj materials")
+	}
+	if !strings.Contains(mtl.String(), "newmtl tag2\nKd 0.000 0.000 1.000\n") {
+		t.Error("FAIL mtl colors")
+	}
+
+	// multi-material 3MF
+	var b bytes.Buffer
+	if err := EncodeTagged3MF(&b, groups, nil, &PrintParms{Name: "inlay"}); err != nil {
+		t.Fatal(err)
+	}
+	z, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(r)
+		r.Close()
+		files[f.Name] = string(data)
+	}
+	model := files["3D/3dmodel.model"]
+	if strings.Count(model, "<base ") != 2 || !strings.Contains(model, "pid=\"1\" p1=\"1\"") {
+		t.Error("FAIL 3mf base materials")
+	}
+	config := files["Metadata/Slic3r_PE_model.config"]
+	if !strings.Contains(config, "key=\"extruder\" value=\"2\"") || strings.Count(config, "<volume ") != 2 {
+		t.Error("FAIL 3mf volumes")
+	}
+	var m struct {
+		Objects []struct {
+			ID string `xml:"id,attr"`
+		} `xml:"resources>object"`
+	}
+	if err := xml.Unmarshal([]byte(model), &m); err != nil || len(m.Objects) != 1 {
+		t.Errorf("FAIL 3mf xml %v", err)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_EncodeAMF(t *testing.T) {
+	k := &AMFParms{
+		Unit:     "inch",
+		Metadata: map[string]string{"name": "nut & bolt"},
+		Objects: []AMFObject{
+			NewAMFObject("box", Box3D(V3{1, 1, 1}, 0), 10),
+			{Name: "sphere", Mesh: GenerateTriangles(Sphere3D(1), 10), Metadata: map[string]string{"material": "PETG"}},
+		},
+		Constellation: []AMFInstance{
+			{Object: 0},
+			{Object: 1, Position: V3{5, 0, 0}, Rotation: V3{0, 0, Pi / 2}},
+			{Object: 1, Position: V3{10, 0, 0}},
+		},
+	}
+	var b bytes.Buffer
+	if err := EncodeAMF(&b, k); err != nil {
+		t.Fatal(err)
+	}
+	var amf struct {
+		Unit     string `xml:"unit,attr"`
+		Metadata []struct {
+			Type  string `xml:"type,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"metadata"`
+		Objects []struct {
+			ID       int `xml:"id,attr"`
+			Metadata []struct {
+				Type  string `xml:"type,attr"`
+				Value string `xml:",chardata"`
+			} `xml:"metadata"`
+			Vertices  []struct{ X, Y, Z float64 } `xml:"mesh>vertices>vertex>coordinates"`
+			Triangles []struct{ V1, V2, V3 int }  `xml:"mesh>volume>triangle"`
+		} `xml:"object"`
+		Instances []struct {
+			ObjectID int     `xml:"objectid,attr"`
+			DeltaX   float64 `xml:"deltax"`
+			RZ       float64 `xml:"rz"`
+		} `xml:"constellation>instance"`
+	}
+	if err := xml.Unmarshal(b.Bytes(), &amf); err != nil {
+		t.Fatal(err)
+	}
+	if amf.Unit != "inch" || len(amf.Metadata) != 1 || amf.Metadata[0].Value != "nut & bolt" {
+		t.Error("FAIL document metadata")
+	}
+	if len(amf.Objects) != 2 {
+		t.Fatalf("FAIL %d objects", len(amf.Objects))
+	}
+	for i, o := range amf.Objects {
+		if o.ID != i || len(o.Triangles) != len(k.Objects[i].Mesh) {
+			t.Errorf("FAIL object %d", i)
+		}
+		for _, f := range o.Triangles {
+			if f.V1 >= len(o.Vertices) || f.V2 >= len(o.Vertices) || f.V3 >= len(o.Vertices) {
+				t.Errorf("FAIL object %d vertex index", i)
+				break
+			}
+		}
+	}
+	if len(amf.Objects[1].Metadata) != 2 || amf.Objects[1].Metadata[1].Value != "sphere" {
+		t.Error("FAIL object metadata")
+	}
+	if len(amf.Instances) != 3 || amf.Instances[1].ObjectID != 1 || amf.Instances[1].DeltaX != 5 || !EqualFloat64(amf.Instances[1].RZ, 90, tolerance) {
+		t.Error("FAIL constellation")
+	}
+
+	// errors
+	if EncodeAMF(&b, &AMFParms{Unit: "cubit", Objects: k.Objects}) == nil {
+		t.Error("FAIL expected unit error")
+	}
+	if EncodeAMF(&b, &AMFParms{Objects: k.Objects, Constellation: []AMFInstance{{Object: 2}}}) == nil {
+		t.Error("FAIL expected instance error")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_EncodePLY(t *testing.T) {
+	s := Sphere3D(10)
+	mesh := GenerateTriangles(s, 20)
+	red := func(p V3) color.RGBA { return color.RGBA{0xff, 0, 0, 0xff} }
+	var b bytes.Buffer
+	if err := EncodePLY(&b, mesh, &PLYParms{Normals: s, Color: red}); err != nil {
+		t.Fatal(err)
+	}
+	// header
+	data := b.Bytes()
+	end := bytes.Index(data, []byte("end_header\n"))
+	if end < 0 || !bytes.HasPrefix(data, []byte("ply\nformat binary_little_endian 1.0\n")) {
+		t.Fatal("FAIL header")
+	}
+	var nv, nf int
+	for _, line := range strings.Split(string(data[:end]), "\n") {
+		fmt.Sscanf(line, "element vertex %d", &nv)
+		fmt.Sscanf(line, "element face %d", &nf)
+	}
+	if nf != len(mesh) || nv == 0 {
+		t.Fatalf("FAIL %d vertices %d faces", nv, nf)
+	}
+	body := data[end+len("end_header\n"):]
+	if len(body) != nv*28+nf*13 {
+		t.Fatalf("FAIL body size %d", len(body))
+	}
+	// vertex normals are the sphere normals
+	for i := 0; i < nv; i++ {
+		var v struct {
+			P, N [3]float32
+			C    [4]uint8
+		}
+		binary.Read(bytes.NewReader(body[i*28:]), binary.LittleEndian, &v)
+		p := V3{float64(v.P[0]), float64(v.P[1]), float64(v.P[2])}
+		n := V3{float64(v.N[0]), float64(v.N[1]), float64(v.N[2])}
+		if n.Sub(p.Normalize()).Length() > 1e-3 || v.C != [4]uint8{0xff, 0, 0, 0xff} {
+			t.Errorf("FAIL vertex %d", i)
+			break
+		}
+	}
+	// faces
+	for i := 0; i < nf; i++ {
+		f := body[nv*28+i*13:]
+		if f[0] != 3 || binary.LittleEndian.Uint32(f[1:]) >= uint32(nv) {
+			t.Errorf("FAIL face %d", i)
+			break
+		}
+	}
+	// positions only
+	b.Reset()
+	if err := EncodePLY(&b, mesh, &PLYParms{}); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b.Bytes(), []byte("property float nx")) || bytes.Contains(b.Bytes(), []byte("property uchar red")) {
+		t.Error("FAIL optional properties")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_SliceLayers(t *testing.T) {
+	// a tube: outer and inner walls
+	s := Difference3D(Cylinder3D(4, 10, 0), Cylinder3D(5, 5, 0))
+	k := DefaultSlicerParms()
+	k.Resolution = 0.2
+	layers, err := SliceLayers(s, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layers) != 20 {
+		t.Fatalf("FAIL %d layers", len(layers))
+	}
+	for i, l := range layers {
+		if !EqualFloat64(l.Z, float64(i+1)*0.2, tolerance) {
+			t.Errorf("FAIL layer %d z %g", i, l.Z)
+		}
+		// outer and inner wall for each perimeter
+		if len(l.Perimeters) != 2*k.Perimeters {
+			t.Errorf("FAIL layer %d has %d perimeters", i, len(l.Perimeters))
+		}
+		if len(l.Infill) == 0 {
+			t.Errorf("FAIL layer %d has no infill", i)
+		}
+		// the infill is inside the walls
+		for _, line := range l.Infill {
+			for _, p := range line {
+				r := p.Length()
+				if r < 5 || r > 10 {
+					t.Errorf("FAIL layer %d infill at r = %g", i, r)
+				}
+			}
+		}
+	}
+	// the outer perimeter is half a line width inside the wall
+	outer := layers[0].Perimeters[len(layers[0].Perimeters)-1]
+	for _, p := range outer {
+		if r := p.Length(); Abs(r-9.8) > 0.05 && Abs(r-5.2) > 0.05 {
+			t.Errorf("FAIL outer perimeter at r = %g", r)
+			break
+		}
+	}
+	// solid layers have more infill
+	if len(layers[0].Infill) <= len(layers[10].Infill) {
+		t.Error("FAIL solid layer infill")
+	}
+
+	var b bytes.Buffer
+	if err := EncodeGCode(&b, layers, s.BoundingBox(), k); err != nil {
+		t.Fatal(err)
+	}
+	gcode := b.String()
+	if strings.Count(gcode, "\nG1 Z") != 21 || !strings.Contains(gcode, "M109 S210\n") {
+		t.Error("FAIL gcode layers")
+	}
+	// extrusion is increasing and the model is centered on the bed
+	e := 0.0
+	for _, line := range strings.Split(gcode, "\n") {
+		var x, y, ex, f float64
+		if n, _ := fmt.Sscanf(line, "G1 X%f Y%f E%f F%f", &x, &y, &ex, &f); n == 4 {
+			if ex <= e || (V2{x, y}).Sub(V2{100, 100}).Length() > 10.01 {
+				t.Errorf("FAIL %s", line)
+				break
+			}
+			e = ex
+		}
+	}
+	// filament used is about the volume of the part
+	r := 0.5 * k.FilamentDiameter
+	volume := e * Pi * r * r
+	if volume < 0.5*Pi*(100-25)*4 || volume > 1.2*Pi*(100-25)*4 {
+		t.Errorf("FAIL filament volume %g", volume)
+	}
+
+	if _, err := SliceLayers(s, &SlicerParms{}); err == nil {
+		t.Error("FAIL expected an error")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_MillToolpath(t *testing.T) {
+	s := Box2D(V2{20, 20}, 0)
+	k := &MillParms{
+		ToolDiameter: 4,
+		Stepover:     0.5,
+		Depth:        3,
+		StepDown:     1,
+		SafeZ:        5,
+		FeedRate:     600,
+		PlungeRate:   200,
+		SpindleSpeed: 10000,
+	}
+
+	// pocket loops at 2, 4, 6, 8 from the boundary (middle first)
+	loops, err := PocketToolpath(s, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loops) != 4 {
+		t.Fatalf("FAIL %d pocket loops", len(loops))
+	}
+	for i, loop := range loops {
+		x := 0.0
+		for _, p := range loop {
+			x = Max(x, Abs(p.X))
+		}
+		if Abs(x-float64(2+2*i)) > 0.1 {
+			t.Errorf("FAIL pocket loop %d at %g", i, x)
+		}
+		// climb milling: the pocket loops are counter-clockwise
+		if signedArea(loop) <= 0 {
+			t.Errorf("FAIL pocket loop %d direction", i)
+		}
+	}
+
+	// outside profile: clockwise for climb milling
+	loops, err = ProfileToolpath(s, k, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loops) != 1 || signedArea(loops[0]) >= 0 {
+		t.Fatal("FAIL outside profile")
+	}
+	for _, p := range loops[0] {
+		if d := s.Evaluate(p); Abs(d-2) > 0.05 {
+			t.Errorf("FAIL outside profile distance %g", d)
+			break
+		}
+	}
+	// inside profile, conventional milling: clockwise
+	k.Direction = MillConventional
+	loops, err = ProfileToolpath(s, k, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loops) != 1 || signedArea(loops[0]) >= 0 || Abs(s.Evaluate(loops[0][0])+2) > 0.05 {
+		t.Error("FAIL inside profile")
+	}
+
+	// 3 depth passes
+	var b bytes.Buffer
+	if err := EncodeMillGCode(&b, loops, k); err != nil {
+		t.Fatal(err)
+	}
+	gcode := b.String()
+	for _, z := range []string{"G1 Z-1.000", "G1 Z-2.000", "G1 Z-3.000"} {
+		if strings.Count(gcode, z) != 1 {
+			t.Errorf("FAIL no %s", z)
+		}
+	}
+	if !strings.Contains(gcode, "M3 S10000\n") || !strings.HasSuffix(gcode, "M5\nM2\n") {
+		t.Error("FAIL spindle commands")
+	}
+
+	// the tool is too big
+	k.ToolDiameter = 25
+	if _, err := PocketToolpath(s, k); err == nil {
+		t.Error("FAIL expected an error")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_JoinLines(t *testing.T) {
+	// segments of a square loop (side 2a, centered on the origin)
+	square := func(a float64, ccw bool) []*Line {
+		v := []V2{{-a, -a}, {a, -a}, {a, a}, {-a, a}}
+		var lines []*Line
+		for i := range v {
+			l := &Line{v[i], v[(i+1)%4]}
+			if !ccw {
+				l = &Line{l[1], l[0]}
+			}
+			// split each side in two
+			m := l[0].Add(l[1]).MulScalar(0.5)
+			lines = append(lines, &Line{l[0], m}, &Line{m, l[1]})
+		}
+		return lines
+	}
+	// an outer square, a hole and an island in the hole
+	var lines []*Line
+	lines = append(lines, square(10, false)...)
+	lines = append(lines, square(6, true)...)
+	lines = append(lines, square(2, false)...)
+	// jitter the end points and shuffle the segments
+	rng := rand.New(rand.NewSource(1))
+	for _, l := range lines {
+		for i := range l {
+			l[i] = l[i].Add(V2{rng.Float64() - 0.5, rng.Float64() - 0.5}.MulScalar(1e-6))
+		}
+	}
+	rng.Shuffle(len(lines), func(i, j int) { lines[i], lines[j] = lines[j], lines[i] })
+
+	polygons := JoinLines(lines, 1e-5)
+	if len(polygons) != 2 {
+		t.Fatalf("FAIL %d polygons", len(polygons))
+	}
+	outer, island := polygons[0], polygons[1]
+	if len(outer.Outer) != 8 || len(outer.Holes) != 1 || len(outer.Holes[0]) != 8 || len(island.Holes) != 0 {
+		t.Error("FAIL polygon loops")
+	}
+	if !EqualFloat64(signedArea(outer.Outer), 400, 1e-3) || !EqualFloat64(signedArea(outer.Holes[0]), -144, 1e-3) || !EqualFloat64(signedArea(island.Outer), 16, 1e-3) {
+		t.Error("FAIL polygon orientation")
+	}
+	// without a tolerance the jittered end points don't join
+	if len(JoinLines(lines, 0)) == 2 {
+		t.Error("FAIL expected broken loops")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_SimplifyLines(t *testing.T) {
+	// collinear points
+	v := V2Set{{0, 0}, {1, 0}, {2, 0.001}, {3, 0}, {4, 1}}
+	if len(SimplifyPolyline(v, 0.01)) != 3 || len(SimplifyPolyline(v, 0.0008)) != 4 {
+		t.Error("FAIL polyline")
+	}
+	// a box is 4 lines (once the corners cut by marching squares are in tolerance)
+	s := Box2D(V2{10, 6}, 0)
+	lines := GenerateLines(s, 200)
+	simple := SimplifyLines(lines, 0.05)
+	if len(simple) != 4 {
+		t.Errorf("FAIL %d box lines", len(simple))
+	}
+	// a circle within tolerance
+	c := Circle2D(5)
+	lines = GenerateLines(c, 400)
+	tolerance := 0.02
+	simple = SimplifyLines(lines, tolerance)
+	if len(simple) >= len(lines)/10 || len(simple) < 8 {
+		t.Errorf("FAIL %d of %d circle lines", len(simple), len(lines))
+	}
+	for _, l := range simple {
+		for _, p := range []V2{l[0], l[1], l[0].Add(l[1]).MulScalar(0.5)} {
+			if math.Abs(c.Evaluate(p)) > tolerance+0.01 {
+				t.Errorf("FAIL circle distance %f", c.Evaluate(p))
+			}
+		}
+	}
+	// contour tree loops keep their orientation
+	tree := GenerateContours(Difference2D(s, Circle2D(2)), 200)
+	tree.Simplify(0.05)
+	if len(tree.Roots) != 1 || len(tree.Roots[0].Points) != 4 || signedArea(tree.Roots[0].Children[0].Points) >= 0 {
+		t.Error("FAIL contour tree")
+	}
+	// a loop thinner than the tolerance collapses
+	if SimplifyLoop(V2Set{{0, 0}, {1, 0}, {2, 0.001}}, 0.01) != nil {
+		t.Error("FAIL expected collapse")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// counterSDF2 counts the evaluations of an SDF2.
+type counterSDF2 struct {
+	SDF2
+	n int
+}
+
+func (s *counterSDF2) Evaluate(p V2) float64 {
+	s.n++
+	return s.SDF2.Evaluate(p)
+}
+
+func Test_MarchingSquaresQuadtree(t *testing.T) {
+	// small circles in a large, mostly empty box
+	s := Union2D(Circle2D(1), Transform2D(Circle2D(1), Translate2d(V2{50, 30})))
+	resolution := 0.05
+
+	c0 := &counterSDF2{SDF2: s}
+	lines0 := marchingSquares(c0, c0.BoundingBox(), resolution)
+
+	c1 := &counterSDF2{SDF2: s}
+	output := make(chan *Line)
+	var lines1 []*Line
+	done := make(chan bool)
+	go func() {
+		for l := range output {
+			lines1 = append(lines1, l)
+		}
+		done <- true
+	}()
+	marchingSquaresQuadtree(c1, resolution, output)
+	close(output)
+	<-done
+
+	if c1.n*20 > c0.n {
+		t.Errorf("FAIL %d quadtree evaluations, %d uniform evaluations", c1.n, c0.n)
+	}
+	// the same boundary
+	length := func(lines []*Line) float64 {
+		var l float64
+		for _, x := range lines {
+			l += x[1].Sub(x[0]).Length()
+		}
+		return l
+	}
+	if !EqualFloat64(length(lines0), 4*Pi, 0.01) || !EqualFloat64(length(lines1), 4*Pi, 0.01) {
+		t.Errorf("FAIL boundary length %f %f", length(lines0), length(lines1))
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_BufferPools(t *testing.T) {
+	// reused buffers give the same results
+	s := Sphere3D(1)
+	bb := s.BoundingBox().ScaleAboutCenter(1.1)
+	m0 := marchingCubes(s, bb, 0.1)
+	m1 := marchingCubes(s, bb, 0.1)
+	if len(m0) == 0 || len(m0) != len(m1) {
+		t.Fatal("FAIL")
+	}
+	for i := range m0 {
+		if *m0[i] != *m1[i] {
+			t.Fatal("FAIL")
+		}
+	}
+	// a pooled buffer of the wrong size isn't used
+	putFloat64s(make([]float64, 10))
+	if x := getFloat64s(20); len(x) != 20 {
+		t.Error("FAIL")
+	}
+	if x := getV3Batch(); len(x) != 0 || cap(x) < evalBatchSize {
+		t.Error("FAIL")
+	}
+	// the estimates are about right for a sphere
+	n := estimateTriangles(bb, 0.1)
+	if len(m0) > 2*n || len(m0) < n/2 {
+		t.Errorf("FAIL %d triangles, %d estimated", len(m0), n)
+	}
+	l := len(GenerateLines(Circle2D(1), 100))
+	n = estimateLines(Circle2D(1).BoundingBox(), 0.02)
+	if l > 2*n || l < n/2 {
+		t.Errorf("FAIL %d lines, %d estimated", l, n)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_EvaluateN(t *testing.T) {
+	box := Box3D(V3{2, 3, 4}, 0.2)
+	sphere := Sphere3D(1.5)
+	cylinder := Cylinder3D(5, 0.5, 0.1)
+	blend := Union3D(box, Transform3D(sphere, Translate3d(V3{1, 0, 0})))
+	blend.(*UnionSDF3).SetMin(PolyMin(0.3))
+	s3 := []SDF3{
+		box, sphere, cylinder, blend,
+		Difference3D(box, cylinder),
+		Intersect3D(ScaleUniform3D(sphere, 1.5), box),
+		Offset3D(Union3D(box, cylinder, Pill3D(6, 0.3)), 0.2),
+		Tag3D(Transform3D(Difference3D(box, Torus3D(1.2, 0.3)), RotateX(0.5)), 1),
+	}
+	for i, s := range s3 {
+		bb := s.BoundingBox().ScaleAboutCenter(1.5)
+		points := bb.RandomSet(257)
+		out := make([]float64, len(points))
+		EvaluateN(s, points, out)
+		for j, p := range points {
+			if out[j] != s.Evaluate(p) {
+				t.Errorf("FAIL sdf3 %d", i)
+				break
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_GLSL(t *testing.T) {
+	if glslFloat(2) != "2.0" || glslFloat(-0.5) != "-0.5" || glslFloat(1e-20) != "1e-20" {
+		t.Error("FAIL float literals")
+	}
+	if glslFloat(math.Inf(1)) != "uintBitsToFloat(0x7f800000u)" || glslFloat(math.NaN()) != "uintBitsToFloat(0x7fc00000u)" {
+		t.Error("FAIL float literals")
+	}
+	box := Box3D(V3{2, 3, 4}, 0.2)
+	s := Difference3D(Union3D(box, Transform3D(Sphere3D(1.5), Translate3d(V3{1, 0, 0}))), Cylinder3D(5, 0.5, 0))
+	src, err := GLSLComputeShader(Tag3D(Offset3D(s, 0.1), 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, x := range []string{
+		"#version 430",
+		"float sdf(vec3 p) {",
+		"sdfBox3d(p, vec3(0.8, 1.3, 1.8)) - 0.2",
+		"mat3(1.0, 0.0, 0.0, 0.0, 1.0, 0.0, 0.0, 0.0, 1.0) * p + vec3(-1.0, 0.0, 0.0)",
+		"length(v1) - 1.5",
+		"min(v0, v3)",
+		"max(v4, -v5)",
+		"v6 - 0.1",
+		"return v7;",
+		"void main() {",
+	} {
+		if !strings.Contains(src, x) {
+			t.Errorf("FAIL missing %q", x)
+		}
+	}
+	// unsupported SDF3s are evaluated on the cpu
+	if _, err := GLSL(Union3D(box, Torus3D(2, 0.5))); err == nil {
+		t.Error("FAIL expected error for torus")
+	}
+	blend := Union3D(box, Sphere3D(2))
+	blend.(*UnionSDF3).SetMin(PolyMin(0.3))
+	if _, err := GLSL(blend); err == nil {
+		t.Error("FAIL expected error for blended union")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// testGrid is a grid evaluator that evaluates the grid on the CPU.
+type testGrid struct {
+	calls int  // number of grids evaluated
+	fail  bool // return an error
+}
+
+func (g *testGrid) EvaluateGrid(s SDF3, base, inc V3, steps V3i, out []float64) error {
+	g.calls++
+	if g.fail {
+		return errors.New("no gpu")
+	}
+	i := 0
+	for x := 0; x <= steps[0]; x++ {
+		for y := 0; y <= steps[1]; y++ {
+			for z := 0; z <= steps[2]; z++ {
+				out[i] = s.Evaluate(base.Add(V3{float64(x), float64(y), float64(z)}.Mul(inc)))
+				i++
+			}
+		}
+	}
+	return nil
+}
+
+func Test_GenerateTrianglesGrid(t *testing.T) {
+	s := Difference3D(Box3D(V3{2, 3, 4}, 0.2), Sphere3D(1.5))
+	m0 := GenerateTrianglesGrid(s, 30, nil)
+	// the grid evaluator is used for each layer
+	g := &testGrid{}
+	m1 := GenerateTrianglesGrid(s, 30, g)
+	_, _, cells := uniformGrid(s, 30)
+	if g.calls != cells[0]+1 || len(m1) != len(m0) {
+		t.Errorf("FAIL %d calls, %d triangles (expected %d, %d)", g.calls, len(m1), cells[0]+1, len(m0))
+	}
+	for i := range m0 {
+		for j := range m0[i].V {
+			if !m0[i].V[j].Equals(m1[i].V[j], tolerance) {
+				t.Fatal("FAIL")
+			}
+		}
+	}
+	// a failing grid evaluator falls back to the cpu
+	g = &testGrid{fail: true}
+	m1 = GenerateTrianglesGrid(s, 30, g)
+	if g.calls != 1 || len(m1) != len(m0) {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Compile3D(t *testing.T) {
+	box := Box3D(V3{2, 3, 4}, 0.2)
+	sphere := Sphere3D(1.5)
+	cylinder := Cylinder3D(5, 0.5, 0.1)
+	blend := Union3D(box, Transform3D(sphere, Translate3d(V3{1, 0, 0})))
+	blend.(*UnionSDF3).SetMin(PolyMin(0.3))
+	s3 := []SDF3{
+		blend,
+		Difference3D(box, cylinder),
+		Intersect3D(ScaleUniform3D(sphere, 1.5), box),
+		Offset3D(Union3D(box, cylinder, Pill3D(6, 0.3)), 0.2),
+		Tag3D(Transform3D(Difference3D(box, Torus3D(1.2, 0.3)), RotateX(0.5)), 1),
+		Difference3D(Transform3D(Union3D(box, Transform3D(cylinder, RotateY(0.3))), Scale3d(V3{2, 2, 2})), Intersect3D(sphere, Offset3D(box, -0.2))),
+	}
+	for i, s := range s3 {
+		c, _ := vmCompile(s)
+		if c == nil {
+			t.Errorf("FAIL sdf3 %d not compiled", i)
+			continue
+		}
+		if c.BoundingBox() != s.BoundingBox() || TagAt(c, V3{}) != TagAt(s, V3{}) {
+			t.Errorf("FAIL sdf3 %d", i)
+		}
+		bb := s.BoundingBox().ScaleAboutCenter(1.5)
+		for _, p := range bb.RandomSet(500) {
+			if c.Evaluate(p) != s.Evaluate(p) {
+				t.Errorf("FAIL sdf3 %d distance", i)
+				break
+			}
+		}
+	}
+	// a union of translated primitives is compiled
+	var balls []SDF3
+	for i := 0; i < 20; i++ {
+		balls = append(balls, Transform3D(Sphere3D(0.5), Translate3d(V3{float64(i), 0, 0})))
+	}
+	s := Union3D(balls...)
+	if _, ok := Compile3D(s).(*CompiledSDF3); !ok {
+		t.Error("FAIL balls")
+	}
+	// nothing to gain
+	torus := Torus3D(1, 0.2)
+	if Compile3D(torus) != torus {
+		t.Error("FAIL torus")
+	}
+	// too deep for the stacks
+	s = Union3D(box, sphere)
+	for i := 0; i < vmStackSize+2; i++ {
+		s = Transform3D(s, RotateZ(0.1))
+	}
+	if c, _ := vmCompile(s); c != nil {
+		t.Error("FAIL deep tree")
+	}
+	// no allocations
+	c, _ := vmCompile(s3[4])
+	if n := testing.AllocsPerRun(100, func() { c.Evaluate(V3{1, 2, 3}) }); n != 0 {
+		t.Errorf("FAIL %f allocations", n)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// stretchedSDF3 is an SDF3 with a distance bound that overestimates the distance.
+type stretchedSDF3 struct {
+	SDF3
+	k float64
+}
+
+func (s *stretchedSDF3) Evaluate(p V3) float64 {
+	return s.k * s.SDF3.Evaluate(p)
+}
+
+func Test_Lipschitz(t *testing.T) {
+	// reported bounds
+	box := Box3D(V3{4, 6, 8}, 0.5)
+	if LipschitzK3(box) != 1 {
+		t.Error("FAIL")
+	}
+	stretched := Lipschitz3D(&stretchedSDF3{Sphere3D(2), 3}, 3)
+	if LipschitzK3(Union3D(box, Transform3D(stretched, Translate3d(V3{5, 0, 0})))) != 3 {
+		t.Error("FAIL")
+	}
+	if LipschitzK3(Difference3D(box, ScaleNonUniform3D(stretched, V3{1, 2, 3}))) != 3 {
+		t.Error("FAIL")
+	}
+	if k := LipschitzK2(Transform2D(Box2D(V2{2, 2}, 0), Scale2d(V2{2, 0.25}))); Abs(k-4) > tolerance {
+		t.Errorf("FAIL k %f, expected 4", k)
+	}
+	// the deformations have the bound of the deformed SDF3
+	deformed := []SDF3{
+		ScaleNonUniform3D(box, V3{0.5, 2, 3}),
+		Transform3D(box, Scale3d(V3{3, 1, 0.25}).Mul(RotateX(0.3))),
+		Twist3D(box, 0.4),
+		Bend3D(box, 0.05),
+	}
+	// the bend is a bound (not a true SDF) inside its minimum radius
+	inside := func(s SDF3, p V3) bool {
+		if bend, ok := s.(*BendSDF3); ok {
+			return (V2{p.X, bend.r - bend.sign*p.Y}).Length() < bend.rmin
+		}
+		return false
+	}
+	for i, s := range deformed {
+		k := LipschitzK3(s)
+		bb := s.BoundingBox().ScaleAboutCenter(1.5)
+		for j := 0; j < 10000; j++ {
+			a := bb.Random()
+			b := a.Add(V3{rand.NormFloat64(), rand.NormFloat64(), rand.NormFloat64()}.MulScalar(0.1))
+			if inside(s, a) || inside(s, b) {
+				continue
+			}
+			if Abs(s.Evaluate(a)-s.Evaluate(b)) > k*a.Sub(b).Length()*1.001 {
+				t.Errorf("FAIL %d: bound %f exceeded at %v", i, k, a)
+				break
+			}
+		}
+	}
+	// the mesher doesn't prune the surface of an SDF3 with a large bound
+	sphere := Sphere3D(10)
+	n := len(GenerateTriangles(sphere, 50))
+	if m := len(GenerateTriangles(Lipschitz3D(&stretchedSDF3{sphere, 4}, 4), 50)); m != n {
+		t.Errorf("FAIL %d triangles, expected %d", m, n)
+	}
+	if m := len(GenerateTriangles(&stretchedSDF3{sphere, 4}, 50)); m >= n {
+		t.Errorf("FAIL %d triangles, expected pruned triangles", m)
+	}
+	// the raytracer doesn't step through the surface
+	o := DefaultRenderOptions(sphere)
+	tr := tracer{s: Lipschitz3D(&stretchedSDF3{sphere, 4}, 4), k: 4, o: o, bb: sphere.BoundingBox(), pixelAngle: 1e-4}
+	x, hit := tr.march(V3{-20, 0, 0}, V3{1, 0, 0})
+	if !hit || Abs(x-10) > 1e-3 {
+		t.Errorf("FAIL hit %v at %f, expected 10", hit, x)
+	}
+	// the warped extrusions have a bound within their bounding boxes
+	profile := Box2D(V2{6, 3}, 0.5)
+	warped := []SDF3{
+		TwistExtrude3D(profile, 4, 3),
+		ScaleExtrude3D(profile, 4, V2{0.2, 1.5}),
+		ScaleTwistExtrude3D(profile, 4, 3, V2{0.2, 1.5}),
+		Loft3D(profile, Circle2D(1), 2, 0),
+	}
+	for i, s := range warped {
+		k := LipschitzK3(s)
+		if k <= 1 || math.IsInf(k, 1) {
+			t.Errorf("FAIL %d: bound %f", i, k)
+		}
+		bb := s.BoundingBox()
+		for j := 0; j < 10000; j++ {
+			a, b := bb.Random(), bb.Random()
+			b = a.Add(b.Sub(a).MulScalar(0.05))
+			if Abs(s.Evaluate(a)-s.Evaluate(b)) > k*a.Sub(b).Length()*1.001 {
+				t.Errorf("FAIL %d: bound %f exceeded at %v", i, k, a)
+				break
+			}
+		}
+	}
+	// a user defined extrusion and a screw have no bound
+	extrude := Extrude3D(profile, 4)
+	extrude.(*ExtrudeSDF3).SetExtrude(TwistExtrude(4, 3))
+	screw := Screw3D(ISOThread(5, 1, "external"), 10, 1, 1)
+	if !math.IsInf(LipschitzK3(extrude), 1) || !math.IsInf(LipschitzK3(Union3D(box, screw)), 1) {
+		t.Error("FAIL")
+	}
+	// the raytracer takes fixed steps
+	tr = tracer{s: screw, k: LipschitzK3(screw), o: o, bb: screw.BoundingBox(), pixelAngle: 1e-4}
+	x, hit = tr.march(V3{-20, 0, 0}, V3{1, 0, 0})
+	if !hit || Abs(screw.Evaluate(V3{-20 + x, 0, 0})) > 1e-3 {
+		t.Errorf("FAIL hit %v at %f", hit, x)
+	}
+}
+
+func Test_ScrewInterval(t *testing.T) {
+	screw := Screw3D(ISOThread(5, 1, "external"), 10, 1, 2)
+	bb := screw.BoundingBox().ScaleAboutCenter(1.2)
+	for i := 0; i < 2000; i++ {
+		c := bb.Random()
+		b := NewBox3(c, V3{rand.Float64(), rand.Float64(), rand.Float64()}.MulScalar(2))
+		d := EvaluateInterval3(screw, b)
+		for j := 0; j < 20; j++ {
+			if x := screw.Evaluate(b.Random()); !d.Contains(x) {
+				t.Fatalf("FAIL %f not in %v", x, d)
+			}
+		}
+	}
+	// the octree mesher prunes using the intervals (without losing triangles)
+	n := len(GenerateTriangles(Lipschitz3D(screw, math.Inf(1)), 50))
+	if m := len(GenerateTriangles(screw, 50)); m != n {
+		t.Errorf("FAIL %d triangles, expected %d", m, n)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_EdgedCylinder3D(t *testing.T) {
+	h, r := 10.0, 4.0
+	round := CylinderEdge{EdgeRound, 1.5}
+	chamfer := CylinderEdge{EdgeChamfer, 1.5}
+	square := CylinderEdge{EdgeSquare, 3}
+	// the same edges at both ends
+	test := []struct {
+		s0, s1 SDF3
+	}{
+		{EdgedCylinder3D(h, r, round, round), Cylinder3D(h, r, 1.5)},
+		{EdgedCylinder3D(h, r, square, square), Cylinder3D(h, r, 0)},
+		{EdgedCylinder3D(h, r, chamfer, chamfer), Revolve3D(ChamferBox2D(V2{2 * r, h}, 1.5))},
+	}
+	for i, x := range test {
+		bb := x.s1.BoundingBox().ScaleAboutCenter(1.5)
+		for _, p := range bb.RandomSet(5000) {
+			if d0, d1 := x.s0.Evaluate(p), x.s1.Evaluate(p); Abs(d0-d1) > tolerance {
+				t.Errorf("FAIL %d: %v %f, expected %f", i, p, d0, d1)
+				break
+			}
+		}
+	}
+	// rounded bottom, chamfered top
+	s := EdgedCylinder3D(h, r, CylinderEdge{EdgeRound, 3}, CylinderEdge{EdgeChamfer, 1})
+	n := V3{1, 0, 1}.Normalize()
+	points := []struct {
+		p V3
+		d float64
+	}{
+		{V3{0, 0, 6}, 1},
+		{V3{0, 0, -7}, 2},
+		{V3{5, 0, 1}, 1},
+		{V3{0, -6, 1.5}, 2},
+		{V3{0, 0, 0}, -4},
+		{V3{3.5, 0, 4.5}.Add(n.MulScalar(0.7)), 0.7},
+		{V3{3.5, 0, 4.5}.Sub(n.MulScalar(0.2)), -0.2},
+		{V3{1, 0, -2}.Add(V3{1, 0, -1}.Normalize().MulScalar(3.5)), 0.5},
+		{V3{1, 0, -2}.Add(V3{1, 0, -1}.Normalize().MulScalar(2.5)), -0.5},
+	}
+	for _, x := range points {
+		if d := s.Evaluate(x.p); Abs(d-x.d) > tolerance {
+			t.Errorf("FAIL %v %f, expected %f", x.p, d, x.d)
+		}
+	}
+	// it's a distance field
+	bb := s.BoundingBox().ScaleAboutCenter(1.5)
+	for _, p := range bb.RandomSet(5000) {
+		q := p.Add(V3{0.1, -0.2, 0.3})
+		if Abs(s.Evaluate(p)-s.Evaluate(q)) > q.Sub(p).Length()+tolerance {
+			t.Errorf("FAIL %v", p)
+			break
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Pipe3D(t *testing.T) {
+	s0 := Pipe3D(5, 1.5, 8)
+	s1 := Revolve3D(Transform2D(Box2D(V2{1.5, 8}, 0), Translate2d(V2{4.25, 0})))
+	if !s0.BoundingBox().Equals(Box3{V3{-5, -5, -4}, V3{5, 5, 4}}, tolerance) {
+		t.Error("FAIL")
+	}
+	bb := s0.BoundingBox().ScaleAboutCenter(1.5)
+	for _, p := range bb.RandomSet(5000) {
+		if d0, d1 := s0.Evaluate(p), s1.Evaluate(p); Abs(d0-d1) > tolerance {
+			t.Errorf("FAIL %v %f, expected %f", p, d0, d1)
+			break
+		}
+	}
+}
+
+func Test_Wall2D(t *testing.T) {
+	s0 := Wall2D(Circle2D(4), 1)
+	s1 := Annulus2D(3.5, 4.5)
+	if !s0.BoundingBox().Equals(s1.BoundingBox(), tolerance) {
+		t.Error("FAIL")
+	}
+	bb := s1.BoundingBox().ScaleAboutCenter(1.5)
+	for _, p := range bb.RandomSet(5000) {
+		if d0, d1 := s0.Evaluate(p), s1.Evaluate(p); Abs(d0-d1) > tolerance {
+			t.Errorf("FAIL %v %f, expected %f", p, d0, d1)
+			break
+		}
+	}
+	// an enclosure wall
+	s2 := Wall2D(Box2D(V2{20, 10}, 2), 1)
+	if s2.Evaluate(V2{10, 0}) != -0.5 || s2.Evaluate(V2{0, 0}) != 4.5 || s2.Evaluate(V2{0, 6}) != 0.5 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_ProjectBox(t *testing.T) {
+	k := ProjectBoxParms{
+		Size:       V3{60, 40, 30},
+		Wall:       2,
+		Rounding:   4,
+		Lid:        2,
+		Lip:        3,
+		Clearance:  0.2,
+		Screw:      "M3x0.5",
+		VentSlots:  5,
+		VentWidth:  2,
+		VentLength: 20,
+	}
+	s, err := ProjectBox(&k)
+	if err != nil {
+		t.Fatalf("FAIL %s", err)
+	}
+	base, lid := s[0], s[1]
+	// the base and the lid don't overlap
+	bb := base.BoundingBox().Extend(lid.BoundingBox())
+	if !bb.Equals(Box3{V3{-30, -20, 0}, V3{30, 20, 30}}, tolerance) {
+		t.Errorf("FAIL %v", bb)
+	}
+	for _, p := range bb.RandomSet(20000) {
+		if base.Evaluate(p) < 0 && lid.Evaluate(p) < 0 {
+			t.Errorf("FAIL overlap at %v", p)
+			break
+		}
+	}
+	inside := func(s SDF3, p V3) bool {
+		return s.Evaluate(p) < 0
+	}
+	// corner boss with a pilot hole
+	boss := V3{28 - 3.5, 18 - 3.5, 20}
+	if inside(base, boss) || !inside(base, boss.Add(V3{2.5, 0, 0})) || inside(lid, boss.Add(V3{0, 0, 9})) {
+		t.Error("FAIL boss")
+	}
+	// the lid lip is inside the walls
+	if !inside(lid, V3{0, 18 - 0.2 - 1, 26}) || inside(base, V3{0, 18 - 0.2 - 1, 26}) || !inside(base, V3{0, 19, 26}) {
+		t.Error("FAIL lip")
+	}
+	// ventilation slots
+	if inside(lid, V3{0, 0, 29}) || inside(lid, V3{8, 9, 29}) || !inside(lid, V3{2, 0, 29}) || !inside(lid, V3{0, 11, 29}) {
+		t.Error("FAIL slots")
+	}
+	// bad parameters
+	k.Screw = "M3x0.6"
+	if _, err := ProjectBox(&k); err == nil {
+		t.Error("FAIL")
+	}
+	k.Screw = ""
+	k.VentSlots = 20
+	if _, err := ProjectBox(&k); err == nil {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_PCBMounts(t *testing.T) {
+	k := PCBParms{
+		Size:           V2{50, 30},
+		Thickness:      1.6,
+		Holes:          V2Set{{3.5, 3.5}, {46.5, 3.5}, {46.5, 26.5}, {3.5, 26.5}},
+		HoleDiameter:   3.2,
+		Keepout:        6,
+		Mount:          PCBSnap,
+		StandoffHeight: 5,
+		Clearance:      0.1,
+	}
+	board, err := PCBBoard3D(&k)
+	if err != nil {
+		t.Fatalf("FAIL %s", err)
+	}
+	mounts, err := PCBMounts3D(&k)
+	if err != nil {
+		t.Fatalf("FAIL %s", err)
+	}
+	// the board and the mounts don't overlap
+	bb := board.BoundingBox().Extend(mounts.BoundingBox())
+	for _, p := range bb.RandomSet(20000) {
+		if board.Evaluate(p) < 0 && mounts.Evaluate(p) < 0 {
+			t.Errorf("FAIL overlap at %v", p)
+			break
+		}
+	}
+	// the barb clips over the top of the board, the pin is split
+	z1 := 5 + 1.6
+	if mounts.Evaluate(V3{46.5 + 1.74, 26.5, z1 + 0.05}) >= 0 || board.Evaluate(V3{46.5 + 1.74, 26.5, z1 - 0.05}) >= 0 {
+		t.Error("FAIL barb")
+	}
+	if mounts.Evaluate(V3{46.5, 26.5, z1 + 0.5}) <= 0 || mounts.Evaluate(V3{46.5, 26.5, 4}) >= 0 {
+		t.Error("FAIL slot")
+	}
+	// screw mounts have a pilot hole
+	k.Mount = PCBScrew
+	k.Screw = "M3x0.5"
+	s, err := PCBStandoff3D(&k)
+	if err != nil {
+		t.Fatalf("FAIL %s", err)
+	}
+	if s.Evaluate(V3{0, 0, 4}) <= 0 || s.Evaluate(V3{2, 0, 4}) >= 0 || s.Evaluate(V3{0, 0, 0.5}) >= 0 {
+		t.Error("FAIL pilot hole")
+	}
+	// gussets around the standoff base
+	k.Webs = 4
+	s, err = PCBStandoff3D(&k)
+	if err != nil {
+		t.Fatalf("FAIL %s", err)
+	}
+	if s.Evaluate(V3{4, 0, 0.5}) >= 0 || s.Evaluate(V3{4, 4, 0.5}) <= 0 || s.Evaluate(V3{4, 0, 3}) <= 0 {
+		t.Error("FAIL webs")
+	}
+	k.Webs = 0
+	// outline and keepouts
+	outline, _ := PCBOutline2D(&k)
+	keepout, _ := PCBKeepout2D(&k)
+	if outline.Evaluate(V2{25, 15}) >= 0 || outline.Evaluate(V2{3.5, 3.5}) <= 0 || keepout.Evaluate(V2{3.5, 3.5}) != -3 {
+		t.Error("FAIL outline")
+	}
+	// bad parameters
+	k.Holes = append(k.Holes, V2{60, 10})
+	if _, err := PCBMounts3D(&k); err == nil {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Textures(t *testing.T) {
+	// check a distance bound at random pairs of points
+	isBound := func(s SDF3) bool {
+		bb := s.BoundingBox().ScaleAboutCenter(1.2)
+		for _, a := range bb.RandomSet(20000) {
+			b := a.Add(V3{rand.NormFloat64(), rand.NormFloat64(), rand.NormFloat64()}.MulScalar(0.05))
+			if Abs(s.Evaluate(a)-s.Evaluate(b)) > a.Sub(b).Length()*1.001 {
+				return false
+			}
+		}
+		return true
+	}
+	cylinder := Cylinder3D(20, 10, 0)
+	straight := ImpressKnurl3D(cylinder, &KnurlParms{Pattern: KnurlStraight, Radius: 10, Pitch: 2, Depth: 0.5})
+	// a groove at angle 0, the next groove is 1/31 of a turn
+	a := 0.5 * Tau / 31
+	if straight.Evaluate(V3{9.9, 0, 3}) <= 0 || straight.Evaluate(V3{9.4, 0, 3}) >= 0 ||
+		straight.Evaluate(V3{9.9 * math.Cos(a), 9.9 * math.Sin(a), 3}) >= 0 {
+		t.Error("FAIL straight knurl")
+	}
+	if !isBound(straight) {
+		t.Error("FAIL straight knurl bound")
+	}
+	diamond := ImpressKnurl3D(cylinder, &KnurlParms{Pattern: KnurlDiamond, Radius: 10, Pitch: 2, Depth: 0.5})
+	if diamond.Evaluate(V3{9.9, 0, 0}) <= 0 || diamond.Evaluate(V3{0, 0, 0}) >= 0 || !isBound(diamond) {
+		t.Error("FAIL diamond knurl")
+	}
+	// displaced sphere
+	sphere := Sphere3D(10)
+	fn := func(p V3) float64 {
+		return 0.5 * math.Sin(2*p.X) * math.Sin(2*p.Y)
+	}
+	s := Displace3D(sphere, fn, 0.5)
+	if !isBound(s) || LipschitzK3(s) != 1 {
+		t.Error("FAIL displace bound")
+	}
+	bb := s.BoundingBox()
+	for _, p := range bb.RandomSet(1000) {
+		d0, d1 := s.Evaluate(p), sphere.Evaluate(p)-fn(p)
+		if (d0 < 0) != (d1 < 0) || Abs(d0) > Abs(d1)+tolerance || d0 < sphere.Evaluate(p)-0.5 {
+			t.Errorf("FAIL %v %f, expected %f", p, d0, d1)
+			break
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_TPMS(t *testing.T) {
+	// surface area per unit cell volume (for a unit cell size of 1)
+	area := []float64{3.09, 2.35, 3.84}
+	for _, typ := range []TPMSType{Gyroid, SchwarzP, SchwarzD} {
+		s := TPMS3D(&TPMSParms{Type: typ, Period: 10, Thickness: 1})
+		// a distance bound
+		bb := s.BoundingBox()
+		for _, a := range bb.RandomSet(20000) {
+			b := a.Add(V3{rand.NormFloat64(), rand.NormFloat64(), rand.NormFloat64()}.MulScalar(0.1))
+			if Abs(s.Evaluate(a)-s.Evaluate(b)) > a.Sub(b).Length()*1.001 {
+				t.Errorf("FAIL %d: bound", typ)
+				break
+			}
+		}
+		// periodic
+		for _, p := range bb.RandomSet(100) {
+			if Abs(s.Evaluate(p)-s.Evaluate(p.Add(V3{10, -20, 30}))) > tolerance {
+				t.Errorf("FAIL %d: not periodic", typ)
+				break
+			}
+		}
+		// a thin sheet: the density is about area/volume * thickness
+		r, err := AnalyzeLattice(s, bb, 50)
+		if err != nil {
+			t.Fatalf("FAIL %s", err)
+		}
+		if Abs(r.Density-0.1*area[typ]) > 0.02 {
+			t.Errorf("FAIL %d: density %f", typ, r.Density)
+		}
+	}
+	// gyroid sheet through the origin
+	s := TPMS3D(&TPMSParms{Type: Gyroid, Period: 10, Thickness: 1})
+	if d := s.Evaluate(V3{}); d >= 0 || d < -0.5 {
+		t.Errorf("FAIL %f", d)
+	}
+	// infill of a part
+	part := Sphere3D(30)
+	infill := Infill3D(part, s)
+	if infill.BoundingBox() != part.BoundingBox() || infill.Evaluate(V3{}) != s.Evaluate(V3{}) || infill.Evaluate(V3{31, 0, 0}) <= 0 {
+		t.Error("FAIL infill")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_StrutLattice(t *testing.T) {
+	// honeycomb
+	h := Honeycomb2D(10, 1)
+	if Abs(h.Evaluate(V2{})-4.5) > tolerance {
+		t.Error("FAIL cell center")
+	}
+	if Abs(h.Evaluate(V2{5, 0})+0.5) > tolerance {
+		t.Error("FAIL wall")
+	}
+	if Abs(h.Evaluate(V2{5, 5 / math.Sqrt(3)})+0.5) > tolerance {
+		t.Error("FAIL vertex")
+	}
+	if Abs(h.Evaluate(V2{5, 5 * math.Sqrt(3)})-4.5) > tolerance {
+		t.Error("FAIL adjacent cell center")
+	}
+	bb2 := h.BoundingBox()
+	for _, p := range bb2.RandomSet(100) {
+		if Abs(h.Evaluate(p)-h.Evaluate(p.Add(V2{30, 20 * math.Sqrt(3)}))) > tolerance {
+			t.Error("FAIL honeycomb not periodic")
+			break
+		}
+	}
+	for _, a := range bb2.RandomSet(20000) {
+		b := a.Add(V2{rand.NormFloat64(), rand.NormFloat64()}.MulScalar(0.5))
+		if Abs(h.Evaluate(a)-h.Evaluate(b)) > a.Sub(b).Length()+tolerance {
+			t.Error("FAIL honeycomb bound")
+			break
+		}
+	}
+	// strut lattices
+	for _, typ := range []StrutLatticeType{CubicLattice, OctetLattice} {
+		s := StrutLattice3D(&StrutLatticeParms{Type: typ, Cell: 10, Radius: 1})
+		if Abs(s.Evaluate(V3{})+1) > tolerance {
+			t.Errorf("FAIL %d: node", typ)
+		}
+		bb := s.BoundingBox()
+		for _, a := range bb.RandomSet(20000) {
+			b := a.Add(V3{rand.NormFloat64(), rand.NormFloat64(), rand.NormFloat64()}.MulScalar(0.5))
+			if Abs(s.Evaluate(a)-s.Evaluate(b)) > a.Sub(b).Length()+tolerance {
+				t.Errorf("FAIL %d: bound", typ)
+				break
+			}
+		}
+		for _, p := range bb.RandomSet(100) {
+			if Abs(s.Evaluate(p)-s.Evaluate(p.Add(V3{10, -20, 30}))) > tolerance {
+				t.Errorf("FAIL %d: not periodic", typ)
+				break
+			}
+		}
+	}
+	cubic := StrutLattice3D(&StrutLatticeParms{Type: CubicLattice, Cell: 10, Radius: 1})
+	if Abs(cubic.Evaluate(V3{5, 5, 5})-(5*math.Sqrt2-1)) > tolerance {
+		t.Error("FAIL cubic cell center")
+	}
+	if Abs(cubic.Evaluate(V3{5, 5, 0})-(5-1)) > tolerance {
+		t.Error("FAIL cubic face center")
+	}
+	octet := StrutLattice3D(&StrutLatticeParms{Type: OctetLattice, Cell: 10, Radius: 1})
+	if Abs(octet.Evaluate(V3{5, 5, 5})-(5-1)) > tolerance {
+		t.Error("FAIL octet cell center")
+	}
+	if Abs(octet.Evaluate(V3{5, 5, 0})+1) > tolerance {
+		t.Error("FAIL octet face center")
+	}
+	if Abs(octet.Evaluate(V3{5, 0, 0})-(5/math.Sqrt2-1)) > tolerance {
+		t.Error("FAIL octet edge center")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Noise(t *testing.T) {
+	// noise is zero on the lattice, periodic and bounded
+	if PerlinNoise3(V3{3, -7, 12}) != 0 {
+		t.Error("FAIL lattice")
+	}
+	b := Box3{V3{-10, -10, -10}, V3{10, 10, 10}}
+	nonzero := false
+	for _, p := range b.RandomSet(10000) {
+		n := PerlinNoise3(p)
+		if Abs(n) > 1 || Abs(FractalNoise3(p, 4)) > 1 {
+			t.Error("FAIL range")
+			break
+		}
+		if Abs(n-PerlinNoise3(p.Add(V3{256, -512, 256}))) > tolerance {
+			t.Error("FAIL not periodic")
+			break
+		}
+		nonzero = nonzero || Abs(n) > 0.1
+	}
+	if !nonzero {
+		t.Error("FAIL no noise")
+	}
+	// displaced sphere: a conservative distance bound within the amplitude
+	sphere := Sphere3D(10)
+	s := Noise3D(sphere, 0.5, 0.3, 3)
+	if !s.BoundingBox().Equals(NewBox3(V3{}, V3{21, 21, 21}), tolerance) {
+		t.Error("FAIL bounding box")
+	}
+	bb := s.BoundingBox()
+	for _, a := range bb.RandomSet(20000) {
+		d := s.Evaluate(a)
+		if Abs(d) > Abs(sphere.Evaluate(a))+0.5+tolerance {
+			t.Error("FAIL amplitude")
+			break
+		}
+		c := a.Add(V3{rand.NormFloat64(), rand.NormFloat64(), rand.NormFloat64()}.MulScalar(0.1))
+		if Abs(d-s.Evaluate(c)) > a.Sub(c).Length()+tolerance {
+			t.Error("FAIL bound")
+			break
+		}
+	}
+	if s.Evaluate(V3{}) >= 0 || s.Evaluate(V3{11, 0, 0}) <= 0 {
+		t.Error("FAIL inside/outside")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Voronoi(t *testing.T) {
+	// a regular grid: square (cube) cells
+	k := &VoronoiParms{Mode: VoronoiEdges, Cell: 10, Width: 1}
+	s2 := Voronoi2D(k)
+	if Abs(s2.Evaluate(V2{5, 5})-4.5) > tolerance || Abs(s2.Evaluate(V2{10, 5})+0.5) > tolerance {
+		t.Error("FAIL 2d grid")
+	}
+	s3 := Voronoi3D(k)
+	if Abs(s3.Evaluate(V3{5, 5, 5})-4.5) > tolerance || Abs(s3.Evaluate(V3{5, 8, 10})+0.5) > tolerance {
+		t.Error("FAIL 3d grid")
+	}
+	k.Mode = VoronoiCells
+	if Abs(Voronoi2D(k).Evaluate(V2{5, 5})+4.5) > tolerance || Abs(Voronoi3D(k).Evaluate(V3{5, 5, 5})+4.5) > tolerance {
+		t.Error("FAIL cells")
+	}
+	// random points: distance bounds and repeatability
+	for _, mode := range []VoronoiMode{VoronoiEdges, VoronoiCells} {
+		k := &VoronoiParms{Mode: mode, Cell: 10, Width: 1, Jitter: 1, Seed: 7}
+		s2 := Voronoi2D(k)
+		s3 := Voronoi3D(k)
+		b2 := Box2{V2{-50, -50}, V2{50, 50}}
+		for _, a := range b2.RandomSet(20000) {
+			b := a.Add(V2{rand.NormFloat64(), rand.NormFloat64()})
+			if Abs(s2.Evaluate(a)-s2.Evaluate(b)) > a.Sub(b).Length()+tolerance {
+				t.Errorf("FAIL %d: 2d bound", mode)
+				break
+			}
+		}
+		b3 := Box3{V3{-50, -50, -50}, V3{50, 50, 50}}
+		for _, a := range b3.RandomSet(20000) {
+			b := a.Add(V3{rand.NormFloat64(), rand.NormFloat64(), rand.NormFloat64()})
+			if Abs(s3.Evaluate(a)-s3.Evaluate(b)) > a.Sub(b).Length()+tolerance {
+				t.Errorf("FAIL %d: 3d bound", mode)
+				break
+			}
+		}
+		p := V3{12.3, -4.5, 6.7}
+		if Voronoi3D(k).Evaluate(p) != s3.Evaluate(p) {
+			t.Errorf("FAIL %d: not repeatable", mode)
+		}
+		k.Seed++
+		if Voronoi3D(k).Evaluate(p) == s3.Evaluate(p) {
+			t.Errorf("FAIL %d: seed", mode)
+		}
+	}
+}
+
+// voronoiBorder2 returns the distance to the Voronoi cell border by brute force,
+// and the distance (in grid cells) from the point to its nearest seed's cell.
+func voronoiBorder2(s *VoronoiSDF2, p V2) (float64, int) {
+	p = p.DivScalar(s.cell)
+	g := V2i{int(math.Floor(p.X)), int(math.Floor(p.Y))}
+	var seeds []V2
+	var cells []V2i // grid cell offsets
+	for j := -4; j <= 4; j++ {
+		for i := -4; i <= 4; i++ {
+			seeds = append(seeds, s.point(g.Add(V2i{i, j}), p))
+			cells = append(cells, V2i{i, j})
+		}
+	}
+	m := 0
+	for i, r := range seeds {
+		if r.Length2() < seeds[m].Length2() {
+			m = i
+		}
+	}
+	mr := seeds[m]
+	d := math.MaxFloat64
+	for i, r := range seeds {
+		if i != m {
+			d = Min(d, mr.Add(r).MulScalar(0.5).Dot(r.Sub(mr).Normalize()))
+		}
+	}
+	c := cells[m]
+	return d * s.cell, int(Max(Abs(float64(c[0])), Abs(float64(c[1]))))
+}
+
+// voronoiBorder3 returns the distance to the Voronoi cell border by brute force,
+// and the distance (in grid cells) from the point to its nearest seed's cell.
+func voronoiBorder3(s *VoronoiSDF3, p V3) (float64, int) {
+	p = p.DivScalar(s.cell)
+	g := V3i{int(math.Floor(p.X)), int(math.Floor(p.Y)), int(math.Floor(p.Z))}
+	var seeds []V3
+	var cells []V3i // grid cell offsets
+	for k := -4; k <= 4; k++ {
+		for j := -4; j <= 4; j++ {
+			for i := -4; i <= 4; i++ {
+				seeds = append(seeds, s.point(g.Add(V3i{i, j, k}), p))
+				cells = append(cells, V3i{i, j, k})
+			}
+		}
+	}
+	m := 0
+	for i, r := range seeds {
+		if r.Length2() < seeds[m].Length2() {
+			m = i
+		}
+	}
+	mr := seeds[m]
+	d := math.MaxFloat64
+	for i, r := range seeds {
+		if i != m {
+			d = Min(d, mr.Add(r).MulScalar(0.5).Dot(r.Sub(mr).Normalize()))
+		}
+	}
+	c := cells[m]
+	return d * s.cell, int(Max(Max(Abs(float64(c[0])), Abs(float64(c[1]))), Abs(float64(c[2]))))
+}
+
+func Test_VoronoiBorder(t *testing.T) {
+	k := &VoronoiParms{Mode: VoronoiEdges, Cell: 10, Width: 1, Jitter: 1, Seed: 3}
+	s2 := Voronoi2D(k).(*VoronoiSDF2)
+	s3 := Voronoi3D(k).(*VoronoiSDF3)
+	// points whose nearest seed is two grid cells away (they are rare)
+	for _, p := range []V2{{80, 60.25}, {80.5, 60.5}, {81.25, 60}} {
+		d, n := voronoiBorder2(s2, p)
+		if n != 2 || Abs(s2.Border(p)-d) > tolerance {
+			t.Errorf("FAIL 2d %v: %f, expected %f (nearest seed %d cells away)", p, s2.Border(p), d, n)
+		}
+	}
+	for _, p := range []V3{{-60, 29, -2}, {65.5, 82, 40}, {77, 20, -35}, {80, -80.5, 36}, {80, 27.5, 2.5}, {80, 99.5, -23}} {
+		d, n := voronoiBorder3(s3, p)
+		if n != 2 || Abs(s3.Border(p)-d) > tolerance {
+			t.Errorf("FAIL 3d %v: %f, expected %f (nearest seed %d cells away)", p, s3.Border(p), d, n)
+		}
+	}
+	// random points
+	b2 := Box2{V2{-100, -100}, V2{100, 100}}
+	for _, p := range b2.RandomSet(2000) {
+		if d, _ := voronoiBorder2(s2, p); Abs(s2.Border(p)-d) > tolerance {
+			t.Errorf("FAIL 2d %v: %f, expected %f", p, s2.Border(p), d)
+		}
+	}
+	b3 := Box3{V3{-100, -100, -100}, V3{100, 100, 100}}
+	for _, p := range b3.RandomSet(2000) {
+		if d, _ := voronoiBorder3(s3, p); Abs(s3.Border(p)-d) > tolerance {
+			t.Errorf("FAIL 3d %v: %f, expected %f", p, s3.Border(p), d)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Lerp3D(t *testing.T) {
+	s0 := Sphere3D(5)
+	s1 := Box3D(V3{10, 10, 10}, 0)
+	// constant blend
+	for _, v := range []float64{-1, 0, 0.25, 1, 2} {
+		s := Lerp3D(s0, s1, v)
+		tc := Clamp(v, 0, 1)
+		for _, p := range []V3{{0, 0, 0}, {5, 5, 0}, {3, 7, -2}} {
+			if Abs(s.Evaluate(p)-Mix(s0.Evaluate(p), s1.Evaluate(p), tc)) > tolerance {
+				t.Errorf("FAIL t = %f", v)
+			}
+		}
+	}
+	if Lerp3D(s0, s1, 0.5).BoundingBox() != s1.BoundingBox() {
+		t.Error("FAIL bounding box")
+	}
+	// a round bar (z < -10) changing to a square bar (z > 10)
+	s := LerpAxis3D(Elongate3D(s0, V3{0, 0, 50}), Elongate3D(s1, V3{0, 0, 50}), V3{0, 0, -10}, V3{0, 0, 10})
+	if s.Evaluate(V3{4.9, 0, -20}) >= 0 || s.Evaluate(V3{4.9, 4.9, -20}) <= 0 || s.Evaluate(V3{4.9, 4.9, 20}) >= 0 {
+		t.Error("FAIL axis ends")
+	}
+	bb := s.BoundingBox()
+	for _, p := range bb.RandomSet(20000) {
+		q := p.Add(V3{rand.NormFloat64(), rand.NormFloat64(), rand.NormFloat64()})
+		if Abs(s.Evaluate(p)-s.Evaluate(q)) > p.Sub(q).Length()+tolerance {
+			t.Error("FAIL bound")
+			break
+		}
+	}
+	if LipschitzK3(s) != 1 {
+		t.Error("FAIL lipschitz")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_BVHUnion3D(t *testing.T) {
+	// a perfboard: a plate with a grid of holes
+	var holes []SDF3
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 30; x++ {
+			p := V3{float64(x)*2.54 + 1.27, float64(y)*2.54 + 1.27, 0}
+			holes = append(holes, Transform3D(Cylinder3D(3, 0.5, 0), Translate3d(p)))
+		}
+	}
+	s0 := Union3D(holes...)
+	s1 := BVHUnion3D(holes...)
+	if s1.BoundingBox() != s0.BoundingBox() {
+		t.Error("FAIL bounding box")
+	}
+	bb := NewBox3(s0.BoundingBox().Center(), s0.BoundingBox().Size().AddScalar(10))
+	for _, p := range bb.RandomSet(5000) {
+		if Abs(s0.Evaluate(p)-s1.Evaluate(p)) > tolerance {
+			t.Errorf("FAIL %v", p)
+			break
+		}
+	}
+	// random spheres
+	var spheres []SDF3
+	for _, p := range bb.RandomSet(300) {
+		spheres = append(spheres, Transform3D(Sphere3D(0.5+2*rand.Float64()), Translate3d(p)))
+	}
+	s0 = Union3D(spheres...)
+	s1 = BVHUnion3D(spheres...)
+	for _, p := range bb.RandomSet(5000) {
+		if Abs(s0.Evaluate(p)-s1.Evaluate(p)) > tolerance {
+			t.Errorf("FAIL %v", p)
+			break
+		}
+	}
+	// difference
+	plate := Box3D(V3{80, 60, 1.6}, 0)
+	d0 := Difference3D(plate, Union3D(holes...))
+	d1 := BVHDifference3D(plate, holes...)
+	for _, p := range bb.RandomSet(5000) {
+		if Abs(d0.Evaluate(p)-d1.Evaluate(p)) > tolerance {
+			t.Errorf("FAIL difference %v", p)
+			break
+		}
+	}
+	if BVHUnion3D(nil, spheres[0]) != spheres[0] || BVHUnion3D() != nil || BVHDifference3D(plate) != plate {
+		t.Error("FAIL degenerate")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_RepeatTransform3D(t *testing.T) {
+	k := Sphere3D(1.2)
+	num := V3i{4, 3, 5}
+	step := V3{3, -3, 2.5}
+	// identity transforms: the same as Repeat3D
+	all := func(i V3i) (M44, bool) { return Identity3d(), true }
+	s0 := RepeatTransform3D(k, num, step, all)
+	s1 := Repeat3D(k, num, step)
+	if !s0.BoundingBox().Equals(s1.BoundingBox(), tolerance) {
+		t.Error("FAIL bounding box")
+	}
+	b := s1.BoundingBox().ScaleAboutCenter(1.5)
+	for _, p := range b.RandomSet(1000) {
+		if Abs(s0.Evaluate(p)-s1.Evaluate(p)) > tolerance {
+			t.Errorf("FAIL %v", p)
+			break
+		}
+	}
+	// staggered rows with holes left out: the same as a union
+	fn := func(i V3i) (M44, bool) {
+		if (i[0]+i[1]+i[2])%3 == 0 {
+			return Identity3d(), false
+		}
+		m := RotateZ(DtoR(float64(10 * i[0])))
+		if i[1]%2 == 1 {
+			m = Translate3d(V3{1.5, 0, 0}).Mul(m)
+		}
+		return m, true
+	}
+	c := Box3D(V3{2, 1, 1}, 0.1)
+	s2 := RepeatTransform3D(c, num, step, fn)
+	var parts []SDF3
+	for z := 0; z < num[2]; z++ {
+		for y := 0; y < num[1]; y++ {
+			for x := 0; x < num[0]; x++ {
+				if m, ok := fn(V3i{x, y, z}); ok {
+					pos := step.Mul(V3{float64(x), float64(y), float64(z)})
+					parts = append(parts, Transform3D(c, Translate3d(pos).Mul(m)))
+				}
+			}
+		}
+	}
+	s3 := Union3D(parts...)
+	if !s2.BoundingBox().Equals(s3.BoundingBox(), tolerance) {
+		t.Error("FAIL bounding box")
+	}
+	b = s3.BoundingBox()
+	for _, p := range b.RandomSet(2000) {
+		if Abs(s2.Evaluate(p)-s3.Evaluate(p)) > tolerance {
+			t.Errorf("FAIL %v", p)
+			break
+		}
+	}
+	// everything left out
+	none := func(i V3i) (M44, bool) { return Identity3d(), false }
+	if RepeatTransform3D(k, num, step, none) != nil || RepeatTransform3D(k, V3i{0, 1, 1}, step, all) != nil {
+		t.Error("FAIL nil")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Model(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// save and load a model
+	s0 := Difference3D(
+		Union3D(Box3D(V3{20, 20, 10}, 1), Tag3D(Transform3D(Sphere3D(6), Translate3d(V3{0, 0, 5})), 2)),
+		Intersect3D(ScaleUniform3D(Cylinder3D(12, 4, 0.5), 1.5), Offset3D(Sphere3D(7), 0.5)),
+	)
+	path := filepath.Join(dir, "model.json")
+	if err := SaveModel(s0, path); err != nil {
+		t.Fatal(err)
+	}
+	s1, err := LoadModel(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s1.BoundingBox().Equals(s0.BoundingBox(), tolerance) {
+		t.Error("FAIL bounding box")
+	}
+	b := s0.BoundingBox().ScaleAboutCenter(1.2)
+	for _, p := range b.RandomSet(1000) {
+		if Abs(s0.Evaluate(p)-s1.Evaluate(p)) > tolerance {
+			t.Errorf("FAIL %v", p)
+			break
+		}
+	}
+	// the saved model is the same
+	var b0, b1 bytes.Buffer
+	if EncodeModel(&b0, s0) != nil || EncodeModel(&b1, s1) != nil || b0.String() != b1.String() {
+		t.Error("FAIL encoding")
+	}
+
+	// a hand written model
+	doc := `{"schema": "sdfx-model", "version": 1, "model": {"type": "translate", "vector": {"X": 1, "Y": 2, "Z": 3},
+		"children": [{"type": "sphere", "radius": 2}]}}`
+	s2, err := DecodeModel(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Abs(s2.Evaluate(V3{1, 2, 3})+2) > tolerance {
+		t.Error("FAIL translate")
+	}
+
+	// errors
+	for _, doc := range []string{
+		`{"schema": "sdfx-report", "version": 1, "model": {"type": "sphere", "radius": 1}}`,
+		`{"schema": "sdfx-model", "version": 99, "model": {"type": "sphere", "radius": 1}}`,
+		`{"schema": "sdfx-model", "version": 1}`,
+		`{"schema": "sdfx-model", "version": 1, "model": {"type": "cone"}}`,
+		`{"schema": "sdfx-model", "version": 1, "model": {"type": "sphere", "radius": -1}}`,
+		`{"schema": "sdfx-model", "version": 1, "model": {"type": "box"}}`,
+		`{"schema": "sdfx-model", "version": 1, "model": {"type": "union", "children": [{"type": "sphere", "radius": 1}]}}`,
+		`{"schema": "sdfx-model", "version": 1, "model": {"type": "tag", "tag": 0, "children": [{"type": "sphere", "radius": 1}]}}`,
+		`{"schema": "sdfx-model", "version": 1, "model": {"type": "sphere", "raduis": 1}}`,
+		`{"schema": "sdfx-model", "version": 1, "units": "mm", "model": {"type": "sphere", "radius": 1}}`,
+	} {
+		if _, err := DecodeModel(strings.NewReader(doc)); err == nil {
+			t.Errorf("FAIL %s", doc)
+		}
+	}
+	u := Union3D(Sphere3D(1), Box3D(V3{1, 1, 1}, 0))
+	u.(*UnionSDF3).SetMin(RoundMin(0.1))
+	if _, err := NewModelNode(u); err == nil {
+		t.Error("FAIL blended union")
+	}
+	if _, err := NewModelNode(Twist3D(Sphere3D(1), 1)); err == nil {
+		t.Error("FAIL twist")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Script(t *testing.T) {
+	src := `
+// a plate with holes
+r = 2.5 # hole radius
+size = [40, 30, 5]
+plate = box(size, 1)
+hole = cylinder(size[0] * 0 + 10, r)
+holes = union(
+	translate([10, 5, 0], hole),
+	translate([-10, -5, 0], hole)
+)
+difference(plate, holes); x = 1
+`
+	_, _, err := EvalScript(src)
+	if err == nil || !strings.Contains(err.Error(), "line 6") {
+		t.Errorf("FAIL %v", err)
+	}
+	src = strings.Replace(src, "size[0] * 0 + 10", "2 * (size - [0, 0, 1]) / 2 - [0, 0, 0]", 1)
+	if _, _, err := EvalScript(src); err == nil {
+		t.Error("FAIL vector height")
+	}
+	src = strings.Replace(src, "2 * (size - [0, 0, 1]) / 2 - [0, 0, 0]", "10", 1)
+	s3, s2, err := EvalScript(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s2 != nil || s3 == nil {
+		t.Fatal("FAIL 3d")
+	}
+	hole := Cylinder3D(10, 2.5, 0)
+	ref := Difference3D(Box3D(V3{40, 30, 5}, 1), Union3D(
+		Transform3D(hole, Translate3d(V3{10, 5, 0})),
+		Transform3D(hole, Translate3d(V3{-10, -5, 0}))))
+	b := ref.BoundingBox()
+	for _, p := range b.RandomSet(1000) {
+		if Abs(s3.Evaluate(p)-ref.Evaluate(p)) > tolerance {
+			t.Errorf("FAIL %v", p)
+			break
+		}
+	}
+
+	// 2d, rotation, math
+	_, s2, err = EvalScript("a = 90; rotate(a, translate([sqrt(4) * cos(0), -1 + 1], rect([2, 1])))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s2 == nil || s2.Evaluate(V2{0, 2}) >= 0 || s2.Evaluate(V2{2, 0}) <= 0 {
+		t.Error("FAIL 2d")
+	}
+	s3, _, err = EvalScript("rotate([0, 0, 90], extrude(2, translate([2, 0], circle(0.5))))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s3.Evaluate(V3{0, 2, 0}) >= 0 || s3.Evaluate(V3{2, 0, 0}) <= 0 {
+		t.Error("FAIL 3d rotate")
+	}
+
+	// errors
+	for _, src := range []string{
+		"",
+		"x = 1",
+		"1 + 2",
+		"sphere(1) + 1",
+		"sphere(\"a\")",
+		"sphere(1, 2)",
+		"cube(1)",
+		"sphere(r)",
+		"box([1, 2], 0)",
+		"union(sphere(1), circle(1))",
+		"sphere = 1",
+		"sphere(1",
+		"sphere(1) sphere(2)",
+		"\"abc",
+		"sphere(1) @",
+	} {
+		if _, _, err := EvalScript(src); err == nil {
+			t.Errorf("FAIL \"%s\"", src)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_SCAD(t *testing.T) {
+	src := `
+/* a plate with a row of holes */
+n = 3;
+$fn = 64;
+size = [10 * n, 10, 2];
+difference() {
+	cube(size);
+	for (i = [0 : n - 1])
+		translate([10 * i + 5, 5, -1]) cylinder(h = 4, d = 3);
+	* sphere(100);
+	% sphere(100);
+	if (n > 5) {
+		sphere(100);
+	} else if (len(size) == 3 && !false)
+		translate([0, 0, size[2]]) cube([1, 1, 2], center = true);
+}
+`
+	s3, s2, err := EvalSCAD(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s2 != nil || s3 == nil {
+		t.Fatal("FAIL 3d")
+	}
+	hole := Cylinder3D(4, 1.5, 0)
+	holes := []SDF3{}
+	for _, x := range []float64{5, 15, 25} {
+		holes = append(holes, Transform3D(hole, Translate3d(V3{x, 5, 1})))
+	}
+	holes = append(holes, Transform3D(Box3D(V3{1, 1, 2}, 0), Translate3d(V3{0, 0, 2})))
+	ref := Difference3D(Transform3D(Box3D(V3{30, 10, 2}, 0), Translate3d(V3{15, 5, 1})), Union3D(holes...))
+	b := ref.BoundingBox()
+	for _, p := range b.RandomSet(1000) {
+		if Abs(s3.Evaluate(p)-ref.Evaluate(p)) > tolerance {
+			t.Errorf("FAIL %v", p)
+			break
+		}
+	}
+
+	// 2d, linear extrusion
+	_, s2, err = EvalSCAD("rotate(90) translate([2, 0]) square(1, center = true);")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s2 == nil || s2.Evaluate(V2{0, 2}) >= 0 || s2.Evaluate(V2{2, 0}) <= 0 {
+		t.Error("FAIL 2d")
+	}
+	s3, _, err = EvalSCAD(`
+for (a = [0, 90]) rotate([0, 0, a]) linear_extrude(height = 4, twist = 90)
+	polygon([[1, -0.5], [3, -0.5], [3, 0.5], [1, 0.5]]);
+mirror([0, 0, 1]) sphere(d = 2 * (true ? 0.5 : 1));
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := DtoR(-45)
+	for _, x := range []struct {
+		p      V3
+		inside bool
+	}{
+		{V3{2, 0, 0.1}, true},
+		{V3{0, 2, 0.1}, true},
+		{V3{-2, 0, 0.1}, false},
+		{V3{2 * math.Cos(c), 2 * math.Sin(c), 2}, true},
+		{V3{2 * math.Sin(-c), 2 * math.Cos(c), 2}, true},
+		{V3{2, 0, 2}, false},
+		{V3{0, 0, -0.4}, true},
+		{V3{0, 0, 4.5}, false},
+	} {
+		if (s3.Evaluate(x.p) < 0) != x.inside {
+			t.Errorf("FAIL %v", x.p)
+		}
+	}
+
+	// errors
+	for _, src := range []string{
+		"",
+		"x = 1;",
+		"sphere(1) @",
+		"cube(1)",
+		"sphere(r);",
+		"sphere(\"a\");",
+		"hull() cube(1);",
+		"module m() {}",
+		"union() { cube(1); circle(1); }",
+		"intersection() { square(1); circle(1); }",
+		"scale([1, 2, 1]) cube(1);",
+		"for (i = [0 : 0 : 1]) cube(i);",
+		"difference() { cube(1);",
+		"/* cube(1);",
+		"cube(1 + true);",
+		"cube(sin(1, 2));",
+	} {
+		if _, _, err := EvalSCAD(src); err == nil {
+			t.Errorf("FAIL \"%s\"", src)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_SCADExport(t *testing.T) {
+	s2 := Union2D(
+		Transform2D(Box2D(V2{4, 2}, 0), Rotate2d(DtoR(30))),
+		Offset2D(Polygon2D([]V2{{0, 0}, {3, 0}, {0, 3}}), 0.5),
+		ScaleUniform2D(Circle2D(1), 1.5))
+	s := Union3D(
+		Difference3D(Box3D(V3{10, 8, 6}, 0), Transform3D(Cylinder3D(8, 2, 0), RotateX(DtoR(90)))),
+		Transform3D(Cone3D(4, 2, 1, 0), Translate3d(V3{0, 0, 5})),
+		Transform3D(Intersect3D(Sphere3D(3), ScaleUniform3D(Box3D(V3{2, 2, 2}, 0), 2)), Translate3d(V3{6, 0, 0})),
+		Transform3D(Extrude3D(s2, 2), Translate3d(V3{0, 0, -5})),
+		Tag3D(Transform3D(Sphere3D(1), Translate3d(V3{-6, 0, 0})), 1))
+	var buf bytes.Buffer
+	if err := EncodeSCAD(&buf, s, &SCADParms{Fn: 64}); err != nil {
+		t.Fatal(err)
+	}
+	// read it back
+	s3, _, err := EvalSCAD(buf.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := s.BoundingBox()
+	for _, p := range b.RandomSet(1000) {
+		if Abs(s3.Evaluate(p)-s.Evaluate(p)) > 1e-9 {
+			t.Errorf("FAIL %v", p)
+			break
+		}
+	}
+
+	// rounding and offsets
+	buf.Reset()
+	s = Union3D(Box3D(V3{2, 2, 2}, 0.5), Offset3D(Sphere3D(1), 0.2))
+	if err := EncodeSCAD(&buf, s, &SCADParms{}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(buf.String(), "minkowski()") != 2 {
+		t.Error("FAIL minkowski")
+	}
+
+	// meshing
+	u := Union3D(Sphere3D(1), Transform3D(Sphere3D(1), Translate3d(V3{1, 0, 0})))
+	u.(*UnionSDF3).SetMin(PolyMin(0.5))
+	if err := EncodeSCAD(&buf, u, &SCADParms{}); err == nil {
+		t.Error("FAIL no mesh")
+	}
+	buf.Reset()
+	if err := EncodeSCAD(&buf, u, &SCADParms{MeshCells: 20}); err != nil || !strings.Contains(buf.String(), "polyhedron(") {
+		t.Errorf("FAIL mesh %v", err)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Attach3D(t *testing.T) {
+	// a cylinder on top of a box
+	box := Box3D(V3{4, 4, 2}, 0)
+	cyl := Cylinder3D(2, 1, 0)
+	s := Attach3D(box, "top", cyl, "bottom")
+	if s.Evaluate(V3{0, 0, 2.5}) >= 0 || s.Evaluate(V3{0, 0, 3.5}) <= 0 || s.Evaluate(V3{1.5, 1.5, 1.5}) <= 0 {
+		t.Error("FAIL stack")
+	}
+
+	// named anchors on a rotated part
+	peg := Anchor3D(Cylinder3D(2, 0.5, 0), map[string]Frame{
+		"tip":  NewFrame(V3{0, 0, 1}, V3{0, 0, 1}, V3{}),
+		"base": NewFrame(V3{0, 0, -1}, V3{0, 0, -1}, V3{1, 0, 0}),
+	})
+	peg = Transform3D(peg, RotateY(DtoR(90)))
+	f, ok := GetAnchor(peg, "tip")
+	if !ok || f.Origin.Sub(V3{1, 0, 0}).Length() > tolerance || f.Z.Sub(V3{1, 0, 0}).Length() > tolerance {
+		t.Errorf("FAIL anchor %v", f)
+	}
+
+	// attach the peg base to the side of the box, then chain another peg on the tip
+	s = Attach3D(box, "right", peg, "base")
+	s = Attach3D(s, "tip", Sphere3D(0.5), "center")
+	if s.Evaluate(V3{3, 0, 0}) >= 0 || s.Evaluate(V3{4.3, 0, 0}) >= 0 || s.Evaluate(V3{3, 0, 0.8}) <= 0 {
+		t.Error("FAIL chain")
+	}
+	f, _ = GetAnchor(s, "tip")
+	if f.Origin.Sub(V3{4, 0, 0}).Length() > tolerance || f.Z.Sub(V3{1, 0, 0}).Length() > tolerance {
+		t.Errorf("FAIL tip %v", f)
+	}
+
+	// the mated frames coincide with opposing z directions
+	m := AttachTransform(box, "back", cyl, "top")
+	fa, _ := GetAnchor(box, "back")
+	fb, _ := GetAnchor(cyl, "top")
+	fb = fb.Transform(m)
+	if fb.Origin.Sub(fa.Origin).Length() > tolerance || fb.Z.Add(fa.Z).Length() > tolerance || fb.X.Sub(fa.X).Length() > tolerance {
+		t.Errorf("FAIL mate %v %v", fa, fb)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Sketch(t *testing.T) {
+	// a 10 x 5 rectangle from rough initial positions
+	s := NewSketch()
+	p0 := s.Point(0, 0)
+	p1 := s.Point(9, 1)
+	p2 := s.Point(11, 4)
+	p3 := s.Point(-1, 6)
+	s.Fix(p0)
+	l0 := s.Line(p0, p1)
+	l1 := s.Line(p1, p2)
+	l2 := s.Line(p2, p3)
+	l3 := s.Line(p3, p0)
+	s.Horizontal(l0)
+	s.Perpendicular(l0, l1)
+	s.Parallel(l0, l2)
+	s.Perpendicular(l2, l3)
+	s.Length(l0, 10)
+	s.Length(l1, 5)
+	if err := s.Solve(); err != nil {
+		t.Fatal(err)
+	}
+	if !p2.P.Equals(V2{10, 5}, 1e-6) || !p3.P.Equals(V2{0, 5}, 1e-6) {
+		t.Errorf("FAIL %v %v", p2.P, p3.P)
+	}
+	p, err := s.Polygon(16, l0, l3, l2, l1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := Polygon2D(p.Vertices())
+	if r.Evaluate(V2{5, 2.5}) >= 0 || r.Evaluate(V2{11, 2.5}) <= 0 {
+		t.Error("FAIL polygon")
+	}
+
+	// a line with a tangent arc
+	s = NewSketch()
+	p0 = s.Point(0, 0)
+	p1 = s.Point(9, 0.5)
+	p2 = s.Point(10, 6)
+	c := s.Point(10, 2.5)
+	s.Fix(p0)
+	l0 = s.Line(p0, p1)
+	a := s.Arc(c, p1, p2)
+	s.Horizontal(l0)
+	s.Length(l0, 10)
+	s.Tangent(l0, a)
+	s.Radius(a, 3)
+	s.Vertical(s.Line(c, p2))
+	if err := s.Solve(); err != nil {
+		t.Fatal(err)
+	}
+	if !p1.P.Equals(V2{10, 0}, 1e-6) || !c.P.Equals(V2{10, 3}, 1e-6) || !p2.P.Equals(V2{10, 6}, 1e-6) {
+		t.Errorf("FAIL %v %v %v", p1.P, c.P, p2.P)
+	}
+	p, err = s.Polygon(36, l0, a, s.Line(p2, p0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = Polygon2D(p.Vertices())
+	if r.Evaluate(V2{12, 3}) >= 0 || r.Evaluate(V2{13.5, 3}) <= 0 {
+		t.Error("FAIL arc polygon")
+	}
+
+	// an arc tangent to a line away from its end points
+	s = NewSketch()
+	p0 = s.Point(0, 0)
+	p1 = s.Point(10, 0)
+	s.Fix(p0)
+	s.Fix(p1)
+	c = s.Point(5, 2.5)
+	a = s.Arc(c, s.Point(7, 2.5), s.Point(3, 2.5))
+	s.Radius(a, 2)
+	s.Tangent(s.Line(p0, p1), a)
+	if err := s.Solve(); err != nil || Abs(c.P.Y-2) > 1e-6 {
+		t.Errorf("FAIL tangent %v %v", c.P, err)
+	}
+
+	// inconsistent constraints
+	s = NewSketch()
+	p0 = s.Point(0, 0)
+	p1 = s.Point(1, 0)
+	s.Distance(p0, p1, 1)
+	s.Distance(p0, p1, 2)
+	if s.Solve() == nil {
+		t.Error("FAIL inconsistent")
+	}
+
+	// edges that aren't a loop
+	if _, err := s.Polygon(16, s.Line(p0, p1), s.Line(p1, s.Point(5, 5))); err == nil {
+		t.Error("FAIL open loop")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Units(t *testing.T) {
+	test := []struct {
+		s  string
+		mm float64
+	}{
+		{"12mm", 12},
+		{"3.5 in", 88.9},
+		{"1/4in", 6.35},
+		{"250mil", 6.35},
+		{"2'", 609.6},
+		{"-1.5cm", -15},
+		{"2", 50.8},
+	}
+	for _, v := range test {
+		x, err := ParseLength(v.s, UnitInch)
+		if err != nil || Abs(x-v.mm) > 1e-9 {
+			t.Errorf("FAIL %s %g %v", v.s, x, err)
+		}
+	}
+	for _, s := range []string{"", "mm", "3 furlongs", "1/0in"} {
+		if _, err := ParseLength(s, UnitMM); err == nil {
+			t.Errorf("FAIL %q", s)
+		}
+	}
+	if Abs(Convert(1, UnitInch, UnitMil)-1000) > 1e-9 || Abs(Convert(25.4, UnitMM, UnitInch)-1) > 1e-9 {
+		t.Error("FAIL convert")
+	}
+
+	// parameter table
+	p := NewParams(UnitInch)
+	p.Set("width", 2, 0)
+	p.Set("wall", 3, UnitMM)
+	p.Set("holes", 4, 0)
+	if p.Length("width") != 50.8 || p.Length("wall") != 3 || p.Int("holes") != 4 {
+		t.Error("FAIL params")
+	}
+	if p.V3("width", "width", "wall") != (V3{50.8, 50.8, 3}) {
+		t.Error("FAIL V3")
+	}
+
+	// config override and conversion
+	if err := p.Decode(strings.NewReader(`{"wall": "1/8in", "depth": 10}`)); err != nil {
+		t.Fatal(err)
+	}
+	if p.Length("wall") != 3.175 || p.Length("depth") != 254 {
+		t.Error("FAIL decode")
+	}
+	if err := p.Decode(strings.NewReader(`{"wall": "3 parsecs"}`)); err == nil {
+		t.Error("FAIL bad unit")
+	}
+	p.Set("wall", 3, UnitMM)
+	var buf bytes.Buffer
+	if err := p.Encode(&buf, UnitMil); err != nil {
+		t.Fatal(err)
+	}
+	q := NewParams(UnitInch)
+	if err := q.Decode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if g, _ := q.Get("wall"); g.Unit != UnitMil || Abs(q.Length("wall")-3) > 1e-9 {
+		t.Errorf("FAIL encode %v", g)
+	}
+	if g, _ := q.Get("holes"); g.Unit != 0 || q.Int("holes") != 4 {
+		t.Errorf("FAIL encode %v", g)
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -67,3 +67,39 @@ func FingerButton2D(k *FingerButtonParms) SDF2 {
 }
 
 //-----------------------------------------------------------------------------
+// slots and keyholes
+
+// Slot2D returns a 2D slot (a capsule) along the x-axis.
+// The length is the overall length including the rounded ends.
+func Slot2D(length, width float64) SDF2 {
+	if width <= 0 || length < width {
+		panic("bad slot size")
+	}
+	return Line2D(length-width, 0.5*width)
+}
+
+// Obround2D returns a 2D obround (a stadium). The short sides are fully rounded.
+func Obround2D(size V2) SDF2 {
+	return Box2D(size, 0.5*Min(size.X, size.Y))
+}
+
+// KeyholeParms defines the parameters for a 2D keyhole.
+type KeyholeParms struct {
+	HeadDiameter float64 // diameter of the hole for the screw head
+	SlotWidth    float64 // width of the slot for the screw shank
+	Length       float64 // distance from the head center to the slot end center
+}
+
+// Keyhole2D returns a 2D keyhole cutout.
+// The head hole is at the origin and the slot goes along the +y axis.
+func Keyhole2D(k *KeyholeParms) SDF2 {
+	if k.SlotWidth <= 0 || k.SlotWidth > k.HeadDiameter {
+		panic("bad slot width")
+	}
+	head := Circle2D(0.5 * k.HeadDiameter)
+	slot := Line2D(k.Length, 0.5*k.SlotWidth)
+	slot = Transform2D(slot, Translate2d(V2{0, 0.5 * k.Length}).Mul(Rotate2d(DtoR(90))))
+	return Union2D(head, slot)
+}
+
+//-----------------------------------------------------------------------------
@@ -424,3 +424,183 @@ func Nut(k *NutParms) (SDF3, error) {
 }
 
 //-----------------------------------------------------------------------------
+// Jig (a cradle for holding a part)
+
+// sweepSDF3 is an SDF3 swept upwards (+z) by a distance.
+// The sweep is sampled at steps along z, the distance is reduced by half a
+// step so it is a bound on the distance to the continuous sweep.
+type sweepSDF3 struct {
+	sdf  SDF3
+	step float64
+	n    int
+	bb   Box3
+}
+
+func newSweepSDF3(sdf SDF3, height, step float64) *sweepSDF3 {
+	s := sweepSDF3{}
+	s.sdf = sdf
+	s.n = int(math.Ceil(height/step)) + 1
+	s.step = height / float64(s.n-1)
+	bb := sdf.BoundingBox()
+	s.bb = Box3{bb.Min, bb.Max.Add(V3{0, 0, height})}
+	return &s
+}
+
+// Evaluate returns the minimum distance to the swept SDF3.
+func (s *sweepSDF3) Evaluate(p V3) float64 {
+	d := math.MaxFloat64
+	for i := 0; i < s.n; i++ {
+		d = Min(d, s.sdf.Evaluate(p.Sub(V3{0, 0, float64(i) * s.step})))
+	}
+	return d - 0.5*s.step
+}
+
+// BoundingBox returns the bounding box of the swept SDF3.
+func (s *sweepSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+// JigParms defines the parameters for a jig.
+type JigParms struct {
+	Clearance     float64 // clearance between the part and the jig
+	BaseThickness float64 // thickness of the jig below the part
+	WallThickness float64 // thickness of the jig around the part
+	SlotWidth     float64 // width of the clamp slots (0 == no slots)
+	SlotDepth     float64 // depth of the clamp slots
+}
+
+// Jig returns a cradle for the lower half (z) of a part, e.g. for holding
+// an irregular part while drilling or soldering. The cavity is the part
+// (offset by the clearance) swept upwards so the part can be dropped in.
+// Two clamp slots run across the top of the jig (in the y direction) so
+// a strap or clamp can hold the part down. The jig is in the coordinates
+// of the part.
+func Jig(part SDF3, k *JigParms) (SDF3, error) {
+	if k.Clearance <= 0 {
+		return nil, errors.New("Clearance <= 0")
+	}
+	if k.BaseThickness <= 0 {
+		return nil, errors.New("BaseThickness <= 0")
+	}
+	if k.WallThickness <= 0 {
+		return nil, errors.New("WallThickness <= 0")
+	}
+	bb := part.BoundingBox()
+	top := bb.Center().Z
+	bottom := bb.Min.Z - k.Clearance - k.BaseThickness
+
+	// jig block
+	ofs := k.Clearance + k.WallThickness
+	bmin := V3{bb.Min.X - ofs, bb.Min.Y - ofs, bottom}
+	bmax := V3{bb.Max.X + ofs, bb.Max.Y + ofs, top}
+	size := bmax.Sub(bmin)
+	block := Transform3D(Box3D(size, 0), Translate3d(bmin.Add(size.MulScalar(0.5))))
+
+	// cavity: sweep the part up and out of the block
+	cavity := SDF3(newSweepSDF3(Offset3D(part, k.Clearance), top-bb.Min.Z, k.Clearance))
+
+	// clamp slots
+	if k.SlotWidth > 0 {
+		if k.SlotDepth <= 0 || k.SlotDepth > top-bottom {
+			return nil, errors.New("bad SlotDepth")
+		}
+		slot := Box3D(V3{k.SlotWidth, size.Y, 2 * k.SlotDepth}, 0)
+		x := 0.25 * bb.Size().X
+		c := bb.Center()
+		slots := Union3D(
+			Transform3D(slot, Translate3d(V3{c.X - x, c.Y, top})),
+			Transform3D(slot, Translate3d(V3{c.X + x, c.Y, top})),
+		)
+		cavity = Union3D(cavity, slots)
+	}
+	return Difference3D(block, cavity), nil
+}
+
+//-----------------------------------------------------------------------------
+// Pill container (a two part screw together sphere/capsule)
+
+// PillContainerParms defines the parameters for a pill container.
+type PillContainerParms struct {
+	Radius       float64 // outer radius
+	Length       float64 // overall length (2 * Radius for a sphere)
+	Wall         float64 // wall thickness
+	ThreadPitch  float64 // thread to thread distance
+	ThreadLength float64 // length of the threaded joint
+	Clearance    float64 // subtract from external thread radius
+	KnurlPitch   float64 // grip knurl pitch (0 == no knurl)
+	KnurlHeight  float64 // grip knurl height
+}
+
+// PillContainer returns the bottom and top halves of a container that screw
+// together. The closed container is a capsule on the z-axis, a sphere has
+// a cylindrical band of ThreadLength at the joint. The bottom half has an
+// external thread on a neck that screws into the top half. The halves are
+// in their assembled positions.
+func PillContainer(k *PillContainerParms) ([]SDF3, error) {
+	// validate parameters
+	if k.Radius <= 0 {
+		return nil, errors.New("Radius <= 0")
+	}
+	if k.Length < 2*k.Radius {
+		return nil, errors.New("Length < 2 * Radius")
+	}
+	if k.ThreadPitch <= 0 {
+		return nil, errors.New("ThreadPitch <= 0")
+	}
+	if k.ThreadLength < k.ThreadPitch {
+		return nil, errors.New("ThreadLength < ThreadPitch")
+	}
+	if k.Wall <= k.ThreadPitch {
+		return nil, errors.New("Wall <= ThreadPitch")
+	}
+	if k.Wall+k.ThreadPitch >= k.Radius {
+		return nil, errors.New("Wall + ThreadPitch >= Radius")
+	}
+	if k.Clearance < 0 {
+		return nil, errors.New("Clearance < 0")
+	}
+	if k.KnurlPitch < 0 || (k.KnurlPitch > 0 && k.KnurlHeight <= 0) {
+		return nil, errors.New("bad knurl parameters")
+	}
+
+	r := k.Radius
+	p := k.ThreadPitch
+	tl := k.ThreadLength
+	// half length of the straight section
+	s := Max(0.5*k.Length-r, 0.5*tl)
+	// the top half slides over the neck from the joint at z0
+	z0 := s - tl
+	// thread radius (the top half keeps half the wall outside the thread)
+	rt := r - 0.5*k.Wall
+
+	outer := Pill3D(2*(s+r), r)
+	if k.KnurlPitch > 0 {
+		// knurl the straight sections of each half
+		knurl := func(za, zb float64) SDF3 {
+			if zb-za < k.KnurlPitch {
+				return nil
+			}
+			knurl := Knurl3D(zb-za, r, k.KnurlPitch, k.KnurlHeight, DtoR(45))
+			return Transform3D(knurl, Translate3d(V3{0, 0, 0.5 * (za + zb)}))
+		}
+		outer = Union3D(outer, knurl(-s, z0), knurl(z0, s))
+	}
+	cavity := Pill3D(2*(s+r-k.Wall), r-k.Wall)
+
+	// bottom: external thread on a neck
+	neck := Screw3D(ISOThread(rt-k.Clearance, p, "external"), tl, p, 1)
+	neck = ChamferedCylinder(neck, 0, 0.5)
+	neck = Difference3D(neck, Cylinder3D(tl+2*p, r-k.Wall-p, 0))
+	neck = Transform3D(neck, Translate3d(V3{0, 0, z0 + 0.5*tl}))
+	bottom := Difference3D(Cut3D(outer, V3{0, 0, z0}, V3{0, 0, -1}), cavity)
+	bottom = Union3D(bottom, neck)
+
+	// top: internal thread over the neck
+	thread := Screw3D(ISOThread(rt, p, "internal"), tl+2*p, p, 1)
+	thread = Transform3D(thread, Translate3d(V3{0, 0, z0 + 0.5*tl}))
+	top := Difference3D(Cut3D(outer, V3{0, 0, z0}, V3{0, 0, 1}), Union3D(cavity, thread))
+
+	return []SDF3{bottom, top}, nil
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,398 @@
+//-----------------------------------------------------------------------------
+/*
+
+Mesh Simplification
+
+Reduce the number of triangles in a mesh with quadric error metric edge
+collapse (Garland & Heckbert). Marching cubes output has far more triangles
+than are needed to describe flat faces, these are merged into a few large
+triangles.
+
+Each vertex has a quadric (the sum of squared distances to the planes of
+its triangles). The edge with the lowest error is collapsed to a single
+vertex at the position with the least error, and the quadrics are summed.
+
+The error of a collapse is the sum of the squared distances from the new
+vertex to the original planes, so the distance from the simplified surface
+to the original surface is no more than the square root of the error.
+
+Collapses that would change the topology of the mesh (e.g. close a hole
+or pinch a thin part) or flip a triangle are not done, so a watertight
+mesh stays watertight. Open edges are kept in place.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"container/heap"
+	"math"
+)
+
+//-----------------------------------------------------------------------------
+
+// boundaryWeight is the weight of the planes that hold open edges in place.
+const boundaryWeight = 1000
+
+// minFlipCos is the minimum cosine of the angle a triangle normal can turn through.
+const minFlipCos = 0.2
+
+// quadric is a symmetric 4x4 matrix (upper triangle).
+type quadric [10]float64
+
+// planeQuadric returns the quadric for the plane n.p + d = 0.
+func planeQuadric(n V3, d, weight float64) quadric {
+	a, b, c := n.X, n.Y, n.Z
+	return quadric{
+		a * a, a * b, a * c, a * d,
+		b * b, b * c, b * d,
+		c * c, c * d,
+		d * d,
+	}.mul(weight)
+}
+
+func (q quadric) mul(k float64) quadric {
+	for i := range q {
+		q[i] *= k
+	}
+	return q
+}
+
+func (q quadric) add(r quadric) quadric {
+	for i := range q {
+		q[i] += r[i]
+	}
+	return q
+}
+
+// error returns the error of a position.
+func (q *quadric) error(p V3) float64 {
+	x, y, z := p.X, p.Y, p.Z
+	return q[0]*x*x + 2*q[1]*x*y + 2*q[2]*x*z + 2*q[3]*x +
+		q[4]*y*y + 2*q[5]*y*z + 2*q[6]*y +
+		q[7]*z*z + 2*q[8]*z +
+		q[9]
+}
+
+// minimum returns the position with the least error (if it's well defined).
+func (q *quadric) minimum() (V3, bool) {
+	// solve A.p = -b
+	a := [3][3]float64{{q[0], q[1], q[2]}, {q[1], q[4], q[5]}, {q[2], q[5], q[7]}}
+	b := V3{-q[3], -q[6], -q[8]}
+	det := a[0][0]*(a[1][1]*a[2][2]-a[1][2]*a[2][1]) -
+		a[0][1]*(a[1][0]*a[2][2]-a[1][2]*a[2][0]) +
+		a[0][2]*(a[1][0]*a[2][1]-a[1][1]*a[2][0])
+	scale := q[0] + q[4] + q[7]
+	if Abs(det) <= 1e-9*scale*scale*scale {
+		return V3{}, false
+	}
+	// Cramer's rule
+	col := func(i int) float64 {
+		m := a
+		m[0][i], m[1][i], m[2][i] = b.X, b.Y, b.Z
+		return m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+			m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+			m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	}
+	return V3{col(0), col(1), col(2)}.DivScalar(det), true
+}
+
+//-----------------------------------------------------------------------------
+
+// collapse is a candidate edge collapse.
+type collapse struct {
+	u, v   int     // edge vertices
+	cost   float64 // error of the collapse
+	p      V3      // position of the collapsed vertex
+	su, sv int     // vertex stamps when the collapse was queued
+}
+
+type collapseHeap []*collapse
+
+func (h collapseHeap) Len() int            { return len(h) }
+func (h collapseHeap) Less(i, j int) bool  { return h[i].cost < h[j].cost }
+func (h collapseHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *collapseHeap) Push(x interface{}) { *h = append(*h, x.(*collapse)) }
+func (h *collapseHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// simplifier is the mesh state for simplification.
+type simplifier struct {
+	vertex    []V3
+	q         []quadric
+	stamp     []int   // incremented when a vertex changes (-1 == removed)
+	vertFaces [][]int // faces using each vertex
+	face      []repairFace
+	alive     []bool
+	faces     int // number of alive faces
+	queue     collapseHeap
+}
+
+// neighbours returns the vertices connected to vertex u.
+func (s *simplifier) neighbours(u int) map[int]bool {
+	n := make(map[int]bool)
+	for _, i := range s.vertFaces[u] {
+		if !s.alive[i] {
+			continue
+		}
+		for _, w := range s.face[i].v {
+			if w != u {
+				n[w] = true
+			}
+		}
+	}
+	return n
+}
+
+// queueEdge queues the collapse of an edge.
+func (s *simplifier) queueEdge(u, v int) {
+	q := s.q[u].add(s.q[v])
+	pu, pv := s.vertex[u], s.vertex[v]
+	mid := pu.Add(pv).MulScalar(0.5)
+	best := &collapse{u: u, v: v, su: s.stamp[u], sv: s.stamp[v]}
+	best.p, best.cost = mid, q.error(mid)
+	candidates := []V3{pu, pv}
+	if p, ok := q.minimum(); ok && p.Sub(mid).Length() <= pu.Sub(pv).Length() {
+		// the optimal position (if it's near the edge)
+		candidates = append(candidates, p)
+	}
+	for _, p := range candidates {
+		if e := q.error(p); e < best.cost {
+			best.p, best.cost = p, e
+		}
+	}
+	heap.Push(&s.queue, best)
+}
+
+// faceNormal returns the (unnormalized) normal of a face with vertex u moved to p.
+func (s *simplifier) faceNormal(f *repairFace, u int, p V3) V3 {
+	var v [3]V3
+	for i, j := range f.v {
+		v[i] = s.vertex[j]
+		if j == u {
+			v[i] = p
+		}
+	}
+	return v[1].Sub(v[0]).Cross(v[2].Sub(v[0]))
+}
+
+// valid returns true if a collapse keeps the topology and doesn't flip triangles.
+func (s *simplifier) valid(c *collapse) bool {
+	// the shared neighbours must be the opposite vertices of the edge faces
+	nu, nv := s.neighbours(c.u), s.neighbours(c.v)
+	shared := 0
+	for w := range nu {
+		if nv[w] {
+			shared++
+		}
+	}
+	edgeFaces := 0
+	for _, i := range s.vertFaces[c.u] {
+		if !s.alive[i] {
+			continue
+		}
+		for _, w := range s.face[i].v {
+			if w == c.v {
+				edgeFaces++
+			}
+		}
+	}
+	if shared != edgeFaces {
+		return false
+	}
+	// don't collapse a closed part down to nothing
+	if len(nu)+len(nv)-shared <= 4 {
+		return false
+	}
+	// the faces that move mustn't flip
+	for _, u := range [2]int{c.u, c.v} {
+		for _, i := range s.vertFaces[u] {
+			f := &s.face[i]
+			if !s.alive[i] {
+				continue
+			}
+			if f.v[0] == c.u+c.v-u || f.v[1] == c.u+c.v-u || f.v[2] == c.u+c.v-u {
+				// this face is removed
+				continue
+			}
+			n0 := s.faceNormal(f, u, s.vertex[u])
+			n1 := s.faceNormal(f, u, c.p)
+			l0, l1 := n0.Length(), n1.Length()
+			if l0 == 0 {
+				continue
+			}
+			if l1 == 0 || n0.Dot(n1) < minFlipCos*l0*l1 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// collapse collapses vertex v into vertex u.
+func (s *simplifier) collapse(c *collapse) {
+	u, v := c.u, c.v
+	var faces []int
+	for _, i := range s.vertFaces[u] {
+		if s.alive[i] {
+			faces = append(faces, i)
+		}
+	}
+	for _, i := range s.vertFaces[v] {
+		f := &s.face[i]
+		if !s.alive[i] {
+			continue
+		}
+		if f.v[0] == u || f.v[1] == u || f.v[2] == u {
+			// the edge faces are removed
+			s.alive[i] = false
+			s.faces--
+			continue
+		}
+		for j := range f.v {
+			if f.v[j] == v {
+				f.v[j] = u
+			}
+		}
+		faces = append(faces, i)
+	}
+	// remove the dead faces from the list
+	n := 0
+	for _, i := range faces {
+		if s.alive[i] {
+			faces[n] = i
+			n++
+		}
+	}
+	s.vertFaces[u] = faces[:n]
+	s.vertFaces[v] = nil
+	s.vertex[u] = c.p
+	s.q[u] = s.q[u].add(s.q[v])
+	s.stamp[u]++
+	s.stamp[v] = -1
+	// requeue the edges of the new vertex
+	for w := range s.neighbours(u) {
+		s.queueEdge(u, w)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// SimplifyParms defines the parameters for mesh simplification.
+type SimplifyParms struct {
+	TargetCount int     // stop at this number of triangles (0 == no target)
+	MaxError    float64 // maximum distance from the original surface (0 == no limit with a target count)
+}
+
+// Simplify reduces the number of triangles in a mesh. Edges are collapsed
+// until the triangle count is reduced to the target count, or a collapse
+// would exceed the maximum error.
+func Simplify(mesh []*Triangle3, k *SimplifyParms) []*Triangle3 {
+	if k.TargetCount < 0 {
+		panic("TargetCount < 0")
+	}
+	if k.MaxError < 0 {
+		panic("MaxError < 0")
+	}
+	maxCost := k.MaxError * k.MaxError
+	if k.MaxError == 0 && k.TargetCount > 0 {
+		maxCost = math.Inf(1)
+	}
+
+	// indexed mesh
+	w := newWelder(0)
+	s := simplifier{}
+	for _, t := range mesh {
+		f := repairFace{attribute: t.Attribute}
+		for i := range t.V {
+			f.v[i], _ = w.index(t.V[i])
+		}
+		if f.v[0] == f.v[1] || f.v[1] == f.v[2] || f.v[2] == f.v[0] {
+			continue
+		}
+		s.face = append(s.face, f)
+	}
+	s.vertex = w.vertex
+	n := len(s.vertex)
+	s.q = make([]quadric, n)
+	s.stamp = make([]int, n)
+	s.vertFaces = make([][]int, n)
+	s.alive = make([]bool, len(s.face))
+	s.faces = len(s.face)
+
+	// vertex quadrics
+	edges := make(map[[2]int][]int)
+	for i := range s.face {
+		f := &s.face[i]
+		s.alive[i] = true
+		nf := s.faceNormal(f, -1, V3{})
+		var q quadric
+		if nf.Length() > 0 {
+			nf = nf.Normalize()
+			q = planeQuadric(nf, -nf.Dot(s.vertex[f.v[0]]), 1)
+		}
+		for j, u := range f.v {
+			s.q[u] = s.q[u].add(q)
+			s.vertFaces[u] = append(s.vertFaces[u], i)
+			e := edgeKey(u, f.v[(j+1)%3])
+			edges[e] = append(edges[e], i)
+		}
+	}
+	// hold the open edges in place
+	for e, faces := range edges {
+		if len(faces) != 1 {
+			continue
+		}
+		nf := s.faceNormal(&s.face[faces[0]], -1, V3{})
+		p0, p1 := s.vertex[e[0]], s.vertex[e[1]]
+		np := p1.Sub(p0).Cross(nf)
+		if np.Length() == 0 {
+			continue
+		}
+		np = np.Normalize()
+		q := planeQuadric(np, -np.Dot(p0), boundaryWeight)
+		s.q[e[0]] = s.q[e[0]].add(q)
+		s.q[e[1]] = s.q[e[1]].add(q)
+	}
+	for e := range edges {
+		s.queueEdge(e[0], e[1])
+	}
+
+	// collapse the edges
+	for s.queue.Len() > 0 {
+		if k.TargetCount > 0 && s.faces <= k.TargetCount {
+			break
+		}
+		c := heap.Pop(&s.queue).(*collapse)
+		if c.su != s.stamp[c.u] || c.sv != s.stamp[c.v] {
+			// out of date
+			continue
+		}
+		if c.cost > maxCost {
+			break
+		}
+		if s.valid(c) {
+			s.collapse(c)
+		}
+	}
+
+	// back to triangles
+	var out []*Triangle3
+	for i, f := range s.face {
+		if s.alive[i] {
+			out = append(out, &Triangle3{
+				V:         [3]V3{s.vertex[f.v[0]], s.vertex[f.v[1]], s.vertex[f.v[2]]},
+				Attribute: f.attribute,
+			})
+		}
+	}
+	return out
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,123 @@
+//-----------------------------------------------------------------------------
+/*
+
+Polyline Simplification
+
+Marching squares generates a line segment for each boundary square, so a
+straight edge is thousands of tiny collinear segments. Douglas-Peucker
+simplification removes the vertices that are within a tolerance of the
+simplified polyline, so straight edges become single segments and curves
+have segments sized for the tolerance.
+
+A polyline keeps its end points. A closed loop is split into two polylines
+at two extreme vertices. A loop that is thinner than the tolerance
+collapses (it has less than 3 vertices).
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+//-----------------------------------------------------------------------------
+
+// simplifyMarks marks the vertices of a polyline kept by Douglas-Peucker simplification.
+func simplifyMarks(v V2Set, tolerance float64) []bool {
+	keep := make([]bool, len(v))
+	keep[0] = true
+	keep[len(v)-1] = true
+	// ranges of vertices to simplify (a stack rather than recursion)
+	stack := [][2]int{{0, len(v) - 1}}
+	for len(stack) != 0 {
+		r := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		// find the vertex farthest from the segment
+		dmax := 0.0
+		k := -1
+		for i := r[0] + 1; i < r[1]; i++ {
+			if d := sdfSegment2d(v[i], v[r[0]], v[r[1]]); d > dmax {
+				dmax = d
+				k = i
+			}
+		}
+		if k >= 0 && dmax > tolerance {
+			keep[k] = true
+			stack = append(stack, [2]int{r[0], k}, [2]int{k, r[1]})
+		}
+	}
+	return keep
+}
+
+// SimplifyPolyline returns a polyline with the vertices within tolerance of
+// the simplified polyline removed. The end points are kept.
+func SimplifyPolyline(v V2Set, tolerance float64) V2Set {
+	if len(v) < 3 {
+		return v
+	}
+	var out V2Set
+	for i, keep := range simplifyMarks(v, tolerance) {
+		if keep {
+			out = append(out, v[i])
+		}
+	}
+	return out
+}
+
+// SimplifyLoop returns a closed loop with the vertices within tolerance of
+// the simplified loop removed. It returns nil if the loop collapses.
+func SimplifyLoop(v V2Set, tolerance float64) V2Set {
+	if len(v) < 3 {
+		return nil
+	}
+	// Split the loop at two extreme vertices: the vertex farthest from the
+	// first vertex, and the vertex farthest from that.
+	farthest := func(v V2Set) int {
+		k := 0
+		dmax := 0.0
+		for i, p := range v {
+			if d := p.Sub(v[0]).Length2(); d > dmax {
+				dmax = d
+				k = i
+			}
+		}
+		return k
+	}
+	k := farthest(v)
+	v = append(append(V2Set{}, v[k:]...), v[:k]...)
+	m := farthest(v)
+	if m == 0 {
+		return nil
+	}
+	v0 := SimplifyPolyline(v[:m+1], tolerance)
+	v1 := SimplifyPolyline(append(v[m:], v[0]), tolerance)
+	out := append(v0, v1[1:len(v1)-1]...)
+	if len(out) < 3 {
+		return nil
+	}
+	return out
+}
+
+//-----------------------------------------------------------------------------
+
+// Simplify simplifies the loops of a contour tree. A loop that collapses is left unchanged.
+func (t *ContourTree) Simplify(tolerance float64) {
+	for _, c := range t.All() {
+		if v := SimplifyLoop(c.Points, tolerance); v != nil {
+			c.Points = v
+		}
+	}
+}
+
+// SimplifyLines joins line segments into loops, simplifies the loops and
+// returns the line segments of the simplified loops. Collapsed loops are removed.
+func SimplifyLines(lines []*Line, tolerance float64) []*Line {
+	var out []*Line
+	for _, loop := range chainLines(lines) {
+		v := SimplifyLoop(loop, tolerance)
+		for i := range v {
+			out = append(out, &Line{v[i], v[(i+1)%len(v)]})
+		}
+	}
+	return out
+}
+
+//-----------------------------------------------------------------------------
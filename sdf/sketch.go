@@ -0,0 +1,436 @@
+//-----------------------------------------------------------------------------
+/*
+
+2D Constraint Sketches
+
+A sketch has points, lines (between two points) and arcs (a center and
+counter-clockwise from a start point to an end point). The point positions
+are initial guesses, the constraints (coincident, distance, angle, tangent,
+etc.) are declared between the entities and Solve moves the points until
+the constraints are satisfied. Polygon then walks a closed loop of lines and
+arcs to build a polygon.
+
+The solver is damped least squares (Levenberg-Marquardt) on the coordinates
+of the points that aren't fixed. Constraints like angles and tangency have
+more than one solution, the solver finds the one nearest the initial
+guesses, so sketch the points roughly where they should be.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+//-----------------------------------------------------------------------------
+
+const sketchTolerance = 1e-6 // distance between coincident points after solving
+
+// SketchPoint is a point in a sketch.
+type SketchPoint struct {
+	P     V2   // position
+	fixed bool // the position isn't changed by the solver
+}
+
+// SketchLine is a line segment between two sketch points.
+type SketchLine struct {
+	P0, P1 *SketchPoint
+}
+
+// SketchArc is an arc about a center point, counter-clockwise from P0 to P1.
+type SketchArc struct {
+	Center, P0, P1 *SketchPoint
+}
+
+// SketchEdge is a line or arc that can be part of a polygon loop.
+type SketchEdge interface {
+	vertices(facets int) []V2 // vertices from the start to the end of the edge
+}
+
+// Sketch is a set of 2d points, lines and arcs with constraints.
+type Sketch struct {
+	points     []*SketchPoint
+	constraint []func() float64 // residuals, zero when the constraints are satisfied
+}
+
+// NewSketch returns an empty sketch.
+func NewSketch() *Sketch {
+	return &Sketch{}
+}
+
+//-----------------------------------------------------------------------------
+// Entities
+
+// Point adds a point to the sketch at an initial position.
+func (s *Sketch) Point(x, y float64) *SketchPoint {
+	p := &SketchPoint{P: V2{x, y}}
+	s.points = append(s.points, p)
+	return p
+}
+
+// Fix stops the solver from moving a point.
+func (s *Sketch) Fix(p *SketchPoint) {
+	p.fixed = true
+}
+
+// Line returns a line between two sketch points.
+func (s *Sketch) Line(p0, p1 *SketchPoint) *SketchLine {
+	return &SketchLine{p0, p1}
+}
+
+// Arc adds an arc to the sketch. The start and end points are constrained
+// to be the same distance from the center.
+func (s *Sketch) Arc(center, p0, p1 *SketchPoint) *SketchArc {
+	a := &SketchArc{center, p0, p1}
+	s.add(func() float64 { return a.P1.P.Sub(a.Center.P).Length() - a.Radius() })
+	return a
+}
+
+// Radius returns the radius of an arc.
+func (a *SketchArc) Radius() float64 {
+	return a.P0.P.Sub(a.Center.P).Length()
+}
+
+// vertices returns the vertices of a line.
+func (l *SketchLine) vertices(facets int) []V2 {
+	return []V2{l.P0.P, l.P1.P}
+}
+
+// vertices returns the vertices of an arc.
+func (a *SketchArc) vertices(facets int) []V2 {
+	c := a.Center.P
+	r := a.Radius()
+	d0 := a.P0.P.Sub(c)
+	d1 := a.P1.P.Sub(c)
+	a0 := math.Atan2(d0.Y, d0.X)
+	a1 := math.Atan2(d1.Y, d1.X)
+	if a1 <= a0 {
+		a1 += Tau
+	}
+	n := int(math.Ceil(float64(facets) * (a1 - a0) / Tau))
+	if n < 1 {
+		n = 1
+	}
+	v := make([]V2, n+1)
+	v[0] = a.P0.P
+	for i := 1; i < n; i++ {
+		theta := a0 + (a1-a0)*float64(i)/float64(n)
+		v[i] = c.Add(V2{math.Cos(theta), math.Sin(theta)}.MulScalar(r))
+	}
+	v[n] = a.P1.P
+	return v
+}
+
+// direction returns the unit vector of a line.
+func (l *SketchLine) direction() V2 {
+	return l.P1.P.Sub(l.P0.P).Normalize()
+}
+
+//-----------------------------------------------------------------------------
+// Constraints
+
+// add adds a constraint residual to the sketch.
+func (s *Sketch) add(r ...func() float64) {
+	s.constraint = append(s.constraint, r...)
+}
+
+// Coincident constrains two points to the same position.
+func (s *Sketch) Coincident(a, b *SketchPoint) {
+	s.add(func() float64 { return a.P.X - b.P.X }, func() float64 { return a.P.Y - b.P.Y })
+}
+
+// Distance constrains the distance between two points.
+func (s *Sketch) Distance(a, b *SketchPoint, d float64) {
+	s.add(func() float64 { return a.P.Sub(b.P).Length() - d })
+}
+
+// Length constrains the length of a line.
+func (s *Sketch) Length(l *SketchLine, d float64) {
+	s.Distance(l.P0, l.P1, d)
+}
+
+// Radius constrains the radius of an arc.
+func (s *Sketch) Radius(a *SketchArc, r float64) {
+	s.Distance(a.Center, a.P0, r)
+}
+
+// Horizontal constrains a line to be parallel to the x-axis.
+func (s *Sketch) Horizontal(l *SketchLine) {
+	s.add(func() float64 { return l.P1.P.Y - l.P0.P.Y })
+}
+
+// Vertical constrains a line to be parallel to the y-axis.
+func (s *Sketch) Vertical(l *SketchLine) {
+	s.add(func() float64 { return l.P1.P.X - l.P0.P.X })
+}
+
+// Angle constrains the counter-clockwise angle (radians) from line l0 to line l1.
+func (s *Sketch) Angle(l0, l1 *SketchLine, angle float64) {
+	sin, cos := math.Sincos(angle)
+	s.add(func() float64 {
+		// sin(theta - angle)
+		u0 := l0.direction()
+		u1 := l1.direction()
+		return u0.Cross(u1)*cos - u0.Dot(u1)*sin
+	})
+}
+
+// Parallel constrains two lines to be parallel.
+func (s *Sketch) Parallel(l0, l1 *SketchLine) {
+	s.Angle(l0, l1, 0)
+}
+
+// Perpendicular constrains two lines to be perpendicular.
+func (s *Sketch) Perpendicular(l0, l1 *SketchLine) {
+	s.Angle(l0, l1, 0.5*Pi)
+}
+
+// OnLine constrains a point to lie on the (infinite) line through a line segment.
+func (s *Sketch) OnLine(p *SketchPoint, l *SketchLine) {
+	s.add(func() float64 { return l.direction().Cross(p.P.Sub(l.P0.P)) })
+}
+
+// OnArc constrains a point to lie on the circle of an arc.
+func (s *Sketch) OnArc(p *SketchPoint, a *SketchArc) {
+	s.add(func() float64 { return p.P.Sub(a.Center.P).Length() - a.Radius() })
+}
+
+// shared returns a point shared by two entities, or nil.
+func shared(a, b []*SketchPoint) *SketchPoint {
+	for _, p := range a {
+		for _, q := range b {
+			if p == q {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+// Tangent constrains a line to be tangent to the circle of an arc. If the
+// line and the arc share an end point, they are tangent at that point.
+func (s *Sketch) Tangent(l *SketchLine, a *SketchArc) {
+	if p := shared([]*SketchPoint{l.P0, l.P1}, []*SketchPoint{a.P0, a.P1}); p != nil {
+		// the radius is perpendicular to the line
+		s.add(func() float64 { return l.direction().Dot(p.P.Sub(a.Center.P).Normalize()) })
+		return
+	}
+	s.add(func() float64 {
+		return math.Abs(l.direction().Cross(a.Center.P.Sub(l.P0.P))) - a.Radius()
+	})
+}
+
+// TangentArcs constrains the circles of two arcs to be tangent. If the arcs
+// share an end point, they are tangent at that point. Otherwise the arcs
+// touch externally unless one circle is inside the other in the initial
+// sketch.
+func (s *Sketch) TangentArcs(a0, a1 *SketchArc) {
+	if p := shared([]*SketchPoint{a0.P0, a0.P1}, []*SketchPoint{a1.P0, a1.P1}); p != nil {
+		// the centers and the shared point are collinear
+		s.add(func() float64 {
+			return p.P.Sub(a0.Center.P).Normalize().Cross(p.P.Sub(a1.Center.P).Normalize())
+		})
+		return
+	}
+	internal := a0.Center.P.Sub(a1.Center.P).Length() < math.Abs(a0.Radius()-a1.Radius())
+	s.add(func() float64 {
+		d := a0.Center.P.Sub(a1.Center.P).Length()
+		if internal {
+			return d - math.Abs(a0.Radius()-a1.Radius())
+		}
+		return d - (a0.Radius() + a1.Radius())
+	})
+}
+
+//-----------------------------------------------------------------------------
+// Solver
+
+// residuals returns the constraint residuals and their sum of squares.
+func (s *Sketch) residuals() ([]float64, float64) {
+	r := make([]float64, len(s.constraint))
+	sum := 0.0
+	for i, f := range s.constraint {
+		r[i] = f()
+		sum += r[i] * r[i]
+	}
+	return r, sum
+}
+
+// solveLinear solves a*x = b (n x n, row major) by gaussian elimination.
+func solveLinear(a, b []float64, n int) ([]float64, bool) {
+	for k := 0; k < n; k++ {
+		// partial pivoting
+		p := k
+		for i := k + 1; i < n; i++ {
+			if math.Abs(a[i*n+k]) > math.Abs(a[p*n+k]) {
+				p = i
+			}
+		}
+		if a[p*n+k] == 0 {
+			return nil, false
+		}
+		if p != k {
+			for j := 0; j < n; j++ {
+				a[k*n+j], a[p*n+j] = a[p*n+j], a[k*n+j]
+			}
+			b[k], b[p] = b[p], b[k]
+		}
+		for i := k + 1; i < n; i++ {
+			f := a[i*n+k] / a[k*n+k]
+			for j := k; j < n; j++ {
+				a[i*n+j] -= f * a[k*n+j]
+			}
+			b[i] -= f * b[k]
+		}
+	}
+	x := make([]float64, n)
+	for i := n - 1; i >= 0; i-- {
+		sum := b[i]
+		for j := i + 1; j < n; j++ {
+			sum -= a[i*n+j] * x[j]
+		}
+		x[i] = sum / a[i*n+i]
+	}
+	return x, true
+}
+
+// Solve moves the points of the sketch to satisfy the constraints. It
+// returns an error if the constraints can't be satisfied.
+func (s *Sketch) Solve() error {
+	// the coordinates of the free points
+	var vars []*float64
+	for _, p := range s.points {
+		if !p.fixed {
+			vars = append(vars, &p.P.X, &p.P.Y)
+		}
+	}
+	n := len(vars)
+	m := len(s.constraint)
+	const tol = 1e-20 // sum of squared residuals
+	r, cost := s.residuals()
+	if cost < tol {
+		return nil
+	}
+	if n == 0 {
+		return errors.New("sketch constraints can't be satisfied (no free points)")
+	}
+
+	jac := make([]float64, m*n)
+	x0 := make([]float64, n)
+	lambda := 1e-3
+	for iter := 0; iter < 200 && cost >= tol; iter++ {
+		// numeric jacobian
+		for j, v := range vars {
+			x := *v
+			h := 1e-8 * math.Max(1, math.Abs(x))
+			*v = x + h
+			rh, _ := s.residuals()
+			*v = x
+			for i := range rh {
+				jac[i*n+j] = (rh[i] - r[i]) / h
+			}
+		}
+		// normal equations: (J'J + lambda*diag(J'J)) dx = -J'r
+		jtj := make([]float64, n*n)
+		jtr := make([]float64, n)
+		for i := 0; i < m; i++ {
+			row := jac[i*n : (i+1)*n]
+			for j := 0; j < n; j++ {
+				if row[j] == 0 {
+					continue
+				}
+				jtr[j] -= row[j] * r[i]
+				for k := 0; k < n; k++ {
+					jtj[j*n+k] += row[j] * row[k]
+				}
+			}
+		}
+		for j := range x0 {
+			x0[j] = *vars[j]
+		}
+		improved := false
+		for !improved && lambda < 1e12 {
+			a := make([]float64, n*n)
+			copy(a, jtj)
+			for j := 0; j < n; j++ {
+				a[j*n+j] += lambda * (jtj[j*n+j] + 1e-9)
+			}
+			b := make([]float64, n)
+			copy(b, jtr)
+			dx, ok := solveLinear(a, b, n)
+			if ok {
+				for j, v := range vars {
+					*v = x0[j] + dx[j]
+				}
+				if r1, cost1 := s.residuals(); cost1 < cost {
+					r, cost = r1, cost1
+					lambda = math.Max(lambda/10, 1e-12)
+					improved = true
+					continue
+				}
+			}
+			lambda *= 10
+		}
+		if !improved {
+			// no progress
+			for j, v := range vars {
+				*v = x0[j]
+			}
+			break
+		}
+	}
+	if cost >= tol {
+		return fmt.Errorf("sketch constraints can't be satisfied (residual %g)", math.Sqrt(cost))
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// Polygon returns a polygon for a closed loop of sketch lines and arcs.
+// Each edge is walked in whichever direction joins it to the previous edge.
+// Arcs have the given number of facets per full circle.
+func (s *Sketch) Polygon(facets int, edges ...SketchEdge) (*Polygon, error) {
+	if len(edges) < 2 {
+		return nil, errors.New("a polygon needs at least 2 edges")
+	}
+	reverse := func(v []V2) []V2 {
+		for i, j := 0, len(v)-1; i < j; i, j = i+1, j-1 {
+			v[i], v[j] = v[j], v[i]
+		}
+		return v
+	}
+	joined := func(a, b V2) bool {
+		return a.Equals(b, sketchTolerance)
+	}
+	// orient the first edge towards the second
+	v := edges[0].vertices(facets)
+	next := edges[1].vertices(facets)
+	if !joined(v[len(v)-1], next[0]) && !joined(v[len(v)-1], next[len(next)-1]) {
+		v = reverse(v)
+	}
+	for i, e := range edges[1:] {
+		ev := e.vertices(facets)
+		end := v[len(v)-1]
+		if !joined(end, ev[0]) {
+			if !joined(end, ev[len(ev)-1]) {
+				return nil, fmt.Errorf("sketch edges %d and %d aren't joined", i, i+1)
+			}
+			ev = reverse(ev)
+		}
+		v = append(v, ev[1:]...)
+	}
+	if !joined(v[0], v[len(v)-1]) {
+		return nil, errors.New("sketch edges aren't a closed loop")
+	}
+	p := NewPolygon()
+	p.AddV2Set(v[:len(v)-1])
+	p.Close()
+	return p, nil
+}
+
+//-----------------------------------------------------------------------------
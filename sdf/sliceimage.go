@@ -0,0 +1,151 @@
+//-----------------------------------------------------------------------------
+/*
+
+Slice Images
+
+Render a Z-slice through an SDF3 (or the silhouette of the SDF3 projected
+along the Z axis) to a PNG image with a distance field color map. It's a
+quick way to check internal cavities and wall thicknesses without meshing.
+
+Color map:
+
+inside: blue, outside: orange
+The color is darker closer to the surface and the surface is white.
+Optional contour lines are drawn at multiples of a distance, so the
+thickness of a wall can be read off the image (the distance at the middle
+of a wall is half the wall thickness).
+
+The silhouette distance is the minimum distance over Z (see Project2D),
+so outside the silhouette it's the distance to the projected shape and
+inside it's about the depth of the thickest part of the model along the
+projection line.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"runtime"
+	"sync"
+)
+
+//-----------------------------------------------------------------------------
+
+// SliceImageParms defines the parameters for a slice image.
+type SliceImageParms struct {
+	Z          float64 // z height of the slice
+	Silhouette bool    // project the SDF3 along the Z axis (Z is ignored)
+	Pixels     int     // number of pixels on the longest axis of the image
+	Range      float64 // distance for the full color scale (0 == 1/4 of the longest axis)
+	Contour    float64 // distance between contour lines (0 == no contour lines)
+	Path       string  // output filename
+}
+
+// validate checks the slice image parameters.
+func (k *SliceImageParms) validate() error {
+	if k.Pixels < 1 {
+		return errors.New("pixels < 1")
+	}
+	if k.Range < 0 {
+		return errors.New("range < 0")
+	}
+	if k.Contour < 0 {
+		return errors.New("contour < 0")
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// distanceColor returns the color map value for a distance.
+func distanceColor(d, scale, contour, surface float64) color.RGBA {
+	c := V3{0.9, 0.6, 0.3}
+	if d < 0 {
+		c = V3{0.65, 0.85, 1.0}
+	}
+	// darker near the surface
+	c = c.MulScalar(0.2 + 0.8*(1-math.Exp(-3*math.Abs(d)/scale)))
+	if contour > 0 {
+		// thin dark lines at multiples of the contour distance
+		x := math.Abs(d) / contour
+		if math.Abs(x-math.Round(x)) < 0.5*surface/contour && math.Round(x) > 0 {
+			c = c.MulScalar(0.5)
+		}
+	}
+	if math.Abs(d) < surface {
+		c = V3{1, 1, 1}
+	}
+	c = c.MulScalar(255)
+	return color.RGBA{uint8(Clamp(c.X, 0, 255)), uint8(Clamp(c.Y, 0, 255)), uint8(Clamp(c.Z, 0, 255)), 0xff}
+}
+
+// SliceImage renders a Z-slice (or silhouette) of an SDF3 with a distance field color map.
+func SliceImage(s SDF3, k *SliceImageParms) (*image.RGBA, error) {
+	if err := k.validate(); err != nil {
+		return nil, err
+	}
+	bb3 := s.BoundingBox()
+	bb := Box2{V2{bb3.Min.X, bb3.Min.Y}, V2{bb3.Max.X, bb3.Max.Y}}.ScaleAboutCenter(1.1)
+	pixel := bb.Size().MaxComponent() / float64(k.Pixels)
+	size := V2i{
+		int(math.Ceil(bb.Size().X / pixel)),
+		int(math.Ceil(bb.Size().Y / pixel)),
+	}
+
+	var s2 SDF2
+	if k.Silhouette {
+		s2 = Project2D(s, V3{0, 0, 1})
+	} else {
+		if k.Z < bb3.Min.Z || k.Z > bb3.Max.Z {
+			return nil, errors.New("z is outside the bounding box")
+		}
+		s2 = SliceZ2D(s, k.Z)
+	}
+
+	scale := k.Range
+	if scale == 0 {
+		scale = 0.25 * bb.Size().MaxComponent()
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, size[0], size[1]))
+	rows := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for y := range rows {
+				for x := 0; x < size[0]; x++ {
+					// +y is up
+					p := V2{
+						bb.Min.X + (float64(x)+0.5)*pixel,
+						bb.Max.Y - (float64(y)+0.5)*pixel,
+					}
+					img.SetRGBA(x, y, distanceColor(s2.Evaluate(p), scale, k.Contour, pixel))
+				}
+			}
+		}()
+	}
+	for y := 0; y < size[1]; y++ {
+		rows <- y
+	}
+	close(rows)
+	wg.Wait()
+	return img, nil
+}
+
+// RenderSlice renders a Z-slice (or silhouette) of an SDF3 to a PNG file.
+func RenderSlice(s SDF3, k *SliceImageParms) error {
+	img, err := SliceImage(s, k)
+	if err != nil {
+		return err
+	}
+	return savePNG(k.Path, img)
+}
+
+//-----------------------------------------------------------------------------
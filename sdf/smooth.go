@@ -0,0 +1,147 @@
+//-----------------------------------------------------------------------------
+/*
+
+Mesh Smoothing
+
+Remove the staircase artifacts of marching cubes meshes with Laplacian or
+Taubin smoothing. Each iteration moves the vertices towards the average of
+their neighbours and then projects them back onto the SDF3 surface (Newton
+steps along the gradient), so the mesh is relaxed without shrinking the
+model.
+
+Taubin smoothing follows each smoothing step (lambda > 0) with an inflating
+step (mu < 0). The projection makes plain Laplacian smoothing (mu = 0) safe
+to use, Taubin smoothing converges to a more even spacing of the vertices.
+
+Vertices on open edges are not moved. Sharp edges of the model are
+softened (the vertices slide along the surface either side of the edge).
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+//-----------------------------------------------------------------------------
+
+// projectSteps is the number of Newton steps to project a vertex onto the surface.
+const projectSteps = 3
+
+// SmoothParms defines the parameters for mesh smoothing.
+type SmoothParms struct {
+	Iterations int     // number of smoothing iterations
+	Lambda     float64 // smoothing factor (0..1], e.g. 0.5
+	Mu         float64 // inflation factor (< 0) for Taubin smoothing, e.g. -0.53 (0 == Laplacian smoothing)
+}
+
+// laplacian moves the vertices a fraction of the way towards the average of their neighbours.
+func laplacian(vertex []V3, neighbours [][]int, fixed []bool, k float64) {
+	delta := make([]V3, len(vertex))
+	for i, n := range neighbours {
+		if fixed[i] || len(n) == 0 {
+			continue
+		}
+		var sum V3
+		for _, j := range n {
+			sum = sum.Add(vertex[j])
+		}
+		delta[i] = sum.DivScalar(float64(len(n))).Sub(vertex[i])
+	}
+	for i := range vertex {
+		vertex[i] = vertex[i].Add(delta[i].MulScalar(k))
+	}
+}
+
+// project moves a point onto the surface of an SDF3.
+func project(s SDF3, p V3, eps float64) V3 {
+	for i := 0; i < projectSteps; i++ {
+		d := s.Evaluate(p)
+		n := Normal3(s, p, eps)
+		if d == 0 || n == (V3{}) {
+			break
+		}
+		p = p.Sub(n.MulScalar(d))
+	}
+	return p
+}
+
+// SmoothMesh smooths a mesh generated from an SDF3. The vertices are kept on
+// the surface of the SDF3. It returns the smoothed mesh.
+func SmoothMesh(s SDF3, mesh []*Triangle3, k *SmoothParms) []*Triangle3 {
+	if k.Iterations < 0 {
+		panic("Iterations < 0")
+	}
+	if k.Lambda <= 0 || k.Lambda > 1 {
+		panic("Lambda must be (0..1]")
+	}
+	if k.Mu > 0 {
+		panic("Mu > 0")
+	}
+
+	// indexed mesh
+	w := newWelder(0)
+	faces := make([]repairFace, len(mesh))
+	for i, t := range mesh {
+		faces[i].attribute = t.Attribute
+		for j := range t.V {
+			faces[i].v[j], _ = w.index(t.V[j])
+		}
+	}
+	vertex := w.vertex
+
+	// neighbours and open edges
+	edges := make(map[[2]int]int)
+	for _, f := range faces {
+		for j := 0; j < 3; j++ {
+			edges[[2]int{f.v[j], f.v[(j+1)%3]}]++
+		}
+	}
+	neighbours := make([][]int, len(vertex))
+	fixed := make([]bool, len(vertex))
+	length := 0.0
+	for e := range edges {
+		if edges[[2]int{e[1], e[0]}] == 0 {
+			fixed[e[0]] = true
+			fixed[e[1]] = true
+		}
+		if e[0] != e[1] {
+			neighbours[e[0]] = append(neighbours[e[0]], e[1])
+			length += vertex[e[0]].Sub(vertex[e[1]]).Length()
+		}
+	}
+	// Each closed edge appears twice (once in each direction), so each
+	// vertex has its neighbours once. Add the missing direction for open edges.
+	for e := range edges {
+		if edges[[2]int{e[1], e[0]}] == 0 && e[0] != e[1] {
+			neighbours[e[1]] = append(neighbours[e[1]], e[0])
+		}
+	}
+	eps := 1e-3
+	if len(edges) > 0 {
+		// a small fraction of the average edge length
+		eps = 0.01 * length / float64(len(edges))
+	}
+
+	for i := 0; i < k.Iterations; i++ {
+		laplacian(vertex, neighbours, fixed, k.Lambda)
+		if k.Mu != 0 {
+			laplacian(vertex, neighbours, fixed, k.Mu)
+		}
+		for j := range vertex {
+			if !fixed[j] {
+				vertex[j] = project(s, vertex[j], eps)
+			}
+		}
+	}
+
+	// back to triangles
+	out := make([]*Triangle3, len(faces))
+	for i, f := range faces {
+		out[i] = &Triangle3{
+			V:         [3]V3{vertex[f.v[0]], vertex[f.v[1]], vertex[f.v[2]]},
+			Attribute: f.attribute,
+		}
+	}
+	return out
+}
+
+//-----------------------------------------------------------------------------
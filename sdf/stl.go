@@ -12,6 +12,7 @@ import (
 	"bufio"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"os"
 	"sync"
 )
@@ -27,7 +28,7 @@ type STLHeader struct {
 // STLTriangle defines the triangle data within an STL file.
 type STLTriangle struct {
 	Normal, Vertex1, Vertex2, Vertex3 [3]float32
-	_                                 uint16 // Attribute byte count
+	Attribute                         uint16 // Attribute byte count (or color)
 }
 
 //-----------------------------------------------------------------------------
@@ -39,8 +40,12 @@ func SaveSTL(path string, mesh []*Triangle3) error {
 		return err
 	}
 	defer file.Close()
+	return EncodeSTL(file, mesh)
+}
 
-	buf := bufio.NewWriter(file)
+// EncodeSTL writes a triangle mesh to a writer in binary STL format.
+func EncodeSTL(w io.Writer, mesh []*Triangle3) error {
+	buf := bufio.NewWriter(w)
 	header := STLHeader{}
 	header.Count = uint32(len(mesh))
 	if err := binary.Write(buf, binary.LittleEndian, &header); err != nil {
@@ -62,6 +67,7 @@ func SaveSTL(path string, mesh []*Triangle3) error {
 		d.Vertex3[0] = float32(triangle.V[2].X)
 		d.Vertex3[1] = float32(triangle.V[2].Y)
 		d.Vertex3[2] = float32(triangle.V[2].Z)
+		d.Attribute = triangle.Attribute
 		if err := binary.Write(buf, binary.LittleEndian, &d); err != nil {
 			return err
 		}
@@ -116,6 +122,7 @@ func WriteSTL(wg *sync.WaitGroup, path string) (chan<- *Triangle3, error) {
 			d.Vertex3[0] = float32(t.V[2].X)
 			d.Vertex3[1] = float32(t.V[2].Y)
 			d.Vertex3[2] = float32(t.V[2].Z)
+			d.Attribute = t.Attribute
 			if err := binary.Write(buf, binary.LittleEndian, &d); err != nil {
 				fmt.Printf("%s\n", err)
 				return
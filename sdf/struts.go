@@ -0,0 +1,162 @@
+//-----------------------------------------------------------------------------
+/*
+
+Honeycomb and Strut Lattices
+
+Infinite lattices for lightweight infill, evaluated with domain repetition:
+the point is folded into a single cell of the lattice, so the cost of an
+evaluation doesn't depend on the size of the part.
+
+honeycomb: hexagonal cells with walls of constant thickness (2d, for
+extrusion).
+
+cubic: struts along the edges of cubic cells.
+
+octet: struts along the face diagonals of cubic cells (the octet truss,
+each node is connected to its 12 nearest neighbours).
+
+The lattices have exact distance fields. The bounding box is a single cell
+centered on the origin (e.g. for AnalyzeLattice). Intersect the lattice
+with a part to use it as infill.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// fold returns the offset of x from the nearest multiple of a.
+func fold(x, a float64) float64 {
+	return x - a*math.Round(x/a)
+}
+
+//-----------------------------------------------------------------------------
+
+// HoneycombSDF2 is a hexagonal honeycomb.
+type HoneycombSDF2 struct {
+	cell float64 // distance between cell centers
+	wall float64 // half wall thickness
+	bb   Box2
+}
+
+// Honeycomb2D returns an SDF2 for a hexagonal honeycomb. The cell size is the
+// distance between the centers of adjacent cells (flat to flat).
+func Honeycomb2D(cell, wall float64) SDF2 {
+	if cell <= 0 {
+		panic("cell <= 0")
+	}
+	if wall <= 0 || wall >= cell {
+		panic("bad wall thickness")
+	}
+	s := HoneycombSDF2{}
+	s.cell = cell
+	s.wall = 0.5 * wall
+	// a cell with its walls
+	d := V2{0.5 * (cell + wall), (cell + wall) / math.Sqrt(3)}
+	s.bb = Box2{d.Neg(), d}
+	return &s
+}
+
+// Evaluate returns the minimum distance to a honeycomb.
+func (s *HoneycombSDF2) Evaluate(p V2) float64 {
+	// The cell centers are two rectangular grids, find the nearest center.
+	a := s.cell
+	b := s.cell * math.Sqrt(3)
+	q0 := V2{fold(p.X, a), fold(p.Y, b)}
+	q1 := V2{fold(p.X-0.5*a, a), fold(p.Y-0.5*b, b)}
+	q := q0
+	if q1.Length2() < q0.Length2() {
+		q = q1
+	}
+	// distance from the cell center to the nearest wall of the hexagon
+	q = q.Abs()
+	h := Max(q.X, 0.5*q.X+0.5*math.Sqrt(3)*q.Y)
+	return Abs(0.5*a-h) - s.wall
+}
+
+// BoundingBox returns the bounding box of a single cell of a honeycomb.
+func (s *HoneycombSDF2) BoundingBox() Box2 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+
+// StrutLatticeType is the type of a strut lattice.
+type StrutLatticeType int
+
+// Strut lattice types.
+const (
+	CubicLattice StrutLatticeType = iota // struts on the cube edges
+	OctetLattice                         // struts on the cube face diagonals
+)
+
+// StrutLatticeParms defines the parameters for a strut lattice.
+type StrutLatticeParms struct {
+	Type   StrutLatticeType // type of lattice
+	Cell   float64          // cubic cell size
+	Radius float64          // strut radius
+}
+
+// StrutLatticeSDF3 is a strut lattice.
+type StrutLatticeSDF3 struct {
+	octet  bool
+	cell   float64
+	radius float64
+	bb     Box3
+}
+
+// StrutLattice3D returns an SDF3 for a strut lattice.
+func StrutLattice3D(k *StrutLatticeParms) SDF3 {
+	if k.Cell <= 0 {
+		panic("cell <= 0")
+	}
+	if k.Radius <= 0 || k.Radius >= 0.25*k.Cell {
+		panic("bad strut radius")
+	}
+	s := StrutLatticeSDF3{}
+	switch k.Type {
+	case CubicLattice:
+	case OctetLattice:
+		s.octet = true
+	default:
+		panic("bad lattice type")
+	}
+	s.cell = k.Cell
+	s.radius = k.Radius
+	d := 0.5 * k.Cell
+	s.bb = Box3{V3{-d, -d, -d}, V3{d, d, d}}
+	return &s
+}
+
+// Evaluate returns the minimum distance to a strut lattice.
+func (s *StrutLatticeSDF3) Evaluate(p V3) float64 {
+	a := s.cell
+	x, y, z := fold(p.X, a), fold(p.Y, a), fold(p.Z, a)
+	var d2 float64
+	if !s.octet {
+		// the nearest strut parallel to each axis
+		d2 = Min(Min(y*y+z*z, x*x+z*z), x*x+y*y)
+	} else {
+		// The struts in the planes normal to an axis are two families of
+		// parallel lines (along the diagonals). Each family is a rectangular
+		// lattice of lines, a/sqrt(2) apart across the diagonal.
+		c := a / math.Sqrt2
+		d2 = math.MaxFloat64
+		for _, v := range [3]V3{{x, p.Y, p.Z}, {y, p.Z, p.X}, {z, p.X, p.Y}} {
+			u0 := fold((v.Y-v.Z)/math.Sqrt2, c)
+			u1 := fold((v.Y+v.Z)/math.Sqrt2, c)
+			d2 = Min(d2, v.X*v.X+Min(u0*u0, u1*u1))
+		}
+	}
+	return math.Sqrt(d2) - s.radius
+}
+
+// BoundingBox returns the bounding box of a single cell of a strut lattice.
+func (s *StrutLatticeSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
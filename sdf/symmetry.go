@@ -0,0 +1,217 @@
+//-----------------------------------------------------------------------------
+/*
+
+Symmetry
+
+Detect the symmetries of an SDF3 by sampling, and use them to reduce the
+meshing work. Random sampling can miss small features, so the detected
+mirror symmetries are a hint: VerifySymmetry checks them against every
+sample of the meshing grid, and the symmetric mesher uses the symmetries
+given by the caller.
+
+Mirror symmetries are about the x, y and z planes through the center of the
+bounding box. The mesher renders one half (quarter, eighth) of the part and
+reflects the triangles, so each mirror symmetry halves the evaluation cost.
+
+Rotational symmetry is about the z-axis through the center of the bounding
+box. It is detected and reported, but isn't used by the mesher (a wedge of
+the part doesn't line up with the sampling grid).
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+//-----------------------------------------------------------------------------
+
+// maxRotation is the largest order of rotational symmetry that is tested.
+const maxRotation = 12
+
+// Symmetry describes the symmetries of an SDF3.
+type Symmetry struct {
+	Center   V3      `json:"center"`   // center of symmetry
+	Mirror   [3]bool `json:"mirror"`   // mirror symmetry about the x, y, z planes through the center
+	Rotation int     `json:"rotation"` // order of rotational symmetry about the z-axis through the center (1 = none)
+}
+
+// String returns a printable symmetry description.
+func (s *Symmetry) String() string {
+	return fmt.Sprintf("mirror x %t y %t z %t, rotation %d", s.Mirror[0], s.Mirror[1], s.Mirror[2], s.Rotation)
+}
+
+// mirror reflects a point in the plane normal to an axis through c.
+func mirror(p, c V3, axis int) V3 {
+	switch axis {
+	case 0:
+		p.X = 2*c.X - p.X
+	case 1:
+		p.Y = 2*c.Y - p.Y
+	default:
+		p.Z = 2*c.Z - p.Z
+	}
+	return p
+}
+
+// DetectSymmetry tests an SDF3 for symmetries. The SDF3 is sampled at random
+// points in the bounding box, a symmetry is accepted if all of the sampled
+// distances match their symmetric counterparts within tolerance.
+func DetectSymmetry(s SDF3, samples int, tolerance float64) *Symmetry {
+	bb := s.BoundingBox()
+	sym := Symmetry{Center: bb.Center(), Rotation: 1}
+	// use a fixed seed so the results are repeatable
+	r := rand.New(rand.NewSource(1))
+	points := make([]V3, samples)
+	d := make([]float64, samples)
+	size := bb.Size()
+	for i := range points {
+		points[i] = bb.Min.Add(V3{r.Float64(), r.Float64(), r.Float64()}.Mul(size))
+		d[i] = s.Evaluate(points[i])
+	}
+	symmetric := func(f func(p V3) V3) bool {
+		for i, p := range points {
+			if Abs(s.Evaluate(f(p))-d[i]) > tolerance {
+				return false
+			}
+		}
+		return true
+	}
+	for axis := 0; axis < 3; axis++ {
+		sym.Mirror[axis] = symmetric(func(p V3) V3 { return mirror(p, sym.Center, axis) })
+	}
+	for n := maxRotation; n >= 2; n-- {
+		m := Translate3d(sym.Center).Mul(RotateZ(Tau / float64(n))).Mul(Translate3d(sym.Center.Neg()))
+		if symmetric(m.MulPosition) {
+			sym.Rotation = n
+			break
+		}
+	}
+	return &sym
+}
+
+//-----------------------------------------------------------------------------
+
+// GenerateTrianglesSymmetric generates a triangle mesh for an SDF3 with mirror
+// symmetries (uses uniform grid sampling). Only the fundamental domain of the
+// part is sampled, the rest of the mesh is reflected.
+func GenerateTrianglesSymmetric(
+	s SDF3, // sdf3 to render
+	meshCells int, // number of cells on the longest axis. e.g 200
+	sym *Symmetry, // symmetries of the sdf3
+) []*Triangle3 {
+	// The sampling grid starts on the mirror planes, so the vertices on the
+	// planes are unchanged by the reflections and the mesh is watertight.
+	bb, step := symmetricBox(s, meshCells, sym)
+	mesh := marchingCubes(s, bb, step)
+	for axis, mirrored := range sym.Mirror {
+		if !mirrored {
+			continue
+		}
+		n := len(mesh)
+		for _, t := range mesh[:n] {
+			m := Triangle3{Attribute: t.Attribute}
+			for i := range t.V {
+				m.V[i] = mirror(t.V[i], sym.Center, axis)
+			}
+			// a reflection reverses the orientation
+			m.Flip()
+			mesh = append(mesh, &m)
+		}
+	}
+	return mesh
+}
+
+// symmetricBox returns the sampling box of the fundamental domain.
+func symmetricBox(s SDF3, meshCells int, sym *Symmetry) (Box3, float64) {
+	bb, inc, _ := gridSize(s, meshCells)
+	for axis, mirrored := range sym.Mirror {
+		if mirrored {
+			switch axis {
+			case 0:
+				bb.Min.X = sym.Center.X
+			case 1:
+				bb.Min.Y = sym.Center.Y
+			default:
+				bb.Min.Z = sym.Center.Z
+			}
+		}
+	}
+	return bb, inc.MinComponent()
+}
+
+// VerifySymmetry checks the mirror symmetries of an SDF3 on the sampling grid
+// used by GenerateTrianglesSymmetric. Each sample of the fundamental domain
+// is compared with its reflection, and a mirror symmetry is removed if any
+// of the distances don't match within tolerance. This costs about as much
+// as sampling the whole part, but guarantees that the symmetric mesh matches
+// the full mesh.
+func VerifySymmetry(s SDF3, meshCells int, sym *Symmetry, tolerance float64) *Symmetry {
+	v := *sym
+	bb, step := symmetricBox(s, meshCells, sym)
+	steps := bb.Size().DivScalar(step).Ceil().ToV3i()
+	inc := bb.Size().Div(steps.ToV3())
+	n := (steps[1] + 1) * (steps[2] + 1)
+	size := (steps[0] + 1) * n
+	a := make([]float32, size)
+	sampleGrid(s, bb, inc, steps, func(x int, layer []float64) {
+		for i, d := range layer {
+			a[x*n+i] = float32(d)
+		}
+	})
+	b := make([]float32, size)
+	index := func(x, y, z int) int { return (x*(steps[1]+1)+y)*(steps[2]+1) + z }
+	// matches returns true if the samples match the reflected samples
+	matches := func(axis int) bool {
+		for x := 0; x <= steps[0]; x++ {
+			for y := 0; y <= steps[1]; y++ {
+				for z := 0; z <= steps[2]; z++ {
+					i := [3]int{x, y, z}
+					i[axis] = steps[axis] - i[axis]
+					if Abs(float64(a[index(x, y, z)]-b[index(i[0], i[1], i[2])])) > tolerance {
+						return false
+					}
+				}
+			}
+		}
+		return true
+	}
+	for axis, mirrored := range sym.Mirror {
+		if !mirrored {
+			continue
+		}
+		// the reflected grid, the sample order is reversed on the axis
+		mb := Box3{mirror(bb.Max, sym.Center, axis), mirror(bb.Min, sym.Center, axis)}
+		mb.Min, mb.Max = mb.Min.Min(mb.Max), mb.Min.Max(mb.Max)
+		sampleGrid(s, mb, inc, steps, func(x int, layer []float64) {
+			for i, d := range layer {
+				b[x*n+i] = float32(d)
+			}
+		})
+		v.Mirror[axis] = matches(axis)
+	}
+	return &v
+}
+
+// RenderSTLSymmetric renders an SDF3 as an STL file (uses uniform grid sampling).
+// The mirror symmetries of the SDF3 are given by the caller and are used to
+// reduce the sampling. DetectSymmetry samples the SDF3 and can miss small
+// features, so its result should be checked with VerifySymmetry before it
+// is used here. The optional hooks are called for each triangle before it is written.
+func RenderSTLSymmetric(
+	s SDF3, //sdf3 to render
+	meshCells int, //number of cells on the longest axis. e.g 200
+	path string, //path to filename
+	sym *Symmetry, //symmetries of the sdf3
+	hooks ...TriangleHook, //triangle hooks
+) error {
+	fmt.Printf("rendering %s (symmetry: %s)\n", path, sym)
+	m := GenerateTrianglesSymmetric(s, meshCells, sym)
+	checkMesh(s, m, RenderOrient).report()
+	return SaveSTL(path, HookMesh(m, hooks...))
+}
+
+//-----------------------------------------------------------------------------
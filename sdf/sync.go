@@ -0,0 +1,77 @@
+//-----------------------------------------------------------------------------
+/*
+
+Concurrent Evaluation
+
+The renderers evaluate SDFs from multiple goroutines, so Evaluate must be
+safe for concurrent calls. The SDFs in this package are immutable after
+construction (any evaluation caches are locked, see Cache3D) and can be
+shared freely. The renderer caches (lineCache, layerYZ) are per goroutine.
+
+A user SDF with mutable state that isn't safe for concurrent calls can be
+wrapped with Synchronized2D/Synchronized3D. The wrapper serializes the
+calls to Evaluate, so it removes the benefit of parallel rendering for
+that SDF.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "sync"
+
+//-----------------------------------------------------------------------------
+
+// SynchronizedSDF2 serializes the evaluations of an SDF2.
+type SynchronizedSDF2 struct {
+	sdf  SDF2
+	lock sync.Mutex
+}
+
+// Synchronized2D returns an SDF2 that is safe for concurrent evaluation.
+func Synchronized2D(sdf SDF2) SDF2 {
+	return &SynchronizedSDF2{sdf: sdf}
+}
+
+// Evaluate returns the minimum distance to the synchronized SDF2.
+func (s *SynchronizedSDF2) Evaluate(p V2) float64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.sdf.Evaluate(p)
+}
+
+// BoundingBox returns the bounding box of the synchronized SDF2.
+func (s *SynchronizedSDF2) BoundingBox() Box2 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.sdf.BoundingBox()
+}
+
+//-----------------------------------------------------------------------------
+
+// SynchronizedSDF3 serializes the evaluations of an SDF3.
+type SynchronizedSDF3 struct {
+	sdf  SDF3
+	lock sync.Mutex
+}
+
+// Synchronized3D returns an SDF3 that is safe for concurrent evaluation.
+func Synchronized3D(sdf SDF3) SDF3 {
+	return &SynchronizedSDF3{sdf: sdf}
+}
+
+// Evaluate returns the minimum distance to the synchronized SDF3.
+func (s *SynchronizedSDF3) Evaluate(p V3) float64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.sdf.Evaluate(p)
+}
+
+// BoundingBox returns the bounding box of the synchronized SDF3.
+func (s *SynchronizedSDF3) BoundingBox() Box3 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.sdf.BoundingBox()
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,196 @@
+//-----------------------------------------------------------------------------
+/*
+
+Tagged Regions
+
+Tag an SDF3 with a material/color ID so the parts of a multi-material
+model (e.g. a dual extrusion part) can be designed in one CSG tree.
+
+The tag at a point is found by descending the tree:
+
+Union: the tag of the nearest (most inside) SDF3.
+Difference: the tag of the first SDF3 (cut faces are the remaining material).
+Intersection: the tag of the first SDF3, or the second SDF3 if the first is untagged.
+Transform, scale, offset and array: the tag of the underlying SDF3.
+
+Other SDF3s are untagged (tag 0), so tag the result of an operation
+(e.g. a blended union) to tag all of it.
+
+The tagged mesh is grouped by tag (the tag of each triangle is the tag at
+its centroid), and can be written as a multi-material 3MF file (a volume
+and base material per tag) or an OBJ file with a material library.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"image/color"
+	"math"
+	"sort"
+)
+
+//-----------------------------------------------------------------------------
+
+// TaggedSDF3 is implemented by SDF3s with tagged regions.
+type TaggedSDF3 interface {
+	Tag(p V3) int
+}
+
+// TagAt returns the tag of an SDF3 at a point (0 == untagged).
+func TagAt(s SDF3, p V3) int {
+	if t, ok := s.(TaggedSDF3); ok {
+		return t.Tag(p)
+	}
+	return 0
+}
+
+//-----------------------------------------------------------------------------
+
+// TagSDF3 is an SDF3 tagged with a material/color ID.
+type TagSDF3 struct {
+	sdf SDF3
+	tag int
+}
+
+// Tag3D returns an SDF3 tagged with a material/color ID (tag > 0).
+func Tag3D(sdf SDF3, tag int) SDF3 {
+	if tag <= 0 {
+		panic("tag <= 0")
+	}
+	return &TagSDF3{sdf: sdf, tag: tag}
+}
+
+// Evaluate returns the minimum distance to a tagged SDF3.
+func (s *TagSDF3) Evaluate(p V3) float64 {
+	return s.sdf.Evaluate(p)
+}
+
+// EvaluateInterval returns the range of distances to a tagged SDF3 within a box.
+func (s *TagSDF3) EvaluateInterval(b Box3) Interval {
+	return EvaluateInterval3(s.sdf, b)
+}
+
+// BoundingBox returns the bounding box of a tagged SDF3.
+func (s *TagSDF3) BoundingBox() Box3 {
+	return s.sdf.BoundingBox()
+}
+
+// Tag returns the tag of a tagged SDF3.
+func (s *TagSDF3) Tag(p V3) int {
+	return s.tag
+}
+
+//-----------------------------------------------------------------------------
+// Operators
+
+// Tag returns the tag of the nearest SDF3 of a union.
+func (s *UnionSDF3) Tag(p V3) int {
+	tag := 0
+	d := math.Inf(1)
+	for _, x := range s.sdf {
+		if dx := x.Evaluate(p); dx < d {
+			d = dx
+			tag = TagAt(x, p)
+		}
+	}
+	return tag
+}
+
+// Tag returns the tag of a difference.
+func (s *DifferenceSDF3) Tag(p V3) int {
+	return TagAt(s.s0, p)
+}
+
+// Tag returns the tag of an intersection.
+func (s *IntersectionSDF3) Tag(p V3) int {
+	if tag := TagAt(s.s0, p); tag != 0 {
+		return tag
+	}
+	return TagAt(s.s1, p)
+}
+
+// Tag returns the tag of a transformed SDF3.
+func (s *TransformSDF3) Tag(p V3) int {
+	return TagAt(s.sdf, s.inverse.MulPosition(p))
+}
+
+// Tag returns the tag of a scaled SDF3.
+func (s *ScaleUniformSDF3) Tag(p V3) int {
+	return TagAt(s.sdf, p.MulScalar(s.invK))
+}
+
+// Tag returns the tag of an offset SDF3.
+func (s *OffsetSDF3) Tag(p V3) int {
+	return TagAt(s.sdf, p)
+}
+
+// Tag returns the tag of the nearest SDF3 of an array.
+func (s *ArraySDF3) Tag(p V3) int {
+	var q V3
+	d := math.Inf(1)
+	for j := 0; j < s.num[0]; j++ {
+		for k := 0; k < s.num[1]; k++ {
+			for l := 0; l < s.num[2]; l++ {
+				x := p.Sub(V3{float64(j) * s.step.X, float64(k) * s.step.Y, float64(l) * s.step.Z})
+				if dx := s.sdf.Evaluate(x); dx < d {
+					d = dx
+					q = x
+				}
+			}
+		}
+	}
+	return TagAt(s.sdf, q)
+}
+
+//-----------------------------------------------------------------------------
+
+// GenerateTaggedTriangles generates a triangle mesh for an SDF3 grouped by
+// the tag at the centroid of each triangle.
+func GenerateTaggedTriangles(s SDF3, meshCells int) map[int][]*Triangle3 {
+	groups := make(map[int][]*Triangle3)
+	for _, t := range GenerateTriangles(s, meshCells) {
+		c := t.V[0].Add(t.V[1]).Add(t.V[2]).DivScalar(3)
+		tag := TagAt(s, c)
+		groups[tag] = append(groups[tag], t)
+	}
+	return groups
+}
+
+// sortedTags returns the tags of a tagged mesh in order.
+func sortedTags(groups map[int][]*Triangle3) []int {
+	tags := make([]int, 0, len(groups))
+	for tag, mesh := range groups {
+		if len(mesh) != 0 {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Ints(tags)
+	return tags
+}
+
+// tagPalette is the default tag colors.
+var tagPalette = []color.RGBA{
+	{0xa0, 0xa0, 0xa0, 0xff}, // untagged
+	{0xe0, 0x40, 0x40, 0xff},
+	{0x40, 0x80, 0xe0, 0xff},
+	{0x40, 0xc0, 0x40, 0xff},
+	{0xe0, 0xc0, 0x20, 0xff},
+	{0xa0, 0x40, 0xc0, 0xff},
+	{0x20, 0xc0, 0xc0, 0xff},
+	{0xe0, 0x80, 0x20, 0xff},
+}
+
+// tagColor returns the color for a tag (from colors, or the default palette).
+func tagColor(tag int, colors map[int]color.RGBA) color.RGBA {
+	if c, ok := colors[tag]; ok {
+		return c
+	}
+	if tag == 0 {
+		return tagPalette[0]
+	}
+	return tagPalette[1+(tag-1)%(len(tagPalette)-1)]
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,198 @@
+//-----------------------------------------------------------------------------
+/*
+
+Surface Textures
+
+Knurling: V-grooves (90 degree) impressed on a cylindrical surface about the
+z-axis, for grips. A straight knurl has grooves along the z-axis, a diamond
+knurl has left and right hand helical grooves. The grooves are worked out on
+the cylinder unrolled at the groove tips, the grooves open up slightly
+towards the surface. The number of grooves around the cylinder is rounded
+so the pattern closes up, so the pitch is approximate.
+
+Displacement: move the surface of an SDF3 out (or in) by a function of
+position, for decorative textures. The displaced distance is divided by a
+Lipschitz bound for the displacement and limited by the maximum amplitude,
+so it stays a conservative bound on the distance to the displaced surface.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"math"
+	"math/rand"
+)
+
+//-----------------------------------------------------------------------------
+
+// KnurlPattern is the pattern of knurl grooves.
+type KnurlPattern int
+
+// Knurl patterns.
+const (
+	KnurlStraight KnurlPattern = iota // grooves along the z-axis
+	KnurlDiamond                      // crossed helical grooves
+)
+
+// KnurlParms defines the parameters for a knurl impressed on a cylindrical surface.
+type KnurlParms struct {
+	Pattern KnurlPattern // straight or diamond grooves
+	Radius  float64      // radius of the cylindrical surface (about the z-axis)
+	Pitch   float64      // distance between grooves
+	Depth   float64      // groove depth
+	Angle   float64      // helix angle of the diamond grooves (radians), 0 == 30 degrees
+}
+
+// knurlGrooves is a family of parallel grooves on the unrolled surface.
+type knurlGrooves struct {
+	c, s  float64 // cos/sin of the groove angle to the z-axis
+	pitch float64 // distance between grooves (across the grooves)
+}
+
+// KnurlSDF3 is an SDF3 with knurl grooves impressed on a cylindrical surface.
+type KnurlSDF3 struct {
+	sdf     SDF3
+	radius  float64
+	depth   float64
+	grooves []knurlGrooves
+}
+
+// ImpressKnurl3D impresses a knurl on the cylindrical surface of an SDF3.
+func ImpressKnurl3D(sdf SDF3, k *KnurlParms) SDF3 {
+	if k.Radius <= 0 || k.Pitch <= 0 || k.Depth <= 0 {
+		panic("bad knurl radius, pitch or depth")
+	}
+	if k.Depth >= k.Radius {
+		panic("knurl depth >= radius")
+	}
+	angles := []float64{0}
+	if k.Pattern == KnurlDiamond {
+		a := k.Angle
+		if a == 0 {
+			a = DtoR(30)
+		}
+		if a <= 0 || a >= 0.5*Pi {
+			panic("bad knurl angle")
+		}
+		angles = []float64{a, -a}
+	}
+	s := KnurlSDF3{}
+	s.sdf = sdf
+	s.radius = k.Radius
+	s.depth = k.Depth
+	for _, a := range angles {
+		c := math.Cos(a)
+		// a whole number of grooves around the cylinder
+		n := math.Max(1, math.Round(Tau*k.Radius*c/k.Pitch))
+		// the pitch on the unrolled surface at the groove tips
+		pitch := Tau * (k.Radius - k.Depth) * c / n
+		s.grooves = append(s.grooves, knurlGrooves{c, math.Sin(a), pitch})
+	}
+	return &s
+}
+
+// Evaluate returns the minimum distance to a knurled SDF3.
+func (s *KnurlSDF3) Evaluate(p V3) float64 {
+	d := s.sdf.Evaluate(p)
+	r := math.Sqrt(p.X*p.X + p.Y*p.Y)
+	// Unroll the cylinder at the radius of the groove tips. This doesn't
+	// stretch space outside of the tips, inside of the tips the distance
+	// across the grooves is scaled back down by r/r0.
+	r0 := s.radius - s.depth
+	u := r0 * math.Atan2(p.Y, p.X)
+	// height above the groove tips
+	h := r - r0
+	g := math.MaxFloat64
+	for _, x := range s.grooves {
+		// distance across the groove from the nearest groove center
+		w := u*x.c - p.Z*x.s
+		w = Abs(w - x.pitch*math.Round(w/x.pitch))
+		if r < r0 {
+			w *= r / r0
+		}
+		// distance to the 90 degree V-groove
+		if h+w < 0 {
+			g = Min(g, math.Sqrt(h*h+w*w))
+		} else {
+			g = Min(g, (w-h)*math.Sqrt2/2)
+		}
+	}
+	return Max(d, -g)
+}
+
+// BoundingBox returns the bounding box of a knurled SDF3.
+func (s *KnurlSDF3) BoundingBox() Box3 {
+	return s.sdf.BoundingBox()
+}
+
+//-----------------------------------------------------------------------------
+
+// DisplaceFunc returns the displacement of a surface at a point.
+type DisplaceFunc func(p V3) float64
+
+// DisplaceSDF3 is an SDF3 with a displaced surface.
+type DisplaceSDF3 struct {
+	sdf  SDF3
+	fn   DisplaceFunc
+	amp  float64 // maximum amplitude of the displacement
+	invK float64 // inverse lipschitz bound of the displaced distance
+	bb   Box3
+}
+
+// displaceSamples is the number of points used to estimate the slope of a displacement.
+const displaceSamples = 20000
+
+// Displace3D displaces the surface of an SDF3 outwards by fn(p), with
+// |fn(p)| <= maxAmp. The slope of fn is estimated by sampling it within the
+// bounding box, so fn should be smooth (e.g. no steps).
+func Displace3D(sdf SDF3, fn DisplaceFunc, maxAmp float64) SDF3 {
+	if maxAmp <= 0 {
+		panic("maxAmp <= 0")
+	}
+	bb := sdf.BoundingBox()
+	bb = NewBox3(bb.Center(), bb.Size().AddScalar(2*maxAmp))
+	// estimate the maximum slope of fn with finite differences
+	rng := rand.New(rand.NewSource(1))
+	size := bb.Size()
+	h := 1e-4 * size.Length()
+	slope := 0.0
+	for i := 0; i < displaceSamples; i++ {
+		p := bb.Min.Add(size.Mul(V3{rng.Float64(), rng.Float64(), rng.Float64()}))
+		v := V3{rng.NormFloat64(), rng.NormFloat64(), rng.NormFloat64()}.Normalize()
+		slope = Max(slope, Abs(fn(p.Add(v.MulScalar(h)))-fn(p))/h)
+	}
+	// allow for the slope being under-estimated by the sampling
+	return displace(sdf, fn, maxAmp, 1.5*slope)
+}
+
+// displace returns a displaced SDF3 given a bound on the slope of the displacement.
+func displace(sdf SDF3, fn DisplaceFunc, maxAmp, slope float64) SDF3 {
+	s := DisplaceSDF3{}
+	s.sdf = sdf
+	s.fn = fn
+	s.amp = maxAmp
+	s.invK = 1 / (1 + slope)
+	bb := sdf.BoundingBox()
+	s.bb = NewBox3(bb.Center(), bb.Size().AddScalar(2*maxAmp))
+	return &s
+}
+
+// Evaluate returns a lower bound on the minimum distance to a displaced SDF3.
+func (s *DisplaceSDF3) Evaluate(p V3) float64 {
+	d := s.sdf.Evaluate(p)
+	dd := (d - s.fn(p)) * s.invK
+	// the displaced surface is within the amplitude of the surface
+	if dd > 0 {
+		return Max(dd, d-s.amp)
+	}
+	return Min(dd, d+s.amp)
+}
+
+// BoundingBox returns the bounding box of a displaced SDF3.
+func (s *DisplaceSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
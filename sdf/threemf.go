@@ -0,0 +1,325 @@
+//-----------------------------------------------------------------------------
+/*
+
+3MF Print Export
+
+Write a triangle mesh as a 3MF file with print metadata for FDM slicers.
+
+The recommended print orientation (e.g. from StablePoses) is the transform
+of the build item, so the model geometry is unchanged and the slicer places
+the part in the print orientation.
+
+The seam position hint, per object slicer settings and modifier volumes
+(regions of the part with different slicer settings, e.g. denser infill
+where the part is highly loaded) are written to the PrusaSlicer/SuperSlicer
+model configuration (Metadata/Slic3r_PE_model.config). The modifier volumes
+are added to the object mesh, so other slicers will see them as part of the
+model.
+
+A tagged mesh (see GenerateTaggedTriangles) is written as a multi-material
+object: a volume per tag (printed with the extruder of the same number) and
+a base material per tag with the tag color.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+	"sort"
+)
+
+//-----------------------------------------------------------------------------
+
+// PrintModifier is a volume of a part with different slicer settings.
+type PrintModifier struct {
+	Name     string
+	Mesh     []*Triangle3      // the modifier volume (a closed mesh)
+	Settings map[string]string // slicer settings, e.g. "fill_density": "40%"
+}
+
+// NewPrintModifier returns a modifier volume for a region (e.g. where a
+// user field is over a threshold) meshed with meshCells cells on the longest axis.
+func NewPrintModifier(name string, region SDF3, meshCells int, settings map[string]string) PrintModifier {
+	return PrintModifier{
+		Name:     name,
+		Mesh:     GenerateTriangles(region, meshCells),
+		Settings: settings,
+	}
+}
+
+// PrintParms defines the print metadata for a 3MF file.
+type PrintParms struct {
+	Name      string            // object name
+	Transform *M44              // recommended print orientation (nil == as modelled)
+	Seam      string            // seam position hint: "aligned", "nearest", "rear" or "random" ("" == slicer default)
+	Settings  map[string]string // object slicer settings, e.g. "perimeters": "4"
+	Modifiers []PrintModifier   // modifier volumes
+}
+
+var seamPositions = map[string]bool{"": true, "aligned": true, "nearest": true, "rear": true, "random": true}
+
+//-----------------------------------------------------------------------------
+
+const threeMFContentTypes = `<?xml version="1.0" encoding="UTF-8"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+ <Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+ <Default Extension="model" ContentType="application/vnd.ms-package.3dmanufacturing-3dmodel+xml"/>
+</Types>
+`
+
+const threeMFRels = `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+ <Relationship Target="/3D/3dmodel.model" Id="rel0" Type="http://schemas.microsoft.com/3dmanufacturing/2013/01/3dmodel"/>
+</Relationships>
+`
+
+// xmlEscape returns a string escaped for XML text or attributes.
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// threeMFTransform returns the 3MF transform attribute for a matrix.
+// 3MF multiplies row vectors by the matrix, so the matrix is transposed.
+func threeMFTransform(m *M44) string {
+	return fmt.Sprintf("%g %g %g %g %g %g %g %g %g %g %g %g",
+		m.x00, m.x10, m.x20,
+		m.x01, m.x11, m.x21,
+		m.x02, m.x12, m.x22,
+		m.x03, m.x13, m.x23)
+}
+
+// writeSettings writes slicer settings as config metadata (sorted by key).
+func writeSettings(w io.Writer, kind string, settings map[string]string) {
+	keys := make([]string, 0, len(settings))
+	for k := range settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "   <metadata type=\"%s\" key=\"%s\" value=\"%s\"/>\n", kind, xmlEscape(k), xmlEscape(settings[k]))
+	}
+}
+
+// threeMFVolume is a volume of the 3MF object (a range of the object triangles).
+type threeMFVolume struct {
+	mesh     []*Triangle3
+	settings map[string]string // volume settings
+	material int               // base material index (-1 == object default)
+}
+
+// modifierVolumes returns the volumes for the modifiers.
+func modifierVolumes(modifiers []PrintModifier) []threeMFVolume {
+	var volumes []threeMFVolume
+	for i, m := range modifiers {
+		if len(m.Mesh) == 0 {
+			continue
+		}
+		settings := map[string]string{"name": m.Name, "modifier": "1"}
+		if m.Name == "" {
+			settings["name"] = fmt.Sprintf("modifier%d", i)
+		}
+		for key, value := range m.Settings {
+			settings[key] = value
+		}
+		volumes = append(volumes, threeMFVolume{mesh: m.Mesh, settings: settings, material: -1})
+	}
+	return volumes
+}
+
+// threeMFName returns the object name.
+func threeMFName(k *PrintParms) string {
+	if k.Name == "" {
+		return "part"
+	}
+	return k.Name
+}
+
+// Encode3MF writes a triangle mesh and print metadata to a writer in 3MF format.
+func Encode3MF(w io.Writer, mesh []*Triangle3, k *PrintParms) error {
+	if len(mesh) == 0 {
+		return errors.New("empty mesh")
+	}
+	volumes := []threeMFVolume{{mesh: mesh, settings: map[string]string{"name": threeMFName(k)}, material: -1}}
+	return encode3MF(w, append(volumes, modifierVolumes(k.Modifiers)...), nil, k)
+}
+
+// EncodeTagged3MF writes a tagged triangle mesh (see GenerateTaggedTriangles)
+// and print metadata to a writer in multi-material 3MF format. Each tag is a
+// volume printed with the extruder of the same number (untagged triangles use
+// the first extruder), and a base material with the tag color (tags without a
+// color use a default color).
+func EncodeTagged3MF(w io.Writer, groups map[int][]*Triangle3, colors map[int]color.RGBA, k *PrintParms) error {
+	tags := sortedTags(groups)
+	if len(tags) == 0 {
+		return errors.New("empty mesh")
+	}
+	var volumes []threeMFVolume
+	var materials []color.RGBA
+	for i, tag := range tags {
+		extruder := tag
+		if extruder == 0 {
+			extruder = 1
+		}
+		volumes = append(volumes, threeMFVolume{
+			mesh: groups[tag],
+			settings: map[string]string{
+				"name":     fmt.Sprintf("%s tag%d", threeMFName(k), tag),
+				"extruder": fmt.Sprintf("%d", extruder),
+			},
+			material: i,
+		})
+		materials = append(materials, tagColor(tag, colors))
+	}
+	return encode3MF(w, append(volumes, modifierVolumes(k.Modifiers)...), materials, k)
+}
+
+// encode3MF writes the volumes of an object and print metadata to a writer in
+// 3MF format. If there are materials, they are written as base materials.
+func encode3MF(w io.Writer, volumes []threeMFVolume, materials []color.RGBA, k *PrintParms) error {
+	if !seamPositions[k.Seam] {
+		return fmt.Errorf("unknown seam position \"%s\"", k.Seam)
+	}
+	name := threeMFName(k)
+	// the materials are defined before the object
+	objectID := 1
+	if len(materials) != 0 {
+		objectID = 2
+	}
+
+	// the object mesh is the volumes in order
+	v := newWelder(0)
+	var faces [][3]int
+	var faceMaterial []int
+	for _, vol := range volumes {
+		for _, t := range vol.mesh {
+			var f [3]int
+			for j := range t.V {
+				f[j], _ = v.index(t.V[j])
+			}
+			faces = append(faces, f)
+			faceMaterial = append(faceMaterial, vol.material)
+		}
+	}
+
+	z := zip.NewWriter(w)
+	f, err := z.Create("[Content_Types].xml")
+	if err != nil {
+		return err
+	}
+	io.WriteString(f, threeMFContentTypes)
+	f, err = z.Create("_rels/.rels")
+	if err != nil {
+		return err
+	}
+	io.WriteString(f, threeMFRels)
+
+	// model
+	f, err = z.Create("3D/3dmodel.model")
+	if err != nil {
+		return err
+	}
+	buf := bufio.NewWriter(f)
+	fmt.Fprintf(buf, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	fmt.Fprintf(buf, "<model unit=\"millimeter\" xml:lang=\"en-US\" xmlns=\"http://schemas.microsoft.com/3dmanufacturing/core/2015/02\">\n")
+	fmt.Fprintf(buf, " <metadata name=\"Application\">sdfx</metadata>\n")
+	fmt.Fprintf(buf, " <resources>\n")
+	if len(materials) != 0 {
+		fmt.Fprintf(buf, "  <basematerials id=\"1\">\n")
+		for i, c := range materials {
+			fmt.Fprintf(buf, "   <base name=\"material%d\" displaycolor=\"#%02X%02X%02X%02X\"/>\n", i, c.R, c.G, c.B, c.A)
+		}
+		fmt.Fprintf(buf, "  </basematerials>\n")
+		fmt.Fprintf(buf, "  <object id=\"%d\" name=\"%s\" type=\"model\" pid=\"1\" pindex=\"0\">\n", objectID, xmlEscape(name))
+	} else {
+		fmt.Fprintf(buf, "  <object id=\"%d\" name=\"%s\" type=\"model\">\n", objectID, xmlEscape(name))
+	}
+	fmt.Fprintf(buf, "   <mesh>\n    <vertices>\n")
+	for _, p := range v.vertex {
+		fmt.Fprintf(buf, "     <vertex x=\"%g\" y=\"%g\" z=\"%g\"/>\n", p.X, p.Y, p.Z)
+	}
+	fmt.Fprintf(buf, "    </vertices>\n    <triangles>\n")
+	for i, t := range faces {
+		if m := faceMaterial[i]; m >= 0 && len(materials) != 0 {
+			fmt.Fprintf(buf, "     <triangle v1=\"%d\" v2=\"%d\" v3=\"%d\" pid=\"1\" p1=\"%d\"/>\n", t[0], t[1], t[2], m)
+		} else {
+			fmt.Fprintf(buf, "     <triangle v1=\"%d\" v2=\"%d\" v3=\"%d\"/>\n", t[0], t[1], t[2])
+		}
+	}
+	fmt.Fprintf(buf, "    </triangles>\n   </mesh>\n  </object>\n </resources>\n")
+	fmt.Fprintf(buf, " <build>\n")
+	if k.Transform != nil {
+		fmt.Fprintf(buf, "  <item objectid=\"%d\" transform=\"%s\"/>\n", objectID, threeMFTransform(k.Transform))
+	} else {
+		fmt.Fprintf(buf, "  <item objectid=\"%d\"/>\n", objectID)
+	}
+	fmt.Fprintf(buf, " </build>\n</model>\n")
+	if err := buf.Flush(); err != nil {
+		return err
+	}
+
+	// slicer configuration
+	f, err = z.Create("Metadata/Slic3r_PE_model.config")
+	if err != nil {
+		return err
+	}
+	buf = bufio.NewWriter(f)
+	fmt.Fprintf(buf, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<config>\n")
+	fmt.Fprintf(buf, " <object id=\"%d\" instances_count=\"1\">\n", objectID)
+	objectSettings := map[string]string{"name": name}
+	for key, value := range k.Settings {
+		objectSettings[key] = value
+	}
+	if k.Seam != "" {
+		objectSettings["seam_position"] = k.Seam
+	}
+	writeSettings(buf, "object", objectSettings)
+	// volumes are ranges of triangles
+	first := 0
+	for _, vol := range volumes {
+		n := len(vol.mesh)
+		fmt.Fprintf(buf, "  <volume firstid=\"%d\" lastid=\"%d\">\n", first, first+n-1)
+		writeSettings(buf, "volume", vol.settings)
+		fmt.Fprintf(buf, "  </volume>\n")
+		first += n
+	}
+	fmt.Fprintf(buf, " </object>\n</config>\n")
+	if err := buf.Flush(); err != nil {
+		return err
+	}
+
+	return z.Close()
+}
+
+// Save3MF writes a triangle mesh and print metadata to a 3MF file.
+func Save3MF(path string, mesh []*Triangle3, k *PrintParms) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return Encode3MF(file, mesh, k)
+}
+
+// SaveTagged3MF writes a tagged triangle mesh and print metadata to a multi-material 3MF file.
+func SaveTagged3MF(path string, groups map[int][]*Triangle3, colors map[int]color.RGBA, k *PrintParms) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return EncodeTagged3MF(file, groups, colors, k)
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,126 @@
+//-----------------------------------------------------------------------------
+/*
+
+Triply Periodic Minimal Surfaces
+
+TPMS lattices (gyroid, Schwarz P and Schwarz D) for lightweight infill.
+The lattice is a sheet on the level set f(p) = 0 of a periodic function:
+|f(p)| <= level. The sheet thickness varies with the gradient of f, the level
+is set from the average gradient on the surface so the sheet has the given
+average thickness (and the volume of a sheet of that thickness). f isn't a
+distance, it is divided by the maximum of its gradient (sqrt(3) for each
+surface) to give a conservative (lower) bound on the distance.
+
+f(x,y,z), with x,y,z scaled to 2 pi per period:
+
+gyroid: sin(x)cos(y) + sin(y)cos(z) + sin(z)cos(x)
+Schwarz P: cos(x) + cos(y) + cos(z)
+Schwarz D: sin(x)sin(y)sin(z) + sin(x)cos(y)cos(z) + cos(x)sin(y)cos(z) + cos(x)cos(y)sin(z)
+
+The lattice is infinite, its bounding box is a single unit cell centered on
+the origin (e.g. for AnalyzeLattice). Intersect the lattice with a part to
+use it as infill.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// TPMSType is the type of a triply periodic minimal surface.
+type TPMSType int
+
+// TPMS types.
+const (
+	Gyroid   TPMSType = iota // gyroid
+	SchwarzP                 // Schwarz primitive
+	SchwarzD                 // Schwarz diamond
+)
+
+// TPMSParms defines the parameters for a TPMS lattice.
+type TPMSParms struct {
+	Type      TPMSType // type of surface
+	Period    float64  // unit cell size
+	Thickness float64  // sheet thickness
+}
+
+// TPMSSDF3 is a TPMS lattice.
+type TPMSSDF3 struct {
+	f     func(x, y, z float64) float64
+	k     float64 // scaling from distance to 2 pi per period
+	invK  float64 // inverse of the maximum gradient of f (in distance units)
+	level float64 // sheet level
+	bb    Box3
+}
+
+func gyroid(x, y, z float64) float64 {
+	sx, cx := math.Sincos(x)
+	sy, cy := math.Sincos(y)
+	sz, cz := math.Sincos(z)
+	return sx*cy + sy*cz + sz*cx
+}
+
+func schwarzP(x, y, z float64) float64 {
+	return math.Cos(x) + math.Cos(y) + math.Cos(z)
+}
+
+func schwarzD(x, y, z float64) float64 {
+	sx, cx := math.Sincos(x)
+	sy, cy := math.Sincos(y)
+	sz, cz := math.Sincos(z)
+	return sx*sy*sz + sx*cy*cz + cx*sy*cz + cx*cy*sz
+}
+
+// TPMS3D returns an SDF3 for a TPMS lattice.
+func TPMS3D(k *TPMSParms) SDF3 {
+	if k.Period <= 0 {
+		panic("period <= 0")
+	}
+	if k.Thickness <= 0 || k.Thickness >= k.Period {
+		panic("bad thickness")
+	}
+	s := TPMSSDF3{}
+	// the average gradient of f on the surface (found by sampling)
+	var g float64
+	switch k.Type {
+	case Gyroid:
+		s.f, g = gyroid, 1.529
+	case SchwarzP:
+		s.f, g = schwarzP, 1.312
+	case SchwarzD:
+		s.f, g = schwarzD, 1.492
+	default:
+		panic("bad tpms type")
+	}
+	s.k = Tau / k.Period
+	s.invK = 1 / (s.k * math.Sqrt(3))
+	s.level = 0.5 * k.Thickness * s.k * g
+	d := 0.5 * k.Period
+	s.bb = Box3{V3{-d, -d, -d}, V3{d, d, d}}
+	return &s
+}
+
+// Evaluate returns a lower bound on the minimum distance to a TPMS lattice.
+func (s *TPMSSDF3) Evaluate(p V3) float64 {
+	q := p.MulScalar(s.k)
+	return (Abs(s.f(q.X, q.Y, q.Z)) - s.level) * s.invK
+}
+
+// BoundingBox returns the bounding box of a unit cell of a TPMS lattice.
+func (s *TPMSSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+
+// Infill3D returns a lattice infill for a part: the lattice intersected with
+// the interior of the part's shell. For a part with a solid skin, union the
+// infill with the hollowed part (see Hollow3D).
+func Infill3D(shell, lattice SDF3) SDF3 {
+	return Intersect3D(shell, lattice)
+}
+
+//-----------------------------------------------------------------------------
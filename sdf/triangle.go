@@ -12,7 +12,8 @@ package sdf
 
 // Triangle3 is a 3D triangle
 type Triangle3 struct {
-	V [3]V3
+	V         [3]V3
+	Attribute uint16 // STL attribute (e.g. color), see ColorHook()
 }
 
 // Triangle2 is a 2D triangle
@@ -38,4 +39,9 @@ func (t *Triangle3) Normal() V3 {
 	return e1.Cross(e2).Normalize()
 }
 
+// Flip reverses the winding order (and the normal) of a 3D triangle.
+func (t *Triangle3) Flip() {
+	t.V[1], t.V[2] = t.V[2], t.V[1]
+}
+
 //-----------------------------------------------------------------------------
@@ -0,0 +1,343 @@
+//-----------------------------------------------------------------------------
+/*
+
+Units and Parameters
+
+sdfx works in millimetres. A Unit converts lengths in other units (inches,
+mils, etc.) to and from millimetres, and ParseLength reads lengths like
+"3.5in", "1/4 in", "250mil" or "12mm".
+
+Params is a table of named design parameters. Lengths keep the unit they
+were given in and are read in millimetres, so a design references its
+parameters by name instead of using raw float literals:
+
+	p := sdf.NewParams(sdf.UnitInch)
+	p.Set("width", 3.5, 0) // the table default unit (inches)
+	p.Set("wall", 2, sdf.UnitMM)
+	p.Set("holes", 4, 0)
+	box := sdf.Box3D(p.V3("width", "width", "wall"), 0)
+
+The table can be loaded from (and saved to) a JSON config. Config values
+are numbers (in the table default unit) or length strings:
+
+	{"width": "3.5in", "wall": "2mm", "holes": 4}
+
+Saving the table with another unit converts a design between metric and
+imperial.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//-----------------------------------------------------------------------------
+// Units
+
+// Unit is a unit of length, the number of millimetres per unit.
+type Unit float64
+
+// Units of length.
+const (
+	UnitMM   Unit = 1
+	UnitCM   Unit = 10
+	UnitM    Unit = 1000
+	UnitInch Unit = MillimetresPerInch
+	UnitFoot Unit = 12 * MillimetresPerInch
+	UnitMil  Unit = Mil
+)
+
+// unitNames maps unit names to units.
+var unitNames = map[string]Unit{
+	"mm":     UnitMM,
+	"cm":     UnitCM,
+	"m":      UnitM,
+	"in":     UnitInch,
+	"inch":   UnitInch,
+	"inches": UnitInch,
+	"\"":     UnitInch,
+	"ft":     UnitFoot,
+	"'":      UnitFoot,
+	"mil":    UnitMil,
+	"mils":   UnitMil,
+	"thou":   UnitMil,
+}
+
+// ParseUnit returns the unit for a unit name (mm, cm, m, in, ft, mil, etc.).
+func ParseUnit(name string) (Unit, error) {
+	if u, ok := unitNames[strings.ToLower(strings.TrimSpace(name))]; ok {
+		return u, nil
+	}
+	return 0, fmt.Errorf("unknown unit \"%s\"", name)
+}
+
+// String returns the name of a unit.
+func (u Unit) String() string {
+	switch u {
+	case UnitMM:
+		return "mm"
+	case UnitCM:
+		return "cm"
+	case UnitM:
+		return "m"
+	case UnitInch:
+		return "in"
+	case UnitFoot:
+		return "ft"
+	case UnitMil:
+		return "mil"
+	}
+	return fmt.Sprintf("(%gmm)", float64(u))
+}
+
+// ToMM converts a length in this unit to millimetres.
+func (u Unit) ToMM(x float64) float64 {
+	return x * float64(u)
+}
+
+// FromMM converts a length in millimetres to this unit.
+func (u Unit) FromMM(x float64) float64 {
+	return x / float64(u)
+}
+
+// Convert converts a length from one unit to another.
+func Convert(x float64, from, to Unit) float64 {
+	return to.FromMM(from.ToMM(x))
+}
+
+// parseNumber parses a number or a fraction (e.g. "3/16").
+func parseNumber(s string) (float64, error) {
+	if i := strings.Index(s, "/"); i >= 0 {
+		n, err0 := strconv.ParseFloat(strings.TrimSpace(s[:i]), 64)
+		d, err1 := strconv.ParseFloat(strings.TrimSpace(s[i+1:]), 64)
+		if err0 != nil || err1 != nil || d == 0 {
+			return 0, fmt.Errorf("bad number \"%s\"", s)
+		}
+		return n / d, nil
+	}
+	x, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad number \"%s\"", s)
+	}
+	return x, nil
+}
+
+// splitLength splits a length string into a number and a unit (0 == no unit).
+func splitLength(s string) (float64, Unit, error) {
+	s = strings.TrimSpace(s)
+	i := strings.LastIndexAny(s, "0123456789.") + 1
+	if i == 0 {
+		return 0, 0, fmt.Errorf("bad length \"%s\"", s)
+	}
+	x, err := parseNumber(s[:i])
+	if err != nil {
+		return 0, 0, err
+	}
+	if strings.TrimSpace(s[i:]) == "" {
+		return x, 0, nil
+	}
+	u, err := ParseUnit(s[i:])
+	if err != nil {
+		return 0, 0, err
+	}
+	return x, u, nil
+}
+
+// ParseLength returns the length in millimetres of a length string (e.g.
+// "3.5in", "1/4 in", "12mm"). A number without a unit is in the default unit.
+func ParseLength(s string, def Unit) (float64, error) {
+	x, u, err := splitLength(s)
+	if err != nil {
+		return 0, err
+	}
+	if u == 0 {
+		u = def
+	}
+	return u.ToMM(x), nil
+}
+
+// lengthString returns a length string. Lengths in units without a name are
+// converted to millimetres.
+func lengthString(x float64, u Unit) string {
+	if _, err := ParseUnit(u.String()); err != nil {
+		x, u = u.ToMM(x), UnitMM
+	}
+	return strconv.FormatFloat(x, 'g', -1, 64) + u.String()
+}
+
+//-----------------------------------------------------------------------------
+// Parameters
+
+// Param is a design parameter.
+type Param struct {
+	Value float64 // parameter value
+	Unit  Unit    // length unit of the value (0 == the table default unit, or not a length)
+}
+
+// Params is a table of named design parameters.
+type Params struct {
+	unit   Unit             // default length unit
+	params map[string]Param // parameters by name
+}
+
+// NewParams returns an empty parameter table. Lengths set without a unit are
+// in the default unit.
+func NewParams(unit Unit) *Params {
+	if unit <= 0 {
+		panic("unit <= 0")
+	}
+	return &Params{unit: unit, params: make(map[string]Param)}
+}
+
+// Set sets a parameter (unit 0 == the table default unit, or not a length).
+func (p *Params) Set(name string, value float64, unit Unit) {
+	p.params[name] = Param{value, unit}
+}
+
+// SetLength sets a parameter from a length string (e.g. "3.5in").
+func (p *Params) SetLength(name, length string) error {
+	x, u, err := splitLength(length)
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	p.Set(name, x, u)
+	return nil
+}
+
+// Get returns a parameter.
+func (p *Params) Get(name string) (Param, bool) {
+	x, ok := p.params[name]
+	return x, ok
+}
+
+// Names returns the sorted parameter names.
+func (p *Params) Names() []string {
+	names := make([]string, 0, len(p.params))
+	for name := range p.params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// param returns a parameter, it panics if the parameter isn't in the table.
+func (p *Params) param(name string) Param {
+	x, ok := p.params[name]
+	if !ok {
+		panic(fmt.Sprintf("no parameter \"%s\"", name))
+	}
+	return x
+}
+
+// Length returns a length parameter in millimetres.
+func (p *Params) Length(name string) float64 {
+	x := p.param(name)
+	if x.Unit == 0 {
+		return p.unit.ToMM(x.Value)
+	}
+	return x.Unit.ToMM(x.Value)
+}
+
+// Number returns a parameter that isn't a length (e.g. a count or an angle).
+func (p *Params) Number(name string) float64 {
+	return p.param(name).Value
+}
+
+// Int returns an integer parameter (rounded to the nearest integer).
+func (p *Params) Int(name string) int {
+	return int(math.Round(p.Number(name)))
+}
+
+// V2 returns a 2d vector of length parameters in millimetres.
+func (p *Params) V2(x, y string) V2 {
+	return V2{p.Length(x), p.Length(y)}
+}
+
+// V3 returns a 3d vector of length parameters in millimetres.
+func (p *Params) V3(x, y, z string) V3 {
+	return V3{p.Length(x), p.Length(y), p.Length(z)}
+}
+
+//-----------------------------------------------------------------------------
+// Config Files
+
+// Decode reads parameters from a JSON object of numbers (in the table
+// default unit) and length strings (e.g. "3.5in"). Existing parameters are
+// overwritten, so a config can override the defaults set by a design.
+func (p *Params) Decode(r io.Reader) error {
+	var m map[string]interface{}
+	dec := json.NewDecoder(r)
+	if err := dec.Decode(&m); err != nil {
+		return err
+	}
+	for name, v := range m {
+		switch v := v.(type) {
+		case float64:
+			p.Set(name, v, 0)
+		case string:
+			if err := p.SetLength(name, v); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%s: bad parameter value %v", name, v)
+		}
+	}
+	return nil
+}
+
+// Load reads parameters from a JSON config file.
+func (p *Params) Load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := p.Decode(f); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+// Encode writes the parameters as a JSON object. Lengths with a unit
+// are written in the given unit (0 == the unit they were set in).
+func (p *Params) Encode(w io.Writer, unit Unit) error {
+	m := make(map[string]interface{}, len(p.params))
+	for name, x := range p.params {
+		switch {
+		case x.Unit == 0:
+			m[name] = x.Value
+		case unit == 0:
+			m[name] = lengthString(x.Value, x.Unit)
+		default:
+			m[name] = lengthString(Convert(x.Value, x.Unit, unit), unit)
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
+
+// Save writes the parameters to a JSON config file.
+func (p *Params) Save(path string, unit Unit) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := p.Encode(f, unit); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+//-----------------------------------------------------------------------------
@@ -111,6 +111,24 @@ func SawTooth(x, period float64) float64 {
 	return period*(t-math.Floor(t)) - period/2
 }
 
+// repeatCells returns the index of the nearest cell of a finite 1d repetition (n cells
+// of size step starting at 0) and the index of its neighbour on the side of x.
+func repeatCells(x, step float64, n int) (int, int) {
+	if n == 1 || step == 0 {
+		return 0, 0
+	}
+	t := x / step
+	i := int(Clamp(math.Round(t), 0, float64(n-1)))
+	j := i - 1
+	if t > float64(i) {
+		j = i + 1
+	}
+	if j < 0 || j >= n {
+		j = i
+	}
+	return i, j
+}
+
 //-----------------------------------------------------------------------------
 
 // MinFunc is a minimum functions for SDF blending.
@@ -0,0 +1,273 @@
+//-----------------------------------------------------------------------------
+/*
+
+Voronoi Patterns
+
+Cellular patterns from the Voronoi cells of a set of random points, for
+decorative panels (2d) and foam or bone-like infill (3d).
+
+The points are on a jittered grid: there is a point in each grid cell, moved
+from the center of the grid cell by a random amount. The random offsets are
+worked out from a hash of the grid cell and a seed, so a pattern is
+repeatable and the cost of an evaluation is the same anywhere. The distance
+to the border of a Voronoi cell is the minimum distance to the bisectors of
+the nearest point and its neighbours. The points in the adjacent grid
+cells are searched for the nearest point, and the next ring of grid cells
+if it is further than a grid cell away. The neighbours are searched one
+ring of grid cells further out than the nearest point. See:
+
+https://iquilezles.org/articles/voronoilines/
+
+edges: walls of a given thickness on the cell borders.
+
+cells: the cells, separated by a gap of a given width.
+
+The pattern is infinite, its bounding box is a single grid cell centered on
+the origin. Intersect the pattern with a part to use it.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// VoronoiMode is the type of Voronoi pattern.
+type VoronoiMode int
+
+// Voronoi pattern modes.
+const (
+	VoronoiEdges VoronoiMode = iota // walls on the cell borders
+	VoronoiCells                    // cells separated by gaps
+)
+
+// VoronoiParms defines the parameters for a Voronoi pattern.
+type VoronoiParms struct {
+	Mode   VoronoiMode // edges or cells
+	Cell   float64     // grid cell size (the average distance between points)
+	Width  float64     // wall thickness (edges) or gap width (cells)
+	Jitter float64     // random movement of the points (0 == a regular grid, 1 == anywhere in the grid cell)
+	Seed   int64       // random seed
+}
+
+// validate checks the Voronoi parameters.
+func (k *VoronoiParms) validate() {
+	if k.Cell <= 0 {
+		panic("cell <= 0")
+	}
+	if k.Width <= 0 || k.Width >= k.Cell {
+		panic("bad width")
+	}
+	if k.Jitter < 0 || k.Jitter > 1 {
+		panic("bad jitter")
+	}
+	if k.Mode != VoronoiEdges && k.Mode != VoronoiCells {
+		panic("bad voronoi mode")
+	}
+}
+
+// voronoiHash returns a pseudo-random value in [0, 1) for a grid cell.
+func voronoiHash(seed int64, i, j, k, n int) float64 {
+	h := uint64(seed)*0x9e3779b97f4a7c15 ^ uint64(i)*0xbf58476d1ce4e5b9 ^ uint64(j)*0x94d049bb133111eb ^ uint64(k)*0xd6e8feb86659fd93 ^ uint64(n)
+	// splitmix64 finalizer
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return float64(h>>11) / (1 << 53)
+}
+
+// voronoiSign returns the sign of the border distance for a Voronoi mode.
+func voronoiSign(mode VoronoiMode) float64 {
+	if mode == VoronoiCells {
+		return -1
+	}
+	return 1
+}
+
+//-----------------------------------------------------------------------------
+
+// VoronoiSDF2 is a 2d Voronoi pattern.
+type VoronoiSDF2 struct {
+	cell   float64
+	width  float64 // half wall or gap width
+	sign   float64 // +1 for edges, -1 for cells
+	jitter float64
+	seed   int64
+	bb     Box2
+}
+
+// Voronoi2D returns an SDF2 for a Voronoi pattern.
+func Voronoi2D(k *VoronoiParms) SDF2 {
+	k.validate()
+	s := VoronoiSDF2{}
+	s.cell = k.Cell
+	s.width = 0.5 * k.Width
+	s.sign = voronoiSign(k.Mode)
+	s.jitter = k.Jitter
+	s.seed = k.Seed
+	d := 0.5 * k.Cell
+	s.bb = Box2{V2{-d, -d}, V2{d, d}}
+	return &s
+}
+
+// point returns the offset from p to the point of grid cell i (in grid units).
+func (s *VoronoiSDF2) point(i V2i, p V2) V2 {
+	o := V2{voronoiHash(s.seed, i[0], i[1], 0, 0), voronoiHash(s.seed, i[0], i[1], 0, 1)}
+	o = o.SubScalar(0.5).MulScalar(s.jitter).AddScalar(0.5)
+	return V2{float64(i[0]), float64(i[1])}.Add(o).Sub(p)
+}
+
+// nearest returns the grid cell of the nearest point (and the offset to it)
+// searching n cells either side of grid cell g.
+func (s *VoronoiSDF2) nearest(g V2i, p V2, n int) (V2i, V2) {
+	var mg V2i
+	var mr V2
+	md := math.MaxFloat64
+	for j := -n; j <= n; j++ {
+		for i := -n; i <= n; i++ {
+			c := g.Add(V2i{i, j})
+			r := s.point(c, p)
+			if d := r.Length2(); d < md {
+				md, mr, mg = d, r, c
+			}
+		}
+	}
+	return mg, mr
+}
+
+// Border returns the distance from a point to the border of its Voronoi cell.
+func (s *VoronoiSDF2) Border(p V2) float64 {
+	p = p.DivScalar(s.cell)
+	g := V2i{int(math.Floor(p.X)), int(math.Floor(p.Y))}
+	n := 1
+	mg, mr := s.nearest(g, p, n)
+	if mr.Length2() > 1 {
+		// the nearest point may be further away
+		n = 2
+		mg, mr = s.nearest(g, p, n)
+	}
+	// the nearest bisector of the nearest point and its neighbours
+	n++
+	md := math.MaxFloat64
+	for j := -n; j <= n; j++ {
+		for i := -n; i <= n; i++ {
+			if i == 0 && j == 0 {
+				continue
+			}
+			r := s.point(mg.Add(V2i{i, j}), p)
+			md = Min(md, mr.Add(r).MulScalar(0.5).Dot(r.Sub(mr).Normalize()))
+		}
+	}
+	return md * s.cell
+}
+
+// Evaluate returns the minimum distance to a 2d Voronoi pattern.
+func (s *VoronoiSDF2) Evaluate(p V2) float64 {
+	return s.sign * (s.Border(p) - s.width)
+}
+
+// BoundingBox returns the bounding box of a single grid cell of a 2d Voronoi pattern.
+func (s *VoronoiSDF2) BoundingBox() Box2 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+
+// VoronoiSDF3 is a 3d Voronoi pattern.
+type VoronoiSDF3 struct {
+	cell   float64
+	width  float64 // half wall or gap width
+	sign   float64 // +1 for edges, -1 for cells
+	jitter float64
+	seed   int64
+	bb     Box3
+}
+
+// Voronoi3D returns an SDF3 for a Voronoi pattern.
+func Voronoi3D(k *VoronoiParms) SDF3 {
+	k.validate()
+	s := VoronoiSDF3{}
+	s.cell = k.Cell
+	s.width = 0.5 * k.Width
+	s.sign = voronoiSign(k.Mode)
+	s.jitter = k.Jitter
+	s.seed = k.Seed
+	d := 0.5 * k.Cell
+	s.bb = Box3{V3{-d, -d, -d}, V3{d, d, d}}
+	return &s
+}
+
+// point returns the offset from p to the point of grid cell i (in grid units).
+func (s *VoronoiSDF3) point(i V3i, p V3) V3 {
+	o := V3{
+		voronoiHash(s.seed, i[0], i[1], i[2], 0),
+		voronoiHash(s.seed, i[0], i[1], i[2], 1),
+		voronoiHash(s.seed, i[0], i[1], i[2], 2),
+	}
+	o = o.SubScalar(0.5).MulScalar(s.jitter).AddScalar(0.5)
+	return V3{float64(i[0]), float64(i[1]), float64(i[2])}.Add(o).Sub(p)
+}
+
+// nearest returns the grid cell of the nearest point (and the offset to it)
+// searching n cells either side of grid cell g.
+func (s *VoronoiSDF3) nearest(g V3i, p V3, n int) (V3i, V3) {
+	var mg V3i
+	var mr V3
+	md := math.MaxFloat64
+	for k := -n; k <= n; k++ {
+		for j := -n; j <= n; j++ {
+			for i := -n; i <= n; i++ {
+				c := g.Add(V3i{i, j, k})
+				r := s.point(c, p)
+				if d := r.Length2(); d < md {
+					md, mr, mg = d, r, c
+				}
+			}
+		}
+	}
+	return mg, mr
+}
+
+// Border returns the distance from a point to the border of its Voronoi cell.
+func (s *VoronoiSDF3) Border(p V3) float64 {
+	p = p.DivScalar(s.cell)
+	g := V3i{int(math.Floor(p.X)), int(math.Floor(p.Y)), int(math.Floor(p.Z))}
+	n := 1
+	mg, mr := s.nearest(g, p, n)
+	if mr.Length2() > 1 {
+		// the nearest point may be further away
+		n = 2
+		mg, mr = s.nearest(g, p, n)
+	}
+	// the nearest bisector of the nearest point and its neighbours
+	n++
+	md := math.MaxFloat64
+	for k := -n; k <= n; k++ {
+		for j := -n; j <= n; j++ {
+			for i := -n; i <= n; i++ {
+				if i == 0 && j == 0 && k == 0 {
+					continue
+				}
+				r := s.point(mg.Add(V3i{i, j, k}), p)
+				md = Min(md, mr.Add(r).MulScalar(0.5).Dot(r.Sub(mr).Normalize()))
+			}
+		}
+	}
+	return md * s.cell
+}
+
+// Evaluate returns the minimum distance to a 3d Voronoi pattern.
+func (s *VoronoiSDF3) Evaluate(p V3) float64 {
+	return s.sign * (s.Border(p) - s.width)
+}
+
+// BoundingBox returns the bounding box of a single grid cell of a 3d Voronoi pattern.
+func (s *VoronoiSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
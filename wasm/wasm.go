@@ -0,0 +1,249 @@
+//go:build js && wasm
+// +build js,wasm
+
+//-----------------------------------------------------------------------------
+/*
+
+WebAssembly JS Bindings
+
+Export a parameterised model to JavaScript so it can be evaluated and
+meshed in the browser. Build with GOOS=js GOARCH=wasm.
+
+Export3("name", fn) creates a global JS object "name" with the methods:
+
+	bounds(params)                  -> [xmin, ymin, zmin, xmax, ymax, zmax]
+	evaluate(params, points)        -> Float64Array of distances
+	evaluateGrid(params, nx, ny, nz) -> Float64Array of distances
+	mesh(params, cells)             -> Float32Array of triangle vertices
+
+params is a JS object of named numeric parameters passed to the model.
+points is a Float64Array of packed x,y,z values. evaluateGrid samples the
+bounding box on an nx * ny * nz grid (x varies fastest). mesh returns 9
+values (3 x,y,z vertices) per triangle.
+
+A JS method that fails (including a call with arguments of the wrong type)
+returns an Error object.
+
+*/
+//-----------------------------------------------------------------------------
+
+package wasm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"syscall/js"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// Model3 returns a 3d model for a set of named parameters.
+type Model3 func(params map[string]float64) (sdf.SDF3, error)
+
+//-----------------------------------------------------------------------------
+// Conversion between JS values and Go values.
+
+// jsParams converts a JS object to a map of named parameters.
+// undefined and null are no parameters.
+func jsParams(v js.Value) (map[string]float64, error) {
+	params := make(map[string]float64)
+	switch v.Type() {
+	case js.TypeUndefined, js.TypeNull:
+		return params, nil
+	case js.TypeObject:
+	default:
+		return nil, errors.New("params must be an object")
+	}
+	keys := js.Global().Get("Object").Call("keys", v)
+	for i := 0; i < keys.Length(); i++ {
+		k := keys.Index(i).String()
+		x := v.Get(k)
+		if x.Type() != js.TypeNumber {
+			return nil, fmt.Errorf("parameter \"%s\" must be a number", k)
+		}
+		params[k] = x.Float()
+	}
+	return params, nil
+}
+
+// jsInt converts a JS number to an integer.
+func jsInt(v js.Value, name string) (int, error) {
+	if v.Type() != js.TypeNumber {
+		return 0, fmt.Errorf("%s must be a number", name)
+	}
+	return v.Int(), nil
+}
+
+// jsBytes returns a Uint8Array view of a JS typed array.
+func jsBytes(v js.Value) js.Value {
+	return js.Global().Get("Uint8Array").New(v.Get("buffer"), v.Get("byteOffset"), v.Get("byteLength"))
+}
+
+// jsToFloat64s copies a JS Float64Array to a Go slice.
+func jsToFloat64s(v js.Value, name string) ([]float64, error) {
+	if v.Type() != js.TypeObject || !v.InstanceOf(js.Global().Get("Float64Array")) {
+		return nil, fmt.Errorf("%s must be a Float64Array", name)
+	}
+	u8 := jsBytes(v)
+	buf := make([]byte, u8.Length())
+	js.CopyBytesToGo(buf, u8)
+	x := make([]float64, len(buf)/8)
+	for i := range x {
+		x[i] = math.Float64frombits(binary.LittleEndian.Uint64(buf[8*i:]))
+	}
+	return x, nil
+}
+
+// float64sToJS copies a Go slice to a JS Float64Array.
+func float64sToJS(x []float64) js.Value {
+	buf := make([]byte, 8*len(x))
+	for i, f := range x {
+		binary.LittleEndian.PutUint64(buf[8*i:], math.Float64bits(f))
+	}
+	v := js.Global().Get("Float64Array").New(len(x))
+	js.CopyBytesToJS(jsBytes(v), buf)
+	return v
+}
+
+// float32sToJS copies a Go slice to a JS Float32Array.
+func float32sToJS(x []float32) js.Value {
+	buf := make([]byte, 4*len(x))
+	for i, f := range x {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(f))
+	}
+	v := js.Global().Get("Float32Array").New(len(x))
+	js.CopyBytesToJS(jsBytes(v), buf)
+	return v
+}
+
+// jsError returns a JS Error object.
+func jsError(err error) js.Value {
+	return js.Global().Get("Error").New(err.Error())
+}
+
+//-----------------------------------------------------------------------------
+
+// model3 is a 3d model exported to JS.
+type model3 struct {
+	fn Model3
+}
+
+// build builds the model from the JS parameters (the first argument).
+func (m *model3) build(args []js.Value, n int) (sdf.SDF3, error) {
+	if len(args) != n {
+		return nil, fmt.Errorf("expected %d arguments, got %d", n, len(args))
+	}
+	params, err := jsParams(args[0])
+	if err != nil {
+		return nil, err
+	}
+	s, err := m.fn(params)
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		return nil, errors.New("model is nil")
+	}
+	return s, nil
+}
+
+// bounds returns the bounding box of the model.
+func (m *model3) bounds(this js.Value, args []js.Value) interface{} {
+	s, err := m.build(args, 1)
+	if err != nil {
+		return jsError(err)
+	}
+	bb := s.BoundingBox()
+	return float64sToJS([]float64{bb.Min.X, bb.Min.Y, bb.Min.Z, bb.Max.X, bb.Max.Y, bb.Max.Z})
+}
+
+// evaluate evaluates the model at a set of points.
+func (m *model3) evaluate(this js.Value, args []js.Value) interface{} {
+	s, err := m.build(args, 2)
+	if err != nil {
+		return jsError(err)
+	}
+	p, err := jsToFloat64s(args[1], "points")
+	if err != nil {
+		return jsError(err)
+	}
+	if len(p)%3 != 0 {
+		return jsError(errors.New("points must have 3 values per point"))
+	}
+	d := make([]float64, len(p)/3)
+	for i := range d {
+		d[i] = s.Evaluate(sdf.V3{X: p[3*i], Y: p[3*i+1], Z: p[3*i+2]})
+	}
+	return float64sToJS(d)
+}
+
+// evaluateGrid evaluates the model on a grid over the bounding box.
+func (m *model3) evaluateGrid(this js.Value, args []js.Value) interface{} {
+	s, err := m.build(args, 4)
+	if err != nil {
+		return jsError(err)
+	}
+	var n sdf.V3i
+	for i, name := range []string{"nx", "ny", "nz"} {
+		if n[i], err = jsInt(args[1+i], name); err != nil {
+			return jsError(err)
+		}
+	}
+	if n[0] < 2 || n[1] < 2 || n[2] < 2 {
+		return jsError(errors.New("grid size must be >= 2 on each axis"))
+	}
+	bb := s.BoundingBox()
+	inc := bb.Size().Div(n.SubScalar(1).ToV3())
+	d := make([]float64, 0, n[0]*n[1]*n[2])
+	for k := 0; k < n[2]; k++ {
+		for j := 0; j < n[1]; j++ {
+			for i := 0; i < n[0]; i++ {
+				p := bb.Min.Add(sdf.V3i{i, j, k}.ToV3().Mul(inc))
+				d = append(d, s.Evaluate(p))
+			}
+		}
+	}
+	return float64sToJS(d)
+}
+
+// mesh returns the triangle mesh for the model.
+func (m *model3) mesh(this js.Value, args []js.Value) interface{} {
+	s, err := m.build(args, 2)
+	if err != nil {
+		return jsError(err)
+	}
+	cells, err := jsInt(args[1], "cells")
+	if err != nil {
+		return jsError(err)
+	}
+	if cells <= 0 {
+		return jsError(errors.New("cells must be > 0"))
+	}
+	mesh := sdf.GenerateTriangles(s, cells)
+	v := make([]float32, 0, 9*len(mesh))
+	for _, t := range mesh {
+		for _, x := range t.V {
+			v = append(v, float32(x.X), float32(x.Y), float32(x.Z))
+		}
+	}
+	return float32sToJS(v)
+}
+
+//-----------------------------------------------------------------------------
+
+// Export3 exports a 3d model to JS as a global object with the given name.
+func Export3(name string, fn Model3) {
+	m := &model3{fn: fn}
+	obj := js.Global().Get("Object").New()
+	obj.Set("bounds", js.FuncOf(m.bounds))
+	obj.Set("evaluate", js.FuncOf(m.evaluate))
+	obj.Set("evaluateGrid", js.FuncOf(m.evaluateGrid))
+	obj.Set("mesh", js.FuncOf(m.mesh))
+	js.Global().Set(name, obj)
+}
+
+//-----------------------------------------------------------------------------